@@ -1,8 +1,24 @@
-package main
-
-import "github.com/yanglinshu/glock/internal/cli"
-
-func main() {
-	cli := cli.CLI{}
-	cli.Run()
-}
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/yanglinshu/glock/internal/cli"
+)
+
+func main() {
+	// The first interrupt stops a running node cleanly, a second one kills the process
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	cli := cli.CLI{}
+	cli.Run(ctx)
+}
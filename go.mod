@@ -3,7 +3,7 @@ module github.com/yanglinshu/glock
 go 1.18
 
 require (
-	github.com/boltdb/bolt v1.3.1
+	go.etcd.io/bbolt v1.3.9
 	golang.org/x/crypto v0.7.0
-	golang.org/x/sys v0.6.0 // indirect
+	golang.org/x/sys v0.6.0
 )
@@ -1,75 +1,201 @@
-package block
-
-import (
-	"bytes"
-	"encoding/gob"
-	"time"
-
-	"github.com/yanglinshu/glock/internal/transaction"
-	"github.com/yanglinshu/glock/internal/util"
-)
-
-// Block represents a block in the blockchain. It contains the header and the transactions.
-type Block struct {
-	Timestamp     int64                      // Time of creation of the block
-	Transactions  []*transaction.Transaction // Transactions in the block
-	PrevBlockHash []byte                     // Hash of the previous block
-	Hash          []byte                     // Hash of the current block
-	Nonce         int                        // Nonce is the number of times the hash of the block is calculated
-	Height        int                        // Height of the block in the blockchain
-}
-
-// NewBlock creates and returns a pointer to a Block.
-func NewBlock(transactions []*transaction.Transaction, prevBlockHash []byte, height int) *Block {
-	block := &Block{time.Now().Unix(), transactions, prevBlockHash, []byte{}, 0, height}
-	pow := NewProofOfWork(block)
-	nonce, hash := pow.Run()
-
-	block.Hash = hash[:]
-	block.Nonce = nonce
-
-	return block
-}
-
-// NewGenesisBlock creates and returns a pointer to a genesis block.
-func NewGenesisBlock(coinbase *transaction.Transaction) *Block {
-	return NewBlock([]*transaction.Transaction{coinbase}, []byte{}, 0)
-}
-
-// Serialize serializes the block into a byte slice using the Gob encoding.
-func (b *Block) Serialize() ([]byte, error) {
-	result, err := util.GobEncode(b)
-	if err != nil {
-		return nil, err
-	}
-
-	return result, nil
-}
-
-// HashTransactions returns the hash of the transactions in the block.
-// In Bitcoin, the transactions are hashed in the Merkle tree, allowing for efficient verification
-// of the transactions in the block.
-func (b *Block) HashTransactions() []byte {
-	var txHashes [][]byte
-
-	for _, tx := range b.Transactions {
-		txHashes = append(txHashes, tx.ID)
-	}
-	mTree := NewMerkleTree(txHashes)
-
-	return mTree.RootNode.Data
-}
-
-// DeserializeBlock deserializes a byte slice into a block using the Gob encoding.
-func DeserializeBlock(d []byte) (*Block, error) {
-	var block Block
-
-	decoder := gob.NewDecoder(bytes.NewReader(d))
-	err := decoder.Decode(&block)
-
-	if err != nil {
-		return nil, err
-	}
-
-	return &block, nil
-}
+package block
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/transaction"
+	"github.com/yanglinshu/glock/internal/util"
+)
+
+// Block represents a block in the blockchain. It contains the header and the transactions.
+type Block struct {
+	Timestamp     int64                      // Time of creation of the block
+	Transactions  []*transaction.Transaction // Transactions in the block
+	PrevBlockHash []byte                     // Hash of the previous block
+	Hash          []byte                     // Hash of the current block
+	Nonce         int                        // Nonce is the number of times the hash of the block is calculated
+	Height        int                        // Height of the block in the blockchain
+	Bits          int                        // Target of the hash in compact form, or before CompactBitsVersion its number of leading zero bits
+	MerkleRoot    []byte                     // Root of the Merkle tree of the transactions, committed to by the hash
+	Version       int                        // Version selects the layout of the data hashed by the proof-of-work
+}
+
+// BinaryHeaderVersion is the first block version whose proof-of-work hashes its integers in
+// fixed-width binary, so the layout of the hashed data no longer depends on their magnitude. Blocks
+// stored before have version 0 and keep the hexadecimal layout.
+const BinaryHeaderVersion = 1
+
+// TimestampRulesVersion is the first block version whose timestamp must come after the median time
+// of its last ancestors. Blocks of earlier versions were mined before the rule and are not held
+// to it.
+const TimestampRulesVersion = 2
+
+// CoinbaseHeightVersion is the first block version whose coinbase commits to the height of the
+// block, so two coinbases paying the same address never share an ID.
+const CoinbaseHeightVersion = 3
+
+// CompactBitsVersion is the first block version whose Bits hold its target in compact form instead
+// of a number of leading zero bits, so the difficulty can move by less than a factor of two.
+const CompactBitsVersion = 4
+
+// CurrentVersion is the version of the blocks mined
+const CurrentVersion = CompactBitsVersion
+
+// NewBlock creates and returns a pointer to a Block with the given timestamp, mined at the target
+// of the given compact bits using every available core. The progress of mining is reported to
+// progress if it is not nil. Mining stops with the error of ctx once ctx is done.
+func NewBlock(ctx context.Context, transactions []*transaction.Transaction, prevBlockHash []byte, height, bits int, timestamp int64, progress ProgressFunc) (*Block, error) {
+	block := NewBlockTemplate(transactions, prevBlockHash, height, bits, timestamp)
+
+	err := block.Mine(ctx, progress)
+	if err != nil {
+		return nil, err
+	}
+
+	return block, nil
+}
+
+// NewBlockTemplate creates and returns a pointer to an unmined Block with the given timestamp and
+// compact bits. Its Merkle root is set, while its nonce is 0 and its hash empty until it is mined.
+func NewBlockTemplate(transactions []*transaction.Transaction, prevBlockHash []byte, height, bits int, timestamp int64) *Block {
+	block := &Block{timestamp, transactions, prevBlockHash, []byte{}, 0, height, bits, nil, CurrentVersion}
+	block.MerkleRoot = block.HashTransactions()
+
+	return block
+}
+
+// Mine finds a nonce putting the hash of the block below its target using every available core,
+// and sets the nonce and hash of the block. The progress of mining is reported to progress if it is
+// not nil. Mining stops with the error of ctx once ctx is done.
+func (b *Block) Mine(ctx context.Context, progress ProgressFunc) error {
+	pow := NewProofOfWork(b)
+	pow.SetProgress(progress)
+	nonce, hash, err := pow.RunParallel(ctx, 0)
+	if err != nil {
+		return err
+	}
+
+	b.Hash = hash[:]
+	b.Nonce = nonce
+
+	return nil
+}
+
+// NewGenesisBlock creates and returns a pointer to a genesis block, which sets the difficulty of
+// the chain to the given number of leading zero bits.
+func NewGenesisBlock(coinbase *transaction.Transaction, targetBits int, timestamp int64) (*Block, error) {
+	bits := int(TargetBitsToCompact(targetBits))
+	return NewBlock(context.Background(), []*transaction.Transaction{coinbase}, []byte{}, 0, bits, timestamp, nil)
+}
+
+// Serialize serializes the block into a byte slice using the Gob encoding.
+func (b *Block) Serialize() ([]byte, error) {
+	result, err := util.GobEncode(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// HashTransactions computes the hash of the transactions in the block, which MerkleRoot must hold.
+// In Bitcoin, the transactions are hashed in the Merkle tree, allowing for efficient verification
+// of the transactions in the block.
+func (b *Block) HashTransactions() []byte {
+	var txHashes [][]byte
+
+	for _, tx := range b.Transactions {
+		txHashes = append(txHashes, tx.ID)
+	}
+	mTree := NewMerkleTree(txHashes)
+
+	return mTree.RootNode.Data
+}
+
+// MerkleProof returns the position of a transaction in the block and the proof of its inclusion,
+// see MerkleTree.Proof. The leaf proven is the hash of the transaction ID. It returns
+// ErrTransactionNotFound if the block does not hold the transaction.
+func (b *Block) MerkleProof(txID []byte) (int, [][]byte, error) {
+	var txHashes [][]byte
+	index := -1
+
+	for i, tx := range b.Transactions {
+		txHashes = append(txHashes, tx.ID)
+		if bytes.Equal(tx.ID, txID) {
+			index = i
+		}
+	}
+
+	if index < 0 {
+		return 0, nil, errors.ErrTransactionNotFound
+	}
+
+	proof, err := NewMerkleTree(txHashes).Proof(index)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return index, proof, nil
+}
+
+// MaxSerializedSize is the largest encoded block decoded. Larger payloads are rejected before any
+// decoding, so a hostile peer cannot make the node allocate for them.
+const MaxSerializedSize = 32 << 20
+
+// checkDecoded rejects a decoded block missing the fields every block has, the hash being left out
+// of a template.
+func (b *Block) checkDecoded(template bool) error {
+	if (len(b.Hash) == 0 && !template) || b.Height < 0 || len(b.Transactions) == 0 {
+		return errors.ErrMalformedBlock
+	}
+
+	for _, tx := range b.Transactions {
+		if tx == nil {
+			return errors.ErrMalformedBlock
+		}
+	}
+
+	return nil
+}
+
+// DeserializeBlock deserializes a byte slice into a block using the Gob encoding.
+func DeserializeBlock(d []byte) (*Block, error) {
+	return deserializeBlock(d, false)
+}
+
+// DeserializeTemplate deserializes a byte slice into an unmined block, as built by NewBlockTemplate,
+// using the Gob encoding.
+func DeserializeTemplate(d []byte) (*Block, error) {
+	return deserializeBlock(d, true)
+}
+
+// deserializeBlock deserializes a byte slice into a block, or an unmined one if template is set.
+func deserializeBlock(d []byte, template bool) (*Block, error) {
+	var block Block
+
+	if len(d) > MaxSerializedSize {
+		return nil, errors.ErrPayloadTooLarge
+	}
+
+	decoder := gob.NewDecoder(bytes.NewReader(d))
+	err := decoder.Decode(&block)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = block.checkDecoded(template)
+	if err != nil {
+		return nil, err
+	}
+
+	// Blocks stored before the Merkle root was recorded committed to the same root
+	if len(block.MerkleRoot) == 0 {
+		block.MerkleRoot = block.HashTransactions()
+	}
+
+	return &block, nil
+}
@@ -0,0 +1,85 @@
+package block
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/yanglinshu/glock/internal/errors"
+)
+
+func TestDeserializeBlockRejectsMalformed(t *testing.T) {
+	for name, malform := range map[string]func(b *Block){
+		"no hash":         func(b *Block) { b.Hash = nil },
+		"negative height": func(b *Block) { b.Height = -1 },
+		"no transaction":  func(b *Block) { b.Transactions = nil },
+	} {
+		b := newTestBlock(t, 1)
+		malform(b)
+
+		data, err := b.Serialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = DeserializeBlock(data)
+		if !errors.Is(err, errors.ErrMalformedBlock) {
+			t.Fatalf("DeserializeBlock of a block with %s = %v, want ErrMalformedBlock", name, err)
+		}
+	}
+
+	_, err := DeserializeBlock(bytes.Repeat([]byte{0}, MaxSerializedSize+1))
+	if !errors.Is(err, errors.ErrPayloadTooLarge) {
+		t.Fatalf("DeserializeBlock of %d bytes = %v, want ErrPayloadTooLarge", MaxSerializedSize+1, err)
+	}
+
+	// A template has no hash until it is mined
+	b := newTestBlock(t, 1)
+	b.Hash = nil
+
+	data, err := b.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = DeserializeTemplate(data)
+	if err != nil {
+		t.Fatalf("DeserializeTemplate of an unmined block: %v", err)
+	}
+}
+
+func FuzzDeserializeBlock(f *testing.F) {
+	data, err := newTestBlock(f, 1).Serialize()
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	f.Add(data)
+	f.Add(data[:len(data)/2])
+	f.Add([]byte{})
+	for _, i := range []int{0, len(data) / 3, len(data) - 1} {
+		corrupt := append([]byte{}, data...)
+		corrupt[i] ^= 0xff
+		f.Add(corrupt)
+	}
+
+	// A decoded block has the fields a node relies on, whatever a peer sends
+	f.Fuzz(func(t *testing.T, data []byte) {
+		b, err := DeserializeBlock(data)
+		if err != nil {
+			return
+		}
+
+		if len(b.Hash) == 0 || b.Height < 0 || len(b.Transactions) == 0 {
+			t.Fatalf("DeserializeBlock returned a malformed block %+v", b)
+		}
+
+		for _, tx := range b.Transactions {
+			if tx == nil {
+				t.Fatal("DeserializeBlock returned a block holding a nil transaction")
+			}
+		}
+
+		b.HashTransactions()
+		NewProofOfWork(b).Validate()
+	})
+}
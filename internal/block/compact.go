@@ -0,0 +1,113 @@
+package block
+
+import "math/big"
+
+// From CompactBitsVersion on, the Bits of a block hold its target in the compact encoding of
+// Bitcoin: the high byte is the size of the target in bytes and the low 23 bits its most
+// significant bits, bit 23 being the sign.
+//
+//	size (byte) | sign (1 bit) | mantissa (23 bits)
+//
+// Before, they hold the number of leading zero bits required in the hash.
+
+// MaxTarget is the easiest target a block may carry, one leading zero bit in its hash
+var MaxTarget = new(big.Int).Lsh(big.NewInt(1), 255)
+
+// CompactToTarget returns the target encoded by compact bits. A set sign bit gives a negative
+// target, which no hash is below.
+func CompactToTarget(bits uint32) *big.Int {
+	mantissa := int64(bits & 0x007fffff)
+	size := uint(bits >> 24)
+
+	var target *big.Int
+	if size <= 3 {
+		target = big.NewInt(mantissa >> (8 * (3 - size)))
+	} else {
+		target = new(big.Int).Lsh(big.NewInt(mantissa), 8*(size-3))
+	}
+
+	if bits&0x00800000 != 0 {
+		target.Neg(target)
+	}
+
+	return target
+}
+
+// TargetToCompact returns the compact encoding of a target. Only the three most significant bytes
+// of the target are kept, so the target decoded from it may be lower.
+func TargetToCompact(target *big.Int) uint32 {
+	if target.Sign() == 0 {
+		return 0
+	}
+
+	abs := new(big.Int).Abs(target)
+	size := uint(len(abs.Bytes()))
+
+	var mantissa uint32
+	if size <= 3 {
+		mantissa = uint32(abs.Uint64()) << (8 * (3 - size))
+	} else {
+		mantissa = uint32(new(big.Int).Rsh(abs, 8*(size-3)).Uint64())
+	}
+
+	// The mantissa is signed, so a set high bit moves to the next byte
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		size++
+	}
+
+	compact := uint32(size)<<24 | mantissa
+	if target.Sign() < 0 {
+		compact |= 0x00800000
+	}
+
+	return compact
+}
+
+// TargetBitsToCompact returns the compact encoding of the target requiring the given number of
+// leading zero bits in the hash.
+func TargetBitsToCompact(targetBits int) uint32 {
+	return TargetToCompact(new(big.Int).Lsh(big.NewInt(1), uint(256-targetBits)))
+}
+
+// targetOf returns the target of a block of the given version carrying the given Bits.
+func targetOf(version, bits int) *big.Int {
+	if version >= CompactBitsVersion {
+		return CompactToTarget(uint32(bits))
+	}
+
+	if bits == 0 {
+		bits = DefaultTargetBits
+	}
+
+	if bits < 1 || bits > 255 {
+		return new(big.Int)
+	}
+
+	return new(big.Int).Lsh(big.NewInt(1), uint(256-bits))
+}
+
+// headerBits returns the Bits hashed by the proof-of-work of a block of the given version carrying
+// the given Bits: the compact target from CompactBitsVersion on, and the number of leading zero bits
+// before.
+func headerBits(version, bits int) int {
+	if version >= CompactBitsVersion {
+		return bits
+	}
+
+	return TargetZeroBits(targetOf(version, bits))
+}
+
+// TargetZeroBits returns the number of leading zero bits of every hash below the target.
+func TargetZeroBits(target *big.Int) int {
+	if target.Sign() <= 0 {
+		return 256
+	}
+
+	return 256 - new(big.Int).Sub(target, big.NewInt(1)).BitLen()
+}
+
+// validTarget checks that a target is positive and no easier than MaxTarget.
+func validTarget(target *big.Int) bool {
+	return target.Sign() > 0 && target.Cmp(MaxTarget) <= 0
+}
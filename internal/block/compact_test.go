@@ -0,0 +1,94 @@
+package block
+
+import (
+	"math/big"
+	"testing"
+)
+
+// bigHex parses a target in hex, failing the test on an invalid one
+func bigHex(t *testing.T, s string) *big.Int {
+	t.Helper()
+
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		t.Fatalf("invalid hex %q", s)
+	}
+
+	return n
+}
+
+func TestCompactVectors(t *testing.T) {
+	// The vectors of Bitcoin Core: the target encoded by compact bits, and the bits it encodes back to
+	for _, tt := range []struct {
+		bits    uint32
+		target  string
+		encoded uint32
+	}{
+		{0x00000000, "0", 0x00000000},
+		{0x00123456, "0", 0x00000000},
+		{0x01003456, "0", 0x00000000},
+		{0x02000056, "0", 0x00000000},
+		{0x03000000, "0", 0x00000000},
+		{0x04000000, "0", 0x00000000},
+		{0x00923456, "0", 0x00000000},
+		{0x01803456, "0", 0x00000000},
+		{0x02800056, "0", 0x00000000},
+		{0x03800000, "0", 0x00000000},
+		{0x04800000, "0", 0x00000000},
+		{0x01123456, "12", 0x01120000},
+		{0x01fedcba, "-7e", 0x01fe0000},
+		{0x02123456, "1234", 0x02123400},
+		{0x03123456, "123456", 0x03123456},
+		{0x04123456, "12345600", 0x04123456},
+		{0x04923456, "-12345600", 0x04923456},
+		{0x05009234, "92340000", 0x05009234},
+		{0x20123456, "1234560000000000000000000000000000000000000000000000000000000000", 0x20123456},
+		{0x1d00ffff, "ffff0000000000000000000000000000000000000000000000000000", 0x1d00ffff},
+	} {
+		want := bigHex(t, tt.target)
+
+		target := CompactToTarget(tt.bits)
+		if target.Cmp(want) != 0 {
+			t.Fatalf("CompactToTarget(%#08x) = %x, want %x", tt.bits, target, want)
+		}
+
+		if encoded := TargetToCompact(target); encoded != tt.encoded {
+			t.Fatalf("TargetToCompact(%x) = %#08x, want %#08x", target, encoded, tt.encoded)
+		}
+	}
+}
+
+func TestTargetToCompactKeepsThreeBytes(t *testing.T) {
+	// Only the three most significant bytes survive, so the decoded target is lower
+	target := bigHex(t, "123456789a")
+
+	bits := TargetToCompact(target)
+	if bits != 0x05123456 {
+		t.Fatalf("TargetToCompact(%x) = %#08x, want 0x05123456", target, bits)
+	}
+
+	if decoded := CompactToTarget(bits); decoded.Cmp(bigHex(t, "1234560000")) != 0 {
+		t.Fatalf("CompactToTarget(%#08x) = %x, want 1234560000", bits, decoded)
+	}
+}
+
+func TestTargetBitsToCompact(t *testing.T) {
+	if bits := TargetBitsToCompact(1); CompactToTarget(bits).Cmp(MaxTarget) != 0 {
+		t.Fatalf("TargetBitsToCompact(1) = %#08x, want the bits of MaxTarget", bits)
+	}
+
+	// Every number of leading zero bits is encoded exactly, as a power of two
+	for zeroBits := 1; zeroBits < 256; zeroBits++ {
+		target := CompactToTarget(TargetBitsToCompact(zeroBits))
+
+		if !validTarget(target) || TargetZeroBits(target) != zeroBits {
+			t.Fatalf("target of TargetBitsToCompact(%d) = %x, %d leading zero bits", zeroBits, target, TargetZeroBits(target))
+		}
+	}
+
+	for _, target := range []*big.Int{new(big.Int), big.NewInt(-1), new(big.Int).Lsh(MaxTarget, 1)} {
+		if validTarget(target) {
+			t.Fatalf("validTarget(%x) = true, want false", target)
+		}
+	}
+}
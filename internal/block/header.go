@@ -0,0 +1,110 @@
+package block
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"math/big"
+
+	"github.com/yanglinshu/glock/internal/util"
+)
+
+// BlockHeader is a block without its transactions, which are only committed to by their Merkle
+// root. It holds everything needed to check the proof-of-work of the block.
+type BlockHeader struct {
+	Timestamp     int64  // Time of creation of the block
+	PrevBlockHash []byte // Hash of the previous block
+	Hash          []byte // Hash of the block
+	Nonce         int    // Nonce solving the proof-of-work
+	Height        int    // Height of the block in the blockchain
+	Bits          int    // Target of the hash in compact form, or before CompactBitsVersion its number of leading zero bits
+	MerkleRoot    []byte // Root of the Merkle tree of the transactions of the block
+	Version       int    // Version selects the layout of the data hashed by the proof-of-work
+}
+
+// Header returns the header of the block.
+func (b *Block) Header() BlockHeader {
+	return BlockHeader{
+		Timestamp:     b.Timestamp,
+		PrevBlockHash: b.PrevBlockHash,
+		Hash:          b.Hash,
+		Nonce:         b.Nonce,
+		Height:        b.Height,
+		Bits:          b.Bits,
+		MerkleRoot:    b.MerkleRoot,
+		Version:       b.Version,
+	}
+}
+
+// Target returns the upper bound of the hash of the block, as given by its Bits.
+func (h *BlockHeader) Target() *big.Int {
+	return targetOf(h.Version, h.Bits)
+}
+
+// TargetBits returns the number of leading zero bits required in the hash of the block.
+func (h *BlockHeader) TargetBits() int {
+	return TargetZeroBits(h.Target())
+}
+
+// Validate checks the proof-of-work of the header: its fields must hash to the hash it carries,
+// and the hash must be below the valid target given by its own Bits.
+func (h *BlockHeader) Validate() bool {
+	var hashInt big.Int
+
+	target := h.Target()
+	if !validTarget(target) {
+		return false
+	}
+
+	hash := sha256.Sum256(headerData(h.Version, h.PrevBlockHash, h.MerkleRoot, h.Timestamp, headerBits(h.Version, h.Bits), h.Nonce))
+	hashInt.SetBytes(hash[:])
+
+	return hashInt.Cmp(target) == -1 && bytes.Equal(hash[:], h.Hash)
+}
+
+// headerData returns the data hashed by the proof-of-work of a block. From BinaryHeaderVersion on,
+// the version and the integers are hashed as 8-byte big-endian values.
+func headerData(version int, prevBlockHash, merkleRoot []byte, timestamp int64, bits, nonce int) []byte {
+	if version >= BinaryHeaderVersion {
+		return bytes.Join(
+			[][]byte{
+				prevBlockHash,
+				merkleRoot,
+				util.Int64ToBytes(int64(version)),
+				util.Int64ToBytes(timestamp),
+				util.Int64ToBytes(int64(bits)),
+				util.Int64ToBytes(int64(nonce)),
+			},
+			[]byte{},
+		)
+	}
+
+	return bytes.Join(
+		[][]byte{
+			prevBlockHash,
+			merkleRoot,
+			util.IntToHex(timestamp),
+			util.IntToHex(int64(bits)),
+			util.IntToHex(int64(nonce)),
+		},
+		[]byte{},
+	)
+}
+
+// SerializeHeaders serializes headers into a byte slice using the Gob encoding.
+func SerializeHeaders(headers []BlockHeader) ([]byte, error) {
+	return util.GobEncode(headers)
+}
+
+// DeserializeHeaders deserializes a byte slice into headers using the Gob encoding.
+func DeserializeHeaders(d []byte) ([]BlockHeader, error) {
+	var headers []BlockHeader
+
+	decoder := gob.NewDecoder(bytes.NewReader(d))
+	err := decoder.Decode(&headers)
+	if err != nil {
+		return nil, err
+	}
+
+	return headers, nil
+}
@@ -1,64 +1,121 @@
-package block
-
-import "crypto/sha256"
-
-// MerkleTree is a struct that contains a pointer to the root node of the tree
-type MerkleTree struct {
-	RootNode *MerkleNode
-}
-
-// MerkleNode is a struct that contains a pointer to the left and right node of the tree
-type MerkleNode struct {
-	Left  *MerkleNode
-	Right *MerkleNode
-	Data  []byte
-}
-
-// NewMerkleTree creates a new Merkle tree based on a sequence of data
-func NewMerkleTree(data [][]byte) *MerkleTree {
-	var nodes []MerkleNode
-
-	// If the number of data is odd, duplicate the last data
-	if len(data)&1 != 0 {
-		data = append(data, data[len(data)-1])
-	}
-
-	// Create a leaf node for each piece of data and add it to the node list
-	for _, datum := range data {
-		node := NewMerkleNode(nil, nil, datum)
-		nodes = append(nodes, node)
-	}
-
-	// Create a parent node for each two child nodes until there is only one node left
-	for i := 0; i < len(data)/2; i++ {
-		var newLevel []MerkleNode
-		for j := 0; j < len(nodes); j += 2 {
-			node := NewMerkleNode(&nodes[j], &nodes[j+1], nil)
-			newLevel = append(newLevel, node)
-		}
-		nodes = newLevel
-	}
-
-	// The root node is the only node left
-	mTree := MerkleTree{&nodes[0]}
-	return &mTree
-}
-
-// NewMerkleNode creates a new Merkle node based on the left and right child nodes
-func NewMerkleNode(left, right *MerkleNode, data []byte) MerkleNode {
-	mNode := MerkleNode{}
-
-	if left == nil && right == nil {
-		hash := sha256.Sum256(data)
-		mNode.Data = hash[:]
-	} else {
-		prevHashes := append(left.Data, right.Data...)
-		hash := sha256.Sum256(prevHashes)
-		mNode.Data = hash[:]
-	}
-
-	mNode.Left = left
-	mNode.Right = right
-
-	return mNode
-}
+package block
+
+import (
+	"bytes"
+	"crypto/sha256"
+
+	"github.com/yanglinshu/glock/internal/errors"
+)
+
+// MerkleTree is a struct that contains a pointer to the root node of the tree
+type MerkleTree struct {
+	RootNode *MerkleNode
+	leaves   int // the number of pieces of data the tree was built from
+}
+
+// MerkleNode is a struct that contains a pointer to the left and right node of the tree
+type MerkleNode struct {
+	Left  *MerkleNode
+	Right *MerkleNode
+	Data  []byte
+}
+
+// NewMerkleTree creates a new Merkle tree based on a sequence of data. Whenever a level has an odd
+// number of nodes, its last node is paired with a copy of itself, as in Bitcoin. A single piece of
+// data is paired with itself as well, so the root is never a leaf.
+func NewMerkleTree(data [][]byte) *MerkleTree {
+	var nodes []MerkleNode
+
+	// Create a leaf node for each piece of data and add it to the node list
+	for _, datum := range data {
+		node := NewMerkleNode(nil, nil, datum)
+		nodes = append(nodes, node)
+	}
+
+	// Create a parent node for each two child nodes until there is only one node left above the
+	// leaves
+	for level := 0; level == 0 || len(nodes) > 1; level++ {
+		if len(nodes)&1 != 0 {
+			nodes = append(nodes, nodes[len(nodes)-1])
+		}
+
+		var newLevel []MerkleNode
+		for j := 0; j < len(nodes); j += 2 {
+			node := NewMerkleNode(&nodes[j], &nodes[j+1], nil)
+			newLevel = append(newLevel, node)
+		}
+		nodes = newLevel
+	}
+
+	// The root node is the only node left
+	mTree := MerkleTree{&nodes[0], len(data)}
+	return &mTree
+}
+
+// NewMerkleNode creates a new Merkle node based on the left and right child nodes
+func NewMerkleNode(left, right *MerkleNode, data []byte) MerkleNode {
+	mNode := MerkleNode{}
+
+	if left == nil && right == nil {
+		hash := sha256.Sum256(data)
+		mNode.Data = hash[:]
+	} else {
+		prevHashes := append(left.Data, right.Data...)
+		hash := sha256.Sum256(prevHashes)
+		mNode.Data = hash[:]
+	}
+
+	mNode.Left = left
+	mNode.Right = right
+
+	return mNode
+}
+
+// Proof returns the hashes of the siblings along the path from the leaf at index to the root,
+// starting from the leaf. Together with the leaf hash, they are enough to recompute the root.
+func (t *MerkleTree) Proof(index int) ([][]byte, error) {
+	if index < 0 || index >= t.leaves {
+		return nil, errors.ErrInvalidLeafIndex
+	}
+
+	depth := 0
+	for node := t.RootNode; node.Left != nil; node = node.Left {
+		depth++
+	}
+
+	// Walk down from the root, the bits of the index choosing the branch at every level
+	proof := make([][]byte, depth)
+	node := t.RootNode
+	for level := depth - 1; level >= 0; level-- {
+		if (index>>level)&1 == 0 {
+			proof[level] = node.Right.Data
+			node = node.Left
+		} else {
+			proof[level] = node.Left.Data
+			node = node.Right
+		}
+	}
+
+	return proof, nil
+}
+
+// VerifyProof checks that the leaf with the given hash sits at index in the Merkle tree with the
+// given root, using the sibling hashes returned by MerkleTree.Proof.
+func VerifyProof(root, leafHash []byte, index int, proof [][]byte) bool {
+	if index < 0 || index>>len(proof) != 0 {
+		return false
+	}
+
+	hash := leafHash
+	for level, sibling := range proof {
+		var sum [32]byte
+		if (index>>level)&1 == 0 {
+			sum = sha256.Sum256(append(append([]byte{}, hash...), sibling...))
+		} else {
+			sum = sha256.Sum256(append(append([]byte{}, sibling...), hash...))
+		}
+		hash = sum[:]
+	}
+
+	return bytes.Equal(hash, root)
+}
@@ -0,0 +1,131 @@
+package block
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// leaves returns n distinct pieces of data
+func leaves(n int) [][]byte {
+	data := make([][]byte, n)
+	for i := range data {
+		data[i] = []byte{byte(i)}
+	}
+
+	return data
+}
+
+func TestMerkleProofs(t *testing.T) {
+	for n := 1; n <= 17; n++ {
+		data := leaves(n)
+		tree := NewMerkleTree(data)
+		root := tree.RootNode.Data
+
+		for i, datum := range data {
+			proof, err := tree.Proof(i)
+			if err != nil {
+				t.Fatalf("Proof(%d) of %d leaves: %v", i, n, err)
+			}
+
+			leaf := sha256.Sum256(datum)
+			if !VerifyProof(root, leaf[:], i, proof) {
+				t.Fatalf("the proof of leaf %d of %d does not verify", i, n)
+			}
+
+			// The proof holds for that leaf at that position only
+			other := sha256.Sum256([]byte("other"))
+			if VerifyProof(root, other[:], i, proof) {
+				t.Fatalf("the proof of leaf %d of %d verifies another leaf", i, n)
+			}
+
+			if VerifyProof(root, leaf[:], i+1<<len(proof), proof) || VerifyProof(root, leaf[:], -1, proof) {
+				t.Fatalf("the proof of leaf %d of %d verifies at a position beyond the tree", i, n)
+			}
+
+			tampered := append([][]byte{}, proof...)
+			tampered[len(tampered)-1] = other[:]
+			if VerifyProof(root, leaf[:], i, tampered) {
+				t.Fatalf("a tampered proof of leaf %d of %d verifies", i, n)
+			}
+		}
+
+		for _, i := range []int{-1, n} {
+			_, err := tree.Proof(i)
+			if !errors.Is(err, errors.ErrInvalidLeafIndex) {
+				t.Fatalf("Proof(%d) of %d leaves = %v, want ErrInvalidLeafIndex", i, n, err)
+			}
+		}
+	}
+}
+
+func TestBlockMerkleProof(t *testing.T) {
+	// A block holding only its coinbase
+	b := newTestBlock(t, 1)
+	coinbase := b.Transactions[0]
+
+	index, proof, err := b.MerkleProof(coinbase.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf := sha256.Sum256(coinbase.ID)
+	if index != 0 || len(proof) != 1 || !VerifyProof(b.MerkleRoot, leaf[:], index, proof) {
+		t.Fatalf("the proof of the only transaction of a block is at %d with %d hashes and does not verify", index, len(proof))
+	}
+
+	// An odd number of transactions
+	for i := 0; i < 2; i++ {
+		b.Transactions = append(b.Transactions, &transaction.Transaction{ID: []byte{byte(i)}})
+	}
+	root := b.HashTransactions()
+
+	for i, tx := range b.Transactions {
+		index, proof, err := b.MerkleProof(tx.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		leaf := sha256.Sum256(tx.ID)
+		if index != i || !VerifyProof(root, leaf[:], index, proof) {
+			t.Fatalf("the proof of transaction %d of 3 does not verify", i)
+		}
+	}
+
+	_, _, err = b.MerkleProof([]byte("missing"))
+	if !errors.Is(err, errors.ErrTransactionNotFound) {
+		t.Fatalf("MerkleProof of a missing transaction = %v, want ErrTransactionNotFound", err)
+	}
+}
+
+func TestMerkleRoots(t *testing.T) {
+	// Roots of the trees over the single bytes 0 to n-1, computed independently with the last node
+	// of every odd level paired with a copy of itself
+	roots := map[int]string{
+		1:  "b289dea92ca5aba5f2e1891a1af11be27914c48854db0fe5b4bb95c137e0f2d6",
+		2:  "30e1867424e66e8b6d159246db94e3486778136f7e386ff5f001859d6b8484ab",
+		3:  "f2dcdd96791b6bac5d554f2d320e594b834f5da1981812c3707e7772234cb0ad",
+		4:  "9675e04b4ba9dc81b06e81731e2d21caa2c95557a85dcfa3fff70c9ff0f30b2e",
+		5:  "9674600fd139741c0f7dd7a32d984a0e74401cc90e6e8e5d203ed973d27324fe",
+		6:  "adccbd2044ec8710e7970bd22e5c68df20fe3848f267086da2013a3377175b5e",
+		7:  "e263b77a6d80c1c56f3f67d1e0d803ad8eb2ac9d66c82f78735207c886a1592c",
+		8:  "0727b310f87099c1ba2ec0ba408def82c308237c8577f0bdfd2643e9cc6b7578",
+		9:  "2af28dd3cb79464e9f6fd73729e96b05ad6e63366897c1cefe11c7fb1340f6d6",
+		10: "3b741f66cbd862f4ab2875227dafdc0588a1f8ae3a20214718f477b5d64a181b",
+		11: "ffcba4af95e6d3088681fee3a054bfef837cd5fd6a8fe0ceb79afb948abfddf3",
+		12: "a1ff90da47809233730205530a6e2db42940acb29a56d6a1e6a3ae7b044f03cb",
+		13: "c982a11fbb61ce357ef7a2f77a28e6bd686d317cc5370337c75441112c8dbfb7",
+		14: "ab4fe64f5c1fdebd6107d754e990a99d1785bfef4e800df0f23807594a7fed28",
+		15: "857dc916037098e5f6edf569a13c76bad46d46beb5688498ea670102fe4a8326",
+		16: "c0c3fe0b145addf71ab16a54fe056bd17d2b5f4b913d11e07220e604f108a9e1",
+	}
+
+	for n := 1; n <= 16; n++ {
+		if got := hex.EncodeToString(NewMerkleTree(leaves(n)).RootNode.Data); got != roots[n] {
+			t.Fatalf("root of %d leaves = %s, want %s", n, got, roots[n])
+		}
+	}
+}
@@ -1,85 +1,205 @@
-package block
-
-import (
-	"bytes"
-	"crypto/sha256"
-	"math"
-	"math/big"
-
-	"github.com/yanglinshu/glock/internal/util"
-)
-
-// targetBits is the number of leading zero bits required in the hash of a block.
-const targetBits = 24
-
-// ProofOfWork represents a proof-of-work.
-type ProofOfWork struct {
-	block  *Block   // block is the block to be mined
-	target *big.Int // target is the upper bound of the hash of a block
-}
-
-// NewProofOfWork creates a new ProofOfWork with the upper bound of the hash of a block.
-func NewProofOfWork(b *Block) *ProofOfWork {
-	target := big.NewInt(1)
-	target.Lsh(target, uint(256-targetBits))
-
-	p := &ProofOfWork{b, target}
-
-	return p
-}
-
-// prepareData returns the data to be hashed. The data is the concatenation of the fields of the
-// block and the nonce.
-func (p *ProofOfWork) prepareData(nonce int) []byte {
-	data := bytes.Join(
-		[][]byte{
-			p.block.PrevBlockHash,
-			p.block.HashTransactions(),
-			util.IntToHex(p.block.Timestamp),
-			util.IntToHex(int64(targetBits)),
-			util.IntToHex(int64(nonce)),
-		},
-		[]byte{},
-	)
-
-	return data
-}
-
-// maxNonce is the maximum number of times the hash of the block is calculated.
-const maxNonce = math.MaxInt64
-
-// Run performs a proof-of-work.
-func (p *ProofOfWork) Run() (int, []byte) {
-	var hashInt big.Int
-	var hash [32]byte
-	nonce := 0 // nonce is the number of times the hash of the block is calculated
-
-	// Calculate the hash of the block until the hash is less than the upper bound.
-	for nonce < maxNonce {
-		data := p.prepareData(nonce)
-		hash = sha256.Sum256(data)
-		hashInt.SetBytes(hash[:])
-
-		if hashInt.Cmp(p.target) == -1 {
-			break
-		} else {
-			nonce++
-		}
-	}
-
-	return nonce, hash[:]
-
-}
-
-// Validate validates a proof-of-work.
-func (p *ProofOfWork) Validate() bool {
-	var hashInt big.Int
-
-	data := p.prepareData(p.block.Nonce)
-	hash := sha256.Sum256(data)
-	hashInt.SetBytes(hash[:])
-
-	isValid := hashInt.Cmp(p.target) == -1
-
-	return isValid
-}
+package block
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"math"
+	"math/big"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yanglinshu/glock/internal/errors"
+)
+
+// DefaultTargetBits is the number of leading zero bits required in the hash of a block when the
+// chain does not configure it. Blocks stored before the difficulty was recorded use it as well.
+const DefaultTargetBits = 24
+
+// Target returns the upper bound of the hash of the block, as given by its Bits.
+func (b *Block) Target() *big.Int {
+	return targetOf(b.Version, b.Bits)
+}
+
+// TargetBits returns the number of leading zero bits required in the hash of the block.
+func (b *Block) TargetBits() int {
+	return TargetZeroBits(b.Target())
+}
+
+// HeaderBits returns the Bits hashed by the proof-of-work of the block, which are also those the
+// retarget schedule sets: the compact target from CompactBitsVersion on, and the number of leading
+// zero bits before.
+func (b *Block) HeaderBits() int {
+	return headerBits(b.Version, b.Bits)
+}
+
+// ProgressFunc receives the progress of mining: the number of hashes tried so far and the hash
+// rate since mining started. It is called from the mining workers, so it must be safe for
+// concurrent use.
+type ProgressFunc func(nonce int, hashesPerSec float64)
+
+// progressInterval is the number of hashes tried between two calls of the progress function. It is a
+// multiple of cancelCheckInterval.
+const progressInterval = 1 << 20
+
+// ProofOfWork represents a proof-of-work.
+type ProofOfWork struct {
+	block    *Block       // block is the block to be mined
+	target   *big.Int     // target is the upper bound of the hash of a block
+	progress ProgressFunc // progress receives the progress of mining, if set
+	hashes   int64        // hashes is the number of hashes tried by all the workers, updated atomically
+	start    time.Time    // start is when mining started
+}
+
+// NewProofOfWork creates a new ProofOfWork with the upper bound of the hash of a block, derived
+// from the Bits of the block.
+func NewProofOfWork(b *Block) *ProofOfWork {
+	p := &ProofOfWork{block: b, target: b.Target()}
+
+	return p
+}
+
+// SetProgress sets the function called every progressInterval hashes while mining.
+func (p *ProofOfWork) SetProgress(progress ProgressFunc) {
+	p.progress = progress
+}
+
+// prepareData returns the data to be hashed. The data is the concatenation of the fields of the
+// block and the nonce.
+func (p *ProofOfWork) prepareData(nonce int) []byte {
+	return headerData(p.block.Version, p.block.PrevBlockHash, p.block.MerkleRoot, p.block.Timestamp, p.block.HeaderBits(), nonce)
+}
+
+// maxNonce is the maximum number of times the hash of the block is calculated.
+const maxNonce = math.MaxInt64
+
+// cancelCheckInterval is the number of nonces tried between two checks for cancellation.
+const cancelCheckInterval = 1 << 12
+
+// Run performs a proof-of-work. It gives up with the error of ctx once ctx is done.
+func (p *ProofOfWork) Run(ctx context.Context) (int, []byte, error) {
+	p.start = time.Now()
+	return p.search(ctx, 0, maxNonce)
+}
+
+// RunParallel performs a proof-of-work on several workers, each trying a disjoint range of nonces.
+// The first valid nonce found is returned and the other workers are stopped. If workers is less
+// than 1, one worker per GOMAXPROCS is used. It gives up with the error of ctx once ctx is done.
+func (p *ProofOfWork) RunParallel(ctx context.Context, workers int) (int, []byte, error) {
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	p.start = time.Now()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		nonce int    // nonce found by the worker
+		hash  []byte // hash of the block with the nonce
+	}
+	found := make(chan result, workers)
+
+	var wg sync.WaitGroup
+	rangeSize := maxNonce / workers
+	for w := 0; w < workers; w++ {
+		from, to := w*rangeSize, (w+1)*rangeSize
+		if w == workers-1 {
+			to = maxNonce
+		}
+
+		wg.Add(1)
+		go func(from, to int) {
+			defer wg.Done()
+
+			nonce, hash, err := p.search(ctx, from, to)
+			if err == nil {
+				found <- result{nonce, hash}
+			}
+		}(from, to)
+	}
+
+	go func() {
+		wg.Wait()
+		close(found)
+	}()
+
+	r, ok := <-found
+	if !ok {
+		if ctx.Err() != nil {
+			return 0, nil, ctx.Err()
+		}
+
+		return 0, nil, errors.ErrNonceExhausted
+	}
+
+	return r.nonce, r.hash, nil
+}
+
+// search tries the nonces from from up to to, excluded, until the hash of the block is below the
+// target.
+func (p *ProofOfWork) search(ctx context.Context, from, to int) (int, []byte, error) {
+	var hashInt big.Int
+	var hash [32]byte
+
+	// Calculate the hash of the block until the hash is less than the upper bound.
+	for nonce := from; nonce < to; nonce++ {
+		if (nonce-from)%cancelCheckInterval == 0 {
+			select {
+			case <-ctx.Done():
+				return 0, nil, ctx.Err()
+			default:
+			}
+
+			if nonce != from {
+				p.reportProgress()
+			}
+		}
+
+		data := p.prepareData(nonce)
+		hash = sha256.Sum256(data)
+		hashInt.SetBytes(hash[:])
+
+		if hashInt.Cmp(p.target) == -1 {
+			return nonce, hash[:], nil
+		}
+	}
+
+	return 0, nil, errors.ErrNonceExhausted
+}
+
+// reportProgress counts the cancelCheckInterval hashes a worker just tried, and calls the progress
+// function once every progressInterval hashes tried by all the workers.
+func (p *ProofOfWork) reportProgress() {
+	hashes := atomic.AddInt64(&p.hashes, cancelCheckInterval)
+	if p.progress == nil || hashes%progressInterval != 0 {
+		return
+	}
+
+	elapsed := time.Since(p.start).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+
+	p.progress(int(hashes), float64(hashes)/elapsed)
+}
+
+// Validate validates a proof-of-work. The target must be valid, and the hash of the block must be
+// below it and match the hash stored in the block.
+func (p *ProofOfWork) Validate() bool {
+	var hashInt big.Int
+
+	if !validTarget(p.target) {
+		return false
+	}
+
+	data := p.prepareData(p.block.Nonce)
+	hash := sha256.Sum256(data)
+	hashInt.SetBytes(hash[:])
+
+	isValid := hashInt.Cmp(p.target) == -1 && bytes.Equal(hash[:], p.block.Hash)
+
+	return isValid
+}
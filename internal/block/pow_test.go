@@ -0,0 +1,273 @@
+package block
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// testBits are the compact bits of the blocks mined by the tests, low enough to be mined at once
+var testBits = int(TargetBitsToCompact(8))
+
+// newTestBlock mines a block holding a coinbase at the given height
+func newTestBlock(t testing.TB, height int) *Block {
+	t.Helper()
+
+	w, err := transaction.NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pubKeyHash, err := transaction.HashPubKey(w.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cbTx, err := transaction.NewCoinbaseTX(transaction.NewAddress(pubKeyHash, transaction.Mainnet), "", height, transaction.ChainParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := NewBlock(context.Background(), []*transaction.Transaction{cbTx}, []byte("prev"), height, testBits, 1700000000, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+func TestProofOfWorkValidate(t *testing.T) {
+	b := newTestBlock(t, 1)
+
+	if !NewProofOfWork(b).Validate() {
+		t.Fatal("a mined block has an invalid proof-of-work")
+	}
+
+	if b.Target().Cmp(NewProofOfWork(b).target) != 0 {
+		t.Fatal("the proof-of-work target differs from the target of the block")
+	}
+}
+
+func TestProofOfWorkTampered(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(b *Block)
+	}{
+		{"nonce", func(b *Block) { b.Nonce++ }},
+		{"timestamp", func(b *Block) { b.Timestamp++ }},
+		{"previous hash", func(b *Block) { b.PrevBlockHash = []byte("other") }},
+		{"hash", func(b *Block) { b.Hash[len(b.Hash)-1] ^= 0xff }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBlock(t, 1)
+			tt.tamper(b)
+
+			if NewProofOfWork(b).Validate() {
+				t.Fatalf("a block with a changed %s has a valid proof-of-work", tt.name)
+			}
+		})
+	}
+}
+
+func TestProofOfWorkCanceled(t *testing.T) {
+	// A target no nonce reaches in the time of the test
+	b := newTestBlock(t, 1)
+	b.Bits = int(TargetBitsToCompact(200))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := b.Mine(ctx, nil)
+	if err != context.Canceled {
+		t.Fatalf("mining with a canceled context = %v, want context.Canceled", err)
+	}
+}
+
+func TestMineAtEightBits(t *testing.T) {
+	start := time.Now()
+	for height := 1; height <= 20; height++ {
+		b := newTestBlock(t, height)
+
+		if b.TargetBits() != 8 {
+			t.Fatalf("target bits of the mined block = %d, want 8", b.TargetBits())
+		}
+
+		if !NewProofOfWork(b).Validate() {
+			t.Fatalf("block %d has an invalid proof-of-work", height)
+		}
+
+		// The proof-of-work is checked against the bits of the block itself
+		b.Bits = int(TargetBitsToCompact(40))
+		if NewProofOfWork(b).Validate() {
+			t.Fatalf("block %d mined at 8 bits is valid at 40 bits", height)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("mining 20 blocks at 8 bits took %v, want well under a second", elapsed)
+	}
+}
+
+func TestRunCanceledPromptly(t *testing.T) {
+	runs := map[string]func(p *ProofOfWork, ctx context.Context) error{
+		"Run": func(p *ProofOfWork, ctx context.Context) error {
+			_, _, err := p.Run(ctx)
+			return err
+		},
+		"RunParallel": func(p *ProofOfWork, ctx context.Context) error {
+			_, _, err := p.RunParallel(ctx, 4)
+			return err
+		},
+	}
+
+	for name, run := range runs {
+		t.Run(name, func(t *testing.T) {
+			// A target no nonce reaches in the time of the test
+			b := newTestBlock(t, 1)
+			b.Bits = int(TargetBitsToCompact(200))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error, 1)
+			go func() {
+				done <- run(NewProofOfWork(b), ctx)
+			}()
+
+			time.Sleep(50 * time.Millisecond)
+			canceled := time.Now()
+			cancel()
+
+			select {
+			case err := <-done:
+				if err != context.Canceled {
+					t.Fatalf("%s after cancellation = %v, want context.Canceled", name, err)
+				}
+
+				if elapsed := time.Since(canceled); elapsed > 500*time.Millisecond {
+					t.Fatalf("%s returned %v after cancellation", name, elapsed)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("%s did not return after cancellation", name)
+			}
+		})
+	}
+}
+
+func TestRunParallelFindsValidNonce(t *testing.T) {
+	for _, workers := range []int{0, 1, 3, 16} {
+		b := newTestBlock(t, 1)
+		b.Bits = int(TargetBitsToCompact(12))
+
+		nonce, hash, err := NewProofOfWork(b).RunParallel(context.Background(), workers)
+		if err != nil {
+			t.Fatalf("RunParallel(%d): %v", workers, err)
+		}
+
+		b.Nonce, b.Hash = nonce, hash
+		if !NewProofOfWork(b).Validate() {
+			t.Fatalf("RunParallel(%d) found nonce %d, which does not validate", workers, nonce)
+		}
+	}
+}
+
+// benchmarkMining mines blocks at a moderate difficulty with the given run function
+func benchmarkMining(b *testing.B, run func(p *ProofOfWork) error) {
+	w, err := transaction.NewWallet()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	pubKeyHash, err := transaction.HashPubKey(w.PublicKey)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	bits := int(TargetBitsToCompact(16))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		// Every block has its own coinbase, so the nonces to try differ
+		cbTx, err := transaction.NewCoinbaseTX(transaction.NewAddress(pubKeyHash, transaction.Mainnet), "", i+1, transaction.ChainParams{})
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		bl := NewBlockTemplate([]*transaction.Transaction{cbTx}, []byte("prev"), i+1, bits, 1700000000)
+		err = run(NewProofOfWork(bl))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRun(b *testing.B) {
+	benchmarkMining(b, func(p *ProofOfWork) error {
+		_, _, err := p.Run(context.Background())
+		return err
+	})
+}
+
+func BenchmarkRunParallel(b *testing.B) {
+	benchmarkMining(b, func(p *ProofOfWork) error {
+		_, _, err := p.RunParallel(context.Background(), 0)
+		return err
+	})
+}
+
+func TestHeaderDataFixedWidth(t *testing.T) {
+	prev, root := []byte("prev"), []byte("root")
+
+	// Every integer takes 8 bytes whatever its magnitude
+	for _, fields := range [][3]int{{0, 0, 0}, {1700000000, 8, 1}, {1 << 40, 1 << 30, 1 << 50}} {
+		data := headerData(BinaryHeaderVersion, prev, root, int64(fields[0]), fields[1], fields[2])
+		if len(data) != len(prev)+len(root)+4*8 {
+			t.Fatalf("header data of %v is %d bytes, want %d", fields, len(data), len(prev)+len(root)+4*8)
+		}
+	}
+
+	// The hex digits of a timestamp and a nonce run together before BinaryHeaderVersion, so two
+	// headers hash the same data, but not from it on
+	legacyA := headerData(0, prev, root, 0x1, 8, 0x23)
+	legacyB := headerData(0, prev, root, 0x18, 0x2, 0x3)
+	if !bytes.Equal(legacyA, legacyB) {
+		t.Fatalf("legacy header data %q and %q differ, want the same", legacyA, legacyB)
+	}
+
+	if bytes.Equal(headerData(BinaryHeaderVersion, prev, root, 0x1, 8, 0x23), headerData(BinaryHeaderVersion, prev, root, 0x18, 0x2, 0x3)) {
+		t.Fatal("header data of different timestamps, bits and nonces is the same")
+	}
+}
+
+func TestProofOfWorkOfEveryVersion(t *testing.T) {
+	for version := 0; version <= CurrentVersion; version++ {
+		b := newTestBlock(t, 1)
+		b.Version = version
+		if version < CompactBitsVersion {
+			b.Bits = 8
+		}
+
+		err := b.Mine(context.Background(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !NewProofOfWork(b).Validate() {
+			t.Fatalf("a block of version %d has an invalid proof-of-work", version)
+		}
+
+		header := b.Header()
+		if !header.Validate() {
+			t.Fatalf("the header of a block of version %d has an invalid proof-of-work", version)
+		}
+
+		// The hash covers the version, so a block cannot be read under another layout
+		b.Version = version ^ 1
+		if version >= BinaryHeaderVersion && NewProofOfWork(b).Validate() {
+			t.Fatalf("a block of version %d is valid as version %d", version, b.Version)
+		}
+	}
+}
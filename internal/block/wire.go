@@ -0,0 +1,123 @@
+package block
+
+import (
+	"bytes"
+
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/transaction"
+	"github.com/yanglinshu/glock/internal/util"
+)
+
+// maxWireLength bounds the length of any variable-length field or list in the binary encoding
+const maxWireLength = 1 << 24
+
+// The binary encoding of a block lays its fields out in a fixed order, integers in big endian and
+// byte strings prefixed with their 32-bit length. Unlike the gob encoding, the same block always
+// encodes to the same bytes:
+//
+//	Timestamp (int64) | Height (int64) | Bits (int64) | Nonce (int64) | Version (int64)
+//	PrevBlockHash | Hash | MerkleRoot
+//	transaction count (uint32) | per transaction: its binary encoding, see transaction.Serialize
+
+// WireOverhead is the size of the binary encoding of a block without transactions, its hashes being
+// 32 bytes long
+const WireOverhead = 5*8 + 3*(4+32) + 4
+
+// WireTxSize returns the number of bytes a transaction adds to the binary encoding of a block.
+func WireTxSize(tx *transaction.Transaction) (int, error) {
+	sl, err := tx.Serialize()
+	if err != nil {
+		return 0, err
+	}
+
+	return 4 + len(sl), nil
+}
+
+// EncodeWire returns the binary encoding of the block.
+func (b *Block) EncodeWire() ([]byte, error) {
+	var buff bytes.Buffer
+
+	util.WriteInt64(&buff, b.Timestamp)
+	util.WriteInt64(&buff, int64(b.Height))
+	util.WriteInt64(&buff, int64(b.Bits))
+	util.WriteInt64(&buff, int64(b.Nonce))
+	util.WriteInt64(&buff, int64(b.Version))
+	util.WriteBytes(&buff, b.PrevBlockHash)
+	util.WriteBytes(&buff, b.Hash)
+	util.WriteBytes(&buff, b.MerkleRoot)
+
+	util.WriteUint32(&buff, uint32(len(b.Transactions)))
+	for _, tx := range b.Transactions {
+		sl, err := tx.Serialize()
+		if err != nil {
+			return nil, err
+		}
+
+		util.WriteBytes(&buff, sl)
+	}
+
+	return buff.Bytes(), nil
+}
+
+// DecodeWireBlock decodes a block from its binary encoding.
+func DecodeWireBlock(data []byte) (*Block, error) {
+	var b Block
+	r := bytes.NewReader(data)
+
+	if len(data) > MaxSerializedSize {
+		return nil, errors.ErrPayloadTooLarge
+	}
+
+	var fields [5]int64
+	for i := range fields {
+		var err error
+		fields[i], err = util.ReadInt64(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+	b.Timestamp, b.Height, b.Bits, b.Nonce, b.Version = fields[0], int(fields[1]), int(fields[2]), int(fields[3]), int(fields[4])
+
+	var err error
+	if b.PrevBlockHash, err = util.ReadBytes(r, maxWireLength); err != nil {
+		return nil, err
+	}
+
+	if b.Hash, err = util.ReadBytes(r, maxWireLength); err != nil {
+		return nil, err
+	}
+
+	if b.MerkleRoot, err = util.ReadBytes(r, maxWireLength); err != nil {
+		return nil, err
+	}
+
+	count, err := util.ReadLength(r, maxWireLength)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < count; i++ {
+		sl, err := util.ReadBytes(r, maxWireLength)
+		if err != nil {
+			return nil, err
+		}
+
+		tx, err := transaction.DeserializeTransaction(sl)
+		if err != nil {
+			return nil, err
+		}
+
+		b.Transactions = append(b.Transactions, &tx)
+	}
+
+	if r.Len() != 0 {
+		return nil, errors.ErrInvalidEncoding
+	}
+
+	err = b.checkDecoded(false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &b, nil
+}
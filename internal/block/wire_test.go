@@ -0,0 +1,68 @@
+package block
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/yanglinshu/glock/internal/errors"
+)
+
+func TestWireRoundTrip(t *testing.T) {
+	b := newTestBlock(t, 3)
+
+	data, err := b.EncodeWire()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := DecodeWireBlock(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := decoded.EncodeWire()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(data, again) {
+		t.Fatal("a decoded block encodes to other bytes")
+	}
+
+	if decoded.Height != b.Height || decoded.Nonce != b.Nonce || !bytes.Equal(decoded.Hash, b.Hash) {
+		t.Fatalf("decoded header %d/%d/%x, want %d/%d/%x", decoded.Height, decoded.Nonce, decoded.Hash, b.Height, b.Nonce, b.Hash)
+	}
+
+	if !NewProofOfWork(decoded).Validate() {
+		t.Fatal("the decoded block has an invalid proof-of-work")
+	}
+}
+
+func TestWireRejectsTrailingData(t *testing.T) {
+	b := newTestBlock(t, 3)
+
+	data, err := b.EncodeWire()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = DecodeWireBlock(append(data, 0x00))
+	if err == nil {
+		t.Fatal("a block followed by trailing data was decoded")
+	}
+
+	_, err = DecodeWireBlock(data[:len(data)-1])
+	if err == nil {
+		t.Fatal("a truncated block was decoded")
+	}
+}
+
+func TestWireUnencodableTransaction(t *testing.T) {
+	b := newTestBlock(t, 3)
+	b.Transactions[0].Version = -1
+
+	_, err := b.EncodeWire()
+	if !errors.Is(err, errors.ErrUnencodable) {
+		t.Fatalf("EncodeWire = %v, want ErrUnencodable", err)
+	}
+}
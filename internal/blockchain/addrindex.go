@@ -0,0 +1,159 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/yanglinshu/glock/internal/transaction"
+	bolt "go.etcd.io/bbolt"
+)
+
+// addressBucket is the name of the bucket indexing the UTXO set by public key hash. Keys are the
+// public key hash, the transaction ID and the output index, values the value of the output.
+const addressBucket = "addresses"
+
+// addressKey returns the key of an output in the address index.
+func addressKey(pubKeyHash, txID []byte, vout int) []byte {
+	key := make([]byte, 0, len(pubKeyHash)+len(txID)+4)
+	key = append(key, pubKeyHash...)
+	key = append(key, txID...)
+
+	var index [4]byte
+	binary.BigEndian.PutUint32(index[:], uint32(vout))
+
+	return append(key, index[:]...)
+}
+
+// indexOutput adds an unspent output to the address index. Data outputs and spent placeholders are
+// locked to no key and are not indexed.
+func indexOutput(idx *bolt.Bucket, txID []byte, vout int, out transaction.TXOutput) error {
+	if len(out.PublicKeyHash) == 0 {
+		return nil
+	}
+
+	var value [8]byte
+	binary.BigEndian.PutUint64(value[:], uint64(out.Value))
+
+	return idx.Put(addressKey(out.PublicKeyHash, txID, vout), value[:])
+}
+
+// unindexOutput removes a spent output from the address index.
+func unindexOutput(idx *bolt.Bucket, txID []byte, vout int, out transaction.TXOutput) error {
+	if len(out.PublicKeyHash) == 0 {
+		return nil
+	}
+
+	return idx.Delete(addressKey(out.PublicKeyHash, txID, vout))
+}
+
+// resetAddressIndex replaces the address index with an empty bucket.
+func resetAddressIndex(tx *bolt.Tx) error {
+	err := tx.DeleteBucket([]byte(addressBucket))
+	if err != nil && err != bolt.ErrBucketNotFound {
+		return err
+	}
+
+	_, err = tx.CreateBucket([]byte(addressBucket))
+	return err
+}
+
+// ReindexAddresses rebuilds the address index from the UTXO set.
+func (u *UTXOSet) ReindexAddresses() error {
+	return u.Blockchain.db.Update(func(tx *bolt.Tx) error {
+		err := resetAddressIndex(tx)
+		if err != nil {
+			return err
+		}
+
+		b := tx.Bucket([]byte(utxoBucket))
+		if b == nil {
+			return nil
+		}
+
+		idx := tx.Bucket([]byte(addressBucket))
+		c := b.Cursor()
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if isLastAppliedKey(k) {
+				continue
+			}
+
+			outs, err := transaction.DeserializeOutputs(v)
+			if err != nil {
+				return err
+			}
+
+			for outIdx, out := range outs.Outputs {
+				err := indexOutput(idx, k, outIdx, out)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// hasAddressIndex checks whether the database holds the address index.
+func (u *UTXOSet) hasAddressIndex() (bool, error) {
+	found := false
+
+	err := u.Blockchain.db.View(func(tx *bolt.Tx) error {
+		found = tx.Bucket([]byte(addressBucket)) != nil
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return found, nil
+}
+
+// FindOutPoints returns the unspent outputs locked with the public key hash, in the order of the
+// UTXO set. Only the entries of the address index for that key are read.
+func (u *UTXOSet) FindOutPoints(pubKeyHash []byte) ([]OutPointValue, error) {
+	var utxos []OutPointValue
+
+	err := u.Blockchain.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(addressBucket)).Cursor()
+
+		for k, v := c.Seek(pubKeyHash); k != nil && bytes.HasPrefix(k, pubKeyHash); k, v = c.Next() {
+			// A multisig script may start with the bytes of a public key hash, so only keys holding
+			// exactly a transaction ID and an index after the prefix are taken
+			outPoint := k[len(pubKeyHash):]
+			if len(outPoint) != sha256.Size+4 || len(v) != 8 {
+				continue
+			}
+
+			txID := append([]byte{}, outPoint[:len(outPoint)-4]...)
+			vout := int(binary.BigEndian.Uint32(outPoint[len(outPoint)-4:]))
+			value := int(binary.BigEndian.Uint64(v))
+
+			utxos = append(utxos, OutPointValue{OutPoint{txID, vout}, value})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return utxos, nil
+}
+
+// GetBalance returns the total value of the unspent outputs locked with the public key hash.
+func (u *UTXOSet) GetBalance(pubKeyHash []byte) (int, error) {
+	utxos, err := u.FindOutPoints(pubKeyHash)
+	if err != nil {
+		return 0, err
+	}
+
+	balance := 0
+	for _, utxo := range utxos {
+		balance += utxo.Value
+	}
+
+	return balance, nil
+}
@@ -0,0 +1,171 @@
+package blockchain
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/yanglinshu/glock/internal/transaction"
+	bolt "go.etcd.io/bbolt"
+)
+
+// fillUTXOSet adds n unspent outputs to the UTXO set and its address index, five to a transaction,
+// paying random keys except for one output in a thousand, which pays pubKeyHash. It returns the
+// value paid to pubKeyHash.
+func fillUTXOSet(tb testing.TB, c *TestChain, n int, pubKeyHash []byte) int {
+	tb.Helper()
+
+	paid := 0
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+		idx := tx.Bucket([]byte(addressBucket))
+
+		for i := 0; i < n; i += 5 {
+			txID := make([]byte, 32)
+			_, err := rand.Read(txID)
+			if err != nil {
+				return err
+			}
+
+			var outs transaction.TXOutputs
+			for j := i; j < i+5 && j < n; j++ {
+				out := transaction.TXOutput{Value: j%9 + 1, PublicKeyHash: make([]byte, 20)}
+				if j%1000 == 0 {
+					out.PublicKeyHash = pubKeyHash
+					paid += out.Value
+				} else {
+					_, err := rand.Read(out.PublicKeyHash)
+					if err != nil {
+						return err
+					}
+				}
+
+				err := indexOutput(idx, txID, len(outs.Outputs), out)
+				if err != nil {
+					return err
+				}
+				outs.Outputs = append(outs.Outputs, out)
+			}
+
+			encoded, err := outs.Serialize()
+			if err != nil {
+				return err
+			}
+
+			err = b.Put(txID, encoded)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	return paid
+}
+
+// scanBalance returns the value of the unspent outputs locked with pubKeyHash, found by scanning
+// the whole UTXO set
+func scanBalance(tb testing.TB, c *TestChain, pubKeyHash []byte) int {
+	tb.Helper()
+
+	outs, err := c.UTXOSet().FindUTXO(pubKeyHash)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	total := 0
+	for _, out := range outs {
+		total += out.Value
+	}
+
+	return total
+}
+
+func TestGetBalanceMatchesScan(t *testing.T) {
+	c := NewTestChain(t)
+	target := newAddress(t)
+	u := c.UTXOSet()
+
+	c.Fund(target, 7)
+	want := 7 + fillUTXOSet(t, c, 5000, target.PubKeyHash())
+
+	for i, address := range []transaction.Address{target, c.Address(), newAddress(t)} {
+		got, err := u.GetBalance(address.PubKeyHash())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if scanned := scanBalance(t, c, address.PubKeyHash()); got != scanned {
+			t.Fatalf("GetBalance(%s) = %d, a scan of the UTXO set finds %d", address, got, scanned)
+		}
+
+		if i == 0 && got != want {
+			t.Fatalf("GetBalance(%s) = %d, want %d", address, got, want)
+		}
+	}
+
+	// Spending through the index updates it
+	to := newAddress(t)
+	c.Fund(to, 3)
+	if got, err := u.GetBalance(to.PubKeyHash()); err != nil || got != 3 {
+		t.Fatalf("GetBalance after a payment = %d, %v, want 3", got, err)
+	}
+
+	if got, err := u.GetBalance(c.Address().PubKeyHash()); err != nil || got != scanBalance(t, c, c.Address().PubKeyHash()) {
+		t.Fatalf("GetBalance of the payer after a payment = %d, %v, want %d", got, err, scanBalance(t, c, c.Address().PubKeyHash()))
+	}
+
+	// A rebuilt index holds the same outputs
+	before, err := u.FindOutPoints(target.PubKeyHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = u.ReindexAddresses()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := u.FindOutPoints(target.PubKeyHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(after) != len(before) {
+		t.Fatalf("the rebuilt index holds %d outputs of the address, want %d", len(after), len(before))
+	}
+}
+
+// benchmarkBalance reads the balance of an address in a UTXO set of about 50,000 outputs
+func benchmarkBalance(b *testing.B, balance func(c *TestChain, pubKeyHash []byte) int) {
+	c := NewTestChain(b)
+	target := newAddress(b)
+	want := fillUTXOSet(b, c, 50000, target.PubKeyHash())
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if got := balance(c, target.PubKeyHash()); got != want {
+			b.Fatalf("balance = %d, want %d", got, want)
+		}
+	}
+}
+
+func BenchmarkGetBalance(b *testing.B) {
+	benchmarkBalance(b, func(c *TestChain, pubKeyHash []byte) int {
+		balance, err := c.UTXOSet().GetBalance(pubKeyHash)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		return balance
+	})
+}
+
+func BenchmarkGetBalanceScan(b *testing.B) {
+	benchmarkBalance(b, func(c *TestChain, pubKeyHash []byte) int {
+		return scanBalance(b, c, pubKeyHash)
+	})
+}
@@ -0,0 +1,106 @@
+package blockchain
+
+import (
+	"encoding/hex"
+
+	"github.com/yanglinshu/glock/internal/block"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// SupplyViolation is a block whose coinbase mints more than the subsidy plus the fees of the block
+type SupplyViolation struct {
+	Height  int    // Height is the height of the block
+	Hash    []byte // Hash is the hash of the block
+	Minted  int    // Minted is the total value of the coinbase outputs
+	Allowed int    // Allowed is the subsidy at the height plus the fees of the block
+}
+
+// AuditReport is the result of a supply audit
+type AuditReport struct {
+	Issued      int               // Issued is the value minted by coinbases, not counting fees
+	Unspent     int               // Unspent is the value of the spendable outputs in the UTXO set
+	Unspendable int               // Unspendable is the value locked in data outputs
+	Violations  []SupplyViolation // Violations are the blocks minting more than allowed
+}
+
+// Balanced checks whether the issued value matches the value held by the UTXO set.
+func (r AuditReport) Balanced() bool {
+	return r.Issued == r.Unspent+r.Unspendable
+}
+
+// OK checks whether the audit found neither over-paying blocks nor a ledger mismatch.
+func (r AuditReport) OK() bool {
+	return len(r.Violations) == 0 && r.Balanced()
+}
+
+// AuditSupply walks the chain and checks every coinbase against the subsidy schedule plus the fees
+// of its block, then compares the total issuance with the value held by the UTXO set.
+func (bc *Blockchain) AuditSupply() (AuditReport, error) {
+	var report AuditReport
+	var blocks []*block.Block
+	txs := make(map[string]*transaction.Transaction)
+
+	bci := bc.Iterator()
+
+	// Collect the chain, the fees of a block need the outputs of earlier transactions
+	for {
+		bl, err := bci.Next()
+		if err != nil {
+			return AuditReport{}, err
+		}
+
+		blocks = append(blocks, bl)
+		for _, tx := range bl.Transactions {
+			txs[hex.EncodeToString(tx.ID)] = tx
+		}
+
+		if len(bl.PrevBlockHash) == 0 {
+			break
+		}
+	}
+
+	for i := len(blocks) - 1; i >= 0; i-- {
+		bl := blocks[i]
+		minted, fees := 0, 0
+
+		for _, tx := range bl.Transactions {
+			outputs := 0
+			for _, out := range tx.Vout {
+				outputs += out.Value
+				if out.IsData() {
+					report.Unspendable += out.Value
+				}
+			}
+
+			if tx.IsCoinbase() {
+				minted += outputs
+				continue
+			}
+
+			inputs := 0
+			for _, in := range tx.Vin {
+				prevTx, ok := txs[hex.EncodeToString(in.Txid)]
+				if ok && in.Vout >= 0 && in.Vout < len(prevTx.Vout) {
+					inputs += prevTx.Vout[in.Vout].Value
+				}
+			}
+			fees += inputs - outputs
+		}
+
+		allowed := bc.SubsidyAt(bl.Height) + fees
+		if minted > allowed {
+			report.Violations = append(report.Violations, SupplyViolation{bl.Height, bl.Hash, minted, allowed})
+		}
+
+		report.Issued += minted - fees
+	}
+
+	UTXOSet := UTXOSet{Blockchain: bc}
+	unspent, err := UTXOSet.totalValue()
+	if err != nil {
+		return AuditReport{}, err
+	}
+	report.Unspent = unspent
+
+	return report, nil
+}
@@ -0,0 +1,134 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/yanglinshu/glock/internal/transaction"
+	bolt "go.etcd.io/bbolt"
+)
+
+// audit runs a supply audit of the chain
+func audit(t *testing.T, c *TestChain) AuditReport {
+	t.Helper()
+
+	report, err := c.AuditSupply()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return report
+}
+
+func TestAuditSupplyWithFees(t *testing.T) {
+	c := NewTestChain(t)
+	to := newAddress(t)
+
+	// Fees go to the miner on top of the subsidy, without minting anything
+	tx, err := NewUTXOTransaction(c.Wallet, to, 5, 2, nil, nil, c.UTXOSet())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fee, err := c.TransactionFee(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cbTx, err := transaction.NewCoinbaseTX(c.Address(), "", 1, c.ChainParams())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cbTx.Vout[0].Value += fee
+
+	cbTx.ID, err = cbTx.UnsignedHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.SubmitBlock(mineWithCoinbase(t, c, cbTx, tx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.MineBlocks(2)
+
+	report := audit(t, c)
+	if !report.OK() {
+		t.Fatalf("audit of a valid chain = %+v, want no violation", report)
+	}
+
+	if report.Issued != 4*transaction.DefaultSubsidy {
+		t.Fatalf("issued = %d, want %d", report.Issued, 4*transaction.DefaultSubsidy)
+	}
+}
+
+func TestAuditSupplyFlagsOverpayingCoinbase(t *testing.T) {
+	c := NewTestChain(t)
+	c.MineBlocks(2)
+
+	cbTx, err := transaction.NewCoinbaseTX(c.Address(), "", 3, c.ChainParams())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cbTx.Vout[0].Value += 10
+
+	cbTx.ID, err = cbTx.UnsignedHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The block is stored without validation, as a chain written by a buggy version would be
+	bl := mineWithCoinbase(t, c, cbTx)
+	err = c.AddBlock(bl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.UTXOSet().Reconcile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.MineBlocks(1)
+
+	report := audit(t, c)
+	if len(report.Violations) != 1 {
+		t.Fatalf("violations = %+v, want the over-paying block alone", report.Violations)
+	}
+
+	v := report.Violations[0]
+	if v.Height != 3 || !bytes.Equal(v.Hash, bl.Hash) {
+		t.Fatalf("violation at height %d, %x, want height 3, %x", v.Height, v.Hash, bl.Hash)
+	}
+
+	if v.Minted != transaction.DefaultSubsidy+10 || v.Allowed != transaction.DefaultSubsidy {
+		t.Fatalf("violation minted %d of %d, want %d of %d", v.Minted, v.Allowed, transaction.DefaultSubsidy+10, transaction.DefaultSubsidy)
+	}
+}
+
+func TestAuditSupplyFlagsLedgerMismatch(t *testing.T) {
+	c := NewTestChain(t)
+	c.Fund(newAddress(t), 5)
+
+	if report := audit(t, c); !report.OK() {
+		t.Fatalf("audit of a valid chain = %+v, want no violation", report)
+	}
+
+	// An output vanishes from the UTXO set
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+		k, _ := b.Cursor().First()
+		if isLastAppliedKey(k) {
+			k, _ = b.Cursor().Last()
+		}
+
+		return b.Delete(k)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := audit(t, c)
+	if report.Balanced() || report.OK() {
+		t.Fatalf("audit of a UTXO set missing an output = %+v, want a mismatch", report)
+	}
+}
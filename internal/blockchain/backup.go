@@ -0,0 +1,96 @@
+package blockchain
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/yanglinshu/glock/internal/config"
+	"github.com/yanglinshu/glock/internal/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// restoreFileFormat is the name of the file a backup is restored to before it replaces the database
+const restoreFileFormat = "blockchain_%s.db.restore"
+
+// Backup writes a consistent copy of the database to w. The copy is taken in a read transaction,
+// so the node keeps adding blocks while it is written.
+func (bc *Blockchain) Backup(w io.Writer) error {
+	return bc.db.View(func(tx *bolt.Tx) error {
+		_, err := tx.WriteTo(w)
+		return err
+	})
+}
+
+// RestoreBlockchain replaces the database of a node with a backup read from r and returns the height
+// of the restored chain. The backup is written next to the database and must pass ValidateChain
+// before it is adopted, otherwise the database is left untouched. It returns ErrDBInUse if the node
+// is running.
+func RestoreBlockchain(r io.Reader, nodeID string) (int, error) {
+	dbFile := dbPath(nodeID)
+
+	// Hold the lock of the current database, so no node opens it until the backup is adopted
+	if dbExists(dbFile) {
+		db, err := bolt.Open(dbFile, 0600, &bolt.Options{Timeout: lockTimeout})
+		if err == bolt.ErrTimeout {
+			return 0, errors.ErrDBInUse
+		}
+		if err != nil {
+			return 0, err
+		}
+		defer db.Close()
+	}
+
+	restoreFile := config.Path(fmt.Sprintf(restoreFileFormat, nodeID))
+	height, err := writeRestoreFile(r, restoreFile)
+	if err != nil {
+		os.Remove(restoreFile)
+		return 0, err
+	}
+
+	err = os.Rename(restoreFile, dbFile)
+	if err != nil {
+		os.Remove(restoreFile)
+		return 0, err
+	}
+
+	return height, nil
+}
+
+// writeRestoreFile writes a backup to a file and validates the chain it holds, returning its height
+func writeRestoreFile(r io.Reader, restoreFile string) (int, error) {
+	f, err := os.OpenFile(restoreFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = io.Copy(f, r)
+	if err != nil {
+		f.Close()
+		return 0, err
+	}
+
+	err = f.Sync()
+	if err != nil {
+		f.Close()
+		return 0, err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	bc, err := openBlockchain(restoreFile)
+	if err != nil {
+		return 0, err
+	}
+	defer bc.CloseDB()
+
+	err = bc.ValidateChain()
+	if err != nil {
+		return 0, err
+	}
+
+	return bc.GetBestHeight()
+}
@@ -1,482 +1,1145 @@
-// Package blockchain implements the essential data structures and functions for a blockchain.
-
-package blockchain
-
-import (
-	"bytes"
-	"crypto/ecdsa"
-	"encoding/hex"
-	"fmt"
-	"os"
-
-	"github.com/boltdb/bolt"
-	"github.com/yanglinshu/glock/internal/block"
-	"github.com/yanglinshu/glock/internal/errors"
-	"github.com/yanglinshu/glock/internal/transaction"
-)
-
-const dbFileFormat = "blockchain_%s.db" // Name of the database file
-const blocksBucket = "blocks"           // Name of the bucket in the database
-// genesisCoinbaseData is the data in the coinbase transaction of the genesis block.
-// See https://blockchain.info/tx/4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b?show_adv=true
-const genesisCoinbaseData = "The Times 03/Jan/2009 Chancellor on brink of second bailout for banks"
-
-// Blockchain represents a blockchain. It contains the tip hash to the last block in the chain and
-// a pointer to the boltDB database.
-type Blockchain struct {
-	tip []byte   // Tip hash to the last block in the chain
-	db  *bolt.DB // Pointer to the boltDB database
-}
-
-// dbExists checks if the database file exists.
-func dbExists(dbFile string) bool {
-	if _, err := os.Stat(dbFile); os.IsNotExist(err) {
-		return false
-	}
-
-	return true
-}
-
-// NewBlockchain creates a new blockchain from boltDB. If the blockchain does not exist, it creates
-// a genesis block and adds it to the database.
-func NewBlockchain(nodeID string) (*Blockchain, error) {
-	dbFile := fmt.Sprintf(dbFileFormat, nodeID)
-	if !dbExists(dbFile) {
-		return nil, errors.ErrDBDoesNotExist
-	}
-
-	var tip []byte
-	db, err := bolt.Open(dbFile, 0600, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	err = db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(blocksBucket))
-		tip = b.Get([]byte("l"))
-
-		return nil
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	bc := Blockchain{tip, db}
-
-	return &bc, nil
-}
-
-// createBlockchain creates a new blockchain database. It also creates a genesis block and adds it
-// to the database.
-func CreateBlockchain(address, nodeID string) (*Blockchain, error) {
-	dbFile := fmt.Sprintf(dbFileFormat, nodeID)
-	if dbExists(dbFile) {
-		return nil, errors.ErrDBExists
-	}
-
-	var tip []byte
-
-	cbtx, err := transaction.NewCoinbaseTX(address, genesisCoinbaseData)
-	if err != nil {
-		return nil, err
-	}
-
-	genesis := block.NewGenesisBlock(cbtx)
-
-	// Open the database
-	db, err := bolt.Open(dbFile, 0600, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	// Create a bucket if it does not exist
-	err = db.Update(func(tx *bolt.Tx) error {
-		b, err := tx.CreateBucket([]byte(blocksBucket))
-		if err != nil {
-			return err
-		}
-
-		sb, err := genesis.Serialize()
-		if err != nil {
-			return err
-		}
-
-		err = b.Put(genesis.Hash, sb)
-		if err != nil {
-			return err
-		}
-
-		err = b.Put([]byte("l"), genesis.Hash)
-		if err != nil {
-			return err
-		}
-
-		tip = genesis.Hash
-		return nil
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	bc := Blockchain{tip, db}
-
-	fmt.Printf("%x\n", tip)
-
-	return &bc, nil
-}
-
-// AddBlock adds a block to the blockchain.
-func (bc *Blockchain) AddBlock(bl *block.Block) error {
-	err := bc.db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(blocksBucket))
-		blockInDB := b.Get(bl.Hash)
-
-		if blockInDB != nil {
-			return errors.ErrBlockExists
-		}
-
-		blockData, err := bl.Serialize()
-		if err != nil {
-			return err
-		}
-
-		err = b.Put(bl.Hash, blockData)
-		if err != nil {
-			return err
-		}
-
-		lastHash := b.Get([]byte("l"))
-		lastBlockData := b.Get(lastHash)
-		lastBlock, err := block.DeserializeBlock(lastBlockData)
-		if err != nil {
-			return err
-		}
-
-		if bl.Height > lastBlock.Height {
-			err = b.Put([]byte("l"), bl.Hash)
-			if err != nil {
-				return err
-			}
-
-			bc.tip = bl.Hash
-		}
-
-		return nil
-	})
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// FindTransaction finds a transaction by its ID.
-func (bc *Blockchain) FindTransaction(ID []byte) (transaction.Transaction, error) {
-	bci := bc.Iterator()
-
-	// Iterate over the blockchain
-	for {
-		block, err := bci.Next()
-		if err != nil {
-			return transaction.Transaction{}, err
-		}
-
-		for _, tx := range block.Transactions {
-			if bytes.Equal(tx.ID, ID) {
-				return *tx, nil
-			}
-		}
-
-		if len(block.PrevBlockHash) == 0 {
-			break
-		}
-	}
-
-	return transaction.Transaction{}, errors.ErrTransactionNotFound
-}
-
-// FindUTXO finds and returns all unspent transaction outputs.
-func (bc *Blockchain) FindUTXO() (map[string]transaction.TXOutputs, error) {
-	UTXOs := make(map[string]transaction.TXOutputs)
-	spentTXO := make(map[string][]int)
-	bci := bc.Iterator()
-
-	// Iterate over the blockchain
-	for {
-		block, err := bci.Next()
-		if err != nil {
-			return nil, err
-		}
-
-		for _, tx := range block.Transactions {
-			txID := hex.EncodeToString(tx.ID)
-
-		Outputs:
-			for outIdx, out := range tx.Vout {
-				// If the output has already been spent, skip it
-				if spentTXO[txID] != nil {
-					for _, spentOut := range spentTXO[txID] {
-						if spentOut == outIdx {
-							continue Outputs
-						}
-					}
-				}
-
-				outs := UTXOs[txID]
-				outs.Outputs = append(outs.Outputs, out)
-				UTXOs[txID] = outs
-			}
-
-			// If the transaction is not a coinbase transaction, add the inputs to the spentTXOs map
-			if !tx.IsCoinbase() {
-				for _, in := range tx.Vin {
-					inTxID := hex.EncodeToString(in.Txid)
-					spentTXO[inTxID] = append(spentTXO[inTxID], in.Vout)
-				}
-			}
-		}
-
-		// If the genesis block has been reached, break out of the loop
-		if len(block.PrevBlockHash) == 0 {
-			break
-		}
-	}
-
-	return UTXOs, nil
-}
-
-// GetBestHeight returns the height of the latest block in the blockchain.
-func (bc *Blockchain) GetBestHeight() (int, error) {
-	var lastBlock *block.Block
-
-	err := bc.db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(blocksBucket))
-		lastHash := b.Get([]byte("l"))
-		blockData := b.Get(lastHash)
-
-		var err error = nil
-		lastBlock, err = block.DeserializeBlock(blockData)
-		if err != nil {
-			return err
-		}
-
-		return nil
-	})
-	if err != nil {
-		return 0, err
-	}
-
-	return lastBlock.Height, nil
-}
-
-// GetBlock returns a block by its hash.
-func (bc *Blockchain) GetBlock(blockHash []byte) (*block.Block, error) {
-	var bl *block.Block
-
-	err := bc.db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(blocksBucket))
-		blockData := b.Get(blockHash)
-
-		var err error = nil
-		bl, err = block.DeserializeBlock(blockData)
-		if err != nil {
-			return err
-		}
-
-		return nil
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	return bl, nil
-}
-
-// GetBlockHashes returns a slice of hashes of all the blocks in the blockchain.
-func (bc *Blockchain) GetBlockHashes() ([][]byte, error) {
-	var blocks [][]byte
-
-	bci := bc.Iterator()
-
-	// Iterate over the blockchain
-	for {
-		block, err := bci.Next()
-		if err != nil {
-			return nil, err
-		}
-
-		blocks = append(blocks, block.Hash)
-
-		if len(block.PrevBlockHash) == 0 {
-			break
-		}
-	}
-
-	return blocks, nil
-}
-
-// MineBlock mines a new block with the provided transactions. It adds the block to the blockchain
-// and updates the database. Verify the transactions happens before the block is mined.
-func (bc *Blockchain) MineBlock(transactions []*transaction.Transaction) (*block.Block, error) {
-	var lastHash []byte
-	var lastHeight int
-
-	// Verify the transactions
-	for _, tx := range transactions {
-		if ok, err := bc.VerifyTransaction(tx); err != nil {
-			return nil, err
-		} else if !ok {
-			return nil, errors.ErrInvalidTransaction
-		}
-	}
-
-	// Get the last block's hash
-	err := bc.db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(blocksBucket))
-		lastHash = b.Get([]byte("l"))
-
-		// Get the last block's height
-		blockData := b.Get(lastHash)
-		lastBlock, err := block.DeserializeBlock(blockData)
-		if err != nil {
-			return err
-		}
-
-		lastHeight = lastBlock.Height
-
-		return nil
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	newBlock := block.NewBlock(transactions, lastHash, lastHeight+1)
-
-	// Write the new block to the database
-	err = bc.db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(blocksBucket))
-		sb, err := newBlock.Serialize()
-		if err != nil {
-			return err
-		}
-
-		err = b.Put(newBlock.Hash, sb)
-		if err != nil {
-			return err
-		}
-
-		err = b.Put([]byte("l"), newBlock.Hash)
-		if err != nil {
-			return err
-		}
-
-		bc.tip = newBlock.Hash
-		return nil
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	fmt.Printf("%x\n", newBlock.Hash)
-
-	return newBlock, nil
-}
-
-// SignTransaction signs inputs of a Transaction.
-func (bc *Blockchain) SignTransaction(tx *transaction.Transaction, privKey ecdsa.PrivateKey) error {
-	prevTXs := make(map[string]transaction.Transaction)
-
-	// Iterate over the transaction inputs
-	for _, vin := range tx.Vin {
-		prevTX, err := bc.FindTransaction(vin.Txid)
-		if err != nil {
-			return err
-		}
-
-		prevTXs[hex.EncodeToString(prevTX.ID)] = prevTX
-	}
-
-	tx.Sign(privKey, prevTXs)
-	return nil
-}
-
-// VerifyTransaction verifies transaction inputs.
-func (bc *Blockchain) VerifyTransaction(tx *transaction.Transaction) (bool, error) {
-	if tx.IsCoinbase() {
-		return true, nil
-	}
-
-	prevTXs := make(map[string]transaction.Transaction)
-
-	// Iterate over the transaction inputs
-	for _, vin := range tx.Vin {
-		prevTX, err := bc.FindTransaction(vin.Txid)
-		if err != nil {
-			return false, err
-		}
-
-		prevTXs[hex.EncodeToString(prevTX.ID)] = prevTX
-	}
-
-	return tx.Verify(prevTXs), nil
-}
-
-// NewUTXOTransaction creates a new transaction. Signing is done here.
-func NewUTXOTransaction(wallet *transaction.Wallet, to string, amount int, UTXOSet *UTXOSet) (*transaction.Transaction, error) {
-	var inputs []transaction.TXInput
-	var outputs []transaction.TXOutput
-
-	pubKeyHash, err := transaction.HashPubKey(wallet.PublicKey)
-	if err != nil {
-		return nil, err
-	}
-
-	acc, validOutputs, err := UTXOSet.FindSpendableOutputs(pubKeyHash, amount)
-	if err != nil {
-		return nil, err
-	}
-
-	if acc < amount {
-		return nil, errors.ErrNotEnoughFunds
-	}
-
-	// Build a list of inputs
-	for txID, outs := range validOutputs {
-		txID, err := hex.DecodeString(txID)
-		if err != nil {
-			return nil, err
-		}
-
-		for _, out := range outs {
-			input := transaction.TXInput{Txid: txID, Vout: out, Signature: nil, PublicKey: wallet.PublicKey}
-			inputs = append(inputs, input)
-		}
-	}
-
-	// Build a list of outputs
-	fromAddr, err := wallet.GetAddress()
-	if err != nil {
-		return nil, err
-	}
-	from := string(fromAddr)
-
-	outputs = append(outputs, *transaction.NewTXOutput(amount, to))
-	if acc > amount {
-		outputs = append(outputs, *transaction.NewTXOutput(acc-amount, from)) // a change
-	}
-
-	tx := transaction.Transaction{ID: nil, Vin: inputs, Vout: outputs}
-	tx.ID, err = tx.Hash()
-	if err != nil {
-		return nil, err
-	}
-
-	UTXOSet.Blockchain.SignTransaction(&tx, wallet.PrivateKey)
-
-	return &tx, nil
-}
-
-// Close closes the database connection in the blockchain.
-func (bc *Blockchain) CloseDB() {
-	bc.db.Close()
-}
+// Package blockchain implements the essential data structures and functions for a blockchain.
+
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/yanglinshu/glock/internal/block"
+	"github.com/yanglinshu/glock/internal/config"
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/logger"
+	"github.com/yanglinshu/glock/internal/transaction"
+	bolt "go.etcd.io/bbolt"
+)
+
+const dbFileFormat = "blockchain_%s.db" // Name of the database file
+const blocksBucket = "blocks"           // Name of the bucket in the database
+// genesisCoinbaseData is the data in the coinbase transaction of the genesis block, unless the
+// genesis parameters set another.
+// See https://blockchain.info/tx/4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b?show_adv=true
+const genesisCoinbaseData = "The Times 03/Jan/2009 Chancellor on brink of second bailout for banks"
+
+// Config holds the parameters of a new blockchain, which are persisted along with its genesis
+// block. Zero fields take their default when the chain is created.
+type Config struct {
+	TargetBits        int // Number of leading zero bits required in the hash of the genesis block
+	RetargetInterval  int // Number of blocks between difficulty adjustments
+	TargetSpacing     int // Expected number of seconds between blocks
+	MaxBlockTxCount   int // Largest number of transactions in a block
+	MaxBlockBytes     int // Largest size of the binary encoding of a block
+	DustThreshold     int // Smallest value of an output locking coins
+	MaxDataSize       int // Largest payload of a data output
+	ChainIDActivation int // Height from which transactions must be signed with transaction.ChainIDVersion
+
+	Checkpoints []Checkpoint // Blocks of the main chain trusted without verifying their signatures
+}
+
+// Blockchain represents a blockchain. It contains the tip hash to the last block in the chain and
+// a pointer to the boltDB database.
+type Blockchain struct {
+	tip      []byte             // Tip hash to the last block in the chain
+	db       *bolt.DB           // Pointer to the boltDB database
+	chainID  []byte             // Identifier of the chain, the hash of its genesis block, looked up lazily
+	config   Config             // Parameters of the chain
+	params   GenesisConfig      // Parameters of the genesis block of the chain
+	logger   logger.Logger      // Destination of the messages of the chain, discarded unless set
+	progress block.ProgressFunc // Receives the progress of the blocks mined, if set
+	lock     sync.RWMutex       // Guards tip and chainID, held for writing while a block is stored
+
+	maxClockSkew time.Duration // How far ahead of the local clock a block may be timestamped, the default if 0
+}
+
+// lockTimeout is how long opening a database waits for the lock held by another process, such as a
+// running node
+const lockTimeout = time.Second
+
+// openDB opens the database file, returning ErrDBLocked if another process holds it open.
+func openDB(dbFile string) (*bolt.DB, error) {
+	db, err := bolt.Open(dbFile, 0600, &bolt.Options{Timeout: lockTimeout})
+	if err == bolt.ErrTimeout {
+		return nil, errors.ErrDBLocked
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// dbPath returns the path of the database of a node in the data directory.
+func dbPath(nodeID string) string {
+	return config.Path(fmt.Sprintf(dbFileFormat, nodeID))
+}
+
+// dbExists checks if the database file exists.
+func dbExists(dbFile string) bool {
+	if _, err := os.Stat(dbFile); os.IsNotExist(err) {
+		return false
+	}
+
+	return true
+}
+
+// NewBlockchain creates a new blockchain from boltDB. If the blockchain does not exist, it creates
+// a genesis block and adds it to the database.
+func NewBlockchain(nodeID string) (*Blockchain, error) {
+	dbFile := dbPath(nodeID)
+	if !dbExists(dbFile) {
+		return nil, errors.ErrDBDoesNotExist
+	}
+
+	return openBlockchain(dbFile)
+}
+
+// openBlockchain opens the blockchain database at the given path, bringing it to the current
+// schema and repairing its UTXO set.
+func openBlockchain(dbFile string) (*Blockchain, error) {
+	var tip []byte
+	db, err := openDB(dbFile)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkSchemaVersion(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(blocksBucket))
+		if b == nil || b.Get([]byte("l")) == nil {
+			return errors.ErrNotBlockchain
+		}
+
+		// Copy the hash, bolt only keeps it valid for the life of the transaction
+		tip = append([]byte{}, b.Get([]byte("l"))...)
+
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	config, err := loadConfig(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	bc := Blockchain{tip: tip, db: db, config: config, logger: logger.Nop()}
+
+	// Bring databases written by older versions to the current layout
+	err = bc.migrate()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	bc.params, err = bc.loadParams()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	// Repair the UTXO set if the last run stopped between writing a block and updating it
+	UTXOSet := UTXOSet{Blockchain: &bc}
+	err = UTXOSet.Reconcile()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &bc, nil
+}
+
+// createBlockchain creates a new blockchain database. It also creates a genesis block and adds it
+// to the database.
+func CreateBlockchain(address transaction.Address, nodeID string, params GenesisConfig, config Config) (*Blockchain, error) {
+	dbFile := dbPath(nodeID)
+	if dbExists(dbFile) {
+		return nil, errors.ErrDBExists
+	}
+
+	genesis, params, config, err := newGenesis(address, params, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return createBlockchain(dbFile, genesis, params, config)
+}
+
+// newGenesis mines the genesis block of a new chain paying address, and returns it along with the
+// parameters of the chain, their zero fields set to their defaults.
+func newGenesis(address transaction.Address, params GenesisConfig, config Config) (*block.Block, GenesisConfig, Config, error) {
+	params = params.withDefaults()
+	if params.TargetBits < 1 || params.TargetBits > 255 {
+		return nil, GenesisConfig{}, Config{}, errors.ErrInvalidTargetBits
+	}
+
+	if params.Subsidy < 0 {
+		return nil, GenesisConfig{}, Config{}, errors.ErrInvalidSubsidy
+	}
+
+	config.TargetBits = params.TargetBits
+	config = config.withDefaults()
+
+	chainParams := transaction.ChainParams{InitialSubsidy: params.Subsidy, HalvingInterval: params.HalvingInterval}
+	cbtx, err := transaction.NewCoinbaseTX(address, params.CoinbaseData, 0, chainParams)
+	if err != nil {
+		return nil, GenesisConfig{}, Config{}, err
+	}
+
+	genesis, err := block.NewGenesisBlock(cbtx, params.TargetBits, params.Timestamp)
+	if err != nil {
+		return nil, GenesisConfig{}, Config{}, err
+	}
+
+	return genesis, params, config, nil
+}
+
+// createBlockchain creates the database at the given path, holding the genesis block of a chain with
+// the given parameters.
+func createBlockchain(dbFile string, genesis *block.Block, params GenesisConfig, config Config) (*Blockchain, error) {
+	// Open the database
+	db, err := openDB(dbFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return initBlockchain(db, genesis, params, config)
+}
+
+// initBlockchain writes the genesis block of a chain with the given parameters to an empty
+// database. The database is closed if it fails.
+func initBlockchain(db *bolt.DB, genesis *block.Block, params GenesisConfig, config Config) (*Blockchain, error) {
+	var tip []byte
+
+	// Create a bucket if it does not exist
+	err := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte(blocksBucket))
+		if err != nil {
+			return err
+		}
+
+		sb, err := genesis.Serialize()
+		if err != nil {
+			return err
+		}
+
+		err = b.Put(genesis.Hash, sb)
+		if err != nil {
+			return err
+		}
+
+		err = b.Put([]byte("l"), genesis.Hash)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.CreateBucket([]byte(heightsBucket))
+		if err != nil {
+			return err
+		}
+
+		err = indexHeights(tx, genesis)
+		if err != nil {
+			return err
+		}
+
+		err = putConfig(tx, config)
+		if err != nil {
+			return err
+		}
+
+		err = putParams(tx, params)
+		if err != nil {
+			return err
+		}
+
+		// The UTXO set and its indexes start with the outputs of the genesis block
+		err = resetAddressIndex(tx)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.CreateBucket([]byte(txIndexBucket))
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.CreateBucket([]byte(utxoBucket))
+		if err != nil {
+			return err
+		}
+
+		err = connectBlock(tx, genesis)
+		if err != nil {
+			return err
+		}
+
+		err = putSchemaVersion(tx, SchemaVersion)
+		if err != nil {
+			return err
+		}
+
+		tip = genesis.Hash
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	bc := Blockchain{tip: tip, db: db, chainID: genesis.Hash, config: config, params: params, logger: logger.Nop()}
+
+	return &bc, nil
+}
+
+// AddBlock adds a block to the blockchain, leaving the UTXO set to Reconcile or Reindex.
+func (bc *Blockchain) AddBlock(bl *block.Block) error {
+	return bc.storeBlock(bl, false)
+}
+
+// ConnectBlock adds a block to the blockchain as AddBlock does. If the block extends the main
+// chain, its transactions are applied to the UTXO set in the same database transaction, so a crash
+// never leaves the set behind the stored tip. A block completing a longer branch is left for
+// Reconcile.
+func (bc *Blockchain) ConnectBlock(bl *block.Block) error {
+	return bc.storeBlock(bl, true)
+}
+
+// storeBlock writes a block and moves the tip to it if it is higher, applying it to the UTXO set
+// if connect is set.
+func (bc *Blockchain) storeBlock(bl *block.Block, connect bool) error {
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+
+	var newTip []byte
+	err := bc.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(blocksBucket))
+		blockInDB := b.Get(bl.Hash)
+
+		if blockInDB != nil {
+			return errors.ErrBlockExists
+		}
+
+		blockData, err := bl.Serialize()
+		if err != nil {
+			return err
+		}
+
+		err = b.Put(bl.Hash, blockData)
+		if err != nil {
+			return err
+		}
+
+		lastHash := b.Get([]byte("l"))
+		lastBlockData := b.Get(lastHash)
+		lastBlock, err := block.DeserializeBlock(lastBlockData)
+		if err != nil {
+			return err
+		}
+
+		if bl.Height > lastBlock.Height {
+			err = b.Put([]byte("l"), bl.Hash)
+			if err != nil {
+				return err
+			}
+
+			err = indexHeights(tx, bl)
+			if err != nil {
+				return err
+			}
+
+			if connect {
+				err = connectTip(tx, bl)
+				if err != nil {
+					return err
+				}
+			}
+
+			newTip = bl.Hash
+		}
+
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "block %x", bl.Hash)
+	}
+
+	// The tip only moves once the block is committed
+	if newTip != nil {
+		bc.tip = newTip
+	}
+
+	return nil
+}
+
+// FindTransaction finds a transaction by its ID.
+func (bc *Blockchain) FindTransaction(ID []byte) (transaction.Transaction, error) {
+	tx, _, err := bc.FindTransactionBlock(ID)
+	return tx, err
+}
+
+// FindTransactionBlock finds a transaction of the main chain by its ID, along with the block
+// holding it. The transaction index is consulted first, the chain is scanned from the tip for the
+// transactions it does not hold.
+func (bc *Blockchain) FindTransactionBlock(ID []byte) (transaction.Transaction, *block.Block, error) {
+	indexedTx, indexedBlock, err := bc.findIndexedTransaction(ID)
+	if err != nil {
+		return transaction.Transaction{}, nil, err
+	}
+	if indexedBlock != nil {
+		return *indexedTx, indexedBlock, nil
+	}
+
+	bci := bc.Iterator()
+
+	// Iterate over the blockchain
+	for {
+		block, err := bci.Next()
+		if err != nil {
+			return transaction.Transaction{}, nil, err
+		}
+
+		for _, tx := range block.Transactions {
+			if bytes.Equal(tx.ID, ID) {
+				return *tx, block, nil
+			}
+		}
+
+		if len(block.PrevBlockHash) == 0 {
+			break
+		}
+	}
+
+	return transaction.Transaction{}, nil, errors.ErrTransactionNotFound
+}
+
+// ChainID returns the identifier of the chain committed to by transaction signatures, which is the
+// hash of the genesis block.
+func (bc *Blockchain) ChainID() ([]byte, error) {
+	bc.lock.RLock()
+	chainID := bc.chainID
+	bc.lock.RUnlock()
+
+	if chainID != nil {
+		return chainID, nil
+	}
+
+	genesis, err := bc.GetBlockByHeight(0)
+	if err != nil {
+		return nil, err
+	}
+
+	bc.lock.Lock()
+	bc.chainID = genesis.Hash
+	bc.lock.Unlock()
+
+	return genesis.Hash, nil
+}
+
+// FindPublicKey finds the public key hashing to pubKeyHash. A public key only appears on the chain
+// once its owner has spent an output, so ErrPublicKeyNotFound is returned for fresh addresses.
+func (bc *Blockchain) FindPublicKey(pubKeyHash []byte) ([]byte, error) {
+	bci := bc.Iterator()
+
+	// Iterate over the blockchain
+	for {
+		block, err := bci.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, tx := range block.Transactions {
+			if tx.IsCoinbase() {
+				continue
+			}
+
+			for _, in := range tx.Vin {
+				if ok, err := in.UsesKey(pubKeyHash); err != nil {
+					return nil, err
+				} else if ok {
+					return in.PublicKey, nil
+				}
+			}
+		}
+
+		if len(block.PrevBlockHash) == 0 {
+			break
+		}
+	}
+
+	return nil, errors.ErrPublicKeyNotFound
+}
+
+// FindUTXO finds and returns all unspent transaction outputs.
+func (bc *Blockchain) FindUTXO() (map[string]transaction.TXOutputs, error) {
+	UTXOs := make(map[string]transaction.TXOutputs)
+	spentTXO := make(map[string][]int)
+	bci := bc.Iterator()
+
+	// Iterate over the blockchain
+	for {
+		block, err := bci.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, tx := range block.Transactions {
+			txID := hex.EncodeToString(tx.ID)
+
+			var outs transaction.TXOutputs
+
+		Outputs:
+			for outIdx, out := range tx.Vout {
+				// If the output has already been spent, or can never be, keep its place with an empty
+				// output
+				if out.IsData() {
+					outs.Outputs = append(outs.Outputs, transaction.TXOutput{})
+					continue
+				}
+
+				if spentTXO[txID] != nil {
+					for _, spentOut := range spentTXO[txID] {
+						if spentOut == outIdx {
+							outs.Outputs = append(outs.Outputs, transaction.TXOutput{})
+							continue Outputs
+						}
+					}
+				}
+
+				outs.Outputs = append(outs.Outputs, out)
+			}
+
+			if !outs.AllSpent() {
+				UTXOs[txID] = outs
+			}
+
+			// If the transaction is not a coinbase transaction, add the inputs to the spentTXOs map
+			if !tx.IsCoinbase() {
+				for _, in := range tx.Vin {
+					inTxID := hex.EncodeToString(in.Txid)
+					spentTXO[inTxID] = append(spentTXO[inTxID], in.Vout)
+				}
+			}
+		}
+
+		// If the genesis block has been reached, break out of the loop
+		if len(block.PrevBlockHash) == 0 {
+			break
+		}
+	}
+
+	return UTXOs, nil
+}
+
+// GetBestHeight returns the height of the latest block in the blockchain.
+func (bc *Blockchain) GetBestHeight() (int, error) {
+	var lastBlock *block.Block
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(blocksBucket))
+		lastHash := b.Get([]byte("l"))
+		blockData := b.Get(lastHash)
+
+		var err error = nil
+		lastBlock, err = block.DeserializeBlock(blockData)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return lastBlock.Height, nil
+}
+
+// GetBlock returns a block by its hash, or ErrBlockNotFound if the database does not hold it.
+func (bc *Blockchain) GetBlock(blockHash []byte) (*block.Block, error) {
+	var bl *block.Block
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(blocksBucket))
+		blockData := b.Get(blockHash)
+		if blockData == nil {
+			return errors.ErrBlockNotFound
+		}
+
+		var err error = nil
+		bl, err = block.DeserializeBlock(blockData)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return bl, nil
+}
+
+// FindFork compares the branch ending at oldTip with the main chain. It returns the blocks of the
+// old branch that are no longer on the main chain and the main chain blocks that replaced them,
+// both ordered from the tip down to the common ancestor.
+func (bc *Blockchain) FindFork(oldTip []byte) ([]*block.Block, []*block.Block, error) {
+	var disconnected, connected []*block.Block
+
+	oldBlock, err := bc.GetBlock(oldTip)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	newBlock, err := bc.GetBlock(bc.Tip())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Walk both branches back until they meet
+	for !bytes.Equal(oldBlock.Hash, newBlock.Hash) {
+		if oldBlock.Height >= newBlock.Height {
+			disconnected = append(disconnected, oldBlock)
+			oldBlock, err = bc.GetBlock(oldBlock.PrevBlockHash)
+			if err != nil {
+				return nil, nil, err
+			}
+		} else {
+			connected = append(connected, newBlock)
+			newBlock, err = bc.GetBlock(newBlock.PrevBlockHash)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	return disconnected, connected, nil
+}
+
+// GetBlockHashes returns a slice of hashes of all the blocks in the blockchain.
+func (bc *Blockchain) GetBlockHashes() ([][]byte, error) {
+	var blocks [][]byte
+
+	bci := bc.Iterator()
+
+	// Iterate over the blockchain
+	for {
+		block, err := bci.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		blocks = append(blocks, block.Hash)
+
+		if len(block.PrevBlockHash) == 0 {
+			break
+		}
+	}
+
+	return blocks, nil
+}
+
+// MineBlock mines a new block with the provided transactions. It adds the block to the blockchain
+// and applies it to the UTXO set in one database transaction. The transactions are verified before
+// the block is mined. Once ctx is done, mining is abandoned and the error of ctx is returned.
+func (bc *Blockchain) MineBlock(ctx context.Context, transactions []*transaction.Transaction) (*block.Block, error) {
+	return bc.mineBlock(ctx, transactions)
+}
+
+// maxGenerateBits is the highest difficulty at which blocks are generated on demand without force
+const maxGenerateBits = 20
+
+// GenerateBlocks mines n blocks on top of the tip, paying every reward to address. The provided
+// transactions are included in the first block. The UTXO set is updated with each block. Unless
+// force is set, it refuses to run when the difficulty makes mining on demand impractical.
+func (bc *Blockchain) GenerateBlocks(n int, address transaction.Address, transactions []*transaction.Transaction, force bool) ([]*block.Block, error) {
+	bits, err := bc.TargetBits()
+	if err != nil {
+		return nil, err
+	}
+
+	if bits > maxGenerateBits && !force {
+		return nil, errors.ErrDifficultyTooHigh
+	}
+
+	height, err := bc.GetBestHeight()
+	if err != nil {
+		return nil, err
+	}
+
+	var blocks []*block.Block
+	for i := 0; i < n; i++ {
+		cbTx, err := transaction.NewCoinbaseTX(address, "", height+i+1, bc.ChainParams())
+		if err != nil {
+			return nil, err
+		}
+
+		txs := []*transaction.Transaction{cbTx}
+		if i == 0 {
+			txs = append(txs, transactions...)
+		}
+
+		newBlock, err := bc.mineBlock(context.Background(), txs)
+		if err != nil {
+			return nil, err
+		}
+
+		blocks = append(blocks, newBlock)
+	}
+
+	return blocks, nil
+}
+
+// templateCoinbaseData is the data of the coinbase of a block template. It is fixed so that a
+// template only depends on its inputs, the height the coinbase commits to keeping its ID unique.
+const templateCoinbaseData = "glock"
+
+// BuildBlockTemplate returns an unmined block on top of the tip holding the given transactions,
+// which must not include a coinbase, after a coinbase paying the reward and the fees to
+// coinbaseAddr. The header fields are set and the nonce is 0, so the block only needs its
+// proof-of-work before it is handed to SubmitBlock. The same tip, transactions and time give the
+// same template within a second.
+func (bc *Blockchain) BuildBlockTemplate(txs []*transaction.Transaction, coinbaseAddr transaction.Address) (*block.Block, error) {
+	height, err := bc.GetBestHeight()
+	if err != nil {
+		return nil, err
+	}
+
+	cbTx, err := transaction.NewCoinbaseTX(coinbaseAddr, templateCoinbaseData, height+1, bc.ChainParams())
+	if err != nil {
+		return nil, err
+	}
+
+	return bc.buildTemplate(append([]*transaction.Transaction{cbTx}, txs...))
+}
+
+// SubmitBlock connects a block mined from a template. Its proof-of-work and transactions are
+// checked as CheckBlock does, and ErrStaleBlock is returned if the tip has moved since the template
+// was built.
+func (bc *Blockchain) SubmitBlock(bl *block.Block) error {
+	if !bytes.Equal(bl.PrevBlockHash, bc.Tip()) {
+		return errors.Wrapf(errors.ErrStaleBlock, "block %x", bl.Hash)
+	}
+
+	err := bc.CheckBlock(bl)
+	if err != nil {
+		return err
+	}
+
+	return bc.ConnectBlock(bl)
+}
+
+// mineBlock mines a new block with the provided transactions and writes it to the database, along
+// with its effect on the UTXO set. It takes the same path as an external miner: a template, its
+// proof-of-work, then SubmitBlock.
+func (bc *Blockchain) mineBlock(ctx context.Context, transactions []*transaction.Transaction) (*block.Block, error) {
+	newBlock, err := bc.buildTemplate(transactions)
+	if err != nil {
+		return nil, err
+	}
+
+	err = newBlock.Mine(ctx, bc.progress)
+	if err != nil {
+		return nil, err
+	}
+
+	err = bc.SubmitBlock(newBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	return newBlock, nil
+}
+
+// buildTemplate returns an unmined block on top of the tip with the provided transactions, the
+// ones beyond the limits of the chain left out and the fees added to the coinbase.
+func (bc *Blockchain) buildTemplate(transactions []*transaction.Transaction) (*block.Block, error) {
+	var lastHash []byte
+	var lastBlock *block.Block
+
+	transactions, err := bc.selectForBlock(transactions)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify the transactions
+	for _, tx := range transactions {
+		if ok, err := bc.VerifyTransaction(tx); err != nil {
+			return nil, err
+		} else if !ok {
+			return nil, errors.ErrInvalidTransaction
+		}
+	}
+
+	// Pay the fees of the block to the miner through the coinbase
+	fees := 0
+	var coinbase *transaction.Transaction
+	for _, tx := range transactions {
+		if tx.IsCoinbase() {
+			coinbase = tx
+			continue
+		}
+
+		fee, err := bc.TransactionFee(tx)
+		if err != nil {
+			return nil, err
+		}
+
+		fees, err = transaction.AddValues(fees, fee)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if coinbase != nil && fees > 0 {
+		coinbase.Vout[0].Value, err = transaction.AddValues(coinbase.Vout[0].Value, fees)
+		if err != nil {
+			return nil, err
+		}
+
+		coinbase.ID, err = coinbase.Hash()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Get the last block's hash
+	err = bc.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(blocksBucket))
+		lastHash = append([]byte{}, b.Get([]byte("l"))...)
+
+		// Get the last block
+		blockData := b.Get(lastHash)
+
+		var err error
+		lastBlock, err = block.DeserializeBlock(blockData)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The coinbase was built for the next height, a tip that moved since cannot take it
+	if coinbase != nil {
+		height, ok := coinbase.CoinbaseHeight()
+		if !ok || height != lastBlock.Height+1 {
+			return nil, errors.Wrapf(errors.ErrInvalidTransaction, "coinbase commits to height %d, the block is at %d", height, lastBlock.Height+1)
+		}
+	}
+
+	bits, err := bc.NextBits(lastBlock, block.CurrentVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp, err := bc.nextTimestamp(lastBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	return block.NewBlockTemplate(transactions, lastHash, lastBlock.Height+1, bits, timestamp), nil
+}
+
+// SignTransaction signs inputs of a Transaction.
+func (bc *Blockchain) SignTransaction(tx *transaction.Transaction, privKey ecdsa.PrivateKey) error {
+	prevTXs := make(map[string]transaction.Transaction)
+
+	// Iterate over the transaction inputs
+	for _, vin := range tx.Vin {
+		prevTX, err := bc.FindTransaction(vin.Txid)
+		if err != nil {
+			return err
+		}
+
+		prevTXs[hex.EncodeToString(prevTX.ID)] = prevTX
+	}
+
+	chainID, err := bc.ChainID()
+	if err != nil {
+		return err
+	}
+
+	return tx.Sign(privKey, prevTXs, chainID)
+}
+
+// VerifyTransaction verifies transaction inputs for inclusion in the next block. It reports an
+// invalid transaction as false, and returns the errors of CheckTransaction that are not about the
+// transaction itself, such as ErrTransactionNotFound for an input spending an unknown transaction.
+func (bc *Blockchain) VerifyTransaction(tx *transaction.Transaction) (bool, error) {
+	err := bc.CheckTransaction(tx)
+	if errors.Is(err, errors.ErrInvalidTransaction) || errors.Is(err, errors.ErrInvalidSignature) || errors.Is(err, errors.ErrInvalidPublicKey) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// CheckTransaction checks a transaction for inclusion in the next block as VerifyTransaction does,
+// returning why it is invalid: ErrInvalidSignature or ErrInvalidPublicKey naming the input that
+// fails, or ErrInvalidTransaction with the reason.
+func (bc *Blockchain) CheckTransaction(tx *transaction.Transaction) error {
+	err := tx.CheckDataOutputs(bc.maxDataSize())
+	if err != nil {
+		return errors.Wrap(errors.ErrInvalidTransaction, err.Error())
+	}
+
+	err = tx.CheckOutputValues(bc.dustThreshold())
+	if err != nil {
+		return errors.Wrap(errors.ErrInvalidTransaction, err.Error())
+	}
+
+	if tx.IsCoinbase() {
+		return nil
+	}
+
+	height, err := bc.GetBestHeight()
+	if err != nil {
+		return err
+	}
+
+	// Past the activation, signatures that do not commit to this chain are rejected
+	if bc.requiresChainID(height+1) && tx.Version < transaction.ChainIDVersion {
+		return errors.Wrap(errors.ErrInvalidTransaction, "signature does not commit to the chain")
+	}
+
+	chainID, err := bc.ChainID()
+	if err != nil {
+		return err
+	}
+
+	prevTXs := make(map[string]transaction.Transaction)
+
+	// Iterate over the transaction inputs
+	for i, vin := range tx.Vin {
+		prevTX, err := bc.FindTransaction(vin.Txid)
+		if err != nil {
+			return errors.Wrapf(err, "input %d (%x:%d)", i, vin.Txid, vin.Vout)
+		}
+
+		if vin.Vout < 0 || vin.Vout >= len(prevTX.Vout) {
+			return errors.Wrapf(errors.ErrInvalidTransaction, "input %d spends unknown output %x:%d", i, vin.Txid, vin.Vout)
+		}
+
+		prevTXs[hex.EncodeToString(prevTX.ID)] = prevTX
+	}
+
+	// The outputs cannot be worth more than the inputs, the difference is the fee
+	fee, err := transactionFee(tx, prevTXs)
+	if err != nil {
+		return errors.Wrap(errors.ErrInvalidTransaction, err.Error())
+	}
+	if fee < 0 {
+		return errors.Wrap(errors.ErrInvalidTransaction, "outputs are worth more than the inputs")
+	}
+
+	if !checkPaymentOutputs(tx) {
+		return errors.Wrap(errors.ErrInvalidTransaction, "invalid payment output")
+	}
+
+	return tx.VerifyInputs(prevTXs, chainID)
+}
+
+// Recipient is a destination of a transaction and the amount paid to it
+type Recipient struct {
+	Address transaction.Address // the address of the recipient
+	Amount  int                 // the amount paid to the recipient
+}
+
+// NewUTXOTransaction creates a new transaction paying fee to the miner on top of amount, funded by
+// the outputs chosen by selector, FirstFit if it is nil. Signing is done here. If memo is not nil,
+// it is appended as the last output.
+func NewUTXOTransaction(wallet *transaction.Wallet, to transaction.Address, amount, fee int, memo *transaction.TXOutput, selector CoinSelector, UTXOSet *UTXOSet) (*transaction.Transaction, error) {
+	return NewUTXOTransactionMulti(wallet, []Recipient{{Address: to, Amount: amount}}, fee, memo, selector, UTXOSet)
+}
+
+// NewUTXOTransactionMulti creates a new transaction with one output per recipient and a single
+// change output, paying fee to the miner on top of the amounts and funded by the outputs chosen by
+// selector, FirstFit if it is nil. Signing is done here. If memo is not nil, it is appended as the
+// last output.
+func NewUTXOTransactionMulti(wallet *transaction.Wallet, recipients []Recipient, fee int, memo *transaction.TXOutput, selector CoinSelector, UTXOSet *UTXOSet) (*transaction.Transaction, error) {
+	tx, err := NewUnsignedTransaction(wallet.PublicKey, recipients, fee, memo, selector, UTXOSet)
+	if err != nil {
+		return nil, err
+	}
+
+	err = UTXOSet.Blockchain.SignTransaction(tx, wallet.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+// NewUnsignedTransaction creates the transaction NewUTXOTransactionMulti would, paying from the
+// address of pubKey, without signing it. Payments below the dust threshold of the chain return
+// ErrDustOutput, while change below it is left to the fee. Its inputs carry pubKey, so the wallet
+// holding the private key can sign it later, see Wallets.SignRaw. With no recipients, it carries
+// the memo, a data output, for the fee alone. Given a multisig script instead of a key, it pays
+// from the multisig address, and the wallets holding its keys co-sign it.
+func NewUnsignedTransaction(pubKey []byte, recipients []Recipient, fee int, memo *transaction.TXOutput, selector CoinSelector, UTXOSet *UTXOSet) (*transaction.Transaction, error) {
+	var inputs []transaction.TXInput
+	var outputs []transaction.TXOutput
+
+	pubKeyHash, err := (&transaction.TXInput{PublicKey: pubKey}).LockingHash()
+	if err != nil {
+		return nil, err
+	}
+	from := transaction.NewAddress(pubKeyHash, UTXOSet.Blockchain.AddressNetwork())
+
+	if (len(recipients) == 0 && memo == nil) || fee < 0 {
+		return nil, errors.ErrInvalidAmount
+	}
+
+	dustThreshold := UTXOSet.Blockchain.dustThreshold()
+
+	// Every recipient is paid a positive amount once, and never the sender, whose only output is
+	// the change
+	amount := 0
+	seen := make(map[string]bool)
+	for _, r := range recipients {
+		if r.Amount <= 0 {
+			return nil, errors.ErrInvalidAmount
+		}
+
+		if r.Amount < dustThreshold {
+			return nil, errors.ErrDustOutput
+		}
+
+		if seen[r.Address.String()] || r.Address.Equal(from) {
+			return nil, errors.ErrDuplicateRecipient
+		}
+		seen[r.Address.String()] = true
+
+		amount, err = transaction.AddValues(amount, r.Amount)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	total, err := transaction.AddValues(amount, fee)
+	if err != nil {
+		return nil, err
+	}
+
+	// A transaction only carrying data pays a fee, so it spends at least one input
+	if total == 0 {
+		return nil, errors.ErrInvalidAmount
+	}
+
+	acc, validOutputs, err := UTXOSet.FindSpendableOutputs(pubKeyHash, total, selector)
+	if err != nil {
+		return nil, err
+	}
+
+	if acc < total {
+		return nil, errors.ErrNotEnoughFunds
+	}
+
+	// Build a list of inputs
+	for txID, outs := range validOutputs {
+		txID, err := hex.DecodeString(txID)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, out := range outs {
+			input := transaction.TXInput{Txid: txID, Vout: out, Signature: nil, PublicKey: pubKey}
+			inputs = append(inputs, input)
+		}
+	}
+
+	// Build a list of outputs
+	for _, r := range recipients {
+		output, err := transaction.NewTXOutput(r.Amount, r.Address)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, *output)
+	}
+	if acc-total >= dustThreshold {
+		change, err := transaction.NewTXOutput(acc-total, from) // a change
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, *change)
+	}
+	if memo != nil {
+		outputs = append(outputs, *memo)
+	}
+
+	tx := transaction.Transaction{ID: nil, Vin: inputs, Vout: outputs, Version: transaction.ChainIDVersion}
+	tx.ID, err = tx.Hash()
+	if err != nil {
+		return nil, err
+	}
+
+	return &tx, nil
+}
+
+// TargetBits returns the difficulty of the next block on top of the tip, in leading zero bits.
+func (bc *Blockchain) TargetBits() (int, error) {
+	tip, err := bc.GetBlock(bc.Tip())
+	if err != nil {
+		return 0, err
+	}
+
+	target, err := bc.NextTarget(tip)
+	if err != nil {
+		return 0, err
+	}
+
+	return block.TargetZeroBits(target), nil
+}
+
+// FreelistSize returns the number of bytes used by the freelist of the database.
+func (bc *Blockchain) FreelistSize() int {
+	return bc.db.Stats().FreelistInuse
+}
+
+// SetLogger sets the destination of the messages of the chain, which are discarded by default.
+func (bc *Blockchain) SetLogger(l logger.Logger) {
+	bc.logger = l
+}
+
+// SetMiningProgress sets the function receiving the progress of the blocks mined on the chain.
+func (bc *Blockchain) SetMiningProgress(progress block.ProgressFunc) {
+	bc.progress = progress
+}
+
+// Tip returns the hash of the last block in the chain.
+func (bc *Blockchain) Tip() []byte {
+	bc.lock.RLock()
+	defer bc.lock.RUnlock()
+
+	return bc.tip
+}
+
+// Close closes the database connection in the blockchain. It does nothing on a nil blockchain.
+func (bc *Blockchain) CloseDB() {
+	if bc == nil || bc.db == nil {
+		return
+	}
+
+	bc.db.Close()
+}
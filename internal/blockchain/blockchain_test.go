@@ -0,0 +1,432 @@
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/yanglinshu/glock/internal/block"
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// newAddress returns the address of a new wallet
+func newAddress(t testing.TB) transaction.Address {
+	t.Helper()
+
+	w, err := transaction.NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pubKeyHash, err := transaction.HashPubKey(w.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return transaction.NewAddress(pubKeyHash, transaction.Mainnet)
+}
+
+// balance returns the value of the unspent outputs paying address
+func balance(t *testing.T, c *TestChain, address transaction.Address) int {
+	t.Helper()
+
+	outs, err := c.UTXOSet().FindUTXO(address.PubKeyHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	total := 0
+	for _, out := range outs {
+		total += out.Value
+	}
+
+	return total
+}
+
+// bestHeight returns the height of the tip of the chain
+func bestHeight(t testing.TB, c *TestChain) int {
+	t.Helper()
+
+	height, err := c.GetBestHeight()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return height
+}
+
+func TestNewTestChain(t *testing.T) {
+	c := NewTestChain(t)
+
+	if height := bestHeight(t, c); height != 0 {
+		t.Fatalf("height of a new chain = %d, want 0", height)
+	}
+
+	genesis, err := c.GetBlock(c.Tip())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !block.NewProofOfWork(genesis).Validate() {
+		t.Fatal("the genesis block has an invalid proof-of-work")
+	}
+
+	if got := balance(t, c, c.Address()); got != transaction.DefaultSubsidy {
+		t.Fatalf("balance of the wallet = %d, want %d", got, transaction.DefaultSubsidy)
+	}
+}
+
+func TestMineBlock(t *testing.T) {
+	c := NewTestChain(t)
+	to := newAddress(t)
+
+	cbTx, err := transaction.NewCoinbaseTX(to, "", 1, c.ChainParams())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bl, err := c.MineBlock(context.Background(), []*transaction.Transaction{cbTx})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bl.Height != 1 {
+		t.Fatalf("height of the mined block = %d, want 1", bl.Height)
+	}
+
+	if !bytes.Equal(c.Tip(), bl.Hash) {
+		t.Fatalf("tip = %x, want the mined block %x", c.Tip(), bl.Hash)
+	}
+
+	if !block.NewProofOfWork(bl).Validate() {
+		t.Fatal("the mined block has an invalid proof-of-work")
+	}
+
+	stored, err := c.GetBlock(bl.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stored.Transactions) != 1 || !bytes.Equal(stored.Transactions[0].ID, cbTx.ID) {
+		t.Fatalf("the stored block does not hold the coinbase %x", cbTx.ID)
+	}
+
+	// The coinbase is applied to the UTXO set along with the block
+	if got := balance(t, c, to); got != transaction.DefaultSubsidy {
+		t.Fatalf("balance of the miner = %d, want %d", got, transaction.DefaultSubsidy)
+	}
+}
+
+func TestMineBlockRejectsInvalidTransaction(t *testing.T) {
+	c := NewTestChain(t)
+	tip := c.Tip()
+
+	// The wallet signs a payment, which is then redirected to another address
+	tx, err := NewUTXOTransaction(c.Wallet, newAddress(t), 5, 0, nil, nil, c.UTXOSet())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = tx.Vout[0].Lock(newAddress(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cbTx, err := transaction.NewCoinbaseTX(c.Address(), "", 1, c.ChainParams())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.MineBlock(context.Background(), []*transaction.Transaction{cbTx, tx})
+	if err == nil {
+		t.Fatal("MineBlock accepted a transaction changed after it was signed")
+	}
+
+	if !bytes.Equal(c.Tip(), tip) {
+		t.Fatal("the tip moved after a block failed to be mined")
+	}
+}
+
+func TestFindUTXO(t *testing.T) {
+	c := NewTestChain(t)
+	to := newAddress(t)
+
+	c.MineBlocks(2)
+	c.Fund(to, 25)
+
+	if got := balance(t, c, to); got != 25 {
+		t.Fatalf("balance of the funded address = %d, want 25", got)
+	}
+
+	// Four rewards were mined, one of them paying for the funding whose change came back
+	want := 4*transaction.DefaultSubsidy - 25
+	if got := balance(t, c, c.Address()); got != want {
+		t.Fatalf("balance of the wallet = %d, want %d", got, want)
+	}
+
+	// The UTXO set matches the outputs found by scanning the chain
+	utxos, err := c.FindUTXO()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	total := 0
+	for _, outs := range utxos {
+		for _, out := range outs.Outputs {
+			total += out.Value
+		}
+	}
+
+	if total != 4*transaction.DefaultSubsidy {
+		t.Fatalf("value of the outputs found by scanning = %d, want %d", total, 4*transaction.DefaultSubsidy)
+	}
+
+	if got := balance(t, c, newAddress(t)); got != 0 {
+		t.Fatalf("balance of an unknown address = %d, want 0", got)
+	}
+}
+
+func TestFindUTXOSpentOutputs(t *testing.T) {
+	c := NewTestChain(t)
+	to := newAddress(t)
+
+	// The genesis reward is spent entirely, leaving the wallet without outputs
+	c.Fund(to, transaction.DefaultSubsidy)
+
+	outs, err := c.UTXOSet().FindUTXO(c.Address().PubKeyHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the reward of the block holding the payment is left
+	if len(outs) != 1 || outs[0].Value != transaction.DefaultSubsidy {
+		t.Fatalf("outputs of the wallet = %v, want the last reward alone", outs)
+	}
+}
+
+func TestAddBlockHeightAndTip(t *testing.T) {
+	main := NewTestChain(t)
+	side := NewTestChain(t, WithWallet(main.Wallet))
+
+	if !bytes.Equal(main.Tip(), side.Tip()) {
+		t.Fatal("chains made with the same wallet do not share their genesis block")
+	}
+
+	main.MineBlocks(3)
+	tip := main.Tip()
+
+	// A shorter branch is stored without moving the tip
+	branch := side.MineBlocks(2)
+	for _, bl := range branch {
+		err := main.AddBlock(bl)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if height := bestHeight(t, main); height != 3 {
+		t.Fatalf("height after adding a shorter branch = %d, want 3", height)
+	}
+
+	if !bytes.Equal(main.Tip(), tip) {
+		t.Fatal("a shorter branch moved the tip")
+	}
+
+	if _, err := main.GetBlock(branch[1].Hash); err != nil {
+		t.Fatalf("the block of the shorter branch was not stored: %v", err)
+	}
+
+	// Once the branch grows higher, its blocks take the tip
+	branch = side.MineBlocks(2)
+	for _, bl := range branch {
+		err := main.AddBlock(bl)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if height := bestHeight(t, main); height != 4 {
+		t.Fatalf("height after adding a longer branch = %d, want 4", height)
+	}
+
+	if !bytes.Equal(main.Tip(), side.Tip()) {
+		t.Fatalf("tip = %x, want the tip of the longer branch %x", main.Tip(), side.Tip())
+	}
+
+	// A block is only stored once
+	err := main.AddBlock(branch[1])
+	if !errors.Is(err, errors.ErrBlockExists) {
+		t.Fatalf("adding a stored block = %v, want ErrBlockExists", err)
+	}
+}
+
+func TestNewUTXOTransactionUnencodableMemo(t *testing.T) {
+	c := NewTestChain(t)
+
+	memo := &transaction.TXOutput{Data: make([]byte, 1<<21)}
+	_, err := NewUTXOTransaction(c.Wallet, newAddress(t), 4, 1, memo, nil, c.UTXOSet())
+	if !errors.Is(err, errors.ErrUnencodable) {
+		t.Fatalf("NewUTXOTransaction with an oversized memo = %v, want ErrUnencodable", err)
+	}
+
+	// The chain is left untouched and keeps mining
+	c.MineBlocks(1)
+	if height := bestHeight(t, c); height != 1 {
+		t.Fatalf("height = %d, want 1", height)
+	}
+}
+
+func TestGenerateBlocks(t *testing.T) {
+	c := NewTestChain(t)
+	miner := newAddress(t)
+	to := newAddress(t)
+
+	tx, err := NewUTXOTransaction(c.Wallet, to, 5, 0, nil, nil, c.UTXOSet())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blocks, err := c.GenerateBlocks(3, miner, []*transaction.Transaction{tx}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(blocks) != 3 {
+		t.Fatalf("GenerateBlocks mined %d blocks, want 3", len(blocks))
+	}
+
+	for i, bl := range blocks {
+		if bl.Height != i+1 {
+			t.Fatalf("height of block %d = %d, want %d", i, bl.Height, i+1)
+		}
+
+		cbTx := bl.Transactions[0]
+		if !cbTx.IsCoinbase() || !cbTx.Vout[0].IsLockedWithKey(miner.PubKeyHash()) {
+			t.Fatalf("the coinbase of block %d does not pay the requested address", i)
+		}
+	}
+
+	// The transactions go in the first block only
+	if len(blocks[0].Transactions) != 2 || !bytes.Equal(blocks[0].Transactions[1].ID, tx.ID) {
+		t.Fatal("the first block does not hold the given transaction")
+	}
+
+	if len(blocks[1].Transactions) != 1 || len(blocks[2].Transactions) != 1 {
+		t.Fatal("a later block holds more than its coinbase")
+	}
+
+	if !bytes.Equal(c.Tip(), blocks[2].Hash) {
+		t.Fatal("the last generated block is not the tip")
+	}
+
+	if got := balance(t, c, miner); got != 3*transaction.DefaultSubsidy {
+		t.Fatalf("balance of the miner = %d, want %d", got, 3*transaction.DefaultSubsidy)
+	}
+
+	if got := balance(t, c, to); got != 5 {
+		t.Fatalf("balance of the payee = %d, want 5", got)
+	}
+}
+
+func TestGenerateBlocksRefusesHighDifficulty(t *testing.T) {
+	c := NewTestChain(t, WithTargetBits(maxGenerateBits+1))
+	tip := c.Tip()
+
+	_, err := c.GenerateBlocks(1, c.Address(), nil, false)
+	if !errors.Is(err, errors.ErrDifficultyTooHigh) {
+		t.Fatalf("GenerateBlocks above %d bits = %v, want ErrDifficultyTooHigh", maxGenerateBits, err)
+	}
+
+	if !bytes.Equal(c.Tip(), tip) {
+		t.Fatal("the tip moved after GenerateBlocks refused to run")
+	}
+}
+
+func TestTargetBitsPersisted(t *testing.T) {
+	c, path := newFileChain(t)
+	c.MineBlocks(2)
+	reopen(t, c, path)
+
+	bits, err := c.TargetBits()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bits != testTargetBits {
+		t.Fatalf("target bits of the reopened chain = %d, want %d", bits, testTargetBits)
+	}
+
+	// Blocks are mined and validated at the difficulty of the chain
+	for _, bl := range c.MineBlocks(2) {
+		if bl.TargetBits() != testTargetBits {
+			t.Fatalf("block %d mined at %d bits, want %d", bl.Height, bl.TargetBits(), testTargetBits)
+		}
+	}
+
+	err = c.ValidateChain()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMultisigPaymentTwoOfThree(t *testing.T) {
+	c := NewTestChain(t)
+	to := newAddress(t)
+
+	var cosigners []*transaction.Wallet
+	var hashes [][]byte
+	for i := 0; i < 3; i++ {
+		w, err := transaction.NewWallet()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cosigners = append(cosigners, w)
+
+		pubKeyHash, err := transaction.HashPubKey(w.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, pubKeyHash)
+	}
+
+	script, err := transaction.NewMultisigScript(2, hashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Fund(transaction.NewAddress(script, c.AddressNetwork()), 7)
+
+	chainID, err := c.ChainID()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := NewUnsignedTransaction(script, []Recipient{{to, 5}}, 2, nil, nil, c.UTXOSet())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// One of the two signatures required is not enough for a block
+	_, err = tx.SignInputs(*cosigners[2], chainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.CheckBlock(mineOnTip(t, c, tx))
+	wantValidationError(t, err, "1 of 2 signatures")
+
+	// Co-signed, the payment is mined
+	_, err = tx.SignInputs(*cosigners[0], chainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.MineBlocks(1, tx)
+
+	if got := balance(t, c, to); got != 5 {
+		t.Fatalf("balance of the payee of the multisig address = %d, want 5", got)
+	}
+
+	if got := balance(t, c, transaction.NewAddress(script, c.AddressNetwork())); got != 0 {
+		t.Fatalf("balance of the multisig address = %d, want 0", got)
+	}
+}
@@ -0,0 +1,86 @@
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/yanglinshu/glock/internal/block"
+	"github.com/yanglinshu/glock/internal/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Checkpoint pins the block of the main chain at a height
+type Checkpoint struct {
+	Height int    // the height of the block
+	Hash   []byte // the hash of the block
+}
+
+// lastCheckpoint returns the height of the highest checkpoint of the chain, -1 if it has none.
+func (bc *Blockchain) lastCheckpoint() int {
+	last := -1
+	for _, cp := range bc.config.Checkpoints {
+		if cp.Height > last {
+			last = cp.Height
+		}
+	}
+
+	return last
+}
+
+// checkCheckpoint returns a ValidationError if a checkpoint pins another block at the height of the
+// block.
+func (bc *Blockchain) checkCheckpoint(bl *block.Block) error {
+	for _, cp := range bc.config.Checkpoints {
+		if cp.Height == bl.Height && !bytes.Equal(cp.Hash, bl.Hash) {
+			return &ValidationError{bl.Height, bl.Hash, fmt.Sprintf("contradicts the checkpoint %x", cp.Hash)}
+		}
+	}
+
+	return nil
+}
+
+// skipsSignatures reports whether the signatures of a block at the given height are trusted. Blocks
+// at or below the highest checkpoint only have their proof-of-work, linkage and values checked,
+// since a branch leading to another block than the checkpoint is rejected when it reaches it.
+func (bc *Blockchain) skipsSignatures(height int) bool {
+	return height <= bc.lastCheckpoint()
+}
+
+// Checkpoints returns the checkpoints of the chain.
+func (bc *Blockchain) Checkpoints() []Checkpoint {
+	return bc.config.Checkpoints
+}
+
+// AddCheckpoint pins the block at a height and persists the checkpoint in the parameters of the
+// chain. It returns ErrCheckpointMismatch if the main chain holds another block at that height, or
+// if another checkpoint pins a block at that height.
+func (bc *Blockchain) AddCheckpoint(height int, hash []byte) error {
+	bl, err := bc.GetBlockByHeight(height)
+	if err != nil && !errors.Is(err, errors.ErrBlockNotFound) {
+		return err
+	}
+	if err == nil && !bytes.Equal(bl.Hash, hash) {
+		return errors.Wrapf(errors.ErrCheckpointMismatch, "main chain holds block %x at height %d", bl.Hash, height)
+	}
+
+	config := bc.config
+	config.Checkpoints = nil
+	for _, cp := range bc.config.Checkpoints {
+		if cp.Height != height {
+			config.Checkpoints = append(config.Checkpoints, cp)
+		} else if !bytes.Equal(cp.Hash, hash) {
+			return errors.Wrapf(errors.ErrCheckpointMismatch, "block %x is pinned at height %d", cp.Hash, height)
+		}
+	}
+	config.Checkpoints = append(config.Checkpoints, Checkpoint{height, hash})
+
+	err = bc.db.Update(func(tx *bolt.Tx) error {
+		return putConfig(tx, config)
+	})
+	if err != nil {
+		return err
+	}
+
+	bc.config = config
+	return nil
+}
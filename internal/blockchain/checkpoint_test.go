@@ -0,0 +1,193 @@
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/yanglinshu/glock/internal/block"
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// mineForged mines a block on top of the tip holding a payment of the wallet of the chain whose
+// signature was tampered with
+func mineForged(t *testing.T, c *TestChain) *block.Block {
+	t.Helper()
+
+	tx, err := NewUTXOTransaction(c.Wallet, newAddress(t), 4, 1, nil, nil, c.UTXOSet())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Vin[0].Signature[len(tx.Vin[0].Signature)-1] ^= 0xff
+
+	return mineOnTip(t, c, tx)
+}
+
+func TestCheckpointSkipsSignatures(t *testing.T) {
+	c := NewTestChain(t)
+	sync := NewTestChain(t, WithWallet(c.Wallet))
+
+	forged := mineForged(t, c)
+
+	err := c.CheckBlock(forged)
+	wantValidationError(t, err, "signature")
+
+	// Pinned by a checkpoint, the block is trusted without its signatures, as are the blocks below
+	err = c.AddCheckpoint(forged.Height, forged.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.SubmitBlock(forged)
+	if err != nil {
+		t.Fatalf("SubmitBlock of a block pinned by a checkpoint: %v", err)
+	}
+	c.MineBlocks(1)
+
+	// A node syncing without the checkpoint refuses the block, one with it follows the chain
+	err = sync.SubmitBlock(forged)
+	wantValidationError(t, err, "signature")
+
+	err = sync.AddCheckpoint(forged.Height, forged.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for height := 1; height <= 2; height++ {
+		bl, err := c.GetBlockByHeight(height)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = sync.SubmitBlock(bl)
+		if err != nil {
+			t.Fatalf("SubmitBlock of block %d with the checkpoint: %v", height, err)
+		}
+	}
+
+	if !bytes.Equal(sync.Tip(), c.Tip()) {
+		t.Fatal("the syncing node did not follow the chain past the checkpoint")
+	}
+
+	// Above the highest checkpoint, signatures are verified again
+	err = sync.CheckBlock(mineForged(t, sync))
+	wantValidationError(t, err, "signature")
+}
+
+func TestCheckpointStillChecksProofOfWork(t *testing.T) {
+	c := NewTestChain(t)
+
+	forged := mineForged(t, c)
+	err := c.AddCheckpoint(forged.Height+1, make([]byte, len(forged.Hash)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.CheckBlock(forged)
+	if err != nil {
+		t.Fatalf("CheckBlock of a block below the checkpoint: %v", err)
+	}
+
+	// Below a checkpoint, a block must still be mined on the tip
+	unmined := *forged
+	unmined.Nonce++
+	err = c.CheckBlock(&unmined)
+	if err == nil {
+		t.Fatal("CheckBlock of a block below the checkpoint with an invalid proof-of-work succeeded")
+	}
+
+	orphan := *forged
+	orphan.PrevBlockHash = make([]byte, len(forged.PrevBlockHash))
+	err = orphan.Mine(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.CheckBlock(&orphan)
+	if !errors.Is(err, errors.ErrOrphanBlock) {
+		t.Fatalf("CheckBlock of a block below the checkpoint off the chain = %v, want ErrOrphanBlock", err)
+	}
+}
+
+func TestCheckpointViolationRejected(t *testing.T) {
+	c := NewTestChain(t)
+	side := NewTestChain(t, WithWallet(c.Wallet))
+
+	// The checkpoint pins the block of the main chain at height 2, and the branch has another
+	pinned := c.MineBlocks(2)[1]
+	branch, err := side.GenerateBlocks(3, newAddress(t), nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.AddCheckpoint(pinned.Height, pinned.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The branch is accepted up to the block contradicting the checkpoint, so it never grows longer
+	// than the main chain
+	err = c.CheckBlock(branch[0])
+	if err != nil {
+		t.Fatalf("CheckBlock of the branch block below the checkpoint: %v", err)
+	}
+
+	err = c.ConnectBlock(branch[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.CheckBlock(branch[1])
+	wantValidationError(t, err, "contradicts the checkpoint")
+
+	if !bytes.Equal(c.Tip(), pinned.Hash) {
+		t.Fatal("a branch contradicting a checkpoint took the tip")
+	}
+
+	// A checkpoint contradicting the main chain or another checkpoint is refused
+	err = c.AddCheckpoint(pinned.Height, branch[1].Hash)
+	if !errors.Is(err, errors.ErrCheckpointMismatch) {
+		t.Fatalf("AddCheckpoint of another block than the main chain one = %v, want ErrCheckpointMismatch", err)
+	}
+
+	err = c.AddCheckpoint(10, branch[2].Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.AddCheckpoint(10, branch[1].Hash)
+	if !errors.Is(err, errors.ErrCheckpointMismatch) {
+		t.Fatalf("AddCheckpoint of another block than the pinned one = %v, want ErrCheckpointMismatch", err)
+	}
+
+	if len(c.Checkpoints()) != 2 {
+		t.Fatalf("chain has %d checkpoints, want 2", len(c.Checkpoints()))
+	}
+
+	// A chain already holding a contradicted block fails validation
+	c.config.Checkpoints = []Checkpoint{{pinned.Height, branch[1].Hash}}
+	err = c.ValidateChain()
+	wantValidationError(t, err, "contradicts the checkpoint")
+}
+
+func TestCheckpointsPersist(t *testing.T) {
+	c, path := newFileChain(t)
+	pinned := c.MineBlocks(1)[0]
+
+	err := c.AddCheckpoint(pinned.Height, pinned.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reopen(t, c, path)
+
+	checkpoints := c.Checkpoints()
+	if len(checkpoints) != 1 || checkpoints[0].Height != pinned.Height || !bytes.Equal(checkpoints[0].Hash, pinned.Hash) {
+		t.Fatalf("checkpoints after reopening = %+v, want block %x at height %d", checkpoints, pinned.Hash, pinned.Height)
+	}
+
+	if got := balance(t, c, c.Address()); got != 2*transaction.DefaultSubsidy {
+		t.Fatalf("balance of the wallet = %d, want %d", got, 2*transaction.DefaultSubsidy)
+	}
+}
@@ -0,0 +1,87 @@
+package blockchain
+
+import (
+	"sort"
+
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// OutPoint references an output of a transaction
+type OutPoint struct {
+	Txid []byte // the ID of the transaction
+	Vout int    // the index of the output in the transaction
+}
+
+// OutPointValue is an unspent output and the coins it holds
+type OutPointValue struct {
+	OutPoint     // the output
+	Value    int // the value of the output
+}
+
+// CoinSelector chooses which unspent outputs fund a transaction. Select returns the outputs to
+// spend and their total value, or ErrNotEnoughFunds if the outputs cannot cover amount.
+type CoinSelector interface {
+	Select(utxos []OutPointValue, amount int) ([]OutPoint, int, error)
+}
+
+// FirstFit selects outputs in the order they are given until the amount is covered
+type FirstFit struct{}
+
+// Select implements CoinSelector.
+func (FirstFit) Select(utxos []OutPointValue, amount int) ([]OutPoint, int, error) {
+	return accumulate(utxos, amount)
+}
+
+// LargestFirst selects the largest outputs first, spending as few outputs as possible
+type LargestFirst struct{}
+
+// Select implements CoinSelector.
+func (LargestFirst) Select(utxos []OutPointValue, amount int) ([]OutPoint, int, error) {
+	sorted := make([]OutPointValue, len(utxos))
+	copy(sorted, utxos)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Value > sorted[j].Value
+	})
+
+	return accumulate(sorted, amount)
+}
+
+// accumulate takes outputs in order until their total value covers amount.
+func accumulate(utxos []OutPointValue, amount int) ([]OutPoint, int, error) {
+	var selected []OutPoint
+	total := 0
+
+	for _, utxo := range utxos {
+		if total >= amount {
+			break
+		}
+
+		selected = append(selected, utxo.OutPoint)
+
+		var err error
+		total, err = transaction.AddValues(total, utxo.Value)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if total < amount {
+		return nil, 0, errors.ErrNotEnoughFunds
+	}
+
+	return selected, total, nil
+}
+
+// CoinSelectorByName returns the coin selector with the given name, "first-fit" or "largest-first".
+func CoinSelectorByName(name string) (CoinSelector, error) {
+	switch name {
+	case "first-fit":
+		return FirstFit{}, nil
+	case "largest-first":
+		return LargestFirst{}, nil
+	default:
+		return nil, errors.ErrUnknownCoinSelector
+	}
+}
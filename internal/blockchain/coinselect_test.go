@@ -0,0 +1,147 @@
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// outPoints returns unspent outputs of the given values, each in a transaction of its own
+func outPoints(values ...int) []OutPointValue {
+	utxos := make([]OutPointValue, len(values))
+	for i, value := range values {
+		utxos[i] = OutPointValue{OutPoint: OutPoint{Txid: []byte{byte(i)}, Vout: 0}, Value: value}
+	}
+
+	return utxos
+}
+
+// txids returns the first byte of the transaction ID of each output
+func txids(ops []OutPoint) []byte {
+	ids := make([]byte, len(ops))
+	for i, op := range ops {
+		ids[i] = op.Txid[0]
+	}
+
+	return ids
+}
+
+func TestCoinSelectorsPickDifferentInputs(t *testing.T) {
+	utxos := outPoints(2, 1, 3, 10, 4)
+
+	for _, test := range []struct {
+		selector CoinSelector
+		amount   int
+		want     []byte
+		total    int
+	}{
+		{FirstFit{}, 5, []byte{0, 1, 2}, 6},
+		{LargestFirst{}, 5, []byte{3}, 10},
+		{FirstFit{}, 12, []byte{0, 1, 2, 3}, 16},
+		{LargestFirst{}, 12, []byte{3, 4}, 14},
+		{FirstFit{}, 20, []byte{0, 1, 2, 3, 4}, 20},
+		{LargestFirst{}, 20, []byte{3, 4, 2, 0, 1}, 20},
+	} {
+		selected, total, err := test.selector.Select(utxos, test.amount)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(txids(selected), test.want) || total != test.total {
+			t.Fatalf("%T selected %v worth %d for %d, want %v worth %d", test.selector, txids(selected), total, test.amount, test.want, test.total)
+		}
+	}
+
+	// Largest first sorts a copy of the outputs it is given
+	for i, utxo := range utxos {
+		if utxo.Txid[0] != byte(i) {
+			t.Fatal("LargestFirst reordered the outputs it was given")
+		}
+	}
+
+	for _, selector := range []CoinSelector{FirstFit{}, LargestFirst{}} {
+		_, _, err := selector.Select(utxos, 21)
+		if !errors.Is(err, errors.ErrNotEnoughFunds) {
+			t.Fatalf("%T selecting more than the outputs hold = %v, want ErrNotEnoughFunds", selector, err)
+		}
+	}
+}
+
+func TestNewUTXOTransactionUsesSelector(t *testing.T) {
+	c := NewTestChain(t)
+
+	w, err := transaction.NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pubKeyHash, err := transaction.HashPubKey(w.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Small outputs and one that covers the payment alone
+	for _, amount := range []int{1, 1, 1, 1, 1, 1, 1, 1, 20} {
+		c.Fund(transaction.NewAddress(pubKeyHash, c.AddressNetwork()), amount)
+	}
+
+	utxos, err := c.UTXOSet().FindOutPoints(pubKeyHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, selector := range []CoinSelector{FirstFit{}, LargestFirst{}} {
+		want, _, err := selector.Select(utxos, 9)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tx, err := NewUTXOTransaction(w, newAddress(t), 9, 0, nil, selector, c.UTXOSet())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(tx.Vin) != len(want) {
+			t.Fatalf("%T spent %d inputs, want %d", selector, len(tx.Vin), len(want))
+		}
+
+		// The inputs are the outputs selected, in no particular order
+		selected := make(map[string]bool)
+		for _, outPoint := range want {
+			selected[fmt.Sprintf("%x:%d", outPoint.Txid, outPoint.Vout)] = true
+		}
+
+		for _, in := range tx.Vin {
+			if !selected[fmt.Sprintf("%x:%d", in.Txid, in.Vout)] {
+				t.Fatalf("%T spent %x:%d, which it did not select", selector, in.Txid, in.Vout)
+			}
+		}
+	}
+
+	// Largest first covers the payment with the single large output
+	tx, err := NewUTXOTransaction(w, newAddress(t), 9, 0, nil, LargestFirst{}, c.UTXOSet())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tx.Vin) != 1 {
+		t.Fatalf("LargestFirst spent %d inputs, want 1", len(tx.Vin))
+	}
+}
+
+func TestCoinSelectorByName(t *testing.T) {
+	for name, want := range map[string]CoinSelector{"first-fit": FirstFit{}, "largest-first": LargestFirst{}} {
+		selector, err := CoinSelectorByName(name)
+		if err != nil || selector != want {
+			t.Fatalf("CoinSelectorByName(%q) = %T, %v", name, selector, err)
+		}
+	}
+
+	_, err := CoinSelectorByName("random")
+	if !errors.Is(err, errors.ErrUnknownCoinSelector) {
+		t.Fatalf("CoinSelectorByName of an unknown selector = %v, want ErrUnknownCoinSelector", err)
+	}
+}
@@ -0,0 +1,229 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/gob"
+	"math"
+	"math/big"
+
+	"github.com/yanglinshu/glock/internal/block"
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/transaction"
+	"github.com/yanglinshu/glock/internal/util"
+	bolt "go.etcd.io/bbolt"
+)
+
+const configBucket = "config" // Name of the bucket holding the parameters of the chain
+const configKey = "c"         // Key of the parameters in the config bucket
+
+// defaultRetargetInterval is the number of blocks between difficulty adjustments of new chains
+const defaultRetargetInterval = 10
+
+// defaultTargetSpacing is the expected number of seconds between blocks of new chains
+const defaultTargetSpacing = 60
+
+// maxRetargetStep is the largest change of the difficulty in bits at a single adjustment
+const maxRetargetStep = 2
+
+// withDefaults returns the config with its zero fields set to their defaults.
+func (c Config) withDefaults() Config {
+	if c.TargetBits == 0 {
+		c.TargetBits = block.DefaultTargetBits
+	}
+
+	if c.RetargetInterval == 0 {
+		c.RetargetInterval = defaultRetargetInterval
+	}
+
+	if c.TargetSpacing == 0 {
+		c.TargetSpacing = defaultTargetSpacing
+	}
+
+	if c.MaxBlockTxCount == 0 {
+		c.MaxBlockTxCount = defaultMaxBlockTxCount
+	}
+
+	if c.MaxBlockBytes == 0 {
+		c.MaxBlockBytes = defaultMaxBlockBytes
+	}
+
+	if c.DustThreshold == 0 {
+		c.DustThreshold = transaction.DefaultDustThreshold
+	}
+
+	if c.MaxDataSize == 0 {
+		c.MaxDataSize = transaction.DefaultMaxDataSize
+	}
+
+	return c
+}
+
+// putConfig persists the parameters of the chain.
+func putConfig(tx *bolt.Tx, config Config) error {
+	b, err := tx.CreateBucketIfNotExists([]byte(configBucket))
+	if err != nil {
+		return err
+	}
+
+	encoded, err := util.GobEncode(config)
+	if err != nil {
+		return err
+	}
+
+	return b.Put([]byte(configKey), encoded)
+}
+
+// loadConfig reads the parameters of the chain. Chains created before they were persisted never
+// adjust their difficulty.
+func loadConfig(db *bolt.DB) (Config, error) {
+	var config Config
+
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(configBucket))
+		if b == nil {
+			return nil
+		}
+
+		return gob.NewDecoder(bytes.NewReader(b.Get([]byte(configKey)))).Decode(&config)
+	})
+	if err != nil {
+		return Config{}, err
+	}
+
+	return config, nil
+}
+
+// retargetWindow returns the number of seconds the window of blocks ending at parent was expected
+// to take and took, and false if the difficulty is not adjusted on top of parent. The window is
+// taken from the branch of parent, which need not be the main chain.
+func (bc *Blockchain) retargetWindow(parent *block.Block) (int64, int64, bool, error) {
+	interval := bc.config.RetargetInterval
+	height := parent.Height + 1
+
+	if interval <= 0 || height%interval != 0 {
+		return 0, 0, false, nil
+	}
+
+	// Find the first block of the window ending at parent
+	first := parent
+	for i := 1; i < interval; i++ {
+		var err error
+		first, err = bc.GetBlock(first.PrevBlockHash)
+		if err != nil {
+			return 0, 0, false, err
+		}
+	}
+
+	expected := int64(bc.config.TargetSpacing * (interval - 1))
+	elapsed := parent.Timestamp - first.Timestamp
+	if elapsed < 1 {
+		elapsed = 1
+	}
+
+	return expected, elapsed, true, nil
+}
+
+// NextBits returns the Bits required of a block of the given version mined on top of parent, as
+// returned by its HeaderBits: a compact target from CompactBitsVersion on, and a number of leading
+// zero bits before.
+func (bc *Blockchain) NextBits(parent *block.Block, version int) (int, error) {
+	if version < block.CompactBitsVersion {
+		return bc.NextTargetBits(parent)
+	}
+
+	target, err := bc.NextTarget(parent)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(block.TargetToCompact(target)), nil
+}
+
+// NextTarget returns the target of a block mined on top of parent. Every RetargetInterval blocks,
+// the target of parent is scaled by the time taken by the last window of blocks over the target
+// spacing, by at most a factor of 2^maxRetargetStep either way; otherwise it is unchanged.
+func (bc *Blockchain) NextTarget(parent *block.Block) (*big.Int, error) {
+	target := parent.Target()
+
+	expected, elapsed, due, err := bc.retargetWindow(parent)
+	if err != nil || !due {
+		return target, err
+	}
+
+	next := new(big.Int).Mul(target, big.NewInt(elapsed))
+	next.Quo(next, big.NewInt(expected))
+
+	lowest := new(big.Int).Rsh(target, maxRetargetStep)
+	highest := new(big.Int).Lsh(target, maxRetargetStep)
+	if next.Cmp(lowest) < 0 {
+		next = lowest
+	}
+	if next.Cmp(highest) > 0 {
+		next = highest
+	}
+	if next.Cmp(block.MaxTarget) > 0 {
+		next = new(big.Int).Set(block.MaxTarget)
+	}
+	if next.Sign() <= 0 {
+		next = big.NewInt(1)
+	}
+
+	return next, nil
+}
+
+// NextTargetBits returns the number of leading zero bits required of a block mined on top of
+// parent before CompactBitsVersion. Every RetargetInterval blocks, the time taken by the last window
+// of blocks is compared to the target spacing and the difficulty is moved by up to maxRetargetStep
+// bits; otherwise it is unchanged.
+func (bc *Blockchain) NextTargetBits(parent *block.Block) (int, error) {
+	bits := parent.TargetBits()
+
+	expected, elapsed, due, err := bc.retargetWindow(parent)
+	if err != nil || !due {
+		return bits, err
+	}
+
+	// Each bit doubles the expected work, so the step is the log of the speed ratio
+	step := int(math.Round(math.Log2(float64(expected) / float64(elapsed))))
+	if step > maxRetargetStep {
+		step = maxRetargetStep
+	}
+	if step < -maxRetargetStep {
+		step = -maxRetargetStep
+	}
+
+	bits += step
+	if bits < 1 {
+		bits = 1
+	}
+	if bits > 255 {
+		bits = 255
+	}
+
+	return bits, nil
+}
+
+// CheckDifficulty checks that a block carries a valid proof-of-work at the difficulty required by
+// the retarget schedule. Blocks whose parent is not known yet cannot be placed in the schedule and
+// are only checked against the difficulty they claim.
+func (bc *Blockchain) CheckDifficulty(bl *block.Block) error {
+	if !block.NewProofOfWork(bl).Validate() {
+		return errors.ErrInvalidDifficulty
+	}
+
+	parent, err := bc.GetBlock(bl.PrevBlockHash)
+	if err != nil {
+		return nil
+	}
+
+	bits, err := bc.NextBits(parent, bl.Version)
+	if err != nil {
+		return err
+	}
+
+	if bl.HeaderBits() != bits {
+		return errors.ErrInvalidDifficulty
+	}
+
+	return nil
+}
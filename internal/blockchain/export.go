@@ -0,0 +1,221 @@
+package blockchain
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+
+	"github.com/yanglinshu/glock/internal/block"
+	"github.com/yanglinshu/glock/internal/errors"
+)
+
+// blockFileMagic starts every exported block file
+const blockFileMagic = "GLKB"
+
+// blockFileVersion is the version of the block file format. Version 2 added the version of the
+// blocks to their binary encoding, version 3 the size limits of the blocks, version 4 the dust
+// threshold, version 5 the size limit of data outputs and version 6 the activation height of the
+// chain ID signatures.
+const blockFileVersion = byte(0x06)
+
+// maxBlockRecord bounds the size of a block in a block file
+const maxBlockRecord = 1 << 26
+
+// A block file holds the parameters of the chain followed by its main chain blocks in height order,
+// each prefixed with its 32-bit length, integers in big endian:
+//
+//	magic | version byte | TargetBits (int64) | RetargetInterval (int64) | TargetSpacing (int64)
+//	MaxBlockTxCount (int64) | MaxBlockBytes (int64) | DustThreshold (int64) | MaxDataSize (int64)
+//	ChainIDActivation (int64)
+//	per block: length (uint32) | the binary encoding of the block, see block.EncodeWire
+
+// ExportChain writes the main chain to w as a block file and returns the number of blocks written.
+func (bc *Blockchain) ExportChain(w io.Writer) (int, error) {
+	bw := bufio.NewWriter(w)
+
+	bw.WriteString(blockFileMagic)
+	bw.WriteByte(blockFileVersion)
+	maxTxCount, maxBytes := bc.blockLimits()
+	for _, v := range []int{bc.config.TargetBits, bc.config.RetargetInterval, bc.config.TargetSpacing, maxTxCount, maxBytes, bc.dustThreshold(), bc.maxDataSize(), bc.config.ChainIDActivation} {
+		binary.Write(bw, binary.BigEndian, int64(v))
+	}
+
+	fi, err := bc.ForwardIterator()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for {
+		bl, err := fi.Next()
+		if err != nil {
+			return 0, err
+		}
+
+		if bl == nil {
+			break
+		}
+
+		record, err := bl.EncodeWire()
+		if err != nil {
+			return 0, err
+		}
+
+		binary.Write(bw, binary.BigEndian, uint32(len(record)))
+		_, err = bw.Write(record)
+		if err != nil {
+			return 0, err
+		}
+
+		count++
+	}
+
+	return count, bw.Flush()
+}
+
+// ImportChain replays the blocks of a block file into the database of a node, creating it from the
+// genesis block of the file if needed, and returns the number of blocks added. Every block goes
+// through CheckBlock and is applied to the UTXO set as it is stored. Blocks already stored
+// are skipped, so an interrupted import is resumed by running it again. If the database holds
+// another chain, ErrWrongGenesis is returned, unless force is set: the database is then moved aside
+// to blockchain_<node>.db.old and replaced.
+func ImportChain(r io.Reader, nodeID string, force bool) (int, error) {
+	br := bufio.NewReader(r)
+
+	config, err := readBlockFileHeader(br)
+	if err != nil {
+		return 0, err
+	}
+
+	genesis, err := readBlockRecord(br)
+	if err != nil {
+		return 0, err
+	}
+
+	if genesis == nil || len(genesis.PrevBlockHash) != 0 || genesis.Height != 0 ||
+		!block.NewProofOfWork(genesis).Validate() || !bytes.Equal(genesis.MerkleRoot, genesis.HashTransactions()) {
+		return 0, errors.ErrInvalidBlockFile
+	}
+
+	bc, err := openImportTarget(nodeID, genesis, config, force)
+	if err != nil {
+		return 0, err
+	}
+	defer bc.CloseDB()
+
+	imported := 0
+	for {
+		bl, err := readBlockRecord(br)
+		if err != nil {
+			return imported, err
+		}
+
+		if bl == nil {
+			break
+		}
+
+		stored, err := bc.HasBlock(bl.Hash)
+		if err != nil {
+			return imported, err
+		}
+
+		if stored {
+			continue
+		}
+
+		err = bc.CheckBlock(bl)
+		if err != nil {
+			return imported, err
+		}
+
+		err = bc.ConnectBlock(bl)
+		if err != nil {
+			return imported, err
+		}
+
+		imported++
+	}
+
+	// Blocks of a branch that overtook the main chain are applied once all are stored
+	UTXOSet := UTXOSet{Blockchain: bc}
+	return imported, UTXOSet.Reconcile()
+}
+
+// openImportTarget opens the database blocks are imported into, see ImportChain
+func openImportTarget(nodeID string, genesis *block.Block, config Config, force bool) (*Blockchain, error) {
+	dbFile := dbPath(nodeID)
+	if !dbExists(dbFile) {
+		return createBlockchain(dbFile, genesis, genesisParams(genesis), config)
+	}
+
+	bc, err := NewBlockchain(nodeID)
+	if err != nil {
+		return nil, err
+	}
+
+	chainID, err := bc.ChainID()
+	if err != nil {
+		bc.CloseDB()
+		return nil, err
+	}
+
+	if bytes.Equal(chainID, genesis.Hash) {
+		return bc, nil
+	}
+
+	bc.CloseDB()
+	if !force {
+		return nil, errors.ErrWrongGenesis
+	}
+
+	err = os.Rename(dbFile, dbFile+".old")
+	if err != nil {
+		return nil, err
+	}
+
+	return createBlockchain(dbFile, genesis, genesisParams(genesis), config)
+}
+
+// readBlockFileHeader reads the header of a block file, returning the parameters of the chain
+func readBlockFileHeader(r io.Reader) (Config, error) {
+	header := make([]byte, len(blockFileMagic)+1)
+	_, err := io.ReadFull(r, header)
+	if err != nil || string(header[:len(blockFileMagic)]) != blockFileMagic || header[len(blockFileMagic)] != blockFileVersion {
+		return Config{}, errors.ErrInvalidBlockFile
+	}
+
+	var params [8]int64
+	err = binary.Read(r, binary.BigEndian, &params)
+	if err != nil {
+		return Config{}, errors.ErrInvalidBlockFile
+	}
+
+	config := Config{int(params[0]), int(params[1]), int(params[2]), int(params[3]), int(params[4]), int(params[5]), int(params[6]), int(params[7]), nil}
+	if config.TargetBits < 1 || config.TargetBits > 255 {
+		return Config{}, errors.ErrInvalidTargetBits
+	}
+
+	return config, nil
+}
+
+// readBlockRecord reads the next block of a block file, or nil at the end of the file
+func readBlockRecord(r io.Reader) (*block.Block, error) {
+	var length uint32
+	err := binary.Read(r, binary.BigEndian, &length)
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil || length > maxBlockRecord {
+		return nil, errors.ErrInvalidBlockFile
+	}
+
+	record := make([]byte, length)
+	_, err = io.ReadFull(r, record)
+	if err != nil {
+		return nil, errors.ErrInvalidBlockFile
+	}
+
+	return block.DecodeWireBlock(record)
+}
@@ -0,0 +1,102 @@
+package blockchain
+
+import (
+	"encoding/hex"
+
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// TransactionFee returns the fee paid by a transaction, the value of its inputs minus the value of
+// its outputs. Coinbase transactions pay no fee.
+func (bc *Blockchain) TransactionFee(tx *transaction.Transaction) (int, error) {
+	if tx.IsCoinbase() {
+		return 0, nil
+	}
+
+	prevTXs := make(map[string]transaction.Transaction)
+	for _, vin := range tx.Vin {
+		prevTX, err := bc.FindTransaction(vin.Txid)
+		if err != nil {
+			return 0, err
+		}
+
+		prevTXs[hex.EncodeToString(prevTX.ID)] = prevTX
+	}
+
+	return transactionFee(tx, prevTXs)
+}
+
+// transactionFee returns the value of the inputs of a transaction minus the value of its outputs.
+func transactionFee(tx *transaction.Transaction, prevTXs map[string]transaction.Transaction) (int, error) {
+	in, err := inputValue(tx, prevTXs)
+	if err != nil {
+		return 0, err
+	}
+
+	out, err := outputValue(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	return in - out, nil
+}
+
+// inputValue returns the total value of the outputs spent by a transaction. Inputs referring to
+// outputs that do not exist count for nothing.
+func inputValue(tx *transaction.Transaction, prevTXs map[string]transaction.Transaction) (int, error) {
+	value := 0
+
+	for _, vin := range tx.Vin {
+		prevTX, ok := prevTXs[hex.EncodeToString(vin.Txid)]
+		if ok && vin.Vout >= 0 && vin.Vout < len(prevTX.Vout) {
+			var err error
+			value, err = transaction.AddValues(value, prevTX.Vout[vin.Vout].Value)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return value, nil
+}
+
+// outputValue returns the total value of the outputs of a transaction.
+func outputValue(tx *transaction.Transaction) (int, error) {
+	value := 0
+
+	for _, out := range tx.Vout {
+		var err error
+		value, err = transaction.AddValues(value, out.Value)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return value, nil
+}
+
+// checkPaymentOutputs checks that the transaction pays at most one change output back to the keys
+// spending its inputs. The values of the outputs are checked by CheckOutputValues.
+func checkPaymentOutputs(tx *transaction.Transaction) bool {
+	spenders := make(map[string]bool)
+	for _, vin := range tx.Vin {
+		pubKeyHash, err := vin.LockingHash()
+		if err != nil {
+			return false
+		}
+		spenders[hex.EncodeToString(pubKeyHash)] = true
+	}
+
+	changes := 0
+	for _, out := range tx.Vout {
+		if out.IsData() {
+			continue
+		}
+
+		if spenders[hex.EncodeToString(out.PublicKeyHash)] {
+			changes++
+		}
+	}
+
+	return changes <= 1
+}
@@ -0,0 +1,135 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/yanglinshu/glock/internal/block"
+	"github.com/yanglinshu/glock/internal/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+const heightsBucket = "heights" // Name of the bucket mapping heights to main chain block hashes
+
+// heightKey encodes a height as a key of the height index. Big endian keeps the keys sorted.
+func heightKey(height int) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(height))
+
+	return key
+}
+
+// indexHeights points the height index at the main chain ending at tip. It walks back from the tip
+// only until the index agrees with the chain, and drops the entries above the tip.
+func indexHeights(tx *bolt.Tx, tip *block.Block) error {
+	b := tx.Bucket([]byte(heightsBucket))
+	blocks := tx.Bucket([]byte(blocksBucket))
+
+	// Drop the heights of a longer branch that is no longer the main chain
+	var stale [][]byte
+	c := b.Cursor()
+	for k, _ := c.Seek(heightKey(tip.Height + 1)); k != nil; k, _ = c.Next() {
+		stale = append(stale, k)
+	}
+
+	for _, k := range stale {
+		err := b.Delete(k)
+		if err != nil {
+			return err
+		}
+	}
+
+	bl := tip
+	for {
+		key := heightKey(bl.Height)
+		if bytes.Equal(b.Get(key), bl.Hash) {
+			return nil
+		}
+
+		err := b.Put(key, bl.Hash)
+		if err != nil {
+			return err
+		}
+
+		if len(bl.PrevBlockHash) == 0 {
+			return nil
+		}
+
+		bl, err = block.DeserializeBlock(blocks.Get(bl.PrevBlockHash))
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// ReindexHeights rebuilds the height index from the main chain. Databases created before the index
+// existed are reindexed when opened.
+func (bc *Blockchain) ReindexHeights() error {
+	return bc.db.Update(func(tx *bolt.Tx) error {
+		err := tx.DeleteBucket([]byte(heightsBucket))
+		if err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+
+		_, err = tx.CreateBucket([]byte(heightsBucket))
+		if err != nil {
+			return err
+		}
+
+		b := tx.Bucket([]byte(blocksBucket))
+		tip, err := block.DeserializeBlock(b.Get(b.Get([]byte("l"))))
+		if err != nil {
+			return err
+		}
+
+		return indexHeights(tx, tip)
+	})
+}
+
+// blockAtHeight reads the main chain block at the given height within a database transaction. It
+// returns ErrBlockNotFound if the height index holds no block at that height.
+func blockAtHeight(tx *bolt.Tx, height int) (*block.Block, error) {
+	hash := tx.Bucket([]byte(heightsBucket)).Get(heightKey(height))
+	if hash == nil {
+		return nil, errors.ErrBlockNotFound
+	}
+
+	return block.DeserializeBlock(tx.Bucket([]byte(blocksBucket)).Get(hash))
+}
+
+// GetBlockByHeight returns the main chain block at the given height.
+func (bc *Blockchain) GetBlockByHeight(height int) (*block.Block, error) {
+	var hash []byte
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		hash = tx.Bucket([]byte(heightsBucket)).Get(heightKey(height))
+		if hash == nil {
+			return errors.ErrBlockNotFound
+		}
+
+		// The value is only valid during the transaction
+		hash = append([]byte{}, hash...)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return bc.GetBlock(hash)
+}
+
+// hasHeightIndex checks whether the database holds the height index.
+func (bc *Blockchain) hasHeightIndex() (bool, error) {
+	found := false
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		found = tx.Bucket([]byte(heightsBucket)) != nil
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return found, nil
+}
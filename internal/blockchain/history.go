@@ -0,0 +1,137 @@
+package blockchain
+
+import (
+	"github.com/yanglinshu/glock/internal/block"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// The kinds of TxRecord
+const (
+	TxReceived = "received" // the transaction pays the address
+	TxSent     = "sent"     // the transaction spends coins of the address
+	TxMined    = "mined"    // the coinbase transaction pays the address
+)
+
+// TxRecord is a transaction of the main chain paying or spending coins of an address
+type TxRecord struct {
+	TxID           []byte   // the ID of the transaction
+	Kind           string   // one of TxReceived, TxSent and TxMined
+	Amount         int      // the value received, or the value spent net of the change, fee included
+	Counterparties []string // the addresses paid if sent, the addresses paying if received
+	Height         int      // the height of the block holding the transaction
+	Timestamp      int64    // the time that block was created
+}
+
+// FindTransactionsForAddress returns the transactions of the main chain paying or spending coins of
+// the public key hash, the latest first. The blocks a rescan recorded the key in the history store
+// for are not walked again.
+func (bc *Blockchain) FindTransactionsForAddress(pubKeyHash []byte) ([]TxRecord, error) {
+	var records []TxRecord
+
+	stored, storedHeight, err := bc.storedHistory(pubKeyHash)
+	if err != nil {
+		return nil, err
+	}
+
+	bci := bc.Iterator()
+	for {
+		bl, err := bci.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		if bl.Height <= storedHeight {
+			return append(records, stored...), nil
+		}
+
+		// Transactions of the same block are listed in reverse too, the spending ones first
+		for i := len(bl.Transactions) - 1; i >= 0; i-- {
+			record, ok, err := bc.classifyTransaction(bl, bl.Transactions[i], pubKeyHash)
+			if err != nil {
+				return nil, err
+			}
+
+			if ok {
+				records = append(records, record)
+			}
+		}
+
+		if len(bl.PrevBlockHash) == 0 {
+			break
+		}
+	}
+
+	return records, nil
+}
+
+// classifyTransaction describes a transaction from the point of view of the public key hash, or
+// returns false if the transaction neither pays nor spends its coins.
+func (bc *Blockchain) classifyTransaction(bl *block.Block, tx *transaction.Transaction, pubKeyHash []byte) (TxRecord, bool, error) {
+	record := TxRecord{TxID: tx.ID, Height: bl.Height, Timestamp: bl.Timestamp}
+
+	received := 0
+	var payees []string
+	for _, out := range tx.Vout {
+		if out.IsLockedWithKey(pubKeyHash) {
+			received += out.Value
+		} else if !out.IsData() && len(out.PublicKeyHash) != 0 {
+			payees = appendAddress(payees, transaction.PubKeyHashToAddress(out.PublicKeyHash, bc.AddressNetwork()))
+		}
+	}
+
+	if tx.IsCoinbase() {
+		record.Kind = TxMined
+		record.Amount = received
+		return record, received > 0, nil
+	}
+
+	spent := 0
+	var payers []string
+	for _, in := range tx.Vin {
+		uses, err := in.UsesKey(pubKeyHash)
+		if err != nil {
+			return TxRecord{}, false, err
+		}
+
+		if !uses {
+			payerHash, err := in.LockingHash()
+			if err != nil {
+				return TxRecord{}, false, err
+			}
+			payers = appendAddress(payers, transaction.PubKeyHashToAddress(payerHash, bc.AddressNetwork()))
+			continue
+		}
+
+		prevTx, err := bc.FindTransaction(in.Txid)
+		if err != nil {
+			return TxRecord{}, false, err
+		}
+		spent += prevTx.Vout[in.Vout].Value
+	}
+
+	switch {
+	case spent > 0:
+		record.Kind = TxSent
+		record.Amount = spent - received
+		record.Counterparties = payees
+	case received > 0:
+		record.Kind = TxReceived
+		record.Amount = received
+		record.Counterparties = payers
+	default:
+		return TxRecord{}, false, nil
+	}
+
+	return record, true, nil
+}
+
+// appendAddress appends an address to the list unless it is already there.
+func appendAddress(addresses []string, address string) []string {
+	for _, a := range addresses {
+		if a == address {
+			return addresses
+		}
+	}
+
+	return append(addresses, address)
+}
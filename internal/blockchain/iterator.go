@@ -1,44 +1,108 @@
-package blockchain
-
-import (
-	"github.com/boltdb/bolt"
-	"github.com/yanglinshu/glock/internal/block"
-)
-
-// BlockchainIterator is used to iterate over blockchain blocks
-type BlockchainIterator struct {
-	currentHash []byte   // Current hash of the block
-	db          *bolt.DB // Database
-}
-
-// Iterator returns a BlockchainIterator from the tip of the chain
-func (bc *Blockchain) Iterator() *BlockchainIterator {
-	bci := &BlockchainIterator{bc.tip, bc.db}
-	return bci
-}
-
-// Next returns the next block starting from the tip
-func (i *BlockchainIterator) Next() (*block.Block, error) {
-	var bl *block.Block
-
-	// Read the block from the database
-	err := i.db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(blocksBucket))
-		encodedBlock := b.Get(i.currentHash)
-
-		var err error = nil
-		bl, err = block.DeserializeBlock(encodedBlock)
-		if err != nil {
-			return err
-		}
-
-		return nil
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	i.currentHash = bl.PrevBlockHash
-
-	return bl, nil
-}
+package blockchain
+
+import (
+	"bytes"
+
+	"github.com/yanglinshu/glock/internal/block"
+	"github.com/yanglinshu/glock/internal/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// BlockchainIterator is used to iterate over blockchain blocks
+type BlockchainIterator struct {
+	currentHash []byte   // Current hash of the block
+	db          *bolt.DB // Database
+}
+
+// Iterator returns a BlockchainIterator from the tip of the chain
+func (bc *Blockchain) Iterator() *BlockchainIterator {
+	bci := &BlockchainIterator{bc.Tip(), bc.db}
+	return bci
+}
+
+// Next returns the next block starting from the tip
+func (i *BlockchainIterator) Next() (*block.Block, error) {
+	var bl *block.Block
+
+	// Read the block from the database
+	err := i.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(blocksBucket))
+		encodedBlock := b.Get(i.currentHash)
+
+		var err error = nil
+		bl, err = block.DeserializeBlock(encodedBlock)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	i.currentHash = bl.PrevBlockHash
+
+	return bl, nil
+}
+
+// ForwardIterator is used to iterate over the main chain from the genesis block up to the tip
+type ForwardIterator struct {
+	height   int      // Height of the next block
+	last     int      // Height of the tip when the iteration started
+	prevHash []byte   // Hash of the block returned last
+	db       *bolt.DB // Database
+}
+
+// ForwardIterator returns a ForwardIterator from the genesis block of the chain up to the current
+// tip. Blocks are looked up by height in the height index, so stale blocks are never visited and
+// only one block is held at a time. Next returns ErrChainChanged if a reorganization replaces the
+// blocks not visited yet.
+func (bc *Blockchain) ForwardIterator() (*ForwardIterator, error) {
+	tip, err := bc.GetBlock(bc.Tip())
+	if err != nil {
+		return nil, err
+	}
+
+	return &ForwardIterator{0, tip.Height, nil, bc.db}, nil
+}
+
+// Next returns the next block starting from the genesis block, or nil once the tip has been passed
+func (i *ForwardIterator) Next() (*block.Block, error) {
+	if i.height > i.last {
+		return nil, nil
+	}
+
+	var bl *block.Block
+
+	// Read the block at the next height from the database
+	err := i.db.View(func(tx *bolt.Tx) error {
+		hash := tx.Bucket([]byte(heightsBucket)).Get(heightKey(i.height))
+		if hash == nil {
+			return errors.ErrChainChanged
+		}
+
+		b := tx.Bucket([]byte(blocksBucket))
+		encodedBlock := b.Get(hash)
+
+		var err error = nil
+		bl, err = block.DeserializeBlock(encodedBlock)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(bl.PrevBlockHash, i.prevHash) {
+		return nil, errors.ErrChainChanged
+	}
+
+	i.height++
+	i.prevHash = bl.Hash
+
+	return bl, nil
+}
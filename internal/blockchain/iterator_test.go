@@ -0,0 +1,105 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/yanglinshu/glock/internal/errors"
+)
+
+func TestForwardIteratorOrder(t *testing.T) {
+	c := NewTestChain(t)
+	side := NewTestChain(t, WithWallet(c.Wallet))
+
+	// Stale blocks share the heights of the first blocks of the main chain
+	c.MineBlocks(4)
+	for _, bl := range side.MineBlocks(3) {
+		err := c.AddBlock(bl)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.MineBlocks(8)
+
+	// The backward iterator gives the main chain from the tip
+	var backward [][]byte
+	bci := c.Iterator()
+	for {
+		bl, err := bci.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		backward = append(backward, bl.Hash)
+		if len(bl.PrevBlockHash) == 0 {
+			break
+		}
+	}
+
+	fi, err := c.ForwardIterator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var prevHash []byte
+	for height := 0; ; height++ {
+		bl, err := fi.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if bl == nil {
+			if height != 13 {
+				t.Fatalf("the iteration ended after %d blocks, want 13", height)
+			}
+			break
+		}
+
+		if bl.Height != height || !bytes.Equal(bl.PrevBlockHash, prevHash) {
+			t.Fatalf("block %d is at height %d after %x, want height %d after %x", height, bl.Height, bl.PrevBlockHash, height, prevHash)
+		}
+
+		if !bytes.Equal(bl.Hash, backward[len(backward)-1-height]) {
+			t.Fatalf("block at height %d is %x, want the main chain block %x", height, bl.Hash, backward[len(backward)-1-height])
+		}
+
+		prevHash = bl.Hash
+	}
+
+	// The iterator stays done
+	bl, err := fi.Next()
+	if bl != nil || err != nil {
+		t.Fatalf("Next after the tip = %v, %v, want nil", bl, err)
+	}
+}
+
+func TestForwardIteratorChainChanged(t *testing.T) {
+	c := NewTestChain(t)
+	side := NewTestChain(t, WithWallet(c.Wallet))
+	c.MineBlocks(3)
+
+	fi, err := c.ForwardIterator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err = fi.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A longer branch replaces the blocks not visited yet
+	for _, bl := range side.MineBlocks(5) {
+		err = c.AddBlock(bl)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = fi.Next()
+	if !errors.Is(err, errors.ErrChainChanged) {
+		t.Fatalf("Next after a reorganization = %v, want ErrChainChanged", err)
+	}
+}
@@ -0,0 +1,145 @@
+package blockchain
+
+import (
+	"sort"
+
+	"github.com/yanglinshu/glock/internal/block"
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// defaultMaxBlockTxCount is the largest number of transactions in a block of new chains
+const defaultMaxBlockTxCount = 1000
+
+// defaultMaxBlockBytes is the largest size of the binary encoding of a block of new chains
+const defaultMaxBlockBytes = 1 << 20
+
+// dustThreshold returns the smallest value of an output locking coins. Chains created before the
+// threshold was persisted use the default.
+func (bc *Blockchain) dustThreshold() int {
+	if bc.config.DustThreshold <= 0 {
+		return transaction.DefaultDustThreshold
+	}
+
+	return bc.config.DustThreshold
+}
+
+// maxDataSize returns the largest payload of a data output. Chains created before the limit was
+// persisted use the default.
+func (bc *Blockchain) maxDataSize() int {
+	if bc.config.MaxDataSize <= 0 {
+		return transaction.DefaultMaxDataSize
+	}
+
+	return bc.config.MaxDataSize
+}
+
+// requiresChainID checks whether the transactions of the block at the given height must be signed
+// with transaction.ChainIDVersion
+func (bc *Blockchain) requiresChainID(height int) bool {
+	return height >= bc.config.ChainIDActivation
+}
+
+// blockLimits returns the largest number of transactions and the largest binary size of a block.
+// Chains created before the limits were persisted use the defaults.
+func (bc *Blockchain) blockLimits() (int, int) {
+	maxTxCount, maxBytes := bc.config.MaxBlockTxCount, bc.config.MaxBlockBytes
+	if maxTxCount <= 0 {
+		maxTxCount = defaultMaxBlockTxCount
+	}
+
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxBlockBytes
+	}
+
+	return maxTxCount, maxBytes
+}
+
+// checkBlockSize returns ErrBlockTooLarge if a block holds more transactions than the chain allows,
+// or if its binary encoding is too large.
+func (bc *Blockchain) checkBlockSize(bl *block.Block) error {
+	maxTxCount, maxBytes := bc.blockLimits()
+	if len(bl.Transactions) > maxTxCount {
+		return errors.Wrapf(errors.ErrBlockTooLarge, "block %d (%x) holds %d transactions", bl.Height, bl.Hash, len(bl.Transactions))
+	}
+
+	encoded, err := bl.EncodeWire()
+	if err != nil {
+		return err
+	}
+
+	if len(encoded) > maxBytes {
+		return errors.Wrapf(errors.ErrBlockTooLarge, "block %d (%x) is %d bytes", bl.Height, bl.Hash, len(encoded))
+	}
+
+	return nil
+}
+
+// selectForBlock returns the transactions to mine in a block. If they do not fit in the limits of
+// the chain, the coinbase is kept and the other transactions are taken by decreasing fee rate
+// until the block is full.
+func (bc *Blockchain) selectForBlock(txs []*transaction.Transaction) ([]*transaction.Transaction, error) {
+	maxTxCount, maxBytes := bc.blockLimits()
+
+	sizes := make(map[*transaction.Transaction]int)
+	total := block.WireOverhead
+	for _, tx := range txs {
+		size, err := block.WireTxSize(tx)
+		if err != nil {
+			return nil, err
+		}
+
+		sizes[tx] = size
+		total += size
+	}
+
+	if len(txs) <= maxTxCount && total <= maxBytes {
+		return txs, nil
+	}
+
+	var selected, candidates []*transaction.Transaction
+	total = block.WireOverhead
+	for _, tx := range txs {
+		if tx.IsCoinbase() {
+			selected = append(selected, tx)
+			total += sizes[tx]
+		} else {
+			candidates = append(candidates, tx)
+		}
+	}
+
+	feeRates := make(map[*transaction.Transaction]float64)
+	for _, tx := range candidates {
+		fee, err := bc.TransactionFee(tx)
+		if err != nil {
+			return nil, err
+		}
+
+		feeRates[tx] = float64(fee) / float64(sizes[tx])
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return feeRates[candidates[i]] > feeRates[candidates[j]]
+	})
+
+	for _, tx := range candidates {
+		if len(selected) >= maxTxCount {
+			break
+		}
+
+		if total+sizes[tx] > maxBytes {
+			continue // a smaller transaction may still fit
+		}
+
+		selected = append(selected, tx)
+		total += sizes[tx]
+	}
+
+	if total > maxBytes || len(selected) > maxTxCount {
+		return nil, errors.Wrapf(errors.ErrBlockTooLarge, "%d transactions cannot fit in a block", len(selected))
+	}
+
+	bc.logger.Info("Block is full, leaving transactions for the next one", "selected", len(selected), "left", len(txs)-len(selected))
+
+	return selected, nil
+}
@@ -0,0 +1,244 @@
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// payments returns n payments of the chain, each from a wallet paid a block reward of its own so
+// that they spend different outputs, the i-th paying a fee of i+1
+func payments(t *testing.T, c *TestChain, n int) []*transaction.Transaction {
+	t.Helper()
+
+	var txs []*transaction.Transaction
+	for i := 0; i < n; i++ {
+		w, err := transaction.NewWallet()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pubKeyHash, err := transaction.HashPubKey(w.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = c.GenerateBlocks(1, transaction.NewAddress(pubKeyHash, c.AddressNetwork()), nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tx, err := NewUTXOTransaction(w, newAddress(t), 4, i+1, nil, nil, c.UTXOSet())
+		if err != nil {
+			t.Fatal(err)
+		}
+		txs = append(txs, tx)
+	}
+
+	return txs
+}
+
+func TestCheckBlockRejectsTooManyTransactions(t *testing.T) {
+	c := NewTestChain(t, WithConfig(Config{RetargetInterval: -1, MaxBlockTxCount: 3}))
+	txs := payments(t, c, 3)
+	tip := c.Tip()
+
+	// The coinbase and three payments are one transaction too many
+	bl := mineOnTip(t, c, txs...)
+
+	err := c.CheckBlock(bl)
+	if !errors.Is(err, errors.ErrBlockTooLarge) {
+		t.Fatalf("CheckBlock of a block of 4 transactions = %v, want ErrBlockTooLarge", err)
+	}
+
+	if !strings.Contains(err.Error(), hex.EncodeToString(bl.Hash)) {
+		t.Fatalf("error %q does not name the block", err)
+	}
+
+	err = c.SubmitBlock(bl)
+	if !errors.Is(err, errors.ErrBlockTooLarge) {
+		t.Fatalf("SubmitBlock of a block of 4 transactions = %v, want ErrBlockTooLarge", err)
+	}
+
+	if !bytes.Equal(c.Tip(), tip) {
+		t.Fatal("an oversized block became the tip")
+	}
+
+	// One payment fewer fits
+	err = c.CheckBlock(mineOnTip(t, c, txs[:2]...))
+	if err != nil {
+		t.Fatalf("CheckBlock of a block of 3 transactions: %v", err)
+	}
+}
+
+func TestCheckBlockRejectsTooManyBytes(t *testing.T) {
+	c := NewTestChain(t)
+	txs := payments(t, c, 1)
+
+	// The limit lets a block of a coinbase alone through, but not one holding a payment
+	small := mineOnTip(t, c)
+	encoded, err := small.EncodeWire()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.config.MaxBlockBytes = len(encoded) + 1
+
+	err = c.CheckBlock(small)
+	if err != nil {
+		t.Fatalf("CheckBlock of a block of %d bytes: %v", len(encoded), err)
+	}
+
+	err = c.CheckBlock(mineOnTip(t, c, txs...))
+	if !errors.Is(err, errors.ErrBlockTooLarge) {
+		t.Fatalf("CheckBlock of a block over %d bytes = %v, want ErrBlockTooLarge", c.config.MaxBlockBytes, err)
+	}
+}
+
+func TestMineBlockKeepsHighestFeeRates(t *testing.T) {
+	c := NewTestChain(t, WithConfig(Config{RetargetInterval: -1, MaxBlockTxCount: 3}))
+	txs := payments(t, c, 4)
+
+	cbTx, err := transaction.NewCoinbaseTX(c.Address(), "", bestHeight(t, c)+1, c.ChainParams())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bl, err := c.MineBlock(context.Background(), append([]*transaction.Transaction{cbTx}, txs...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The payments are the same size, so the two paying the highest fees are kept
+	if len(bl.Transactions) != 3 || !bl.Transactions[0].IsCoinbase() {
+		t.Fatalf("block holds %d transactions, want the coinbase and 2 payments", len(bl.Transactions))
+	}
+
+	for _, tx := range bl.Transactions[1:] {
+		if !bytes.Equal(tx.ID, txs[2].ID) && !bytes.Equal(tx.ID, txs[3].ID) {
+			t.Fatalf("block holds payment %x, want the two paying the highest fees", tx.ID)
+		}
+	}
+}
+
+func TestPaymentDustBoundaries(t *testing.T) {
+	// The threshold leaves room for a payment and the change out of a reward of DefaultSubsidy
+	const threshold = 3
+	c := NewTestChain(t, WithConfig(Config{RetargetInterval: -1, DustThreshold: threshold}))
+	reward := balance(t, c, c.Address())
+	to := newAddress(t)
+
+	for amount, want := range map[int]error{
+		-1:            errors.ErrInvalidAmount,
+		0:             errors.ErrInvalidAmount,
+		threshold - 1: errors.ErrDustOutput,
+		threshold:     nil,
+	} {
+		_, err := NewUTXOTransaction(c.Wallet, to, amount, 0, nil, nil, c.UTXOSet())
+		if !errors.Is(err, want) {
+			t.Fatalf("payment of %d = %v, want %v", amount, err, want)
+		}
+	}
+
+	// Change below the threshold is left to the fee, change at the threshold is paid back
+	for change, outputs := range map[int]int{threshold - 1: 1, threshold: 2} {
+		tx, err := NewUTXOTransaction(c.Wallet, to, reward-1-change, 1, nil, nil, c.UTXOSet())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(tx.Vout) != outputs {
+			t.Fatalf("payment leaving %d of change has %d outputs, want %d", change, len(tx.Vout), outputs)
+		}
+
+		fee, err := c.TransactionFee(tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if wantFee := reward - tx.Vout[0].Value - (outputs-1)*change; fee != wantFee {
+			t.Fatalf("payment leaving %d of change pays a fee of %d, want %d", change, fee, wantFee)
+		}
+	}
+
+	// A dust output slipped into a transaction is refused before its signatures are checked
+	tx, err := NewUTXOTransaction(c.Wallet, to, threshold, 0, nil, nil, c.UTXOSet())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Vout[0].Value = threshold - 1
+
+	err = c.CheckTransaction(tx)
+	if !errors.Is(err, errors.ErrInvalidTransaction) || !strings.Contains(err.Error(), errors.ErrDustOutput.Error()) {
+		t.Fatalf("CheckTransaction of a dust output = %v, want ErrInvalidTransaction for the dust", err)
+	}
+
+	err = c.CheckBlock(mineOnTip(t, c, tx))
+	wantValidationError(t, err, "invalid output value")
+}
+
+func TestValueOverflowRejected(t *testing.T) {
+	c := NewTestChain(t)
+	to, other := newAddress(t), newAddress(t)
+
+	// Totals past math.MaxInt would wrap around below the value of the inputs
+	for _, recipients := range [][]Recipient{
+		{{to, math.MaxInt}, {other, 1}},
+		{{to, math.MaxInt/2 + 1}, {other, math.MaxInt/2 + 1}},
+	} {
+		_, err := NewUTXOTransactionMulti(c.Wallet, recipients, 0, nil, nil, c.UTXOSet())
+		if !errors.Is(err, errors.ErrValueOverflow) {
+			t.Fatalf("payment of %d and %d = %v, want ErrValueOverflow", recipients[0].Amount, recipients[1].Amount, err)
+		}
+	}
+
+	_, err := NewUTXOTransaction(c.Wallet, to, math.MaxInt, 1, nil, nil, c.UTXOSet())
+	if !errors.Is(err, errors.ErrValueOverflow) {
+		t.Fatalf("payment of math.MaxInt and a fee = %v, want ErrValueOverflow", err)
+	}
+
+	// A transaction whose outputs add up past math.MaxInt is invalid, whatever its inputs
+	tx, err := NewUTXOTransaction(c.Wallet, to, 4, 0, nil, nil, c.UTXOSet())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Vout = []transaction.TXOutput{
+		{Value: math.MaxInt, PublicKeyHash: to.PubKeyHash()},
+		{Value: math.MaxInt, PublicKeyHash: other.PubKeyHash()},
+	}
+
+	err = c.CheckTransaction(tx)
+	if !errors.Is(err, errors.ErrInvalidTransaction) || !strings.Contains(err.Error(), errors.ErrValueOverflow.Error()) {
+		t.Fatalf("CheckTransaction of outputs overflowing = %v, want ErrInvalidTransaction for the overflow", err)
+	}
+
+	// So is a coinbase minting more than math.MaxInt, or one coin more than the subsidy
+	for name, values := range map[string][]int{
+		"value overflow": {math.MaxInt, 1},
+		"mints more":     {transaction.DefaultSubsidy + 1},
+	} {
+		cbTx, err := transaction.NewCoinbaseTX(c.Address(), "", bestHeight(t, c)+1, c.ChainParams())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cbTx.Vout = nil
+		for _, value := range values {
+			cbTx.Vout = append(cbTx.Vout, transaction.TXOutput{Value: value, PublicKeyHash: to.PubKeyHash()})
+		}
+
+		cbTx.ID, err = cbTx.Hash()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = c.CheckBlock(mineWithCoinbase(t, c, cbTx))
+		wantValidationError(t, err, name)
+	}
+}
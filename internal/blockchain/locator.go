@@ -0,0 +1,161 @@
+package blockchain
+
+import (
+	"bytes"
+
+	"github.com/yanglinshu/glock/internal/block"
+	bolt "go.etcd.io/bbolt"
+)
+
+// locatorDenseLength is the number of blocks below the tip listed one by one in a block locator,
+// before the steps between listed blocks start doubling
+const locatorDenseLength = 10
+
+// BlockLocator returns the hashes of main chain blocks at exponentially increasing depths from the
+// tip, ending with the genesis block. A peer finds the last block it shares with the chain in it.
+func (bc *Blockchain) BlockLocator() ([][]byte, error) {
+	var locator [][]byte
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		heights := tx.Bucket([]byte(heightsBucket))
+		blocks := tx.Bucket([]byte(blocksBucket))
+
+		tip, err := block.DeserializeBlock(blocks.Get(blocks.Get([]byte("l"))))
+		if err != nil {
+			return err
+		}
+
+		step := 1
+		for height := tip.Height; height > 0; height -= step {
+			if hash := heights.Get(heightKey(height)); hash != nil {
+				locator = append(locator, append([]byte{}, hash...))
+			}
+
+			if len(locator) >= locatorDenseLength {
+				step *= 2
+			}
+		}
+
+		if genesis := heights.Get(heightKey(0)); genesis != nil {
+			locator = append(locator, append([]byte{}, genesis...))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return locator, nil
+}
+
+// HasBlock checks whether the block with the given hash is stored, on the main chain or not.
+func (bc *Blockchain) HasBlock(hash []byte) (bool, error) {
+	found := false
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		found = tx.Bucket([]byte(blocksBucket)).Get(hash) != nil
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return found, nil
+}
+
+// locatorFork returns the height of the first block of the locator on the main chain, or -1 if
+// none is.
+func locatorFork(tx *bolt.Tx, locator [][]byte) (int, error) {
+	heights := tx.Bucket([]byte(heightsBucket))
+	blocks := tx.Bucket([]byte(blocksBucket))
+
+	for _, hash := range locator {
+		data := blocks.Get(hash)
+		if data == nil {
+			continue
+		}
+
+		bl, err := block.DeserializeBlock(data)
+		if err != nil {
+			return 0, err
+		}
+
+		if bytes.Equal(heights.Get(heightKey(bl.Height)), hash) {
+			return bl.Height, nil
+		}
+	}
+
+	return -1, nil
+}
+
+// HeadersAfter returns the headers of at most max main chain blocks following the last block
+// shared with the locator, in chain order. The headers start from the genesis block if the locator
+// shares no block with the chain.
+func (bc *Blockchain) HeadersAfter(locator [][]byte, max int) ([]block.BlockHeader, error) {
+	var headers []block.BlockHeader
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		hashes, err := hashesAfter(tx, locator, max)
+		if err != nil {
+			return err
+		}
+
+		blocks := tx.Bucket([]byte(blocksBucket))
+		for _, hash := range hashes {
+			bl, err := block.DeserializeBlock(blocks.Get(hash))
+			if err != nil {
+				return err
+			}
+
+			headers = append(headers, bl.Header())
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return headers, nil
+}
+
+// HashesAfter returns the hashes of at most max main chain blocks following the last block shared
+// with the locator, in chain order, like HeadersAfter.
+func (bc *Blockchain) HashesAfter(locator [][]byte, max int) ([][]byte, error) {
+	var hashes [][]byte
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		var err error
+		hashes, err = hashesAfter(tx, locator, max)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return hashes, nil
+}
+
+// hashesAfter returns copies of the hashes of at most max main chain blocks following the last
+// block shared with the locator
+func hashesAfter(tx *bolt.Tx, locator [][]byte, max int) ([][]byte, error) {
+	heights := tx.Bucket([]byte(heightsBucket))
+
+	fork, err := locatorFork(tx, locator)
+	if err != nil {
+		return nil, err
+	}
+
+	var hashes [][]byte
+	for height := fork + 1; len(hashes) < max; height++ {
+		hash := heights.Get(heightKey(height))
+		if hash == nil {
+			break
+		}
+
+		hashes = append(hashes, append([]byte{}, hash...))
+	}
+
+	return hashes, nil
+}
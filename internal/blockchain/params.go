@@ -0,0 +1,137 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/gob"
+	"time"
+
+	"github.com/yanglinshu/glock/internal/block"
+	"github.com/yanglinshu/glock/internal/transaction"
+	"github.com/yanglinshu/glock/internal/util"
+	bolt "go.etcd.io/bbolt"
+)
+
+const genesisKey = "genesis" // Key of the genesis parameters in the meta bucket
+
+// GenesisConfig holds the parameters of the genesis block of a new blockchain, which are persisted
+// in its metadata
+type GenesisConfig struct {
+	Network      string // Name of the network the chain belongs to, any if empty
+	CoinbaseData string // Data in the coinbase transaction of the genesis block
+	Subsidy      int    // Reward for mining a block, the genesis block included, before any halving
+	TargetBits   int    // Number of leading zero bits required in the hash of the genesis block
+	Timestamp    int64  // Time of the genesis block
+
+	HalvingInterval int // Number of blocks between halvings of the subsidy, the default if 0 for a new chain, never if negative or for a chain created before halvings
+}
+
+// withDefaults returns the genesis parameters with their zero fields set to their defaults. The
+// timestamp defaults to the current time.
+func (g GenesisConfig) withDefaults() GenesisConfig {
+	if g.CoinbaseData == "" {
+		g.CoinbaseData = genesisCoinbaseData
+	}
+
+	if g.Subsidy == 0 {
+		g.Subsidy = transaction.DefaultSubsidy
+	}
+
+	if g.HalvingInterval == 0 {
+		g.HalvingInterval = transaction.DefaultHalvingInterval
+	}
+
+	if g.TargetBits == 0 {
+		g.TargetBits = block.DefaultTargetBits
+	}
+
+	if g.Timestamp == 0 {
+		g.Timestamp = time.Now().Unix()
+	}
+
+	return g
+}
+
+// genesisParams returns the parameters a genesis block was created with. The network and the
+// halving interval are not recorded in the block, so the chain is taken to never halve its subsidy.
+func genesisParams(genesis *block.Block) GenesisConfig {
+	params := GenesisConfig{TargetBits: genesis.TargetBits(), Timestamp: genesis.Timestamp}
+	for _, tx := range genesis.Transactions {
+		if tx.IsCoinbase() {
+			params.CoinbaseData = string(tx.Vin[0].PublicKey)
+			if genesis.Version >= block.CoinbaseHeightVersion {
+				params.CoinbaseData = string(tx.CoinbaseData())
+			}
+			params.Subsidy = tx.Vout[0].Value
+		}
+	}
+
+	return params
+}
+
+// putParams persists the genesis parameters of the chain in the meta bucket.
+func putParams(tx *bolt.Tx, params GenesisConfig) error {
+	b, err := tx.CreateBucketIfNotExists([]byte(metaBucket))
+	if err != nil {
+		return err
+	}
+
+	encoded, err := util.GobEncode(params)
+	if err != nil {
+		return err
+	}
+
+	return b.Put([]byte(genesisKey), encoded)
+}
+
+// loadParams reads the genesis parameters of the chain. Chains created before they were persisted
+// get the parameters of their genesis block.
+func (bc *Blockchain) loadParams() (GenesisConfig, error) {
+	var params GenesisConfig
+	found := false
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(metaBucket))
+		if b == nil || b.Get([]byte(genesisKey)) == nil {
+			return nil
+		}
+
+		found = true
+		return gob.NewDecoder(bytes.NewReader(b.Get([]byte(genesisKey)))).Decode(&params)
+	})
+	if err != nil || found {
+		return params, err
+	}
+
+	genesis, err := bc.GetBlockByHeight(0)
+	if err != nil {
+		return GenesisConfig{}, err
+	}
+
+	return genesisParams(genesis), nil
+}
+
+// Params returns the genesis parameters of the chain.
+func (bc *Blockchain) Params() GenesisConfig {
+	return bc.params
+}
+
+// ChainParams returns the parameters setting the reward for mining a block of the chain.
+func (bc *Blockchain) ChainParams() transaction.ChainParams {
+	return transaction.ChainParams{InitialSubsidy: bc.params.Subsidy, HalvingInterval: bc.params.HalvingInterval}
+}
+
+// AddressNetwork returns the network of the addresses of the chain, the default network for a
+// chain created before its network was recorded.
+func (bc *Blockchain) AddressNetwork() transaction.Network {
+	network, err := transaction.NetworkByName(bc.params.Network)
+	if err != nil {
+		return transaction.Mainnet
+	}
+
+	return network
+}
+
+// SubsidyAt returns the reward for mining the block at the given height.
+func (bc *Blockchain) SubsidyAt(height int) int {
+	return transaction.BlockSubsidy(height, bc.ChainParams())
+}
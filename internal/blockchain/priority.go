@@ -0,0 +1,66 @@
+package blockchain
+
+import (
+	"encoding/hex"
+
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// Priorities computes the coin-age priority of each transaction: the sum of its input values
+// weighted by their confirmations, divided by its serialized size. Transactions spending old,
+// large outputs come first when fees do not decide. The result is keyed by hex transaction ID.
+// The inputs are looked up in the transaction index.
+func (bc *Blockchain) Priorities(txs []*transaction.Transaction) (map[string]float64, error) {
+	type confirmedOutputs struct {
+		height  int
+		outputs []transaction.TXOutput
+	}
+
+	bestHeight, err := bc.GetBestHeight()
+	if err != nil {
+		return nil, err
+	}
+
+	// Look up every transaction the inputs refer to once, nil if it is not confirmed
+	found := make(map[string]*confirmedOutputs)
+	for _, tx := range txs {
+		for _, in := range tx.Vin {
+			txID := hex.EncodeToString(in.Txid)
+			if _, ok := found[txID]; ok {
+				continue
+			}
+
+			prevTx, bl, err := bc.findIndexedTransaction(in.Txid)
+			if err != nil {
+				return nil, err
+			}
+
+			found[txID] = nil
+			if prevTx != nil {
+				found[txID] = &confirmedOutputs{bl.Height, prevTx.Vout}
+			}
+		}
+	}
+
+	priorities := make(map[string]float64)
+	for _, tx := range txs {
+		sl, err := tx.Serialize()
+		if err != nil {
+			return nil, err
+		}
+
+		weighted := 0
+		for _, in := range tx.Vin {
+			prev := found[hex.EncodeToString(in.Txid)]
+			if prev == nil || in.Vout < 0 || in.Vout >= len(prev.outputs) {
+				continue // unconfirmed inputs do not age
+			}
+
+			weighted += prev.outputs[in.Vout].Value * (bestHeight - prev.height + 1)
+		}
+
+		priorities[hex.EncodeToString(tx.ID)] = float64(weighted) / float64(len(sl))
+	}
+
+	return priorities, nil
+}
@@ -0,0 +1,59 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+func TestPrioritiesWeighInputAge(t *testing.T) {
+	c := NewTestChain(t)
+	young, err := transaction.NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The rewards of the wallet are older than the last one, paid to the young wallet
+	c.MineBlocks(4)
+	pubKeyHash, err := transaction.HashPubKey(young.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.GenerateBlocks(1, transaction.NewAddress(pubKeyHash, c.AddressNetwork()), nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old, err := NewUTXOTransaction(c.Wallet, newAddress(t), 5, 0, nil, nil, c.UTXOSet())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recent, err := NewUTXOTransaction(young, newAddress(t), 5, 0, nil, nil, c.UTXOSet())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An input spending an output of the mempool has not aged
+	unconfirmed := &transaction.Transaction{
+		ID:   []byte{0x01},
+		Vin:  []transaction.TXInput{{Txid: recent.ID, Vout: 0}},
+		Vout: []transaction.TXOutput{{Value: 5, PublicKeyHash: pubKeyHash}},
+	}
+
+	priorities, err := c.Priorities([]*transaction.Transaction{old, recent, unconfirmed})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pOld, pRecent := priorities[hex.EncodeToString(old.ID)], priorities[hex.EncodeToString(recent.ID)]
+	if pOld <= pRecent || pRecent <= 0 {
+		t.Fatalf("priorities = %v for the old input and %v for the recent one, want the old one higher", pOld, pRecent)
+	}
+
+	if p := priorities[hex.EncodeToString(unconfirmed.ID)]; p != 0 {
+		t.Fatalf("priority of a transaction spending an unconfirmed output = %v, want 0", p)
+	}
+}
@@ -0,0 +1,251 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"runtime"
+	"sync"
+
+	"github.com/yanglinshu/glock/internal/transaction"
+	bolt "go.etcd.io/bbolt"
+)
+
+// reindexBatchSize is the number of chainstate entries written per database transaction
+const reindexBatchSize = 1000
+
+// partialUTXO holds the outputs created and spent by a contiguous range of blocks
+type partialUTXO struct {
+	created map[string][]transaction.TXOutput // outputs left unspent by the range, by transaction ID
+	spent   map[string]map[int]bool           // indices of the outputs of earlier ranges spent, by transaction ID
+}
+
+// ReindexParallel rebuilds the UTXO set like Reindex. The blocks too deep for their journal to be
+// kept are split into contiguous height ranges scanned by a pool of workers, which read their
+// blocks through the height index one at a time. The partial results are merged in height order
+// before the chainstate is written in batches. The last undoDepth+1 blocks are then connected one
+// by one as Reindex does, journaling the outputs they spend so they can be disconnected in a reorg.
+// A worker count below 1 uses one worker per CPU.
+func (u *UTXOSet) ReindexParallel(workers int) error {
+	bc := u.Blockchain
+	tip, err := bc.GetBlock(bc.Tip())
+	if err != nil {
+		return err
+	}
+
+	err = bc.db.Update(resetChainstate)
+	if err != nil {
+		return err
+	}
+
+	journaled := tip.Height - undoDepth
+	if journaled <= 0 {
+		return u.connectFrom(0, tip)
+	}
+
+	UTXO, err := bc.scanParallel(journaled, workers)
+	if err != nil {
+		return err
+	}
+
+	last, err := bc.GetBlockByHeight(journaled - 1)
+	if err != nil {
+		return err
+	}
+
+	err = u.writeChainstate(UTXO, last.Hash)
+	if err != nil {
+		return err
+	}
+
+	err = bc.indexTransactions(0, journaled)
+	if err != nil {
+		return err
+	}
+
+	return u.connectFrom(journaled, tip)
+}
+
+// scanParallel returns the outputs left unspent by the main chain blocks below height count,
+// scanned by the given number of workers, one per CPU if it is below 1.
+func (bc *Blockchain) scanParallel(count, workers int) (map[string]transaction.TXOutputs, error) {
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+
+	if workers > count {
+		workers = count
+	}
+	rangeSize := (count + workers - 1) / workers
+	partials := make([]partialUTXO, workers)
+	errs := make([]error, workers)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		from, to := w*rangeSize, (w+1)*rangeSize
+		if to > count {
+			to = count
+		}
+
+		wg.Add(1)
+		go func(w, from, to int) {
+			defer wg.Done()
+			partials[w], errs[w] = bc.scanRange(from, to)
+		}(w, from, to)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Merge the ranges in height order, the spends of a range applying to the earlier ones
+	created := make(map[string][]transaction.TXOutput)
+	for _, p := range partials {
+		for txID, indices := range p.spent {
+			outs := created[txID]
+			for idx := range indices {
+				if idx >= 0 && idx < len(outs) {
+					outs[idx] = transaction.TXOutput{}
+				}
+			}
+		}
+
+		for txID, outs := range p.created {
+			created[txID] = outs
+		}
+	}
+
+	UTXO := make(map[string]transaction.TXOutputs)
+	for txID, outs := range created {
+		var unspent transaction.TXOutputs
+		for _, out := range outs {
+			if out.IsData() {
+				out = transaction.TXOutput{}
+			}
+			unspent.Outputs = append(unspent.Outputs, out)
+		}
+
+		if !unspent.AllSpent() {
+			UTXO[txID] = unspent
+		}
+	}
+
+	return UTXO, nil
+}
+
+// scanRange collects the outputs created and spent by the main chain blocks from height from up to
+// to, excluded. Outputs spent within the range are dropped right away, so a worker holds about as
+// many outputs as the range leaves unspent.
+func (bc *Blockchain) scanRange(from, to int) (partialUTXO, error) {
+	p := partialUTXO{make(map[string][]transaction.TXOutput), make(map[string]map[int]bool)}
+
+	err := bc.db.View(func(dbTx *bolt.Tx) error {
+		for height := from; height < to; height++ {
+			bl, err := blockAtHeight(dbTx, height)
+			if err != nil {
+				return err
+			}
+
+			for _, tx := range bl.Transactions {
+				if !tx.IsCoinbase() {
+					p.spend(tx.Vin)
+				}
+
+				outs := make([]transaction.TXOutput, len(tx.Vout))
+				copy(outs, tx.Vout)
+				p.created[hex.EncodeToString(tx.ID)] = outs
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return partialUTXO{}, err
+	}
+
+	for txID, outs := range p.created {
+		if (transaction.TXOutputs{Outputs: outs}).AllSpent() {
+			delete(p.created, txID)
+		}
+	}
+
+	return p, nil
+}
+
+// spend records the outputs spent by inputs, dropping those created earlier in the range
+func (p partialUTXO) spend(inputs []transaction.TXInput) {
+	for _, in := range inputs {
+		inTxID := hex.EncodeToString(in.Txid)
+
+		if outs, ok := p.created[inTxID]; ok {
+			if in.Vout >= 0 && in.Vout < len(outs) {
+				outs[in.Vout] = transaction.TXOutput{}
+			}
+			continue
+		}
+
+		if p.spent[inTxID] == nil {
+			p.spent[inTxID] = make(map[int]bool)
+		}
+		p.spent[inTxID][in.Vout] = true
+	}
+}
+
+// writeChainstate writes the given UTXO set and its address index to the emptied chainstate in
+// batches, and records tip as the last applied block once every entry is written.
+func (u *UTXOSet) writeChainstate(UTXO map[string]transaction.TXOutputs, tip []byte) error {
+	db := u.Blockchain.db
+	bucketName := []byte(utxoBucket)
+
+	var txIDs []string
+	for txID := range UTXO {
+		txIDs = append(txIDs, txID)
+	}
+
+	for start := 0; start < len(txIDs); start += reindexBatchSize {
+		end := start + reindexBatchSize
+		if end > len(txIDs) {
+			end = len(txIDs)
+		}
+
+		err := db.Update(func(tx *bolt.Tx) error {
+			b := tx.Bucket(bucketName)
+			idx := tx.Bucket([]byte(addressBucket))
+
+			for _, txID := range txIDs[start:end] {
+				key, err := hex.DecodeString(txID)
+				if err != nil {
+					return err
+				}
+
+				sl, err := UTXO[txID].Serialize()
+				if err != nil {
+					return err
+				}
+
+				err = b.Put(key, sl)
+				if err != nil {
+					return err
+				}
+
+				for outIdx, out := range UTXO[txID].Outputs {
+					err = indexOutput(idx, key, outIdx, out)
+					if err != nil {
+						return err
+					}
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// The marker goes last, an interrupted rebuild is redone on the next start
+	return db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketName).Put([]byte(lastAppliedKey), tip)
+	})
+}
@@ -0,0 +1,339 @@
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/yanglinshu/glock/internal/block"
+	"github.com/yanglinshu/glock/internal/transaction"
+	"github.com/yanglinshu/glock/internal/util"
+	bolt "go.etcd.io/bbolt"
+)
+
+// newBusyChain creates a test chain of about n blocks, every tenth one holding a payment that
+// spends outputs of earlier blocks and returns change
+func newBusyChain(tb testing.TB, n int) *TestChain {
+	tb.Helper()
+
+	c := NewTestChain(tb)
+	for height := 1; height <= n; height += 10 {
+		pubKeyHash := make([]byte, 20)
+		copy(pubKeyHash, fmt.Sprintf("payee %d", height))
+
+		tx, err := NewUTXOTransaction(c.Wallet, transaction.NewAddress(pubKeyHash, c.AddressNetwork()), height%7+1, 1, nil, nil, c.UTXOSet())
+		if err != nil {
+			tb.Fatal(err)
+		}
+
+		c.MineBlocks(10, tx)
+	}
+
+	return c
+}
+
+// utxoStats returns the statistics of the UTXO set of the chain
+func utxoStats(t *testing.T, c *TestChain) UTXOStats {
+	t.Helper()
+
+	stats, err := c.UTXOSet().Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return stats
+}
+
+func TestReindexParallelMatchesSerial(t *testing.T) {
+	c := newBusyChain(t, 200)
+
+	// Data outputs are never spendable and are left out of the set
+	memo := &transaction.TXOutput{Data: []byte("a note")}
+	tx, err := NewUTXOTransaction(c.Wallet, newAddress(t), 3, 0, memo, nil, c.UTXOSet())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.MineBlocks(1, tx)
+
+	err = c.UTXOSet().Reindex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial := utxoStats(t, c)
+
+	for _, workers := range []int{0, 1, 2, 3, 7, 64, 1000} {
+		err = c.UTXOSet().ReindexParallel(workers)
+		if err != nil {
+			t.Fatalf("ReindexParallel(%d): %v", workers, err)
+		}
+
+		parallel := utxoStats(t, c)
+		if !bytes.Equal(parallel.Hash, serial.Hash) || parallel.Outputs != serial.Outputs || parallel.TotalValue != serial.TotalValue {
+			t.Fatalf("ReindexParallel(%d) = %+v, want the set of the serial rebuild %+v", workers, parallel, serial)
+		}
+
+		if !bytes.Equal(parallel.BestBlock, c.Tip()) {
+			t.Fatalf("ReindexParallel(%d) applied the set up to %x, want the tip %x", workers, parallel.BestBlock, c.Tip())
+		}
+
+		err = c.ValidateChain()
+		if err != nil {
+			t.Fatalf("ValidateChain after ReindexParallel(%d): %v", workers, err)
+		}
+	}
+}
+
+func TestReorgAfterReindexParallel(t *testing.T) {
+	c := newBusyChain(t, 150)
+	to := newAddress(t)
+	spend := c.Fund(to, 7)
+	tip := bestHeight(t, c)
+
+	// A branch forking below the tip, shared up to there
+	side := NewTestChain(t, WithWallet(c.Wallet))
+	for height := 1; height < tip; height++ {
+		bl, err := c.GetBlockByHeight(height)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = side.SubmitBlock(bl)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	branch, err := side.GenerateBlocks(2, newAddress(t), nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Mined transactions still recorded as unconfirmed, deep in the chain and at the tip
+	deep, err := c.GetBlockByHeight(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tx := range []*transaction.Transaction{deep.Transactions[1], spend} {
+		err := c.AddUnconfirmed(tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The journal the rebuild starts from is stale at the tip and missing below it
+	stale, err := util.GobEncode([]spentOutput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(undoBucket))
+		for height := tip - 1; height <= tip; height++ {
+			bl, err := blockAtHeight(tx, height)
+			if err != nil {
+				return err
+			}
+
+			err = b.Delete(undoKey(bl))
+			if err != nil {
+				return err
+			}
+
+			if height == tip {
+				err = b.Put(undoKey(bl), stale)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.UTXOSet().ReindexParallel(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The journal is rebuilt for the blocks a reorg may disconnect, and only for them
+	for height, want := range map[int]bool{tip: true, tip - 1: true, tip - undoDepth: true, tip - undoDepth - 1: false} {
+		bl, err := c.GetBlockByHeight(height)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := journaled(t, c, bl); got != want {
+			t.Fatalf("block %d journaled after ReindexParallel = %t, want %t", height, got, want)
+		}
+	}
+
+	err = c.db.View(func(tx *bolt.Tx) error {
+		if n := tx.Bucket([]byte(unconfirmedBucket)).Stats().KeyN; n != 0 {
+			t.Fatalf("%d mined transactions are still recorded as unconfirmed after ReindexParallel", n)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The branch overtakes the tip, whose payment is undone from its journal
+	connectBranch(t, c, branch)
+
+	if !bytes.Equal(c.Tip(), side.Tip()) {
+		t.Fatal("the longer branch did not take the tip")
+	}
+
+	in := spend.Vin[0]
+	if !isUnspent(t, c, in.Txid, in.Vout) || balance(t, c, to) != 0 {
+		t.Fatal("the payment of the disconnected block was not undone")
+	}
+
+	wantSameUTXOSet(t, c, side)
+	wantChainstateMatchesChain(t, c)
+}
+
+func BenchmarkReindex(b *testing.B) {
+	c := newBusyChain(b, 2000)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		err := c.UTXOSet().Reindex()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReindexParallel(b *testing.B) {
+	c := newBusyChain(b, 2000)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		err := c.UTXOSet().ReindexParallel(0)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchmarkSync connects the blocks of a chain of 1000 small blocks to a fresh chain sharing its
+// genesis block, as a node does during its initial block download, with connect
+func benchmarkSync(b *testing.B, connect func(c *TestChain, bl *block.Block) error) {
+	source := newBusyChain(b, 1000)
+
+	var blocks []*block.Block
+	for height := 1; height <= bestHeight(b, source); height++ {
+		bl, err := source.GetBlockByHeight(height)
+		if err != nil {
+			b.Fatal(err)
+		}
+		blocks = append(blocks, bl)
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		c := NewTestChain(b, WithWallet(source.Wallet))
+		b.StartTimer()
+
+		for _, bl := range blocks {
+			err := connect(c, bl)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+
+		b.StopTimer()
+		if !bytes.Equal(c.Tip(), source.Tip()) {
+			b.Fatal("the synced chain did not reach the tip of the source")
+		}
+		c.CloseDB()
+		b.StartTimer()
+	}
+}
+
+func BenchmarkSyncConnectBlock(b *testing.B) {
+	benchmarkSync(b, func(c *TestChain, bl *block.Block) error {
+		return c.ConnectBlock(bl)
+	})
+}
+
+func BenchmarkSyncReindexEachBlock(b *testing.B) {
+	benchmarkSync(b, func(c *TestChain, bl *block.Block) error {
+		err := c.AddBlock(bl)
+		if err != nil {
+			return err
+		}
+
+		return c.UTXOSet().Reindex()
+	})
+}
+
+func TestSyncKeepsChainstateWithoutReindex(t *testing.T) {
+	source := newBusyChain(t, 100)
+	c := NewTestChain(t, WithWallet(source.Wallet))
+
+	for height := 1; height <= bestHeight(t, source); height++ {
+		bl, err := source.GetBlockByHeight(height)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = c.SubmitBlock(bl)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The set was applied block by block, and matches both the source and the chain itself
+	synced, want := utxoStats(t, c), utxoStats(t, source)
+	if !bytes.Equal(synced.BestBlock, c.Tip()) || !bytes.Equal(synced.Hash, want.Hash) {
+		t.Fatalf("UTXO set after syncing = %+v, want %+v", synced, want)
+	}
+
+	wantChainstateMatchesChain(t, c)
+}
+
+func TestReindexLargeChainMatchesScan(t *testing.T) {
+	// More blocks and outputs than fit in one batch of the rebuild
+	c := newBusyChain(t, 4550)
+
+	transactions := 0
+	for height := 0; height <= bestHeight(t, c); height++ {
+		bl, err := c.GetBlockByHeight(height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		transactions += len(bl.Transactions)
+	}
+
+	if transactions < 5000 {
+		t.Fatalf("chain holds %d transactions, want at least 5000", transactions)
+	}
+
+	before := utxoStats(t, c)
+
+	err := c.UTXOSet().Reindex()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The batched rebuild gives the set found by scanning the whole chain at once
+	wantChainstateMatchesChain(t, c)
+
+	after := utxoStats(t, c)
+	if !bytes.Equal(after.Hash, before.Hash) || after.Outputs != before.Outputs || after.TotalValue != before.TotalValue {
+		t.Fatalf("UTXO set after the rebuild = %+v, want the set applied block by block %+v", after, before)
+	}
+
+	err = c.UTXOSet().ReindexParallel(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantChainstateMatchesChain(t, c)
+}
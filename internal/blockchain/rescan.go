@@ -0,0 +1,287 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+
+	"github.com/yanglinshu/glock/internal/block"
+	"github.com/yanglinshu/glock/internal/transaction"
+	"github.com/yanglinshu/glock/internal/util"
+	bolt "go.etcd.io/bbolt"
+)
+
+// historyBucket is the name of the bucket holding the history store: the transactions found by a
+// rescan for the keys of a wallet, in a bucket per public key hash keyed by height and position in
+// the block, and the state of the rescan under rescanStateKey.
+const historyBucket = "history"
+
+// rescanStateKey is the key of the state of the last rescan in the history bucket
+const rescanStateKey = "rescan"
+
+// rescanChunk is the number of blocks whose records are written in one database transaction, and
+// between two reports of the progress
+const rescanChunk = 100
+
+// rescanState is how far the last rescan got, which a rescan resumes from
+type rescanState struct {
+	Height     int      // the height of the last block scanned
+	Hash       []byte   // the hash of that block, which must still be on the main chain
+	PubKeyHash [][]byte // the public key hashes scanned for
+}
+
+// covers checks whether the rescan recorded the transactions of the public key hash.
+func (s *rescanState) covers(pubKeyHash []byte) bool {
+	for _, scanned := range s.PubKeyHash {
+		if bytes.Equal(scanned, pubKeyHash) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RescanProgressFunc receives the progress of a rescan: the height of the last block scanned and
+// the best height of the chain.
+type RescanProgressFunc func(height, bestHeight int)
+
+// historyKey returns the key of the record of the transaction at the given position in the block at
+// the given height, which orders the records as the chain does.
+func historyKey(height, position int) []byte {
+	key := make([]byte, 12)
+	binary.BigEndian.PutUint64(key, uint64(height))
+	binary.BigEndian.PutUint32(key[8:], uint32(position))
+
+	return key
+}
+
+// loadRescanState returns the state of the last rescan, or nil if there was none or the block it
+// stopped at has left the main chain.
+func (bc *Blockchain) loadRescanState() (*rescanState, error) {
+	var state *rescanState
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(historyBucket))
+		if b == nil {
+			return nil
+		}
+
+		encoded := b.Get([]byte(rescanStateKey))
+		if encoded == nil {
+			return nil
+		}
+
+		state = &rescanState{}
+		return gob.NewDecoder(bytes.NewReader(encoded)).Decode(state)
+	})
+	if err != nil || state == nil {
+		return nil, err
+	}
+
+	bl, err := bc.GetBlockByHeight(state.Height)
+	if err != nil || !bytes.Equal(bl.Hash, state.Hash) {
+		return nil, nil
+	}
+
+	return state, nil
+}
+
+// Rescan walks the main chain and records in the history store the transactions paying or spending
+// coins of the public key hashes, then returns the number of blocks scanned. It starts from the
+// given height if it is not negative, keeping the records below it. Otherwise it resumes where the
+// last rescan stopped if that covered every key and is still on the main chain, and starts from the
+// genesis block if not. The progress is written every rescanChunk blocks, so an interrupted rescan
+// loses at most a chunk, and reported to progress if it is not nil.
+func (bc *Blockchain) Rescan(pubKeyHashes [][]byte, from int, progress RescanProgressFunc) (int, error) {
+	bestHeight, err := bc.GetBestHeight()
+	if err != nil {
+		return 0, err
+	}
+
+	resume := false
+	if from < 0 {
+		from = 0
+
+		state, err := bc.loadRescanState()
+		if err != nil {
+			return 0, err
+		}
+
+		resume = state != nil
+		for _, pubKeyHash := range pubKeyHashes {
+			if resume && !state.covers(pubKeyHash) {
+				resume = false
+			}
+		}
+		if resume {
+			from = state.Height + 1
+		}
+	}
+
+	// Records from the start on are found again, and the ones of blocks since replaced go with them.
+	// Unless the rescan resumes, the state of the last one no longer holds until a chunk is written.
+	err = bc.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(historyBucket))
+		if err != nil {
+			return err
+		}
+
+		for _, pubKeyHash := range pubKeyHashes {
+			records, err := b.CreateBucketIfNotExists(pubKeyHash)
+			if err != nil {
+				return err
+			}
+
+			c := records.Cursor()
+			for k, _ := c.Seek(historyKey(from, 0)); k != nil; k, _ = c.Seek(historyKey(from, 0)) {
+				err := records.Delete(k)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if resume {
+			return nil
+		}
+		return b.Delete([]byte(rescanStateKey))
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	scanned := 0
+	for start := from; start <= bestHeight; start += rescanChunk {
+		end := start + rescanChunk - 1
+		if end > bestHeight {
+			end = bestHeight
+		}
+
+		var last *block.Block
+		found := make(map[string]map[string][]byte)
+		for height := start; height <= end; height++ {
+			bl, err := bc.GetBlockByHeight(height)
+			if err != nil {
+				return scanned, err
+			}
+			last = bl
+
+			for position, tx := range bl.Transactions {
+				for _, pubKeyHash := range pubKeyHashes {
+					record, ok, err := bc.classifyTransaction(bl, tx, pubKeyHash)
+					if err != nil {
+						return scanned, err
+					}
+
+					if !ok {
+						continue
+					}
+
+					encoded, err := util.GobEncode(record)
+					if err != nil {
+						return scanned, err
+					}
+
+					if found[string(pubKeyHash)] == nil {
+						found[string(pubKeyHash)] = make(map[string][]byte)
+					}
+					found[string(pubKeyHash)][string(historyKey(height, position))] = encoded
+				}
+			}
+		}
+
+		state, err := util.GobEncode(rescanState{end, last.Hash, pubKeyHashes})
+		if err != nil {
+			return scanned, err
+		}
+
+		// The chunk is classified before the database is written, as looking up the coins spent
+		// opens read transactions of its own
+		err = bc.db.Update(func(tx *bolt.Tx) error {
+			b := tx.Bucket([]byte(historyBucket))
+			for pubKeyHash, records := range found {
+				rb := b.Bucket([]byte(pubKeyHash))
+				for key, encoded := range records {
+					err := rb.Put([]byte(key), encoded)
+					if err != nil {
+						return err
+					}
+				}
+			}
+
+			return b.Put([]byte(rescanStateKey), state)
+		})
+		if err != nil {
+			return scanned, err
+		}
+
+		scanned += end - start + 1
+		if progress != nil {
+			progress(end, bestHeight)
+		}
+	}
+
+	return scanned, nil
+}
+
+// RescanWallets rescans the chain for the keys of the wallets as Rescan does, then rebuilds the
+// address index so the balances of keys imported since the UTXO set was built are found too.
+func (bc *Blockchain) RescanWallets(ws *transaction.Wallets, from int, progress RescanProgressFunc) (int, error) {
+	var pubKeyHashes [][]byte
+	for _, address := range ws.GetAddresses() {
+		pubKeyHash, err := transaction.HashPubKey(ws.Wallets[address].PublicKey)
+		if err != nil {
+			return 0, err
+		}
+
+		pubKeyHashes = append(pubKeyHashes, pubKeyHash)
+	}
+
+	scanned, err := bc.Rescan(pubKeyHashes, from, progress)
+	if err != nil {
+		return scanned, err
+	}
+
+	UTXOSet := UTXOSet{Blockchain: bc}
+	return scanned, UTXOSet.ReindexAddresses()
+}
+
+// storedHistory returns the records of the history store for the public key hash, the latest
+// first, and the height up to which they are complete. The height is -1 if the last rescan did not
+// cover the key or its blocks have left the main chain.
+func (bc *Blockchain) storedHistory(pubKeyHash []byte) ([]TxRecord, int, error) {
+	state, err := bc.loadRescanState()
+	if err != nil {
+		return nil, -1, err
+	}
+
+	if state == nil || !state.covers(pubKeyHash) {
+		return nil, -1, nil
+	}
+
+	var records []TxRecord
+	err = bc.db.View(func(tx *bolt.Tx) error {
+		rb := tx.Bucket([]byte(historyBucket)).Bucket(pubKeyHash)
+		if rb == nil {
+			return nil
+		}
+
+		c := rb.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var record TxRecord
+			err := gob.NewDecoder(bytes.NewReader(v)).Decode(&record)
+			if err != nil {
+				return err
+			}
+
+			records = append(records, record)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, -1, err
+	}
+
+	return records, state.Height, nil
+}
@@ -0,0 +1,196 @@
+package blockchain
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// importedKey creates a wallet as if its key was imported, and returns the wallets holding it alone
+// and its public key hash
+func importedKey(t *testing.T) (*transaction.Wallets, transaction.Address) {
+	t.Helper()
+
+	w, err := transaction.NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pubKeyHash, err := transaction.HashPubKey(w.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := transaction.NewAddress(pubKeyHash, transaction.Mainnet)
+
+	ws := &transaction.Wallets{Wallets: map[string]*transaction.Wallet{address.String(): w}, Network: transaction.Mainnet}
+	return ws, address
+}
+
+// rescanned rescans the chain for the wallets from the given height, and returns the number of
+// blocks scanned and the heights the progress was reported at
+func rescanned(t *testing.T, c *TestChain, ws *transaction.Wallets, from int) (int, []int) {
+	t.Helper()
+
+	var reported []int
+	scanned, err := c.RescanWallets(ws, from, func(height, best int) {
+		if want := bestHeight(t, c); best != want {
+			t.Fatalf("rescan reported a best height of %d, want %d", best, want)
+		}
+		reported = append(reported, height)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return scanned, reported
+}
+
+// wantStoredHistory checks that the history store holds the records of the public key hash at the
+// given heights, the latest first, complete up to the tip
+func wantStoredHistory(t *testing.T, c *TestChain, pubKeyHash []byte, heights ...int) []TxRecord {
+	t.Helper()
+
+	records, storedHeight, err := c.storedHistory(pubKeyHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tip := bestHeight(t, c); storedHeight != tip {
+		t.Fatalf("history store complete up to height %d, want the tip at %d", storedHeight, tip)
+	}
+
+	var got []int
+	for _, record := range records {
+		got = append(got, record.Height)
+	}
+
+	if !reflect.DeepEqual(got, heights) {
+		t.Fatalf("history store holds records at heights %v, want %v", got, heights)
+	}
+
+	return records
+}
+
+// walletBalance returns the balance of the address as the address index has it
+func walletBalance(t *testing.T, c *TestChain, address transaction.Address) int {
+	t.Helper()
+
+	balance, err := c.UTXOSet().GetBalance(address.PubKeyHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return balance
+}
+
+func TestRescanFindsImportedKey(t *testing.T) {
+	c := NewTestChain(t)
+	ws, address := importedKey(t)
+	pubKeyHash := address.PubKeyHash()
+
+	// The key is paid, then spends, in the middle of the chain
+	c.MineBlocks(3)
+	received := c.Fund(address, 7)
+	c.MineBlocks(3)
+
+	sent, err := NewUTXOTransaction(ws.Wallets[address.String()], newAddress(t), 2, 1, nil, nil, c.UTXOSet())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.MineBlocks(1, sent)
+	c.MineBlocks(2)
+
+	// The key was imported into a node whose address index was built without it
+	err = c.db.Update(resetAddressIndex)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := walletBalance(t, c, address); got != 0 {
+		t.Fatalf("balance of the imported key before the rescan = %d, want 0", got)
+	}
+
+	if _, storedHeight, err := c.storedHistory(pubKeyHash); err != nil || storedHeight != -1 {
+		t.Fatalf("history store complete up to height %d, %v before the rescan, want -1", storedHeight, err)
+	}
+
+	scanned, reported := rescanned(t, c, ws, -1)
+	if scanned != 11 || !reflect.DeepEqual(reported, []int{10}) {
+		t.Fatalf("rescan scanned %d blocks reporting heights %v, want 11 blocks reported at 10", scanned, reported)
+	}
+
+	if got := walletBalance(t, c, address); got != 4 {
+		t.Fatalf("balance of the imported key after the rescan = %d, want 4", got)
+	}
+
+	records := wantStoredHistory(t, c, pubKeyHash, 8, 4)
+	if records[0].Kind != TxSent || !bytes.Equal(records[0].TxID, sent.ID) || records[0].Amount != 3 {
+		t.Fatalf("record of the spending = %+v, want %x sending 3", records[0], sent.ID)
+	}
+
+	if records[1].Kind != TxReceived || !bytes.Equal(records[1].TxID, received.ID) || records[1].Amount != 7 {
+		t.Fatalf("record of the payment = %+v, want %x receiving 7", records[1], received.ID)
+	}
+
+	// The history read from the store is the one walking the chain finds
+	history, err := c.FindTransactionsForAddress(pubKeyHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(history, records) {
+		t.Fatalf("history of the imported key = %+v, want %+v", history, records)
+	}
+}
+
+func TestRescanResumes(t *testing.T) {
+	c, path := newFileChain(t)
+	ws, address := importedKey(t)
+
+	first := c.Fund(address, 5)
+	c.MineBlocks(rescanChunk + 10)
+	firstHeight := bestHeight(t, c) - rescanChunk - 10
+	tip := bestHeight(t, c)
+
+	// The progress is written and reported chunk by chunk
+	scanned, reported := rescanned(t, c, ws, -1)
+	if scanned != tip+1 || !reflect.DeepEqual(reported, []int{rescanChunk - 1, tip}) {
+		t.Fatalf("rescan scanned %d blocks reporting heights %v, want %d blocks reported at %d and %d", scanned, reported, tip+1, rescanChunk-1, tip)
+	}
+
+	// After a restart, the next rescan only scans the blocks since
+	reopen(t, c, path)
+	second := c.Fund(address, 3)
+	c.MineBlocks(1)
+	secondHeight := bestHeight(t, c) - 1
+
+	scanned, _ = rescanned(t, c, ws, -1)
+	if scanned != 2 {
+		t.Fatalf("resumed rescan scanned %d blocks, want the 2 mined since", scanned)
+	}
+
+	records := wantStoredHistory(t, c, address.PubKeyHash(), secondHeight, firstHeight)
+	if !bytes.Equal(records[0].TxID, second.ID) || !bytes.Equal(records[1].TxID, first.ID) {
+		t.Fatalf("history store holds %x and %x, want %x and %x", records[0].TxID, records[1].TxID, second.ID, first.ID)
+	}
+
+	// From a given height, the records below it are kept
+	tip = bestHeight(t, c)
+	scanned, _ = rescanned(t, c, ws, secondHeight)
+	if scanned != tip-secondHeight+1 {
+		t.Fatalf("rescan from height %d scanned %d blocks, want %d", secondHeight, scanned, tip-secondHeight+1)
+	}
+	wantStoredHistory(t, c, address.PubKeyHash(), secondHeight, firstHeight)
+
+	// A key the last rescan did not cover starts it over from the genesis block
+	other, otherAddress := importedKey(t)
+	ws.Wallets[otherAddress.String()] = other.Wallets[otherAddress.String()]
+
+	scanned, _ = rescanned(t, c, ws, -1)
+	if scanned != tip+1 {
+		t.Fatalf("rescan for a new key scanned %d blocks, want %d", scanned, tip+1)
+	}
+	wantStoredHistory(t, c, otherAddress.PubKeyHash())
+}
@@ -0,0 +1,180 @@
+package blockchain
+
+import (
+	"encoding/binary"
+
+	"github.com/yanglinshu/glock/internal/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+const metaBucket = "meta"         // Name of the bucket holding the metadata of the database
+const schemaVersionKey = "schema" // Key of the schema version in the meta bucket
+
+// SchemaVersion is the layout of the databases written by this version of the code. Databases
+// created before the version was recorded are at version 0.
+const SchemaVersion = 4
+
+// migration upgrades a database from the version before its own. Migrations must be idempotent,
+// since databases created before the schema was versioned may already hold part of the layout.
+type migration struct {
+	version     int                        // the version reached once the migration ran
+	description string                     // what the migration changes
+	apply       func(bc *Blockchain) error // upgrades the database
+}
+
+// migrations upgrade databases step by step, in version order
+var migrations = []migration{
+	{1, "build the height index", migrateHeightIndex},
+	{2, "build the address index", migrateAddressIndex},
+	{3, "build the transaction index", migrateTxIndex},
+	{4, "schedule the chain ID signatures", migrateChainIDActivation},
+}
+
+// readSchemaVersion returns the schema version of the database, 0 if none is recorded.
+func readSchemaVersion(db *bolt.DB) (int, error) {
+	version := 0
+
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(metaBucket))
+		if b == nil {
+			return nil
+		}
+
+		value := b.Get([]byte(schemaVersionKey))
+		if len(value) != 4 {
+			return nil
+		}
+
+		version = int(binary.BigEndian.Uint32(value))
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// putSchemaVersion records the schema version of the database.
+func putSchemaVersion(tx *bolt.Tx, version int) error {
+	b, err := tx.CreateBucketIfNotExists([]byte(metaBucket))
+	if err != nil {
+		return err
+	}
+
+	var value [4]byte
+	binary.BigEndian.PutUint32(value[:], uint32(version))
+
+	return b.Put([]byte(schemaVersionKey), value[:])
+}
+
+// checkSchemaVersion returns ErrUnsupportedSchema if the database was written by a newer version of
+// the code, before any of its content is decoded.
+func checkSchemaVersion(db *bolt.DB) error {
+	version, err := readSchemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	if version > SchemaVersion {
+		return errors.ErrUnsupportedSchema
+	}
+
+	return nil
+}
+
+// migrate upgrades the database to SchemaVersion, recording the version reached after every step
+// so an interrupted upgrade resumes where it stopped.
+func (bc *Blockchain) migrate() error {
+	version, err := readSchemaVersion(bc.db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+
+		bc.logger.Info("Migrating the database", "version", m.version, "migration", m.description)
+
+		err := m.apply(bc)
+		if err != nil {
+			return err
+		}
+
+		err = bc.db.Update(func(tx *bolt.Tx) error {
+			return putSchemaVersion(tx, m.version)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateHeightIndex builds the height index of databases created before it existed.
+func migrateHeightIndex(bc *Blockchain) error {
+	indexed, err := bc.hasHeightIndex()
+	if err != nil {
+		return err
+	}
+
+	if indexed {
+		return nil
+	}
+
+	return bc.ReindexHeights()
+}
+
+// migrateAddressIndex builds the address index of databases created before it existed.
+func migrateAddressIndex(bc *Blockchain) error {
+	UTXOSet := UTXOSet{Blockchain: bc}
+	indexed, err := UTXOSet.hasAddressIndex()
+	if err != nil {
+		return err
+	}
+
+	if indexed {
+		return nil
+	}
+
+	return UTXOSet.ReindexAddresses()
+}
+
+// migrateChainIDActivation schedules the chain ID signatures of databases created before they
+// existed right above the tip, as their blocks hold transactions signed without the chain ID.
+func migrateChainIDActivation(bc *Blockchain) error {
+	height, err := bc.GetBestHeight()
+	if err != nil {
+		return err
+	}
+
+	config := bc.config
+	config.ChainIDActivation = height + 1
+
+	err = bc.db.Update(func(tx *bolt.Tx) error {
+		return putConfig(tx, config)
+	})
+	if err != nil {
+		return err
+	}
+
+	bc.config = config
+	return nil
+}
+
+// migrateTxIndex builds the transaction index of databases created before it existed.
+func migrateTxIndex(bc *Blockchain) error {
+	indexed, err := bc.hasTxIndex()
+	if err != nil {
+		return err
+	}
+
+	if indexed {
+		return nil
+	}
+
+	return bc.ReindexTransactions()
+}
@@ -0,0 +1,26 @@
+//go:build linux
+
+package blockchain
+
+import (
+	"os"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/sys/unix"
+)
+
+// openMemoryDB opens a database held in an anonymous memory file named after the test, which is
+// freed once the database is closed.
+func openMemoryDB(tb testing.TB) (*bolt.DB, error) {
+	openFile := func(path string, flag int, mode os.FileMode) (*os.File, error) {
+		fd, err := unix.MemfdCreate(path, unix.MFD_CLOEXEC)
+		if err != nil {
+			return nil, err
+		}
+
+		return os.NewFile(uintptr(fd), path), nil
+	}
+
+	return bolt.Open(tb.Name(), 0600, &bolt.Options{Timeout: lockTimeout, OpenFile: openFile})
+}
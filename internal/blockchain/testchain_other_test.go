@@ -0,0 +1,16 @@
+//go:build !linux
+
+package blockchain
+
+import (
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// openMemoryDB opens a database in a temporary directory of the test, removed once the test ends
+// and the database is closed. Only Linux keeps it in memory.
+func openMemoryDB(tb testing.TB) (*bolt.DB, error) {
+	return bolt.Open(filepath.Join(tb.TempDir(), "chain.db"), 0600, &bolt.Options{Timeout: lockTimeout})
+}
@@ -0,0 +1,151 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/yanglinshu/glock/internal/block"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// testTargetBits is the difficulty of test chains, low enough for blocks to be mined at once
+const testTargetBits = 4
+
+// testGenesisTime is the time of the genesis block of test chains, fixed so that chains paying the
+// same wallet share their genesis block
+const testGenesisTime = 1700000000
+
+// TestChain is a blockchain kept in memory for tests, whose genesis block pays a throwaway wallet.
+// It fails the test on errors and is closed when the test ends.
+type TestChain struct {
+	*Blockchain
+
+	Wallet *transaction.Wallet // Wallet paid by the genesis block and the blocks mined by MineBlocks
+	t      testing.TB          // Test the chain belongs to
+}
+
+// testChainOptions are the parameters of a chain made by NewTestChain
+type testChainOptions struct {
+	params GenesisConfig       // Parameters of the genesis block
+	config Config              // Parameters of the chain
+	wallet *transaction.Wallet // Wallet paid by the genesis block, a new one if nil
+}
+
+// TestChainOption changes the parameters of a chain made by NewTestChain
+type TestChainOption func(opts *testChainOptions)
+
+// WithTargetBits sets the difficulty of the chain, in leading zero bits
+func WithTargetBits(bits int) TestChainOption {
+	return func(opts *testChainOptions) {
+		opts.params.TargetBits = bits
+	}
+}
+
+// WithHalvingInterval sets the number of blocks between halvings of the subsidy of the chain
+func WithHalvingInterval(interval int) TestChainOption {
+	return func(opts *testChainOptions) {
+		opts.params.HalvingInterval = interval
+	}
+}
+
+// WithConfig sets the parameters of the chain, its difficulty aside
+func WithConfig(config Config) TestChainOption {
+	return func(opts *testChainOptions) {
+		opts.config = config
+	}
+}
+
+// WithWallet makes the genesis block pay the given wallet. Chains made with the same wallet and
+// difficulty share their genesis block, so blocks mined on one can be added to the others.
+func WithWallet(wallet *transaction.Wallet) TestChainOption {
+	return func(opts *testChainOptions) {
+		opts.wallet = wallet
+	}
+}
+
+// NewTestChain creates a chain held in memory, at a low difficulty and without retargeting unless
+// opts say otherwise. Its genesis block pays a new wallet.
+func NewTestChain(t testing.TB, opts ...TestChainOption) *TestChain {
+	t.Helper()
+
+	o := testChainOptions{
+		params: GenesisConfig{TargetBits: testTargetBits, Timestamp: testGenesisTime},
+		config: Config{RetargetInterval: -1},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.wallet == nil {
+		var err error
+		o.wallet, err = transaction.NewWallet()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := &TestChain{Wallet: o.wallet, t: t}
+
+	genesis, params, config, err := newGenesis(c.Address(), o.params, o.config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := openMemoryDB(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Blockchain, err = initBlockchain(db, genesis, params, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.CloseDB)
+
+	return c
+}
+
+// Address returns the address of the wallet of the chain. Test chains belong to no network, so
+// their addresses are those of the default one.
+func (c *TestChain) Address() transaction.Address {
+	c.t.Helper()
+
+	pubKeyHash, err := transaction.HashPubKey(c.Wallet.PublicKey)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	return transaction.NewAddress(pubKeyHash, transaction.Mainnet)
+}
+
+// UTXOSet returns the UTXO set of the chain
+func (c *TestChain) UTXOSet() *UTXOSet {
+	return &UTXOSet{Blockchain: c.Blockchain}
+}
+
+// MineBlocks mines n blocks on top of the tip paying the wallet of the chain, the first one holding
+// the given transactions, and returns them.
+func (c *TestChain) MineBlocks(n int, txs ...*transaction.Transaction) []*block.Block {
+	c.t.Helper()
+
+	blocks, err := c.GenerateBlocks(n, c.Address(), txs, false)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	return blocks
+}
+
+// Fund pays amount from the wallet of the chain to an address in a new block, and returns the
+// payment.
+func (c *TestChain) Fund(to transaction.Address, amount int) *transaction.Transaction {
+	c.t.Helper()
+
+	tx, err := NewUTXOTransaction(c.Wallet, to, amount, 0, nil, nil, c.UTXOSet())
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	c.MineBlocks(1, tx)
+
+	return tx
+}
@@ -0,0 +1,98 @@
+package blockchain
+
+import (
+	"sort"
+	"time"
+
+	"github.com/yanglinshu/glock/internal/block"
+	"github.com/yanglinshu/glock/internal/errors"
+)
+
+// medianTimeSpan is the number of ancestors whose median timestamp a block must come after
+const medianTimeSpan = 11
+
+// DefaultMaxClockSkew is how far ahead of the local clock a block may be timestamped unless
+// configured otherwise
+const DefaultMaxClockSkew = 2 * time.Hour
+
+// SetMaxClockSkew sets how far ahead of the local clock a block may be timestamped, the default if
+// skew is 0.
+func (bc *Blockchain) SetMaxClockSkew(skew time.Duration) {
+	bc.maxClockSkew = skew
+}
+
+// clockSkew returns how far ahead of the local clock a block may be timestamped.
+func (bc *Blockchain) clockSkew() time.Duration {
+	if bc.maxClockSkew <= 0 {
+		return DefaultMaxClockSkew
+	}
+
+	return bc.maxClockSkew
+}
+
+// medianTime returns the median timestamp of the given blocks, in any order.
+func medianTime(blocks []*block.Block) int64 {
+	timestamps := make([]int64, len(blocks))
+	for i, bl := range blocks {
+		timestamps[i] = bl.Timestamp
+	}
+
+	sort.Slice(timestamps, func(i, j int) bool {
+		return timestamps[i] < timestamps[j]
+	})
+
+	return timestamps[len(timestamps)/2]
+}
+
+// medianTimePast returns the median timestamp of the last medianTimeSpan blocks of the branch
+// ending at parent, or of all of them on a shorter branch.
+func (bc *Blockchain) medianTimePast(parent *block.Block) (int64, error) {
+	ancestors := []*block.Block{parent}
+	for len(ancestors) < medianTimeSpan && len(ancestors[len(ancestors)-1].PrevBlockHash) > 0 {
+		bl, err := bc.GetBlock(ancestors[len(ancestors)-1].PrevBlockHash)
+		if err != nil {
+			return 0, err
+		}
+
+		ancestors = append(ancestors, bl)
+	}
+
+	return medianTime(ancestors), nil
+}
+
+// nextTimestamp returns the timestamp of a block mined on top of parent: the local time, unless
+// the clock is behind the median time of the branch.
+func (bc *Blockchain) nextTimestamp(parent *block.Block) (int64, error) {
+	median, err := bc.medianTimePast(parent)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now().Unix()
+	if now <= median {
+		return median + 1, nil
+	}
+
+	return now, nil
+}
+
+// checkTimestamp returns ErrInvalidTimestamp if a block is timestamped more than the allowed skew
+// ahead of the local clock, or, from block.TimestampRulesVersion on, not after the median time of
+// its ancestors. The version of a block may not go below the version of its parent, so the rule
+// cannot be dodged by claiming an older version.
+func (bc *Blockchain) checkTimestamp(bl *block.Block, parent *block.Block, median int64) error {
+	if bl.Version < parent.Version {
+		return errors.Wrapf(errors.ErrInvalidTimestamp, "block %d (%x) has version %d below its parent", bl.Height, bl.Hash, bl.Version)
+	}
+
+	latest := time.Now().Add(bc.clockSkew())
+	if bl.Timestamp > latest.Unix() {
+		return errors.Wrapf(errors.ErrInvalidTimestamp, "block %d (%x) is timestamped %s, more than %s ahead of the local clock", bl.Height, bl.Hash, time.Unix(bl.Timestamp, 0).UTC().Format(time.RFC3339), bc.clockSkew())
+	}
+
+	if bl.Version >= block.TimestampRulesVersion && bl.Timestamp <= median {
+		return errors.Wrapf(errors.ErrInvalidTimestamp, "block %d (%x) is timestamped %s, not after the median time %s of the last blocks", bl.Height, bl.Hash, time.Unix(bl.Timestamp, 0).UTC().Format(time.RFC3339), time.Unix(median, 0).UTC().Format(time.RFC3339))
+	}
+
+	return nil
+}
@@ -0,0 +1,140 @@
+package blockchain
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/yanglinshu/glock/internal/block"
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// mineAt mines a block on top of the tip holding a coinbase, timestamped at the given time and
+// left unchecked
+func mineAt(t *testing.T, c *TestChain, timestamp int64) *block.Block {
+	t.Helper()
+
+	parent, err := c.GetBlock(c.Tip())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bits, err := c.NextBits(parent, block.CurrentVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cbTx, err := transaction.NewCoinbaseTX(c.Address(), "", parent.Height+1, c.ChainParams())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bl := block.NewBlockTemplate([]*transaction.Transaction{cbTx}, parent.Hash, parent.Height+1, bits, timestamp)
+	err = bl.Mine(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bl
+}
+
+func TestMedianTime(t *testing.T) {
+	for _, tt := range []struct {
+		timestamps []int64
+		want       int64
+	}{
+		{[]int64{5}, 5},
+		{[]int64{3, 1, 2}, 2},
+		{[]int64{10, 40, 20, 30}, 30},
+		{[]int64{9, 1, 8, 2, 7, 3, 6, 4, 5, 0, 10}, 5},
+	} {
+		var blocks []*block.Block
+		for _, timestamp := range tt.timestamps {
+			blocks = append(blocks, &block.Block{Timestamp: timestamp})
+		}
+
+		if got := medianTime(blocks); got != tt.want {
+			t.Fatalf("medianTime(%v) = %d, want %d", tt.timestamps, got, tt.want)
+		}
+	}
+}
+
+func TestTimestampAfterMedianTime(t *testing.T) {
+	c := NewTestChain(t)
+
+	// The genesis block and 10 blocks 10 seconds apart: the median of the last 11 blocks is the
+	// timestamp of the sixth, well before the tip
+	for i := 1; i <= 10; i++ {
+		err := c.SubmitBlock(mineAt(t, c, testGenesisTime+int64(10*i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	median := int64(testGenesisTime + 50)
+
+	for _, timestamp := range []int64{testGenesisTime, median - 1, median} {
+		err := c.CheckBlock(mineAt(t, c, timestamp))
+		if !errors.Is(err, errors.ErrInvalidTimestamp) {
+			t.Fatalf("CheckBlock of a block at %d, median time %d = %v, want ErrInvalidTimestamp", timestamp, median, err)
+		}
+	}
+
+	// A block may still come before its parent, as long as it is after the median time
+	for _, timestamp := range []int64{median + 1, testGenesisTime + 99} {
+		err := c.CheckBlock(mineAt(t, c, timestamp))
+		if err != nil {
+			t.Fatalf("CheckBlock of a block at %d, median time %d: %v", timestamp, median, err)
+		}
+	}
+
+	err := c.SubmitBlock(mineAt(t, c, median))
+	if !errors.Is(err, errors.ErrInvalidTimestamp) {
+		t.Fatalf("SubmitBlock of a block at the median time = %v, want ErrInvalidTimestamp", err)
+	}
+
+	if height := bestHeight(t, c); height != 10 {
+		t.Fatalf("height = %d after a rejected block, want 10", height)
+	}
+}
+
+func TestTimestampWithinClockSkew(t *testing.T) {
+	c := NewTestChain(t)
+
+	for _, skew := range []time.Duration{0, 10 * time.Minute} {
+		c.SetMaxClockSkew(skew)
+		if skew == 0 {
+			skew = DefaultMaxClockSkew
+		}
+
+		latest := time.Now().Add(skew).Unix()
+
+		err := c.CheckBlock(mineAt(t, c, latest-60))
+		if err != nil {
+			t.Fatalf("CheckBlock of a block a minute within a skew of %s: %v", skew, err)
+		}
+
+		err = c.CheckBlock(mineAt(t, c, latest+60))
+		if !errors.Is(err, errors.ErrInvalidTimestamp) {
+			t.Fatalf("CheckBlock of a block a minute past a skew of %s = %v, want ErrInvalidTimestamp", skew, err)
+		}
+	}
+}
+
+func TestTimestampRulesCannotBeDodged(t *testing.T) {
+	c := NewTestChain(t)
+
+	parent, err := c.GetBlock(c.Tip())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A block claiming a version from before the rules, on top of a parent following them
+	bl := mineAt(t, c, parent.Timestamp)
+	bl.Version = block.TimestampRulesVersion - 1
+
+	err = c.checkTimestamp(bl, parent, parent.Timestamp)
+	if !errors.Is(err, errors.ErrInvalidTimestamp) {
+		t.Fatalf("checkTimestamp of a block of version %d on a parent of version %d = %v, want ErrInvalidTimestamp", bl.Version, parent.Version, err)
+	}
+}
@@ -0,0 +1,312 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"sort"
+
+	"github.com/yanglinshu/glock/internal/block"
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/transaction"
+	bolt "go.etcd.io/bbolt"
+)
+
+// txIndexBucket is the name of the bucket mapping the transactions of the main chain to the block
+// holding them. Keys are transaction IDs, values the block hash followed by the block height and the
+// position of the transaction in the block. It is kept in step with the UTXO set, so it is written
+// when blocks added by AddBlock or MineBlock are applied to the set.
+const txIndexBucket = "txindex"
+
+// txLocationSize is the size of an entry of the transaction index
+const txLocationSize = sha256.Size + 8
+
+// TxLocation is where a transaction of the main chain was included
+type TxLocation struct {
+	BlockHash     []byte // the hash of the block holding the transaction
+	Height        int    // the height of that block
+	Offset        int    // the position of the transaction in the block
+	Confirmations int    // the number of blocks from that block to the tip, itself included
+}
+
+// indexBlockTransactions adds the transactions of a block to the transaction index.
+func indexBlockTransactions(idx *bolt.Bucket, bl *block.Block) error {
+	for offset, tx := range bl.Transactions {
+		value := make([]byte, txLocationSize)
+		copy(value, bl.Hash)
+		binary.BigEndian.PutUint32(value[sha256.Size:], uint32(bl.Height))
+		binary.BigEndian.PutUint32(value[sha256.Size+4:], uint32(offset))
+
+		err := idx.Put(tx.ID, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unindexBlockTransactions removes the transactions of a disconnected block from the transaction
+// index.
+func unindexBlockTransactions(idx *bolt.Bucket, bl *block.Block) error {
+	for _, tx := range bl.Transactions {
+		err := idx.Delete(tx.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// decodeTxLocation decodes an entry of the transaction index, without its confirmations.
+func decodeTxLocation(value []byte) (TxLocation, error) {
+	if len(value) != txLocationSize {
+		return TxLocation{}, errors.ErrTransactionNotFound
+	}
+
+	return TxLocation{
+		BlockHash: append([]byte{}, value[:sha256.Size]...),
+		Height:    int(binary.BigEndian.Uint32(value[sha256.Size:])),
+		Offset:    int(binary.BigEndian.Uint32(value[sha256.Size+4:])),
+	}, nil
+}
+
+// findIndexedTransaction looks a transaction up in the transaction index. It returns a nil block if
+// the index does not hold the transaction, or holds it in a block that is no longer on the main
+// chain, as happens until the UTXO set catches up with the tip.
+func (bc *Blockchain) findIndexedTransaction(ID []byte) (*transaction.Transaction, *block.Block, error) {
+	var location TxLocation
+	var mainHash []byte
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		idx := tx.Bucket([]byte(txIndexBucket))
+		if idx == nil {
+			return errors.ErrTransactionNotFound
+		}
+
+		var err error
+		location, err = decodeTxLocation(idx.Get(ID))
+		if err != nil {
+			return err
+		}
+
+		mainHash = append([]byte{}, tx.Bucket([]byte(heightsBucket)).Get(heightKey(location.Height))...)
+		return nil
+	})
+	if errors.Is(err, errors.ErrTransactionNotFound) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !bytes.Equal(mainHash, location.BlockHash) {
+		return nil, nil, nil
+	}
+
+	bl, err := bc.GetBlock(location.BlockHash)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if location.Offset >= len(bl.Transactions) || !bytes.Equal(bl.Transactions[location.Offset].ID, ID) {
+		return nil, nil, nil
+	}
+
+	return bl.Transactions[location.Offset], bl, nil
+}
+
+// ReindexTransactions rebuilds the transaction index from the main chain. Databases created before
+// the index existed are reindexed when opened, and `glock reindex -tx` rebuilds it on demand. The
+// blocks are read by height in batches of about reindexBatchKeys transactions, like Reindex.
+func (bc *Blockchain) ReindexTransactions() error {
+	tip, err := bc.GetBlock(bc.Tip())
+	if err != nil {
+		return err
+	}
+
+	err = bc.db.Update(func(tx *bolt.Tx) error {
+		err := tx.DeleteBucket([]byte(txIndexBucket))
+		if err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+
+		_, err = tx.CreateBucket([]byte(txIndexBucket))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return bc.indexTransactions(0, tip.Height+1)
+}
+
+// indexTransactions indexes the transactions of the main chain blocks from height from up to to,
+// excluded, and forgets the unconfirmed transactions among them, as connecting the blocks does.
+func (bc *Blockchain) indexTransactions(from, to int) error {
+	height := from
+	for height < to {
+		err := bc.db.Update(func(tx *bolt.Tx) error {
+			idx := tx.Bucket([]byte(txIndexBucket))
+
+			keys := 0
+			for keys < reindexBatchKeys && height < to {
+				bl, err := blockAtHeight(tx, height)
+				if err != nil {
+					return err
+				}
+
+				err = indexBlockTransactions(idx, bl)
+				if err != nil {
+					return err
+				}
+
+				err = confirmBlockTransactions(tx, bl)
+				if err != nil {
+					return err
+				}
+
+				keys += len(bl.Transactions)
+				height++
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// hasTxIndex checks whether the database holds the transaction index.
+func (bc *Blockchain) hasTxIndex() (bool, error) {
+	found := false
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		found = tx.Bucket([]byte(txIndexBucket)) != nil
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return found, nil
+}
+
+// LocateTransaction returns the block holding a transaction of the main chain and its number of
+// confirmations. It returns ErrTransactionNotFound if the transaction is not on the main chain.
+func (bc *Blockchain) LocateTransaction(ID []byte) (TxLocation, error) {
+	var location TxLocation
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		var err error
+		location, err = decodeTxLocation(tx.Bucket([]byte(txIndexBucket)).Get(ID))
+		return err
+	})
+	if err != nil {
+		return TxLocation{}, err
+	}
+
+	bestHeight, err := bc.GetBestHeight()
+	if err != nil {
+		return TxLocation{}, err
+	}
+	location.Confirmations = bestHeight - location.Height + 1
+
+	return location, nil
+}
+
+// UnspentOutput is an unspent output with the number of confirmations of the transaction holding it
+type UnspentOutput struct {
+	OutPointValue
+	Confirmations int // the number of blocks from the one holding the output to the tip, itself included
+}
+
+// FindUTXOWithOutpoints returns the unspent outputs locked with the public key hash, with their
+// number of confirmations, in the order of the UTXO set.
+func (u *UTXOSet) FindUTXOWithOutpoints(pubKeyHash []byte) ([]UnspentOutput, error) {
+	utxos, err := u.FindOutPoints(pubKeyHash)
+	if err != nil {
+		return nil, err
+	}
+
+	bestHeight, err := u.Blockchain.GetBestHeight()
+	if err != nil {
+		return nil, err
+	}
+
+	var unspent []UnspentOutput
+	err = u.Blockchain.db.View(func(tx *bolt.Tx) error {
+		idx := tx.Bucket([]byte(txIndexBucket))
+
+		for _, utxo := range utxos {
+			location, err := decodeTxLocation(idx.Get(utxo.Txid))
+			if err != nil {
+				return err
+			}
+
+			unspent = append(unspent, UnspentOutput{utxo, bestHeight - location.Height + 1})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return unspent, nil
+}
+
+// GetBalances splits the balance of a public key hash into the value of the outputs with at least
+// minConf confirmations and the value of the younger ones.
+func (u *UTXOSet) GetBalances(pubKeyHash []byte, minConf int) (int, int, error) {
+	unspent, err := u.FindUTXOWithOutpoints(pubKeyHash)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	confirmed, pending := 0, 0
+	for _, utxo := range unspent {
+		if utxo.Confirmations >= minConf {
+			confirmed += utxo.Value
+		} else {
+			pending += utxo.Value
+		}
+	}
+
+	return confirmed, pending, nil
+}
+
+// AddressBalance is the balance of an address of the wallets of a node
+type AddressBalance struct {
+	Address   string // the address
+	Confirmed int    // the value of the outputs with enough confirmations
+	Pending   int    // the value of the younger outputs
+}
+
+// GetWalletBalances returns the balance of every address of the wallets, sorted by address, with
+// the outputs with at least minConf confirmations counted as confirmed.
+func (u *UTXOSet) GetWalletBalances(ws *transaction.Wallets, minConf int) ([]AddressBalance, error) {
+	addresses := ws.GetAddresses()
+	sort.Strings(addresses)
+
+	var balances []AddressBalance
+	for _, address := range addresses {
+		pubKeyHash, err := transaction.HashPubKey(ws.Wallets[address].PublicKey)
+		if err != nil {
+			return nil, err
+		}
+
+		confirmed, pending, err := u.GetBalances(pubKeyHash, minConf)
+		if err != nil {
+			return nil, err
+		}
+
+		balances = append(balances, AddressBalance{address, confirmed, pending})
+	}
+
+	return balances, nil
+}
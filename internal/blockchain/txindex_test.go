@@ -0,0 +1,123 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/yanglinshu/glock/internal/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// dropTxIndex removes the transaction index, as in databases created before it existed
+func dropTxIndex(tb testing.TB, c *TestChain) {
+	tb.Helper()
+
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket([]byte(txIndexBucket))
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+}
+
+// wantTransactionsFound checks that every transaction of the main chain is found in its block
+func wantTransactionsFound(t *testing.T, c *TestChain) {
+	t.Helper()
+
+	for height := 0; height <= bestHeight(t, c); height++ {
+		bl, err := c.GetBlockByHeight(height)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, want := range bl.Transactions {
+			tx, found, err := c.FindTransactionBlock(want.ID)
+			if err != nil {
+				t.Fatalf("FindTransactionBlock of %x at height %d: %v", want.ID, height, err)
+			}
+
+			if !bytes.Equal(tx.ID, want.ID) || !bytes.Equal(found.Hash, bl.Hash) {
+				t.Fatalf("transaction %x of block %d found in block %d", want.ID, height, found.Height)
+			}
+		}
+	}
+}
+
+func TestFindTransactionWithAndWithoutIndex(t *testing.T) {
+	c := newBusyChain(t, 60)
+	wantTransactionsFound(t, c)
+
+	genesis, err := c.GetBlockByHeight(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	location, err := c.LocateTransaction(genesis.Transactions[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(location.BlockHash, genesis.Hash) || location.Confirmations != bestHeight(t, c)+1 {
+		t.Fatalf("the genesis coinbase is located in %x with %d confirmations", location.BlockHash, location.Confirmations)
+	}
+
+	// Without the index the chain is scanned
+	dropTxIndex(t, c)
+	wantTransactionsFound(t, c)
+
+	_, err = c.FindTransaction(make([]byte, 32))
+	if !errors.Is(err, errors.ErrTransactionNotFound) {
+		t.Fatalf("FindTransaction of an unknown transaction = %v, want ErrTransactionNotFound", err)
+	}
+
+	// A rebuilt index holds the whole main chain
+	err = c.ReindexTransactions()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for height := 0; height <= bestHeight(t, c); height++ {
+		bl, err := c.GetBlockByHeight(height)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for offset, tx := range bl.Transactions {
+			location, err := c.LocateTransaction(tx.ID)
+			if err != nil || location.Height != height || location.Offset != offset {
+				t.Fatalf("transaction %d of block %d located at %+v, %v", offset, height, location, err)
+			}
+		}
+	}
+}
+
+// benchmarkFindTransaction looks up the genesis coinbase, the transaction furthest from the tip, on
+// a chain of 2,000 blocks
+func benchmarkFindTransaction(b *testing.B, indexed bool) {
+	c := newBusyChain(b, 2000)
+	if !indexed {
+		dropTxIndex(b, c)
+	}
+
+	genesis, err := c.GetBlockByHeight(0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	ID := genesis.Transactions[0].ID
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := c.FindTransaction(ID)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFindTransaction(b *testing.B) {
+	benchmarkFindTransaction(b, true)
+}
+
+func BenchmarkFindTransactionScan(b *testing.B) {
+	benchmarkFindTransaction(b, false)
+}
@@ -0,0 +1,95 @@
+package blockchain
+
+import (
+	"github.com/yanglinshu/glock/internal/block"
+	"github.com/yanglinshu/glock/internal/transaction"
+	bolt "go.etcd.io/bbolt"
+)
+
+// unconfirmedBucket is the name of the bucket holding the transactions created by the wallet of the
+// node until they are included in the main chain, so a node can announce them again after a
+// restart. Keys are transaction IDs, values the serialized transactions. It is created by the first
+// transaction recorded.
+const unconfirmedBucket = "unconfirmed"
+
+// AddUnconfirmed records a transaction created by the wallet of the node until it is confirmed.
+func (bc *Blockchain) AddUnconfirmed(tx *transaction.Transaction) error {
+	sl, err := tx.Serialize()
+	if err != nil {
+		return err
+	}
+
+	return bc.db.Update(func(dbTx *bolt.Tx) error {
+		b, err := dbTx.CreateBucketIfNotExists([]byte(unconfirmedBucket))
+		if err != nil {
+			return err
+		}
+
+		return b.Put(tx.ID, sl)
+	})
+}
+
+// RemoveUnconfirmed forgets a transaction recorded by AddUnconfirmed, such as one that can no
+// longer be mined.
+func (bc *Blockchain) RemoveUnconfirmed(ID []byte) error {
+	return bc.db.Update(func(dbTx *bolt.Tx) error {
+		b := dbTx.Bucket([]byte(unconfirmedBucket))
+		if b == nil {
+			return nil
+		}
+
+		return b.Delete(ID)
+	})
+}
+
+// UnconfirmedTransactions returns the transactions recorded by AddUnconfirmed that are not
+// included in the main chain yet. Transactions found in the transaction index are skipped, as one
+// may be recorded after the block including it was connected.
+func (bc *Blockchain) UnconfirmedTransactions() ([]*transaction.Transaction, error) {
+	var txs []*transaction.Transaction
+
+	err := bc.db.View(func(dbTx *bolt.Tx) error {
+		b := dbTx.Bucket([]byte(unconfirmedBucket))
+		if b == nil {
+			return nil
+		}
+
+		idx := dbTx.Bucket([]byte(txIndexBucket))
+		return b.ForEach(func(k, v []byte) error {
+			if idx != nil && idx.Get(k) != nil {
+				return nil
+			}
+
+			tx, err := transaction.DeserializeTransaction(v)
+			if err != nil {
+				return err
+			}
+
+			txs = append(txs, &tx)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return txs, nil
+}
+
+// confirmBlockTransactions forgets the unconfirmed transactions included in a block connected to
+// the main chain.
+func confirmBlockTransactions(dbTx *bolt.Tx, bl *block.Block) error {
+	b := dbTx.Bucket([]byte(unconfirmedBucket))
+	if b == nil {
+		return nil
+	}
+
+	for _, tx := range bl.Transactions {
+		err := b.Delete(tx.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,172 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/gob"
+
+	"github.com/yanglinshu/glock/internal/block"
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/transaction"
+	"github.com/yanglinshu/glock/internal/util"
+	bolt "go.etcd.io/bbolt"
+)
+
+// undoBucket is the name of the bucket journaling the outputs spent by every connected block, keyed
+// by the height and the hash of the block so the oldest entries come first
+const undoBucket = "undo"
+
+// undoDepth is the number of confirmations after which the journal of a block is pruned. Deeper
+// blocks are disconnected by looking up the spent outputs in the chain instead.
+const undoDepth = 100
+
+// spentOutput is an output spent by a block, as it was in the UTXO set
+type spentOutput struct {
+	Txid    []byte               // the ID of the transaction holding the output
+	Vout    int                  // the index of the output
+	Output  transaction.TXOutput // the output
+	Outputs int                  // the number of outputs of the entry of the transaction in the set
+}
+
+// undoKey returns the key of the journal of a block.
+func undoKey(bl *block.Block) []byte {
+	return append(heightKey(bl.Height), bl.Hash...)
+}
+
+// putUndo journals the outputs spent by a block and prunes the journals of the blocks more than
+// undoDepth below it.
+func putUndo(tx *bolt.Tx, bl *block.Block, spent []spentOutput) error {
+	b, err := tx.CreateBucketIfNotExists([]byte(undoBucket))
+	if err != nil {
+		return err
+	}
+
+	sl, err := util.GobEncode(spent)
+	if err != nil {
+		return err
+	}
+
+	err = b.Put(undoKey(bl), sl)
+	if err != nil {
+		return err
+	}
+
+	if bl.Height <= undoDepth {
+		return nil
+	}
+
+	cutoff := heightKey(bl.Height - undoDepth)
+	c := b.Cursor()
+	for k, _ := c.First(); k != nil && bytes.Compare(k[:len(cutoff)], cutoff) < 0; k, _ = c.First() {
+		err := c.Delete()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getUndo returns the outputs spent by a block, or ErrUndoNotFound if they were not journaled.
+func getUndo(tx *bolt.Tx, bl *block.Block) ([]spentOutput, error) {
+	b := tx.Bucket([]byte(undoBucket))
+	if b == nil {
+		return nil, errors.ErrUndoNotFound
+	}
+
+	value := b.Get(undoKey(bl))
+	if value == nil {
+		return nil, errors.ErrUndoNotFound
+	}
+
+	var spent []spentOutput
+	dec := gob.NewDecoder(bytes.NewReader(value))
+	err := dec.Decode(&spent)
+	if err != nil {
+		return nil, err
+	}
+
+	return spent, nil
+}
+
+// Disconnect undoes the effect of the last applied block on the UTXO set with its journal: the
+// outputs it created are removed and the outputs it spent are restored. It returns ErrUndoNotFound
+// if the block was not journaled or its journal was pruned.
+func (u *UTXOSet) Disconnect(bl *block.Block) error {
+	return u.Blockchain.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+		idx := tx.Bucket([]byte(addressBucket))
+
+		if !bytes.Equal(b.Get([]byte(lastAppliedKey)), bl.Hash) {
+			return errors.Wrapf(errors.ErrNotLastApplied, "block %d (%x)", bl.Height, bl.Hash)
+		}
+
+		spent, err := getUndo(tx, bl)
+		if err != nil {
+			return err
+		}
+
+		created := make(map[string]bool)
+		for _, blockTx := range bl.Transactions {
+			created[string(blockTx.ID)] = true
+
+			err := b.Delete(blockTx.ID)
+			if err != nil {
+				return err
+			}
+
+			for outIdx, out := range blockTx.Vout {
+				err = unindexOutput(idx, blockTx.ID, outIdx, out)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		// Outputs created and spent within the block go away with their transaction
+		for _, s := range spent {
+			if created[string(s.Txid)] {
+				continue
+			}
+
+			outs := transaction.TXOutputs{Outputs: make([]transaction.TXOutput, s.Outputs)}
+			if outsBytes := b.Get(s.Txid); outsBytes != nil {
+				outs, err = transaction.DeserializeOutputs(outsBytes)
+				if err != nil {
+					return err
+				}
+			}
+
+			if s.Vout >= len(outs.Outputs) {
+				return errors.ErrUndoNotFound
+			}
+			outs.Outputs[s.Vout] = s.Output
+
+			err = indexOutput(idx, s.Txid, s.Vout, s.Output)
+			if err != nil {
+				return err
+			}
+
+			sl, err := outs.Serialize()
+			if err != nil {
+				return err
+			}
+
+			err = b.Put(s.Txid, sl)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = unindexBlockTransactions(tx.Bucket([]byte(txIndexBucket)), bl)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Bucket([]byte(undoBucket)).Delete(undoKey(bl))
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(lastAppliedKey), bl.PrevBlockHash)
+	})
+}
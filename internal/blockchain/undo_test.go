@@ -0,0 +1,141 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/yanglinshu/glock/internal/block"
+	"github.com/yanglinshu/glock/internal/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// journaled checks whether the undo journal holds the outputs spent by a block
+func journaled(t *testing.T, c *TestChain, bl *block.Block) bool {
+	t.Helper()
+
+	err := c.db.View(func(tx *bolt.Tx) error {
+		_, err := getUndo(tx, bl)
+		return err
+	})
+	if errors.Is(err, errors.ErrUndoNotFound) {
+		return false
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return true
+}
+
+func TestDisconnectRoundTrip(t *testing.T) {
+	c := NewTestChain(t)
+	to := newAddress(t)
+
+	c.MineBlocks(1)
+	before := utxoStats(t, c)
+
+	spend := c.Fund(to, 7)
+	bl, err := c.GetBlock(c.Tip())
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := utxoStats(t, c)
+
+	// Disconnecting the block restores the output its payment spent and removes the outputs it
+	// created, leaving the set as it was before the block
+	err = c.UTXOSet().Disconnect(bl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats := utxoStats(t, c); !bytes.Equal(stats.Hash, before.Hash) || !bytes.Equal(stats.BestBlock, bl.PrevBlockHash) {
+		t.Fatalf("UTXO set at %x with hash %x after Disconnect, want the set at %x with hash %x", stats.BestBlock, stats.Hash, bl.PrevBlockHash, before.Hash)
+	}
+
+	in := spend.Vin[0]
+	if !isUnspent(t, c, in.Txid, in.Vout) {
+		t.Fatal("the output spent by the disconnected block is still spent")
+	}
+
+	for _, tx := range bl.Transactions {
+		if isUnspent(t, c, tx.ID, 0) {
+			t.Fatalf("output of %x created by the disconnected block is still unspent", tx.ID)
+		}
+	}
+
+	if got := balance(t, c, to); got != 0 {
+		t.Fatalf("balance of the address paid by the disconnected block = %d, want 0", got)
+	}
+
+	if journaled(t, c, bl) {
+		t.Fatal("the journal of the disconnected block was kept")
+	}
+
+	// Connecting it again journals it afresh and brings back the same set
+	err = c.UTXOSet().Update(bl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats := utxoStats(t, c); !bytes.Equal(stats.Hash, after.Hash) || !bytes.Equal(stats.BestBlock, bl.Hash) {
+		t.Fatalf("UTXO set at %x with hash %x after reconnecting, want the set at %x with hash %x", stats.BestBlock, stats.Hash, bl.Hash, after.Hash)
+	}
+
+	if !journaled(t, c, bl) {
+		t.Fatal("the reconnected block was not journaled")
+	}
+
+	wantChainstateMatchesChain(t, c)
+	wantConsistent(t, c)
+}
+
+func TestDisconnectOnlyLastApplied(t *testing.T) {
+	c := NewTestChain(t)
+	blocks := c.MineBlocks(2)
+	stats := utxoStats(t, c)
+
+	err := c.UTXOSet().Disconnect(blocks[0])
+	if !errors.Is(err, errors.ErrNotLastApplied) {
+		t.Fatalf("Disconnect of the block below the last applied = %v, want ErrNotLastApplied", err)
+	}
+
+	if got := utxoStats(t, c); !bytes.Equal(got.Hash, stats.Hash) || !bytes.Equal(got.BestBlock, stats.BestBlock) {
+		t.Fatal("a refused Disconnect changed the UTXO set")
+	}
+
+	// Unwinding from the tip down works block by block
+	for i := len(blocks) - 1; i >= 0; i-- {
+		err := c.UTXOSet().Disconnect(blocks[i])
+		if err != nil {
+			t.Fatalf("Disconnect of block %d: %v", blocks[i].Height, err)
+		}
+	}
+}
+
+func TestUndoJournalPruned(t *testing.T) {
+	c := NewTestChain(t)
+	blocks := c.MineBlocks(undoDepth + 2)
+
+	// At height undoDepth+2, the journals of the blocks below height 2 are pruned
+	if journaled(t, c, blocks[0]) {
+		t.Fatalf("block 1 is still journaled %d blocks deep", undoDepth+1)
+	}
+
+	for _, bl := range blocks[1:] {
+		if !journaled(t, c, bl) {
+			t.Fatalf("block %d was pruned from the journal at height %d", bl.Height, undoDepth+2)
+		}
+	}
+
+	for i := len(blocks) - 1; i > 0; i-- {
+		err := c.UTXOSet().Disconnect(blocks[i])
+		if err != nil {
+			t.Fatalf("Disconnect of block %d: %v", blocks[i].Height, err)
+		}
+	}
+
+	err := c.UTXOSet().Disconnect(blocks[0])
+	if !errors.Is(err, errors.ErrUndoNotFound) {
+		t.Fatalf("Disconnect of a pruned block = %v, want ErrUndoNotFound", err)
+	}
+}
@@ -1,212 +1,508 @@
-package blockchain
-
-import (
-	"encoding/hex"
-
-	"github.com/boltdb/bolt"
-	"github.com/yanglinshu/glock/internal/block"
-	"github.com/yanglinshu/glock/internal/transaction"
-)
-
-// utxoBucket is the name of the bucket used to store the UTXO set
-const utxoBucket = "chainstate"
-
-// UTXOSet represents a set of UTXOs
-type UTXOSet struct {
-	Blockchain *Blockchain
-}
-
-// Reindex rebuilds the UTXO set when the blockchain is updated
-func (u *UTXOSet) Reindex() error {
-	db := u.Blockchain.db
-	bucketName := []byte(utxoBucket)
-	err := db.Update(func(tx *bolt.Tx) error {
-		err := tx.DeleteBucket(bucketName)
-		if err != nil && err != bolt.ErrBucketNotFound {
-			return err
-		}
-
-		_, err = tx.CreateBucket(bucketName)
-		return err
-	})
-	if err != nil {
-		return err
-	}
-
-	UTXO, err := u.Blockchain.FindUTXO()
-	if err != nil {
-		return err
-	}
-
-	err = db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket(bucketName)
-
-		for txID, outs := range UTXO {
-			key, err := hex.DecodeString(txID)
-			if err != nil {
-				return err
-			}
-
-			sl, err := outs.Serialize()
-			if err != nil {
-				return err
-			}
-
-			err = b.Put(key, sl)
-			if err != nil {
-				return err
-			}
-		}
-
-		return nil
-	})
-	return err
-}
-
-// FindSpendableOutputs finds and returns unspent outputs to reference in inputs
-func (u *UTXOSet) FindSpendableOutputs(pubKeyHash []byte, amount int) (int, map[string][]int, error) {
-	unspentOutputs := make(map[string][]int)
-	accumulated := 0
-
-	db := u.Blockchain.db
-	err := db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(utxoBucket))
-
-		c := b.Cursor()
-
-		for k, v := c.First(); k != nil; k, v = c.Next() {
-			txID := hex.EncodeToString(k)
-			outs, err := transaction.DeserializeOutputs(v)
-			if err != nil {
-				return err
-			}
-
-			for outIdx, out := range outs.Outputs {
-				if out.IsLockedWithKey(pubKeyHash) && accumulated < amount {
-					accumulated += out.Value
-					unspentOutputs[txID] = append(unspentOutputs[txID], outIdx)
-				}
-			}
-		}
-
-		return nil
-	})
-	if err != nil {
-		return 0, nil, err
-	}
-
-	return accumulated, unspentOutputs, nil
-}
-
-// FindUTXO finds and returns all unspent transaction outputs
-func (u *UTXOSet) FindUTXO(pubKeyHash []byte) ([]transaction.TXOutput, error) {
-	var UTXOs []transaction.TXOutput
-
-	db := u.Blockchain.db
-	err := db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(utxoBucket))
-		c := b.Cursor()
-
-		for k, v := c.First(); k != nil; k, v = c.Next() {
-			outs, err := transaction.DeserializeOutputs(v)
-			if err != nil {
-				return err
-			}
-
-			for _, out := range outs.Outputs {
-				if out.IsLockedWithKey(pubKeyHash) {
-					UTXOs = append(UTXOs, out)
-				}
-			}
-		}
-
-		return nil
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	return UTXOs, nil
-}
-
-// CountTransactions returns the number of transactions in the UTXO set
-func (u UTXOSet) CountTransactions() (int, error) {
-	db := u.Blockchain.db
-	counter := 0
-
-	err := db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(utxoBucket))
-		c := b.Cursor()
-
-		for k, _ := c.First(); k != nil; k, _ = c.Next() {
-			counter++
-		}
-
-		return nil
-	})
-	if err != nil {
-		return 0, err
-	}
-
-	return counter, nil
-}
-
-// Update updates the UTXO set with transactions from the Block
-func (u *UTXOSet) Update(block *block.Block) error {
-	db := u.Blockchain.db
-	err := db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(utxoBucket))
-
-		for _, tx := range block.Transactions {
-			if !tx.IsCoinbase() {
-				for _, in := range tx.Vin {
-					updatedOuts := transaction.TXOutputs{}
-					outsBytes := b.Get(in.Txid)
-					outs, err := transaction.DeserializeOutputs(outsBytes)
-					if err != nil {
-						return err
-					}
-
-					for outIdx, out := range outs.Outputs {
-						if outIdx != in.Vout {
-							updatedOuts.Outputs = append(updatedOuts.Outputs, out)
-						}
-					}
-
-					if len(updatedOuts.Outputs) == 0 {
-						err := b.Delete(in.Txid)
-						if err != nil {
-							return err
-						}
-					} else {
-						sl, err := updatedOuts.Serialize()
-						if err != nil {
-							return err
-						}
-
-						err = b.Put(in.Txid, sl)
-						if err != nil {
-							return err
-						}
-					}
-				}
-			}
-
-			newOutputs := transaction.TXOutputs{}
-			newOutputs.Outputs = append(newOutputs.Outputs, tx.Vout...)
-
-			sl, err := newOutputs.Serialize()
-			if err != nil {
-				return err
-			}
-
-			err = b.Put(tx.ID, sl)
-			if err != nil {
-				return err
-			}
-		}
-
-		return nil
-	})
-	return err
-}
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+
+	"github.com/yanglinshu/glock/internal/block"
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/transaction"
+	bolt "go.etcd.io/bbolt"
+)
+
+// utxoBucket is the name of the bucket used to store the UTXO set
+const utxoBucket = "chainstate"
+
+// lastAppliedKey is the key in the chainstate bucket holding the hash of the last block whose
+// transactions are reflected in the UTXO set. Transaction IDs are 32 bytes long, so it never
+// collides with an entry of the set.
+const lastAppliedKey = "l"
+
+// UTXOSet represents a set of UTXOs
+type UTXOSet struct {
+	Blockchain *Blockchain
+}
+
+// isLastAppliedKey checks whether a key of the chainstate bucket is the last applied block marker
+func isLastAppliedKey(key []byte) bool {
+	return bytes.Equal(key, []byte(lastAppliedKey))
+}
+
+// reindexBatchKeys is about the number of keys of the UTXO set and its indexes written by one
+// database transaction of Reindex
+const reindexBatchKeys = 4096
+
+// Reindex rebuilds the UTXO set from the whole chain. Blocks are applied one by one as they are
+// connected, so a rebuild is only needed to recover a chainstate that cannot be reconciled. The
+// main chain is replayed from the genesis block in batches of about reindexBatchKeys keys, so
+// neither the memory used nor the size of a database transaction grows with the chain.
+func (u *UTXOSet) Reindex() error {
+	bc := u.Blockchain
+	err := bc.db.Update(resetChainstate)
+	if err != nil {
+		return err
+	}
+
+	tip, err := bc.GetBlock(bc.Tip())
+	if err != nil {
+		return err
+	}
+
+	return u.connectFrom(0, tip)
+}
+
+// resetChainstate replaces the UTXO set, the indexes built along with it and the undo journal with
+// empty buckets, for a rebuild from the main chain.
+func resetChainstate(tx *bolt.Tx) error {
+	for _, name := range []string{utxoBucket, txIndexBucket, undoBucket} {
+		err := tx.DeleteBucket([]byte(name))
+		if err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+
+		_, err = tx.CreateBucket([]byte(name))
+		if err != nil {
+			return err
+		}
+	}
+
+	return resetAddressIndex(tx)
+}
+
+// connectFrom applies the main chain blocks from the given height up to tip to the UTXO set as they
+// are connected, journaling the outputs they spend, in batches of about reindexBatchKeys keys.
+func (u *UTXOSet) connectFrom(height int, tip *block.Block) error {
+	bc := u.Blockchain
+
+	for height <= tip.Height {
+		err := bc.db.Update(func(tx *bolt.Tx) error {
+			keys := 0
+			for keys < reindexBatchKeys && height <= tip.Height {
+				bl, err := blockAtHeight(tx, height)
+				if err != nil {
+					return err
+				}
+
+				err = connectBlock(tx, bl)
+				if err != nil {
+					return err
+				}
+
+				for _, blockTx := range bl.Transactions {
+					keys += len(blockTx.Vin) + len(blockTx.Vout) + 1
+				}
+				height++
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		bc.logger.Info("Rebuilding the UTXO set", "height", height-1, "tip", tip.Height)
+	}
+
+	return nil
+}
+
+// FindSpendableOutputs chooses unspent outputs covering amount with the selector, FirstFit if it is
+// nil, and returns their total value and their indices by transaction ID.
+func (u *UTXOSet) FindSpendableOutputs(pubKeyHash []byte, amount int, selector CoinSelector) (int, map[string][]int, error) {
+	if selector == nil {
+		selector = FirstFit{}
+	}
+
+	utxos, err := u.FindOutPoints(pubKeyHash)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	selected, accumulated, err := selector.Select(utxos, amount)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	unspentOutputs := make(map[string][]int)
+	for _, op := range selected {
+		txID := hex.EncodeToString(op.Txid)
+		unspentOutputs[txID] = append(unspentOutputs[txID], op.Vout)
+	}
+
+	return accumulated, unspentOutputs, nil
+}
+
+// FindUTXO finds and returns all unspent transaction outputs
+func (u *UTXOSet) FindUTXO(pubKeyHash []byte) ([]transaction.TXOutput, error) {
+	var UTXOs []transaction.TXOutput
+
+	db := u.Blockchain.db
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+		c := b.Cursor()
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if isLastAppliedKey(k) {
+				continue
+			}
+
+			outs, err := transaction.DeserializeOutputs(v)
+			if err != nil {
+				return err
+			}
+
+			for _, out := range outs.Outputs {
+				if out.IsLockedWithKey(pubKeyHash) {
+					UTXOs = append(UTXOs, out)
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return UTXOs, nil
+}
+
+// totalValue returns the total value of the spendable outputs in the UTXO set
+func (u *UTXOSet) totalValue() (int, error) {
+	db := u.Blockchain.db
+	total := 0
+
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+		c := b.Cursor()
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if isLastAppliedKey(k) {
+				continue
+			}
+
+			outs, err := transaction.DeserializeOutputs(v)
+			if err != nil {
+				return err
+			}
+
+			for _, out := range outs.Outputs {
+				if !out.IsData() {
+					total += out.Value
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return total, nil
+}
+
+// CountTransactions returns the number of transactions in the UTXO set
+func (u UTXOSet) CountTransactions() (int, error) {
+	db := u.Blockchain.db
+	counter := 0
+
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+		c := b.Cursor()
+
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			if isLastAppliedKey(k) {
+				continue
+			}
+
+			counter++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return counter, nil
+}
+
+// Update updates the UTXO set with transactions from the Block. A block already applied last is
+// not applied twice.
+func (u *UTXOSet) Update(block *block.Block) error {
+	return u.Blockchain.db.Update(func(tx *bolt.Tx) error {
+		if bytes.Equal(tx.Bucket([]byte(utxoBucket)).Get([]byte(lastAppliedKey)), block.Hash) {
+			return nil
+		}
+
+		return connectBlock(tx, block)
+	})
+}
+
+// connectBlock applies the transactions of a block to the UTXO set and the indexes kept in step with
+// it, within the given database transaction. The outputs it spends are journaled for Disconnect.
+func connectBlock(tx *bolt.Tx, block *block.Block) error {
+	b := tx.Bucket([]byte(utxoBucket))
+	idx := tx.Bucket([]byte(addressBucket))
+	var spent []spentOutput
+
+	for _, tx := range block.Transactions {
+		if !tx.IsCoinbase() {
+			for _, in := range tx.Vin {
+				outsBytes := b.Get(in.Txid)
+				updatedOuts, err := transaction.DeserializeOutputs(outsBytes)
+				if err != nil {
+					return err
+				}
+
+				// Keep the other outputs at their indices
+				if in.Vout < len(updatedOuts.Outputs) {
+					err := unindexOutput(idx, in.Txid, in.Vout, updatedOuts.Outputs[in.Vout])
+					if err != nil {
+						return err
+					}
+
+					spent = append(spent, spentOutput{in.Txid, in.Vout, updatedOuts.Outputs[in.Vout], len(updatedOuts.Outputs)})
+					updatedOuts.Outputs[in.Vout] = transaction.TXOutput{}
+				}
+
+				if updatedOuts.AllSpent() {
+					err := b.Delete(in.Txid)
+					if err != nil {
+						return err
+					}
+				} else {
+					sl, err := updatedOuts.Serialize()
+					if err != nil {
+						return err
+					}
+
+					err = b.Put(in.Txid, sl)
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		// A transaction never replaces the outputs another with the same ID left unspent
+		if enforcesUniqueIDs(block) && b.Get(tx.ID) != nil {
+			return errors.Wrapf(errors.ErrDuplicateTransaction, "transaction %x", tx.ID)
+		}
+
+		// A transaction left with only data outputs has nothing to spend and is not kept
+		newOutputs := transaction.UnspentOutputs(tx.Vout)
+		if !newOutputs.AllSpent() {
+			sl, err := newOutputs.Serialize()
+			if err != nil {
+				return err
+			}
+
+			err = b.Put(tx.ID, sl)
+			if err != nil {
+				return err
+			}
+		}
+
+		for outIdx, out := range tx.Vout {
+			err := indexOutput(idx, tx.ID, outIdx, out)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err := putUndo(tx, block, spent)
+	if err != nil {
+		return err
+	}
+
+	err = indexBlockTransactions(tx.Bucket([]byte(txIndexBucket)), block)
+	if err != nil {
+		return err
+	}
+
+	err = confirmBlockTransactions(tx, block)
+	if err != nil {
+		return err
+	}
+
+	// Record the block in the same transaction so the marker never disagrees with the set
+	return b.Put([]byte(lastAppliedKey), block.Hash)
+}
+
+// connectTip applies a block that became the tip of the main chain to the UTXO set within the
+// database transaction storing it, if the set is at the parent of the block. Otherwise, such as
+// when the block completes a longer branch, the set is left for Reconcile.
+func connectTip(tx *bolt.Tx, bl *block.Block) error {
+	b := tx.Bucket([]byte(utxoBucket))
+	if b == nil || !bytes.Equal(b.Get([]byte(lastAppliedKey)), bl.PrevBlockHash) {
+		return nil
+	}
+
+	return connectBlock(tx, bl)
+}
+
+// Reconcile brings the UTXO set in line with the chain tip, after an unclean shutdown or once the
+// tip has moved. Blocks of the branch the chainstate was built on are disconnected down to the
+// common ancestor, then the main chain blocks above it are replayed through Update. If the last
+// applied block is unknown, the set is rebuilt from scratch.
+func (u *UTXOSet) Reconcile() error {
+	var lastApplied []byte
+
+	db := u.Blockchain.db
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+		if b == nil {
+			return nil
+		}
+
+		if marker := b.Get([]byte(lastAppliedKey)); marker != nil {
+			lastApplied = append([]byte{}, marker...)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if lastApplied == nil {
+		u.Blockchain.logger.Warn("Chainstate has no last applied block, rebuilding the UTXO set")
+		return u.Reindex()
+	}
+
+	if bytes.Equal(lastApplied, u.Blockchain.tip) {
+		return nil
+	}
+
+	disconnected, connected, err := u.Blockchain.FindFork(lastApplied)
+	if err != nil {
+		u.Blockchain.logger.Warn("Chainstate is at an unknown block, rebuilding the UTXO set", "block", lastApplied)
+		return u.Reindex()
+	}
+
+	// Undo the stale branch from its tip down, looking up the spent outputs in the chain for blocks
+	// connected before the journal or pruned from it
+	for _, bl := range disconnected {
+		err := u.Disconnect(bl)
+		if errors.Is(err, errors.ErrUndoNotFound) {
+			err = u.disconnect(bl, disconnected)
+		}
+		if err != nil {
+			return err
+		}
+
+		u.Blockchain.logger.Debug("Disconnected block from the chainstate", "block", bl.Hash, "height", bl.Height)
+	}
+
+	// Replay the main chain blocks in chain order
+	for i := len(connected) - 1; i >= 0; i-- {
+		err := u.Update(connected[i])
+		if err != nil {
+			return err
+		}
+
+		u.Blockchain.logger.Debug("Replayed block into the chainstate", "block", connected[i].Hash, "height", connected[i].Height)
+	}
+
+	return nil
+}
+
+// disconnect undoes the effect of a block on the UTXO set: the outputs it created are removed and
+// the outputs it spent are restored. The block must be the last applied one. branch holds the
+// blocks being disconnected, where spent outputs are looked up before the main chain.
+func (u *UTXOSet) disconnect(bl *block.Block, branch []*block.Block) error {
+	prevTXs := make(map[string]transaction.Transaction)
+	for _, tx := range bl.Transactions {
+		if tx.IsCoinbase() {
+			continue
+		}
+
+		for _, in := range tx.Vin {
+			prevTX, err := findBranchTransaction(u.Blockchain, branch, in.Txid)
+			if err != nil {
+				return err
+			}
+
+			prevTXs[hex.EncodeToString(in.Txid)] = prevTX
+		}
+	}
+
+	db := u.Blockchain.db
+	return db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+		idx := tx.Bucket([]byte(addressBucket))
+
+		// Walk the transactions backwards, so spends within the block are undone in order
+		for i := len(bl.Transactions) - 1; i >= 0; i-- {
+			blockTx := bl.Transactions[i]
+
+			err := b.Delete(blockTx.ID)
+			if err != nil {
+				return err
+			}
+
+			for outIdx, out := range blockTx.Vout {
+				err = unindexOutput(idx, blockTx.ID, outIdx, out)
+				if err != nil {
+					return err
+				}
+			}
+
+			if blockTx.IsCoinbase() {
+				continue
+			}
+
+			for _, in := range blockTx.Vin {
+				prevTX := prevTXs[hex.EncodeToString(in.Txid)]
+
+				outs := transaction.TXOutputs{Outputs: make([]transaction.TXOutput, len(prevTX.Vout))}
+				if outsBytes := b.Get(in.Txid); outsBytes != nil {
+					outs, err = transaction.DeserializeOutputs(outsBytes)
+					if err != nil {
+						return err
+					}
+				}
+
+				outs.Outputs[in.Vout] = prevTX.Vout[in.Vout]
+
+				err = indexOutput(idx, in.Txid, in.Vout, prevTX.Vout[in.Vout])
+				if err != nil {
+					return err
+				}
+
+				sl, err := outs.Serialize()
+				if err != nil {
+					return err
+				}
+
+				err = b.Put(in.Txid, sl)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		err := unindexBlockTransactions(tx.Bucket([]byte(txIndexBucket)), bl)
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(lastAppliedKey), bl.PrevBlockHash)
+	})
+}
+
+// findBranchTransaction finds a transaction in the given blocks, falling back to the main chain.
+func findBranchTransaction(bc *Blockchain, branch []*block.Block, ID []byte) (transaction.Transaction, error) {
+	for _, bl := range branch {
+		for _, tx := range bl.Transactions {
+			if bytes.Equal(tx.ID, ID) {
+				return *tx, nil
+			}
+		}
+	}
+
+	return bc.FindTransaction(ID)
+}
@@ -0,0 +1,383 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/yanglinshu/glock/internal/block"
+	"github.com/yanglinshu/glock/internal/transaction"
+	bolt "go.etcd.io/bbolt"
+)
+
+// newFileChain creates a test chain kept in a file of a temporary directory, so that it can be
+// reopened, and returns it along with the path of the file
+func newFileChain(t *testing.T) (*TestChain, string) {
+	t.Helper()
+
+	wallet, err := transaction.NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &TestChain{Wallet: wallet, t: t}
+
+	params := GenesisConfig{TargetBits: testTargetBits, Timestamp: testGenesisTime}
+	genesis, params, config, err := newGenesis(c.Address(), params, Config{RetargetInterval: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "blockchain.db")
+	c.Blockchain, err = createBlockchain(path, genesis, params, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.CloseDB() })
+
+	return c, path
+}
+
+// reopen closes the database of the chain and opens it again, as a node restarted after a crash
+func reopen(t *testing.T, c *TestChain, path string) {
+	t.Helper()
+
+	c.CloseDB()
+
+	bc, err := openBlockchain(path)
+	if err != nil {
+		t.Fatalf("reopening the chain: %v", err)
+	}
+
+	c.Blockchain = bc
+}
+
+// wantConsistent fails the test unless the UTXO set was applied up to the tip and matches the set
+// rebuilt from the chain
+func wantConsistent(t *testing.T, c *TestChain) {
+	t.Helper()
+
+	stats, err := c.UTXOSet().Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(stats.BestBlock, c.Tip()) {
+		t.Fatalf("UTXO set applied up to %x, want the tip %x", stats.BestBlock, c.Tip())
+	}
+
+	err = c.UTXOSet().Reindex()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rebuilt, err := c.UTXOSet().Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(stats.Hash, rebuilt.Hash) {
+		t.Fatalf("UTXO set hash = %x, want the hash of the rebuilt set %x", stats.Hash, rebuilt.Hash)
+	}
+}
+
+func TestReconcileAfterCrashBeforeUpdate(t *testing.T) {
+	c, path := newFileChain(t)
+	miner := NewTestChain(t, WithWallet(c.Wallet))
+	to := newAddress(t)
+
+	// The legacy path stores each block, then updates the UTXO set in a second write. The process
+	// is killed between the two, so no update ever happens.
+	miner.MineBlocks(2)
+	miner.Fund(to, 7)
+	for height := 1; height <= 3; height++ {
+		bl, err := miner.GetBlockByHeight(height)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = c.AddBlock(bl)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reopen(t, c, path)
+	wantConsistent(t, c)
+
+	if got := balance(t, c, to); got != 7 {
+		t.Fatalf("balance of the funded address = %d, want 7", got)
+	}
+}
+
+func TestReconcileAfterCrashDuringReorg(t *testing.T) {
+	c, path := newFileChain(t)
+	side := NewTestChain(t, WithWallet(c.Wallet))
+	to := newAddress(t)
+
+	// The main chain is connected block by block, one of them paying to
+	c.MineBlocks(1)
+	c.Fund(to, 7)
+
+	// A longer branch takes the tip, and the process is killed before the UTXO set follows it
+	side.MineBlocks(3)
+	for height := 1; height <= 3; height++ {
+		bl, err := side.GetBlockByHeight(height)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = c.AddBlock(bl)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !bytes.Equal(c.Tip(), side.Tip()) {
+		t.Fatal("the longer branch did not take the tip")
+	}
+
+	reopen(t, c, path)
+	wantConsistent(t, c)
+
+	// The payment was only confirmed on the abandoned branch
+	if got := balance(t, c, to); got != 0 {
+		t.Fatalf("balance of the address paid on the abandoned branch = %d, want 0", got)
+	}
+
+	if got := balance(t, c, c.Address()); got != 4*transaction.DefaultSubsidy {
+		t.Fatalf("balance of the wallet = %d, want %d", got, 4*transaction.DefaultSubsidy)
+	}
+
+	if report := audit(t, c); !report.OK() {
+		t.Fatalf("audit after the reorg = %+v, want no violation", report)
+	}
+}
+
+// isUnspent checks whether the UTXO set of the chain holds an output
+func isUnspent(t *testing.T, c *TestChain, txID []byte, vout int) bool {
+	t.Helper()
+
+	var unspent bool
+	err := c.db.View(func(tx *bolt.Tx) error {
+		outsBytes := tx.Bucket([]byte(utxoBucket)).Get(txID)
+		if outsBytes == nil {
+			return nil
+		}
+
+		outs, err := transaction.DeserializeOutputs(outsBytes)
+		if err != nil {
+			return err
+		}
+
+		unspent = vout < len(outs.Outputs) && !outs.Outputs[vout].IsSpent()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return unspent
+}
+
+// connectBranch hands the blocks of a branch to the chain as a node receiving them does, then
+// brings the UTXO set to the new tip
+func connectBranch(t *testing.T, c *TestChain, branch []*block.Block) {
+	t.Helper()
+
+	for _, bl := range branch {
+		err := c.ConnectBlock(bl)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := c.UTXOSet().Reconcile()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// wantSameUTXOSet fails the test unless both chains have the same UTXO set
+func wantSameUTXOSet(t *testing.T, c, other *TestChain) {
+	t.Helper()
+
+	stats, otherStats := utxoStats(t, c), utxoStats(t, other)
+	if !bytes.Equal(stats.Hash, otherStats.Hash) || !bytes.Equal(stats.BestBlock, otherStats.BestBlock) {
+		t.Fatalf("UTXO set at %x with hash %x, want the set at %x with hash %x", stats.BestBlock, stats.Hash, otherStats.BestBlock, otherStats.Hash)
+	}
+}
+
+func TestReorgTwoBlocks(t *testing.T) {
+	c := NewTestChain(t)
+	side := NewTestChain(t, WithWallet(c.Wallet))
+	to := newAddress(t)
+
+	c.MineBlocks(1)
+	c.Fund(to, 7)
+
+	// The branch overtakes the two blocks of the main chain
+	connectBranch(t, c, side.MineBlocks(3))
+
+	if !bytes.Equal(c.Tip(), side.Tip()) {
+		t.Fatal("the longer branch did not take the tip")
+	}
+
+	wantSameUTXOSet(t, c, side)
+
+	if got := balance(t, c, to); got != 0 {
+		t.Fatalf("balance of the address paid on the abandoned branch = %d, want 0", got)
+	}
+
+	err := c.ValidateChain()
+	if err != nil {
+		t.Fatalf("ValidateChain after the reorg: %v", err)
+	}
+}
+
+func TestReorgInvalidatesSpend(t *testing.T) {
+	c := NewTestChain(t)
+	side := NewTestChain(t, WithWallet(c.Wallet))
+	first, second := newAddress(t), newAddress(t)
+
+	// Both branches spend the genesis reward, the only output of the wallet, to another address
+	spend := c.Fund(first, 7)
+	doubleSpend := side.Fund(second, 8)
+
+	branch, err := side.GetBlockByHeight(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	connectBranch(t, c, append([]*block.Block{branch}, side.MineBlocks(1)...))
+
+	wantSameUTXOSet(t, c, side)
+
+	if got := balance(t, c, first); got != 0 {
+		t.Fatalf("balance of the payee of the abandoned spend = %d, want 0", got)
+	}
+
+	if got := balance(t, c, second); got != 8 {
+		t.Fatalf("balance of the payee of the winning spend = %d, want 8", got)
+	}
+
+	// The abandoned spend left the main chain, and the output it spends is spent on the new one
+	if _, err := c.LocateTransaction(spend.ID); err == nil {
+		t.Fatal("the spend of the abandoned branch is still in the main chain")
+	}
+
+	in := spend.Vin[0]
+	if isUnspent(t, c, in.Txid, in.Vout) {
+		t.Fatal("the output spent on both branches is unspent after the reorg")
+	}
+
+	if _, err := c.LocateTransaction(doubleSpend.ID); err != nil {
+		t.Fatalf("the spend of the winning branch is not in the main chain: %v", err)
+	}
+}
+
+// wantChainstateMatchesChain fails the test unless the chainstate bucket holds exactly the
+// unspent outputs found by walking the chain, without reconciling it first
+func wantChainstateMatchesChain(t *testing.T, c *TestChain) {
+	t.Helper()
+
+	want, err := c.FindUTXO()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]transaction.TXOutputs)
+	err = c.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+
+		if !bytes.Equal(b.Get([]byte(lastAppliedKey)), c.Tip()) {
+			t.Fatalf("chainstate applied up to %x, want the tip %x", b.Get([]byte(lastAppliedKey)), c.Tip())
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			if string(k) == lastAppliedKey {
+				return nil
+			}
+
+			outs, err := transaction.DeserializeOutputs(v)
+			if err != nil {
+				return err
+			}
+			got[hex.EncodeToString(k)] = outs
+
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("chainstate holds outputs of %d transactions, the chain %d", len(got), len(want))
+	}
+
+	for txID, outs := range want {
+		if !reflect.DeepEqual(got[txID].Outputs, outs.Outputs) {
+			t.Fatalf("chainstate outputs of %s = %+v, want %+v", txID, got[txID].Outputs, outs.Outputs)
+		}
+	}
+}
+
+func TestConnectBlockAtomicAcrossCrashes(t *testing.T) {
+	c, path := newFileChain(t)
+	miner := NewTestChain(t, WithWallet(c.Wallet))
+	to := newAddress(t)
+
+	miner.MineBlocks(2)
+	miner.Fund(to, 7)
+	miner.MineBlocks(1)
+
+	// The process is killed right after each block is committed: the chainstate never lags
+	for height := 1; height <= 4; height++ {
+		bl, err := miner.GetBlockByHeight(height)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = c.ConnectBlock(bl)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		wantChainstateMatchesChain(t, c)
+		reopen(t, c, path)
+		wantChainstateMatchesChain(t, c)
+	}
+
+	// A write failing halfway, once the block is stored and some of its outputs spent, leaves
+	// neither the block nor any change to the chainstate
+	funded, err := miner.GetBlockByHeight(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tip := c.Tip()
+	bl := mineOnTip(t, c, funded.Transactions[1])
+
+	err = c.ConnectBlock(bl)
+	if err == nil {
+		t.Fatal("ConnectBlock of a block replaying a spent payment succeeded")
+	}
+
+	if ok, err := c.HasBlock(bl.Hash); err != nil || ok {
+		t.Fatalf("HasBlock of the block whose write failed = %t, %v, want false", ok, err)
+	}
+
+	if !bytes.Equal(c.Tip(), tip) {
+		t.Fatal("the tip moved to the block whose write failed")
+	}
+
+	wantChainstateMatchesChain(t, c)
+	reopen(t, c, path)
+	wantChainstateMatchesChain(t, c)
+
+	if got := balance(t, c, to); got != 7 {
+		t.Fatalf("balance of the funded address = %d, want 7", got)
+	}
+}
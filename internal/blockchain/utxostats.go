@@ -0,0 +1,78 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/yanglinshu/glock/internal/transaction"
+	bolt "go.etcd.io/bbolt"
+)
+
+// UTXOStats describes the UTXO set
+type UTXOStats struct {
+	BestBlock      []byte // the hash of the last block applied to the set
+	Transactions   int    // the number of transactions with unspent outputs
+	Outputs        int    // the number of unspent outputs
+	TotalValue     int    // the total value of the unspent outputs, data outputs excluded
+	SerializedSize int    // the size of the entries of the set in the database
+	Hash           []byte // the digest of the unspent outputs in outpoint order
+}
+
+// Stats describes the UTXO set in one pass over the chainstate bucket. The hash covers the
+// outpoint, value, public key hash and data of every unspent output in outpoint order, so two nodes
+// with the same set get the same hash whatever the encoding of their database.
+func (u *UTXOSet) Stats() (UTXOStats, error) {
+	var stats UTXOStats
+
+	err := u.Blockchain.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+		c := b.Cursor()
+		hasher := sha256.New()
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if isLastAppliedKey(k) {
+				continue
+			}
+
+			outs, err := transaction.DeserializeOutputs(v)
+			if err != nil {
+				return err
+			}
+
+			stats.Transactions++
+			stats.SerializedSize += len(k) + len(v)
+
+			for outIdx, out := range outs.Outputs {
+				if out.IsSpent() {
+					continue
+				}
+
+				stats.Outputs++
+				if !out.IsData() {
+					stats.TotalValue += out.Value
+				}
+
+				var fields [20]byte
+				binary.BigEndian.PutUint32(fields[0:], uint32(outIdx))
+				binary.BigEndian.PutUint64(fields[4:], uint64(out.Value))
+				binary.BigEndian.PutUint32(fields[12:], uint32(len(out.PublicKeyHash)))
+				binary.BigEndian.PutUint32(fields[16:], uint32(len(out.Data)))
+
+				hasher.Write(k)
+				hasher.Write(fields[:16])
+				hasher.Write(out.PublicKeyHash)
+				hasher.Write(fields[16:])
+				hasher.Write(out.Data)
+			}
+		}
+
+		stats.BestBlock = append([]byte{}, b.Get([]byte(lastAppliedKey))...)
+		stats.Hash = hasher.Sum(nil)
+		return nil
+	})
+	if err != nil {
+		return UTXOStats{}, err
+	}
+
+	return stats, nil
+}
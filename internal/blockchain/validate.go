@@ -0,0 +1,477 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/yanglinshu/glock/internal/block"
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/transaction"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ValidationError describes the first inconsistency found in the chain by ValidateChain.
+type ValidationError struct {
+	Height int    // Height of the offending block
+	Hash   []byte // Hash of the offending block
+	Reason string // What is wrong with the block
+}
+
+// Error returns a description of the inconsistency and where it occurs.
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("block %d (%x): %s", e.Height, e.Hash, e.Reason)
+}
+
+// ValidateChain checks that the chain stored in the database is internally consistent. Walking
+// from the tip to the genesis block, every block must link to its parent, have a height one above
+// it, be timestamped after the median time of its last ancestors and carry a valid proof-of-work.
+// Every non-coinbase transaction must then be correctly signed over outputs of earlier
+// transactions. Transaction IDs must match their hashes and never reuse the ID of a transaction
+// with unspent outputs. The first inconsistency is returned as a *ValidationError.
+func (bc *Blockchain) ValidateChain() error {
+	var blocks []*block.Block
+
+	bci := bc.Iterator()
+	for {
+		bl, err := bci.Next()
+		if err != nil {
+			return err
+		}
+
+		if !block.NewProofOfWork(bl).Validate() {
+			return &ValidationError{bl.Height, bl.Hash, "invalid proof-of-work"}
+		}
+
+		if !bytes.Equal(bl.MerkleRoot, bl.HashTransactions()) {
+			return &ValidationError{bl.Height, bl.Hash, "Merkle root does not match the transactions"}
+		}
+
+		err = checkTransactionIDs(bl)
+		if err != nil {
+			return err
+		}
+
+		if len(blocks) > 0 {
+			child := blocks[len(blocks)-1]
+			if !bytes.Equal(child.PrevBlockHash, bl.Hash) {
+				return &ValidationError{child.Height, child.Hash, "previous block hash does not match its parent"}
+			}
+
+			if child.Height != bl.Height+1 {
+				return &ValidationError{child.Height, child.Hash, fmt.Sprintf("height does not follow parent height %d", bl.Height)}
+			}
+
+			bits, err := bc.NextBits(bl, child.Version)
+			if err != nil {
+				return err
+			}
+
+			if child.HeaderBits() != bits {
+				return &ValidationError{child.Height, child.Hash, fmt.Sprintf("bits %#x do not match the retarget schedule, expected %#x", child.HeaderBits(), bits)}
+			}
+		}
+
+		blocks = append(blocks, bl)
+
+		if len(bl.PrevBlockHash) == 0 {
+			if bl.Height != 0 {
+				return &ValidationError{bl.Height, bl.Hash, "genesis block is not at height 0"}
+			}
+
+			break
+		}
+	}
+
+	chainID := blocks[len(blocks)-1].Hash
+
+	// Verify the timestamps and the signatures in chain order, so every ancestor and spent output
+	// is already known
+	txs := make(map[string]transaction.Transaction)
+	unspent := make(map[string]int) // the number of unspent outputs of every transaction, by ID
+	spent := make(map[string]bool)  // the outputs spent, by "txid:vout"
+	for i := len(blocks) - 1; i >= 0; i-- {
+		bl := blocks[i]
+
+		if i < len(blocks)-1 {
+			ancestors := blocks[i+1:]
+			if len(ancestors) > medianTimeSpan {
+				ancestors = ancestors[:medianTimeSpan]
+			}
+
+			err := bc.checkTimestamp(bl, blocks[i+1], medianTime(ancestors))
+			if err != nil {
+				return &ValidationError{bl.Height, bl.Hash, err.Error()}
+			}
+		}
+
+		err := bc.checkCheckpoint(bl)
+		if err != nil {
+			return err
+		}
+
+		for _, tx := range bl.Transactions {
+			id := hex.EncodeToString(tx.ID)
+			if enforcesUniqueIDs(bl) && unspent[id] > 0 {
+				return &ValidationError{bl.Height, bl.Hash, fmt.Sprintf("transaction %x: reuses the ID of a transaction with unspent outputs", tx.ID)}
+			}
+
+			if tx.IsCoinbase() {
+				err := checkCoinbaseHeight(bl, tx)
+				if err != nil {
+					return err
+				}
+			} else {
+				reason := bc.verifyChainTransaction(tx, txs, bl.Height, chainID, true)
+				if reason != "" {
+					return &ValidationError{bl.Height, bl.Hash, fmt.Sprintf("transaction %x: %s", tx.ID, reason)}
+				}
+
+				for _, in := range tx.Vin {
+					outpoint := fmt.Sprintf("%x:%d", in.Txid, in.Vout)
+					if !spent[outpoint] {
+						spent[outpoint] = true
+						unspent[hex.EncodeToString(in.Txid)]--
+					}
+				}
+			}
+
+			txs[id] = *tx
+			unspent[id] = 0
+			for outIdx, out := range tx.Vout {
+				if !out.IsData() {
+					unspent[id]++
+					delete(spent, fmt.Sprintf("%s:%d", id, outIdx))
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// CheckBlock checks a block received from a peer before it is stored. The block must carry a valid
+// proof-of-work at the difficulty of the retarget schedule, sit one above its parent and hold
+// exactly one coinbase minting at most the subsidy plus the fees, within the size limits of the
+// chain, which are reported as ErrBlockTooLarge. It must be timestamped after the median time of
+// its last ancestors and not too far ahead of the local clock, or ErrInvalidTimestamp is returned.
+// Every other transaction must be correctly signed over outputs left unspent by the branch ending
+// at the parent, and no transaction may carry an ID other than its hash or the ID of one with
+// unspent outputs. ErrOrphanBlock is returned if the parent is not known yet, otherwise the first
+// problem found as a *ValidationError.
+func (bc *Blockchain) CheckBlock(bl *block.Block) error {
+	if !block.NewProofOfWork(bl).Validate() {
+		return &ValidationError{bl.Height, bl.Hash, "invalid proof-of-work"}
+	}
+
+	if !bytes.Equal(bl.MerkleRoot, bl.HashTransactions()) {
+		return &ValidationError{bl.Height, bl.Hash, "Merkle root does not match the transactions"}
+	}
+
+	if len(bl.PrevBlockHash) == 0 {
+		return &ValidationError{bl.Height, bl.Hash, "genesis block of another chain"}
+	}
+
+	err := bc.checkBlockSize(bl)
+	if err != nil {
+		return err
+	}
+
+	ok, err := bc.HasBlock(bl.PrevBlockHash)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.ErrOrphanBlock
+	}
+
+	parent, err := bc.GetBlock(bl.PrevBlockHash)
+	if err != nil {
+		return err
+	}
+
+	if bl.Height != parent.Height+1 {
+		return &ValidationError{bl.Height, bl.Hash, fmt.Sprintf("height does not follow parent height %d", parent.Height)}
+	}
+
+	err = bc.checkCheckpoint(bl)
+	if err != nil {
+		return err
+	}
+
+	bits, err := bc.NextBits(parent, bl.Version)
+	if err != nil {
+		return err
+	}
+
+	if bl.HeaderBits() != bits {
+		return &ValidationError{bl.Height, bl.Hash, fmt.Sprintf("bits %#x do not match the retarget schedule, expected %#x", bl.HeaderBits(), bits)}
+	}
+
+	median, err := bc.medianTimePast(parent)
+	if err != nil {
+		return err
+	}
+
+	err = bc.checkTimestamp(bl, parent, median)
+	if err != nil {
+		return err
+	}
+
+	var coinbase *transaction.Transaction
+	for _, tx := range bl.Transactions {
+		if tx.CheckOutputValues(bc.dustThreshold()) != nil {
+			return &ValidationError{bl.Height, bl.Hash, fmt.Sprintf("transaction %x: invalid output value", tx.ID)}
+		}
+
+		if tx.IsCoinbase() {
+			if coinbase != nil {
+				return &ValidationError{bl.Height, bl.Hash, "more than one coinbase transaction"}
+			}
+			coinbase = tx
+		}
+	}
+
+	if coinbase == nil {
+		return &ValidationError{bl.Height, bl.Hash, "no coinbase transaction"}
+	}
+
+	err = checkTransactionIDs(bl)
+	if err != nil {
+		return err
+	}
+
+	err = bc.checkUnspentIDs(bl)
+	if err != nil {
+		return err
+	}
+
+	err = checkCoinbaseHeight(bl, coinbase)
+	if err != nil {
+		return err
+	}
+
+	txs, spent, err := bc.branchTransactions(parent, bl)
+	if err != nil {
+		return err
+	}
+
+	chainID, err := bc.ChainID()
+	if err != nil {
+		return err
+	}
+
+	fees := 0
+	for _, tx := range bl.Transactions {
+		if !tx.IsCoinbase() {
+			reason := bc.verifyChainTransaction(tx, txs, bl.Height, chainID, !bc.skipsSignatures(bl.Height))
+			if reason == "" && !checkPaymentOutputs(tx) {
+				reason = "invalid payment output"
+			}
+
+			for _, in := range tx.Vin {
+				outpoint := fmt.Sprintf("%x:%d", in.Txid, in.Vout)
+				if reason == "" && spent[outpoint] {
+					reason = fmt.Sprintf("spends output %s twice", outpoint)
+				}
+				spent[outpoint] = true
+			}
+
+			if reason == "" {
+				prevTXs := make(map[string]transaction.Transaction)
+				for _, in := range tx.Vin {
+					prevTXs[hex.EncodeToString(in.Txid)] = txs[hex.EncodeToString(in.Txid)]
+				}
+
+				fee, err := transactionFee(tx, prevTXs)
+				if err == nil {
+					fees, err = transaction.AddValues(fees, fee)
+				}
+				if err != nil {
+					reason = err.Error()
+				} else if fee < 0 {
+					reason = "outputs are worth more than the inputs"
+				}
+			}
+
+			if reason != "" {
+				return &ValidationError{bl.Height, bl.Hash, fmt.Sprintf("transaction %x: %s", tx.ID, reason)}
+			}
+		}
+
+		txs[hex.EncodeToString(tx.ID)] = *tx
+	}
+
+	minted, err := outputValue(coinbase)
+	if err != nil {
+		return &ValidationError{bl.Height, bl.Hash, "coinbase " + err.Error()}
+	}
+
+	allowed, err := transaction.AddValues(bc.SubsidyAt(bl.Height), fees)
+	if err != nil {
+		return &ValidationError{bl.Height, bl.Hash, "fees " + err.Error()}
+	}
+
+	if minted > allowed {
+		return &ValidationError{bl.Height, bl.Hash, "coinbase mints more than the subsidy and the fees"}
+	}
+
+	return nil
+}
+
+// branchTransactions walks the branch ending at parent back until every transaction spent by the
+// block and not created by it is found. It returns the transactions found by ID, and the outputs
+// spent on the way by "txid:vout".
+func (bc *Blockchain) branchTransactions(parent *block.Block, bl *block.Block) (map[string]transaction.Transaction, map[string]bool, error) {
+	txs := make(map[string]transaction.Transaction)
+	spent := make(map[string]bool)
+
+	missing := make(map[string]bool)
+	for _, tx := range bl.Transactions {
+		if !tx.IsCoinbase() {
+			for _, in := range tx.Vin {
+				missing[hex.EncodeToString(in.Txid)] = true
+			}
+		}
+	}
+	for _, tx := range bl.Transactions {
+		delete(missing, hex.EncodeToString(tx.ID))
+	}
+
+	bci := &BlockchainIterator{parent.Hash, bc.db}
+	for len(missing) > 0 {
+		branchBlock, err := bci.Next()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, tx := range branchBlock.Transactions {
+			if !tx.IsCoinbase() {
+				for _, in := range tx.Vin {
+					spent[fmt.Sprintf("%x:%d", in.Txid, in.Vout)] = true
+				}
+			}
+
+			id := hex.EncodeToString(tx.ID)
+			if missing[id] {
+				txs[id] = *tx
+				delete(missing, id)
+			}
+		}
+
+		if len(branchBlock.PrevBlockHash) == 0 {
+			break
+		}
+	}
+
+	return txs, spent, nil
+}
+
+// verifyChainTransaction checks a transaction of the block at the given height against the earlier
+// transactions of the chain, with its signatures if verifySignatures is set, and its data output
+// held to the size limit of the chain. It returns the reason the transaction is invalid, or an empty
+// string.
+func (bc *Blockchain) verifyChainTransaction(tx *transaction.Transaction, txs map[string]transaction.Transaction, height int, chainID []byte, verifySignatures bool) string {
+	if tx.CheckDataOutputs(bc.maxDataSize()) != nil {
+		return "invalid data output"
+	}
+
+	if bc.requiresChainID(height) && tx.Version < transaction.ChainIDVersion {
+		return "signature does not commit to the chain"
+	}
+
+	prevTXs := make(map[string]transaction.Transaction)
+	for _, in := range tx.Vin {
+		prevTX, ok := txs[hex.EncodeToString(in.Txid)]
+		if !ok || in.Vout < 0 || in.Vout >= len(prevTX.Vout) {
+			return fmt.Sprintf("spends unknown output %x:%d", in.Txid, in.Vout)
+		}
+
+		prevTXs[hex.EncodeToString(in.Txid)] = prevTX
+	}
+
+	if verifySignatures {
+		ok, err := tx.Verify(prevTXs, chainID)
+		if !ok {
+			return err.Error()
+		}
+	}
+
+	return ""
+}
+
+// checkTransactionIDs returns a ValidationError if a transaction of a block appears twice or
+// carries an ID other than its hash before signing, which could overwrite the outputs of another
+// transaction.
+// Blocks mined before block.BinaryHeaderVersion may hold transactions keeping the IDs of their gob
+// encoding, so only their duplicates are checked.
+func checkTransactionIDs(bl *block.Block) error {
+	seen := make(map[string]bool)
+	for _, tx := range bl.Transactions {
+		id := hex.EncodeToString(tx.ID)
+		if seen[id] {
+			return &ValidationError{bl.Height, bl.Hash, fmt.Sprintf("transaction %x appears twice", tx.ID)}
+		}
+		seen[id] = true
+
+		if bl.Version < block.BinaryHeaderVersion {
+			continue
+		}
+
+		hash, err := tx.UnsignedHash()
+		if err != nil {
+			return err
+		}
+
+		if !bytes.Equal(tx.ID, hash) {
+			return &ValidationError{bl.Height, bl.Hash, fmt.Sprintf("transaction %x: ID does not match its hash %x", tx.ID, hash)}
+		}
+	}
+
+	return nil
+}
+
+// enforcesUniqueIDs checks whether a block may not reuse the ID of a transaction with unspent
+// outputs. Before block.CoinbaseHeightVersion, coinbases paying the same address shared an ID.
+func enforcesUniqueIDs(bl *block.Block) bool {
+	return bl.Version >= block.CoinbaseHeightVersion
+}
+
+// checkUnspentIDs returns a ValidationError if a transaction of a block reuses the ID of a
+// transaction whose outputs the UTXO set still holds. Only blocks extending the block the set was
+// last applied to are checked here, connectBlock refusing the others as they are connected.
+func (bc *Blockchain) checkUnspentIDs(bl *block.Block) error {
+	if !enforcesUniqueIDs(bl) {
+		return nil
+	}
+
+	return bc.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+		if !bytes.Equal(b.Get([]byte(lastAppliedKey)), bl.PrevBlockHash) {
+			return nil
+		}
+
+		for _, t := range bl.Transactions {
+			if b.Get(t.ID) != nil {
+				return &ValidationError{bl.Height, bl.Hash, fmt.Sprintf("transaction %x: reuses the ID of a transaction with unspent outputs", t.ID)}
+			}
+		}
+
+		return nil
+	})
+}
+
+// checkCoinbaseHeight returns a ValidationError if the coinbase of a block does not commit to its
+// height. Blocks mined before block.CoinbaseHeightVersion are not held to it.
+func checkCoinbaseHeight(bl *block.Block, coinbase *transaction.Transaction) error {
+	if bl.Version < block.CoinbaseHeightVersion {
+		return nil
+	}
+
+	height, ok := coinbase.CoinbaseHeight()
+	if !ok || height != bl.Height {
+		return &ValidationError{bl.Height, bl.Hash, "coinbase does not commit to the block height"}
+	}
+
+	return nil
+}
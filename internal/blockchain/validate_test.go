@@ -0,0 +1,271 @@
+package blockchain
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/yanglinshu/glock/internal/block"
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// mineOnTip mines a block on top of the tip holding a coinbase followed by txs, left unchecked so
+// that invalid blocks can be built
+func mineOnTip(t *testing.T, c *TestChain, txs ...*transaction.Transaction) *block.Block {
+	t.Helper()
+
+	cbTx, err := transaction.NewCoinbaseTX(c.Address(), "", bestHeight(t, c)+1, c.ChainParams())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return mineWithCoinbase(t, c, cbTx, txs...)
+}
+
+// mineWithCoinbase mines a block on top of the tip holding the given coinbase followed by txs, left
+// unchecked
+func mineWithCoinbase(t *testing.T, c *TestChain, cbTx *transaction.Transaction, txs ...*transaction.Transaction) *block.Block {
+	t.Helper()
+
+	parent, err := c.GetBlock(c.Tip())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bits, err := c.NextBits(parent, block.CurrentVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	timestamp, err := c.nextTimestamp(parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txs = append([]*transaction.Transaction{cbTx}, txs...)
+	bl := block.NewBlockTemplate(txs, parent.Hash, parent.Height+1, bits, timestamp)
+	err = bl.Mine(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bl
+}
+
+// wantValidationError fails the test unless err is a *ValidationError whose reason holds reason
+func wantValidationError(t *testing.T, err error, reason string) {
+	t.Helper()
+
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("error = %v, want a ValidationError", err)
+	}
+
+	if !strings.Contains(verr.Reason, reason) {
+		t.Fatalf("reason = %q, want it to mention %q", verr.Reason, reason)
+	}
+}
+
+func TestCheckBlockAcceptsSignedTransactions(t *testing.T) {
+	c := NewTestChain(t)
+	to := newAddress(t)
+
+	// Signing changes the hash of a transaction but not its ID
+	tx, err := NewUTXOTransaction(c.Wallet, to, 4, 1, nil, nil, c.UTXOSet())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.CheckBlock(mineOnTip(t, c, tx))
+	if err != nil {
+		t.Fatalf("CheckBlock of a block holding a signed payment: %v", err)
+	}
+
+	c.Fund(to, 3)
+	c.MineBlocks(2)
+
+	err = c.ValidateChain()
+	if err != nil {
+		t.Fatalf("ValidateChain of a chain holding payments: %v", err)
+	}
+}
+
+func TestCheckBlockRejectsMismatchedID(t *testing.T) {
+	c := NewTestChain(t)
+
+	tx, err := NewUTXOTransaction(c.Wallet, newAddress(t), 4, 0, nil, nil, c.UTXOSet())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The outputs of the transaction would be stored under another ID
+	tx.ID[0] ^= 0xff
+
+	err = c.CheckBlock(mineOnTip(t, c, tx))
+	wantValidationError(t, err, "ID does not match its hash")
+}
+
+func TestCheckBlockRejectsDuplicateTransaction(t *testing.T) {
+	c := NewTestChain(t)
+
+	tx, err := NewUTXOTransaction(c.Wallet, newAddress(t), 4, 0, nil, nil, c.UTXOSet())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.CheckBlock(mineOnTip(t, c, tx, tx))
+	wantValidationError(t, err, "appears twice")
+}
+
+func TestCheckBlockRejectsReusedUnspentID(t *testing.T) {
+	c := NewTestChain(t)
+
+	// Once confirmed, the outputs of the payment are unspent, so a block holding it again would
+	// overwrite them
+	tx := c.Fund(newAddress(t), 4)
+
+	bl := mineOnTip(t, c, tx)
+	err := c.CheckBlock(bl)
+	wantValidationError(t, err, "reuses the ID")
+
+	err = c.SubmitBlock(bl)
+	wantValidationError(t, err, "reuses the ID")
+}
+
+// coinbaseWorth returns a coinbase of the block on top of the tip paying value to the wallet of the
+// chain, whatever the subsidy
+func coinbaseWorth(t *testing.T, c *TestChain, value int) *transaction.Transaction {
+	t.Helper()
+
+	cbTx, err := transaction.NewCoinbaseTX(c.Address(), "", bestHeight(t, c)+1, c.ChainParams())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cbTx.Vout[0].Value = value
+	cbTx.ID, err = cbTx.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cbTx
+}
+
+func TestMinedSubsidyHalves(t *testing.T) {
+	c := NewTestChain(t, WithHalvingInterval(2))
+
+	// The subsidy of 10 halves at heights 2, 4, 6 and 8, where it reaches 0
+	want := []int{10, 5, 5, 2, 2, 1, 1, 0, 0}
+	for i, bl := range c.MineBlocks(len(want)) {
+		if got := bl.Transactions[0].Vout[0].Value; got != want[i] {
+			t.Fatalf("coinbase of block %d is worth %d, want %d", bl.Height, got, want[i])
+		}
+	}
+
+	// The genesis block is paid the full subsidy too
+	if got := balance(t, c, c.Address()); got != transaction.DefaultSubsidy+26 {
+		t.Fatalf("balance of the wallet = %d, want %d", got, transaction.DefaultSubsidy+26)
+	}
+}
+
+func TestCoinbaseHeldToHalvedSubsidy(t *testing.T) {
+	c := NewTestChain(t, WithHalvingInterval(2))
+	c.MineBlocks(1)
+
+	// At the first halving, the subsidy before it is too much
+	err := c.CheckBlock(mineWithCoinbase(t, c, coinbaseWorth(t, c, transaction.DefaultSubsidy)))
+	wantValidationError(t, err, "mints more")
+
+	err = c.CheckBlock(mineWithCoinbase(t, c, coinbaseWorth(t, c, transaction.DefaultSubsidy/2)))
+	if err != nil {
+		t.Fatalf("CheckBlock of a coinbase worth the halved subsidy: %v", err)
+	}
+
+	// Once the subsidy is 0, a coinbase may only claim the fees of its block
+	c.MineBlocks(6)
+	if subsidy := c.SubsidyAt(bestHeight(t, c) + 1); subsidy != 0 {
+		t.Fatalf("subsidy at height %d = %d, want 0", bestHeight(t, c)+1, subsidy)
+	}
+
+	err = c.CheckBlock(mineWithCoinbase(t, c, coinbaseWorth(t, c, 1)))
+	wantValidationError(t, err, "mints more")
+
+	err = c.CheckBlock(mineWithCoinbase(t, c, coinbaseWorth(t, c, 0)))
+	if err != nil {
+		t.Fatalf("CheckBlock of a coinbase worth nothing past the last halving: %v", err)
+	}
+
+	tx, err := NewUTXOTransaction(c.Wallet, newAddress(t), 4, 3, nil, nil, c.UTXOSet())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.CheckBlock(mineWithCoinbase(t, c, coinbaseWorth(t, c, 4), tx))
+	wantValidationError(t, err, "mints more")
+
+	// A miner is paid the fees alone
+	bl := c.MineBlocks(1, tx)[0]
+	if got := bl.Transactions[0].Vout[0].Value; got != 3 {
+		t.Fatalf("coinbase of a fee-only block is worth %d, want the fee of 3", got)
+	}
+}
+
+// mineWithBits mines a block on top of the tip holding a coinbase, carrying the given compact bits
+// instead of the ones of the retarget schedule
+func mineWithBits(t *testing.T, c *TestChain, bits uint32) *block.Block {
+	t.Helper()
+
+	parent, err := c.GetBlock(c.Tip())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	timestamp, err := c.nextTimestamp(parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cbTx, err := transaction.NewCoinbaseTX(c.Address(), "", parent.Height+1, c.ChainParams())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bl := block.NewBlockTemplate([]*transaction.Transaction{cbTx}, parent.Hash, parent.Height+1, int(bits), timestamp)
+	err = bl.Mine(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bl
+}
+
+func TestCheckBlockRejectsBitsOffSchedule(t *testing.T) {
+	c := NewTestChain(t)
+
+	// A block is held to the target of its own bits, which must be the ones of the schedule
+	for _, zeroBits := range []int{testTargetBits - 2, testTargetBits + 2} {
+		err := c.CheckBlock(mineWithBits(t, c, block.TargetBitsToCompact(zeroBits)))
+		wantValidationError(t, err, "do not match the retarget schedule")
+	}
+
+	bl := mineWithBits(t, c, block.TargetBitsToCompact(testTargetBits))
+	err := c.CheckBlock(bl)
+	if err != nil {
+		t.Fatalf("CheckBlock of a block carrying the bits of the schedule: %v", err)
+	}
+
+	// The bits are part of the header, so changing them breaks the proof-of-work
+	bl.Bits = int(block.TargetBitsToCompact(1))
+	err = c.CheckBlock(bl)
+	wantValidationError(t, err, "invalid proof-of-work")
+
+	// A chain holding a block off the schedule fails validation
+	err = c.AddBlock(mineWithBits(t, c, block.TargetBitsToCompact(testTargetBits-2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.ValidateChain()
+	wantValidationError(t, err, "do not match the retarget schedule")
+}
@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/qr"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// qrScale is the number of pixels per module in QR code images
+const qrScale = 8
+
+// qrResult is the result of address qr
+type qrResult struct {
+	Payload string `json:"payload"`       // the address or payment URI held by the code
+	Out     string `json:"out,omitempty"` // the PNG file written, if any
+
+	terminal string // the code drawn for the terminal, if no file is written
+}
+
+// printText draws the code followed by its payload, or tells where the image is written.
+func (r *qrResult) printText() {
+	if r.Out == "" {
+		fmt.Print(r.terminal)
+		fmt.Println(r.Payload)
+		return
+	}
+
+	fmt.Printf("QR code for %s written to %s\n", r.Payload, r.Out)
+}
+
+// showAddressQR renders an address as a QR code. With an amount or a label, the code holds a
+// payment URI instead of the bare address. The code is written as a PNG to out, or drawn for the
+// terminal if out is empty.
+func showAddressQR(address string, amount int, label, out string, network transaction.Network) (*qrResult, error) {
+	to, err := transaction.ParseAddress(address, network)
+	if err != nil {
+		return nil, errors.ErrInvalidAddress
+	}
+
+	payload := to.String()
+	if amount > 0 || label != "" {
+		payload = transaction.PaymentRequest{Address: to, Amount: amount, Label: label}.String()
+	}
+
+	code, err := qr.Encode([]byte(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	if out == "" {
+		return &qrResult{Payload: payload, terminal: code.Terminal()}, nil
+	}
+
+	image, err := code.PNG(qrScale)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.WriteFile(out, image, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &qrResult{Payload: payload, Out: out}, nil
+}
+
+// paymentResult is the result of parseuri
+type paymentResult struct {
+	Address string `json:"address"` // the address to pay
+	Amount  int    `json:"amount"`  // the amount requested, 0 if any
+	Label   string `json:"label"`   // the label of the request
+}
+
+// printText prints the fields of the payment request.
+func (r *paymentResult) printText() {
+	fmt.Printf("Address: %s\n", r.Address)
+	fmt.Printf("Amount:  %d\n", r.Amount)
+	fmt.Printf("Label:   %s\n", r.Label)
+}
+
+// parseURI decodes a payment URI
+func parseURI(uri string, network transaction.Network) (*paymentResult, error) {
+	request, err := transaction.ParsePaymentURI(uri, network)
+	if err != nil {
+		return nil, err
+	}
+
+	return &paymentResult{Address: request.Address.String(), Amount: request.Amount, Label: request.Label}, nil
+}
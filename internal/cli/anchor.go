@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/yanglinshu/glock/internal/blockchain"
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/server"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// anchorData anchors data given in hex on the chain, in the data output of a transaction from an
+// address of the wallet paying only the fee, the rest of the coins spent coming back as change. The
+// transaction is checked against the chain first, so data above the limit of the chain is rejected
+// before anything is sent.
+func anchorData(from, dataHex string, fee int, network transaction.Network, nodeID string, client *server.Client, mineNow bool) (*sendResult, error) {
+	if !transaction.ValidateAddress(from, network) {
+		return nil, errors.ErrInvalidAddress
+	}
+
+	data, err := hex.DecodeString(dataHex)
+	if err != nil {
+		return nil, errors.ErrInvalidDataOutput
+	}
+
+	dataOut, err := transaction.NewDataTXOutput(data)
+	if err != nil {
+		return nil, err
+	}
+
+	bc, err := openBlockchain(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBlockchain(bc)
+
+	wallets, err := transaction.NewWallets(nodeID, network)
+	if err != nil {
+		return nil, err
+	}
+
+	wallet, err := wallets.GetWallet(from)
+	if errors.Is(err, errors.ErrWalletNotFound) {
+		return nil, errors.NewError(fmt.Sprintf("address %s is not in your wallet (run 'glock show -addresses')", from))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	UTXOSet := blockchain.UTXOSet{Blockchain: bc}
+	tx, err := blockchain.NewUTXOTransactionMulti(wallet, nil, fee, dataOut, nil, &UTXOSet)
+	if err != nil {
+		return nil, err
+	}
+
+	err = bc.CheckTransaction(tx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "transaction %x", tx.ID)
+	}
+
+	return submitTransaction(bc, tx, from, network, client, mineNow)
+}
@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/yanglinshu/glock/internal/blockchain"
+	"github.com/yanglinshu/glock/internal/server"
+)
+
+// backupChain writes a copy of the blockchain database to the out file. If rpcPort is not 0, the
+// copy is pulled from the running node serving RPC on it, otherwise the database is opened
+// directly, which requires the node to be stopped.
+func backupChain(out string, rpcPort int, rpcToken, nodeID string) (*messageResult, error) {
+	f, err := os.OpenFile(out, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeBackup(f, rpcPort, rpcToken, nodeID)
+	if err != nil {
+		f.Close()
+		os.Remove(out)
+		return nil, err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return &messageResult{Message: fmt.Sprintf("Backup written to %s", out)}, nil
+}
+
+// writeBackup writes a copy of the blockchain database to f, see backupChain
+func writeBackup(f *os.File, rpcPort int, rpcToken, nodeID string) error {
+	if rpcPort != 0 {
+		return server.FetchBackup(rpcPort, rpcToken, f)
+	}
+
+	bc, err := openBlockchain(nodeID)
+	if err != nil {
+		return err
+	}
+	defer closeBlockchain(bc)
+
+	return bc.Backup(f)
+}
+
+// restoreChainResult is the result of restorechain
+type restoreChainResult struct {
+	Height int `json:"height"` // the height of the restored chain
+}
+
+// printText prints the height of the restored chain.
+func (r *restoreChainResult) printText() {
+	fmt.Printf("Restored a valid chain of height %d\n", r.Height)
+}
+
+// restoreChain replaces the blockchain database with the backup in the in file, once the chain it
+// holds is validated
+func restoreChain(in, nodeID string) (*restoreChainResult, error) {
+	f, err := os.Open(in)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	height, err := blockchain.RestoreBlockchain(f, nodeID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &restoreChainResult{Height: height}, nil
+}
@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/yanglinshu/glock/internal/block"
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// blockResult is the result of block
+type blockResult struct {
+	blockJSON
+
+	block *block.Block // the same block, printed as text
+}
+
+// printText prints the header of the block, then its transactions.
+func (r *blockResult) printText() {
+	fmt.Printf("============ Block %s ============\n", r.Hash)
+	fmt.Printf("Height: %d\n", r.Height)
+	fmt.Printf("Time: %s\n", r.Time)
+	fmt.Printf("Prev. block: %s\n", r.PrevBlockHash)
+	fmt.Printf("Merkle root: %s\n", r.MerkleRoot)
+	fmt.Printf("Bits: %d\n", r.Bits)
+	fmt.Printf("Nonce: %d\n", r.Nonce)
+	fmt.Printf("PoW: %t\n\n", r.PoW)
+	for _, tx := range r.block.Transactions {
+		fmt.Println(tx)
+	}
+}
+
+// getBlock returns the block with the given hash in hex if it is not empty, or else the block at
+// the given height on the main chain
+func getBlock(hashHex string, height int, network transaction.Network, nodeID string) (*blockResult, error) {
+	bc, err := openBlockchain(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBlockchain(bc)
+
+	var bl *block.Block
+	if hashHex != "" {
+		hash, err := hex.DecodeString(hashHex)
+		if err != nil || len(hash) == 0 {
+			return nil, errors.ErrInvalidHash
+		}
+
+		bl, err = bc.GetBlock(hash)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		bl, err = bc.GetBlockByHeight(height)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &blockResult{newBlockJSON(bl, network), bl}, nil
+}
@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/yanglinshu/glock/internal/errors"
+)
+
+// addCheckpoint pins the block with the given hash in hex at a height, or the block of the main
+// chain at that height if the hash is empty
+func addCheckpoint(height int, hashHex, nodeID string) (*messageResult, error) {
+	bc, err := openBlockchain(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBlockchain(bc)
+
+	var hash []byte
+	if hashHex != "" {
+		hash, err = hex.DecodeString(hashHex)
+		if err != nil || len(hash) == 0 {
+			return nil, errors.ErrInvalidHash
+		}
+	} else {
+		bl, err := bc.GetBlockByHeight(height)
+		if err != nil {
+			return nil, err
+		}
+		hash = bl.Hash
+	}
+
+	err = bc.AddCheckpoint(height, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return &messageResult{Message: fmt.Sprintf("Block %x is pinned at height %d", hash, height)}, nil
+}
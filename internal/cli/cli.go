@@ -1,212 +1,943 @@
-package cli
-
-import (
-	"flag"
-	"fmt"
-	"os"
-
-	"github.com/yanglinshu/glock/internal/blockchain"
-)
-
-// CLI represents the command line interface
-type CLI struct{}
-
-// NewCLI creates a new CLI instance
-func NewCLI(bc *blockchain.Blockchain) *CLI {
-	return &CLI{}
-}
-
-// printUsage prints the usage of the CLI
-func (cli *CLI) printUsage() {
-	fmt.Println("Usage:")
-	fmt.Println("  get -balance ADDRESS - Get balance of ADDRESS")
-	fmt.Println("  create -blockchain ADDRESS - Create a blockchain and send genesis block reward to ADDRESS")
-	fmt.Println("  create -wallet - Create a new wallet")
-	fmt.Println("  show -blockchain - Print all the blocks of the blockchain")
-	fmt.Println("  show -addresses - Print all the addresses in the wallet file")
-	fmt.Println("  send -from FROM -to TO -amount AMOUNT - Send AMOUNT of coins from FROM address to TO")
-	fmt.Println("  update -UTXO - Update the UTXO set")
-}
-
-// validateArgs validates the command line arguments
-func (cli *CLI) validateArgs() {
-	if len(os.Args) < 2 {
-		cli.printUsage()
-		os.Exit(1)
-	}
-}
-
-// Run parses the command line arguments and executes the command
-func (cli *CLI) Run() {
-	cli.validateArgs()
-
-	nodeID := os.Getenv("NODE_ID")
-	if nodeID == "" {
-		fmt.Println("NODE_ID env is not set!")
-		os.Exit(1)
-	}
-
-	// CLI commands
-	// Get command, has subcommand balance
-	getCmd := flag.NewFlagSet("get", flag.ExitOnError)
-	getCmdBalance := getCmd.String("balance", "", "The address to get balance for")
-
-	// Create command, has subcommand blockchain wallet
-	createCmd := flag.NewFlagSet("create", flag.ExitOnError)
-	createCmdBlockchain := createCmd.String("blockchain", "", "The address to send genesis block reward to")
-	createCmdWallet := createCmd.Bool("wallet", false, "Create a new wallet")
-
-	// Show command, has subcommand blockchain, addresses
-	showCmd := flag.NewFlagSet("print", flag.ExitOnError)
-	showCmdBlockchain := showCmd.Bool("blockchain", false, "Print all the blocks of the blockchain")
-	showCmdAddresses := showCmd.Bool("addresses", false, "Print all the addresses in the wallet file")
-
-	// Send command, defaultly create a send transaction, has parameters from, to, amount
-	sendCmd := flag.NewFlagSet("send", flag.ExitOnError)
-	sendCmdFrom := sendCmd.String("from", "", "Source wallet address")
-	sendCmdTo := sendCmd.String("to", "", "Destination wallet address")
-	sendCmdAmount := sendCmd.Int("amount", 0, "Amount to send")
-	sendCmdMine := sendCmd.Bool("mine", false, "Mine immediately on the same node")
-
-	// Update command, has subcommand UTXO
-	updateCmd := flag.NewFlagSet("update", flag.ExitOnError)
-	updateCmdUTXO := updateCmd.Bool("UTXO", false, "Update the UTXO set")
-
-	// Start command, start a node with a miner address
-	startCmd := flag.NewFlagSet("start", flag.ExitOnError)
-	startCmdNode := startCmd.String("node", "", "Start a node with a miner address")
-
-	// Parse the command line arguments
-	switch os.Args[1] {
-	case "get":
-		err := getCmd.Parse(os.Args[2:])
-		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
-		}
-	case "create":
-		err := createCmd.Parse(os.Args[2:])
-		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
-		}
-	case "show":
-		err := showCmd.Parse(os.Args[2:])
-		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
-		}
-	case "send":
-		err := sendCmd.Parse(os.Args[2:])
-		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
-		}
-	case "update":
-		err := updateCmd.Parse(os.Args[2:])
-		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
-		}
-	case "start":
-		err := startCmd.Parse(os.Args[2:])
-		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
-		}
-	default:
-		cli.printUsage()
-		os.Exit(1)
-	}
-
-	// Execute the command get if it was parsed
-	if getCmd.Parsed() {
-		if *getCmdBalance == "" {
-			getCmd.Usage()
-			fmt.Println("Invalid address: ", *getCmdBalance)
-			os.Exit(1)
-		}
-		err := getBalance(*getCmdBalance, nodeID)
-		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
-		}
-	}
-
-	// Execute the command create if it was parsed
-	if createCmd.Parsed() {
-		if *createCmdBlockchain != "" {
-			err := createBlockchain(*createCmdBlockchain, nodeID)
-			if err != nil {
-				fmt.Println(err)
-				os.Exit(1)
-			}
-		} else if *createCmdWallet {
-			err := createWallet(nodeID)
-			if err != nil {
-				fmt.Println(err)
-				os.Exit(1)
-			}
-		} else {
-			createCmd.Usage()
-			os.Exit(1)
-		}
-	}
-
-	// Execute the command show if it was parsed
-	if showCmd.Parsed() {
-		if *showCmdBlockchain {
-			err := showBlockchain(nodeID)
-			if err != nil {
-				fmt.Println(err)
-				os.Exit(1)
-			}
-		} else if *showCmdAddresses {
-			err := showAddresses(nodeID)
-			if err != nil {
-				fmt.Println(err)
-				os.Exit(1)
-			}
-		} else {
-			showCmd.Usage()
-			os.Exit(1)
-		}
-	}
-
-	// Execute the command send if it was parsed
-	if sendCmd.Parsed() {
-		if *sendCmdFrom == "" || *sendCmdTo == "" || *sendCmdAmount <= 0 {
-			sendCmd.Usage()
-			fmt.Println("Invalid address or amount")
-			os.Exit(1)
-		}
-		err := sendTransaction(*sendCmdFrom, *sendCmdTo, *sendCmdAmount, nodeID, *sendCmdMine)
-		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
-		}
-	}
-
-	// Execute the command update if it was parsed
-	if updateCmd.Parsed() {
-		if *updateCmdUTXO {
-			err := updateUTXO(nodeID)
-			if err != nil {
-				fmt.Println(err)
-				os.Exit(1)
-			}
-		} else {
-			updateCmd.Usage()
-			os.Exit(1)
-		}
-	}
-
-	// Execute the command start if it was parsed
-	if startCmd.Parsed() {
-		err := startNode(*startCmdNode, nodeID)
-		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
-		}
-	}
-}
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yanglinshu/glock/internal/block"
+	"github.com/yanglinshu/glock/internal/blockchain"
+	"github.com/yanglinshu/glock/internal/config"
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/logger"
+	"github.com/yanglinshu/glock/internal/server"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// CLI represents the command line interface
+type CLI struct {
+	json        bool   // print the results as JSON, set by the global -json flag
+	configFile  string // the configuration file, set by the global -config flag
+	dataDir     string // the data directory overriding the configuration file, set by -datadir
+	interactive bool   // running the commands typed in the shell, whose flag errors return to the prompt
+}
+
+// NewCLI creates a new CLI instance
+func NewCLI(bc *blockchain.Blockchain) *CLI {
+	return &CLI{}
+}
+
+// printUsage prints the usage of the CLI
+func (cli *CLI) printUsage() {
+	fmt.Println("Usage: [-json] [-config FILE] [-datadir DIR] COMMAND")
+	fmt.Println("  -json - Print the result of COMMAND as JSON, and its error as JSON on the standard error")
+	fmt.Println("  -config FILE - Read the settings of the node from a JSON file, overridden by the flags of COMMAND")
+	fmt.Println("  -datadir DIR - Keep the files of the node in DIR instead of the configured one")
+	fmt.Println("  get -balance ADDRESS [-minconf N] - Get the balance of ADDRESS, confirmed by at least N blocks and pending")
+	fmt.Println("  balance [-minconf N] - Get the balance of every address in the wallet file and their total")
+	fmt.Println("  create -blockchain ADDRESS [-network NAME] [-coinbase DATA] [-subsidy N] [-halving N] [-timestamp T] [-bits N] [-retarget N] [-spacing SECONDS] [-maxblocktx N] [-maxblockbytes N] [-dust N] [-maxdata N] - Create a blockchain and send genesis block reward to ADDRESS")
+	fmt.Println("  create -wallet [-mnemonic [-passphrase PASSPHRASE]] - Create a new wallet")
+	fmt.Println("  show -blockchain - Print all the blocks of the blockchain")
+	fmt.Println("  show -addresses - Print all the addresses in the wallet file")
+	fmt.Println("  show -memos - Print the memos sent to the addresses in the wallet file")
+	fmt.Println("  show -identity - Print the identity key of the node")
+	fmt.Println("  send -from FROM -to TO -amount AMOUNT [-fee FEE] [-memo MEMO [-pubkey KEY]] [-mine] - Send AMOUNT of coins from FROM address to TO")
+	fmt.Println("  send -from FROM -uri URI [-mine] - Pay the payment request URI from FROM address")
+	fmt.Println("  send -from FROM -outputs ADDR:AMOUNT,... [-fee FEE] [-mine] - Pay several addresses from FROM address in one transaction")
+	fmt.Println("  anchor -from FROM -data HEX [-fee FEE] [-mine] - Anchor data on the chain in a transaction from FROM address paying FEE")
+	fmt.Println("  block -hash HASH | -height N - Print the block with hash HASH, or at height N of the main chain")
+	fmt.Println("  history -address ADDRESS - Print the payments to and from ADDRESS, the latest first")
+	fmt.Println("  listunspent -address ADDRESS [-minvalue N] [-json] - Print the unspent outputs of ADDRESS worth at least N")
+	fmt.Println("  createrawtransaction -from FROM -to TO -amount AMOUNT | -outputs ADDR:AMOUNT,... [-fee FEE] [-pubkey KEY] - Print an unsigned transaction in hex")
+	fmt.Println("  signrawtransaction -hex HEX [-chainid ID] - Sign a transaction in hex with the wallet, offline if the chain ID is given")
+	fmt.Println("  createmultisig -required M -addresses ADDR,ADDR,... - Print the address of outputs M of the keys of the addresses must sign to spend")
+	fmt.Println("  sendrawtransaction -hex HEX - Send a signed transaction in hex to the seeds")
+	fmt.Println("  restore -seed HEX - Recreate the wallet file and its used addresses from a seed")
+	fmt.Println("  restore -mnemonic PHRASE [-passphrase PASSPHRASE] - Recreate the wallet file from a mnemonic phrase")
+	fmt.Println("  update -UTXO [-workers N] - Update the UTXO set")
+	fmt.Println("  reindex -tx - Rebuild the transaction index")
+	fmt.Println("  rescan [-from HEIGHT] - Record the transactions of the wallet addresses from HEIGHT, resuming the last rescan if not given")
+	fmt.Println("  backup -out FILE [-rpcport PORT [-rpctoken TOKEN]] - Back up the blockchain, from the running node if PORT is given")
+	fmt.Println("  restorechain -in FILE - Replace the blockchain with a backup once it is validated")
+	fmt.Println("  exportchain -out FILE - Write the blocks of the main chain to a portable block file")
+	fmt.Println("  importchain -in FILE [-force] - Validate and add the blocks of a block file, replacing a chain with another genesis if -force is given")
+	fmt.Println("  start [-node ADDRESS] [-listen HOST:PORT] [-seeds HOST:PORT,...] [-allowlist FILE] [-pprof HOST:PORT] [-network NAME] [-mempool N] [-timeout SECONDS] [-rpcport PORT [-rpctoken TOKEN]] [-loglevel LEVEL] - Start a node, mining to ADDRESS if given")
+	fmt.Println("  shell - Open the blockchain once and run the commands typed at an interactive prompt")
+	fmt.Println("  mempool [-tx ID] - Print the transactions pending in the mempool of the running node, or the one with ID")
+	fmt.Println("  peers - Print the peers of the running node with their last-seen time and round-trip time")
+	fmt.Println("  debug profile [-addr HOST:PORT] [-seconds N] [-out FILE] - Fetch a CPU profile from a running node")
+	fmt.Println("  generate -blocks N -address ADDRESS [-rpcport PORT [-rpctoken TOKEN]] [-force] - Mine N blocks immediately, rewarding ADDRESS, on the running node if PORT is given")
+	fmt.Println("  verify -level supply - Audit the total issuance against the subsidy schedule")
+	fmt.Println("  validate - Check that the blockchain database is internally consistent")
+	fmt.Println("  utxostats - Print the size, total value and hash of the UTXO set")
+	fmt.Println("  addcheckpoint -height N [-hash HASH] - Pin the block with HASH, or the main chain block, at height N")
+	fmt.Println("  address qr -address ADDRESS [-amount AMOUNT] [-label LABEL] [-out FILE] - Render ADDRESS or a payment request as a QR code")
+	fmt.Println("  parseuri -uri URI - Print the fields of a glock: payment URI")
+}
+
+// validateArgs validates the command line arguments, removing the global flags
+func (cli *CLI) validateArgs() {
+	globalCmd := flag.NewFlagSet("glock", flag.ContinueOnError)
+	globalCmd.BoolVar(&cli.json, "json", false, "Print the result as JSON")
+	globalCmd.StringVar(&cli.configFile, "config", "", "JSON file holding the settings of the node")
+	globalCmd.StringVar(&cli.dataDir, "datadir", "", "Directory holding the files of the node")
+	globalCmd.Usage = cli.printUsage
+
+	err := globalCmd.Parse(os.Args[1:])
+	if err != nil {
+		os.Exit(1)
+	}
+	os.Args = append(os.Args[:1], globalCmd.Args()...)
+
+	if len(os.Args) < 2 {
+		cli.printUsage()
+		os.Exit(1)
+	}
+}
+
+// loadConfig reads the configuration file given with -config, or the defaults without it, then
+// applies the NODE_ID env and the -datadir flag and moves to the data directory.
+func (cli *CLI) loadConfig() (config.Config, error) {
+	settings := config.Default()
+	if cli.configFile != "" {
+		var err error
+		settings, err = config.Load(cli.configFile)
+		if err != nil {
+			return config.Config{}, err
+		}
+	}
+
+	if nodeID := os.Getenv("NODE_ID"); nodeID != "" {
+		settings.NodeID = nodeID
+	}
+
+	if cli.dataDir != "" {
+		settings.DataDir = cli.dataDir
+	}
+
+	err := config.SetDataDir(settings.DataDir)
+	if err != nil {
+		return config.Config{}, err
+	}
+
+	return settings, nil
+}
+
+// Run parses the command line arguments and executes the command. A node started by the command
+// runs until the context is canceled.
+func (cli *CLI) Run(ctx context.Context) {
+	cli.validateArgs()
+
+	settings, err := cli.loadConfig()
+	if err != nil {
+		cli.report(nil, err)
+		os.Exit(1)
+	}
+
+	if settings.NodeID == "" {
+		fmt.Println("NODE_ID env is not set and the configuration file has no node_id!")
+		os.Exit(1)
+	}
+
+	if err := cli.execute(ctx, settings, os.Args[1:]); err != nil {
+		os.Exit(1)
+	}
+}
+
+// execute parses the arguments of a command and runs it, args[0] naming the command. It returns
+// ErrCommandFailed once the failure of the command is printed.
+func (cli *CLI) execute(ctx context.Context, settings config.Config, args []string) error {
+	nodeID := settings.NodeID
+	network, err := transaction.NetworkByName(settings.Network)
+	if err != nil {
+		return cli.report(nil, err)
+	}
+	client := server.NewClient(settings.NodeAddress(), settings.Seeds, settings.Network)
+
+	// CLI commands
+	// Get command, has subcommand balance
+	getCmd := flag.NewFlagSet("get", cli.errorHandling())
+	getCmdBalance := getCmd.String("balance", "", "The address to get balance for")
+	getCmdMinConf := getCmd.Int("minconf", 1, "Confirmations an output needs to count as confirmed")
+
+	// Balance command, adds up the balances of the wallet file
+	balanceCmd := flag.NewFlagSet("balance", cli.errorHandling())
+	balanceCmdMinConf := balanceCmd.Int("minconf", 1, "Confirmations an output needs to count as confirmed")
+
+	// Create command, has subcommand blockchain wallet
+	createCmd := flag.NewFlagSet("create", cli.errorHandling())
+	createCmdBlockchain := createCmd.String("blockchain", "", "The address to send genesis block reward to")
+	createCmdWallet := createCmd.Bool("wallet", false, "Create a new wallet")
+	createCmdMnemonic := createCmd.Bool("mnemonic", false, "Derive the wallet seed from a new mnemonic phrase")
+	createCmdPassphrase := createCmd.String("passphrase", "", "Passphrase protecting the mnemonic phrase")
+	createCmdBits := createCmd.Int("bits", block.DefaultTargetBits, "Number of leading zero bits initially required in block hashes")
+	createCmdRetarget := createCmd.Int("retarget", 10, "Number of blocks between difficulty adjustments")
+	createCmdSpacing := createCmd.Int("spacing", 60, "Expected number of seconds between blocks")
+	createCmdMaxBlockTx := createCmd.Int("maxblocktx", 1000, "Largest number of transactions in a block")
+	createCmdMaxBlockBytes := createCmd.Int("maxblockbytes", 1<<20, "Largest size of a block in bytes")
+	createCmdDust := createCmd.Int("dust", transaction.DefaultDustThreshold, "Smallest value of an output")
+	createCmdMaxData := createCmd.Int("maxdata", transaction.DefaultMaxDataSize, "Largest payload of a data output in bytes")
+	createCmdCoinbase := createCmd.String("coinbase", "", "Data in the coinbase transaction of the genesis block, a newspaper headline if empty")
+	createCmdSubsidy := createCmd.Int("subsidy", transaction.DefaultSubsidy, "Reward for mining a block")
+	createCmdHalving := createCmd.Int("halving", transaction.DefaultHalvingInterval, "Number of blocks between halvings of the subsidy, never if negative")
+	createCmdTimestamp := createCmd.Int64("timestamp", 0, "Unix time of the genesis block, the current time if 0")
+	createCmdNetwork := createCmd.String("network", settings.Network, "Network the chain belongs to: mainnet, testnet or dev")
+
+	// Show command, has subcommand blockchain, addresses
+	showCmd := flag.NewFlagSet("print", cli.errorHandling())
+	showCmdBlockchain := showCmd.Bool("blockchain", false, "Print all the blocks of the blockchain")
+	showCmdAddresses := showCmd.Bool("addresses", false, "Print all the addresses in the wallet file")
+	showCmdMemos := showCmd.Bool("memos", false, "Print the memos sent to the addresses in the wallet file")
+	showCmdIdentity := showCmd.Bool("identity", false, "Print the identity key of the node")
+
+	// Send command, defaultly create a send transaction, has parameters from, to, amount
+	sendCmd := flag.NewFlagSet("send", cli.errorHandling())
+	sendCmdFrom := sendCmd.String("from", "", "Source wallet address")
+	sendCmdTo := sendCmd.String("to", "", "Destination wallet address")
+	sendCmdAmount := sendCmd.Int("amount", 0, "Amount to send")
+	sendCmdFee := sendCmd.Int("fee", 0, "Fee paid to the miner on top of the amount")
+	sendCmdMine := sendCmd.Bool("mine", false, "Mine immediately on the same node")
+	sendCmdMemo := sendCmd.String("memo", "", "Memo readable only by the recipient")
+	sendCmdPubKey := sendCmd.String("pubkey", "", "Public key of the recipient in hex, to encrypt the memo")
+	sendCmdURI := sendCmd.String("uri", "", "Payment URI providing the destination and amount")
+	sendCmdOutputs := sendCmd.String("outputs", "", "Recipients and amounts as ADDR:AMOUNT,ADDR:AMOUNT")
+	sendCmdCoins := sendCmd.String("coins", "first-fit", "Coin selection strategy, first-fit or largest-first")
+
+	// Anchor command, has parameters from, data, fee and mine
+	anchorCmd := flag.NewFlagSet("anchor", cli.errorHandling())
+	anchorCmdFrom := anchorCmd.String("from", "", "Source wallet address paying the fee")
+	anchorCmdData := anchorCmd.String("data", "", "Data to anchor in hex")
+	anchorCmdFee := anchorCmd.Int("fee", 1, "Fee paid to the miner")
+	anchorCmdMine := anchorCmd.Bool("mine", false, "Mine immediately on the same node")
+
+	// Block command, prints a block by hash or height
+	blockCmd := flag.NewFlagSet("block", cli.errorHandling())
+	blockCmdHash := blockCmd.String("hash", "", "The hash of the block in hex")
+	blockCmdHeight := blockCmd.Int("height", -1, "The height of the block on the main chain")
+
+	// History command, lists the transactions of an address
+	historyCmd := flag.NewFlagSet("history", cli.errorHandling())
+	historyCmdAddress := historyCmd.String("address", "", "The address to list the transactions of")
+
+	// Listunspent command, lists the unspent outputs of an address
+	listUnspentCmd := flag.NewFlagSet("listunspent", cli.errorHandling())
+	listUnspentCmdAddress := listUnspentCmd.String("address", "", "The address to list the unspent outputs of")
+	listUnspentCmdMinValue := listUnspentCmd.Int("minvalue", 0, "Smallest value of the outputs listed")
+	listUnspentCmdJSON := listUnspentCmd.Bool("json", false, "Print the outputs as JSON")
+
+	// Raw transaction commands, building, signing and sending a transaction as separate steps
+	createRawCmd := flag.NewFlagSet("createrawtransaction", cli.errorHandling())
+	createRawCmdFrom := createRawCmd.String("from", "", "Source wallet address")
+	createRawCmdTo := createRawCmd.String("to", "", "Destination wallet address")
+	createRawCmdAmount := createRawCmd.Int("amount", 0, "Amount to send")
+	createRawCmdOutputs := createRawCmd.String("outputs", "", "Recipients and amounts as ADDR:AMOUNT,ADDR:AMOUNT")
+	createRawCmdFee := createRawCmd.Int("fee", 0, "Fee paid to the miner on top of the amount")
+	createRawCmdPubKey := createRawCmd.String("pubkey", "", "Public key of the source address in hex, if not in the wallet file")
+	createRawCmdCoins := createRawCmd.String("coins", "first-fit", "Coin selection strategy, first-fit or largest-first")
+	signRawCmd := flag.NewFlagSet("signrawtransaction", cli.errorHandling())
+	signRawCmdHex := signRawCmd.String("hex", "", "The transaction in hex")
+	signRawCmdChainID := signRawCmd.String("chainid", "", "Hash of the genesis block in hex, read from the blockchain if not given")
+	sendRawCmd := flag.NewFlagSet("sendrawtransaction", cli.errorHandling())
+	sendRawCmdHex := sendRawCmd.String("hex", "", "The signed transaction in hex")
+	createMultisigCmd := flag.NewFlagSet("createmultisig", cli.errorHandling())
+	createMultisigCmdRequired := createMultisigCmd.Int("required", 0, "Number of signatures needed to spend")
+	createMultisigCmdAddresses := createMultisigCmd.String("addresses", "", "Addresses whose keys may sign, as ADDR,ADDR")
+
+	// Restore command, has parameters seed, mnemonic, passphrase
+	restoreCmd := flag.NewFlagSet("restore", cli.errorHandling())
+	restoreCmdSeed := restoreCmd.String("seed", "", "Master seed of the wallet in hex")
+	restoreCmdMnemonic := restoreCmd.String("mnemonic", "", "Mnemonic phrase of the wallet")
+	restoreCmdPassphrase := restoreCmd.String("passphrase", "", "Passphrase protecting the mnemonic phrase")
+
+	// Update command, has subcommand UTXO
+	updateCmd := flag.NewFlagSet("update", cli.errorHandling())
+	updateCmdUTXO := updateCmd.Bool("UTXO", false, "Update the UTXO set")
+	updateCmdWorkers := updateCmd.Int("workers", 0, "Number of workers rebuilding the UTXO set, one per CPU if 0")
+
+	// Reindex command, has subcommand tx
+	reindexCmd := flag.NewFlagSet("reindex", cli.errorHandling())
+	reindexCmdTx := reindexCmd.Bool("tx", false, "Rebuild the transaction index")
+
+	// Rescan command, has flag from
+	rescanCmd := flag.NewFlagSet("rescan", cli.errorHandling())
+	rescanCmdFrom := rescanCmd.Int("from", -1, "Height to rescan from, resuming the last rescan if not given")
+
+	// Backup and restorechain commands
+	backupCmd := flag.NewFlagSet("backup", cli.errorHandling())
+	backupCmdOut := backupCmd.String("out", "", "File to write the backup to")
+	backupCmdRPCPort := backupCmd.Int("rpcport", 0, "Local RPC port of the running node to pull the backup from, 0 to open the database directly")
+	backupCmdRPCToken := backupCmd.String("rpctoken", "", "Bearer token of the RPC server")
+	restoreChainCmd := flag.NewFlagSet("restorechain", cli.errorHandling())
+	restoreChainCmdIn := restoreChainCmd.String("in", "", "File holding the backup")
+
+	// Exportchain and importchain commands
+	exportChainCmd := flag.NewFlagSet("exportchain", cli.errorHandling())
+	exportChainCmdOut := exportChainCmd.String("out", "", "File to write the blocks to")
+	importChainCmd := flag.NewFlagSet("importchain", cli.errorHandling())
+	importChainCmdIn := importChainCmd.String("in", "", "File holding the blocks")
+	importChainCmdForce := importChainCmd.Bool("force", false, "Replace a blockchain starting from another genesis block")
+
+	// Start command, start a node with a miner address
+	startCmd := flag.NewFlagSet("start", cli.errorHandling())
+	startCmdNode := startCmd.String("node", settings.MinerAddress, "Start a node with a miner address")
+	startCmdListen := startCmd.String("listen", settings.ListenAddr, "Address the node listens on, localhost:NODE_ID if empty")
+	startCmdSeeds := startCmd.String("seeds", strings.Join(settings.Seeds, ","), "Nodes known at startup as HOST:PORT,HOST:PORT, which transactions are sent to")
+	startCmdAllowlist := startCmd.String("allowlist", "", "File listing the identities allowed to connect")
+	startCmdPprof := startCmd.String("pprof", "", "Address of the debug listener serving profiles and metrics, disabled if empty")
+	startCmdMempool := startCmd.Int("mempool", server.DefaultMempoolSize, "Maximum number of transactions in the mempool, unbounded if 0")
+	startCmdNetwork := startCmd.String("network", settings.Network, "Network to join: mainnet, testnet or dev")
+	startCmdTimeout := startCmd.Int("timeout", int(server.DefaultTimeout/time.Second), "Seconds a peer may take to send or receive a message")
+	startCmdRPCPort := startCmd.Int("rpcport", settings.RPCPort, "Local port serving the JSON-RPC methods and the block explorer, disabled if 0")
+	startCmdRPCToken := startCmd.String("rpctoken", settings.RPCToken, "Bearer token JSON-RPC requests must carry")
+	startCmdLogLevel := startCmd.String("loglevel", settings.LogLevel, "Lowest level logged: debug, info, warn or error")
+
+	// Shell command, has no parameters
+	shellCmd := flag.NewFlagSet("shell", cli.errorHandling())
+
+	// Mempool command, has parameter tx
+	mempoolCmd := flag.NewFlagSet("mempool", cli.errorHandling())
+	mempoolCmdTx := mempoolCmd.String("tx", "", "The ID in hex of the pending transaction to print")
+
+	// Peers command, has no parameters
+	peersCmd := flag.NewFlagSet("peers", cli.errorHandling())
+
+	// Debug command, has subcommand profile with parameters addr, seconds, out
+	debugProfileCmd := flag.NewFlagSet("debug profile", cli.errorHandling())
+	debugProfileCmdAddr := debugProfileCmd.String("addr", "127.0.0.1:6060", "Address of the debug listener of the node")
+	debugProfileCmdSeconds := debugProfileCmd.Int("seconds", 30, "Duration of the profile in seconds")
+	debugProfileCmdOut := debugProfileCmd.String("out", "cpu.pb.gz", "File to write the profile to")
+
+	// Generate command, has parameters blocks, address, rpcport, rpctoken, force
+	generateCmd := flag.NewFlagSet("generate", cli.errorHandling())
+	generateCmdBlocks := generateCmd.Int("blocks", 1, "Number of blocks to mine")
+	generateCmdAddress := generateCmd.String("address", "", "The address to send the block rewards to")
+	generateCmdRPCPort := generateCmd.Int("rpcport", settings.RPCPort, "Local RPC port of the running node to mine on, 0 to mine on the database directly")
+	generateCmdRPCToken := generateCmd.String("rpctoken", settings.RPCToken, "Bearer token of the RPC server")
+	generateCmdForce := generateCmd.Bool("force", false, "Mine on the database even if the difficulty is high")
+
+	// Verify command, has parameter level
+	verifyCmd := flag.NewFlagSet("verify", cli.errorHandling())
+	verifyCmdLevel := verifyCmd.String("level", "supply", "Verification level: supply")
+
+	// Validate command, has no parameters
+	validateCmd := flag.NewFlagSet("validate", cli.errorHandling())
+
+	// Utxostats command, has no parameters
+	utxoStatsCmd := flag.NewFlagSet("utxostats", cli.errorHandling())
+
+	// Addcheckpoint command, has parameters height, hash
+	addCheckpointCmd := flag.NewFlagSet("addcheckpoint", cli.errorHandling())
+	addCheckpointCmdHeight := addCheckpointCmd.Int("height", -1, "The height of the pinned block")
+	addCheckpointCmdHash := addCheckpointCmd.String("hash", "", "The hash of the pinned block in hex, the main chain block if empty")
+
+	// Address command, has subcommand qr with parameters address, amount, label, out
+	addressQRCmd := flag.NewFlagSet("address qr", cli.errorHandling())
+	addressQRCmdAddress := addressQRCmd.String("address", "", "The address to render")
+	addressQRCmdAmount := addressQRCmd.Int("amount", 0, "Amount to request")
+	addressQRCmdLabel := addressQRCmd.String("label", "", "Label of the payment request")
+	addressQRCmdOut := addressQRCmd.String("out", "", "PNG file to write, prints to the terminal if empty")
+
+	// Parseuri command, has parameter uri
+	parseURICmd := flag.NewFlagSet("parseuri", cli.errorHandling())
+	parseURICmdURI := parseURICmd.String("uri", "", "The glock: URI to decode")
+
+	// Parse the command line arguments
+	switch args[0] {
+	case "get":
+		err := getCmd.Parse(args[1:])
+		if err != nil {
+			return errors.ErrCommandFailed
+		}
+	case "balance":
+		err := balanceCmd.Parse(args[1:])
+		if err != nil {
+			return errors.ErrCommandFailed
+		}
+	case "create":
+		err := createCmd.Parse(args[1:])
+		if err != nil {
+			return errors.ErrCommandFailed
+		}
+	case "show", "print":
+		err := showCmd.Parse(args[1:])
+		if err != nil {
+			return errors.ErrCommandFailed
+		}
+	case "send":
+		err := sendCmd.Parse(args[1:])
+		if err != nil {
+			return errors.ErrCommandFailed
+		}
+	case "anchor":
+		err := anchorCmd.Parse(args[1:])
+		if err != nil {
+			return errors.ErrCommandFailed
+		}
+	case "block":
+		err := blockCmd.Parse(args[1:])
+		if err != nil {
+			return errors.ErrCommandFailed
+		}
+	case "history":
+		err := historyCmd.Parse(args[1:])
+		if err != nil {
+			return errors.ErrCommandFailed
+		}
+	case "listunspent":
+		err := listUnspentCmd.Parse(args[1:])
+		if err != nil {
+			return errors.ErrCommandFailed
+		}
+	case "createrawtransaction":
+		err := createRawCmd.Parse(args[1:])
+		if err != nil {
+			return errors.ErrCommandFailed
+		}
+	case "signrawtransaction":
+		err := signRawCmd.Parse(args[1:])
+		if err != nil {
+			return errors.ErrCommandFailed
+		}
+	case "sendrawtransaction":
+		err := sendRawCmd.Parse(args[1:])
+		if err != nil {
+			return errors.ErrCommandFailed
+		}
+	case "createmultisig":
+		err := createMultisigCmd.Parse(args[1:])
+		if err != nil {
+			return errors.ErrCommandFailed
+		}
+	case "restore":
+		err := restoreCmd.Parse(args[1:])
+		if err != nil {
+			return errors.ErrCommandFailed
+		}
+	case "update":
+		err := updateCmd.Parse(args[1:])
+		if err != nil {
+			return errors.ErrCommandFailed
+		}
+	case "reindex":
+		err := reindexCmd.Parse(args[1:])
+		if err != nil {
+			return errors.ErrCommandFailed
+		}
+	case "rescan":
+		err := rescanCmd.Parse(args[1:])
+		if err != nil {
+			return errors.ErrCommandFailed
+		}
+	case "backup":
+		err := backupCmd.Parse(args[1:])
+		if err != nil {
+			return errors.ErrCommandFailed
+		}
+	case "restorechain":
+		err := restoreChainCmd.Parse(args[1:])
+		if err != nil {
+			return errors.ErrCommandFailed
+		}
+	case "exportchain":
+		err := exportChainCmd.Parse(args[1:])
+		if err != nil {
+			return errors.ErrCommandFailed
+		}
+	case "importchain":
+		err := importChainCmd.Parse(args[1:])
+		if err != nil {
+			return errors.ErrCommandFailed
+		}
+	case "start":
+		err := startCmd.Parse(args[1:])
+		if err != nil {
+			return errors.ErrCommandFailed
+		}
+	case "shell":
+		err := shellCmd.Parse(args[1:])
+		if err != nil {
+			return errors.ErrCommandFailed
+		}
+	case "mempool":
+		err := mempoolCmd.Parse(args[1:])
+		if err != nil {
+			return errors.ErrCommandFailed
+		}
+	case "peers":
+		err := peersCmd.Parse(args[1:])
+		if err != nil {
+			return errors.ErrCommandFailed
+		}
+	case "debug":
+		if len(args) < 2 || args[1] != "profile" {
+			cli.printUsage()
+			return errors.ErrCommandFailed
+		}
+		err := debugProfileCmd.Parse(args[2:])
+		if err != nil {
+			return errors.ErrCommandFailed
+		}
+	case "generate":
+		err := generateCmd.Parse(args[1:])
+		if err != nil {
+			return errors.ErrCommandFailed
+		}
+	case "verify":
+		err := verifyCmd.Parse(args[1:])
+		if err != nil {
+			return errors.ErrCommandFailed
+		}
+	case "validate":
+		err := validateCmd.Parse(args[1:])
+		if err != nil {
+			return errors.ErrCommandFailed
+		}
+	case "utxostats":
+		err := utxoStatsCmd.Parse(args[1:])
+		if err != nil {
+			return errors.ErrCommandFailed
+		}
+	case "addcheckpoint":
+		err := addCheckpointCmd.Parse(args[1:])
+		if err != nil {
+			return errors.ErrCommandFailed
+		}
+	case "address":
+		if len(args) < 2 || args[1] != "qr" {
+			cli.printUsage()
+			return errors.ErrCommandFailed
+		}
+		err := addressQRCmd.Parse(args[2:])
+		if err != nil {
+			return errors.ErrCommandFailed
+		}
+	case "parseuri":
+		err := parseURICmd.Parse(args[1:])
+		if err != nil {
+			return errors.ErrCommandFailed
+		}
+	default:
+		cli.printUsage()
+		return errors.ErrCommandFailed
+	}
+
+	// Execute the command get if it was parsed
+	if getCmd.Parsed() {
+		if *getCmdBalance == "" {
+			getCmd.Usage()
+			fmt.Println("Invalid address: ", *getCmdBalance)
+			return errors.ErrCommandFailed
+		}
+		if *getCmdMinConf < 0 {
+			getCmd.Usage()
+			return errors.ErrCommandFailed
+		}
+		res, err := getBalance(*getCmdBalance, *getCmdMinConf, network, nodeID)
+		return cli.report(res, err)
+	}
+
+	// Execute the command balance if it was parsed
+	if balanceCmd.Parsed() {
+		if *balanceCmdMinConf < 0 {
+			balanceCmd.Usage()
+			return errors.ErrCommandFailed
+		}
+		res, err := getWalletBalance(*balanceCmdMinConf, network, nodeID)
+		return cli.report(res, err)
+	}
+
+	// Execute the command create if it was parsed
+	if createCmd.Parsed() {
+		if *createCmdBlockchain != "" {
+			params := blockchain.GenesisConfig{
+				Network:      *createCmdNetwork,
+				CoinbaseData: *createCmdCoinbase,
+				Subsidy:      *createCmdSubsidy,
+				TargetBits:   *createCmdBits,
+				Timestamp:    *createCmdTimestamp,
+
+				HalvingInterval: *createCmdHalving,
+			}
+			config := blockchain.Config{
+				RetargetInterval: *createCmdRetarget,
+				TargetSpacing:    *createCmdSpacing,
+				MaxBlockTxCount:  *createCmdMaxBlockTx,
+				MaxBlockBytes:    *createCmdMaxBlockBytes,
+				DustThreshold:    *createCmdDust,
+				MaxDataSize:      *createCmdMaxData,
+			}
+			res, err := createBlockchain(*createCmdBlockchain, params, config, nodeID)
+			return cli.report(res, err)
+		} else if *createCmdWallet {
+			res, err := createWallet(*createCmdMnemonic, *createCmdPassphrase, network, nodeID)
+			return cli.report(res, err)
+		} else {
+			createCmd.Usage()
+			return errors.ErrCommandFailed
+		}
+	}
+
+	// Execute the command show if it was parsed
+	if showCmd.Parsed() {
+		if *showCmdBlockchain {
+			res, err := showBlockchain(network, nodeID)
+			return cli.report(res, err)
+		} else if *showCmdAddresses {
+			res, err := showAddresses(network, nodeID)
+			return cli.report(res, err)
+		} else if *showCmdMemos {
+			res, err := showMemos(network, nodeID)
+			return cli.report(res, err)
+		} else if *showCmdIdentity {
+			res, err := showIdentity(nodeID)
+			return cli.report(res, err)
+		} else {
+			showCmd.Usage()
+			return errors.ErrCommandFailed
+		}
+	}
+
+	// Execute the command send if it was parsed
+	if sendCmd.Parsed() {
+		if *sendCmdURI != "" {
+			request, err := transaction.ParsePaymentURI(*sendCmdURI, network)
+			if err != nil {
+				fmt.Println(err)
+				return errors.ErrCommandFailed
+			}
+
+			*sendCmdTo = request.Address.String()
+			if *sendCmdAmount == 0 {
+				*sendCmdAmount = request.Amount
+			}
+		}
+
+		var recipients []blockchain.Recipient
+		if *sendCmdOutputs != "" {
+			var err error
+			recipients, err = parseOutputs(*sendCmdOutputs, network)
+			if err != nil {
+				fmt.Println(err)
+				return errors.ErrCommandFailed
+			}
+		} else if *sendCmdTo != "" && *sendCmdAmount > 0 {
+			recipient, err := newRecipient(*sendCmdTo, *sendCmdAmount, network)
+			if err != nil {
+				fmt.Println(err)
+				return errors.ErrCommandFailed
+			}
+			recipients = []blockchain.Recipient{recipient}
+		}
+
+		if *sendCmdFrom == "" || len(recipients) == 0 || *sendCmdFee < 0 {
+			sendCmd.Usage()
+			fmt.Println("Invalid address or amount")
+			return errors.ErrCommandFailed
+		}
+		res, err := sendTransaction(*sendCmdFrom, recipients, *sendCmdFee, *sendCmdMemo, *sendCmdPubKey, *sendCmdCoins, network, nodeID, client, *sendCmdMine)
+		return cli.report(res, err)
+	}
+
+	// Execute the command anchor if it was parsed
+	if anchorCmd.Parsed() {
+		if *anchorCmdFrom == "" || *anchorCmdData == "" || *anchorCmdFee <= 0 {
+			anchorCmd.Usage()
+			return errors.ErrCommandFailed
+		}
+		res, err := anchorData(*anchorCmdFrom, *anchorCmdData, *anchorCmdFee, network, nodeID, client, *anchorCmdMine)
+		return cli.report(res, err)
+	}
+
+	// Execute the command block if it was parsed
+	if blockCmd.Parsed() {
+		if (*blockCmdHash == "") == (*blockCmdHeight < 0) {
+			blockCmd.Usage()
+			return errors.ErrCommandFailed
+		}
+		res, err := getBlock(*blockCmdHash, *blockCmdHeight, network, nodeID)
+		return cli.report(res, err)
+	}
+
+	// Execute the command history if it was parsed
+	if historyCmd.Parsed() {
+		if *historyCmdAddress == "" {
+			historyCmd.Usage()
+			return errors.ErrCommandFailed
+		}
+		res, err := getHistory(*historyCmdAddress, network, nodeID)
+		return cli.report(res, err)
+	}
+
+	// Execute the command listunspent if it was parsed
+	if listUnspentCmd.Parsed() {
+		if *listUnspentCmdAddress == "" {
+			listUnspentCmd.Usage()
+			return errors.ErrCommandFailed
+		}
+		if *listUnspentCmdJSON {
+			cli.json = true
+		}
+		res, err := listUnspent(*listUnspentCmdAddress, *listUnspentCmdMinValue, network, nodeID)
+		return cli.report(res, err)
+	}
+
+	// Execute the command createrawtransaction if it was parsed
+	if createRawCmd.Parsed() {
+		var recipients []blockchain.Recipient
+		if *createRawCmdOutputs != "" {
+			var err error
+			recipients, err = parseOutputs(*createRawCmdOutputs, network)
+			if err != nil {
+				fmt.Println(err)
+				return errors.ErrCommandFailed
+			}
+		} else if *createRawCmdTo != "" && *createRawCmdAmount > 0 {
+			recipient, err := newRecipient(*createRawCmdTo, *createRawCmdAmount, network)
+			if err != nil {
+				fmt.Println(err)
+				return errors.ErrCommandFailed
+			}
+			recipients = []blockchain.Recipient{recipient}
+		}
+
+		if *createRawCmdFrom == "" || len(recipients) == 0 || *createRawCmdFee < 0 {
+			createRawCmd.Usage()
+			fmt.Println("Invalid address or amount")
+			return errors.ErrCommandFailed
+		}
+		res, err := createRawTransaction(*createRawCmdFrom, recipients, *createRawCmdFee, *createRawCmdPubKey, *createRawCmdCoins, network, nodeID)
+		return cli.report(res, err)
+	}
+
+	// Execute the command signrawtransaction if it was parsed
+	if signRawCmd.Parsed() {
+		if *signRawCmdHex == "" {
+			signRawCmd.Usage()
+			return errors.ErrCommandFailed
+		}
+		res, err := signRawTransaction(*signRawCmdHex, *signRawCmdChainID, network, nodeID)
+		return cli.report(res, err)
+	}
+
+	// Execute the command sendrawtransaction if it was parsed
+	if sendRawCmd.Parsed() {
+		if *sendRawCmdHex == "" {
+			sendRawCmd.Usage()
+			return errors.ErrCommandFailed
+		}
+		res, err := sendRawTransaction(*sendRawCmdHex, nodeID, client)
+		return cli.report(res, err)
+	}
+
+	// Execute the command createmultisig if it was parsed
+	if createMultisigCmd.Parsed() {
+		if *createMultisigCmdRequired <= 0 || *createMultisigCmdAddresses == "" {
+			createMultisigCmd.Usage()
+			return errors.ErrCommandFailed
+		}
+		res, err := createMultisig(*createMultisigCmdRequired, *createMultisigCmdAddresses, network)
+		return cli.report(res, err)
+	}
+
+	// Execute the command restore if it was parsed
+	if restoreCmd.Parsed() {
+		if *restoreCmdMnemonic != "" {
+			res, err := restoreFromMnemonic(*restoreCmdMnemonic, *restoreCmdPassphrase, network, nodeID)
+			return cli.report(res, err)
+		} else if *restoreCmdSeed != "" {
+			res, err := restoreWallets(*restoreCmdSeed, network, nodeID)
+			return cli.report(res, err)
+		} else {
+			restoreCmd.Usage()
+			return errors.ErrCommandFailed
+		}
+	}
+
+	// Execute the command update if it was parsed
+	if updateCmd.Parsed() {
+		if *updateCmdUTXO {
+			res, err := updateUTXO(*updateCmdWorkers, nodeID)
+			return cli.report(res, err)
+		} else {
+			updateCmd.Usage()
+			return errors.ErrCommandFailed
+		}
+	}
+
+	// Execute the command reindex if it was parsed
+	if reindexCmd.Parsed() {
+		if *reindexCmdTx {
+			res, err := reindexTransactions(nodeID)
+			return cli.report(res, err)
+		} else {
+			reindexCmd.Usage()
+			return errors.ErrCommandFailed
+		}
+	}
+
+	// Execute the command rescan if it was parsed
+	if rescanCmd.Parsed() {
+		res, err := rescanWallet(*rescanCmdFrom, network, nodeID)
+		return cli.report(res, err)
+	}
+
+	// Execute the command backup if it was parsed
+	if backupCmd.Parsed() {
+		if *backupCmdOut == "" || *backupCmdRPCPort < 0 {
+			backupCmd.Usage()
+			return errors.ErrCommandFailed
+		}
+		res, err := backupChain(*backupCmdOut, *backupCmdRPCPort, *backupCmdRPCToken, nodeID)
+		return cli.report(res, err)
+	}
+
+	// Execute the command restorechain if it was parsed
+	if restoreChainCmd.Parsed() {
+		if *restoreChainCmdIn == "" {
+			restoreChainCmd.Usage()
+			return errors.ErrCommandFailed
+		}
+		res, err := restoreChain(*restoreChainCmdIn, nodeID)
+		return cli.report(res, err)
+	}
+
+	// Execute the command exportchain if it was parsed
+	if exportChainCmd.Parsed() {
+		if *exportChainCmdOut == "" {
+			exportChainCmd.Usage()
+			return errors.ErrCommandFailed
+		}
+		res, err := exportChain(*exportChainCmdOut, nodeID)
+		return cli.report(res, err)
+	}
+
+	// Execute the command importchain if it was parsed
+	if importChainCmd.Parsed() {
+		if *importChainCmdIn == "" {
+			importChainCmd.Usage()
+			return errors.ErrCommandFailed
+		}
+		res, err := importChain(*importChainCmdIn, *importChainCmdForce, nodeID)
+		return cli.report(res, err)
+	}
+
+	// Execute the command start if it was parsed
+	if startCmd.Parsed() {
+		logLevel, err := logger.ParseLevel(*startCmdLogLevel)
+		seeds := strings.Split(*startCmdSeeds, ",")
+		if err != nil || *startCmdMempool < 0 || *startCmdTimeout <= 0 || *startCmdRPCPort < 0 || *startCmdSeeds == "" {
+			startCmd.Usage()
+			return errors.ErrCommandFailed
+		}
+		timeout := time.Duration(*startCmdTimeout) * time.Second
+		var rpcAddr string
+		if *startCmdRPCPort > 0 {
+			rpcAddr = strconv.Itoa(*startCmdRPCPort)
+		}
+		settings.MinerAddress = *startCmdNode
+		settings.ListenAddr = *startCmdListen
+		settings.Seeds = seeds
+		settings.RPCToken = *startCmdRPCToken
+		err = startNode(ctx, settings, *startCmdAllowlist, *startCmdPprof, *startCmdNetwork, rpcAddr, *startCmdMempool, timeout, logLevel)
+		return cli.report(nil, err)
+	}
+
+	// Execute the command shell if it was parsed
+	if shellCmd.Parsed() {
+		err := cli.runShell(ctx, settings)
+		return cli.report(nil, err)
+	}
+
+	// Execute the command mempool if it was parsed
+	if mempoolCmd.Parsed() {
+		if *mempoolCmdTx != "" {
+			res, err := showMempoolTx(*mempoolCmdTx, client)
+			return cli.report(res, err)
+		} else {
+			res, err := showMempool(client)
+			return cli.report(res, err)
+		}
+	}
+
+	// Execute the command peers if it was parsed
+	if peersCmd.Parsed() {
+		res, err := showPeers(client)
+		return cli.report(res, err)
+	}
+
+	// Execute the command debug profile if it was parsed
+	if debugProfileCmd.Parsed() {
+		res, err := fetchProfile(*debugProfileCmdAddr, *debugProfileCmdSeconds, *debugProfileCmdOut)
+		return cli.report(res, err)
+	}
+
+	// Execute the command generate if it was parsed
+	if generateCmd.Parsed() {
+		if *generateCmdAddress == "" || *generateCmdBlocks <= 0 || *generateCmdRPCPort < 0 {
+			generateCmd.Usage()
+			fmt.Println("Invalid address or number of blocks")
+			return errors.ErrCommandFailed
+		}
+		res, err := generateBlocks(*generateCmdBlocks, *generateCmdAddress, network, nodeID, *generateCmdRPCPort, *generateCmdRPCToken, *generateCmdForce)
+		return cli.report(res, err)
+	}
+
+	// Execute the command verify if it was parsed
+	if verifyCmd.Parsed() {
+		res, err := verifyChain(*verifyCmdLevel, nodeID)
+		if err := cli.report(res, err); err != nil {
+			return err
+		}
+		if !res.Consistent {
+			return cli.report(nil, errors.ErrSupplyMismatch)
+		}
+	}
+
+	// Execute the command validate if it was parsed
+	if validateCmd.Parsed() {
+		res, err := validateChain(nodeID)
+		return cli.report(res, err)
+	}
+
+	// Execute the command utxostats if it was parsed
+	if utxoStatsCmd.Parsed() {
+		res, err := showUTXOStats(nodeID)
+		return cli.report(res, err)
+	}
+
+	// Execute the command addcheckpoint if it was parsed
+	if addCheckpointCmd.Parsed() {
+		if *addCheckpointCmdHeight < 0 {
+			addCheckpointCmd.Usage()
+			return errors.ErrCommandFailed
+		}
+		res, err := addCheckpoint(*addCheckpointCmdHeight, *addCheckpointCmdHash, nodeID)
+		return cli.report(res, err)
+	}
+
+	// Execute the command address qr if it was parsed
+	if addressQRCmd.Parsed() {
+		if *addressQRCmdAddress == "" {
+			addressQRCmd.Usage()
+			return errors.ErrCommandFailed
+		}
+		res, err := showAddressQR(*addressQRCmdAddress, *addressQRCmdAmount, *addressQRCmdLabel, *addressQRCmdOut, network)
+		return cli.report(res, err)
+	}
+
+	// Execute the command parseuri if it was parsed
+	if parseURICmd.Parsed() {
+		if *parseURICmdURI == "" {
+			parseURICmd.Usage()
+			return errors.ErrCommandFailed
+		}
+		res, err := parseURI(*parseURICmdURI, network)
+		return cli.report(res, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,477 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yanglinshu/glock/internal/blockchain"
+	"github.com/yanglinshu/glock/internal/config"
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/server"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// testNodeID is the node whose files the tests create in a temporary data directory
+const testNodeID = "3000"
+
+// newTestChain creates a wallet and a blockchain paying it in a temporary data directory, and
+// returns the address of the wallet and the hash of the genesis block
+func newTestChain(t *testing.T) (string, string) {
+	t.Helper()
+
+	err := config.SetDataDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wallet, err := createWallet(false, "", transaction.Mainnet, testNodeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params := blockchain.GenesisConfig{Network: server.DefaultNetwork, TargetBits: 8, Timestamp: 1700000000}
+	chain, err := createBlockchain(wallet.Address, params, blockchain.Config{RetargetInterval: -1}, testNodeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return wallet.Address, chain.Genesis
+}
+
+// capture runs f and returns what it wrote on the standard output and the standard error
+func capture(t *testing.T, f func()) ([]byte, []byte) {
+	t.Helper()
+
+	read := func(target **os.File) (func() []byte, error) {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return nil, err
+		}
+
+		saved := *target
+		*target = w
+
+		done := make(chan []byte)
+		go func() {
+			data, _ := io.ReadAll(r)
+			done <- data
+		}()
+
+		return func() []byte {
+			*target = saved
+			w.Close()
+			data := <-done
+			r.Close()
+			return data
+		}, nil
+	}
+
+	stdout, err := read(&os.Stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr, err := read(&os.Stderr)
+	if err != nil {
+		stdout()
+		t.Fatal(err)
+	}
+
+	f()
+
+	return stdout(), stderr()
+}
+
+func TestCommandsReturnTypedResults(t *testing.T) {
+	address, genesis := newTestChain(t)
+
+	if hash, err := hex.DecodeString(genesis); err != nil || len(hash) != 32 {
+		t.Fatalf("genesis = %q, want a hash in hex", genesis)
+	}
+
+	// The same block by hash and by height
+	byHeight, err := getBlock("", 0, transaction.Mainnet, testNodeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byHash, err := getBlock(genesis, 0, transaction.Mainnet, testNodeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if byHeight.Hash != genesis || byHash.Hash != genesis {
+		t.Fatalf("block at height 0 = %s, block %s = %s, want the genesis block", byHeight.Hash, genesis, byHash.Hash)
+	}
+
+	if !byHeight.PoW || byHeight.Height != 0 || byHeight.Bits != 8 || len(byHeight.Transactions) != 1 {
+		t.Fatalf("genesis block = %+v", byHeight.blockJSON)
+	}
+
+	created, err := time.Parse(time.RFC3339, byHeight.Time)
+	if err != nil || created.Unix() != 1700000000 {
+		t.Fatalf("time of the genesis block = %q, want 1700000000 in RFC 3339", byHeight.Time)
+	}
+
+	chain, err := showBlockchain(transaction.Mainnet, testNodeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(chain.Blocks) != 1 || chain.Blocks[0].Hash != genesis {
+		t.Fatalf("blockchain = %+v, want the genesis block alone", chain.Blocks)
+	}
+
+	balance, err := getBalance(address, 1, transaction.Mainnet, testNodeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if balance.Address != address || balance.Balance <= 0 || balance.Pending != 0 {
+		t.Fatalf("balance = %+v, want the confirmed genesis reward", balance)
+	}
+
+	// Invalid arguments are returned as errors, not printed
+	_, err = getBlock("zz", 0, transaction.Mainnet, testNodeID)
+	if !errors.Is(err, errors.ErrInvalidHash) {
+		t.Fatalf("getBlock of an invalid hash = %v, want ErrInvalidHash", err)
+	}
+
+	_, err = getBalance("notanaddress", 1, transaction.Mainnet, testNodeID)
+	if err == nil {
+		t.Fatal("getBalance of an invalid address succeeded")
+	}
+}
+
+func TestReportPrintsJSON(t *testing.T) {
+	address, genesis := newTestChain(t)
+
+	bl, err := getBlock("", 0, transaction.Mainnet, testNodeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	balance, err := getBalance(address, 1, transaction.Mainnet, testNodeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cli := &CLI{json: true}
+
+	stdout, stderr := capture(t, func() { cli.report(bl, nil) })
+	if len(stderr) != 0 {
+		t.Fatalf("report of a block wrote %q on the standard error", stderr)
+	}
+
+	var decodedBlock map[string]interface{}
+	err = json.Unmarshal(stdout, &decodedBlock)
+	if err != nil {
+		t.Fatalf("report of a block printed %q, not JSON: %v", stdout, err)
+	}
+
+	for field, want := range map[string]interface{}{
+		"hash":   genesis,
+		"height": 0.0,
+		"time":   "2023-11-14T22:13:20Z",
+		"bits":   8.0,
+		"pow":    true,
+	} {
+		if decodedBlock[field] != want {
+			t.Fatalf("field %q of the block = %v, want %v", field, decodedBlock[field], want)
+		}
+	}
+
+	if txs, ok := decodedBlock["transactions"].([]interface{}); !ok || len(txs) != 1 {
+		t.Fatalf("transactions of the block = %v, want the coinbase", decodedBlock["transactions"])
+	}
+
+	stdout, _ = capture(t, func() { cli.report(balance, nil) })
+
+	var decodedBalance balanceResult
+	err = json.Unmarshal(stdout, &decodedBalance)
+	if err != nil {
+		t.Fatalf("report of a balance printed %q, not JSON: %v", stdout, err)
+	}
+
+	if decodedBalance != *balance {
+		t.Fatalf("balance read back = %+v, want %+v", decodedBalance, *balance)
+	}
+
+	// An error goes to the standard error as an object, and fails the command
+	stdout, stderr = capture(t, func() { err = cli.report(nil, errors.ErrInvalidHash) })
+	if err != errors.ErrCommandFailed {
+		t.Fatalf("report of an error returned %v, want %v", err, errors.ErrCommandFailed)
+	}
+	if len(stdout) != 0 {
+		t.Fatalf("report of an error wrote %q on the standard output", stdout)
+	}
+
+	var decodedError map[string]string
+	err = json.Unmarshal(stderr, &decodedError)
+	if err != nil || decodedError["error"] != errors.ErrInvalidHash.Error() {
+		t.Fatalf("report of an error printed %q, want {\"error\": %q}", stderr, errors.ErrInvalidHash.Error())
+	}
+}
+
+func TestReportPrintsText(t *testing.T) {
+	cli := &CLI{}
+
+	var err error
+	stdout, _ := capture(t, func() { err = cli.report(&messageResult{Message: "Done!"}, nil) })
+	if err != nil {
+		t.Fatalf("report of a message returned %v", err)
+	}
+	if !bytes.Equal(stdout, []byte("Done!\n")) {
+		t.Fatalf("report of a message printed %q, want the message", stdout)
+	}
+
+	stdout, _ = capture(t, func() { err = cli.report(nil, errors.ErrInvalidHash) })
+	if err != errors.ErrCommandFailed {
+		t.Fatalf("report of an error returned %v, want %v", err, errors.ErrCommandFailed)
+	}
+	if !bytes.Equal(stdout, []byte(errors.ErrInvalidHash.Error()+"\n")) {
+		t.Fatalf("report of an error printed %q, want the error", stdout)
+	}
+}
+
+func TestShellCommandFailureReturnsToPrompt(t *testing.T) {
+	cli := &CLI{interactive: true}
+	settings := config.Config{NodeID: testNodeID, Network: "mainnet"}
+
+	for _, args := range [][]string{
+		{"get"},
+		{"get", "-unknown"},
+		{"unknown"},
+	} {
+		var err error
+		capture(t, func() { err = cli.runCommand(context.Background(), settings, args) })
+		if err != errors.ErrCommandFailed {
+			t.Fatalf("runCommand(%q) = %v, want %v", args, err, errors.ErrCommandFailed)
+		}
+	}
+}
+
+func TestISOTime(t *testing.T) {
+	for timestamp, want := range map[int64]string{
+		0:          "1970-01-01T00:00:00Z",
+		1700000000: "2023-11-14T22:13:20Z",
+	} {
+		if got := isoTime(timestamp); got != want {
+			t.Fatalf("isoTime(%d) = %q, want %q", timestamp, got, want)
+		}
+	}
+}
+
+func TestCreateWalletKeepsCorruptFile(t *testing.T) {
+	err := config.SetDataDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = createWallet(false, "", transaction.Mainnet, testNodeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	walletFile := config.Path("wallet_" + testNodeID + ".dat")
+	content, err := os.ReadFile(walletFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Neither a truncated file nor garbage is replaced by a new wallet
+	for _, corrupt := range [][]byte{content[:len(content)/2], bytes.Repeat([]byte{0xff}, 100)} {
+		err = os.WriteFile(walletFile, corrupt, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = createWallet(false, "", transaction.Mainnet, testNodeID)
+		if !errors.Is(err, errors.ErrWalletFileCorrupt) {
+			t.Fatalf("createWallet over a corrupt wallet file = %v, want ErrWalletFileCorrupt", err)
+		}
+
+		kept, err := os.ReadFile(walletFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(kept, corrupt) {
+			t.Fatal("createWallet overwrote a corrupt wallet file")
+		}
+	}
+}
+
+func TestSendFromAddressMissingFromWallet(t *testing.T) {
+	address, _ := newTestChain(t)
+
+	to, err := transaction.ParseAddress(address, transaction.Mainnet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := &transaction.Wallets{Wallets: make(map[string]*transaction.Wallet), Network: transaction.Mainnet}
+	from, err := other.CreateWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recipients := []blockchain.Recipient{{Address: to, Amount: 1}}
+	_, err = sendTransaction(from, recipients, 0, "", "", "first-fit", transaction.Mainnet, testNodeID, nil, true)
+	if err == nil {
+		t.Fatal("sending from an address missing from the wallet succeeded")
+	}
+
+	want := "address " + from + " is not in your wallet"
+	if !strings.Contains(err.Error(), want) {
+		t.Fatalf("sending from an address missing from the wallet = %q, want %q", err, want)
+	}
+}
+
+func TestMainnetNodeRejectsTestnetAddress(t *testing.T) {
+	address, _ := newTestChain(t)
+
+	// A wallet of another node, created on testnet
+	testnet, err := createWallet(false, "", transaction.Testnet, "3001")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = getBalance(testnet.Address, 1, transaction.Mainnet, testNodeID)
+	if !errors.Is(err, errors.ErrInvalidAddress) {
+		t.Fatalf("balance of a testnet address on mainnet = %v, want ErrInvalidAddress", err)
+	}
+
+	params := blockchain.GenesisConfig{Network: "mainnet", TargetBits: 8, Timestamp: 1700000000}
+	_, err = createBlockchain(testnet.Address, params, blockchain.Config{RetargetInterval: -1}, "3001")
+	if !errors.Is(err, errors.ErrInvalidAddress) {
+		t.Fatalf("creating a mainnet chain paying a testnet address = %v, want ErrInvalidAddress", err)
+	}
+
+	if _, err = getBalance(address, 1, transaction.Mainnet, testNodeID); err != nil {
+		t.Fatalf("balance of a mainnet address on mainnet: %v", err)
+	}
+}
+
+func TestSendMineRejectsInvalidSignature(t *testing.T) {
+	address, _ := newTestChain(t)
+
+	wallets, err := transaction.NewWallets(testNodeID, transaction.Mainnet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wallet, err := wallets.GetWallet(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bc, err := openBlockchain(testNodeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeBlockchain(bc)
+
+	// A payment to an address of another wallet
+	other := &transaction.Wallets{Wallets: make(map[string]*transaction.Wallet), Network: transaction.Mainnet}
+	otherAddress, err := other.CreateWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	to, err := transaction.ParseAddress(otherAddress, transaction.Mainnet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := blockchain.NewUTXOTransaction(wallet, to, 4, 1, nil, nil, &blockchain.UTXOSet{Blockchain: bc})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signature := tx.Vin[0].Signature
+	tx.Vin[0].Signature = append([]byte{}, signature...)
+	tx.Vin[0].Signature[len(signature)-1] ^= 0xff
+
+	// The transaction is refused before a block is mined, naming the input at fault
+	_, err = submitTransaction(bc, tx, address, transaction.Mainnet, nil, true)
+	if !errors.Is(err, errors.ErrInvalidSignature) {
+		t.Fatalf("send -mine of a transaction with an invalid signature = %v, want ErrInvalidSignature", err)
+	}
+
+	if !strings.Contains(err.Error(), "input 0") || !strings.Contains(err.Error(), hex.EncodeToString(tx.ID)) {
+		t.Fatalf("error %q does not name the transaction and its input", err)
+	}
+
+	if height, err := bc.GetBestHeight(); err != nil || height != 0 {
+		t.Fatalf("height after a refused send -mine = %d, %v, want 0", height, err)
+	}
+
+	// Once signed, it is mined in a block the result names
+	tx.Vin[0].Signature = signature
+
+	res, err := submitTransaction(bc, tx, address, transaction.Mainnet, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.TxID != hex.EncodeToString(tx.ID) {
+		t.Fatalf("send -mine returned transaction %s, want %x", res.TxID, tx.ID)
+	}
+
+	location, err := bc.LocateTransaction(tx.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hex.EncodeToString(location.BlockHash) != res.Block {
+		t.Fatalf("transaction mined in %x, send -mine returned block %s", location.BlockHash, res.Block)
+	}
+}
+
+func TestAddCheckpoint(t *testing.T) {
+	_, genesis := newTestChain(t)
+
+	// Without a hash, the main chain block at the height is pinned
+	res, err := addCheckpoint(0, "", testNodeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(res.Message, genesis) {
+		t.Fatalf("addcheckpoint message %q does not name the genesis block %s", res.Message, genesis)
+	}
+
+	other := strings.Repeat("00", len(genesis)/2)
+	for hashHex, want := range map[string]error{
+		genesis: nil,
+		other:   errors.ErrCheckpointMismatch,
+		"zz":    errors.ErrInvalidHash,
+	} {
+		_, err := addCheckpoint(0, hashHex, testNodeID)
+		if !errors.Is(err, want) {
+			t.Fatalf("addcheckpoint -height 0 -hash %s = %v, want %v", hashHex, err, want)
+		}
+	}
+
+	_, err = addCheckpoint(1, "", testNodeID)
+	if !errors.Is(err, errors.ErrBlockNotFound) {
+		t.Fatalf("addcheckpoint above the tip without a hash = %v, want ErrBlockNotFound", err)
+	}
+
+	bc, err := openBlockchain(testNodeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeBlockchain(bc)
+
+	checkpoints := bc.Checkpoints()
+	if len(checkpoints) != 1 || checkpoints[0].Height != 0 || hex.EncodeToString(checkpoints[0].Hash) != genesis {
+		t.Fatalf("checkpoints = %+v, want the genesis block alone", checkpoints)
+	}
+}
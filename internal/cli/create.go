@@ -1,43 +1,111 @@
-package cli
-
-import (
-	"fmt"
-
-	"github.com/yanglinshu/glock/internal/blockchain"
-	"github.com/yanglinshu/glock/internal/errors"
-	"github.com/yanglinshu/glock/internal/transaction"
-)
-
-// createBlockchain creates a new blockchain
-func createBlockchain(address, nodeID string) error {
-	if !transaction.ValidateAddress(address) {
-		return errors.ErrInvalidAddress
-	}
-
-	bc, err := blockchain.CreateBlockchain(address, nodeID)
-	if err != nil {
-		return err
-	}
-	defer bc.CloseDB()
-
-	UTXOSet := blockchain.UTXOSet{Blockchain: bc}
-	UTXOSet.Reindex()
-
-	fmt.Println("Done!")
-	return nil
-}
-
-// createWallet creates a new wallet
-func createWallet(nodeID string) error {
-	wallets, _ := transaction.NewWallets(nodeID)
-
-	address, err := wallets.CreateWallet()
-	if err != nil {
-		return err
-	}
-
-	wallets.SaveToFile(nodeID)
-
-	fmt.Printf("Your new address: %s\n", address)
-	return nil
-}
+package cli
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/yanglinshu/glock/internal/blockchain"
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// createChainResult is the result of create -blockchain
+type createChainResult struct {
+	Genesis string `json:"genesis"` // the hash of the genesis block in hex
+}
+
+// printText prints the hash of the genesis block.
+func (r *createChainResult) printText() {
+	fmt.Println(r.Genesis)
+	fmt.Println("Done!")
+}
+
+// createBlockchain creates a new blockchain of a network with the given parameters
+func createBlockchain(address string, params blockchain.GenesisConfig, config blockchain.Config, nodeID string) (*createChainResult, error) {
+	network, err := transaction.NetworkByName(params.Network)
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := transaction.ParseAddress(address, network)
+	if err != nil {
+		return nil, errors.ErrInvalidAddress
+	}
+
+	bc, err := blockchain.CreateBlockchain(to, nodeID, params, config)
+	if err != nil {
+		return nil, err
+	}
+	defer bc.CloseDB()
+
+	return &createChainResult{Genesis: hex.EncodeToString(bc.Tip())}, nil
+}
+
+// mnemonicBits is the entropy of the mnemonic phrases generated for new wallets, 12 words
+const mnemonicBits = 128
+
+// walletResult is the result of create -wallet
+type walletResult struct {
+	Address  string `json:"address"`            // the new address
+	Seed     string `json:"seed,omitempty"`     // the seed in hex, when it was first generated
+	Mnemonic string `json:"mnemonic,omitempty"` // the mnemonic phrase, when one was generated
+}
+
+// printText prints the new address, after the seed or the mnemonic phrase if generated.
+func (r *walletResult) printText() {
+	if r.Mnemonic != "" {
+		fmt.Printf("Your mnemonic phrase, keep it safe: %s\n", r.Mnemonic)
+	} else if r.Seed != "" {
+		fmt.Printf("Your wallet seed, keep it safe: %s\n", r.Seed)
+	}
+
+	fmt.Printf("Your new address: %s\n", r.Address)
+}
+
+// createWallet creates a new wallet. The seed is returned when it is first generated, it is all that
+// is needed to restore the addresses derived from it. With useMnemonic, the seed is derived from a
+// new mnemonic phrase and the passphrase, and the phrase is returned instead.
+func createWallet(useMnemonic bool, passphrase string, network transaction.Network, nodeID string) (*walletResult, error) {
+	// Only a missing wallet file starts a new wallet, one that cannot be read is never overwritten
+	wallets, err := transaction.NewWallets(nodeID, network)
+	if errors.Is(err, errors.ErrWalletFileNotFound) {
+		wallets = &transaction.Wallets{Wallets: make(map[string]*transaction.Wallet), Network: network}
+	} else if err != nil {
+		return nil, err
+	}
+	newSeed := len(wallets.Seed) == 0
+
+	var mnemonic string
+	if useMnemonic {
+		if !newSeed {
+			return nil, errors.ErrWalletExists
+		}
+
+		mnemonic, err = transaction.NewMnemonic(mnemonicBits)
+		if err != nil {
+			return nil, err
+		}
+
+		wallets.Seed, err = transaction.SeedFromMnemonic(mnemonic, passphrase)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	address, err := wallets.CreateWallet()
+	if err != nil {
+		return nil, err
+	}
+
+	err = wallets.SaveToFile(nodeID)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &walletResult{Address: address, Mnemonic: mnemonic}
+	if mnemonic == "" && newSeed {
+		res.Seed = hex.EncodeToString(wallets.Seed)
+	}
+
+	return res, nil
+}
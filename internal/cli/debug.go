@@ -0,0 +1,38 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+// fetchProfile fetches a CPU profile covering the given number of seconds from the debug listener
+// of a running node and writes it to out
+func fetchProfile(addr string, seconds int, out string) (*messageResult, error) {
+	url := fmt.Sprintf("http://%s/debug/pprof/profile?seconds=%d", addr, seconds)
+	fmt.Fprintf(os.Stderr, "Profiling %s for %d seconds\n", addr, seconds)
+
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("debug server replied %s", resp.Status)
+	}
+
+	file, err := os.Create(out)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &messageResult{Message: fmt.Sprintf("CPU profile written to %s", out)}, nil
+}
@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/yanglinshu/glock/internal/blockchain"
+)
+
+// exportResult is the result of exportchain
+type exportResult struct {
+	Blocks int    `json:"blocks"` // the number of blocks written
+	Out    string `json:"out"`    // the block file
+}
+
+// printText prints the number of blocks written.
+func (r *exportResult) printText() {
+	fmt.Printf("Exported %d blocks to %s\n", r.Blocks, r.Out)
+}
+
+// importResult is the result of importchain
+type importResult struct {
+	Imported int `json:"imported"` // the number of blocks added
+}
+
+// printText prints the number of blocks added.
+func (r *importResult) printText() {
+	fmt.Printf("Imported %d blocks\n", r.Imported)
+}
+
+// exportChain writes the main chain to the out file as a block file
+func exportChain(out, nodeID string) (*exportResult, error) {
+	bc, err := openBlockchain(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBlockchain(bc)
+
+	f, err := os.OpenFile(out, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := bc.ExportChain(f)
+	if err != nil {
+		f.Close()
+		os.Remove(out)
+		return nil, err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return &exportResult{Blocks: count, Out: out}, nil
+}
+
+// importChain replays the blocks of the block file in the in file into the blockchain database. If
+// force is set, a database holding another chain is replaced.
+func importChain(in string, force bool, nodeID string) (*importResult, error) {
+	f, err := os.Open(in)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	count, err := blockchain.ImportChain(f, nodeID, force)
+	if err != nil {
+		return nil, err
+	}
+
+	return &importResult{Imported: count}, nil
+}
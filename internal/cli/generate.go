@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/server"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// generateResult is the result of generate
+type generateResult struct {
+	Blocks []string `json:"blocks"` // the hashes of the blocks mined in hex, in order
+}
+
+// printText prints the hash of every block mined.
+func (r *generateResult) printText() {
+	for _, hash := range r.Blocks {
+		fmt.Println(hash)
+	}
+}
+
+// generateBlocks mines blocks on demand, paying the rewards to address. If rpcPort is not 0 and a
+// node serves RPC on it, the node mines them with its mempool, never past the difficulty limit;
+// otherwise they are mined directly on the database, past the limit if force is set.
+func generateBlocks(blocks int, address string, network transaction.Network, nodeID string, rpcPort int, rpcToken string, force bool) (*generateResult, error) {
+	to, err := transaction.ParseAddress(address, network)
+	if err != nil {
+		return nil, errors.ErrInvalidAddress
+	}
+
+	var hashes [][]byte
+	err = errors.ErrNodeNotRunning
+	if rpcPort != 0 {
+		hashes, err = server.RequestGenerate(rpcPort, rpcToken, blocks, to.String())
+	}
+	if errors.Is(err, errors.ErrNodeNotRunning) {
+		hashes, err = generateBlocksOffline(blocks, to, nodeID, force)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res := &generateResult{Blocks: []string{}}
+	for _, hash := range hashes {
+		res.Blocks = append(res.Blocks, hex.EncodeToString(hash))
+	}
+
+	return res, nil
+}
+
+// generateBlocksOffline mines blocks directly on the database of a stopped node
+func generateBlocksOffline(blocks int, address transaction.Address, nodeID string, force bool) ([][]byte, error) {
+	bc, err := openBlockchain(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBlockchain(bc)
+
+	newBlocks, err := bc.GenerateBlocks(blocks, address, nil, force)
+	if err != nil {
+		return nil, err
+	}
+
+	var hashes [][]byte
+	for _, b := range newBlocks {
+		hashes = append(hashes, b.Hash)
+	}
+
+	return hashes, nil
+}
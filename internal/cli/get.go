@@ -1,40 +1,84 @@
-package cli
-
-import (
-	"fmt"
-
-	"github.com/yanglinshu/glock/internal/blockchain"
-	"github.com/yanglinshu/glock/internal/errors"
-	"github.com/yanglinshu/glock/internal/transaction"
-	"github.com/yanglinshu/glock/internal/util"
-)
-
-// getBalance gets the balance of an address
-func getBalance(address, nodeID string) error {
-	if !transaction.ValidateAddress(address) {
-		return errors.ErrInvalidAddress
-	}
-
-	bc, err := blockchain.NewBlockchain(nodeID)
-	if err != nil {
-		return err
-	}
-	defer bc.CloseDB()
-
-	UTXOSet := blockchain.UTXOSet{Blockchain: bc}
-
-	balance := 0
-	publicKeyHash := util.Base58Decode([]byte(address))
-	publicKeyHash = publicKeyHash[1 : len(publicKeyHash)-4]
-	UTXOs, err := UTXOSet.FindUTXO(publicKeyHash)
-	if err != nil {
-		return err
-	}
-
-	for _, out := range UTXOs {
-		balance += out.Value
-	}
-
-	fmt.Printf("Balance of '%s': %d\n", address, balance)
-	return nil
-}
+package cli
+
+import (
+	"fmt"
+
+	"github.com/yanglinshu/glock/internal/blockchain"
+	"github.com/yanglinshu/glock/internal/server"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// balanceResult is the result of get -balance
+type balanceResult struct {
+	Address string `json:"address"` // the address
+	Balance int    `json:"balance"` // the value of the outputs with enough confirmations
+	Pending int    `json:"pending"` // the value of the younger outputs
+}
+
+// printText prints the confirmed and pending balances.
+func (r *balanceResult) printText() {
+	fmt.Printf("Balance of '%s': %d\n", r.Address, r.Balance)
+	fmt.Printf("Pending: %d\n", r.Pending)
+}
+
+// getBalance gets the balance of an address, counting as confirmed the outputs with at least minConf
+// confirmations
+func getBalance(address string, minConf int, network transaction.Network, nodeID string) (*balanceResult, error) {
+	parsed, err := transaction.ParseAddress(address, network)
+	if err != nil {
+		return nil, err
+	}
+	publicKeyHash := parsed.PubKeyHash()
+
+	bc, err := openBlockchain(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBlockchain(bc)
+
+	UTXOSet := blockchain.UTXOSet{Blockchain: bc}
+
+	confirmed, pending, err := UTXOSet.GetBalances(publicKeyHash, minConf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &balanceResult{Address: address, Balance: confirmed, Pending: pending}, nil
+}
+
+// walletBalanceResult is the result of balance
+type walletBalanceResult struct {
+	server.WalletBalanceResult
+}
+
+// printText prints the balance of every address, then the total.
+func (r *walletBalanceResult) printText() {
+	for _, b := range r.Addresses {
+		fmt.Printf("%s  balance: %d  pending: %d\n", b.Address, b.Confirmed, b.Pending)
+	}
+	fmt.Printf("Total balance: %d\n", r.Confirmed)
+	fmt.Printf("Pending: %d\n", r.Pending)
+}
+
+// getWalletBalance gets the balance of every address of the wallet file and their total, counting
+// as confirmed the outputs with at least minConf confirmations
+func getWalletBalance(minConf int, network transaction.Network, nodeID string) (*walletBalanceResult, error) {
+	wallets, err := transaction.NewWallets(nodeID, network)
+	if err != nil {
+		return nil, err
+	}
+
+	bc, err := openBlockchain(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBlockchain(bc)
+
+	UTXOSet := blockchain.UTXOSet{Blockchain: bc}
+	balances, err := UTXOSet.GetWalletBalances(wallets, minConf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &walletBalanceResult{server.WalletBalance(balances)}, nil
+}
@@ -0,0 +1,96 @@
+package cli
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yanglinshu/glock/internal/blockchain"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// historyEntry is a transaction listed by history
+type historyEntry struct {
+	TxID           string   `json:"txid"`           // the ID of the transaction in hex
+	Kind           string   `json:"kind"`           // "received", "sent" or "mined"
+	Amount         int      `json:"amount"`         // the value received, or spent net of the change
+	Counterparties []string `json:"counterparties"` // the addresses paid if sent, paying if received
+	Height         int      `json:"height"`         // the height of the block holding the transaction
+	Time           string   `json:"time"`           // the time that block was created
+
+	timestamp int64 // the same time, printed as text
+}
+
+// historyResult is the result of history
+type historyResult struct {
+	Address      string         `json:"address"`      // the address
+	Transactions []historyEntry `json:"transactions"` // the transactions, the latest first
+}
+
+// printText prints a line per transaction, followed by its counterparties.
+func (r *historyResult) printText() {
+	if len(r.Transactions) == 0 {
+		fmt.Printf("No transactions for '%s'\n", r.Address)
+		return
+	}
+
+	for _, e := range r.Transactions {
+		sign := "+"
+		if e.Kind == blockchain.TxSent {
+			sign = "-"
+		}
+
+		date := time.Unix(e.timestamp, 0).Format("2006-01-02 15:04:05")
+		fmt.Printf("%s  height %-6d %-8s %s%d  %s\n", date, e.Height, e.Kind, sign, e.Amount, e.TxID)
+
+		switch {
+		case len(e.Counterparties) == 0:
+		case e.Kind == blockchain.TxSent:
+			fmt.Printf("    to %s\n", strings.Join(e.Counterparties, ", "))
+		default:
+			fmt.Printf("    from %s\n", strings.Join(e.Counterparties, ", "))
+		}
+	}
+}
+
+// getHistory returns the transactions of the main chain paying or spending coins of an address,
+// the latest first
+func getHistory(address string, network transaction.Network, nodeID string) (*historyResult, error) {
+	parsed, err := transaction.ParseAddress(address, network)
+	if err != nil {
+		return nil, err
+	}
+	pubKeyHash := parsed.PubKeyHash()
+
+	bc, err := openBlockchain(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBlockchain(bc)
+
+	records, err := bc.FindTransactionsForAddress(pubKeyHash)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &historyResult{Address: address, Transactions: []historyEntry{}}
+	for _, r := range records {
+		counterparties := r.Counterparties
+		if counterparties == nil {
+			counterparties = []string{}
+		}
+
+		res.Transactions = append(res.Transactions, historyEntry{
+			TxID:           hex.EncodeToString(r.TxID),
+			Kind:           r.Kind,
+			Amount:         r.Amount,
+			Counterparties: counterparties,
+			Height:         r.Height,
+			Time:           isoTime(r.Timestamp),
+			timestamp:      r.Timestamp,
+		})
+	}
+
+	return res, nil
+}
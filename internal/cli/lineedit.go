@@ -0,0 +1,224 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+)
+
+// lineReader reads the commands typed in the shell
+type lineReader interface {
+	// readLine prints the prompt and reads a line, returning io.EOF at the end of the input
+	readLine(prompt string) (string, error)
+
+	// addHistory records a line so it can be recalled
+	addHistory(line string)
+}
+
+// newLineReader returns a line editor if the input is a terminal, and a plain reader otherwise.
+func newLineReader(in *os.File, out io.Writer, history []string) lineReader {
+	if isTerminal(int(in.Fd())) {
+		return &lineEditor{fd: int(in.Fd()), in: bufio.NewReader(in), out: out, history: history}
+	}
+
+	return &plainReader{scanner: bufio.NewScanner(in), out: out}
+}
+
+// plainReader reads lines from input that is not a terminal, such as a script piped to the shell
+type plainReader struct {
+	scanner *bufio.Scanner // the lines of the input
+	out     io.Writer      // where the prompt is printed
+}
+
+// readLine prints the prompt and reads a line.
+func (r *plainReader) readLine(prompt string) (string, error) {
+	fmt.Fprint(r.out, prompt)
+	if !r.scanner.Scan() {
+		fmt.Fprintln(r.out)
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+
+	return r.scanner.Text(), nil
+}
+
+// addHistory does nothing, the input cannot be edited.
+func (r *plainReader) addHistory(line string) {}
+
+// lineEditor reads lines from a terminal in raw mode. The cursor moves with the left and right
+// arrows, Home, End, Ctrl-A and Ctrl-E, and the up and down arrows browse the history. Ctrl-U
+// clears the line up to the cursor, Ctrl-C discards it and Ctrl-D at an empty line ends the input.
+type lineEditor struct {
+	fd      int           // the descriptor of the terminal
+	in      *bufio.Reader // the keys typed
+	out     io.Writer     // where the line is echoed
+	history []string      // the lines typed, the latest last
+}
+
+// Control keys handled by the line editor
+const (
+	keyCtrlA     = 1
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyBackspace = 8
+	keyCtrlU     = 21
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+// readLine prints the prompt and reads a line, the terminal in raw mode until the line is entered.
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	state, err := makeRaw(e.fd)
+	if err != nil {
+		return "", err
+	}
+	defer restoreTerminal(e.fd, state)
+
+	var line []rune
+	pos := 0
+	index := len(e.history) // the history entry shown, len(e.history) for the line being typed
+	var pending []rune      // the line being typed, while browsing the history
+
+	show := func(entry []rune) {
+		line = append([]rune{}, entry...)
+		pos = len(line)
+	}
+
+	for {
+		fmt.Fprintf(e.out, "\r\x1b[K%s%s", prompt, string(line))
+		if back := len(line) - pos; back > 0 {
+			fmt.Fprintf(e.out, "\x1b[%dD", back)
+		}
+
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\r\n")
+			return string(line), nil
+		case keyCtrlC:
+			fmt.Fprint(e.out, "^C\r\n")
+			line, pos, index = nil, 0, len(e.history)
+		case keyCtrlD:
+			if len(line) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			if pos < len(line) {
+				line = append(line[:pos], line[pos+1:]...)
+			}
+		case keyBackspace, keyDelete:
+			if pos > 0 {
+				line = append(line[:pos-1], line[pos:]...)
+				pos--
+			}
+		case keyCtrlA:
+			pos = 0
+		case keyCtrlE:
+			pos = len(line)
+		case keyCtrlU:
+			line = append([]rune{}, line[pos:]...)
+			pos = 0
+		case keyEscape:
+			key, err := e.readEscape()
+			if err != nil {
+				return "", err
+			}
+
+			switch key {
+			case 'A':
+				if index > 0 {
+					if index == len(e.history) {
+						pending = line
+					}
+					index--
+					show([]rune(e.history[index]))
+				}
+			case 'B':
+				if index < len(e.history) {
+					index++
+					if index == len(e.history) {
+						show(pending)
+					} else {
+						show([]rune(e.history[index]))
+					}
+				}
+			case 'C':
+				if pos < len(line) {
+					pos++
+				}
+			case 'D':
+				if pos > 0 {
+					pos--
+				}
+			case 'H':
+				pos = 0
+			case 'F':
+				pos = len(line)
+			case '3':
+				if pos < len(line) {
+					line = append(line[:pos], line[pos+1:]...)
+				}
+			}
+		default:
+			if r >= ' ' {
+				line = append(line[:pos], append([]rune{r}, line[pos:]...)...)
+				pos++
+			}
+		}
+	}
+}
+
+// readEscape reads the rest of an escape sequence sent by a special key and returns its final
+// character, or '3' for the Delete key. Unknown sequences return 0.
+func (e *lineEditor) readEscape() (rune, error) {
+	r, _, err := e.in.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	if r != '[' && r != 'O' {
+		return 0, nil
+	}
+
+	r, _, err = e.in.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+
+	// Sequences such as Delete end with a tilde after their number
+	if r >= '0' && r <= '9' {
+		for {
+			next, _, err := e.in.ReadRune()
+			if err != nil {
+				return 0, err
+			}
+			if next == '~' {
+				return r, nil
+			}
+			if next < '0' || next > '9' {
+				return 0, nil
+			}
+		}
+	}
+
+	return r, nil
+}
+
+// addHistory records a line, unless it repeats the previous one.
+func (e *lineEditor) addHistory(line string) {
+	if len(e.history) > 0 && e.history[len(e.history)-1] == line {
+		return
+	}
+
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistory {
+		e.history = e.history[1:]
+	}
+}
@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/yanglinshu/glock/internal/blockchain"
+	"github.com/yanglinshu/glock/internal/server"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// unspentResult is the result of listunspent, encoded as by the listunspent RPC method
+type unspentResult []server.UnspentResult
+
+// printText prints a line per output.
+func (r unspentResult) printText() {
+	for _, u := range r {
+		fmt.Printf("%s:%d  value %d  confirmations %d\n", u.TxID, u.Vout, u.Value, u.Confirmations)
+	}
+	fmt.Printf("%d unspent outputs\n", len(r))
+}
+
+// listUnspent returns the unspent outputs of an address worth at least minValue
+func listUnspent(address string, minValue int, network transaction.Network, nodeID string) (unspentResult, error) {
+	parsed, err := transaction.ParseAddress(address, network)
+	if err != nil {
+		return nil, err
+	}
+	pubKeyHash := parsed.PubKeyHash()
+
+	bc, err := openBlockchain(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBlockchain(bc)
+
+	UTXOSet := blockchain.UTXOSet{Blockchain: bc}
+
+	unspent, err := UTXOSet.FindUTXOWithOutpoints(pubKeyHash)
+	if err != nil {
+		return nil, err
+	}
+
+	return server.UnspentResults(unspent, minValue), nil
+}
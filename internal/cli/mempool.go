@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/server"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// mempoolResult is the result of mempool
+type mempoolResult struct {
+	Transactions []server.MempoolEntryResult `json:"transactions"` // the pending transactions, the oldest first
+}
+
+// printText prints a line per pending transaction.
+func (r *mempoolResult) printText() {
+	for _, entry := range r.Transactions {
+		fmt.Printf("%s  size: %d  fee: %d  since: %s\n", entry.TxID, entry.Size, entry.Fee, isoTime(entry.Time))
+	}
+	fmt.Printf("%d transactions pending\n", len(r.Transactions))
+}
+
+// mempoolTxResult is the result of mempool -tx
+type mempoolTxResult struct {
+	server.MempoolEntryResult
+
+	tx *transaction.Transaction // the same transaction, printed as text
+}
+
+// printText prints the description of the transaction, then the transaction.
+func (r *mempoolTxResult) printText() {
+	fmt.Printf("Size: %d\n", r.Size)
+	fmt.Printf("Fee: %d\n", r.Fee)
+	fmt.Printf("Since: %s\n", isoTime(r.Time))
+	fmt.Println(r.tx)
+}
+
+// showMempool returns the transactions pending in the mempool of the running node
+func showMempool(client *server.Client) (*mempoolResult, error) {
+	reply, err := client.RequestMempool(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mempoolResult{Transactions: server.MempoolEntries(reply.Entries)}, nil
+}
+
+// showMempoolTx returns a transaction pending in the mempool of the running node
+func showMempoolTx(txIDHex string, client *server.Client) (*mempoolTxResult, error) {
+	txID, err := hex.DecodeString(txIDHex)
+	if err != nil || len(txID) == 0 {
+		return nil, errors.ErrInvalidHash
+	}
+
+	reply, err := client.RequestMempool(txID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := transaction.DeserializeTransaction(reply.Tx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &mempoolTxResult{MempoolEntryResult: server.MempoolEntries(reply.Entries)[0], tx: &tx}
+	res.Hex = hex.EncodeToString(reply.Tx)
+
+	return res, nil
+}
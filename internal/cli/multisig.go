@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// multisigResult is the result of createmultisig
+type multisigResult struct {
+	Address   string   `json:"address"`   // the multisig address
+	Required  int      `json:"required"`  // the number of signatures needed to spend from it
+	Addresses []string `json:"addresses"` // the addresses whose keys may sign
+}
+
+// printText prints the multisig address.
+func (r *multisigResult) printText() {
+	fmt.Printf("%s (%d-of-%d)\n", r.Address, r.Required, len(r.Addresses))
+}
+
+// createMultisig returns the address of the outputs locked to the keys of the comma-separated
+// addresses, required of which must sign to spend them. Coins are sent to it like to any address,
+// and spent with createrawtransaction -from, then signrawtransaction by the holders of the keys.
+func createMultisig(required int, addresses string, network transaction.Network) (*multisigResult, error) {
+	var pubKeyHashes [][]byte
+	var list []string
+	for _, address := range strings.Split(addresses, ",") {
+		address = strings.TrimSpace(address)
+
+		parsed, err := transaction.ParseAddress(address, network)
+		if err != nil || parsed.IsMultisig() {
+			return nil, errors.Wrapf(errors.ErrInvalidAddress, "address %s", address)
+		}
+
+		pubKeyHashes = append(pubKeyHashes, parsed.PubKeyHash())
+		list = append(list, address)
+	}
+
+	address, err := transaction.MultisigAddress(required, pubKeyHashes, network)
+	if err != nil {
+		return nil, err
+	}
+
+	return &multisigResult{Address: address, Required: required, Addresses: list}, nil
+}
@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/yanglinshu/glock/internal/errors"
+)
+
+// result is what a command returns once it succeeds. It is printed as text, or encoded as JSON on
+// the standard output with the global -json flag, hashes in hex and times in RFC 3339.
+type result interface {
+	// printText prints the result for a human reader
+	printText()
+}
+
+// messageResult is the result of the commands reporting only what they did
+type messageResult struct {
+	Message string `json:"message"` // what the command did
+}
+
+// printText prints the message.
+func (r *messageResult) printText() {
+	fmt.Println(r.Message)
+}
+
+// report prints the result of a command, or its error and returns ErrCommandFailed. With -json,
+// the error is written to the standard error as a JSON object.
+func (cli *CLI) report(res result, err error) error {
+	if err != nil {
+		if cli.json {
+			data, _ := json.Marshal(map[string]string{"error": err.Error()})
+			fmt.Fprintln(os.Stderr, string(data))
+		} else {
+			fmt.Println(err)
+		}
+		return errors.ErrCommandFailed
+	}
+
+	if res == nil {
+		return nil
+	}
+
+	if !cli.json {
+		res.printText()
+		return nil
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(res)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return errors.ErrCommandFailed
+	}
+
+	return nil
+}
+
+// isoTime formats a Unix timestamp in RFC 3339, in UTC.
+func isoTime(timestamp int64) string {
+	return time.Unix(timestamp, 0).UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/yanglinshu/glock/internal/server"
+)
+
+// peerJSON is a peer listed by peers
+type peerJSON struct {
+	Address  string `json:"address"`  // the address of the peer
+	LastSeen string `json:"lastseen"` // the time a message of the peer was last received, empty if never
+	RTT      int64  `json:"rtt"`      // the round-trip time of the last ping in microseconds, 0 if none
+}
+
+// peersResult is the result of peers
+type peersResult struct {
+	Peers []peerJSON `json:"peers"` // the peers of the node
+}
+
+// printText prints a line per peer.
+func (r *peersResult) printText() {
+	for _, peer := range r.Peers {
+		lastSeen := "never"
+		if peer.LastSeen != "" {
+			lastSeen = peer.LastSeen
+		}
+
+		rtt := "unknown"
+		if peer.RTT > 0 {
+			rtt = (time.Duration(peer.RTT) * time.Microsecond).String()
+		}
+
+		fmt.Printf("%s  last seen: %s  rtt: %s\n", peer.Address, lastSeen, rtt)
+	}
+}
+
+// showPeers returns the peers of the running node with when they were last heard from and their
+// round-trip time
+func showPeers(client *server.Client) (*peersResult, error) {
+	peers, err := client.RequestPeers()
+	if err != nil {
+		return nil, err
+	}
+
+	res := &peersResult{Peers: []peerJSON{}}
+	for _, peer := range peers {
+		entry := peerJSON{Address: peer.Address, RTT: peer.RTT.Microseconds()}
+		if !peer.LastSeen.IsZero() {
+			entry.LastSeen = peer.LastSeen.Format(time.RFC3339)
+		}
+
+		res.Peers = append(res.Peers, entry)
+	}
+
+	return res, nil
+}
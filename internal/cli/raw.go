@@ -0,0 +1,209 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/yanglinshu/glock/internal/blockchain"
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/server"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// rawResult is the result of createrawtransaction
+type rawResult struct {
+	Hex string `json:"hex"` // the raw transaction
+}
+
+// printText prints the raw transaction.
+func (r *rawResult) printText() {
+	fmt.Println(r.Hex)
+}
+
+// signResult is the result of signrawtransaction
+type signResult struct {
+	Hex      string `json:"hex"`      // the signed transaction
+	Complete bool   `json:"complete"` // whether the transaction has every signature it needs
+	Missing  int    `json:"missing"`  // the number of signatures other wallets must still add
+}
+
+// printText prints the signed transaction, noting on the standard error if it still needs
+// signatures.
+func (r *signResult) printText() {
+	fmt.Println(r.Hex)
+	if !r.Complete {
+		fmt.Fprintf(os.Stderr, "Partially signed, %d more signatures needed\n", r.Missing)
+	}
+}
+
+// txIDResult is the result of sendrawtransaction
+type txIDResult struct {
+	TxID string `json:"txid"` // the ID of the transaction sent in hex
+}
+
+// printText prints the ID of the transaction.
+func (r *txIDResult) printText() {
+	fmt.Println(r.TxID)
+}
+
+// createRawTransaction returns an unsigned payment from one address to the recipients as a raw
+// transaction. The public key of the payer is given in hex, or else taken from the wallet file or
+// from a transaction of the chain spending coins of the payer. A payment from a multisig address
+// needs no key, its inputs carry the script for the holders of its keys to co-sign.
+func createRawTransaction(from string, recipients []blockchain.Recipient, fee int, pubKeyHex, coins string, network transaction.Network, nodeID string) (*rawResult, error) {
+	if !transaction.ValidateAddress(from, network) {
+		return nil, errors.ErrInvalidAddress
+	}
+
+	selector, err := blockchain.CoinSelectorByName(coins)
+	if err != nil {
+		return nil, err
+	}
+
+	bc, err := openBlockchain(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBlockchain(bc)
+
+	pubKey, err := payerPublicKey(bc, from, pubKeyHex, network, nodeID)
+	if err != nil {
+		return nil, err
+	}
+
+	UTXOSet := blockchain.UTXOSet{Blockchain: bc}
+	tx, err := blockchain.NewUnsignedTransaction(pubKey, recipients, fee, nil, selector, &UTXOSet)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := tx.EncodeRaw()
+	if err != nil {
+		return nil, err
+	}
+
+	return &rawResult{Hex: raw}, nil
+}
+
+// payerPublicKey returns the public key of the address paying a raw transaction, see
+// createRawTransaction
+func payerPublicKey(bc *blockchain.Blockchain, from, pubKeyHex string, network transaction.Network, nodeID string) ([]byte, error) {
+	parsed, err := transaction.ParseAddress(from, network)
+	if err != nil {
+		return nil, err
+	}
+
+	pubKeyHash := parsed.PubKeyHash()
+	if parsed.IsMultisig() {
+		return pubKeyHash, nil
+	}
+
+	var pubKey []byte
+
+	if pubKeyHex != "" {
+		pubKey, err = hex.DecodeString(pubKeyHex)
+		if err != nil {
+			return nil, errors.ErrInvalidPublicKey
+		}
+	} else if wallets, err := transaction.NewWallets(nodeID, network); err == nil && wallets.Wallets[from] != nil {
+		pubKey = wallets.Wallets[from].PublicKey
+	} else {
+		pubKey, err = bc.FindPublicKey(pubKeyHash)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	keyHash, err := transaction.HashPubKey(pubKey)
+	if err != nil || !bytes.Equal(keyHash, pubKeyHash) {
+		return nil, errors.ErrInvalidPublicKey
+	}
+
+	return pubKey, nil
+}
+
+// signRawTransaction signs a raw transaction with the wallet file of the node and returns it. The
+// identifier of the chain is given in hex, or else read from the blockchain database, so signing
+// works on a machine without the chain. A transaction spending multisig outputs may be returned
+// partially signed, to be passed on to the holders of the other keys.
+func signRawTransaction(raw, chainIDHex string, network transaction.Network, nodeID string) (*signResult, error) {
+	tx, err := transaction.DecodeRaw(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var chainID []byte
+	if chainIDHex != "" {
+		chainID, err = hex.DecodeString(chainIDHex)
+		if err != nil {
+			return nil, errors.ErrInvalidChainID
+		}
+	} else {
+		bc, err := openBlockchain(nodeID)
+		if err != nil {
+			return nil, err
+		}
+
+		chainID, err = bc.ChainID()
+		closeBlockchain(bc)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	wallets, err := transaction.NewWallets(nodeID, network)
+	if err != nil {
+		return nil, err
+	}
+
+	err = wallets.SignRaw(&tx, chainID)
+	if err != nil {
+		return nil, err
+	}
+
+	signed, err := tx.EncodeRaw()
+	if err != nil {
+		return nil, err
+	}
+
+	missing := tx.MissingSignatures()
+	return &signResult{Hex: signed, Complete: missing == 0, Missing: missing}, nil
+}
+
+// sendRawTransaction checks a signed raw transaction against the chain and sends it to the central
+// node.
+func sendRawTransaction(raw, nodeID string, client *server.Client) (*txIDResult, error) {
+	tx, err := transaction.DecodeRaw(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	bc, err := openBlockchain(nodeID)
+	if err != nil {
+		return nil, err
+	}
+
+	chainID, err := bc.ChainID()
+	if err != nil {
+		closeBlockchain(bc)
+		return nil, err
+	}
+
+	ok, err := bc.VerifyTransaction(&tx)
+	closeBlockchain(bc)
+	if err != nil {
+		return nil, err
+	}
+	if !ok || tx.IsCoinbase() {
+		return nil, errors.ErrInvalidTransaction
+	}
+
+	err = client.SendTransaction(&tx, chainID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &txIDResult{TxID: hex.EncodeToString(tx.ID)}, nil
+}
@@ -0,0 +1,17 @@
+package cli
+
+// reindexTransactions rebuilds the transaction index from the main chain
+func reindexTransactions(nodeID string) (*messageResult, error) {
+	bc, err := openBlockchain(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBlockchain(bc)
+
+	err = bc.ReindexTransactions()
+	if err != nil {
+		return nil, err
+	}
+
+	return &messageResult{Message: "Done! The transaction index is rebuilt."}, nil
+}
@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/yanglinshu/glock/internal/blockchain"
+	"github.com/yanglinshu/glock/internal/server"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// rescanResult is the result of rescan
+type rescanResult struct {
+	server.RescanResult
+}
+
+// printText prints the number of blocks scanned, then the balances of the wallet.
+func (r *rescanResult) printText() {
+	fmt.Printf("Done! %d blocks scanned.\n", r.Scanned)
+	(&walletBalanceResult{r.Balance}).printText()
+}
+
+// rescanWallet records the transactions of the addresses of the wallet file found in the chain from
+// the given height, or from where the last rescan stopped if it is negative, and rebuilds the
+// address index. The progress is shown on the standard error at a terminal.
+func rescanWallet(from int, network transaction.Network, nodeID string) (*rescanResult, error) {
+	wallets, err := transaction.NewWallets(nodeID, network)
+	if err != nil {
+		return nil, err
+	}
+
+	bc, err := openBlockchain(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBlockchain(bc)
+
+	var progress blockchain.RescanProgressFunc
+	interactive := isTerminal(int(os.Stderr.Fd()))
+	if interactive {
+		progress = func(height, bestHeight int) {
+			fmt.Fprintf(os.Stderr, "\rScanned block %d of %d", height, bestHeight)
+		}
+	}
+
+	scanned, err := bc.RescanWallets(wallets, from, progress)
+	if interactive && scanned > 0 {
+		fmt.Fprint(os.Stderr, "\r\x1b[K")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	UTXOSet := blockchain.UTXOSet{Blockchain: bc}
+	balances, err := UTXOSet.GetWalletBalances(wallets, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rescanResult{server.RescanResult{Scanned: scanned, Balance: server.WalletBalance(balances)}}, nil
+}
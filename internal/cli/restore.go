@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/yanglinshu/glock/internal/blockchain"
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// restoreGapLimit is the number of consecutive unused addresses after which restoring stops
+const restoreGapLimit = 20
+
+// restoreResult is the result of restore
+type restoreResult struct {
+	Addresses []string `json:"addresses"` // the addresses kept in the wallet file
+}
+
+// printText prints the addresses restored.
+func (r *restoreResult) printText() {
+	for _, address := range r.Addresses {
+		fmt.Println(address)
+	}
+
+	fmt.Printf("Restored %d addresses\n", len(r.Addresses))
+}
+
+// restoreWallets recreates the wallet file from a seed in hex. Addresses are derived in order until
+// restoreGapLimit of them in a row hold no unspent outputs.
+func restoreWallets(seedHex string, network transaction.Network, nodeID string) (*restoreResult, error) {
+	seed, err := hex.DecodeString(seedHex)
+	if err != nil || len(seed) == 0 {
+		return nil, errors.ErrInvalidSeed
+	}
+
+	return restoreFromSeed(seed, network, nodeID)
+}
+
+// restoreFromMnemonic recreates the wallet file from a mnemonic phrase and its passphrase.
+func restoreFromMnemonic(mnemonic, passphrase string, network transaction.Network, nodeID string) (*restoreResult, error) {
+	seed, err := transaction.SeedFromMnemonic(mnemonic, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	return restoreFromSeed(seed, network, nodeID)
+}
+
+// restoreFromSeed recreates the wallet file from a seed, keeping the addresses up to the last one
+// found in the UTXO set.
+func restoreFromSeed(seed []byte, network transaction.Network, nodeID string) (*restoreResult, error) {
+	if transaction.WalletFileExists(nodeID) {
+		return nil, errors.ErrWalletExists
+	}
+
+	bc, err := openBlockchain(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBlockchain(bc)
+
+	UTXOSet := blockchain.UTXOSet{Blockchain: bc}
+
+	used := 0
+	for index := 0; index < used+restoreGapLimit; index++ {
+		wallet, err := transaction.DeriveWallet(seed, index)
+		if err != nil {
+			return nil, err
+		}
+
+		pubKeyHash, err := transaction.HashPubKey(wallet.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+
+		utxos, err := UTXOSet.FindOutPoints(pubKeyHash)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(utxos) > 0 {
+			used = index + 1
+		}
+	}
+
+	// Keep at least one address, so the restored wallet can receive coins
+	if used == 0 {
+		used = 1
+	}
+
+	wallets, err := transaction.NewWalletsFromSeed(seed, used, network)
+	if err != nil {
+		return nil, err
+	}
+
+	err = wallets.SaveToFile(nodeID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &restoreResult{Addresses: wallets.GetAddresses()}, nil
+}
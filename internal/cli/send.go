@@ -1,62 +1,230 @@
-package cli
-
-import (
-	"fmt"
-
-	"github.com/yanglinshu/glock/internal/blockchain"
-	"github.com/yanglinshu/glock/internal/errors"
-	"github.com/yanglinshu/glock/internal/server"
-	"github.com/yanglinshu/glock/internal/transaction"
-)
-
-// sendTransaction sends coins from one address to another
-func sendTransaction(from, to string, amount int, nodeID string, mineNow bool) error {
-	if !transaction.ValidateAddress(from) {
-		return errors.ErrInvalidAddress
-	}
-
-	if !transaction.ValidateAddress(to) {
-		return errors.ErrInvalidAddress
-	}
-
-	bc, err := blockchain.NewBlockchain(nodeID)
-	if err != nil {
-		return err
-	}
-	defer bc.CloseDB()
-
-	UTXOSet := blockchain.UTXOSet{Blockchain: bc}
-
-	wallets, err := transaction.NewWallets(nodeID)
-	if err != nil {
-		return err
-	}
-
-	wallet := wallets.GetWallet(from)
-
-	tx, err := blockchain.NewUTXOTransaction(&wallet, to, amount, &UTXOSet)
-	if err != nil {
-		return err
-	}
-
-	if mineNow {
-		cbTx, err := transaction.NewCoinbaseTX(from, "")
-		if err != nil {
-			return err
-		}
-
-		txs := []*transaction.Transaction{cbTx, tx}
-
-		newBlock, err := bc.MineBlock(txs)
-		if err != nil {
-			return err
-		}
-
-		UTXOSet.Update(newBlock)
-	} else {
-		server.SendTransaction(tx)
-	}
-
-	fmt.Println("Success!")
-	return nil
-}
+package cli
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/yanglinshu/glock/internal/block"
+	"github.com/yanglinshu/glock/internal/blockchain"
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/server"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// sendResult is the result of send
+type sendResult struct {
+	TxID  string `json:"txid"`            // the ID of the transaction in hex
+	Block string `json:"block,omitempty"` // the hash of the block mined with -mine in hex
+}
+
+// printText prints the ID of the transaction, and the hash of the block mined, if any.
+func (r *sendResult) printText() {
+	if r.Block != "" {
+		fmt.Printf("Mined block %s\n", r.Block)
+	}
+
+	fmt.Printf("Sent transaction %s\n", r.TxID)
+}
+
+// sendTransaction sends coins from one address to the recipients in one transaction, paying fee to
+// the miner and choosing the coins to spend with the named strategy. A non-empty memo is encrypted
+// to the public key of the first recipient, given in hex or looked up on the chain. A transaction
+// that is not mined at once is recorded as unconfirmed, so the node announces it again until it is
+// mined, even if it cannot be sent now.
+func sendTransaction(from string, recipients []blockchain.Recipient, fee int, memo, pubKeyHex, coins string, network transaction.Network, nodeID string, client *server.Client, mineNow bool) (*sendResult, error) {
+	if !transaction.ValidateAddress(from, network) {
+		return nil, errors.ErrInvalidAddress
+	}
+
+	selector, err := blockchain.CoinSelectorByName(coins)
+	if err != nil {
+		return nil, err
+	}
+
+	bc, err := openBlockchain(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBlockchain(bc)
+
+	UTXOSet := blockchain.UTXOSet{Blockchain: bc}
+
+	wallets, err := transaction.NewWallets(nodeID, network)
+	if err != nil {
+		return nil, err
+	}
+
+	wallet, err := wallets.GetWallet(from)
+	if errors.Is(err, errors.ErrWalletNotFound) {
+		return nil, errors.NewError(fmt.Sprintf("address %s is not in your wallet (run 'glock show -addresses')", from))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var memoOut *transaction.TXOutput
+	if memo != "" {
+		memoOut, err = newMemoOutput(bc, memo, recipients[0].Address, pubKeyHex)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := blockchain.NewUTXOTransactionMulti(wallet, recipients, fee, memoOut, selector, &UTXOSet)
+	if err != nil {
+		return nil, err
+	}
+
+	return submitTransaction(bc, tx, from, network, client, mineNow)
+}
+
+// submitTransaction mines a transaction created by the wallet of from at once, rewarding from, or
+// else records it as unconfirmed and sends it to the central node.
+func submitTransaction(bc *blockchain.Blockchain, tx *transaction.Transaction, from string, network transaction.Network, client *server.Client, mineNow bool) (*sendResult, error) {
+	res := &sendResult{TxID: hex.EncodeToString(tx.ID)}
+	if mineNow {
+		// Check the transaction before anything is mined, so a failure names the input at fault
+		err := bc.CheckTransaction(tx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "transaction %x", tx.ID)
+		}
+
+		height, err := bc.GetBestHeight()
+		if err != nil {
+			return nil, err
+		}
+
+		rewardTo, err := transaction.ParseAddress(from, network)
+		if err != nil {
+			return nil, err
+		}
+
+		cbTx, err := transaction.NewCoinbaseTX(rewardTo, "", height+1, bc.ChainParams())
+		if err != nil {
+			return nil, err
+		}
+
+		txs := []*transaction.Transaction{cbTx, tx}
+
+		// Show the user waiting at a terminal that mining is under way
+		interactive := isTerminal(int(os.Stderr.Fd()))
+		if interactive {
+			bc.SetMiningProgress(miningSpinner())
+		}
+
+		newBlock, err := bc.MineBlock(context.Background(), txs)
+		if interactive {
+			bc.SetMiningProgress(nil)
+			fmt.Fprint(os.Stderr, "\r\x1b[K")
+		}
+		if err != nil {
+			return nil, err
+		}
+		res.Block = hex.EncodeToString(newBlock.Hash)
+	} else {
+		chainID, err := bc.ChainID()
+		if err != nil {
+			return nil, err
+		}
+
+		err = bc.AddUnconfirmed(tx)
+		if err != nil {
+			return nil, err
+		}
+
+		err = client.SendTransaction(tx, chainID)
+		if errors.Is(err, errors.ErrRejected) {
+			// A transaction the network refuses would only be rejected again when rebroadcast
+			removeErr := bc.RemoveUnconfirmed(tx.ID)
+			if removeErr != nil {
+				return nil, removeErr
+			}
+			return nil, err
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "transaction %x is kept and will be rebroadcast by the node", tx.ID)
+		}
+	}
+
+	return res, nil
+}
+
+// spinnerFrames are the frames of the spinner shown while a block is mined
+const spinnerFrames = `|/-\`
+
+// miningSpinner returns a progress function printing a spinner and the hash rate on the standard
+// error.
+func miningSpinner() block.ProgressFunc {
+	var mu sync.Mutex
+	frame := 0
+
+	return func(hashes int, hashesPerSec float64) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		fmt.Fprintf(os.Stderr, "\r%c Mining: %d hashes, %.0f H/s", spinnerFrames[frame%len(spinnerFrames)], hashes, hashesPerSec)
+		frame++
+	}
+}
+
+// parseOutputs parses a comma-separated list of ADDR:AMOUNT pairs.
+func parseOutputs(outputs string, network transaction.Network) ([]blockchain.Recipient, error) {
+	var recipients []blockchain.Recipient
+
+	for _, pair := range strings.Split(outputs, ",") {
+		address, amount, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || address == "" {
+			return nil, errors.ErrInvalidAddress
+		}
+
+		value, err := strconv.Atoi(amount)
+		if err != nil || value <= 0 {
+			return nil, errors.ErrInvalidAmount
+		}
+
+		recipient, err := newRecipient(address, value, network)
+		if err != nil {
+			return nil, err
+		}
+
+		recipients = append(recipients, recipient)
+	}
+
+	return recipients, nil
+}
+
+// newRecipient returns the recipient paid amount at an address, checking the address.
+func newRecipient(address string, amount int, network transaction.Network) (blockchain.Recipient, error) {
+	to, err := transaction.ParseAddress(address, network)
+	if err != nil {
+		return blockchain.Recipient{}, errors.Wrapf(errors.ErrInvalidAddress, "address %s", address)
+	}
+
+	return blockchain.Recipient{Address: to, Amount: amount}, nil
+}
+
+// newMemoOutput encrypts a memo to the recipient. Without an explicit public key, the key is taken
+// from a previous transaction in which the recipient spent coins.
+func newMemoOutput(bc *blockchain.Blockchain, memo string, to transaction.Address, pubKeyHex string) (*transaction.TXOutput, error) {
+	var pubKey []byte
+	var err error
+
+	if pubKeyHex != "" {
+		pubKey, err = hex.DecodeString(pubKeyHex)
+		if err != nil {
+			return nil, errors.ErrInvalidPublicKey
+		}
+	} else {
+		pubKey, err = bc.FindPublicKey(to.PubKeyHash())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return transaction.NewMemoTXOutput(memo, pubKey)
+}
@@ -0,0 +1,202 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/yanglinshu/glock/internal/blockchain"
+	"github.com/yanglinshu/glock/internal/config"
+	"github.com/yanglinshu/glock/internal/errors"
+)
+
+// shellPrompt is printed before every command typed in the shell
+const shellPrompt = "glock> "
+
+// historyFileFormat is the format of the file keeping the commands typed in the shell
+const historyFileFormat = "shell_history_%s"
+
+// maxHistory is the number of commands kept in the history of the shell
+const maxHistory = 500
+
+// shellExcluded are the commands the shell does not run, as they replace or lock the database it
+// keeps open
+var shellExcluded = map[string]bool{
+	"create":       true,
+	"restorechain": true,
+	"importchain":  true,
+	"start":        true,
+	"shell":        true,
+}
+
+// sharedChain is the blockchain the shell keeps open for its commands, nil outside the shell
+var sharedChain *blockchain.Blockchain
+
+// openBlockchain opens the blockchain of the node, or returns the one the shell keeps open.
+func openBlockchain(nodeID string) (*blockchain.Blockchain, error) {
+	if sharedChain != nil {
+		return sharedChain, nil
+	}
+
+	return blockchain.NewBlockchain(nodeID)
+}
+
+// closeBlockchain closes a blockchain returned by openBlockchain, unless the shell keeps it open.
+func closeBlockchain(bc *blockchain.Blockchain) {
+	if bc != sharedChain {
+		bc.CloseDB()
+	}
+}
+
+// errorHandling is how the flag sets of the commands handle parse errors: by exiting, or by
+// returning them in the shell.
+func (cli *CLI) errorHandling() flag.ErrorHandling {
+	if cli.interactive {
+		return flag.ContinueOnError
+	}
+
+	return flag.ExitOnError
+}
+
+// runShell opens the blockchain once and runs the commands typed at the prompt with it, until exit
+// or the end of the input. A failed command has printed its error, so the shell returns to the
+// prompt.
+func (cli *CLI) runShell(ctx context.Context, settings config.Config) error {
+	bc, err := blockchain.NewBlockchain(settings.NodeID)
+	if err != nil {
+		return err
+	}
+	sharedChain = bc
+	cli.interactive = true
+	defer func() {
+		cli.interactive = false
+		sharedChain = nil
+		bc.CloseDB()
+	}()
+
+	historyFile := config.Path(fmt.Sprintf(historyFileFormat, settings.NodeID))
+	reader := newLineReader(os.Stdin, os.Stdout, loadHistory(historyFile))
+
+	fmt.Println("Type help for the commands, exit to quit")
+	for {
+		line, err := reader.readLine(shellPrompt)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		args, err := splitArgs(line)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+		reader.addHistory(line)
+		appendHistory(historyFile, line)
+
+		switch {
+		case args[0] == "exit" || args[0] == "quit":
+			return nil
+		case args[0] == "help":
+			cli.printUsage()
+		case shellExcluded[args[0]]:
+			fmt.Printf("%s is not available in the shell\n", args[0])
+		default:
+			err := cli.runCommand(ctx, settings, args)
+			if err != nil && err != errors.ErrCommandFailed {
+				return err
+			}
+		}
+	}
+}
+
+// runCommand runs a command typed in the shell. Flags such as -json given to a command only apply
+// to it.
+func (cli *CLI) runCommand(ctx context.Context, settings config.Config, args []string) error {
+	defer func(json bool) {
+		cli.json = json
+	}(cli.json)
+
+	return cli.execute(ctx, settings, args)
+}
+
+// splitArgs splits a command line into arguments on spaces, keeping together the text between
+// single or double quotes.
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	var quote rune
+	inArg := false
+
+	for _, r := range line {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			current.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, errors.ErrUnterminatedQuote
+	}
+
+	if inArg {
+		args = append(args, current.String())
+	}
+
+	return args, nil
+}
+
+// loadHistory reads the commands typed in previous sessions, none if the file cannot be read.
+func loadHistory(historyFile string) []string {
+	f, err := os.Open(historyFile)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var history []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		history = append(history, scanner.Text())
+	}
+
+	if len(history) > maxHistory {
+		history = history[len(history)-maxHistory:]
+	}
+
+	return history
+}
+
+// appendHistory adds a command to the history file. The history is a convenience, so failing to
+// write it is ignored.
+func appendHistory(historyFile, line string) {
+	f, err := os.OpenFile(historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	fmt.Fprintln(f, line)
+}
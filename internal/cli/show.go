@@ -1,59 +1,254 @@
-package cli
-
-import (
-	"fmt"
-	"strconv"
-
-	"github.com/yanglinshu/glock/internal/block"
-	"github.com/yanglinshu/glock/internal/blockchain"
-	"github.com/yanglinshu/glock/internal/transaction"
-)
-
-// showBlockchain prints the blockchain
-func showBlockchain(nodeID string) error {
-	bc, err := blockchain.NewBlockchain(nodeID)
-	defer bc.CloseDB()
-	if err != nil {
-		return err
-	}
-
-	bci := bc.Iterator()
-
-	for {
-		bl, err := bci.Next()
-		if err != nil {
-			return err
-		}
-
-		fmt.Printf("============ Block %x ============\n", bl.Hash)
-		fmt.Printf("Prev. block: %x\n", bl.PrevBlockHash)
-		pow := block.NewProofOfWork(bl)
-		fmt.Printf("PoW: %s\n\n", strconv.FormatBool(pow.Validate()))
-		for _, tx := range bl.Transactions {
-			fmt.Println(tx)
-		}
-		fmt.Printf("\n\n")
-
-		if len(bl.PrevBlockHash) == 0 {
-			break
-		}
-	}
-
-	return nil
-}
-
-// showAddresses lists all the addresses in the wallet file
-func showAddresses(nodeID string) error {
-	wallets, err := transaction.NewWallets(nodeID)
-	if err != nil {
-		return err
-	}
-
-	addresses := wallets.GetAddresses()
-
-	for _, address := range addresses {
-		fmt.Println(address)
-	}
-
-	return nil
-}
+package cli
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+
+	"github.com/yanglinshu/glock/internal/block"
+	"github.com/yanglinshu/glock/internal/server"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// blockJSON is a block as encoded by show -blockchain -json
+type blockJSON struct {
+	Hash          string   `json:"hash"`          // the hash of the block in hex
+	PrevBlockHash string   `json:"prevblockhash"` // the hash of the parent in hex
+	Height        int      `json:"height"`        // the height of the block
+	Time          string   `json:"time"`          // the time the block was created
+	Bits          int      `json:"bits"`          // the difficulty of the block
+	Nonce         int      `json:"nonce"`         // the nonce of the proof-of-work
+	MerkleRoot    string   `json:"merkleroot"`    // the Merkle root of the transactions in hex
+	PoW           bool     `json:"pow"`           // whether the proof-of-work is valid
+	Transactions  []txJSON `json:"transactions"`  // the transactions of the block
+}
+
+// txJSON is a transaction as encoded in blockJSON
+type txJSON struct {
+	ID      string       `json:"txid"`    // the ID of the transaction in hex
+	Version int          `json:"version"` // the signature rules of the transaction
+	Inputs  []inputJSON  `json:"inputs"`  // the outputs spent, none for a coinbase
+	Outputs []outputJSON `json:"outputs"` // the outputs created
+}
+
+// inputJSON is an input as encoded in txJSON
+type inputJSON struct {
+	TxID      string `json:"txid"`      // the transaction holding the spent output in hex
+	Vout      int    `json:"vout"`      // the index of the spent output
+	PublicKey string `json:"publickey"` // the public key of the spender in hex
+	Signature string `json:"signature"` // the signature in hex
+}
+
+// outputJSON is an output as encoded in txJSON
+type outputJSON struct {
+	Value   int    `json:"value"`             // the value of the output
+	Address string `json:"address,omitempty"` // the address the output is locked to, none for data
+	Data    string `json:"data,omitempty"`    // the data carried by the output in hex
+}
+
+// newTxJSON converts a transaction to its JSON encoding.
+func newTxJSON(tx *transaction.Transaction, network transaction.Network) txJSON {
+	encoded := txJSON{ID: hex.EncodeToString(tx.ID), Version: tx.Version, Inputs: []inputJSON{}, Outputs: []outputJSON{}}
+
+	if !tx.IsCoinbase() {
+		for _, in := range tx.Vin {
+			encoded.Inputs = append(encoded.Inputs, inputJSON{
+				TxID:      hex.EncodeToString(in.Txid),
+				Vout:      in.Vout,
+				PublicKey: hex.EncodeToString(in.PublicKey),
+				Signature: hex.EncodeToString(in.Signature),
+			})
+		}
+	}
+
+	for _, out := range tx.Vout {
+		output := outputJSON{Value: out.Value, Data: hex.EncodeToString(out.Data)}
+		if len(out.PublicKeyHash) != 0 {
+			output.Address = transaction.PubKeyHashToAddress(out.PublicKeyHash, network)
+		}
+		encoded.Outputs = append(encoded.Outputs, output)
+	}
+
+	return encoded
+}
+
+// chainResult is the result of show -blockchain
+type chainResult struct {
+	Blocks []blockJSON `json:"blocks"` // the blocks from the tip down to the genesis block
+
+	blocks []*block.Block // the same blocks, printed as text
+}
+
+// printText prints every block with its transactions.
+func (r *chainResult) printText() {
+	for _, bl := range r.blocks {
+		fmt.Printf("============ Block %x ============\n", bl.Hash)
+		fmt.Printf("Prev. block: %x\n", bl.PrevBlockHash)
+		fmt.Printf("Bits: %d\n", bl.TargetBits())
+		pow := block.NewProofOfWork(bl)
+		fmt.Printf("PoW: %s\n\n", strconv.FormatBool(pow.Validate()))
+		for _, tx := range bl.Transactions {
+			fmt.Println(tx)
+		}
+		fmt.Printf("\n\n")
+	}
+}
+
+// newBlockJSON converts a block to its JSON encoding.
+func newBlockJSON(bl *block.Block, network transaction.Network) blockJSON {
+	encoded := blockJSON{
+		Hash:          hex.EncodeToString(bl.Hash),
+		PrevBlockHash: hex.EncodeToString(bl.PrevBlockHash),
+		Height:        bl.Height,
+		Time:          isoTime(bl.Timestamp),
+		Bits:          bl.TargetBits(),
+		Nonce:         bl.Nonce,
+		MerkleRoot:    hex.EncodeToString(bl.MerkleRoot),
+		PoW:           block.NewProofOfWork(bl).Validate(),
+	}
+	for _, tx := range bl.Transactions {
+		encoded.Transactions = append(encoded.Transactions, newTxJSON(tx, network))
+	}
+
+	return encoded
+}
+
+// showBlockchain returns the blocks of the blockchain, from the tip down
+func showBlockchain(network transaction.Network, nodeID string) (*chainResult, error) {
+	bc, err := openBlockchain(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBlockchain(bc)
+
+	res := &chainResult{Blocks: []blockJSON{}}
+	bci := bc.Iterator()
+
+	for {
+		bl, err := bci.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		res.Blocks = append(res.Blocks, newBlockJSON(bl, network))
+		res.blocks = append(res.blocks, bl)
+
+		if len(bl.PrevBlockHash) == 0 {
+			break
+		}
+	}
+
+	return res, nil
+}
+
+// memoJSON is a memo decrypted by show -memos
+type memoJSON struct {
+	Height  int    `json:"height"`  // the height of the block holding the memo
+	TxID    string `json:"txid"`    // the transaction carrying the memo in hex
+	Address string `json:"address"` // the address of the wallet the memo is sent to
+	Memo    string `json:"memo"`    // the decrypted memo
+}
+
+// memosResult is the result of show -memos
+type memosResult struct {
+	Memos []memoJSON `json:"memos"` // the memos, the latest first
+}
+
+// printText prints a line per memo.
+func (r *memosResult) printText() {
+	for _, m := range r.Memos {
+		fmt.Printf("Block %d, transaction %s, to %s: %s\n", m.Height, m.TxID, m.Address, m.Memo)
+	}
+}
+
+// showMemos returns the memos on the chain that can be decrypted by the wallets of the node
+func showMemos(network transaction.Network, nodeID string) (*memosResult, error) {
+	wallets, err := transaction.NewWallets(nodeID, network)
+	if err != nil {
+		return nil, err
+	}
+
+	bc, err := openBlockchain(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBlockchain(bc)
+
+	res := &memosResult{Memos: []memoJSON{}}
+	bci := bc.Iterator()
+
+	for {
+		bl, err := bci.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, tx := range bl.Transactions {
+			for _, out := range tx.Vout {
+				if !out.IsMemo() {
+					continue
+				}
+
+				address, memo, err := wallets.DecryptMemo(&out)
+				if err != nil {
+					continue
+				}
+
+				res.Memos = append(res.Memos, memoJSON{bl.Height, hex.EncodeToString(tx.ID), address, memo})
+			}
+		}
+
+		if len(bl.PrevBlockHash) == 0 {
+			break
+		}
+	}
+
+	return res, nil
+}
+
+// identityResult is the result of show -identity
+type identityResult struct {
+	Identity string `json:"identity"` // the identity of the node
+}
+
+// printText prints the identity.
+func (r *identityResult) printText() {
+	fmt.Println(r.Identity)
+}
+
+// showIdentity returns the identity of the node, to be listed in the allowlists of its peers
+func showIdentity(nodeID string) (*identityResult, error) {
+	identity, err := server.LoadIdentity(nodeID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &identityResult{Identity: server.Identity(identity)}, nil
+}
+
+// addressesResult is the result of show -addresses
+type addressesResult struct {
+	Addresses []string `json:"addresses"` // the addresses of the wallet file
+}
+
+// printText prints an address per line.
+func (r *addressesResult) printText() {
+	for _, address := range r.Addresses {
+		fmt.Println(address)
+	}
+}
+
+// showAddresses lists all the addresses in the wallet file
+func showAddresses(network transaction.Network, nodeID string) (*addressesResult, error) {
+	wallets, err := transaction.NewWallets(nodeID, network)
+	if err != nil {
+		return nil, err
+	}
+
+	addresses := wallets.GetAddresses()
+	if addresses == nil {
+		addresses = []string{}
+	}
+
+	return &addressesResult{Addresses: addresses}, nil
+}
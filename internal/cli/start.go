@@ -1,29 +1,90 @@
-package cli
-
-import (
-	"fmt"
-
-	"github.com/yanglinshu/glock/internal/errors"
-	"github.com/yanglinshu/glock/internal/server"
-	"github.com/yanglinshu/glock/internal/transaction"
-)
-
-// startNode creates a new node
-func startNode(minerAddress, nodeID string) error {
-	fmt.Printf("Starting node %s\n", nodeID)
-	if len(minerAddress) > 0 {
-		if transaction.ValidateAddress(minerAddress) {
-			fmt.Println("Mining is on. Address to receive rewards: ", minerAddress)
-		} else {
-			return errors.ErrInvalidAddress
-		}
-	}
-
-	err := server.StartServer(nodeID, minerAddress)
-	if err != nil {
-		return err
-	}
-
-	fmt.Println("Shutting down node ", nodeID)
-	return nil
-}
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/yanglinshu/glock/internal/config"
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/logger"
+	"github.com/yanglinshu/glock/internal/server"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// startNode runs a node with the given settings on the given network until the context is canceled.
+// Its mempool holds at most mempoolSize transactions and its peers have timeout to send or receive
+// a message. If allowlistFile is not empty, only peers whose identity is listed in it, one per line,
+// may talk to the node. If pprofAddr is not empty, the node serves profiles and metrics on it, and
+// if rpcAddr is not, the JSON-RPC methods guarded by the RPC token. Messages at logLevel and above
+// are logged to the standard error.
+func startNode(ctx context.Context, settings config.Config, allowlistFile, pprofAddr, network, rpcAddr string, mempoolSize int, timeout time.Duration, logLevel logger.Level) error {
+	nodeID := settings.NodeID
+	fmt.Printf("Starting node %s\n", nodeID)
+
+	addresses, err := transaction.NetworkByName(network)
+	if err != nil {
+		return err
+	}
+
+	if len(settings.MinerAddress) > 0 {
+		if transaction.ValidateAddress(settings.MinerAddress, addresses) {
+			fmt.Println("Mining is on. Address to receive rewards: ", settings.MinerAddress)
+		} else {
+			return errors.ErrInvalidAddress
+		}
+	}
+
+	var allowed []string
+	if allowlistFile != "" {
+		content, err := os.ReadFile(allowlistFile)
+		if err != nil {
+			return err
+		}
+
+		for _, line := range strings.Split(string(content), "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "#") {
+				allowed = append(allowed, line)
+			}
+		}
+		fmt.Printf("Allowlist mode is on, %d identities allowed\n", len(allowed))
+	}
+
+	node, err := server.NewNode(server.Config{
+		NodeID:             nodeID,
+		ListenAddr:         settings.ListenAddr,
+		MinerAddress:       settings.MinerAddress,
+		Allowed:            allowed,
+		DebugAddr:          pprofAddr,
+		Network:            network,
+		MempoolSize:        mempoolSize,
+		ReadTimeout:        timeout,
+		WriteTimeout:       timeout,
+		RPCAddr:            rpcAddr,
+		Seeds:              settings.Seeds,
+		RPCToken:           settings.RPCToken,
+		MaxClockSkew:       time.Duration(settings.MaxClockSkew) * time.Second,
+		MempoolTTL:         time.Duration(settings.MempoolTTL) * time.Second,
+		MiningIdleInterval: time.Duration(settings.MiningIdle) * time.Second,
+		MaxInbound:         settings.MaxInbound,
+		MaxMessageRate:     settings.MaxMessageRate,
+		MaxInvItems:        settings.MaxInvItems,
+		Logger:             logger.New(os.Stderr, logLevel),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = node.Start(ctx)
+	// Start returns as soon as the node stops listening, wait for the rest of the shutdown
+	node.Stop()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Shutting down node ", nodeID)
+	return nil
+}
@@ -0,0 +1,69 @@
+//go:build linux
+
+package cli
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// terminalState is the mode of a terminal, restored once a line is read
+type terminalState struct {
+	termios syscall.Termios // the settings of the terminal
+}
+
+// getTermios reads the settings of the terminal.
+func getTermios(fd int, termios *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.TCGETS, uintptr(unsafe.Pointer(termios)))
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+// setTermios changes the settings of the terminal.
+func setTermios(fd int, termios *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.TCSETS, uintptr(unsafe.Pointer(termios)))
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+// isTerminal checks whether the descriptor is a terminal.
+func isTerminal(fd int) bool {
+	var termios syscall.Termios
+	return getTermios(fd, &termios) == nil
+}
+
+// makeRaw puts the terminal in raw mode, so keys are read one by one without being echoed, and
+// returns its previous mode. Output processing is kept so newlines still return the carriage.
+func makeRaw(fd int) (*terminalState, error) {
+	var state terminalState
+	err := getTermios(fd, &state.termios)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := state.termios
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+
+	err = setTermios(fd, &raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+// restoreTerminal puts the terminal back in the mode returned by makeRaw.
+func restoreTerminal(fd int, state *terminalState) error {
+	return setTermios(fd, &state.termios)
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+
+package cli
+
+import "github.com/yanglinshu/glock/internal/errors"
+
+// terminalState is the mode of a terminal, restored once a line is read
+type terminalState struct{}
+
+// isTerminal reports no terminal, so the shell reads plain lines on this platform.
+func isTerminal(fd int) bool {
+	return false
+}
+
+// makeRaw is not supported on this platform.
+func makeRaw(fd int) (*terminalState, error) {
+	return nil, errors.ErrNotTerminal
+}
+
+// restoreTerminal is not supported on this platform.
+func restoreTerminal(fd int, state *terminalState) error {
+	return errors.ErrNotTerminal
+}
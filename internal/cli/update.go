@@ -1,27 +1,39 @@
-package cli
-
-import (
-	"fmt"
-
-	"github.com/yanglinshu/glock/internal/blockchain"
-)
-
-// updateUTXO rebuilds the UTXO set
-func updateUTXO(nodeID string) error {
-	bc, err := blockchain.NewBlockchain(nodeID)
-	if err != nil {
-		return err
-	}
-	defer bc.CloseDB()
-
-	UTXOSet := blockchain.UTXOSet{Blockchain: bc}
-	UTXOSet.Reindex()
-
-	count, err := UTXOSet.CountTransactions()
-	if err != nil {
-		return err
-	}
-
-	fmt.Printf("Done! There are now %d transactions in the UTXO set.\n", count)
-	return nil
-}
+package cli
+
+import (
+	"fmt"
+
+	"github.com/yanglinshu/glock/internal/blockchain"
+)
+
+// utxoResult is the result of update -UTXO
+type utxoResult struct {
+	Transactions int `json:"transactions"` // the number of transactions with unspent outputs
+}
+
+// printText prints the size of the rebuilt UTXO set.
+func (r *utxoResult) printText() {
+	fmt.Printf("Done! There are now %d transactions in the UTXO set.\n", r.Transactions)
+}
+
+// updateUTXO rebuilds the UTXO set with the given number of workers
+func updateUTXO(workers int, nodeID string) (*utxoResult, error) {
+	bc, err := openBlockchain(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBlockchain(bc)
+
+	UTXOSet := blockchain.UTXOSet{Blockchain: bc}
+	err = UTXOSet.ReindexParallel(workers)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := UTXOSet.CountTransactions()
+	if err != nil {
+		return nil, err
+	}
+
+	return &utxoResult{Transactions: count}, nil
+}
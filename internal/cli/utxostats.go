@@ -0,0 +1,40 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/yanglinshu/glock/internal/blockchain"
+	"github.com/yanglinshu/glock/internal/server"
+)
+
+// utxoStatsResult is the result of utxostats
+type utxoStatsResult struct {
+	server.UTXOStatsResult
+}
+
+// printText prints the statistics and the hash of the UTXO set.
+func (r *utxoStatsResult) printText() {
+	fmt.Printf("Best block:   %s\n", r.BestBlock)
+	fmt.Printf("Transactions: %d\n", r.Transactions)
+	fmt.Printf("Outputs:      %d\n", r.Outputs)
+	fmt.Printf("Total value:  %d\n", r.TotalValue)
+	fmt.Printf("Size:         %d bytes\n", r.SerializedSize)
+	fmt.Printf("Hash:         %s\n", r.Hash)
+}
+
+// showUTXOStats returns the statistics and the hash of the UTXO set of the blockchain
+func showUTXOStats(nodeID string) (*utxoStatsResult, error) {
+	bc, err := openBlockchain(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBlockchain(bc)
+
+	UTXOSet := blockchain.UTXOSet{Blockchain: bc}
+	stats, err := UTXOSet.Stats()
+	if err != nil {
+		return nil, err
+	}
+
+	return &utxoStatsResult{server.UTXOStatsEntry(stats)}, nil
+}
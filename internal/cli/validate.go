@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"fmt"
+)
+
+// validateResult is the result of validate
+type validateResult struct {
+	Blocks int `json:"blocks"` // the number of blocks checked
+}
+
+// printText prints the number of blocks checked.
+func (r *validateResult) printText() {
+	fmt.Printf("Chain is valid, %d blocks checked\n", r.Blocks)
+}
+
+// validateChain checks that the blockchain database is internally consistent
+func validateChain(nodeID string) (*validateResult, error) {
+	bc, err := openBlockchain(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBlockchain(bc)
+
+	err = bc.ValidateChain()
+	if err != nil {
+		return nil, err
+	}
+
+	height, err := bc.GetBestHeight()
+	if err != nil {
+		return nil, err
+	}
+
+	return &validateResult{Blocks: height + 1}, nil
+}
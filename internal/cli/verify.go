@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/yanglinshu/glock/internal/blockchain"
+	"github.com/yanglinshu/glock/internal/errors"
+)
+
+// violationJSON is a block minting more than allowed, listed by verify -level supply
+type violationJSON struct {
+	Height  int    `json:"height"`  // the height of the block
+	Hash    string `json:"hash"`    // the hash of the block in hex
+	Minted  int    `json:"minted"`  // the total value of the coinbase outputs
+	Allowed int    `json:"allowed"` // the subsidy at the height plus the fees of the block
+}
+
+// supplyResult is the result of verify -level supply
+type supplyResult struct {
+	Issued      int             `json:"issued"`      // the value minted by coinbases, not counting fees
+	Unspent     int             `json:"unspent"`     // the value of the spendable outputs
+	Unspendable int             `json:"unspendable"` // the value locked in outputs nobody can spend
+	Violations  []violationJSON `json:"violations"`  // the blocks minting more than allowed
+	Consistent  bool            `json:"consistent"`  // whether the supply matches the schedule
+}
+
+// printText prints the violations and the totals.
+func (r *supplyResult) printText() {
+	for _, v := range r.Violations {
+		fmt.Printf("Block %d (%s) minted %d, allowed %d\n", v.Height, v.Hash, v.Minted, v.Allowed)
+	}
+
+	fmt.Printf("Issued:      %d\n", r.Issued)
+	fmt.Printf("Unspent:     %d\n", r.Unspent)
+	fmt.Printf("Unspendable: %d\n", r.Unspendable)
+
+	if r.Consistent {
+		fmt.Println("Supply is consistent")
+	}
+}
+
+// verifyChain runs the checks of the given verification level against the blockchain
+func verifyChain(level, nodeID string) (*supplyResult, error) {
+	bc, err := openBlockchain(nodeID)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBlockchain(bc)
+
+	switch level {
+	case "supply":
+		return verifySupply(bc)
+	default:
+		return nil, errors.ErrUnknownVerifyLevel
+	}
+}
+
+// verifySupply audits the total issuance against the subsidy schedule. An inconsistent supply is
+// reported in the result, not as an error.
+func verifySupply(bc *blockchain.Blockchain) (*supplyResult, error) {
+	report, err := bc.AuditSupply()
+	if err != nil {
+		return nil, err
+	}
+
+	res := &supplyResult{
+		Issued:      report.Issued,
+		Unspent:     report.Unspent,
+		Unspendable: report.Unspendable,
+		Violations:  []violationJSON{},
+		Consistent:  report.OK(),
+	}
+	for _, v := range report.Violations {
+		res.Violations = append(res.Violations, violationJSON{v.Height, hex.EncodeToString(v.Hash), v.Minted, v.Allowed})
+	}
+
+	return res, nil
+}
@@ -0,0 +1,112 @@
+// Package config loads the settings of a node from a JSON file. Command line flags override the
+// values of the file, which override the defaults.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/yanglinshu/glock/internal/errors"
+)
+
+// DefaultSeed is the node known at startup unless other seeds are configured
+const DefaultSeed = "localhost:5000"
+
+// DefaultNetwork is the network a node joins unless configured otherwise
+const DefaultNetwork = "mainnet"
+
+// Config holds the settings of a node, as read from a configuration file
+type Config struct {
+	NodeID       string   `json:"node_id"`        // the ID of the node, overridden by the NODE_ID env
+	DataDir      string   `json:"data_dir"`       // the directory holding the files of the node
+	Network      string   `json:"network"`        // the network the node joins, which sets the version of its addresses
+	ListenAddr   string   `json:"listen_addr"`    // the address the node listens on, localhost:NodeID if empty
+	Seeds        []string `json:"seeds"`          // the nodes known at startup, which transactions are sent to
+	MinerAddress string   `json:"miner_address"`  // the address receiving mining rewards, mining is off if empty
+	RPCPort      int      `json:"rpc_port"`       // the local port serving the JSON-RPC methods, disabled if 0
+	RPCToken     string   `json:"rpc_token"`      // the bearer token JSON-RPC requests must carry
+	LogLevel     string   `json:"log_level"`      // the lowest level logged
+	MaxClockSkew int      `json:"max_clock_skew"` // the seconds a block may be timestamped ahead of the local clock, 2 hours if 0
+	MempoolTTL   int      `json:"mempool_ttl"`    // the seconds a transaction may wait in the mempool, 72 hours if 0
+	MiningIdle   int      `json:"mining_idle"`    // the seconds after which an empty block is mined when no transaction arrives, never if 0
+
+	MaxInbound     int `json:"max_inbound"`      // the most inbound connections open at once, 125 if 0
+	MaxMessageRate int `json:"max_message_rate"` // the most messages a peer may send per minute before it is throttled, 3000 if 0
+	MaxInvItems    int `json:"max_inv_items"`    // the most items of an inv message handled, 1000 if 0
+}
+
+// Default returns the settings used when no configuration file is given.
+func Default() Config {
+	return Config{
+		DataDir:  ".",
+		Network:  DefaultNetwork,
+		Seeds:    []string{DefaultSeed},
+		LogLevel: "info",
+	}
+}
+
+// Load reads a configuration file. Settings missing from the file keep their default value, and
+// unknown settings are rejected so a misspelled one is not silently ignored.
+func Load(path string) (Config, error) {
+	cfg := Default()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return Config{}, err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	err = dec.Decode(&cfg)
+	if err != nil {
+		return Config{}, errors.ErrInvalidConfig
+	}
+
+	if cfg.DataDir == "" {
+		cfg.DataDir = "."
+	}
+
+	if cfg.Network == "" {
+		cfg.Network = DefaultNetwork
+	}
+
+	if len(cfg.Seeds) == 0 || cfg.RPCPort < 0 || cfg.MaxClockSkew < 0 || cfg.MempoolTTL < 0 || cfg.MiningIdle < 0 ||
+		cfg.MaxInbound < 0 || cfg.MaxMessageRate < 0 || cfg.MaxInvItems < 0 {
+		return Config{}, errors.ErrInvalidConfig
+	}
+
+	return cfg, nil
+}
+
+// NodeAddress returns the address the node listens on and is reached at.
+func (c Config) NodeAddress() string {
+	if c.ListenAddr != "" {
+		return c.ListenAddr
+	}
+
+	return fmt.Sprintf("localhost:%s", c.NodeID)
+}
+
+// dataDir is the directory the files of the node are read from and written to
+var dataDir = "."
+
+// SetDataDir sets the directory holding the files of the node, creating it if needed. It is called
+// once at startup, before any file is opened.
+func SetDataDir(dir string) error {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	dataDir = dir
+	return nil
+}
+
+// Path returns the path of a file of the node in the data directory.
+func Path(name string) string {
+	return filepath.Join(dataDir, name)
+}
@@ -1,42 +1,314 @@
-package errors
-
-type Error struct {
-	message string
-}
-
-func NewError(message string) *Error {
-	return &Error{
-		message: message,
-	}
-}
-
-func (err *Error) Error() string {
-	return err.message
-}
-
-// ErrDBExists is an error that is returned when a database already exists
-var ErrDBExists = NewError("database already exists")
-
-// ErrDBDoesNotExist is an error that is returned when a database does not exist
-var ErrDBDoesNotExist = NewError("database does not exist")
-
-// ErrNotEnoughFunds is an error that is returned when a transaction does not have enough funds
-var ErrNotEnoughFunds = NewError("not enough funds")
-
-// ErrTransactionNotFound is an error that is returned when a transaction is not found
-var ErrTransactionNotFound = NewError("transaction not found")
-
-// ErrInvalidTransaction is an error that is returned when a transaction is invalid
-var ErrInvalidTransaction = NewError("invalid transaction")
-
-// ErrInvalidAddress is an error that is returned when an address is invalid
-var ErrInvalidAddress = NewError("invalid address")
-
-// ErrBlockExists is an error that is returned when a block already exists
-var ErrBlockExists = NewError("block already exists")
-
-// ErrUnknownCommand is an error that is returned when an unknown command is received
-var ErrUnknownCommand = NewError("unknown command")
-
-// ErrUnknownGetDataType is an error that is returned when an unknown getdata type is received
-var ErrUnknownGetDataType = NewError("unknown getdata type")
+package errors
+
+import (
+	"errors"
+	"fmt"
+)
+
+type Error struct {
+	message string
+}
+
+func NewError(message string) *Error {
+	return &Error{
+		message: message,
+	}
+}
+
+func (err *Error) Error() string {
+	return err.message
+}
+
+// wrappedError adds context, such as the block or the address concerned, to an error while keeping
+// it comparable with Is
+type wrappedError struct {
+	context string // what the error is about
+	err     error  // the error being wrapped
+}
+
+// Error returns the context followed by the message of the wrapped error.
+func (err *wrappedError) Error() string {
+	return err.context + ": " + err.err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (err *wrappedError) Unwrap() error {
+	return err.err
+}
+
+// Wrap adds context to err, returning nil if err is nil. Is still matches the sentinel err wraps.
+func Wrap(err error, context string) error {
+	if err == nil {
+		return nil
+	}
+
+	return &wrappedError{context, err}
+}
+
+// Wrapf adds formatted context to err, see Wrap.
+func Wrapf(err error, format string, args ...any) error {
+	return Wrap(err, fmt.Sprintf(format, args...))
+}
+
+// Is reports whether err or an error it wraps is target.
+func Is(err, target error) bool {
+	return errors.Is(err, target)
+}
+
+// As finds the first error in the chain of err that matches target and sets target to it.
+func As(err error, target any) bool {
+	return errors.As(err, target)
+}
+
+// ErrDBExists is an error that is returned when a database already exists
+var ErrDBExists = NewError("database already exists")
+
+// ErrDBDoesNotExist is an error that is returned when a database does not exist
+var ErrDBDoesNotExist = NewError("database does not exist")
+
+// ErrNotEnoughFunds is an error that is returned when a transaction does not have enough funds
+var ErrNotEnoughFunds = NewError("not enough funds")
+
+// ErrTransactionNotFound is an error that is returned when a transaction is not found
+var ErrTransactionNotFound = NewError("transaction not found")
+
+// ErrInvalidTransaction is an error that is returned when a transaction is invalid
+var ErrInvalidTransaction = NewError("invalid transaction")
+
+// ErrInvalidAddress is an error that is returned when an address is invalid
+var ErrInvalidAddress = NewError("invalid address")
+
+// ErrBlockExists is an error that is returned when a block already exists
+var ErrBlockExists = NewError("block already exists")
+
+// ErrUnknownCommand is an error that is returned when an unknown command is received
+var ErrUnknownCommand = NewError("unknown command")
+
+// ErrUnknownGetDataType is an error that is returned when an unknown getdata type is received
+var ErrUnknownGetDataType = NewError("unknown getdata type")
+
+// ErrInvalidPublicKey is an error that is returned when a public key is not a point on the curve
+var ErrInvalidPublicKey = NewError("invalid public key")
+
+// ErrPublicKeyNotFound is an error that is returned when no public key is known for an address
+var ErrPublicKeyNotFound = NewError("public key not found")
+
+// ErrMemoTooLarge is an error that is returned when a memo exceeds the maximum size
+var ErrMemoTooLarge = NewError("memo too large")
+
+// ErrInvalidMemo is an error that is returned when a memo cannot be decrypted
+var ErrInvalidMemo = NewError("invalid memo")
+
+// ErrInvalidDataOutput is an error that is returned when a data-carrying output is not standard
+var ErrInvalidDataOutput = NewError("invalid data output")
+
+// ErrDataTooLong is an error that is returned when data does not fit in a QR code
+var ErrDataTooLong = NewError("data too long for a QR code")
+
+// ErrInvalidURI is an error that is returned when a payment URI cannot be parsed
+var ErrInvalidURI = NewError("invalid payment URI")
+
+// ErrDifficultyTooHigh is an error that is returned when generating blocks would take too long
+var ErrDifficultyTooHigh = NewError("difficulty too high to generate blocks on demand, use -force")
+
+// ErrNodeNotRunning is an error that is returned when no node is listening on the node address
+var ErrNodeNotRunning = NewError("node is not running")
+
+// ErrSupplyMismatch is an error that is returned when the supply audit finds inflation
+var ErrSupplyMismatch = NewError("supply does not match the subsidy schedule")
+
+// ErrUnknownVerifyLevel is an error that is returned when an unknown verification level is requested
+var ErrUnknownVerifyLevel = NewError("unknown verification level")
+
+// ErrInvalidHandshake is an error that is returned when a version message fails authentication
+var ErrInvalidHandshake = NewError("invalid handshake signature")
+
+// ErrPeerNotAllowed is an error that is returned when a peer is not in the allowlist
+var ErrPeerNotAllowed = NewError("peer is not in the allowlist")
+
+// ErrBlockNotFound is an error that is returned when a block is not found
+var ErrBlockNotFound = NewError("block not found")
+
+// ErrInvalidTargetBits is an error that is returned when a difficulty is out of range
+var ErrInvalidTargetBits = NewError("target bits must be between 1 and 255")
+
+// ErrInvalidDifficulty is an error that is returned when a block does not meet the required difficulty
+var ErrInvalidDifficulty = NewError("block does not meet the required difficulty")
+
+// ErrNonceExhausted is an error that is returned when no nonce gives a hash below the target
+var ErrNonceExhausted = NewError("no nonce satisfies the target")
+
+// ErrMempoolConflict is an error that is returned when a transaction spends an output already spent in the mempool
+var ErrMempoolConflict = NewError("transaction conflicts with the mempool")
+
+// ErrMempoolFull is an error that is returned when the mempool is full of better paying transactions
+var ErrMempoolFull = NewError("mempool is full")
+
+// ErrInvalidEncoding is an error that is returned when a transaction cannot be decoded
+var ErrInvalidEncoding = NewError("invalid transaction encoding")
+
+// ErrInvalidAmount is an error that is returned when a payment is not worth a positive amount
+var ErrInvalidAmount = NewError("amount must be positive")
+
+// ErrDuplicateRecipient is an error that is returned when a transaction pays the same address twice
+var ErrDuplicateRecipient = NewError("duplicate recipient")
+
+// ErrUnknownCoinSelector is an error that is returned when a coin selection strategy is not known
+var ErrUnknownCoinSelector = NewError("unknown coin selection strategy")
+
+// ErrInvalidSeed is an error that is returned when a wallet seed cannot derive keys
+var ErrInvalidSeed = NewError("invalid wallet seed")
+
+// ErrWalletExists is an error that is returned when a wallet file would be overwritten
+var ErrWalletExists = NewError("wallet file already exists")
+
+// ErrInvalidMnemonic is an error that is returned when a mnemonic phrase has unknown words, a wrong
+// number of words or a bad checksum
+var ErrInvalidMnemonic = NewError("invalid mnemonic phrase")
+
+// ErrMessageTooLarge is an error that is returned when a peer announces a message above the size limit
+var ErrMessageTooLarge = NewError("message too large")
+
+// ErrPeerBackoff is an error that is returned when a peer that could not be reached is not retried yet
+var ErrPeerBackoff = NewError("peer is backing off after a failed connection")
+
+// ErrUnknownNetwork is an error that is returned when a network name is not known
+var ErrUnknownNetwork = NewError("unknown network")
+
+// ErrWrongNetwork is an error that is returned when a peer runs on another network or chain
+var ErrWrongNetwork = NewError("peer is on another network")
+
+// ErrSelfConnection is an error that is returned when a node receives its own handshake
+var ErrSelfConnection = NewError("connected to self")
+
+// ErrHandshakeIncomplete is an error that is returned when a peer sends data before completing the handshake
+var ErrHandshakeIncomplete = NewError("handshake not completed")
+
+// ErrInvalidHeaders is an error that is returned when received headers do not form a valid chain
+var ErrInvalidHeaders = NewError("invalid block headers")
+
+// ErrInvalidHash is an error that is returned when a block hash or a transaction ID is not valid hex
+var ErrInvalidHash = NewError("invalid hash")
+
+// ErrInvalidLimit is an error that is returned when a page size is out of range
+var ErrInvalidLimit = NewError("invalid limit")
+
+// ErrUnknownRoute is an error that is returned when an API path does not exist
+var ErrUnknownRoute = NewError("unknown route")
+
+// ErrUnknownLogLevel is an error that is returned when a log level name is not known
+var ErrUnknownLogLevel = NewError("unknown log level")
+
+// ErrOrphanBlock is an error that is returned when the parent of a received block is not known yet
+var ErrOrphanBlock = NewError("parent block not known")
+
+// ErrInvalidLeafIndex is an error that is returned when a Merkle proof is requested for a leaf that does not exist
+var ErrInvalidLeafIndex = NewError("invalid Merkle leaf index")
+
+// ErrUnsupportedSchema is an error that is returned when a database was written by a newer version of the code
+var ErrUnsupportedSchema = NewError("database schema is newer than supported, upgrade glock")
+
+// ErrDBInUse is an error that is returned when a database is held open by a running node
+var ErrDBInUse = NewError("database is in use, stop the node first")
+
+// ErrNotBlockchain is an error that is returned when a database file holds no chain
+var ErrNotBlockchain = NewError("file is not a blockchain database")
+
+// ErrInvalidBlockFile is an error that is returned when an exported block file cannot be read
+var ErrInvalidBlockFile = NewError("invalid block file")
+
+// ErrWrongGenesis is an error that is returned when imported blocks belong to another chain than the database
+var ErrWrongGenesis = NewError("blocks start from another genesis block")
+
+// ErrMissingKey is an error that is returned when no wallet holds the key to sign an input of a transaction
+var ErrMissingKey = NewError("no wallet holds the key of an input")
+
+// ErrInvalidChainID is an error that is returned when a chain identifier is not valid hex
+var ErrInvalidChainID = NewError("invalid chain ID")
+
+// ErrInvalidConfig is an error that is returned when a configuration file is not valid
+var ErrInvalidConfig = NewError("invalid configuration file")
+
+// ErrUnterminatedQuote is an error that is returned when a command typed in the shell has an unterminated quote
+var ErrUnterminatedQuote = NewError("unterminated quote")
+
+// ErrCommandFailed is an error that is returned by a command of the CLI once its failure is printed
+var ErrCommandFailed = NewError("command failed")
+
+// ErrNotTerminal is an error that is returned when the input of the shell cannot be edited as a terminal
+var ErrNotTerminal = NewError("not a terminal")
+
+// ErrDBLocked is an error that is returned when another process holds the lock of a database
+var ErrDBLocked = NewError("database is locked by another process; is a node running? use RPC instead")
+
+// ErrWalletFileNotFound is an error that is returned when a node has no wallet file
+var ErrWalletFileNotFound = NewError("wallet file not found, create a wallet first")
+
+// ErrWalletFileCorrupt is an error that is returned when a wallet file cannot be decoded
+var ErrWalletFileCorrupt = NewError("wallet file is corrupt, restore it from a backup or from the seed")
+
+// ErrWalletNotFound is an error that is returned when an address is not in the wallet
+var ErrWalletNotFound = NewError("address is not in the wallet")
+
+// ErrInvalidBase58 is an error that is returned when a string has a character outside the Base58 alphabet
+var ErrInvalidBase58 = NewError("invalid Base58 character")
+
+// ErrBlockTooLarge is an error that is returned when a block holds too many transactions or bytes
+var ErrBlockTooLarge = NewError("block is too large")
+
+// ErrDustOutput is an error that is returned when an output is worth less than the dust threshold
+var ErrDustOutput = NewError("output is below the dust threshold")
+
+// ErrValueOverflow is an error that is returned when a total of values of coins does not fit in an int
+var ErrValueOverflow = NewError("value overflow")
+
+// ErrInvalidTimestamp is an error that is returned when a block is timestamped before the median time of its last ancestors or too far in the future
+var ErrInvalidTimestamp = NewError("invalid block timestamp")
+
+// ErrInvalidSignature is an error that is returned when an input of a transaction is not signed by the owner of the output it spends
+var ErrInvalidSignature = NewError("invalid signature")
+
+// ErrUndoNotFound is an error that is returned when the outputs spent by a block are not in the undo journal
+var ErrUndoNotFound = NewError("undo data not found")
+
+// ErrNotLastApplied is an error that is returned when a block other than the last one applied to the UTXO set is disconnected
+var ErrNotLastApplied = NewError("block is not the last applied to the UTXO set")
+
+// ErrCheckpointMismatch is an error that is returned when a block contradicts a checkpoint of the chain
+var ErrCheckpointMismatch = NewError("block does not match the checkpoint")
+
+// ErrInvalidSubsidy is an error that is returned when the subsidy of a new chain is negative
+var ErrInvalidSubsidy = NewError("subsidy must not be negative")
+
+// ErrChainNetwork is an error that is returned when a node is started on another network than the one of its blockchain
+var ErrChainNetwork = NewError("blockchain belongs to another network")
+
+// ErrPayloadTooLarge is an error that is returned when an encoded block or transaction is above the size limit
+var ErrPayloadTooLarge = NewError("payload too large")
+
+// ErrMalformedBlock is an error that is returned when a decoded block is missing a required field
+var ErrMalformedBlock = NewError("malformed block")
+
+// ErrMalformedTransaction is an error that is returned when a decoded transaction is missing a required field
+var ErrMalformedTransaction = NewError("malformed transaction")
+
+// ErrInvalidMultisig is an error that is returned when a multisig output is not locked to between 1 and 16 distinct keys with a threshold in range
+var ErrInvalidMultisig = NewError("invalid multisig parameters")
+
+// ErrObsoletePeer is an error that is returned when a peer runs a protocol version the node does not support, or requires a newer one
+var ErrObsoletePeer = NewError("peer protocol version not supported")
+
+// ErrRejected is an error that is returned when a peer rejects a transaction or a block sent to it
+var ErrRejected = NewError("rejected by peer")
+
+// ErrStaleBlock is an error that is returned when a block submitted does not extend the tip
+var ErrStaleBlock = NewError("block does not extend the tip")
+
+// ErrDuplicateTransaction is an error that is returned when a transaction reuses the ID of a transaction whose outputs are still unspent
+var ErrDuplicateTransaction = NewError("duplicate transaction ID")
+
+// ErrChainChanged is an error that is returned when the main chain is reorganized while it is being iterated
+var ErrChainChanged = NewError("main chain changed during the iteration")
+
+// ErrUnencodable is an error that is returned when a transaction holds a field its binary encoding cannot represent
+var ErrUnencodable = NewError("transaction field cannot be encoded")
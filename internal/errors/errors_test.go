@@ -0,0 +1,56 @@
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestWrapKeepsSentinel(t *testing.T) {
+	err := Wrapf(ErrNotEnoughFunds, "address %s", "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa")
+	err = Wrap(err, "send")
+	err = fmt.Errorf("command failed: %w", err)
+
+	if !Is(err, ErrNotEnoughFunds) {
+		t.Fatalf("Is(%v, ErrNotEnoughFunds) = false, want true", err)
+	}
+
+	if Is(err, ErrInvalidAddress) {
+		t.Fatalf("Is(%v, ErrInvalidAddress) = true, want false", err)
+	}
+
+	// The message holds the whole chain, outermost context first
+	want := "command failed: send: address 1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa: not enough funds"
+	if err.Error() != want {
+		t.Fatalf("message = %q, want %q", err.Error(), want)
+	}
+
+	var target *Error
+	if !As(err, &target) || target != ErrNotEnoughFunds {
+		t.Fatalf("As(%v) = %v, want ErrNotEnoughFunds", err, target)
+	}
+}
+
+func TestWrapNil(t *testing.T) {
+	if err := Wrap(nil, "block 1"); err != nil {
+		t.Fatalf("Wrap(nil) = %v, want nil", err)
+	}
+
+	if err := Wrapf(nil, "block %d", 1); err != nil {
+		t.Fatalf("Wrapf(nil) = %v, want nil", err)
+	}
+}
+
+func TestSentinelsAreDistinct(t *testing.T) {
+	// Two sentinels with the same message are still different errors
+	a, b := NewError("same"), NewError("same")
+	if Is(a, b) || Is(Wrap(a, "context"), b) {
+		t.Fatal("errors with the same message are the same sentinel")
+	}
+
+	// Errors of the standard library wrapped with context are matched too
+	base := errors.New("disk full")
+	if !Is(Wrap(base, "file"), base) {
+		t.Fatal("a wrapped standard error does not match itself")
+	}
+}
@@ -0,0 +1,75 @@
+// Package events implements a publish-subscribe bus for chain, mempool and wallet notifications.
+
+package events
+
+import "sync"
+
+// Kind is the kind of an event
+type Kind int
+
+const (
+	// TxUnconfirmed is published when a transaction left the main chain and went back to the
+	// mempool, waiting to be mined again
+	TxUnconfirmed Kind = iota
+	// TxConflicted is published when a transaction left the main chain and was dropped because it
+	// spends outputs already spent on the new main chain
+	TxConflicted
+	// TxAccepted is published when a transaction entered the mempool, from a peer or the wallet
+	TxAccepted
+	// TipChanged is published when a block became the tip of the chain, mined by the node,
+	// submitted by a miner or received from a peer
+	TipChanged
+)
+
+// Event is a notification published on the bus
+type Event struct {
+	Kind Kind   // Kind is the kind of the event
+	ID   []byte // ID is the hash of the block or transaction the event is about
+}
+
+// Bus delivers published events to every subscriber
+type Bus struct {
+	mu          sync.Mutex              // mu guards subscribers
+	subscribers map[chan Event]struct{} // subscribers are the channels events are delivered to
+}
+
+// NewBus creates an empty bus
+func NewBus() *Bus {
+	return &Bus{subscribers: make(map[chan Event]struct{})}
+}
+
+// Subscribe returns a channel receiving the events published from now on. A subscriber lagging
+// more than buffer events behind misses the events published in the meantime.
+func (b *Bus) Subscribe(buffer int) chan Event {
+	ch := make(chan Event, buffer)
+
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch
+}
+
+// Unsubscribe stops delivering events to a channel returned by Subscribe and closes it
+func (b *Bus) Unsubscribe(ch chan Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[ch]; ok {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
+
+// Publish delivers an event to every subscriber without blocking
+func (b *Bus) Publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
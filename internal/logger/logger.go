@@ -0,0 +1,158 @@
+// Package logger implements leveled logging with key-value fields, one line per message.
+
+package logger
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yanglinshu/glock/internal/errors"
+)
+
+// Level is the severity of a message
+type Level int
+
+const (
+	// LevelDebug is for the details of the protocol, such as every command received
+	LevelDebug Level = iota
+	// LevelInfo is for the progress of the node, such as blocks added and mined
+	LevelInfo
+	// LevelWarn is for problems the node recovers from, such as invalid data sent by a peer
+	LevelWarn
+	// LevelError is for failures the node cannot recover from
+	LevelError
+)
+
+// levelNames are the names of the levels, as printed and parsed
+var levelNames = map[Level]string{
+	LevelDebug: "DEBUG",
+	LevelInfo:  "INFO",
+	LevelWarn:  "WARN",
+	LevelError: "ERROR",
+}
+
+// String returns the name of the level.
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// ParseLevel returns the level with the given name, in any case.
+func ParseLevel(name string) (Level, error) {
+	for level, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, nil
+		}
+	}
+
+	return 0, errors.ErrUnknownLogLevel
+}
+
+// Logger writes messages at a level, followed by fields given as alternating keys and values.
+// Byte slices are printed in hex.
+type Logger interface {
+	Debug(msg string, fields ...interface{})
+	Info(msg string, fields ...interface{})
+	Warn(msg string, fields ...interface{})
+	Error(msg string, fields ...interface{})
+
+	// With returns a logger adding the given fields to every message
+	With(fields ...interface{}) Logger
+}
+
+// textLogger writes messages as lines of text
+type textLogger struct {
+	mu     *sync.Mutex   // serializes the writes, shared by the loggers derived with With
+	w      io.Writer     // the destination of the messages
+	level  Level         // the lowest level written
+	fields []interface{} // the fields added to every message
+}
+
+// New returns a logger writing the messages at level or above to w.
+func New(w io.Writer, level Level) Logger {
+	return &textLogger{mu: &sync.Mutex{}, w: w, level: level}
+}
+
+// Nop returns a logger discarding every message.
+func Nop() Logger {
+	return &textLogger{mu: &sync.Mutex{}, w: io.Discard, level: LevelError + 1}
+}
+
+// Debug writes a message at LevelDebug.
+func (l *textLogger) Debug(msg string, fields ...interface{}) {
+	l.write(LevelDebug, msg, fields)
+}
+
+// Info writes a message at LevelInfo.
+func (l *textLogger) Info(msg string, fields ...interface{}) {
+	l.write(LevelInfo, msg, fields)
+}
+
+// Warn writes a message at LevelWarn.
+func (l *textLogger) Warn(msg string, fields ...interface{}) {
+	l.write(LevelWarn, msg, fields)
+}
+
+// Error writes a message at LevelError.
+func (l *textLogger) Error(msg string, fields ...interface{}) {
+	l.write(LevelError, msg, fields)
+}
+
+// With returns a logger adding the given fields to every message.
+func (l *textLogger) With(fields ...interface{}) Logger {
+	derived := *l
+	derived.fields = append(append([]interface{}{}, l.fields...), fields...)
+
+	return &derived
+}
+
+// write writes a message as a line: the time, the level, the message and the fields
+func (l *textLogger) write(level Level, msg string, fields []interface{}) {
+	if level < l.level {
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString(time.Now().Format("2006/01/02 15:04:05"))
+	b.WriteString(" ")
+	b.WriteString(level.String())
+	b.WriteString(" ")
+	b.WriteString(msg)
+
+	all := append(append([]interface{}{}, l.fields...), fields...)
+	for i := 0; i < len(all); i += 2 {
+		var value interface{} = "<missing>"
+		if i+1 < len(all) {
+			value = all[i+1]
+		}
+
+		fmt.Fprintf(&b, " %v=%s", all[i], formatValue(value))
+	}
+	b.WriteString("\n")
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	io.WriteString(l.w, b.String())
+}
+
+// formatValue formats the value of a field, quoting strings holding spaces
+func formatValue(value interface{}) string {
+	var s string
+	switch v := value.(type) {
+	case []byte:
+		return fmt.Sprintf("%x", v)
+	case error:
+		s = v.Error()
+	default:
+		s = fmt.Sprint(v)
+	}
+
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return fmt.Sprintf("%q", s)
+	}
+
+	return s
+}
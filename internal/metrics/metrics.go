@@ -0,0 +1,36 @@
+// Package metrics implements the registry of runtime and node metrics, published as expvar
+// variables under the "glock" map.
+
+package metrics
+
+import (
+	"expvar"
+	"net/http"
+)
+
+// registry holds every metric of the node
+var registry = expvar.NewMap("glock")
+
+// Set sets the value of a gauge.
+func Set(name string, value int64) {
+	v := new(expvar.Int)
+	v.Set(value)
+	registry.Set(name, v)
+}
+
+// SetFloat sets the value of a floating point gauge.
+func SetFloat(name string, value float64) {
+	v := new(expvar.Float)
+	v.Set(value)
+	registry.Set(name, v)
+}
+
+// Add increments a counter by delta.
+func Add(name string, delta int64) {
+	registry.Add(name, delta)
+}
+
+// Handler returns an HTTP handler serving every metric as JSON.
+func Handler() http.Handler {
+	return expvar.Handler()
+}
@@ -0,0 +1,518 @@
+// Package qr implements a QR code encoder for addresses and payment requests. It only supports
+// byte mode at error correction level M, up to version 10, which is plenty for glock URIs.
+
+package qr
+
+import (
+	"github.com/yanglinshu/glock/internal/errors"
+)
+
+// maxVersion is the largest QR code version supported by the encoder
+const maxVersion = 10
+
+// blockLayout describes how the codewords of a version are split into error correction blocks.
+type blockLayout struct {
+	ecPerBlock int // ecPerBlock is the number of error correction codewords in every block
+	shortCount int // shortCount is the number of blocks holding shortLen data codewords
+	shortLen   int // shortLen is the number of data codewords in a short block
+	longCount  int // longCount is the number of blocks holding shortLen+1 data codewords
+}
+
+// layouts holds the block layout for error correction level M, indexed by version
+var layouts = [maxVersion + 1]blockLayout{
+	{},
+	{10, 1, 16, 0},
+	{16, 1, 28, 0},
+	{26, 1, 44, 0},
+	{18, 2, 32, 0},
+	{24, 2, 43, 0},
+	{16, 4, 27, 0},
+	{18, 4, 31, 0},
+	{22, 2, 38, 2},
+	{22, 3, 36, 2},
+	{26, 4, 43, 1},
+}
+
+// alignmentPositions holds the centers of the alignment patterns, indexed by version
+var alignmentPositions = [maxVersion + 1][]int{
+	{}, {}, {6, 18}, {6, 22}, {6, 26}, {6, 30}, {6, 34}, {6, 22, 38}, {6, 24, 42}, {6, 26, 46}, {6, 28, 50},
+}
+
+// dataCodewords returns the number of data codewords a block layout can hold.
+func (l blockLayout) dataCodewords() int {
+	return l.shortCount*l.shortLen + l.longCount*(l.shortLen+1)
+}
+
+// Code is an encoded QR code, a square of dark and light modules.
+type Code struct {
+	Size       int      // Size is the number of modules on each side
+	modules    [][]bool // modules holds the color of every module, true for dark
+	isFunction [][]bool // isFunction marks the modules that belong to function patterns
+}
+
+// Encode encodes data in the smallest QR code that can hold it.
+func Encode(data []byte) (*Code, error) {
+	version := 0
+	for v := 1; v <= maxVersion; v++ {
+		if 4+countBits(v)+8*len(data) <= layouts[v].dataCodewords()*8 {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, errors.ErrDataTooLong
+	}
+
+	size := 17 + 4*version
+	c := &Code{Size: size, modules: newGrid(size), isFunction: newGrid(size)}
+
+	c.drawFunctionPatterns(version)
+	c.drawCodewords(addErrorCorrection(encodeData(data, version), version))
+
+	// Pick the mask with the lowest penalty
+	bestMask, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		c.applyMask(mask)
+		c.drawFormatBits(mask)
+		if penalty := c.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			bestMask, bestPenalty = mask, penalty
+		}
+		c.applyMask(mask) // masks are XOR, so applying it again undoes it
+	}
+
+	c.applyMask(bestMask)
+	c.drawFormatBits(bestMask)
+
+	return c, nil
+}
+
+// Dark reports whether the module at column x and row y is dark.
+func (c *Code) Dark(x, y int) bool {
+	return c.modules[y][x]
+}
+
+// newGrid allocates a size by size grid of modules.
+func newGrid(size int) [][]bool {
+	grid := make([][]bool, size)
+	for i := range grid {
+		grid[i] = make([]bool, size)
+	}
+
+	return grid
+}
+
+// countBits returns the width of the character count field in byte mode.
+func countBits(version int) int {
+	if version < 10 {
+		return 8
+	}
+
+	return 16
+}
+
+// encodeData builds the data codewords: mode indicator, character count, payload, terminator and
+// padding up to the capacity of the version.
+func encodeData(data []byte, version int) []byte {
+	var bb bitBuffer
+
+	bb.append(0x4, 4) // byte mode
+	bb.append(len(data), countBits(version))
+	for _, b := range data {
+		bb.append(int(b), 8)
+	}
+
+	capacity := layouts[version].dataCodewords() * 8
+	terminator := capacity - len(bb)
+	if terminator > 4 {
+		terminator = 4
+	}
+	bb.append(0, terminator)
+	bb.append(0, (8-len(bb)%8)%8)
+
+	for pad := 0xec; len(bb) < capacity; pad ^= 0xec ^ 0x11 {
+		bb.append(pad, 8)
+	}
+
+	return bb.bytes()
+}
+
+// addErrorCorrection splits the data codewords into blocks, computes the error correction
+// codewords of each block and interleaves the result.
+func addErrorCorrection(data []byte, version int) []byte {
+	layout := layouts[version]
+	generator := rsGenerator(layout.ecPerBlock)
+
+	var blocks, ecBlocks [][]byte
+	for i, offset := 0, 0; i < layout.shortCount+layout.longCount; i++ {
+		n := layout.shortLen
+		if i >= layout.shortCount {
+			n++
+		}
+
+		block := data[offset : offset+n]
+		blocks = append(blocks, block)
+		ecBlocks = append(ecBlocks, rsRemainder(block, generator))
+		offset += n
+	}
+
+	var result []byte
+	for i := 0; i <= layout.shortLen; i++ {
+		for _, block := range blocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+
+	for i := 0; i < layout.ecPerBlock; i++ {
+		for _, ec := range ecBlocks {
+			result = append(result, ec[i])
+		}
+	}
+
+	return result
+}
+
+// setFunction colors a module that belongs to a function pattern.
+func (c *Code) setFunction(x, y int, dark bool) {
+	c.modules[y][x] = dark
+	c.isFunction[y][x] = true
+}
+
+// drawFunctionPatterns draws the timing, finder and alignment patterns and reserves the format and
+// version areas.
+func (c *Code) drawFunctionPatterns(version int) {
+	for i := 0; i < c.Size; i++ {
+		c.setFunction(6, i, i%2 == 0)
+		c.setFunction(i, 6, i%2 == 0)
+	}
+
+	c.drawFinder(3, 3)
+	c.drawFinder(c.Size-4, 3)
+	c.drawFinder(3, c.Size-4)
+
+	positions := alignmentPositions[version]
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			// Skip the corners taken by the finder patterns
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			c.drawAlignment(x, y)
+		}
+	}
+
+	c.drawFormatBits(0)
+	c.drawVersion(version)
+}
+
+// drawFinder draws a finder pattern and its separator centered at x, y.
+func (c *Code) drawFinder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || xx >= c.Size || yy < 0 || yy >= c.Size {
+				continue
+			}
+
+			dist := max(abs(dx), abs(dy))
+			c.setFunction(xx, yy, dist != 2 && dist != 4)
+		}
+	}
+}
+
+// drawAlignment draws an alignment pattern centered at x, y.
+func (c *Code) drawAlignment(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			c.setFunction(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// drawFormatBits draws both copies of the format information for level M and the given mask.
+func (c *Code) drawFormatBits(mask int) {
+	data := mask // level M is encoded as 00
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+
+	// First copy, around the top left finder pattern
+	for i := 0; i <= 5; i++ {
+		c.setFunction(8, i, bit(bits, i))
+	}
+	c.setFunction(8, 7, bit(bits, 6))
+	c.setFunction(8, 8, bit(bits, 7))
+	c.setFunction(7, 8, bit(bits, 8))
+	for i := 9; i < 15; i++ {
+		c.setFunction(14-i, 8, bit(bits, i))
+	}
+
+	// Second copy, split between the top right and bottom left finder patterns
+	for i := 0; i < 8; i++ {
+		c.setFunction(c.Size-1-i, 8, bit(bits, i))
+	}
+	for i := 8; i < 15; i++ {
+		c.setFunction(8, c.Size-15+i, bit(bits, i))
+	}
+	c.setFunction(8, c.Size-8, true) // the dark module
+}
+
+// drawVersion draws both copies of the version information, present from version 7.
+func (c *Code) drawVersion(version int) {
+	if version < 7 {
+		return
+	}
+
+	rem := version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1f25)
+	}
+	bits := version<<12 | rem
+
+	for i := 0; i < 18; i++ {
+		a, b := c.Size-11+i%3, i/3
+		c.setFunction(a, b, bit(bits, i))
+		c.setFunction(b, a, bit(bits, i))
+	}
+}
+
+// drawCodewords places the codewords in the zigzag order defined by the standard, skipping the
+// function patterns.
+func (c *Code) drawCodewords(codewords []byte) {
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 { // skip the vertical timing pattern
+			right = 5
+		}
+
+		for vert := 0; vert < c.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 { // upward column
+					y = c.Size - 1 - vert
+				}
+
+				if !c.isFunction[y][x] && i < len(codewords)*8 {
+					c.modules[y][x] = bit(int(codewords[i>>3]), 7-i&7)
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyMask flips the data modules selected by the mask pattern.
+func (c *Code) applyMask(mask int) {
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.isFunction[y][x] {
+				continue
+			}
+
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+
+			c.modules[y][x] = c.modules[y][x] != invert
+		}
+	}
+}
+
+// finderLike are the module sequences that look like part of a finder pattern
+var finderLike = [][]bool{
+	{true, false, true, true, true, false, true, false, false, false, false},
+	{false, false, false, false, true, false, true, true, true, false, true},
+}
+
+// penalty scores how hard the code is to read, following the four rules of the standard.
+func (c *Code) penalty() int {
+	result := 0
+
+	// Rules 1 and 3, on rows and columns alike
+	for _, line := range c.lines() {
+		run := 1
+		for i := 1; i <= len(line); i++ {
+			if i < len(line) && line[i] == line[i-1] {
+				run++
+				continue
+			}
+			if run >= 5 {
+				result += 3 + run - 5
+			}
+			run = 1
+		}
+
+		for i := 0; i+len(finderLike[0]) <= len(line); i++ {
+			for _, pattern := range finderLike {
+				if equal(line[i:i+len(pattern)], pattern) {
+					result += 40
+				}
+			}
+		}
+	}
+
+	// Rule 2, 2x2 blocks of the same color
+	dark := 0
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.modules[y][x] {
+				dark++
+			}
+
+			if x+1 < c.Size && y+1 < c.Size {
+				color := c.modules[y][x]
+				if color == c.modules[y][x+1] && color == c.modules[y+1][x] && color == c.modules[y+1][x+1] {
+					result += 3
+				}
+			}
+		}
+	}
+
+	// Rule 4, balance of dark and light modules
+	total := c.Size * c.Size
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	if k > 0 {
+		result += k * 10
+	}
+
+	return result
+}
+
+// lines returns every row and every column of the code.
+func (c *Code) lines() [][]bool {
+	var lines [][]bool
+	for i := 0; i < c.Size; i++ {
+		column := make([]bool, c.Size)
+		for j := 0; j < c.Size; j++ {
+			column[j] = c.modules[j][i]
+		}
+		lines = append(lines, c.modules[i], column)
+	}
+
+	return lines
+}
+
+// rsGenerator returns the Reed-Solomon generator polynomial of the given degree, highest
+// coefficient first and without the leading 1.
+func rsGenerator(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+
+	return result
+}
+
+// rsRemainder returns the error correction codewords of data for the generator polynomial.
+func rsRemainder(data, generator []byte) []byte {
+	result := make([]byte, len(generator))
+
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+
+		for i := range result {
+			result[i] ^= gfMultiply(generator[i], factor)
+		}
+	}
+
+	return result
+}
+
+// gfMultiply multiplies two elements of GF(2^8) modulo the QR polynomial x^8+x^4+x^3+x^2+1.
+func gfMultiply(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11d)
+		z ^= int((y>>i)&1) * int(x)
+	}
+
+	return byte(z)
+}
+
+// bitBuffer accumulates bits, most significant first.
+type bitBuffer []bool
+
+// append appends the n lowest bits of value.
+func (bb *bitBuffer) append(value, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*bb = append(*bb, bit(value, i))
+	}
+}
+
+// bytes packs the bits into bytes. The buffer must hold a whole number of bytes.
+func (bb bitBuffer) bytes() []byte {
+	result := make([]byte, len(bb)/8)
+	for i, b := range bb {
+		if b {
+			result[i/8] |= 1 << (7 - i%8)
+		}
+	}
+
+	return result
+}
+
+// bit reports whether bit i of x is set.
+func bit(x, i int) bool {
+	return (x>>i)&1 != 0
+}
+
+// equal reports whether two module sequences are identical.
+func equal(a, b []bool) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// abs returns the absolute value of x.
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+
+	return x
+}
+
+// max returns the larger of a and b.
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
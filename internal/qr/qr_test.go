@@ -0,0 +1,304 @@
+package qr
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// decode reads the payload of a code back: it reads the format information, removes the mask,
+// collects the codewords in placement order, checks their error correction and parses the byte
+// mode segment.
+func decode(c *Code) ([]byte, error) {
+	version := (c.Size - 17) / 4
+	if version < 1 || version > maxVersion || c.Size != 17+4*version {
+		return nil, fmt.Errorf("size %d is not the size of a supported version", c.Size)
+	}
+
+	// The first copy of the format information, laid out as drawFormatBits does
+	bits := 0
+	for i := 0; i <= 5; i++ {
+		bits |= boolBit(c.Dark(8, i)) << i
+	}
+	bits |= boolBit(c.Dark(8, 7)) << 6
+	bits |= boolBit(c.Dark(8, 8)) << 7
+	bits |= boolBit(c.Dark(7, 8)) << 8
+	for i := 9; i < 15; i++ {
+		bits |= boolBit(c.Dark(14-i, 8)) << i
+	}
+
+	format := (bits ^ 0x5412) >> 10
+	if format>>3 != 0 {
+		return nil, fmt.Errorf("error correction level %d, want M", format>>3)
+	}
+	mask := format & 7
+
+	// Rebuild the function patterns of the version to find the data modules, then unmask them
+	data := &Code{Size: c.Size, modules: newGrid(c.Size), isFunction: newGrid(c.Size)}
+	data.drawFunctionPatterns(version)
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !data.isFunction[y][x] {
+				data.modules[y][x] = c.Dark(x, y)
+			}
+		}
+	}
+	data.applyMask(mask)
+
+	layout := layouts[version]
+	blockCount := layout.shortCount + layout.longCount
+	codewords := make([]byte, layout.dataCodewords()+blockCount*layout.ecPerBlock)
+
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+
+		for vert := 0; vert < c.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if (right+1)&2 == 0 {
+					y = c.Size - 1 - vert
+				}
+
+				if !data.isFunction[y][x] && i < len(codewords)*8 {
+					if data.modules[y][x] {
+						codewords[i>>3] |= 1 << (7 - i&7)
+					}
+					i++
+				}
+			}
+		}
+	}
+
+	// Undo the interleaving, checking the error correction codewords of every block
+	blocks := make([][]byte, blockCount)
+	k := 0
+	for i := 0; i <= layout.shortLen; i++ {
+		for b := range blocks {
+			if i < layout.shortLen || b >= layout.shortCount {
+				blocks[b] = append(blocks[b], codewords[k])
+				k++
+			}
+		}
+	}
+
+	generator := rsGenerator(layout.ecPerBlock)
+	var payload []byte
+	for b, block := range blocks {
+		var ec []byte
+		for i := 0; i < layout.ecPerBlock; i++ {
+			ec = append(ec, codewords[k+i*blockCount+b])
+		}
+
+		if !bytes.Equal(rsRemainder(block, generator), ec) {
+			return nil, fmt.Errorf("block %d fails its error correction check", b)
+		}
+
+		payload = append(payload, block...)
+	}
+
+	// Byte mode segment: mode, count, then the bytes
+	read := func(offset, n int) int {
+		v := 0
+		for i := offset; i < offset+n; i++ {
+			v = v<<1 | int(payload[i/8]>>(7-i%8)&1)
+		}
+		return v
+	}
+
+	if mode := read(0, 4); mode != 0x4 {
+		return nil, fmt.Errorf("mode %x, want byte mode", mode)
+	}
+
+	count := read(4, countBits(version))
+	offset := 4 + countBits(version)
+	if offset+8*count > len(payload)*8 {
+		return nil, fmt.Errorf("count %d exceeds the capacity", count)
+	}
+
+	result := make([]byte, count)
+	for i := range result {
+		result[i] = byte(read(offset+8*i, 8))
+	}
+
+	return result, nil
+}
+
+// boolBit returns 1 if b is set
+func boolBit(b bool) int {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+// fromPNG reads the modules of a code from an image rendered by PNG at the given scale, checking
+// that the quiet zone is light
+func fromPNG(t *testing.T, img []byte, scale int) *Code {
+	t.Helper()
+
+	decoded, err := png.Decode(bytes.NewReader(img))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	width := decoded.Bounds().Dx()
+	if width%scale != 0 || width != decoded.Bounds().Dy() {
+		t.Fatalf("image of %dx%d pixels is not a square of %d pixel modules", width, decoded.Bounds().Dy(), scale)
+	}
+
+	size := width/scale - 2*quietZone
+	c := &Code{Size: size, modules: newGrid(size)}
+
+	for y := 0; y < width/scale; y++ {
+		for x := 0; x < width/scale; x++ {
+			r, _, _, _ := decoded.At(x*scale+scale/2, y*scale+scale/2).RGBA()
+			dark := r < 0x8000
+
+			inside := x >= quietZone && y >= quietZone && x < size+quietZone && y < size+quietZone
+			if !inside {
+				if dark {
+					t.Fatalf("dark module at %d, %d in the quiet zone", x, y)
+				}
+				continue
+			}
+
+			c.modules[y-quietZone][x-quietZone] = dark
+		}
+	}
+
+	return c
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	for version := 1; version <= maxVersion; version++ {
+		// The longest payload each version holds
+		n := (layouts[version].dataCodewords()*8 - 4 - countBits(version)) / 8
+		data := make([]byte, n)
+		for i := range data {
+			data[i] = byte(i*7 + version)
+		}
+
+		c, err := Encode(data)
+		if err != nil {
+			t.Fatalf("Encode of %d bytes: %v", n, err)
+		}
+
+		if c.Size != 17+4*version {
+			t.Fatalf("Encode of %d bytes made a code of size %d, want version %d", n, c.Size, version)
+		}
+
+		got, err := decode(c)
+		if err != nil {
+			t.Fatalf("decoding version %d: %v", version, err)
+		}
+
+		if !bytes.Equal(got, data) {
+			t.Fatalf("version %d decodes to %x, want %x", version, got, data)
+		}
+	}
+}
+
+func TestEncodeTooLong(t *testing.T) {
+	n := (layouts[maxVersion].dataCodewords()*8-4-countBits(maxVersion))/8 + 1
+
+	_, err := Encode(make([]byte, n))
+	if !errors.Is(err, errors.ErrDataTooLong) {
+		t.Fatalf("Encode of %d bytes = %v, want ErrDataTooLong", n, err)
+	}
+}
+
+func TestPaymentRequestPNGRoundTrip(t *testing.T) {
+	w, err := transaction.NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pubKeyHash, err := transaction.HashPubKey(w.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := transaction.PaymentRequest{Address: transaction.NewAddress(pubKeyHash, transaction.Mainnet), Amount: 42, Label: "invoice #42"}
+
+	c, err := Encode([]byte(request.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := c.PNG(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload, err := decode(fromPNG(t, img, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := transaction.ParsePaymentURI(string(payload), transaction.Mainnet)
+	if err != nil {
+		t.Fatalf("ParsePaymentURI(%q): %v", payload, err)
+	}
+
+	if parsed.Address.String() != request.Address.String() || parsed.Amount != request.Amount || parsed.Label != request.Label {
+		t.Fatalf("payment request read back = %+v, want %+v", parsed, request)
+	}
+}
+
+func TestTerminalMatchesModules(t *testing.T) {
+	c, err := Encode([]byte("1KXtiGFFFrG1S2gcjZjbB8XAw3TXQQrpmf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(c.Terminal(), "\n"), "\n")
+	width := c.Size + 2*quietZone
+	if len(lines) != (width+1)/2 {
+		t.Fatalf("rendering has %d lines, want %d", len(lines), (width+1)/2)
+	}
+
+	// Light modules are drawn, so each character holds the light halves of two rows
+	halves := map[rune][2]bool{'█': {true, true}, '▀': {true, false}, '▄': {false, true}, ' ': {false, false}}
+	for row, line := range lines {
+		runes := []rune(line)
+		if len(runes) != width {
+			t.Fatalf("line %d is %d characters wide, want %d", row, len(runes), width)
+		}
+
+		for x, r := range runes {
+			light, ok := halves[r]
+			if !ok {
+				t.Fatalf("unexpected character %q at %d, %d", r, x, row)
+			}
+
+			for half := 0; half < 2; half++ {
+				y := 2*row + half
+				if y >= width {
+					continue
+				}
+
+				if light[half] == c.darkAt(x, y) {
+					t.Fatalf("module %d, %d is drawn the wrong color", x, y)
+				}
+			}
+		}
+	}
+
+	payload, err := decode(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(payload) != "1KXtiGFFFrG1S2gcjZjbB8XAw3TXQQrpmf" {
+		t.Fatalf("payload = %q", payload)
+	}
+}
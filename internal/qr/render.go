@@ -0,0 +1,75 @@
+package qr
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+)
+
+// quietZone is the width of the light border around the code, in modules
+const quietZone = 4
+
+// darkAt reports whether the module at x, y is dark, treating the quiet zone as light.
+func (c *Code) darkAt(x, y int) bool {
+	x -= quietZone
+	y -= quietZone
+	if x < 0 || y < 0 || x >= c.Size || y >= c.Size {
+		return false
+	}
+
+	return c.Dark(x, y)
+}
+
+// PNG renders the code as a PNG image with scale pixels per module.
+func (c *Code) PNG(scale int) ([]byte, error) {
+	width := (c.Size + 2*quietZone) * scale
+	img := image.NewGray(image.Rect(0, 0, width, width))
+
+	for y := 0; y < width; y++ {
+		for x := 0; x < width; x++ {
+			shade := color.White
+			if c.darkAt(x/scale, y/scale) {
+				shade = color.Black
+			}
+			img.Set(x, y, shade)
+		}
+	}
+
+	var buff bytes.Buffer
+	err := png.Encode(&buff, img)
+	if err != nil {
+		return nil, err
+	}
+
+	return buff.Bytes(), nil
+}
+
+// Terminal renders the code with UTF-8 half blocks, two rows of modules per line. Light modules
+// are drawn as blocks, so the code reads correctly on a dark terminal background.
+func (c *Code) Terminal() string {
+	var sb strings.Builder
+	width := c.Size + 2*quietZone
+
+	for y := 0; y < width; y += 2 {
+		for x := 0; x < width; x++ {
+			top := !c.darkAt(x, y)
+			bottom := y+1 < width && !c.darkAt(x, y+1)
+
+			switch {
+			case top && bottom:
+				sb.WriteString("█")
+			case top:
+				sb.WriteString("▀")
+			case bottom:
+				sb.WriteString("▄")
+			default:
+				sb.WriteString(" ")
+			}
+		}
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
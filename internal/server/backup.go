@@ -0,0 +1,59 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/yanglinshu/glock/internal/errors"
+)
+
+// serveBackup streams a consistent copy of the database in reply to GET /backup, see
+// blockchain.Blockchain.Backup
+func (n *Node) serveBackup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "only GET is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !n.authorized(r) {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "blockchain_"+n.config.NodeID+".db"))
+
+	err := n.bc.Backup(w)
+	if err != nil {
+		n.logger.Warn("Failed to stream backup", "remote", r.RemoteAddr, "err", err)
+	}
+}
+
+// FetchBackup pulls a backup of the database from the RPC server of a running node on the local
+// port and writes it to w. token is the bearer token of the server, if any. It returns
+// ErrNodeNotRunning if the server is not reachable.
+func FetchBackup(port int, token string, w io.Writer) error {
+	request, err := http.NewRequest(http.MethodGet, "http://"+localAddress(strconv.Itoa(port))+"/backup", nil)
+	if err != nil {
+		return err
+	}
+
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return errors.ErrNodeNotRunning
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return errors.NewError(fmt.Sprintf("backup failed: %s", response.Status))
+	}
+
+	_, err = io.Copy(w, response.Body)
+	return err
+}
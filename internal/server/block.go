@@ -1,338 +1,415 @@
-package server
-
-import (
-	"bytes"
-	"encoding/gob"
-	"encoding/hex"
-	"log"
-
-	"github.com/yanglinshu/glock/internal/block"
-	"github.com/yanglinshu/glock/internal/blockchain"
-	"github.com/yanglinshu/glock/internal/errors"
-	"github.com/yanglinshu/glock/internal/transaction"
-	"github.com/yanglinshu/glock/internal/util"
-)
-
-// Block is the block command
-type Block struct {
-	AddrFrom string // the address of the node
-	Block    []byte // the block data
-}
-
-// sendBlock sends the block to the known nodes
-func sendBlock(addr string, b *block.Block) error {
-	sl, err := b.Serialize()
-	if err != nil {
-		return err
-	}
-
-	payload, err := util.GobEncode(Block{nodeAddress, sl})
-	if err != nil {
-		return err
-	}
-
-	request := append(commandToBytes("block"), payload...)
-
-	err = sendData(addr, request)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// handleBlock handles the block command
-func handleBlock(request []byte, bc *blockchain.Blockchain) error {
-	var buff bytes.Buffer
-	var payload Block
-
-	buff.Write(request[commandLength:])
-	dec := gob.NewDecoder(&buff)
-	err := dec.Decode(&payload)
-	if err != nil {
-		return err
-	}
-
-	blockData := payload.Block
-	bl, err := block.DeserializeBlock(blockData)
-	if err != nil {
-		return err
-	}
-
-	log.Printf("Received a new block!")
-	bc.AddBlock(bl)
-
-	log.Printf("Added block %x", bl.Hash)
-
-	if len(blocksInTransit) > 0 {
-		blockHash := blocksInTransit[0]
-		sendGetData(payload.AddrFrom, "block", blockHash)
-
-		blocksInTransit = blocksInTransit[1:]
-	} else {
-		UTXOSet := blockchain.UTXOSet{Blockchain: bc}
-		UTXOSet.Reindex()
-	}
-
-	return nil
-}
-
-// Tx is the transaction
-type Tx struct {
-	AddrFrom    string
-	Transaction []byte
-}
-
-// sendTx sends the transaction to the known nodes
-func sendTx(addr string, tx *transaction.Transaction) error {
-	sl, err := tx.Serialize()
-	if err != nil {
-		return err
-	}
-
-	data := Tx{nodeAddress, sl}
-	payload, err := util.GobEncode(data)
-	if err != nil {
-		return err
-	}
-	request := append(commandToBytes("tx"), payload...)
-
-	sendData(addr, request)
-	return nil
-}
-
-// handleTx handles the tx command
-func handleTx(request []byte, bc *blockchain.Blockchain) error {
-	var buff bytes.Buffer
-	var payload Tx
-
-	buff.Write(request[commandLength:])
-	dec := gob.NewDecoder(&buff)
-	err := dec.Decode(&payload)
-	if err != nil {
-		return err
-	}
-
-	txData := payload.Transaction
-	tx, err := transaction.DeserializeTransaction(txData)
-	if err != nil {
-		return err
-	}
-
-	// Save the transaction to the mempool
-	txID := hex.EncodeToString(tx.ID)
-	mempool[txID] = tx
-
-	if nodeAddress == knownNodes[0] { // If this is the coordinator node
-		for _, node := range knownNodes {
-			if node != nodeAddress && node != payload.AddrFrom {
-				sendInv(node, "tx", [][]byte{tx.ID})
-			}
-		}
-	} else {
-		if len(mempool) >= 2 && len(miningAddress) > 0 {
-		MineTransactions:
-			var txs []*transaction.Transaction
-			for id := range mempool {
-				tx := mempool[id]
-				if ok, err := bc.VerifyTransaction(&tx); err != nil {
-					return err
-				} else if ok {
-					txs = append(txs, &tx)
-				}
-			}
-
-			if len(txs) == 0 {
-				log.Println("All transactions are invalid. Waiting for new transactions")
-				return nil
-			}
-
-			cbTx, err := transaction.NewCoinbaseTX(miningAddress, "")
-			if err != nil {
-				return err
-			}
-			txs = append(txs, cbTx)
-
-			// Create a new block containing the transactions
-			newBlock, err := bc.MineBlock(txs)
-			if err != nil {
-				return err
-			}
-
-			UTXOSet := blockchain.UTXOSet{Blockchain: bc}
-			UTXOSet.Reindex()
-
-			log.Printf("New block is mined: %x", newBlock.Hash)
-
-			// Clear the mempool
-			for _, tx := range txs {
-				txID := hex.EncodeToString(tx.ID)
-				delete(mempool, txID)
-			}
-
-			// Broadcast the new block to all the nodes
-			for _, node := range knownNodes {
-				if node != nodeAddress {
-					sendInv(node, "block", [][]byte{newBlock.Hash})
-				}
-			}
-
-			if len(mempool) > 0 {
-				goto MineTransactions
-			}
-		}
-	}
-	return nil
-}
-
-// Inv shows other nodes what blocks or transactions it has
-type Inv struct {
-	AddrFrom string
-	Type     string
-	Items    [][]byte
-}
-
-// sendInv sends the inventory to the known nodes
-func sendInv(addr, kind string, items [][]byte) error {
-	inventory := Inv{nodeAddress, kind, items}
-	payload, err := util.GobEncode(inventory)
-	if err != nil {
-		return err
-	}
-
-	request := append(commandToBytes("inv"), payload...)
-	sendData(addr, request)
-	return nil
-}
-
-// handleInv handles the inv command
-func handleInv(request []byte, bc *blockchain.Blockchain) error {
-	var buff bytes.Buffer
-	var payload Inv
-
-	buff.Write(request[commandLength:])
-	dec := gob.NewDecoder(&buff)
-	err := dec.Decode(&payload)
-	if err != nil {
-		return err
-	}
-
-	log.Printf("Received inventory with %d %s\n", len(payload.Items), payload.Type)
-
-	if payload.Type == "block" {
-		blocksInTransit = payload.Items
-
-		blockHash := payload.Items[0]
-		sendGetData(payload.AddrFrom, "block", blockHash)
-
-		newInTransit := [][]byte{}
-		for _, b := range blocksInTransit {
-			if !bytes.Equal(b, blockHash) {
-				newInTransit = append(newInTransit, b)
-			}
-		}
-		blocksInTransit = newInTransit
-	}
-
-	if payload.Type == "tx" {
-		txID := hex.EncodeToString(payload.Items[0])
-		if mempool[txID].ID == nil {
-			sendGetData(payload.AddrFrom, "tx", payload.Items[0])
-		}
-	}
-
-	return nil
-}
-
-// GetBlocks is the getblocks command
-type GetBlocks struct {
-	AddrFrom string // the address of the node
-}
-
-// requestBlocks requests the blocks from the known nodes
-func requestBlocks() {
-	for _, node := range knownNodes {
-		sendGetBlocks(node)
-	}
-}
-
-// sendGetBlocks sends the getblocks command to the given address
-func sendGetBlocks(addr string) error {
-	payload, err := util.GobEncode(GetBlocks{nodeAddress})
-	if err != nil {
-		return err
-	}
-
-	request := append(commandToBytes("getblocks"), payload...)
-	sendData(addr, request)
-	return nil
-}
-
-// handleGetBlocks handles the getblocks command
-func handleGetBlocks(request []byte, bc *blockchain.Blockchain) error {
-	var buff bytes.Buffer
-	var payload GetBlocks
-
-	buff.Write(request[commandLength:])
-	dec := gob.NewDecoder(&buff)
-	err := dec.Decode(&payload)
-	if err != nil {
-		return err
-	}
-
-	blocks, err := bc.GetBlockHashes()
-	if err != nil {
-		return err
-	}
-	sendInv(payload.AddrFrom, "block", blocks)
-
-	return nil
-}
-
-// GetData is a message that requests data from another node
-type GetData struct {
-	AddrFrom string // the address of the node that sent the message
-	Type     string // the type of data requested
-	ID       []byte // the ID of the data requested
-}
-
-// sendGetData sends a GetData message to the given address
-func sendGetData(addr, kind string, id []byte) error {
-	payload, err := util.GobEncode(GetData{nodeAddress, kind, id})
-	if err != nil {
-		return err
-	}
-
-	request := append(commandToBytes("getdata"), payload...)
-	sendData(addr, request)
-	return nil
-}
-
-// handleGetData handles a GetData message
-func handleGetData(request []byte, bc *blockchain.Blockchain) error {
-	var buff bytes.Buffer
-	var payload GetData
-
-	buff.Write(request[commandLength:])
-	dec := gob.NewDecoder(&buff)
-	err := dec.Decode(&payload)
-	if err != nil {
-		return err
-	}
-
-	if payload.Type == "block" { // if the data requested is a block
-		block, err := bc.GetBlock(payload.ID)
-		if err != nil {
-			return err
-		}
-		sendBlock(payload.AddrFrom, block)
-	} else if payload.Type == "tx" { // if the data requested is a transaction
-		txID := hex.EncodeToString(payload.ID)
-		tx := mempool[txID]
-		sendTx(payload.AddrFrom, &tx)
-	} else {
-		return errors.ErrUnknownGetDataType
-	}
-
-	return nil
-}
+package server
+
+import (
+	"bytes"
+	"encoding/gob"
+	"net"
+
+	"github.com/yanglinshu/glock/internal/block"
+	"github.com/yanglinshu/glock/internal/blockchain"
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/events"
+	"github.com/yanglinshu/glock/internal/metrics"
+	"github.com/yanglinshu/glock/internal/transaction"
+	"github.com/yanglinshu/glock/internal/util"
+)
+
+// Block is the block command
+type Block struct {
+	AddrFrom string // the address of the node
+	Block    []byte // the block data
+}
+
+// sendBlock sends the block to the known nodes
+func (n *Node) sendBlock(addr string, b *block.Block) error {
+	sl, err := b.Serialize()
+	if err != nil {
+		return err
+	}
+
+	payload, err := util.GobEncode(Block{n.address, sl})
+	if err != nil {
+		return err
+	}
+
+	request := append(commandToBytes("block"), payload...)
+
+	err = n.sendData(addr, request)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// handleBlock handles the block command
+func (n *Node) handleBlock(request []byte) error {
+	var buff bytes.Buffer
+	var payload Block
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		return err
+	}
+
+	blockData := payload.Block
+	bl, err := block.DeserializeBlock(blockData)
+	if err != nil {
+		n.sendReject(payload.AddrFrom, newReject("block", nil, err))
+		return err
+	}
+
+	n.logger.Debug("Received block", "block", bl.Hash, "height", bl.Height, "peer", payload.AddrFrom)
+	n.lock.Lock()
+	if n.reorgBase == nil {
+		n.reorgBase = n.bc.Tip()
+	}
+	n.lock.Unlock()
+
+	n.acceptBlock(bl, payload.AddrFrom)
+
+	if blockHash, ok := n.blocksInTransit.Pop(); ok {
+		n.sendGetData(payload.AddrFrom, "block", blockHash)
+	} else {
+		n.lock.Lock()
+		reorgBase := n.reorgBase
+		n.reorgBase = nil
+		n.lock.Unlock()
+
+		// Disconnect the blocks of a stale branch and connect the new main chain
+		UTXOSet := blockchain.UTXOSet{Blockchain: n.bc}
+		err = UTXOSet.Reconcile()
+		if err != nil {
+			return err
+		}
+
+		err = n.readmitDisconnected(reorgBase)
+		if err != nil {
+			return err
+		}
+
+		err = n.continueSync()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// acceptBlock stores a block received from a peer once it is checked, followed by the orphans
+// waiting for it. A block whose parent is unknown is kept as an orphan, an invalid one counts
+// against the peer that sent it, which is told why with a reject message.
+func (n *Node) acceptBlock(received *block.Block, addrFrom string) {
+	pending := []*block.Block{received}
+	for len(pending) > 0 {
+		bl := pending[0]
+		pending = pending[1:]
+
+		err := n.bc.CheckBlock(bl)
+		if errors.Is(err, errors.ErrOrphanBlock) {
+			if n.orphans.Add(bl) {
+				n.logger.Info("Block is an orphan, waiting for its parent", "block", bl.Hash, "height", bl.Height)
+			}
+			continue
+		}
+		if err != nil {
+			n.logger.Warn("Rejected block", "block", bl.Hash, "height", bl.Height, "peer", addrFrom, "err", err)
+
+			// Orphans connected on the way may come from other peers
+			if bl == received {
+				n.sendReject(addrFrom, newReject("block", bl.Hash, err))
+				n.penalize(addrFrom)
+			}
+			continue
+		}
+
+		err = n.bc.ConnectBlock(bl)
+		if err != nil {
+			n.logger.Warn("Rejected block", "block", bl.Hash, "height", bl.Height, "peer", addrFrom, "err", err)
+			if bl == received {
+				n.sendReject(addrFrom, newReject("block", bl.Hash, err))
+			}
+			continue
+		}
+
+		n.logger.Info("Added block", "block", bl.Hash, "height", bl.Height, "peer", addrFrom)
+		if bytes.Equal(n.bc.Tip(), bl.Hash) {
+			n.publishTip(bl)
+		}
+
+		// A competing block makes the one being mined stale
+		n.cancelStaleMining(bl.Height)
+
+		pending = append(pending, n.orphans.TakeChildren(bl.Hash)...)
+	}
+}
+
+// maxInvalidBlocks is the number of invalid blocks a peer may send before it is forgotten
+const maxInvalidBlocks = 3
+
+// penalize counts an invalid block against the peer that sent it, forgetting the peer once it sent
+// too many
+func (n *Node) penalize(addr string) {
+	if n.knownNodes.Penalize(addr) >= maxInvalidBlocks {
+		n.logger.Warn("Forgetting peer after invalid blocks", "peer", addr, "invalid", maxInvalidBlocks)
+		n.knownNodes.RemovePeer(addr)
+	}
+}
+
+// Tx is the transaction
+type Tx struct {
+	AddrFrom    string
+	Transaction []byte
+}
+
+// sendTx sends the transaction to the known nodes
+func (n *Node) sendTx(addr string, tx *transaction.Transaction) error {
+	request, err := txRequest(n.address, tx)
+	if err != nil {
+		return err
+	}
+
+	n.sendData(addr, request)
+	return nil
+}
+
+// txRequest builds the tx command carrying a transaction, sent by the node at addrFrom
+func txRequest(addrFrom string, tx *transaction.Transaction) ([]byte, error) {
+	sl, err := tx.Serialize()
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := util.GobEncode(Tx{addrFrom, sl})
+	if err != nil {
+		return nil, err
+	}
+
+	return append(commandToBytes("tx"), payload...), nil
+}
+
+// handleTx handles the tx command. A transaction that is invalid or that the mempool refuses is
+// dropped, and its sender told why with a reject message.
+func (n *Node) handleTx(request []byte, conn net.Conn) error {
+	var buff bytes.Buffer
+	var payload Tx
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		return err
+	}
+
+	txData := payload.Transaction
+	tx, err := transaction.DeserializeTransaction(txData)
+	if err != nil {
+		n.replyReject(payload.AddrFrom, conn, newReject("tx", nil, err))
+		return err
+	}
+
+	// A transaction already in the mempool was relayed when it arrived
+	if n.mempool.Has(tx.ID) {
+		return nil
+	}
+
+	// Save the transaction to the mempool, unless it double-spends one already there. The fee of a
+	// transaction spending unknown outputs counts as nothing.
+	fee, err := n.bc.TransactionFee(&tx)
+	if err != nil {
+		fee = 0
+	}
+
+	err = n.bc.CheckTransaction(&tx)
+	if err == nil {
+		err = n.mempool.Add(tx, fee)
+	}
+	if err != nil {
+		n.logger.Warn("Rejected transaction", "tx", tx.ID, "peer", payload.AddrFrom, "err", err)
+		n.replyReject(payload.AddrFrom, conn, newReject("tx", tx.ID, err))
+		return nil
+	}
+
+	// Relay the transaction to every peer but the one it came from, and wake the miner
+	n.broadcastInv("tx", tx.ID, payload.AddrFrom)
+	n.eventBus.Publish(events.Event{Kind: events.TxAccepted, ID: tx.ID})
+
+	return nil
+}
+
+// Inv shows other nodes what blocks or transactions it has
+type Inv struct {
+	AddrFrom string
+	Type     string
+	Items    [][]byte
+}
+
+// sendInv sends the inventory to the known nodes
+func (n *Node) sendInv(addr, kind string, items [][]byte) error {
+	inventory := Inv{n.address, kind, items}
+	payload, err := util.GobEncode(inventory)
+	if err != nil {
+		return err
+	}
+
+	request := append(commandToBytes("inv"), payload...)
+	n.sendData(addr, request)
+	return nil
+}
+
+// broadcastInv announces an item to every known peer but the node itself and the given address,
+// which may be empty.
+func (n *Node) broadcastInv(kind string, ID []byte, except string) {
+	for _, node := range n.knownNodes.Peers() {
+		if node != n.address && node != except {
+			n.sendInv(node, kind, [][]byte{ID})
+		}
+	}
+}
+
+// handleInv handles the inv command
+func (n *Node) handleInv(request []byte) error {
+	var buff bytes.Buffer
+	var payload Inv
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		return err
+	}
+
+	n.logger.Debug("Received inventory", "type", payload.Type, "items", len(payload.Items), "peer", payload.AddrFrom)
+
+	if len(payload.Items) > n.config.MaxInvItems {
+		metrics.Add("inv_items_dropped", int64(len(payload.Items)-n.config.MaxInvItems))
+		payload.Items = payload.Items[:n.config.MaxInvItems]
+	}
+
+	if payload.Type == "block" && len(payload.Items) > 0 {
+		// A full inventory means the peer has more blocks to announce
+		err := n.downloadBatch(payload.AddrFrom, payload.Items, len(payload.Items) == maxInvBlocks, true)
+		if err != nil {
+			return err
+		}
+	}
+
+	if payload.Type == "tx" && len(payload.Items) > 0 {
+		if !n.mempool.Has(payload.Items[0]) {
+			n.sendGetData(payload.AddrFrom, "tx", payload.Items[0])
+		}
+	}
+
+	return nil
+}
+
+// maxInvBlocks is the largest number of block hashes sent in reply to a getblocks command
+const maxInvBlocks = 500
+
+// GetBlocks is the getblocks command, asking for the hashes following the last block the
+// requester shares with the chain
+type GetBlocks struct {
+	AddrFrom string   // the address of the node
+	Locator  [][]byte // the block locator of the node, see Blockchain.BlockLocator
+}
+
+// requestBlocks requests the blocks from the known nodes
+func (n *Node) requestBlocks() {
+	for _, node := range n.knownNodes.Peers() {
+		n.sendGetBlocks(node)
+	}
+}
+
+// sendGetBlocks sends the getblocks command to the given address
+func (n *Node) sendGetBlocks(addr string) error {
+	locator, err := n.bc.BlockLocator()
+	if err != nil {
+		return err
+	}
+
+	payload, err := util.GobEncode(GetBlocks{n.address, locator})
+	if err != nil {
+		return err
+	}
+
+	request := append(commandToBytes("getblocks"), payload...)
+	n.sendData(addr, request)
+	return nil
+}
+
+// handleGetBlocks handles the getblocks command
+func (n *Node) handleGetBlocks(request []byte) error {
+	var buff bytes.Buffer
+	var payload GetBlocks
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		return err
+	}
+
+	blocks, err := n.bc.HashesAfter(payload.Locator, maxInvBlocks)
+	if err != nil {
+		return err
+	}
+
+	if len(blocks) > 0 {
+		n.sendInv(payload.AddrFrom, "block", blocks)
+	}
+
+	return nil
+}
+
+// GetData is a message that requests data from another node
+type GetData struct {
+	AddrFrom string // the address of the node that sent the message
+	Type     string // the type of data requested
+	ID       []byte // the ID of the data requested
+}
+
+// sendGetData sends a GetData message to the given address
+func (n *Node) sendGetData(addr, kind string, id []byte) error {
+	payload, err := util.GobEncode(GetData{n.address, kind, id})
+	if err != nil {
+		return err
+	}
+
+	request := append(commandToBytes("getdata"), payload...)
+	n.sendData(addr, request)
+	return nil
+}
+
+// handleGetData handles a GetData message
+func (n *Node) handleGetData(request []byte) error {
+	var buff bytes.Buffer
+	var payload GetData
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		return err
+	}
+
+	if payload.Type == "block" { // if the data requested is a block
+		block, err := n.bc.GetBlock(payload.ID)
+		if err != nil {
+			return err
+		}
+		n.sendBlock(payload.AddrFrom, block)
+	} else if payload.Type == "tx" { // if the data requested is a transaction
+		tx, ok := n.mempool.Get(payload.ID)
+		if !ok {
+			return errors.ErrTransactionNotFound
+		}
+		n.sendTx(payload.AddrFrom, &tx)
+	} else {
+		return errors.ErrUnknownGetDataType
+	}
+
+	return nil
+}
@@ -1,33 +1,82 @@
-package server
-
-// commandLength is the length of the command
-const commandLength = 12
-
-// commandToBytes converts a string command to a byte array
-func commandToBytes(command string) []byte {
-	var bytes [commandLength]byte
-
-	for i, c := range command {
-		bytes[i] = byte(c)
-	}
-
-	return bytes[:]
-}
-
-// bytesToCommand converts a byte array to a string command
-func bytesToCommand(bytes []byte) string {
-	var command []byte
-
-	for _, b := range bytes {
-		if b != 0x0 {
-			command = append(command, b)
-		}
-	}
-
-	return string(command)
-}
-
-// extractCommand extracts the command from the payload
-func extractCommand(request []byte) []byte {
-	return request[:commandLength]
-}
+package server
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/yanglinshu/glock/internal/errors"
+)
+
+// commandLength is the length of the command
+const commandLength = 12
+
+// commandToBytes converts a string command to a byte array
+func commandToBytes(command string) []byte {
+	var bytes [commandLength]byte
+
+	for i, c := range command {
+		bytes[i] = byte(c)
+	}
+
+	return bytes[:]
+}
+
+// bytesToCommand converts a byte array to a string command
+func bytesToCommand(bytes []byte) string {
+	var command []byte
+
+	for _, b := range bytes {
+		if b != 0x0 {
+			command = append(command, b)
+		}
+	}
+
+	return string(command)
+}
+
+// extractCommand extracts the command from the payload
+func extractCommand(request []byte) []byte {
+	return request[:commandLength]
+}
+
+// maxMessageSize is the largest message a peer may send
+const maxMessageSize = 32 << 20
+
+// writeMessage writes a message prefixed by its length, so several messages can share a connection
+func writeMessage(w io.Writer, message []byte) error {
+	if len(message) > maxMessageSize {
+		return errors.ErrMessageTooLarge
+	}
+
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(message)))
+
+	_, err := w.Write(append(length[:], message...))
+	return err
+}
+
+// readMessage reads a message written by writeMessage. It returns io.EOF if the connection was
+// closed between two messages.
+func readMessage(r io.Reader) ([]byte, error) {
+	var length [4]byte
+	_, err := io.ReadFull(r, length[:])
+	if err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(length[:])
+	if size > maxMessageSize {
+		return nil, errors.ErrMessageTooLarge
+	}
+
+	message := make([]byte, size)
+	_, err = io.ReadFull(r, message)
+	if err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+
+	"github.com/yanglinshu/glock/internal/blockchain"
+	"github.com/yanglinshu/glock/internal/logger"
+	"github.com/yanglinshu/glock/internal/metrics"
+)
+
+// runtimeStatsInterval is how often runtime statistics are pushed into the metrics registry
+const runtimeStatsInterval = 10 * time.Second
+
+// localAddress completes the address of an HTTP listener, binding to the loopback interface if no
+// host is given
+func localAddress(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return net.JoinHostPort("127.0.0.1", addr) // a bare port
+	}
+
+	if host == "" {
+		host = "127.0.0.1"
+	}
+
+	return net.JoinHostPort(host, port)
+}
+
+// startDebugServer serves the pprof profiles and the metrics registry on addr, and starts
+// sampling runtime statistics into the registry until the context is canceled. The returned
+// listener stops the server once closed.
+func startDebugServer(ctx context.Context, addr string, bc *blockchain.Blockchain, l logger.Logger) (net.Listener, error) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", metrics.Handler())
+
+	ln, err := net.Listen("tcp", localAddress(addr))
+	if err != nil {
+		return nil, err
+	}
+	l.Info("Debug server listening", "addr", ln.Addr())
+
+	go func() {
+		err := http.Serve(ln, mux)
+		if err != nil && ctx.Err() == nil {
+			l.Error("Debug server stopped", "err", err)
+		}
+	}()
+
+	go sampleRuntimeStats(ctx, bc)
+
+	return ln, nil
+}
+
+// sampleRuntimeStats periodically pushes runtime and database statistics into the registry until
+// the context is canceled
+func sampleRuntimeStats(ctx context.Context, bc *blockchain.Blockchain) {
+	var stats runtime.MemStats
+
+	ticker := time.NewTicker(runtimeStatsInterval)
+	defer ticker.Stop()
+
+	for {
+		runtime.ReadMemStats(&stats)
+
+		metrics.Set("goroutines", int64(runtime.NumGoroutine()))
+		metrics.Set("heap_alloc_bytes", int64(stats.HeapAlloc))
+		metrics.Set("heap_objects", int64(stats.HeapObjects))
+		metrics.Set("gc_count", int64(stats.NumGC))
+		metrics.Set("gc_pause_total_ns", int64(stats.PauseTotalNs))
+		metrics.Set("gc_last_pause_ns", int64(stats.PauseNs[(stats.NumGC+255)%256]))
+		metrics.Set("db_freelist_bytes", int64(bc.FreelistSize()))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
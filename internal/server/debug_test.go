@@ -0,0 +1,161 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// debugAddress waits for the debug server of a node and returns its address
+func debugAddress(tn *testNetwork, n *Node) string {
+	tn.t.Helper()
+
+	var addr string
+	tn.waitFor("the debug server to listen", func() bool {
+		n.lock.Lock()
+		defer n.lock.Unlock()
+
+		if n.debugListener == nil {
+			return false
+		}
+		addr = n.debugListener.Addr().String()
+		return true
+	})
+
+	return addr
+}
+
+// httpGet fetches a URL and returns the body of a successful response
+func httpGet(t *testing.T, url string) []byte {
+	t.Helper()
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s = %s: %s", url, resp.Status, body)
+	}
+
+	return body
+}
+
+// protoFields walks the top level of a protocol buffer message and counts its fields by number
+func protoFields(msg []byte) (map[int]int, error) {
+	fields := make(map[int]int)
+
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return nil, fmt.Errorf("invalid key")
+		}
+		msg = msg[n:]
+
+		switch key & 7 {
+		case 0: // varint
+			_, n = binary.Uvarint(msg)
+			if n <= 0 {
+				return nil, fmt.Errorf("invalid varint in field %d", key>>3)
+			}
+		case 1: // 64 bits
+			n = 8
+		case 2: // length-delimited
+			length, m := binary.Uvarint(msg)
+			if m <= 0 || length > uint64(len(msg)-m) {
+				return nil, fmt.Errorf("invalid length in field %d", key>>3)
+			}
+			n = m + int(length)
+		case 5: // 32 bits
+			n = 4
+		default:
+			return nil, fmt.Errorf("unsupported wire type %d in field %d", key&7, key>>3)
+		}
+
+		if n > len(msg) {
+			return nil, fmt.Errorf("field %d is truncated", key>>3)
+		}
+		msg = msg[n:]
+		fields[int(key>>3)]++
+	}
+
+	return fields, nil
+}
+
+func TestDebugServerServesHeapProfile(t *testing.T) {
+	tn := newTestNetwork(t, 0)
+	a := tn.addNode(Config{DebugAddr: "127.0.0.1:0"})
+	addr := debugAddress(tn, a)
+
+	if !strings.HasPrefix(addr, "127.0.0.1:") {
+		t.Fatalf("debug server listens on %s, want the loopback interface", addr)
+	}
+
+	// A profile is a gzipped protocol buffer
+	body := httpGet(t, "http://"+addr+"/debug/pprof/heap")
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("the heap profile is not gzipped: %v", err)
+	}
+
+	profile, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("reading the heap profile: %v", err)
+	}
+
+	fields, err := protoFields(profile)
+	if err != nil {
+		t.Fatalf("the heap profile is not a protocol buffer: %v", err)
+	}
+
+	// Sample types and the string table
+	for _, field := range []int{1, 6} {
+		if fields[field] == 0 {
+			t.Fatalf("the heap profile has no field %d: %v", field, fields)
+		}
+	}
+
+	// The runtime statistics are sampled into the metrics
+	vars := httpGet(t, "http://"+addr+"/debug/vars")
+	for _, name := range []string{"goroutines", "heap_alloc_bytes", "db_freelist_bytes"} {
+		if !bytes.Contains(vars, []byte(`"`+name+`"`)) {
+			t.Fatalf("the metrics do not hold %s: %s", name, vars)
+		}
+	}
+}
+
+func TestDebugServerDisabledByDefault(t *testing.T) {
+	tn := newTestNetwork(t, 0)
+	a := tn.addNode(Config{})
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.debugListener != nil {
+		t.Fatal("a debug server was started without a debug address")
+	}
+}
+
+func TestLocalAddressDefaultsToLoopback(t *testing.T) {
+	for addr, want := range map[string]string{
+		"6060":         "127.0.0.1:6060",
+		":6060":        "127.0.0.1:6060",
+		"0.0.0.0:6060": "0.0.0.0:6060",
+		"[::1]:6060":   "[::1]:6060",
+	} {
+		if got := localAddress(addr); got != want {
+			t.Fatalf("localAddress(%q) = %q, want %q", addr, got, want)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/yanglinshu/glock/internal/block"
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// MaxGenerateBlocks is the largest number of blocks a generate request mines
+const MaxGenerateBlocks = 100
+
+// GenerateParams are the parameters of generate, which mines blocks on demand
+type GenerateParams struct {
+	Blocks  int    `json:"blocks"`  // the number of blocks to mine, at most MaxGenerateBlocks
+	Address string `json:"address"` // the address receiving the rewards
+}
+
+// GenerateResult is the result of generate
+type GenerateResult struct {
+	Hashes []string `json:"hashes"` // the hashes of the mined blocks in hex, in order
+}
+
+// RequestGenerate asks the node serving RPC on the local port to mine blocks, including the
+// transactions of its mempool, and returns the hashes of the new blocks. token is the bearer token
+// of the server, if any. It returns ErrNodeNotRunning if the server is not reachable.
+func RequestGenerate(port int, token string, blocks int, address string) ([][]byte, error) {
+	var result GenerateResult
+	err := callRPC(port, token, "generate", GenerateParams{blocks, address}, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	var hashes [][]byte
+	for _, h := range result.Hashes {
+		hash, err := hex.DecodeString(h)
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+
+	return hashes, nil
+}
+
+// rpcGenerate mines blocks on demand. Unlike on a stopped node, the difficulty limit of
+// blockchain.GenerateBlocks cannot be forced.
+func rpcGenerate(n *Node, params json.RawMessage) (interface{}, error) {
+	var p GenerateParams
+	err := decodeParams(params, &p)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Blocks <= 0 || p.Blocks > MaxGenerateBlocks {
+		return nil, &RPCError{RPCInvalidParams, fmt.Sprintf("blocks must be between 1 and %d", MaxGenerateBlocks)}
+	}
+
+	address, err := n.parseAddress(p.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks, err := n.generate(p.Blocks, address)
+	if errors.Is(err, errors.ErrDifficultyTooHigh) {
+		return nil, &RPCError{RPCInvalidParams, err.Error()}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := GenerateResult{Hashes: []string{}}
+	for _, b := range blocks {
+		result.Hashes = append(result.Hashes, hex.EncodeToString(b.Hash))
+	}
+
+	return result, nil
+}
+
+// generate mines blocks on top of the tip, the first one holding the valid transactions of the
+// mempool, and announces them to the known nodes
+func (n *Node) generate(count int, address transaction.Address) ([]*block.Block, error) {
+	// Include the valid transactions of the mempool
+	var txs []*transaction.Transaction
+	for _, tx := range n.mempool.Transactions() {
+		if ok, err := n.bc.VerifyTransaction(tx); err != nil {
+			return nil, err
+		} else if ok {
+			txs = append(txs, tx)
+		}
+	}
+
+	err := orderForMining(n.bc, txs)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks, err := n.bc.GenerateBlocks(count, address, txs, false)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, tx := range txs {
+		n.mempool.Remove(tx.ID)
+	}
+
+	var hashes [][]byte
+	for _, b := range blocks {
+		n.logger.Info("Generated block", "block", b.Hash, "height", b.Height)
+		hashes = append(hashes, b.Hash)
+	}
+
+	if len(blocks) > 0 {
+		n.publishTip(blocks[len(blocks)-1])
+
+		// Broadcast the new blocks to all the nodes
+		for _, node := range n.knownNodes.Peers() {
+			if node != n.address {
+				n.sendInv(node, "block", hashes)
+			}
+		}
+	}
+
+	return blocks, nil
+}
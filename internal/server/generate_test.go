@@ -0,0 +1,97 @@
+package server
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/yanglinshu/glock/internal/errors"
+)
+
+func TestRPCGenerateIncludesMempool(t *testing.T) {
+	tn := newTestNetwork(t, 1)
+	a := tn.addNode(Config{})
+
+	tx := tn.payment(a, 5, 1)
+	err := a.mempool.Add(*tx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	miner := newAddress(t)
+	params, err := json.Marshal(GenerateParams{Blocks: 3, Address: miner.String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := rpcGenerate(a, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hashes := result.(GenerateResult).Hashes
+	if len(hashes) != 3 {
+		t.Fatalf("generate returned %d hashes, want 3", len(hashes))
+	}
+
+	for i, h := range hashes {
+		hash, err := hex.DecodeString(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bl, err := a.bc.GetBlock(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if bl.Height != 2+i {
+			t.Fatalf("height of generated block %d = %d, want %d", i, bl.Height, 2+i)
+		}
+
+		if !bl.Transactions[0].Vout[0].IsLockedWithKey(miner.PubKeyHash()) {
+			t.Fatalf("the coinbase of generated block %d does not pay the requested address", i)
+		}
+	}
+
+	// The mempool transaction is mined in the first block and leaves the mempool
+	location, err := a.bc.LocateTransaction(tx.ID)
+	if err != nil {
+		t.Fatalf("the mempool transaction was not mined: %v", err)
+	}
+
+	if hex.EncodeToString(location.BlockHash) != hashes[0] {
+		t.Fatalf("the mempool transaction was mined in %x, want the first generated block", location.BlockHash)
+	}
+
+	if _, ok := a.mempool.Get(tx.ID); ok {
+		t.Fatal("the mined transaction is still in the mempool")
+	}
+}
+
+func TestRPCGenerateRejectsInvalidParams(t *testing.T) {
+	tn := newTestNetwork(t, 0)
+	a := tn.addNode(Config{})
+
+	for _, p := range []GenerateParams{
+		{Blocks: 0, Address: tn.address.String()},
+		{Blocks: MaxGenerateBlocks + 1, Address: tn.address.String()},
+		{Blocks: 1, Address: "notanaddress"},
+	} {
+		params, err := json.Marshal(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = rpcGenerate(a, params)
+
+		var rpcErr *RPCError
+		if !errors.As(err, &rpcErr) || rpcErr.Code != RPCInvalidParams {
+			t.Fatalf("generate with %+v = %v, want invalid parameters", p, err)
+		}
+	}
+
+	if height, err := a.bc.GetBestHeight(); err != nil || height != 0 {
+		t.Fatalf("height after rejected requests = %d, %v, want 0", height, err)
+	}
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"bytes"
+	"encoding/gob"
+	"net"
+	"time"
+
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/util"
+)
+
+// GetMempool asks a node for the transactions of its mempool, or for one of them
+type GetMempool struct {
+	AddrFrom string // the address of the node, empty for a client
+	TxID     []byte // the ID of the transaction asked for, every transaction is described if nil
+}
+
+// MempoolReply is the reply to the getmempool command
+type MempoolReply struct {
+	Entries []MempoolInfo // the transactions of the mempool, or the one asked for
+	Tx      []byte        // the transaction asked for, serialized
+	Error   string        // the reason the transaction could not be returned, if any
+}
+
+// mempoolReply builds the reply to a getmempool command
+func (n *Node) mempoolReply(txID []byte) (MempoolReply, error) {
+	if txID == nil {
+		return MempoolReply{Entries: n.mempool.Info()}, nil
+	}
+
+	tx, ok := n.mempool.Get(txID)
+	if !ok {
+		return MempoolReply{}, errors.ErrTransactionNotFound
+	}
+
+	sl, err := tx.Serialize()
+	if err != nil {
+		return MempoolReply{}, err
+	}
+
+	for _, info := range n.mempool.Info() {
+		if bytes.Equal(info.ID, txID) {
+			return MempoolReply{Entries: []MempoolInfo{info}, Tx: sl}, nil
+		}
+	}
+
+	return MempoolReply{}, errors.ErrTransactionNotFound
+}
+
+// RequestMempool asks the local node for the description of the transactions of its mempool, or
+// for the transaction with the given ID if it is not nil. It returns ErrNodeNotRunning if the node
+// is not running.
+func (c *Client) RequestMempool(txID []byte) (MempoolReply, error) {
+	payload, err := util.GobEncode(GetMempool{TxID: txID})
+	if err != nil {
+		return MempoolReply{}, err
+	}
+
+	request := append(commandToBytes("getmempool"), payload...)
+
+	reply, err := requestData(c.nodeAddress, request)
+	if err != nil {
+		if _, ok := err.(*net.OpError); ok {
+			return MempoolReply{}, errors.Wrapf(errors.ErrNodeNotRunning, "node %s", c.nodeAddress)
+		}
+		return MempoolReply{}, err
+	}
+
+	var result MempoolReply
+	dec := gob.NewDecoder(bytes.NewReader(reply))
+	err = dec.Decode(&result)
+	if err != nil {
+		return MempoolReply{}, err
+	}
+
+	if result.Error != "" {
+		return MempoolReply{}, errors.NewError(result.Error)
+	}
+
+	return result, nil
+}
+
+// handleGetMempool handles the getmempool command, replying with the transactions on the connection
+func (n *Node) handleGetMempool(request []byte, conn net.Conn) error {
+	var payload GetMempool
+
+	dec := gob.NewDecoder(bytes.NewReader(request[commandLength:]))
+	err := dec.Decode(&payload)
+	if err != nil {
+		return err
+	}
+
+	result, err := n.mempoolReply(payload.TxID)
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	reply, err := util.GobEncode(result)
+	if err != nil {
+		return err
+	}
+
+	err = conn.SetWriteDeadline(time.Now().Add(n.config.WriteTimeout))
+	if err != nil {
+		return err
+	}
+
+	return writeMessage(conn, reply)
+}
@@ -0,0 +1,285 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/yanglinshu/glock/internal/block"
+	"github.com/yanglinshu/glock/internal/blockchain"
+	"github.com/yanglinshu/glock/internal/config"
+	"github.com/yanglinshu/glock/internal/events"
+	"github.com/yanglinshu/glock/internal/logger"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// testTargetBits is the difficulty of the chains of test networks, low enough for blocks to be
+// mined at once
+const testTargetBits = 8
+
+// testGenesisTime is the time of the genesis block shared by the nodes of test networks
+const testGenesisTime = 1700000000
+
+// waitTimeout is how long the helpers of the harness wait for the network to converge
+const waitTimeout = 10 * time.Second
+
+// testNetwork runs nodes in the process of a test, each listening on an ephemeral port and keeping
+// its files in a temporary directory. The nodes share a genesis block paying the wallet of the
+// network, followed by the blocks of the prefix.
+type testNetwork struct {
+	t       *testing.T
+	wallet  *transaction.Wallet // wallet paid by the genesis block and the prefix
+	address transaction.Address // address of the wallet
+	prefix  int                 // number of blocks every node starts with after the genesis block
+	blocks  []*block.Block      // blocks of the prefix, mined along with the chain of the first node
+	nodes   []*Node             // nodes of the network, in the order they were added
+}
+
+// newTestNetwork creates an empty network whose nodes start with prefix blocks after the genesis
+// block.
+func newTestNetwork(t *testing.T, prefix int) *testNetwork {
+	t.Helper()
+
+	err := config.SetDataDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wallet, err := transaction.NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pubKeyHash, err := transaction.HashPubKey(wallet.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testNetwork{t: t, wallet: wallet, address: transaction.NewAddress(pubKeyHash, transaction.Mainnet), prefix: prefix}
+}
+
+// createChain creates the blockchain of a node, holding the genesis block and the prefix of the
+// network
+func (tn *testNetwork) createChain(nodeID string) {
+	tn.t.Helper()
+
+	params := blockchain.GenesisConfig{Network: DefaultNetwork, TargetBits: testTargetBits, Timestamp: testGenesisTime}
+	bc, err := blockchain.CreateBlockchain(tn.address, nodeID, params, blockchain.Config{RetargetInterval: -1})
+	if err != nil {
+		tn.t.Fatal(err)
+	}
+	defer bc.CloseDB()
+
+	if tn.blocks == nil && tn.prefix > 0 {
+		tn.blocks, err = bc.GenerateBlocks(tn.prefix, tn.address, nil, false)
+		if err != nil {
+			tn.t.Fatal(err)
+		}
+		return
+	}
+
+	for _, bl := range tn.blocks {
+		err = bc.SubmitBlock(bl)
+		if err != nil {
+			tn.t.Fatal(err)
+		}
+	}
+}
+
+// addNode starts a node on the network, connected to the given peers. Unless set, the node listens
+// on an ephemeral port of the loopback interface and logs nothing. The node is stopped when the
+// test ends.
+func (tn *testNetwork) addNode(cfg Config, peers ...*Node) *Node {
+	tn.t.Helper()
+
+	if cfg.NodeID == "" {
+		cfg.NodeID = fmt.Sprintf("node%d", len(tn.nodes))
+	}
+
+	if cfg.ListenAddr == "" {
+		cfg.ListenAddr = "127.0.0.1:0"
+	}
+
+	if cfg.Logger == nil {
+		cfg.Logger = logger.Nop()
+	}
+
+	cfg.Seeds = []string{}
+	for _, peer := range peers {
+		cfg.Seeds = append(cfg.Seeds, peer.Address())
+	}
+
+	tn.createChain(cfg.NodeID)
+
+	n, err := NewNode(cfg)
+	if err != nil {
+		tn.t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- n.Start(ctx)
+	}()
+
+	// Stop returns once the node saved its files, whichever goroutine runs it
+	tn.t.Cleanup(func() {
+		cancel()
+		n.Stop()
+		<-done
+	})
+
+	// The node resolves its port before it contacts its peers
+	deadline := time.Now().Add(waitTimeout)
+	for {
+		_, port, err := net.SplitHostPort(n.Address())
+		if err == nil && port != "0" {
+			break
+		}
+
+		select {
+		case err := <-done:
+			tn.t.Fatalf("node %s stopped: %v", cfg.NodeID, err)
+		default:
+		}
+
+		if time.Now().After(deadline) {
+			tn.t.Fatalf("node %s did not start", cfg.NodeID)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	tn.nodes = append(tn.nodes, n)
+
+	return n
+}
+
+// connect has a node handshake with a peer, as it does with its seeds when it starts
+func (tn *testNetwork) connect(n, peer *Node) {
+	tn.t.Helper()
+
+	n.knownNodes.AddPeer(peer.Address())
+	err := n.sendVersion(peer.Address())
+	if err != nil {
+		tn.t.Fatal(err)
+	}
+}
+
+// newAddress returns the address of a new wallet
+func newAddress(t *testing.T) transaction.Address {
+	t.Helper()
+
+	w, err := transaction.NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pubKeyHash, err := transaction.HashPubKey(w.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return transaction.NewAddress(pubKeyHash, transaction.Mainnet)
+}
+
+// payment returns a transaction paying amount from the wallet of the network to a new address,
+// built on the UTXO set of a node
+func (tn *testNetwork) payment(n *Node, amount, fee int) *transaction.Transaction {
+	tn.t.Helper()
+
+	utxoSet := &blockchain.UTXOSet{Blockchain: n.bc}
+	tx, err := blockchain.NewUTXOTransaction(tn.wallet, newAddress(tn.t), amount, fee, nil, nil, utxoSet)
+	if err != nil {
+		tn.t.Fatal(err)
+	}
+
+	return tx
+}
+
+// waitFor waits until cond holds, failing the test with the description of what it waited for
+// once waitTimeout elapses
+func (tn *testNetwork) waitFor(what string, cond func() bool) {
+	tn.t.Helper()
+
+	deadline := time.Now().Add(waitTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			tn.t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// waitHeight waits until the nodes share the same tip at the given height
+func (tn *testNetwork) waitHeight(height int, nodes ...*Node) {
+	tn.t.Helper()
+
+	tn.waitFor(fmt.Sprintf("the nodes to converge at height %d", height), func() bool {
+		var tip string
+		for _, n := range nodes {
+			h, err := n.bc.GetBestHeight()
+			if err != nil || h != height {
+				return false
+			}
+
+			if tip == "" {
+				tip = string(n.bc.Tip())
+			} else if tip != string(n.bc.Tip()) {
+				return false
+			}
+		}
+
+		return true
+	})
+}
+
+// waitMempool waits until the mempool of every node holds the transaction
+func (tn *testNetwork) waitMempool(tx *transaction.Transaction, nodes ...*Node) {
+	tn.t.Helper()
+
+	tn.waitFor(fmt.Sprintf("transaction %x to reach the mempools", tx.ID), func() bool {
+		for _, n := range nodes {
+			if _, ok := n.mempool.Get(tx.ID); !ok {
+				return false
+			}
+		}
+
+		return true
+	})
+}
+
+// waitEvent waits until an event of the given kind about id is delivered on ch, skipping the
+// others
+func (tn *testNetwork) waitEvent(ch chan events.Event, kind events.Kind, id []byte) {
+	tn.t.Helper()
+
+	timeout := time.After(waitTimeout)
+	for {
+		select {
+		case e := <-ch:
+			if e.Kind == kind && bytes.Equal(e.ID, id) {
+				return
+			}
+		case <-timeout:
+			tn.t.Fatalf("timed out waiting for event %d about %x", kind, id)
+		}
+	}
+}
+
+// waitConfirmed waits until the main chain of every node holds the transaction
+func (tn *testNetwork) waitConfirmed(tx *transaction.Transaction, nodes ...*Node) {
+	tn.t.Helper()
+
+	tn.waitFor(fmt.Sprintf("transaction %x to be confirmed", tx.ID), func() bool {
+		for _, n := range nodes {
+			if _, err := n.bc.LocateTransaction(tx.ID); err != nil {
+				return false
+			}
+		}
+
+		return true
+	})
+}
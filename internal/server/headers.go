@@ -0,0 +1,138 @@
+package server
+
+import (
+	"bytes"
+	"encoding/gob"
+
+	"github.com/yanglinshu/glock/internal/block"
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/util"
+)
+
+// maxHeadersPerMessage is the largest number of headers sent in reply to a getheaders command
+const maxHeadersPerMessage = 2000
+
+// GetHeaders asks for the headers following the last block the requester shares with the chain
+type GetHeaders struct {
+	AddrFrom string   // the address of the node
+	Locator  [][]byte // the block locator of the node, see Blockchain.BlockLocator
+}
+
+// Headers carries block headers in chain order
+type Headers struct {
+	AddrFrom string // the address of the node
+	Headers  []byte // the serialized headers
+}
+
+// sendGetHeaders asks the given address for the headers following the tip of the node
+func (n *Node) sendGetHeaders(addr string) error {
+	locator, err := n.bc.BlockLocator()
+	if err != nil {
+		return err
+	}
+
+	payload, err := util.GobEncode(GetHeaders{n.address, locator})
+	if err != nil {
+		return err
+	}
+
+	request := append(commandToBytes("getheaders"), payload...)
+	return n.sendData(addr, request)
+}
+
+// handleGetHeaders handles the getheaders command
+func (n *Node) handleGetHeaders(request []byte) error {
+	var buff bytes.Buffer
+	var payload GetHeaders
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		return err
+	}
+
+	headers, err := n.bc.HeadersAfter(payload.Locator, maxHeadersPerMessage)
+	if err != nil {
+		return err
+	}
+
+	sl, err := block.SerializeHeaders(headers)
+	if err != nil {
+		return err
+	}
+
+	reply, err := util.GobEncode(Headers{n.address, sl})
+	if err != nil {
+		return err
+	}
+
+	return n.sendData(payload.AddrFrom, append(commandToBytes("headers"), reply...))
+}
+
+// handleHeaders handles the headers command. Once the headers are checked to form a chain of valid
+// proofs-of-work extending a known block, the blocks missing from the chain are downloaded.
+func (n *Node) handleHeaders(request []byte) error {
+	var buff bytes.Buffer
+	var payload Headers
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		return err
+	}
+
+	headers, err := block.DeserializeHeaders(payload.Headers)
+	if err != nil {
+		return err
+	}
+
+	n.logger.Debug("Received headers", "headers", len(headers), "peer", payload.AddrFrom)
+	if len(headers) == 0 {
+		return nil
+	}
+
+	err = n.checkHeaders(headers)
+	if err != nil {
+		return err
+	}
+
+	hashes := make([][]byte, len(headers))
+	for i, header := range headers {
+		hashes[i] = header.Hash
+	}
+
+	// A full batch means the peer has more headers to send
+	return n.downloadBatch(payload.AddrFrom, hashes, len(headers) == maxHeadersPerMessage, false)
+}
+
+// checkHeaders checks that headers form a chain of valid proofs-of-work extending a known block
+func (n *Node) checkHeaders(headers []block.BlockHeader) error {
+	first := headers[0]
+	if len(first.PrevBlockHash) > 0 {
+		ok, err := n.bc.HasBlock(first.PrevBlockHash)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			return errors.ErrInvalidHeaders
+		}
+	}
+
+	for i := range headers {
+		if !headers[i].Validate() {
+			return errors.ErrInvalidHeaders
+		}
+
+		if i > 0 {
+			prev := headers[i-1]
+			if !bytes.Equal(headers[i].PrevBlockHash, prev.Hash) || headers[i].Height != prev.Height+1 {
+				return errors.ErrInvalidHeaders
+			}
+		}
+	}
+
+	return nil
+}
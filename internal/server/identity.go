@@ -0,0 +1,169 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/yanglinshu/glock/internal/config"
+	"github.com/yanglinshu/glock/internal/errors"
+)
+
+// identityFileFormat is the format of the file holding the identity key of a node
+const identityFileFormat = "node_%s.key"
+
+// handshakeMaxAge is how far the timestamp of a version message may drift from the local clock
+const handshakeMaxAge = 5 * time.Minute
+
+// LoadIdentity loads the identity key of a node, generating and saving one on first use. The key
+// is independent of the wallet keys and identifies the node to its peers.
+func LoadIdentity(nodeID string) (*ecdsa.PrivateKey, error) {
+	identityFile := config.Path(fmt.Sprintf(identityFileFormat, nodeID))
+
+	content, err := os.ReadFile(identityFile)
+	if os.IsNotExist(err) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+
+		content = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+		err = os.WriteFile(identityFile, content, 0600)
+		if err != nil {
+			return nil, err
+		}
+
+		return key, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, errors.ErrInvalidPublicKey
+	}
+
+	return x509.ParseECPrivateKey(block.Bytes)
+}
+
+// Identity returns the public identity of a key, as shared with peers and listed in allowlists.
+func Identity(key *ecdsa.PrivateKey) string {
+	return hex.EncodeToString(elliptic.Marshal(key.Curve, key.X, key.Y))
+}
+
+// handshakeDigest returns the digest of the fields of a version message covered by its signature.
+// The services and the lowest version of the peers are covered from capabilitiesVersion on, so the
+// signatures of older nodes still verify.
+func handshakeDigest(v Version) []byte {
+	fields := fmt.Sprintf("%d|%d|%d|%s|%d|%x", v.Version, v.Nonce, v.Timestamp, v.AddrFrom, v.Magic, v.Genesis)
+	if v.Version >= capabilitiesVersion {
+		fields += fmt.Sprintf("|%d|%d", v.Services, v.MinVersion)
+	}
+
+	digest := sha256.Sum256([]byte(fields))
+	return digest[:]
+}
+
+// signVersion signs a version message with the identity of the node
+func (n *Node) signVersion(v *Version) error {
+	if n.identity == nil {
+		return nil
+	}
+
+	v.PublicKey = elliptic.Marshal(n.identity.Curve, n.identity.X, n.identity.Y)
+
+	signature, err := ecdsa.SignASN1(rand.Reader, n.identity, handshakeDigest(*v))
+	if err != nil {
+		return err
+	}
+	v.Signature = signature
+
+	return nil
+}
+
+// authenticateVersion checks the signature of a version message and the allowlist, and records
+// the identity of the peer. Unsigned messages are only accepted when no allowlist is configured. A
+// signed message is accepted once: its nonce is remembered for its identity until its timestamp is
+// too old, so a captured handshake cannot be replayed over another connection to pass for the peer.
+func (n *Node) authenticateVersion(v Version) error {
+	if len(v.Signature) == 0 {
+		if n.allowlist != nil {
+			return errors.ErrPeerNotAllowed
+		}
+		return nil
+	}
+
+	x, y := elliptic.Unmarshal(elliptic.P256(), v.PublicKey)
+	if x == nil {
+		return errors.ErrInvalidHandshake
+	}
+
+	age := time.Since(time.Unix(v.Timestamp, 0))
+	if age > handshakeMaxAge || age < -handshakeMaxAge {
+		return errors.ErrInvalidHandshake
+	}
+
+	pub := ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+	if !ecdsa.VerifyASN1(&pub, handshakeDigest(v), v.Signature) {
+		return errors.ErrInvalidHandshake
+	}
+
+	identity := hex.EncodeToString(v.PublicKey)
+	if n.allowlist != nil && !n.allowlist[identity] {
+		return errors.ErrPeerNotAllowed
+	}
+
+	n.peerIdentitiesLock.Lock()
+	defer n.peerIdentitiesLock.Unlock()
+
+	now := time.Now()
+	for received, expiry := range n.receivedNonces {
+		if now.After(expiry) {
+			delete(n.receivedNonces, received)
+		}
+	}
+
+	received := fmt.Sprintf("%s/%d", identity, v.Nonce)
+	if _, ok := n.receivedNonces[received]; ok {
+		return errors.ErrInvalidHandshake
+	}
+	n.receivedNonces[received] = time.Unix(v.Timestamp, 0).Add(handshakeMaxAge)
+
+	// A known identity coming from a new address keeps a single entry
+	for addr, known := range n.peerIdentities {
+		if known == identity && addr != v.AddrFrom {
+			delete(n.peerIdentities, addr)
+			n.knownNodes.RemovePeer(addr)
+		}
+	}
+	n.peerIdentities[v.AddrFrom] = identity
+
+	return nil
+}
+
+// isAuthenticated checks whether messages from a peer, bound to the session of its connection, may
+// be handled
+func (n *Node) isAuthenticated(addr string) bool {
+	if n.allowlist == nil {
+		return true
+	}
+
+	n.peerIdentitiesLock.Lock()
+	defer n.peerIdentitiesLock.Unlock()
+
+	_, ok := n.peerIdentities[addr]
+	return ok
+}
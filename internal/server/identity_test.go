@@ -0,0 +1,230 @@
+package server
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/gob"
+	"testing"
+	"time"
+
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/util"
+)
+
+// signedVersion returns the version message of a node, signed by its identity, decoded
+func signedVersion(t *testing.T, n *Node) Version {
+	t.Helper()
+
+	request, err := n.versionRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var v Version
+	err = gob.NewDecoder(bytes.NewReader(request[commandLength:])).Decode(&v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return v
+}
+
+// versionMessage encodes a version message
+func versionMessage(t *testing.T, v Version) []byte {
+	t.Helper()
+
+	payload, err := util.GobEncode(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return append(commandToBytes("version"), payload...)
+}
+
+// resign signs a version message again with the given key
+func resign(t *testing.T, v *Version, key *ecdsa.PrivateKey) {
+	t.Helper()
+
+	signature, err := ecdsa.SignASN1(rand.Reader, key, handshakeDigest(*v))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.Signature = signature
+}
+
+func TestAllowlistedPeerAccepted(t *testing.T) {
+	tn := newTestNetwork(t, 1)
+	b := tn.addNode(Config{})
+	a := tn.addNode(Config{Allowed: []string{Identity(b.identity)}})
+
+	tx := tn.payment(a, 5, 1)
+	request, err := txRequest(b.Address(), tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exchange(t, a, versionMessage(t, signedVersion(t, b)), request)
+
+	if !a.isAuthenticated(b.Address()) {
+		t.Fatal("an allowlisted peer was not authenticated")
+	}
+
+	if _, ok := a.mempool.Get(tx.ID); !ok {
+		t.Fatal("a transaction from an allowlisted peer did not reach the mempool")
+	}
+}
+
+func TestUnlistedPeerRejected(t *testing.T) {
+	tn := newTestNetwork(t, 1)
+	b := tn.addNode(Config{})
+	c := tn.addNode(Config{})
+	a := tn.addNode(Config{Allowed: []string{Identity(b.identity)}})
+
+	tx := tn.payment(a, 5, 1)
+
+	// A peer with a valid signature by an identity missing from the allowlist, and a client that
+	// does not sign at all
+	unsigned, err := NewClient("", nil, DefaultNetwork).versionRequest(a.genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for addr, version := range map[string][]byte{c.Address(): versionMessage(t, signedVersion(t, c)), "": unsigned} {
+		request, err := txRequest(addr, tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		exchange(t, a, version, request)
+
+		if addr != "" && a.isAuthenticated(addr) {
+			t.Fatal("a peer missing from the allowlist was authenticated")
+		}
+
+		if _, ok := a.mempool.Get(tx.ID); ok {
+			t.Fatalf("a transaction from %q, missing from the allowlist, reached the mempool", addr)
+		}
+	}
+
+	err = a.authenticateVersion(signedVersion(t, c))
+	if !errors.Is(err, errors.ErrPeerNotAllowed) {
+		t.Fatalf("authenticating a peer missing from the allowlist = %v, want ErrPeerNotAllowed", err)
+	}
+}
+
+func TestForgedVersionSignatureRejected(t *testing.T) {
+	tn := newTestNetwork(t, 1)
+	b := tn.addNode(Config{})
+	c := tn.addNode(Config{})
+	a := tn.addNode(Config{Allowed: []string{Identity(b.identity)}})
+
+	forgeries := map[string]func(v *Version){
+		// c claims the identity of b without its key
+		"signed by another key": func(v *Version) { resign(t, v, c.identity) },
+		// a signed handshake of b replayed from another address
+		"address changed": func(v *Version) { v.AddrFrom = c.Address() },
+		// an old handshake of b replayed later
+		"stale timestamp": func(v *Version) {
+			v.Timestamp = time.Now().Add(-2 * handshakeMaxAge).Unix()
+			resign(t, v, b.identity)
+		},
+		"invalid public key": func(v *Version) { v.PublicKey = []byte{0x04, 0x01} },
+	}
+
+	for name, forge := range forgeries {
+		v := signedVersion(t, b)
+		forge(&v)
+
+		err := a.authenticateVersion(v)
+		if !errors.Is(err, errors.ErrInvalidHandshake) {
+			t.Fatalf("authenticating a handshake %s = %v, want ErrInvalidHandshake", name, err)
+		}
+	}
+
+	// Over the wire, the forged handshake gets no transaction through
+	v := signedVersion(t, b)
+	resign(t, &v, c.identity)
+
+	tx := tn.payment(a, 5, 1)
+	request, err := txRequest(b.Address(), tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exchange(t, a, versionMessage(t, v), request)
+	if _, ok := a.mempool.Get(tx.ID); ok {
+		t.Fatal("a transaction sent after a forged handshake reached the mempool")
+	}
+}
+
+func TestReplayedVersionRejected(t *testing.T) {
+	tn := newTestNetwork(t, 1)
+	b := tn.addNode(Config{})
+	a := tn.addNode(Config{Allowed: []string{Identity(b.identity)}})
+
+	// The handshake of b is captured as it authenticates
+	captured := signedVersion(t, b)
+	err := a.authenticateVersion(captured)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = a.authenticateVersion(captured)
+	if !errors.Is(err, errors.ErrInvalidHandshake) {
+		t.Fatalf("authenticating a replayed handshake = %v, want ErrInvalidHandshake", err)
+	}
+
+	// Replayed over another connection within its validity, it gets no transaction through
+	tx := tn.payment(a, 5, 1)
+	request, err := txRequest(b.Address(), tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exchange(t, a, versionMessage(t, captured), request)
+	if _, ok := a.mempool.Get(tx.ID); ok {
+		t.Fatal("a transaction sent after a replayed handshake reached the mempool")
+	}
+
+	// A fresh handshake of b, with a nonce of its own, is accepted
+	exchange(t, a, versionMessage(t, signedVersion(t, b)), request)
+	tn.waitMempool(tx, a)
+}
+
+func TestIdentityPersistsAndFollowsPeer(t *testing.T) {
+	tn := newTestNetwork(t, 0)
+	b := tn.addNode(Config{})
+	a := tn.addNode(Config{})
+
+	key, err := LoadIdentity(b.config.NodeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if Identity(key) != Identity(b.identity) {
+		t.Fatal("the identity of a node changed when loaded again")
+	}
+
+	// b moves to another address, keeping a single entry under its identity
+	v := signedVersion(t, b)
+	err = a.authenticateVersion(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v.AddrFrom = "127.0.0.1:1"
+	v.Nonce++
+	resign(t, &v, b.identity)
+	err = a.authenticateVersion(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a.peerIdentitiesLock.Lock()
+	defer a.peerIdentitiesLock.Unlock()
+
+	if len(a.peerIdentities) != 1 || a.peerIdentities["127.0.0.1:1"] != Identity(b.identity) {
+		t.Fatalf("peer identities = %v, want b under its new address alone", a.peerIdentities)
+	}
+}
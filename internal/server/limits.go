@@ -0,0 +1,124 @@
+package server
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/yanglinshu/glock/internal/metrics"
+)
+
+// DefaultMaxInbound is the most inbound connections open at once unless configured otherwise
+const DefaultMaxInbound = 125
+
+// DefaultMaxMessageRate is the most messages a peer may send per minute unless configured
+// otherwise. It leaves room for a peer sending a batch of blocks during sync.
+const DefaultMaxMessageRate = 3000
+
+// DefaultMaxInvItems is the most items of an inv message handled unless configured otherwise. It
+// is never below maxInvBlocks, so a full batch of block hashes is kept whole.
+const DefaultMaxInvItems = 1000
+
+// rateWindow is the window the messages of a peer are counted in
+const rateWindow = time.Minute
+
+// maxTrackedPeers is the number of peers the rate limiter tracks before forgetting the idle ones
+const maxTrackedPeers = 1024
+
+// RateLimiter counts the messages of every peer in windows of rateWindow. A peer sending more than
+// the limit in a window is throttled until the next window ends. It is safe for concurrent use.
+type RateLimiter struct {
+	mu    sync.Mutex
+	limit int                  // the most messages of a peer in a window
+	peers map[string]*peerRate // the message counts of the peers by host
+}
+
+// peerRate is the message count of a peer
+type peerRate struct {
+	window    time.Time // when the current window started
+	count     int       // the number of messages in the current window
+	throttled time.Time // until when the messages of the peer are dropped, zero if they are not
+}
+
+// NewRateLimiter creates a rate limiter allowing limit messages per peer per window.
+func NewRateLimiter(limit int) *RateLimiter {
+	return &RateLimiter{limit: limit, peers: make(map[string]*peerRate)}
+}
+
+// Allow counts a message of a peer received at now, and checks whether it may be handled. It
+// returns false while the peer is throttled.
+func (r *RateLimiter) Allow(peer string, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rate, ok := r.peers[peer]
+	if !ok {
+		if len(r.peers) >= maxTrackedPeers {
+			r.prune(now)
+		}
+
+		rate = &peerRate{window: now}
+		r.peers[peer] = rate
+	}
+
+	if now.Before(rate.throttled) {
+		return false
+	}
+
+	if now.Sub(rate.window) >= rateWindow {
+		rate.window, rate.count = now, 0
+	}
+
+	rate.count++
+	if rate.count > r.limit {
+		rate.throttled = rate.window.Add(2 * rateWindow)
+		return false
+	}
+
+	return true
+}
+
+// prune forgets the peers that sent nothing in the last window and are not throttled
+func (r *RateLimiter) prune(now time.Time) {
+	for peer, rate := range r.peers {
+		if now.Sub(rate.window) >= rateWindow && !now.Before(rate.throttled) {
+			delete(r.peers, peer)
+		}
+	}
+}
+
+// remoteHost returns the host a connection comes from, which the messages of a peer are counted
+// by whatever address the peer claims
+func remoteHost(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+
+	return host
+}
+
+// trackInbound records an inbound connection, and returns false if the node already has
+// MaxInbound open, in which case the connection is to be closed at once
+func (n *Node) trackInbound(conn net.Conn) bool {
+	n.connsLock.Lock()
+	defer n.connsLock.Unlock()
+
+	if len(n.conns) >= n.config.MaxInbound {
+		metrics.Add("inbound_refused", 1)
+		return false
+	}
+
+	n.conns[conn] = struct{}{}
+	metrics.Set("inbound_connections", int64(len(n.conns)))
+	return true
+}
+
+// untrackInbound forgets a closed inbound connection
+func (n *Node) untrackInbound(conn net.Conn) {
+	n.connsLock.Lock()
+	defer n.connsLock.Unlock()
+
+	delete(n.conns, conn)
+	metrics.Set("inbound_connections", int64(len(n.conns)))
+}
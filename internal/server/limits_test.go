@@ -0,0 +1,241 @@
+package server
+
+import (
+	"expvar"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yanglinshu/glock/internal/util"
+)
+
+// metric returns the value of a counter of the node metrics, 0 if it was never set
+func metric(name string) int64 {
+	v, ok := expvar.Get("glock").(*expvar.Map).Get(name).(*expvar.Int)
+	if !ok {
+		return 0
+	}
+
+	return v.Value()
+}
+
+// dialFrom opens a connection to the node from the given loopback host, closed when the test ends
+func dialFrom(t *testing.T, n *Node, host string) net.Conn {
+	t.Helper()
+
+	dialer := net.Dialer{Timeout: DefaultTimeout, LocalAddr: &net.TCPAddr{IP: net.ParseIP(host)}}
+	conn, err := dialer.Dial(protocol, n.Address())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+// getPeers sends a getpeers message over the connection and waits for the reply, returning the
+// error reading it
+func getPeers(t *testing.T, conn net.Conn) error {
+	t.Helper()
+
+	payload, err := util.GobEncode(GetPeers{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = writeMessage(conn, append(commandToBytes("getpeers"), payload...))
+	if err != nil {
+		return err
+	}
+
+	err = conn.SetReadDeadline(time.Now().Add(DefaultTimeout))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = readMessage(conn)
+	return err
+}
+
+// invMessage encodes an inv message of n transaction IDs
+func invMessage(t *testing.T, addrFrom string, n int) []byte {
+	t.Helper()
+
+	inv := Inv{AddrFrom: addrFrom, Type: "tx"}
+	for i := 0; i < n; i++ {
+		inv.Items = append(inv.Items, []byte(fmt.Sprintf("tx%d", i)))
+	}
+
+	payload, err := util.GobEncode(inv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return append(commandToBytes("inv"), payload...)
+}
+
+func TestRateLimiterThrottles(t *testing.T) {
+	r := NewRateLimiter(3)
+	start := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if !r.Allow("a", start) {
+			t.Fatalf("message %d of 3 refused", i+1)
+		}
+	}
+
+	// The fourth message of the window throttles the peer, the others are not affected
+	if r.Allow("a", start) {
+		t.Fatal("a message over the limit was allowed")
+	}
+
+	if !r.Allow("b", start) {
+		t.Fatal("a peer was throttled for the messages of another")
+	}
+
+	// The peer stays throttled until the window after the next one ends
+	for _, at := range []time.Duration{rateWindow, 2*rateWindow - time.Second} {
+		if r.Allow("a", start.Add(at)) {
+			t.Fatalf("a throttled peer was allowed a message %s later", at)
+		}
+	}
+
+	if !r.Allow("a", start.Add(2*rateWindow)) {
+		t.Fatal("a peer was still throttled once its throttling ended")
+	}
+}
+
+func TestRateLimiterForgetsIdlePeers(t *testing.T) {
+	r := NewRateLimiter(1)
+	start := time.Now()
+
+	r.Allow("throttled", start)
+	r.Allow("throttled", start)
+	for i := 1; i < maxTrackedPeers; i++ {
+		r.Allow(fmt.Sprintf("peer%d", i), start)
+	}
+
+	// Tracking one more peer a window later forgets the idle peers, but not the throttled one
+	r.Allow("late", start.Add(rateWindow))
+
+	if len(r.peers) != 2 {
+		t.Fatalf("rate limiter tracks %d peers, want the throttled and the late ones", len(r.peers))
+	}
+
+	if r.Allow("throttled", start.Add(rateWindow)) {
+		t.Fatal("pruning lifted the throttling of a peer")
+	}
+}
+
+func TestInboundConnectionsCapped(t *testing.T) {
+	tn := newTestNetwork(t, 0)
+	a := tn.addNode(Config{MaxInbound: 2})
+	refused := metric("inbound_refused")
+
+	// The two connections the node allows are answered
+	var open []net.Conn
+	for i := 0; i < 2; i++ {
+		conn := dialFrom(t, a, "127.0.0.1")
+		err := getPeers(t, conn)
+		if err != nil {
+			t.Fatalf("getpeers over connection %d of 2: %v", i+1, err)
+		}
+		open = append(open, conn)
+	}
+
+	// The next one is closed at once
+	err := getPeers(t, dialFrom(t, a, "127.0.0.1"))
+	if err == nil {
+		t.Fatal("a connection over the limit was answered")
+	}
+
+	if got := metric("inbound_refused") - refused; got != 1 {
+		t.Fatalf("inbound_refused grew by %d, want 1", got)
+	}
+
+	// Closing a connection frees its slot
+	open[0].Close()
+	tn.waitFor("the closed connection to be released", func() bool {
+		return getPeers(t, dialFrom(t, a, "127.0.0.1")) == nil
+	})
+}
+
+func TestInvItemsTruncated(t *testing.T) {
+	tn := newTestNetwork(t, 0)
+	a := tn.addNode(Config{MaxInvItems: maxInvBlocks})
+	peer := listen(t)
+	dropped := metric("inv_items_dropped")
+
+	err := a.handleInv(invMessage(t, peer.Addr().String(), maxInvBlocks))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = a.handleInv(invMessage(t, peer.Addr().String(), maxInvBlocks+25))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := metric("inv_items_dropped") - dropped; got != 25 {
+		t.Fatalf("inv_items_dropped grew by %d, want the 25 items over the limit", got)
+	}
+}
+
+func TestNodeResponsiveUnderFlood(t *testing.T) {
+	tn := newTestNetwork(t, 1)
+	a := tn.addNode(Config{MaxInbound: 8, MaxMessageRate: 100})
+	throttled := metric("messages_throttled")
+	spam := invMessage(t, "", DefaultMaxInvItems*2)
+
+	// Clients on one host open many more connections than allowed, each sending inv spam until
+	// the node drops it
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			conn, err := net.DialTimeout(protocol, a.Address(), DefaultTimeout)
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+
+			err = conn.SetWriteDeadline(time.Now().Add(DefaultTimeout))
+			if err != nil {
+				return
+			}
+
+			for j := 0; j < 500; j++ {
+				if writeMessage(conn, spam) != nil {
+					return
+				}
+			}
+		}()
+	}
+
+	// The node keeps serving its RPC clients during the flood
+	for i := 0; i < 10; i++ {
+		var height int
+		if err := rpcCall(t, a, "getbestheight", nil, &height); err != nil || height != 1 {
+			t.Fatalf("getbestheight during the flood = %d, %v, want 1", height, err)
+		}
+	}
+	wg.Wait()
+
+	if metric("messages_throttled") == throttled {
+		t.Fatal("the flood was never throttled")
+	}
+
+	// The flooding host stays throttled, while a peer on another host is answered
+	err := getPeers(t, dialFrom(t, a, "127.0.0.1"))
+	if err == nil {
+		t.Fatal("the flooding host was answered")
+	}
+
+	tn.waitFor("a peer on another host to be answered", func() bool {
+		return getPeers(t, dialFrom(t, a, "127.0.0.2")) == nil
+	})
+}
@@ -0,0 +1,362 @@
+package server
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/yanglinshu/glock/internal/config"
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/logger"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// DefaultMempoolSize is the number of transactions the mempool holds unless configured otherwise
+const DefaultMempoolSize = 5000
+
+// mempoolFileFormat is the format of the file holding the mempool of a stopped node
+const mempoolFileFormat = "mempool_%s.dat"
+
+// mempoolEntry is a transaction of the mempool with the data deciding its eviction
+type mempoolEntry struct {
+	tx      transaction.Transaction // the transaction
+	fee     int                     // the fee paid by the transaction
+	size    int                     // the size of the serialized transaction in bytes
+	feeRate float64                 // the fee paid per byte of the transaction
+	seq     uint64                  // the order in which the transaction was added
+	added   time.Time               // when the transaction was added
+}
+
+// MempoolInfo describes a transaction of the mempool
+type MempoolInfo struct {
+	ID    []byte    // the ID of the transaction
+	Size  int       // the size of the serialized transaction in bytes
+	Fee   int       // the fee paid by the transaction
+	Added time.Time // when the transaction entered the mempool
+}
+
+// Mempool holds the transactions waiting to be mined. Besides the transactions themselves, it
+// indexes the outputs they spend, so two transactions spending the same output never coexist. It
+// is safe for concurrent use. When full, the transaction paying the lowest fee per byte, the oldest
+// among equals, makes room for a better paying one.
+type Mempool struct {
+	mu       sync.RWMutex
+	txs      map[string]*mempoolEntry // transactions by hex ID
+	spenders map[string]string        // hex ID of the transaction spending each outpoint
+	maxSize  int                      // the maximum number of transactions, unbounded if 0
+	seq      uint64                   // the sequence number of the next transaction
+	logger   logger.Logger            // the logger of the evictions
+}
+
+// NewMempool creates an empty mempool holding at most maxSize transactions, or any number of
+// transactions if maxSize is 0. Evictions are logged to l.
+func NewMempool(maxSize int, l logger.Logger) *Mempool {
+	return &Mempool{
+		txs:      make(map[string]*mempoolEntry),
+		spenders: make(map[string]string),
+		maxSize:  maxSize,
+		logger:   l,
+	}
+}
+
+// Add adds a transaction paying the given fee to the mempool. It returns ErrMempoolConflict if the
+// transaction spends an output already spent by another transaction of the mempool, and
+// ErrMempoolFull if the mempool is full of transactions paying at least as much per byte. Adding a
+// transaction twice has no effect.
+func (m *Mempool) Add(tx transaction.Transaction, fee int) error {
+	return m.addAt(tx, fee, time.Now())
+}
+
+// addAt adds a transaction as Add does, recording that it arrived at the given time.
+func (m *Mempool) addAt(tx transaction.Transaction, fee int, added time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	txID := hex.EncodeToString(tx.ID)
+	if _, ok := m.txs[txID]; ok {
+		return nil
+	}
+
+	if !tx.IsCoinbase() {
+		for _, in := range tx.Vin {
+			if _, ok := m.spenders[outpoint(in.Txid, in.Vout)]; ok {
+				return errors.ErrMempoolConflict
+			}
+		}
+	}
+
+	size := txSize(&tx)
+	entry := &mempoolEntry{tx: tx, fee: fee, size: size, feeRate: feeRate(fee, size), seq: m.seq, added: added}
+
+	if m.maxSize > 0 && len(m.txs) >= m.maxSize {
+		lowest := m.lowest()
+		if !lowest.before(entry) {
+			return errors.ErrMempoolFull
+		}
+
+		m.logger.Info("Evicted transaction from the full mempool", "tx", lowest.tx.ID)
+		m.remove(hex.EncodeToString(lowest.tx.ID))
+	}
+
+	if !tx.IsCoinbase() {
+		for _, in := range tx.Vin {
+			m.spenders[outpoint(in.Txid, in.Vout)] = txID
+		}
+	}
+
+	m.txs[txID] = entry
+	m.seq++
+	return nil
+}
+
+// txSize returns the size of the serialized transaction, 0 if it cannot be serialized.
+func txSize(tx *transaction.Transaction) int {
+	data, err := tx.Serialize()
+	if err != nil {
+		return 0
+	}
+
+	return len(data)
+}
+
+// feeRate returns the fee paid per byte of a transaction of the given size.
+func feeRate(fee, size int) float64 {
+	if size == 0 {
+		return 0
+	}
+
+	return float64(fee) / float64(size)
+}
+
+// before checks whether the entry is evicted before the other one: it pays less per byte, or as
+// much and is older.
+func (e *mempoolEntry) before(other *mempoolEntry) bool {
+	if e.feeRate != other.feeRate {
+		return e.feeRate < other.feeRate
+	}
+
+	return e.seq < other.seq
+}
+
+// lowest returns the entry evicted first. The mempool must not be empty.
+func (m *Mempool) lowest() *mempoolEntry {
+	var lowest *mempoolEntry
+	for _, entry := range m.txs {
+		if lowest == nil || entry.before(lowest) {
+			lowest = entry
+		}
+	}
+
+	return lowest
+}
+
+// Remove removes a transaction from the mempool, releasing the outputs it spends.
+func (m *Mempool) Remove(ID []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.remove(hex.EncodeToString(ID))
+}
+
+// remove removes the transaction with the given hex ID. The caller holds the lock.
+func (m *Mempool) remove(txID string) {
+	entry, ok := m.txs[txID]
+	if !ok {
+		return
+	}
+
+	if !entry.tx.IsCoinbase() {
+		for _, in := range entry.tx.Vin {
+			delete(m.spenders, outpoint(in.Txid, in.Vout))
+		}
+	}
+
+	delete(m.txs, txID)
+}
+
+// Expire removes the transactions that arrived more than ttl ago, returning their IDs.
+func (m *Mempool) Expire(ttl time.Duration) [][]byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var expired [][]byte
+	deadline := time.Now().Add(-ttl)
+	for txID, entry := range m.txs {
+		if entry.added.Before(deadline) {
+			expired = append(expired, entry.tx.ID)
+			m.remove(txID)
+		}
+	}
+
+	return expired
+}
+
+// Get returns the transaction with the given ID, and whether it is in the mempool.
+func (m *Mempool) Get(ID []byte) (transaction.Transaction, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entry, ok := m.txs[hex.EncodeToString(ID)]
+	if !ok {
+		return transaction.Transaction{}, false
+	}
+
+	return entry.tx, true
+}
+
+// Has checks whether the transaction with the given ID is in the mempool.
+func (m *Mempool) Has(ID []byte) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.txs[hex.EncodeToString(ID)]
+	return ok
+}
+
+// Len returns the number of transactions in the mempool.
+func (m *Mempool) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return len(m.txs)
+}
+
+// Fees returns the fees paid by the transactions in the mempool.
+func (m *Mempool) Fees() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	fees := 0
+	for _, entry := range m.txs {
+		fees += entry.fee
+	}
+
+	return fees
+}
+
+// Transactions returns copies of the transactions in the mempool.
+func (m *Mempool) Transactions() []*transaction.Transaction {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	txs := make([]*transaction.Transaction, 0, len(m.txs))
+	for _, entry := range m.txs {
+		tx := entry.tx
+		txs = append(txs, &tx)
+	}
+
+	return txs
+}
+
+// Info describes the transactions in the mempool, in the order they were added.
+func (m *Mempool) Info() []MempoolInfo {
+	m.mu.RLock()
+	entries := make([]*mempoolEntry, 0, len(m.txs))
+	for _, entry := range m.txs {
+		entries = append(entries, entry)
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].seq < entries[j].seq
+	})
+
+	infos := make([]MempoolInfo, 0, len(entries))
+	for _, entry := range entries {
+		infos = append(infos, MempoolInfo{entry.tx.ID, entry.size, entry.fee, entry.added})
+	}
+
+	return infos
+}
+
+// SaveToFile saves the transactions of the mempool to the mempool file of the node, in the order
+// they were added, so a restarted node does not lose them. Their arrival times follow, so they
+// expire as if the node had not stopped.
+func (m *Mempool) SaveToFile(nodeID string) error {
+	m.mu.RLock()
+	entries := make([]*mempoolEntry, 0, len(m.txs))
+	for _, entry := range m.txs {
+		entries = append(entries, entry)
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].seq < entries[j].seq
+	})
+
+	var txs [][]byte
+	var added []int64
+	for _, entry := range entries {
+		sl, err := entry.tx.Serialize()
+		if err != nil {
+			return err
+		}
+
+		txs = append(txs, sl)
+		added = append(added, entry.added.Unix())
+	}
+
+	var content bytes.Buffer
+	enc := gob.NewEncoder(&content)
+	err := enc.Encode(txs)
+	if err != nil {
+		return err
+	}
+
+	err = enc.Encode(added)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(config.Path(fmt.Sprintf(mempoolFileFormat, nodeID)), content.Bytes(), 0644)
+}
+
+// loadMempoolFile loads the transactions saved by SaveToFile and their arrival times. A missing
+// file holds no transactions, and the transactions of a file saved without arrival times are taken
+// to arrive now.
+func loadMempoolFile(nodeID string) ([]transaction.Transaction, []time.Time, error) {
+	content, err := os.ReadFile(config.Path(fmt.Sprintf(mempoolFileFormat, nodeID)))
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var serialized [][]byte
+	dec := gob.NewDecoder(bytes.NewReader(content))
+	err = dec.Decode(&serialized)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var added []int64
+	err = dec.Decode(&added)
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+
+	var txs []transaction.Transaction
+	var times []time.Time
+	for i, sl := range serialized {
+		tx, err := transaction.DeserializeTransaction(sl)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		txs = append(txs, tx)
+		if i < len(added) {
+			times = append(times, time.Unix(added[i], 0))
+		} else {
+			times = append(times, time.Now())
+		}
+	}
+
+	return txs, times, nil
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"crypto/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/logger"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// spendOf returns a transaction spending the given output. Transactions made by it all have the
+// same size, so their fee rates compare as their fees do.
+func spendOf(t *testing.T, txid []byte, vout int) transaction.Transaction {
+	t.Helper()
+
+	id := make([]byte, 32)
+	_, err := rand.Read(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return transaction.Transaction{
+		ID:   id,
+		Vin:  []transaction.TXInput{{Txid: txid, Vout: vout}},
+		Vout: []transaction.TXOutput{{Value: 1, PublicKeyHash: make([]byte, 20)}},
+	}
+}
+
+// newSpend returns a transaction spending an output of a random transaction
+func newSpend(t *testing.T) transaction.Transaction {
+	t.Helper()
+
+	txid := make([]byte, 32)
+	_, err := rand.Read(txid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return spendOf(t, txid, 0)
+}
+
+func TestMempoolConcurrentAccess(t *testing.T) {
+	const workers, perWorker, maxSize = 8, 100, 50
+	m := NewMempool(maxSize, logger.Nop())
+
+	txs := make([][]transaction.Transaction, workers)
+	for w := range txs {
+		for i := 0; i < perWorker; i++ {
+			txs[w] = append(txs[w], newSpend(t))
+		}
+	}
+
+	// Writers add and remove transactions while readers list and look them up
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(2)
+
+		go func(txs []transaction.Transaction) {
+			defer wg.Done()
+
+			for i, tx := range txs {
+				err := m.Add(tx, i)
+				if err != nil && !errors.Is(err, errors.ErrMempoolFull) {
+					t.Errorf("Add: %v", err)
+				}
+
+				if i%3 == 0 {
+					m.Remove(tx.ID)
+				}
+			}
+		}(txs[w])
+
+		go func(txs []transaction.Transaction) {
+			defer wg.Done()
+
+			for _, tx := range txs {
+				if got, ok := m.Get(tx.ID); ok && string(got.ID) != string(tx.ID) {
+					t.Errorf("Get(%x) returned %x", tx.ID, got.ID)
+				}
+				m.Has(tx.ID)
+				m.Transactions()
+				m.Info()
+				m.Fees()
+				m.Expire(time.Hour)
+			}
+		}(txs[w])
+	}
+	wg.Wait()
+
+	if m.Len() > maxSize {
+		t.Fatalf("the mempool holds %d transactions, more than its size of %d", m.Len(), maxSize)
+	}
+
+	// Every spent output belongs to a transaction still in the mempool
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if len(m.spenders) != len(m.txs) {
+		t.Fatalf("the mempool indexes %d spent outputs for %d transactions", len(m.spenders), len(m.txs))
+	}
+
+	for op, txID := range m.spenders {
+		if _, ok := m.txs[txID]; !ok {
+			t.Fatalf("output %s is spent by %s, missing from the mempool", op, txID)
+		}
+	}
+}
+
+func TestMempoolEvictsLowestFeeRate(t *testing.T) {
+	m := NewMempool(3, logger.Nop())
+
+	var txs []transaction.Transaction
+	for _, fee := range []int{2, 1, 2} {
+		tx := newSpend(t)
+		err := m.Add(tx, fee)
+		if err != nil {
+			t.Fatal(err)
+		}
+		txs = append(txs, tx)
+	}
+
+	// A better paying transaction takes the place of the lowest paying one
+	better := newSpend(t)
+	err := m.Add(better, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Has(txs[1].ID) || !m.Has(better.ID) || m.Len() != 3 {
+		t.Fatal("adding to a full mempool did not evict the lowest paying transaction")
+	}
+
+	// None goes for a transaction paying less, and among equals the oldest goes first
+	err = m.Add(newSpend(t), 1)
+	if !errors.Is(err, errors.ErrMempoolFull) {
+		t.Fatalf("adding a transaction paying less than the rest = %v, want ErrMempoolFull", err)
+	}
+
+	err = m.Add(newSpend(t), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Has(txs[0].ID) || !m.Has(txs[2].ID) {
+		t.Fatal("the newer of two equally paying transactions was evicted first")
+	}
+}
+
+func TestMempoolRejectsConflict(t *testing.T) {
+	m := NewMempool(0, logger.Nop())
+
+	tx := newSpend(t)
+	err := m.Add(tx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Adding a transaction twice has no effect
+	err = m.Add(tx, 1)
+	if err != nil || m.Len() != 1 {
+		t.Fatalf("adding a transaction twice = %v with %d transactions", err, m.Len())
+	}
+
+	conflict := spendOf(t, tx.Vin[0].Txid, tx.Vin[0].Vout)
+	err = m.Add(conflict, 10)
+	if !errors.Is(err, errors.ErrMempoolConflict) {
+		t.Fatalf("adding a double spend = %v, want ErrMempoolConflict", err)
+	}
+
+	// Removing the transaction releases the output
+	m.Remove(tx.ID)
+	err = m.Add(conflict, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"bytes"
+	"encoding/gob"
+	"net"
+	"time"
+
+	"github.com/yanglinshu/glock/internal/block"
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/util"
+)
+
+// GetMerkleProof asks a node for the proof that a transaction is included in the main chain
+type GetMerkleProof struct {
+	AddrFrom string // the address of the node, empty for a client
+	TxID     []byte // the ID of the transaction
+}
+
+// MerkleProof is the reply to the getmerkleproof command. A client holding the headers of the main
+// chain checks it with block.VerifyProof against the Merkle root of the header.
+type MerkleProof struct {
+	Header block.BlockHeader // the header of the block holding the transaction
+	Index  int               // the position of the transaction in the block
+	Proof  [][]byte          // the sibling hashes from the leaf up, see block.MerkleTree.Proof
+	Error  string            // the reason no proof could be built, if any
+}
+
+// merkleProof builds the proof that a transaction is included in the main chain
+func (n *Node) merkleProof(txID []byte) (MerkleProof, error) {
+	_, bl, err := n.bc.FindTransactionBlock(txID)
+	if err != nil {
+		return MerkleProof{}, err
+	}
+
+	index, proof, err := bl.MerkleProof(txID)
+	if err != nil {
+		return MerkleProof{}, err
+	}
+
+	return MerkleProof{Header: bl.Header(), Index: index, Proof: proof}, nil
+}
+
+// RequestMerkleProof asks the local node for the proof that a transaction is included in the main
+// chain. It returns ErrNodeNotRunning if the node is not running.
+func (c *Client) RequestMerkleProof(txID []byte) (MerkleProof, error) {
+	payload, err := util.GobEncode(GetMerkleProof{TxID: txID})
+	if err != nil {
+		return MerkleProof{}, err
+	}
+
+	request := append(commandToBytes("getmerkleproof"), payload...)
+
+	reply, err := requestData(c.nodeAddress, request)
+	if err != nil {
+		if _, ok := err.(*net.OpError); ok {
+			return MerkleProof{}, errors.Wrapf(errors.ErrNodeNotRunning, "node %s", c.nodeAddress)
+		}
+		return MerkleProof{}, err
+	}
+
+	var proof MerkleProof
+	dec := gob.NewDecoder(bytes.NewReader(reply))
+	err = dec.Decode(&proof)
+	if err != nil {
+		return MerkleProof{}, err
+	}
+
+	if proof.Error != "" {
+		return MerkleProof{}, errors.NewError(proof.Error)
+	}
+
+	return proof, nil
+}
+
+// handleGetMerkleProof handles the getmerkleproof command, replying with the proof on the
+// connection
+func (n *Node) handleGetMerkleProof(request []byte, conn net.Conn) error {
+	var payload GetMerkleProof
+
+	dec := gob.NewDecoder(bytes.NewReader(request[commandLength:]))
+	err := dec.Decode(&payload)
+	if err != nil {
+		return err
+	}
+
+	proof, err := n.merkleProof(payload.TxID)
+	if err != nil {
+		proof.Error = err.Error()
+	}
+
+	reply, err := util.GobEncode(proof)
+	if err != nil {
+		return err
+	}
+
+	err = conn.SetWriteDeadline(time.Now().Add(n.config.WriteTimeout))
+	if err != nil {
+		return err
+	}
+
+	return writeMessage(conn, reply)
+}
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/yanglinshu/glock/internal/block"
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/metrics"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// miningState tracks the block being mined, which is shared by the connection handlers
+type miningState struct {
+	cancel  context.CancelFunc // aborts the block being mined, if any
+	height  int                // the height of the block being mined
+	lastLog time.Time          // when the hash rate was last logged
+	lock    sync.Mutex         // guards the mining state
+}
+
+// hashRateLogInterval is how often the hash rate is logged while a block is mined
+const hashRateLogInterval = 10 * time.Second
+
+// startMining returns the context in which to mine the block at the given height, and a function
+// to call once mining is over. The context is canceled when a competing block is added or the node
+// stops.
+func (n *Node) startMining(height int) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(n.ctx)
+
+	n.mining.lock.Lock()
+	n.mining.cancel = cancel
+	n.mining.height = height
+	n.mining.lock.Unlock()
+
+	done := func() {
+		n.mining.lock.Lock()
+		n.mining.cancel = nil
+		n.mining.lock.Unlock()
+
+		metrics.SetFloat("mining_hashrate", 0)
+		cancel()
+	}
+
+	return ctx, done
+}
+
+// reportHashRate publishes the hash rate of the block being mined as a metric, and logs it every
+// hashRateLogInterval.
+func (n *Node) reportHashRate(hashes int, hashesPerSec float64) {
+	metrics.SetFloat("mining_hashrate", hashesPerSec)
+
+	n.mining.lock.Lock()
+	defer n.mining.lock.Unlock()
+
+	if time.Since(n.mining.lastLog) < hashRateLogInterval {
+		return
+	}
+	n.mining.lastLog = time.Now()
+
+	n.logger.Info("Mining", "height", n.mining.height, "hashes", hashes, "rate", fmt.Sprintf("%.0f H/s", hashesPerSec))
+}
+
+// cancelStaleMining cancels mining if a block at the given height or above has been added.
+func (n *Node) cancelStaleMining(height int) {
+	n.mining.lock.Lock()
+	defer n.mining.lock.Unlock()
+
+	if n.mining.cancel != nil && height >= n.mining.height {
+		n.mining.cancel()
+	}
+}
+
+// minerEventBuffer is the number of events the mining loop may lag behind
+const minerEventBuffer = 64
+
+// mineLoop mines the transactions of the mempool until the context is canceled. It mines as long
+// as the mempool holds valid transactions, then waits for a transaction to be accepted. If an idle
+// interval is configured, a block is mined every interval even without transactions.
+func (n *Node) mineLoop(ctx context.Context) {
+	txEvents := n.eventBus.Subscribe(minerEventBuffer)
+	defer n.eventBus.Unsubscribe(txEvents)
+
+	var idle <-chan time.Time
+	if n.config.MiningIdleInterval > 0 {
+		ticker := time.NewTicker(n.config.MiningIdleInterval)
+		defer ticker.Stop()
+		idle = ticker.C
+	}
+
+	for {
+		for ctx.Err() == nil && n.mineMempool(false) {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-txEvents:
+		case <-idle:
+			n.mineMempool(true)
+		}
+	}
+}
+
+// transactionsToMine returns the valid transactions of the mempool in the order they are mined.
+// Transactions already in the main chain, such as the ones of a block received from a peer, are
+// removed from the mempool first.
+func (n *Node) transactionsToMine() ([]*transaction.Transaction, error) {
+	var txs []*transaction.Transaction
+	for _, tx := range n.mempool.Transactions() {
+		_, err := n.bc.LocateTransaction(tx.ID)
+		if err == nil {
+			n.mempool.Remove(tx.ID)
+			continue
+		}
+
+		if ok, err := n.bc.VerifyTransaction(tx); err == nil && ok {
+			txs = append(txs, tx)
+		}
+	}
+
+	err := orderForMining(n.bc, txs)
+	if err != nil {
+		return nil, err
+	}
+
+	return txs, nil
+}
+
+// mineMempool mines a block of the valid transactions of the mempool, or an empty one if
+// allowEmpty is set and there are none. The block goes through the same template and submission as
+// the ones of an external miner. It returns whether mining should be attempted again right away: a
+// block was mined, or a competing block canceled it.
+func (n *Node) mineMempool(allowEmpty bool) bool {
+	txs, err := n.transactionsToMine()
+	if err != nil {
+		n.logger.Error("Failed to order the transactions to mine", "err", err)
+		return false
+	}
+
+	if len(txs) == 0 && !allowEmpty {
+		return false
+	}
+
+	template, err := n.bc.BuildBlockTemplate(txs, n.miningAddress)
+	if err != nil {
+		n.logger.Error("Failed to build a block template", "err", err)
+		return false
+	}
+	height := template.Height
+
+	// Mine the template, then connect it as a submitted block
+	ctx, done := n.startMining(height)
+	err = template.Mine(ctx, n.reportHashRate)
+	done()
+	if err == context.Canceled && n.ctx.Err() != nil {
+		n.logger.Info("Mining canceled, the node is stopping", "height", height)
+		return false
+	}
+	if err == context.Canceled {
+		n.logger.Info("Mining canceled, a competing block was received", "height", height)
+		return true
+	}
+	if err != nil {
+		n.logger.Error("Failed to mine a block", "height", height, "err", err)
+		return false
+	}
+
+	err = n.submitBlock(template)
+	if errors.Is(err, errors.ErrStaleBlock) {
+		n.logger.Info("Mined block is stale, a competing block was received", "height", height)
+		return true
+	}
+	if err != nil {
+		n.logger.Error("Failed to add the mined block", "height", height, "err", err)
+		return false
+	}
+
+	n.logger.Info("Mined block", "block", template.Hash, "height", height, "transactions", len(template.Transactions))
+
+	return true
+}
+
+// submitBlock connects a block mined from a template, clears its transactions from the mempool, the
+// ones left out waiting for the next block, and announces it to the known nodes.
+func (n *Node) submitBlock(bl *block.Block) error {
+	err := n.bc.SubmitBlock(bl)
+	if err != nil {
+		return err
+	}
+
+	for _, tx := range bl.Transactions {
+		n.mempool.Remove(tx.ID)
+	}
+
+	// A block mined elsewhere makes the one being mined here stale
+	n.cancelStaleMining(bl.Height)
+	n.publishTip(bl)
+
+	n.broadcastInv("block", bl.Hash, "")
+
+	return nil
+}
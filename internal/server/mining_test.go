@@ -0,0 +1,32 @@
+package server
+
+import "testing"
+
+func TestCompetingBlockCancelsMining(t *testing.T) {
+	tn := newTestNetwork(t, 0)
+	a := tn.addNode(Config{})
+
+	ctx, done := a.startMining(5)
+	defer done()
+
+	// A block below the one being mined does not compete with it
+	a.cancelStaleMining(4)
+	if ctx.Err() != nil {
+		t.Fatal("a block below the one being mined canceled mining")
+	}
+
+	a.cancelStaleMining(5)
+	if ctx.Err() == nil {
+		t.Fatal("a block at the height being mined did not cancel mining")
+	}
+
+	// Once mining is over, a later block has nothing to cancel
+	done()
+	next, nextDone := a.startMining(6)
+	defer nextDone()
+
+	a.cancelStaleMining(5)
+	if next.Err() != nil {
+		t.Fatal("a stale block canceled mining the next height")
+	}
+}
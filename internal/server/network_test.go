@@ -0,0 +1,317 @@
+package server
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/yanglinshu/glock/internal/blockchain"
+	"github.com/yanglinshu/glock/internal/events"
+)
+
+func TestFreshNodeSyncs(t *testing.T) {
+	tn := newTestNetwork(t, 0)
+
+	a := tn.addNode(Config{})
+	_, err := a.generate(20, tn.address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := tn.addNode(Config{}, a)
+	tn.waitHeight(20, a, b)
+
+	// The UTXO set follows the downloaded blocks
+	utxoSet := &blockchain.UTXOSet{Blockchain: b.bc}
+	stats, err := utxoSet.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(stats.BestBlock, b.bc.Tip()) {
+		t.Fatalf("UTXO set applied up to %x, want the tip %x", stats.BestBlock, b.bc.Tip())
+	}
+}
+
+func TestNodesExchangeBlocks(t *testing.T) {
+	tn := newTestNetwork(t, 0)
+
+	a := tn.addNode(Config{})
+	b := tn.addNode(Config{}, a)
+
+	// Readers of the shared peer state run alongside the exchange
+	done := make(chan struct{})
+	defer close(done)
+	for _, n := range []*Node{a, b} {
+		go func(n *Node) {
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					n.knownNodes.Peers()
+					n.knownNodes.Info()
+					n.blocksInTransit.Len()
+				}
+			}
+		}(n)
+	}
+
+	// Each node mines in turn and the other follows
+	for round := 1; round <= 4; round++ {
+		miner := a
+		if round%2 == 0 {
+			miner = b
+		}
+
+		_, err := miner.generate(3, tn.address)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tn.waitHeight(3*round, a, b)
+	}
+
+	if !a.knownNodes.IsKnown(b.Address()) || !b.knownNodes.IsKnown(a.Address()) {
+		t.Fatal("the nodes do not know each other")
+	}
+}
+
+func TestSyncOverPersistentConnections(t *testing.T) {
+	tn := newTestNetwork(t, 0)
+
+	a := tn.addNode(Config{})
+	_, err := a.generate(50, tn.address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := tn.addNode(Config{}, a)
+	tn.waitHeight(50, a, b)
+
+	// Each node holds the single connection the other opened for the whole sync
+	for _, n := range []*Node{a, b} {
+		tn.waitFor("the connections to settle", func() bool {
+			n.connsLock.Lock()
+			defer n.connsLock.Unlock()
+
+			return len(n.conns) == 1
+		})
+	}
+
+	for _, link := range [][2]*Node{{a, b}, {b, a}} {
+		pc := link[0].pool.peer(link[1].Address())
+
+		pc.lock.Lock()
+		open := pc.conn != nil
+		pc.lock.Unlock()
+
+		if !open {
+			t.Fatalf("%s holds no connection to %s", link[0].Address(), link[1].Address())
+		}
+	}
+}
+
+func TestTransactionRelayedToMiner(t *testing.T) {
+	tn := newTestNetwork(t, 2)
+
+	a := tn.addNode(Config{})
+	b := tn.addNode(Config{}, a)
+	miner := tn.addNode(Config{MinerAddress: tn.address.String()}, a, b)
+	tn.waitHeight(2, a, b, miner)
+
+	// The client hands the transaction to a, which floods it to its peers, the miner among them
+	tx := tn.payment(a, 5, 1)
+	client := NewClient("", []string{a.Address()}, DefaultNetwork)
+	err := client.SendTransaction(tx, a.genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tn.waitConfirmed(tx, a, b, miner)
+	tn.waitHeight(3, a, b, miner)
+
+	if _, ok := miner.mempool.Get(tx.ID); ok {
+		t.Fatal("the miner kept the transaction it mined in its mempool")
+	}
+}
+
+func TestTransactionReachesMempools(t *testing.T) {
+	tn := newTestNetwork(t, 1)
+
+	a := tn.addNode(Config{})
+	b := tn.addNode(Config{}, a)
+	c := tn.addNode(Config{}, b)
+	tn.waitHeight(1, a, b, c)
+
+	tx := tn.payment(c, 5, 1)
+	client := NewClient("", []string{c.Address()}, DefaultNetwork)
+	err := client.SendTransaction(tx, c.genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tn.waitMempool(tx, a, b, c)
+}
+
+func TestPartitionHealsThroughReorg(t *testing.T) {
+	tn := newTestNetwork(t, 2)
+
+	// The nodes share the prefix, then mine apart
+	a := tn.addNode(Config{})
+	b := tn.addNode(Config{})
+
+	tx := tn.payment(a, 5, 1)
+	_, err := a.generate(2, tn.address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a.mempool.Add(*tx, 1)
+	_, err = a.generate(1, tn.address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tn.waitConfirmed(tx, a)
+
+	_, err = b.generate(5, tn.address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Once the partition heals, a gives up its shorter branch for the one of b
+	ch := a.Subscribe(64)
+	tn.connect(a, b)
+	tn.waitHeight(7, a, b)
+
+	// The payment confirmed on the abandoned branch goes back to the mempool of a
+	tn.waitEvent(ch, events.TxUnconfirmed, tx.ID)
+	tn.waitMempool(tx, a)
+
+	statsA, err := (&blockchain.UTXOSet{Blockchain: a.bc}).Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statsB, err := (&blockchain.UTXOSet{Blockchain: b.bc}).Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(statsA.Hash, statsB.Hash) {
+		t.Fatalf("UTXO sets differ after the reorg: %x and %x", statsA.Hash, statsB.Hash)
+	}
+
+	// The payment is mined again on the winning branch
+	_, err = a.generate(1, tn.address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tn.waitHeight(8, a, b)
+	tn.waitConfirmed(tx, a, b)
+}
+
+func TestReorgDropsConflictingTransaction(t *testing.T) {
+	tn := newTestNetwork(t, 0)
+
+	// Both payments spend the genesis reward, the only output of the wallet
+	a := tn.addNode(Config{})
+	b := tn.addNode(Config{})
+	spend := tn.payment(a, 5, 1)
+	doubleSpend := tn.payment(b, 6, 1)
+
+	err := a.mempool.Add(*spend, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = a.generate(1, tn.address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = b.mempool.Add(*doubleSpend, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = b.generate(3, tn.address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch := a.Subscribe(64)
+	tn.connect(a, b)
+	tn.waitHeight(3, a, b)
+
+	// The payment of the abandoned branch conflicts with the winning one and is dropped
+	tn.waitEvent(ch, events.TxConflicted, spend.ID)
+	tn.waitConfirmed(doubleSpend, a)
+
+	if _, ok := a.mempool.Get(spend.ID); ok {
+		t.Fatal("a payment conflicting with the main chain went back to the mempool")
+	}
+}
+
+// offlineAddress returns an address of the loopback interface no node listens on
+func offlineAddress(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	return addr
+}
+
+func TestTransactionSpreadsWithBootstrapNodeOffline(t *testing.T) {
+	tn := newTestNetwork(t, 1)
+	offline := offlineAddress(t)
+
+	// The first peer a knows of, the node it bootstrapped from, is gone
+	a := tn.addNode(Config{})
+	b := tn.addNode(Config{})
+	a.knownNodes.AddPeer(offline)
+	tn.connect(a, b)
+	tn.connect(b, a)
+	tn.waitHeight(1, a, b)
+
+	if peers := a.knownNodes.Peers(); len(peers) != 2 || peers[0] != offline {
+		t.Fatalf("peers of a = %v, want the offline node first", peers)
+	}
+
+	tx := tn.payment(a, 5, 1)
+	err := a.SendTransaction(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tn.waitMempool(tx, a, b)
+}
+
+func TestClientSkipsOfflineSeed(t *testing.T) {
+	tn := newTestNetwork(t, 1)
+	offline := offlineAddress(t)
+
+	a := tn.addNode(Config{})
+	b := tn.addNode(Config{}, a)
+	tn.waitHeight(1, a, b)
+
+	// With every seed offline, the client says so
+	tx := tn.payment(b, 3, 1)
+	err := NewClient("", []string{offline}, DefaultNetwork).SendTransaction(tx, b.genesis)
+	if err == nil {
+		t.Fatal("sending a transaction to an offline seed alone succeeded")
+	}
+
+	// A client whose first seed is offline still reaches the network through the next one
+	client := NewClient("", []string{offline, b.Address()}, DefaultNetwork)
+	err = client.SendTransaction(tx, b.genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tn.waitMempool(tx, a, b)
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"bytes"
+	"encoding/hex"
+	"sync"
+
+	"github.com/yanglinshu/glock/internal/block"
+)
+
+// maxOrphans is the largest number of blocks kept while their parent is unknown
+const maxOrphans = 100
+
+// OrphanPool holds the blocks received before their parent, until the parent arrives. It is safe
+// for concurrent use.
+type OrphanPool struct {
+	mu     sync.Mutex
+	blocks map[string][]*block.Block // the orphans by the hash of their parent
+	size   int                       // the number of orphans held
+}
+
+// NewOrphanPool creates an empty orphan pool.
+func NewOrphanPool() *OrphanPool {
+	return &OrphanPool{blocks: make(map[string][]*block.Block)}
+}
+
+// Add keeps a block until its parent arrives. It returns false if the block is already held or the
+// pool is full.
+func (p *OrphanPool) Add(bl *block.Block) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.size >= maxOrphans {
+		return false
+	}
+
+	parent := hex.EncodeToString(bl.PrevBlockHash)
+	for _, orphan := range p.blocks[parent] {
+		if bytes.Equal(orphan.Hash, bl.Hash) {
+			return false
+		}
+	}
+
+	p.blocks[parent] = append(p.blocks[parent], bl)
+	p.size++
+
+	return true
+}
+
+// TakeChildren removes and returns the orphans whose parent is the given block.
+func (p *OrphanPool) TakeChildren(parent []byte) []*block.Block {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := hex.EncodeToString(parent)
+	children := p.blocks[key]
+	delete(p.blocks, key)
+	p.size -= len(children)
+
+	return children
+}
@@ -0,0 +1,231 @@
+package server
+
+import (
+	"bytes"
+	"sync"
+	"time"
+)
+
+// PeerManager holds the addresses of the known nodes and what the keepalive learned about them. It
+// is safe for concurrent use.
+type PeerManager struct {
+	mu     sync.RWMutex
+	peers  []string               // addresses of the known nodes, in the order they were learned
+	health map[string]*peerHealth // the keepalive state of the known nodes by address
+}
+
+// peerHealth is the keepalive state of a peer
+type peerHealth struct {
+	lastSeen time.Time     // when a message of the peer was last received
+	rtt      time.Duration // the round-trip time of the last ping answered
+	nonce    uint64        // the nonce of the ping waiting for a pong, 0 if none
+	pingSent time.Time     // when the ping waiting for a pong was sent
+	missed   int           // the number of consecutive pings left unanswered
+	invalid  int           // the number of invalid blocks received from the peer
+}
+
+// PeerInfo describes a known node
+type PeerInfo struct {
+	Address  string        // the address of the node
+	LastSeen time.Time     // when a message of the node was last received, zero if never
+	RTT      time.Duration // the round-trip time of the last ping answered, zero if none
+}
+
+// NewPeerManager creates a peer manager knowing the given nodes.
+func NewPeerManager(seeds ...string) *PeerManager {
+	pm := &PeerManager{}
+	for _, seed := range seeds {
+		pm.AddPeer(seed)
+	}
+
+	return pm
+}
+
+// AddPeer adds a node to the known nodes. It returns false if the node was already known.
+func (pm *PeerManager) AddPeer(addr string) bool {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	for _, peer := range pm.peers {
+		if peer == addr {
+			return false
+		}
+	}
+
+	pm.peers = append(pm.peers, addr)
+	if pm.health == nil {
+		pm.health = make(map[string]*peerHealth)
+	}
+	pm.health[addr] = &peerHealth{}
+
+	return true
+}
+
+// RemovePeer removes a node from the known nodes.
+func (pm *PeerManager) RemovePeer(addr string) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	var updated []string
+	for _, peer := range pm.peers {
+		if peer != addr {
+			updated = append(updated, peer)
+		}
+	}
+
+	pm.peers = updated
+	delete(pm.health, addr)
+}
+
+// Peers returns a copy of the addresses of the known nodes.
+func (pm *PeerManager) Peers() []string {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	peers := make([]string, len(pm.peers))
+	copy(peers, pm.peers)
+
+	return peers
+}
+
+// IsKnown checks whether the node is known.
+func (pm *PeerManager) IsKnown(addr string) bool {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	for _, peer := range pm.peers {
+		if peer == addr {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Seen records that a message of a known node was received.
+func (pm *PeerManager) Seen(addr string) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if health, ok := pm.health[addr]; ok {
+		health.lastSeen = time.Now()
+	}
+}
+
+// ExpectPong records a ping sent to a known node with the given nonce. It returns the number of
+// consecutive pings the node left unanswered, counting the previous one if still waiting.
+func (pm *PeerManager) ExpectPong(addr string, nonce uint64) int {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	health, ok := pm.health[addr]
+	if !ok {
+		return 0
+	}
+
+	if health.nonce != 0 {
+		health.missed++
+	}
+	health.nonce = nonce
+	health.pingSent = time.Now()
+
+	return health.missed
+}
+
+// Pong records the pong of a known node, measuring its round-trip time. It returns false if the
+// nonce does not match the ping waiting for a pong.
+func (pm *PeerManager) Pong(addr string, nonce uint64) bool {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	health, ok := pm.health[addr]
+	if !ok || health.nonce == 0 || health.nonce != nonce {
+		return false
+	}
+
+	health.rtt = time.Since(health.pingSent)
+	health.nonce = 0
+	health.missed = 0
+
+	return true
+}
+
+// Penalize records an invalid block received from a known node. It returns the number of invalid
+// blocks received from the node so far.
+func (pm *PeerManager) Penalize(addr string) int {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	health, ok := pm.health[addr]
+	if !ok {
+		return 0
+	}
+
+	health.invalid++
+	return health.invalid
+}
+
+// Info returns the description of the known nodes, in the order they were learned.
+func (pm *PeerManager) Info() []PeerInfo {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	info := make([]PeerInfo, len(pm.peers))
+	for i, peer := range pm.peers {
+		info[i] = PeerInfo{Address: peer}
+		if health, ok := pm.health[peer]; ok {
+			info[i].LastSeen = health.lastSeen
+			info[i].RTT = health.rtt
+		}
+	}
+
+	return info
+}
+
+// BlockQueue holds the hashes of the blocks announced by a peer and not requested yet. It is safe
+// for concurrent use.
+type BlockQueue struct {
+	mu     sync.Mutex
+	hashes [][]byte // hashes of the blocks to request, in order
+}
+
+// NewBlockQueue creates an empty block queue.
+func NewBlockQueue() *BlockQueue {
+	return &BlockQueue{}
+}
+
+// Reset replaces the queued hashes, leaving out the given hash that is already being requested.
+func (q *BlockQueue) Reset(hashes [][]byte, requested []byte) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.hashes = nil
+	for _, hash := range hashes {
+		if !bytes.Equal(hash, requested) {
+			q.hashes = append(q.hashes, hash)
+		}
+	}
+}
+
+// Pop removes and returns the next hash to request, or false if the queue is empty.
+func (q *BlockQueue) Pop() ([]byte, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.hashes) == 0 {
+		return nil, false
+	}
+
+	hash := q.hashes[0]
+	q.hashes = q.hashes[1:]
+
+	return hash, true
+}
+
+// Len returns the number of queued hashes.
+func (q *BlockQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.hashes)
+}
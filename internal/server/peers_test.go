@@ -0,0 +1,98 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestPeerManagerConcurrentAccess(t *testing.T) {
+	pm := NewPeerManager("seed:1")
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+
+		go func(w int) {
+			defer wg.Done()
+
+			for i := 0; i < 100; i++ {
+				addr := fmt.Sprintf("node%d:%d", w, i)
+				if !pm.AddPeer(addr) {
+					t.Errorf("AddPeer(%s) found a node never added", addr)
+				}
+				pm.Seen(addr)
+				pm.ExpectPong(addr, uint64(i+1))
+				pm.Pong(addr, uint64(i+1))
+				pm.Penalize(addr)
+				pm.IsKnown("seed:1")
+				pm.Peers()
+				pm.Info()
+
+				if i%2 == 0 {
+					pm.RemovePeer(addr)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	peers := pm.Peers()
+	if len(peers) != 1+8*50 {
+		t.Fatalf("%d known nodes, want %d", len(peers), 1+8*50)
+	}
+
+	if pm.AddPeer("seed:1") || !pm.IsKnown("node3:99") || pm.IsKnown("node3:98") {
+		t.Fatal("the known nodes do not match the nodes added and removed")
+	}
+}
+
+func TestBlockQueue(t *testing.T) {
+	q := NewBlockQueue()
+
+	var hashes [][]byte
+	for i := 0; i < 200; i++ {
+		hashes = append(hashes, []byte{byte(i)})
+	}
+
+	// The block already requested is left out
+	q.Reset(hashes, hashes[0])
+	if q.Len() != len(hashes)-1 {
+		t.Fatalf("queue holds %d hashes, want %d", q.Len(), len(hashes)-1)
+	}
+
+	// Concurrent pops hand out every hash exactly once
+	var mu sync.Mutex
+	popped := make(map[byte]int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for {
+				hash, ok := q.Pop()
+				if !ok {
+					return
+				}
+
+				mu.Lock()
+				popped[hash[0]]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(popped) != len(hashes)-1 || popped[0] != 0 {
+		t.Fatalf("popped %d distinct hashes, want all but the requested one", len(popped))
+	}
+
+	for hash, n := range popped {
+		if n != 1 {
+			t.Fatalf("hash %x was popped %d times", hash, n)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/gob"
+	"net"
+	"time"
+
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/util"
+)
+
+// DefaultPingInterval is how often the peers are pinged unless configured otherwise
+const DefaultPingInterval = 30 * time.Second
+
+// maxMissedPongs is the number of consecutive pings a peer may leave unanswered before it is
+// forgotten
+const maxMissedPongs = 3
+
+// Ping checks that a peer is alive
+type Ping struct {
+	AddrFrom string // the address of the node
+	Nonce    uint64 // random value the pong echoes
+}
+
+// Pong answers a ping
+type Pong struct {
+	AddrFrom string // the address of the node
+	Nonce    uint64 // the nonce of the ping
+}
+
+// GetPeers asks a node for the description of its peers
+type GetPeers struct {
+	AddrFrom string // the address of the node, empty for a client
+}
+
+// randomNonce returns a random nonce, never 0
+func randomNonce() (uint64, error) {
+	var nonce [8]byte
+	for {
+		_, err := rand.Read(nonce[:])
+		if err != nil {
+			return 0, err
+		}
+
+		if n := binary.BigEndian.Uint64(nonce[:]); n != 0 {
+			return n, nil
+		}
+	}
+}
+
+// keepAlive pings the peers periodically until the context is canceled
+func (n *Node) keepAlive(ctx context.Context) {
+	ticker := time.NewTicker(n.config.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n.pingPeers()
+		}
+	}
+}
+
+// pingPeers pings every peer, forgetting the ones that left too many pings unanswered
+func (n *Node) pingPeers() {
+	for _, peer := range n.knownNodes.Peers() {
+		if peer == n.address {
+			continue
+		}
+
+		nonce, err := randomNonce()
+		if err != nil {
+			n.logger.Error("Failed to draw a ping nonce", "err", err)
+			return
+		}
+
+		if n.knownNodes.ExpectPong(peer, nonce) >= maxMissedPongs {
+			n.logger.Warn("Forgetting peer after unanswered pings", "peer", peer, "pings", maxMissedPongs)
+			n.knownNodes.RemovePeer(peer)
+			continue
+		}
+
+		n.sendPing(peer, nonce)
+	}
+}
+
+// sendPing sends a ping with the given nonce to the given address
+func (n *Node) sendPing(addr string, nonce uint64) error {
+	payload, err := util.GobEncode(Ping{n.address, nonce})
+	if err != nil {
+		return err
+	}
+
+	request := append(commandToBytes("ping"), payload...)
+	return n.sendData(addr, request)
+}
+
+// handlePing handles the ping command, answering with a pong
+func (n *Node) handlePing(request []byte) error {
+	var buff bytes.Buffer
+	var payload Ping
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		return err
+	}
+
+	reply, err := util.GobEncode(Pong{n.address, payload.Nonce})
+	if err != nil {
+		return err
+	}
+
+	return n.sendData(payload.AddrFrom, append(commandToBytes("pong"), reply...))
+}
+
+// handlePong handles the pong command
+func (n *Node) handlePong(request []byte) error {
+	var buff bytes.Buffer
+	var payload Pong
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		return err
+	}
+
+	if !n.knownNodes.Pong(payload.AddrFrom, payload.Nonce) {
+		n.logger.Debug("Unexpected pong", "peer", payload.AddrFrom)
+	}
+
+	return nil
+}
+
+// RequestPeers asks the local node for the description of its peers. It returns ErrNodeNotRunning
+// if the node is not running.
+func (c *Client) RequestPeers() ([]PeerInfo, error) {
+	payload, err := util.GobEncode(GetPeers{})
+	if err != nil {
+		return nil, err
+	}
+
+	request := append(commandToBytes("getpeers"), payload...)
+
+	reply, err := requestData(c.nodeAddress, request)
+	if err != nil {
+		if _, ok := err.(*net.OpError); ok {
+			return nil, errors.Wrapf(errors.ErrNodeNotRunning, "node %s", c.nodeAddress)
+		}
+		return nil, err
+	}
+
+	var peers []PeerInfo
+	dec := gob.NewDecoder(bytes.NewReader(reply))
+	err = dec.Decode(&peers)
+	if err != nil {
+		return nil, err
+	}
+
+	return peers, nil
+}
+
+// handleGetPeers handles the getpeers command, replying with the description of the peers
+func (n *Node) handleGetPeers(conn net.Conn) error {
+	reply, err := util.GobEncode(n.knownNodes.Info())
+	if err != nil {
+		return err
+	}
+
+	err = conn.SetWriteDeadline(time.Now().Add(n.config.WriteTimeout))
+	if err != nil {
+		return err
+	}
+
+	return writeMessage(conn, reply)
+}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/yanglinshu/glock/internal/errors"
+)
+
+// minBackoff is how long to wait before dialing a peer again after a first failure
+const minBackoff = 500 * time.Millisecond
+
+// maxBackoff caps the wait between two attempts to dial a peer
+const maxBackoff = 30 * time.Second
+
+// peerConn is the outbound connection to a peer
+type peerConn struct {
+	lock     sync.Mutex // serializes the messages sent to the peer
+	conn     net.Conn   // the open connection, nil if none
+	failures int        // the number of failed dials in a row
+	retryAt  time.Time  // the earliest time to dial again after a failure
+}
+
+// ConnPool keeps one outbound connection per peer and sends every message to a peer over it. A
+// broken connection is dialed again on the next message, waiting longer after every failed dial.
+// It is safe for concurrent use.
+type ConnPool struct {
+	lock     sync.Mutex             // guards peers
+	peers    map[string]*peerConn   // the connections by address
+	timeout  time.Duration          // how long dialing a peer or writing a message may take
+	greeting func() ([]byte, error) // the version message opening every new connection, if any
+}
+
+// NewConnPool creates an empty connection pool giving up on a dial or a write after timeout. Every
+// new connection starts with the version message returned by greeting, as peers only handle the
+// messages of connections the sender was verified on. greeting may be nil.
+func NewConnPool(timeout time.Duration, greeting func() ([]byte, error)) *ConnPool {
+	return &ConnPool{peers: make(map[string]*peerConn), timeout: timeout, greeting: greeting}
+}
+
+// peer returns the connection state of a peer, creating it if needed
+func (p *ConnPool) peer(addr string) *peerConn {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	pc, ok := p.peers[addr]
+	if !ok {
+		pc = &peerConn{}
+		p.peers[addr] = pc
+	}
+
+	return pc
+}
+
+// Send sends a message to a peer, dialing it if no connection is open. A message failing on a
+// connection that was reused is sent once more over a new connection, as the peer may have closed
+// it in the meantime. It returns ErrPeerBackoff if the last dial failed too recently.
+func (p *ConnPool) Send(addr string, message []byte) error {
+	pc := p.peer(addr)
+
+	pc.lock.Lock()
+	defer pc.lock.Unlock()
+
+	if pc.conn != nil {
+		err := p.write(pc.conn, message)
+		if err == nil {
+			return nil
+		}
+
+		pc.conn.Close()
+		pc.conn = nil
+	}
+
+	if time.Now().Before(pc.retryAt) {
+		return errors.ErrPeerBackoff
+	}
+
+	conn, err := net.DialTimeout(protocol, addr, p.timeout)
+	if err != nil {
+		backoff := maxBackoff
+		if pc.failures < 16 && minBackoff<<pc.failures < maxBackoff {
+			backoff = minBackoff << pc.failures
+		}
+		pc.failures++
+		pc.retryAt = time.Now().Add(backoff)
+
+		return err
+	}
+	pc.failures = 0
+	pc.retryAt = time.Time{}
+
+	err = p.greet(conn, message)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	err = p.write(conn, message)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	pc.conn = conn
+	go pc.watch(conn)
+
+	return nil
+}
+
+// greet opens a new connection with the version message of the pool, unless the message to send
+// is a version message itself
+func (p *ConnPool) greet(conn net.Conn, message []byte) error {
+	if p.greeting == nil || bytesToCommand(message[:commandLength]) == "version" {
+		return nil
+	}
+
+	version, err := p.greeting()
+	if err != nil {
+		return err
+	}
+
+	return p.write(conn, version)
+}
+
+// write writes a message, giving up after the timeout of the pool
+func (p *ConnPool) write(conn net.Conn, message []byte) error {
+	err := conn.SetWriteDeadline(time.Now().Add(p.timeout))
+	if err != nil {
+		return err
+	}
+
+	return writeMessage(conn, message)
+}
+
+// watch drops the connection once the peer closes it, so the next message dials again instead of
+// being written to a dead connection. Peers never send anything back over it.
+func (pc *peerConn) watch(conn net.Conn) {
+	io.Copy(ioutil.Discard, conn)
+
+	pc.lock.Lock()
+	defer pc.lock.Unlock()
+
+	if pc.conn == conn {
+		pc.conn.Close()
+		pc.conn = nil
+	}
+}
+
+// Remove closes the connection to a peer and forgets it.
+func (p *ConnPool) Remove(addr string) {
+	p.lock.Lock()
+	pc, ok := p.peers[addr]
+	delete(p.peers, addr)
+	p.lock.Unlock()
+
+	if !ok {
+		return
+	}
+
+	pc.lock.Lock()
+	defer pc.lock.Unlock()
+
+	if pc.conn != nil {
+		pc.conn.Close()
+		pc.conn = nil
+	}
+}
+
+// Close closes every connection of the pool.
+func (p *ConnPool) Close() {
+	p.lock.Lock()
+	addrs := make([]string, 0, len(p.peers))
+	for addr := range p.peers {
+		addrs = append(addrs, addr)
+	}
+	p.lock.Unlock()
+
+	for _, addr := range addrs {
+		p.Remove(addr)
+	}
+}
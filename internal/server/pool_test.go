@@ -0,0 +1,181 @@
+package server
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yanglinshu/glock/internal/errors"
+)
+
+// countingListener accepts connections on a loopback port, counting them and handing their
+// messages to a channel
+type countingListener struct {
+	net.Listener
+	accepted int32         // the number of connections accepted
+	conns    chan net.Conn // the accepted connections
+	messages chan []byte   // the messages read from every connection
+}
+
+// listen starts a counting listener, closed when the test ends
+func listen(t *testing.T) *countingListener {
+	t.Helper()
+
+	ln, err := net.Listen(protocol, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	l := &countingListener{Listener: ln, conns: make(chan net.Conn, 16), messages: make(chan []byte, 1024)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&l.accepted, 1)
+			l.conns <- conn
+
+			go func() {
+				defer conn.Close()
+
+				for {
+					message, err := readMessage(conn)
+					if err != nil {
+						return
+					}
+					l.messages <- message
+				}
+			}()
+		}
+	}()
+
+	return l
+}
+
+// receive waits for the next message read by the listener
+func (l *countingListener) receive(t *testing.T) []byte {
+	t.Helper()
+
+	select {
+	case message := <-l.messages:
+		return message
+	case <-time.After(waitTimeout):
+		t.Fatal("timed out waiting for a message")
+		return nil
+	}
+}
+
+func TestConnPoolReusesConnection(t *testing.T) {
+	l := listen(t)
+	p := NewConnPool(time.Second, nil)
+	defer p.Close()
+
+	for i := 0; i < 100; i++ {
+		err := p.Send(l.Addr().String(), append(commandToBytes("ping"), byte(i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 100; i++ {
+		if message := l.receive(t); message[commandLength] != byte(i) {
+			t.Fatalf("message %d arrived as message %d", message[commandLength], i)
+		}
+	}
+
+	if accepted := atomic.LoadInt32(&l.accepted); accepted != 1 {
+		t.Fatalf("100 messages took %d connections, want 1", accepted)
+	}
+
+	// Once the peer closes the connection, the next message dials again
+	(<-l.conns).Close()
+	pc := p.peer(l.Addr().String())
+	deadline := time.Now().Add(waitTimeout)
+	for {
+		pc.lock.Lock()
+		closed := pc.conn == nil
+		pc.lock.Unlock()
+
+		if closed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the pool kept a connection the peer closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	err := p.Send(l.Addr().String(), commandToBytes("ping"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.receive(t)
+
+	if accepted := atomic.LoadInt32(&l.accepted); accepted != 2 {
+		t.Fatalf("%d connections after the first was closed, want 2", accepted)
+	}
+}
+
+func TestConnPoolGreetsNewConnections(t *testing.T) {
+	l := listen(t)
+	p := NewConnPool(time.Second, func() ([]byte, error) {
+		return commandToBytes("version"), nil
+	})
+	defer p.Close()
+
+	for i := 0; i < 2; i++ {
+		err := p.Send(l.Addr().String(), commandToBytes("inv"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The greeting opens the connection, once
+	for _, want := range []string{"version", "inv", "inv"} {
+		if command := bytesToCommand(l.receive(t)[:commandLength]); command != want {
+			t.Fatalf("received %s, want %s", command, want)
+		}
+	}
+}
+
+func TestConnPoolBacksOff(t *testing.T) {
+	// A port nothing listens on
+	ln, err := net.Listen(protocol, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	p := NewConnPool(time.Second, nil)
+	defer p.Close()
+
+	err = p.Send(addr, commandToBytes("ping"))
+	if err == nil || errors.Is(err, errors.ErrPeerBackoff) {
+		t.Fatalf("sending to a closed port = %v, want a dial error", err)
+	}
+
+	err = p.Send(addr, commandToBytes("ping"))
+	if !errors.Is(err, errors.ErrPeerBackoff) {
+		t.Fatalf("sending again right after a failed dial = %v, want ErrPeerBackoff", err)
+	}
+
+	pc := p.peer(addr)
+	pc.lock.Lock()
+	failures, wait := pc.failures, time.Until(pc.retryAt)
+	pc.lock.Unlock()
+
+	if failures != 1 || wait <= 0 || wait > minBackoff {
+		t.Fatalf("after a failed dial: %d failures, retry in %v, want 1 and at most %v", failures, wait, minBackoff)
+	}
+
+	// A removed peer is dialed again at once
+	p.Remove(addr)
+	err = p.Send(addr, commandToBytes("ping"))
+	if err == nil || errors.Is(err, errors.ErrPeerBackoff) {
+		t.Fatalf("sending to a removed peer = %v, want a dial error", err)
+	}
+}
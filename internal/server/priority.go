@@ -0,0 +1,44 @@
+package server
+
+import (
+	"encoding/hex"
+	"sort"
+
+	"github.com/yanglinshu/glock/internal/blockchain"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// orderForMining sorts the transactions to mine by descending fee per byte, breaking ties by
+// descending coin-age priority
+func orderForMining(bc *blockchain.Blockchain, txs []*transaction.Transaction) error {
+	priorities, err := bc.Priorities(txs)
+	if err != nil {
+		return err
+	}
+
+	feeRates := make(map[string]float64)
+	for _, tx := range txs {
+		fee, err := bc.TransactionFee(tx)
+		if err != nil {
+			return err
+		}
+
+		sl, err := tx.Serialize()
+		if err != nil {
+			return err
+		}
+
+		feeRates[hex.EncodeToString(tx.ID)] = float64(fee) / float64(len(sl))
+	}
+
+	sort.SliceStable(txs, func(i, j int) bool {
+		idI, idJ := hex.EncodeToString(txs[i].ID), hex.EncodeToString(txs[j].ID)
+		if feeRates[idI] != feeRates[idJ] {
+			return feeRates[idI] > feeRates[idJ]
+		}
+
+		return priorities[idI] > priorities[idJ]
+	})
+
+	return nil
+}
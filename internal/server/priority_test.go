@@ -0,0 +1,69 @@
+package server
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/yanglinshu/glock/internal/blockchain"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+func TestTemplateOrdersFeelessTransactionsByPriority(t *testing.T) {
+	tn := newTestNetwork(t, 0)
+	a := tn.addNode(Config{})
+
+	young, err := transaction.NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pubKeyHash, err := transaction.HashPubKey(young.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The genesis reward of the network wallet is six blocks old when the young wallet is paid
+	_, err = a.generate(5, newAddress(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = a.generate(1, transaction.NewAddress(pubKeyHash, transaction.Mainnet))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	utxoSet := &blockchain.UTXOSet{Blockchain: a.bc}
+	recent, err := blockchain.NewUTXOTransaction(young, newAddress(t), 5, 0, nil, nil, utxoSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := tn.payment(a, 5, 0)
+
+	// Neither pays a fee, the recent one arrives first
+	for _, tx := range []*transaction.Transaction{recent, old} {
+		err = a.mempool.Add(*tx, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	txs, err := a.transactionsToMine()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template, err := a.bc.BuildBlockTemplate(txs, tn.address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(template.Transactions) != 3 {
+		t.Fatalf("template holds %d transactions, want the coinbase and both payments", len(template.Transactions))
+	}
+
+	if !bytes.Equal(template.Transactions[1].ID, old.ID) || !bytes.Equal(template.Transactions[2].ID, recent.ID) {
+		t.Fatal("the payment spending the older output does not come first")
+	}
+}
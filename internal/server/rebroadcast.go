@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/yanglinshu/glock/internal/events"
+)
+
+// DefaultMempoolTTL is how long a transaction may wait in the mempool unless configured otherwise
+const DefaultMempoolTTL = 72 * time.Hour
+
+// DefaultRebroadcastInterval is how often the mempool is pruned and the transactions of the wallet
+// left unconfirmed are announced again, unless configured otherwise
+const DefaultRebroadcastInterval = 10 * time.Minute
+
+// maintainMempool periodically expires the old transactions of the mempool and rebroadcasts the
+// unconfirmed transactions of the wallet, until the context is canceled
+func (n *Node) maintainMempool(ctx context.Context) {
+	ticker := time.NewTicker(n.config.RebroadcastInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n.expireMempool()
+			n.rebroadcast()
+		}
+	}
+}
+
+// expireMempool removes the transactions that waited in the mempool longer than the TTL
+func (n *Node) expireMempool() {
+	for _, ID := range n.mempool.Expire(n.config.MempoolTTL) {
+		n.logger.Info("Expired transaction from the mempool", "tx", ID, "ttl", n.config.MempoolTTL)
+	}
+}
+
+// rebroadcast puts the unconfirmed transactions of the wallet back into the mempool and announces
+// them to the peers, so a transaction missed by the network is eventually mined. The ones that can
+// no longer be mined are forgotten.
+func (n *Node) rebroadcast() {
+	txs, err := n.bc.UnconfirmedTransactions()
+	if err != nil {
+		n.logger.Error("Failed to read the unconfirmed transactions", "err", err)
+		return
+	}
+
+	for _, tx := range txs {
+		ok, err := n.bc.VerifyTransaction(tx)
+		if err == nil && ok {
+			var fee int
+			fee, err = n.bc.TransactionFee(tx)
+			if err == nil {
+				err = n.mempool.Add(*tx, fee)
+			}
+		}
+		if err != nil || !ok {
+			n.logger.Info("Dropped unconfirmed transaction, it can no longer be mined", "tx", tx.ID, "err", err)
+
+			err = n.bc.RemoveUnconfirmed(tx.ID)
+			if err != nil {
+				n.logger.Error("Failed to forget the unconfirmed transaction", "tx", tx.ID, "err", err)
+			}
+			continue
+		}
+
+		n.logger.Info("Rebroadcasting unconfirmed transaction", "tx", tx.ID)
+		n.eventBus.Publish(events.Event{Kind: events.TxAccepted, ID: tx.ID})
+		n.broadcastInv("tx", tx.ID, "")
+	}
+}
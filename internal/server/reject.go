@@ -0,0 +1,168 @@
+package server
+
+import (
+	"bytes"
+	"encoding/gob"
+	"net"
+	"time"
+
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/util"
+)
+
+// RejectCode tells why a message was refused
+type RejectCode int
+
+// The reasons a message may be refused
+const (
+	RejectMalformed        RejectCode = 0x01 // the message or the object it carries cannot be decoded
+	RejectInvalid          RejectCode = 0x10 // the object breaks a rule of the chain
+	RejectObsolete         RejectCode = 0x11 // the protocol version of the sender is not supported
+	RejectDuplicate        RejectCode = 0x12 // the object is known, or spends outputs already spent
+	RejectInvalidSignature RejectCode = 0x13 // an input of the transaction is not signed by the owner of its output
+	RejectInsufficientFee  RejectCode = 0x42 // the fee is too low for the mempool to take the transaction
+)
+
+// String returns the name of the code.
+func (c RejectCode) String() string {
+	switch c {
+	case RejectMalformed:
+		return "malformed"
+	case RejectObsolete:
+		return "obsolete"
+	case RejectDuplicate:
+		return "duplicate"
+	case RejectInvalidSignature:
+		return "invalid-signature"
+	case RejectInsufficientFee:
+		return "insufficient-fee"
+	default:
+		return "invalid"
+	}
+}
+
+// rejectCode returns the code of the reject sent for an object refused with the given error.
+func rejectCode(err error) RejectCode {
+	switch {
+	case errors.Is(err, errors.ErrMalformedTransaction), errors.Is(err, errors.ErrMalformedBlock), errors.Is(err, errors.ErrPayloadTooLarge):
+		return RejectMalformed
+	case errors.Is(err, errors.ErrInvalidSignature), errors.Is(err, errors.ErrInvalidPublicKey):
+		return RejectInvalidSignature
+	case errors.Is(err, errors.ErrMempoolFull):
+		return RejectInsufficientFee
+	case errors.Is(err, errors.ErrMempoolConflict), errors.Is(err, errors.ErrBlockExists):
+		return RejectDuplicate
+	default:
+		return RejectInvalid
+	}
+}
+
+// Reject tells a peer why a message of it was refused before the node drops it
+type Reject struct {
+	AddrFrom string     // the address of the node
+	Command  string     // the command refused: version, tx or block
+	Hash     []byte     // the ID of the transaction or the hash of the block refused, if known
+	Code     RejectCode // why the command was refused
+	Reason   string     // why the command was refused, for humans
+}
+
+// Err returns the reject as an ErrRejected error.
+func (r Reject) Err() error {
+	if len(r.Hash) > 0 {
+		return errors.Wrapf(errors.ErrRejected, "%s %x: %s (%s)", r.Command, r.Hash, r.Reason, r.Code)
+	}
+
+	return errors.Wrapf(errors.ErrRejected, "%s: %s (%s)", r.Command, r.Reason, r.Code)
+}
+
+// newReject returns the reject of an object refused with the given error.
+func newReject(command string, hash []byte, err error) Reject {
+	return Reject{Command: command, Hash: hash, Code: rejectCode(err), Reason: err.Error()}
+}
+
+// rejectRequest builds the reject command sent by the node at addrFrom
+func rejectRequest(addrFrom string, reject Reject) ([]byte, error) {
+	reject.AddrFrom = addrFrom
+	payload, err := util.GobEncode(reject)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(commandToBytes("reject"), payload...), nil
+}
+
+// sendReject tells the given address why a command of it was refused
+func (n *Node) sendReject(addr string, reject Reject) error {
+	request, err := rejectRequest(n.address, reject)
+	if err != nil {
+		return err
+	}
+
+	return n.sendData(addr, request)
+}
+
+// replyReject tells the sender of a message why it was refused: a peer at its address, and a
+// client, which gives none, over the connection the message came on.
+func (n *Node) replyReject(addrFrom string, conn net.Conn, reject Reject) error {
+	if addrFrom != "" {
+		return n.sendReject(addrFrom, reject)
+	}
+
+	request, err := rejectRequest(n.address, reject)
+	if err != nil {
+		return err
+	}
+
+	err = conn.SetWriteDeadline(time.Now().Add(n.config.WriteTimeout))
+	if err != nil {
+		return err
+	}
+
+	return writeMessage(conn, request)
+}
+
+// handleReject handles the reject command. A peer refusing the version of the node is forgotten.
+func (n *Node) handleReject(request []byte) error {
+	var buff bytes.Buffer
+	var payload Reject
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		return err
+	}
+
+	n.logger.Warn("Peer rejected command", "command", payload.Command, "hash", payload.Hash, "code", payload.Code.String(), "peer", payload.AddrFrom, "reason", payload.Reason)
+	if payload.Command == "version" {
+		n.knownNodes.RemovePeer(payload.AddrFrom)
+	}
+
+	return nil
+}
+
+// rejectWait is how long a client waits for a seed to reject a transaction it sent
+const rejectWait = time.Second
+
+// awaitReject waits rejectWait for a reject over the connection a message was sent on. It returns
+// nil if none came: the node took the message, or is too old to reject it.
+func awaitReject(conn net.Conn) *Reject {
+	err := conn.SetReadDeadline(time.Now().Add(rejectWait))
+	if err != nil {
+		return nil
+	}
+
+	reply, err := readMessage(conn)
+	if err != nil || len(reply) < commandLength || bytesToCommand(reply[:commandLength]) != "reject" {
+		return nil
+	}
+
+	var reject Reject
+	dec := gob.NewDecoder(bytes.NewReader(reply[commandLength:]))
+	err = dec.Decode(&reject)
+	if err != nil {
+		return nil
+	}
+
+	return &reject
+}
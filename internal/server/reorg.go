@@ -0,0 +1,112 @@
+package server
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/yanglinshu/glock/internal/block"
+	"github.com/yanglinshu/glock/internal/events"
+)
+
+// readmitDisconnected puts the transactions of blocks that left the main chain back into the
+// mempool once the UTXO set reflects the new main chain. oldTip is the tip before the switch.
+// Transactions spending outputs already spent on the new main chain are dropped.
+func (n *Node) readmitDisconnected(oldTip []byte) error {
+	if oldTip == nil || bytes.Equal(oldTip, n.bc.Tip()) {
+		return nil
+	}
+
+	disconnected, connected, err := n.bc.FindFork(oldTip)
+	if err != nil {
+		return err
+	}
+
+	if len(disconnected) == 0 {
+		return nil
+	}
+
+	n.logger.Warn("Chain reorganized", "disconnected", len(disconnected), "connected", len(connected))
+
+	confirmed, spent := connectedOutpoints(connected)
+
+	var readmitted [][]byte
+	for i := len(disconnected) - 1; i >= 0; i-- { // in chain order
+		for _, tx := range disconnected[i].Transactions {
+			txID := hex.EncodeToString(tx.ID)
+			if tx.IsCoinbase() || confirmed[txID] {
+				continue
+			}
+
+			conflicted := false
+			for _, in := range tx.Vin {
+				if spent[outpoint(in.Txid, in.Vout)] {
+					conflicted = true
+				}
+			}
+
+			if conflicted {
+				n.logger.Info("Dropped transaction, it conflicts with the main chain", "tx", tx.ID)
+				n.eventBus.Publish(events.Event{Kind: events.TxConflicted, ID: tx.ID})
+				continue
+			}
+
+			if ok, err := n.bc.VerifyTransaction(tx); err != nil || !ok {
+				n.logger.Info("Dropped transaction, it is no longer valid", "tx", tx.ID)
+				continue
+			}
+
+			fee, err := n.bc.TransactionFee(tx)
+			if err != nil {
+				n.logger.Info("Dropped transaction, it is no longer valid", "tx", tx.ID)
+				continue
+			}
+
+			err = n.mempool.Add(*tx, fee)
+			if err != nil {
+				n.logger.Info("Dropped transaction", "tx", tx.ID, "err", err)
+				continue
+			}
+			readmitted = append(readmitted, tx.ID)
+			n.eventBus.Publish(events.Event{Kind: events.TxUnconfirmed, ID: tx.ID})
+		}
+	}
+
+	// Relay the transactions waiting to be mined again
+	for _, id := range readmitted {
+		for _, node := range n.knownNodes.Peers() {
+			if node != n.address {
+				n.sendInv(node, "tx", [][]byte{id})
+			}
+		}
+	}
+
+	return nil
+}
+
+// connectedOutpoints returns the IDs of the transactions in the blocks and the outpoints they spend
+func connectedOutpoints(blocks []*block.Block) (map[string]bool, map[string]bool) {
+	confirmed := make(map[string]bool)
+	spent := make(map[string]bool)
+
+	for _, b := range blocks {
+		for _, tx := range b.Transactions {
+			confirmed[hex.EncodeToString(tx.ID)] = true
+
+			if tx.IsCoinbase() {
+				continue
+			}
+
+			for _, in := range tx.Vin {
+				spent[outpoint(in.Txid, in.Vout)] = true
+			}
+		}
+	}
+
+	return confirmed, spent
+}
+
+// outpoint formats a reference to a transaction output as a map key
+func outpoint(txID []byte, vout int) string {
+	return fmt.Sprintf("%x:%d", txID, vout)
+}
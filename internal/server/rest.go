@@ -0,0 +1,300 @@
+package server
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/yanglinshu/glock/internal/block"
+	"github.com/yanglinshu/glock/internal/blockchain"
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// The number of blocks listed by GET /blocks, by default and at most
+const (
+	defaultBlocksPerPage = 10
+	maxBlocksPerPage     = 100
+)
+
+// BlocksPage is a page of blocks listed by GET /blocks, from the newest
+type BlocksPage struct {
+	Blocks []BlockResult `json:"blocks"`         // the blocks of the page
+	Next   string        `json:"next,omitempty"` // the hash starting the next page, empty on the last one
+}
+
+// TransactionResult is a transaction returned by GET /tx/{id}
+type TransactionResult struct {
+	ID            string         `json:"id"`                  // the ID of the transaction in hex
+	BlockHash     string         `json:"blockhash,omitempty"` // the block holding it, empty if in the mempool
+	Confirmations int            `json:"confirmations"`       // the number of blocks on top of it, 0 if in the mempool
+	Inputs        []InputResult  `json:"inputs"`              // the outputs spent
+	Outputs       []OutputResult `json:"outputs"`             // the outputs created
+}
+
+// InputResult is an input of a transaction
+type InputResult struct {
+	TxID string `json:"txid"` // the transaction of the spent output in hex, empty for a coinbase
+	Vout int    `json:"vout"` // the index of the spent output
+}
+
+// OutputResult is an output of a transaction
+type OutputResult struct {
+	Value   int    `json:"value"`             // the coins held
+	Address string `json:"address,omitempty"` // the address the coins are locked to
+	Data    string `json:"data,omitempty"`    // the data carried in hex, for a data output
+}
+
+// UTXOResult is an unspent output returned by GET /address/{addr}/utxos
+type UTXOResult struct {
+	TxID  string `json:"txid"`  // the transaction of the output in hex
+	Vout  int    `json:"vout"`  // the index of the output
+	Value int    `json:"value"` // the coins held
+}
+
+// BalanceResult is the balance returned by GET /address/{addr}/balance
+type BalanceResult struct {
+	Address string `json:"address"` // the address
+	Balance int    `json:"balance"` // the coins the address can spend
+}
+
+// registerExplorer adds the read-only block explorer routes to a mux
+func (n *Node) registerExplorer(mux *http.ServeMux) {
+	mux.HandleFunc("/blocks", n.explorerHandler(n.serveBlocks))
+	mux.HandleFunc("/block/", n.explorerHandler(n.serveBlock))
+	mux.HandleFunc("/tx/", n.explorerHandler(n.serveTransaction))
+	mux.HandleFunc("/address/", n.explorerHandler(n.serveAddress))
+}
+
+// explorerHandler turns a function returning a JSON value into a GET handler. Errors from the
+// errors package are mapped to HTTP statuses.
+func (n *Node) explorerHandler(serve func(r *http.Request) (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "only GET is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		v, err := serve(r)
+		status := http.StatusOK
+		switch {
+		case err == nil:
+		case errors.Is(err, errors.ErrBlockNotFound) || errors.Is(err, errors.ErrTransactionNotFound) || errors.Is(err, errors.ErrUnknownRoute):
+			status = http.StatusNotFound
+		case errors.Is(err, errors.ErrInvalidAddress) || errors.Is(err, errors.ErrInvalidHash) || errors.Is(err, errors.ErrInvalidLimit):
+			status = http.StatusBadRequest
+		default:
+			status = http.StatusInternalServerError
+		}
+
+		if err != nil {
+			v = struct {
+				Error string `json:"error"`
+			}{err.Error()}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+
+		err = json.NewEncoder(w).Encode(v)
+		if err != nil {
+			n.logger.Warn("Failed to write explorer response", "path", r.URL.Path, "err", err)
+		}
+	}
+}
+
+// blockResult describes a block, with its confirmations on the main chain at the given best height
+func (n *Node) blockResult(bl *block.Block, bestHeight int) (BlockResult, error) {
+	result := BlockResult{
+		Hash:          hex.EncodeToString(bl.Hash),
+		PrevBlockHash: hex.EncodeToString(bl.PrevBlockHash),
+		Height:        bl.Height,
+		Timestamp:     bl.Timestamp,
+		Bits:          bl.TargetBits(),
+		Nonce:         bl.Nonce,
+		MerkleRoot:    hex.EncodeToString(bl.MerkleRoot),
+		Transactions:  []string{},
+	}
+	for _, tx := range bl.Transactions {
+		result.Transactions = append(result.Transactions, hex.EncodeToString(tx.ID))
+	}
+
+	// A block of a stale branch has no confirmations
+	mainBlock, err := n.bc.GetBlockByHeight(bl.Height)
+	if err != nil && !errors.Is(err, errors.ErrBlockNotFound) {
+		return BlockResult{}, err
+	}
+	if err == nil && hex.EncodeToString(mainBlock.Hash) == result.Hash {
+		result.Confirmations = bestHeight - bl.Height + 1
+	}
+
+	return result, nil
+}
+
+// getBlockByHexHash returns a stored block by its hash in hex
+func (n *Node) getBlockByHexHash(hexHash string) (*block.Block, error) {
+	hash, err := hex.DecodeString(hexHash)
+	if err != nil || len(hash) == 0 {
+		return nil, errors.ErrInvalidHash
+	}
+
+	ok, err := n.bc.HasBlock(hash)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.ErrBlockNotFound
+	}
+
+	return n.bc.GetBlock(hash)
+}
+
+// serveBlocks lists the blocks from the one given by the from parameter, the tip by default, down
+// to the genesis block, at most limit per page
+func (n *Node) serveBlocks(r *http.Request) (interface{}, error) {
+	limit := defaultBlocksPerPage
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxBlocksPerPage {
+			return nil, errors.ErrInvalidLimit
+		}
+	}
+
+	bestHeight, err := n.bc.GetBestHeight()
+	if err != nil {
+		return nil, err
+	}
+
+	hash := hex.EncodeToString(n.bc.Tip())
+	if from := r.URL.Query().Get("from"); from != "" {
+		hash = from
+	}
+
+	page := BlocksPage{Blocks: []BlockResult{}}
+	for len(page.Blocks) < limit && hash != "" {
+		bl, err := n.getBlockByHexHash(hash)
+		if err != nil {
+			return nil, err
+		}
+
+		result, err := n.blockResult(bl, bestHeight)
+		if err != nil {
+			return nil, err
+		}
+
+		page.Blocks = append(page.Blocks, result)
+		hash = result.PrevBlockHash
+	}
+	page.Next = hash
+
+	return page, nil
+}
+
+// serveBlock returns the block at /block/{hash}
+func (n *Node) serveBlock(r *http.Request) (interface{}, error) {
+	bl, err := n.getBlockByHexHash(strings.TrimPrefix(r.URL.Path, "/block/"))
+	if err != nil {
+		return nil, err
+	}
+
+	bestHeight, err := n.bc.GetBestHeight()
+	if err != nil {
+		return nil, err
+	}
+
+	return n.blockResult(bl, bestHeight)
+}
+
+// serveTransaction returns the transaction at /tx/{id}, from the mempool or the main chain
+func (n *Node) serveTransaction(r *http.Request) (interface{}, error) {
+	ID, err := hex.DecodeString(strings.TrimPrefix(r.URL.Path, "/tx/"))
+	if err != nil || len(ID) == 0 {
+		return nil, errors.ErrInvalidHash
+	}
+
+	return n.transactionResult(ID)
+}
+
+// transactionResult describes the transaction with the given ID, from the mempool or the main chain,
+// with the payload of its data output if it has one
+func (n *Node) transactionResult(ID []byte) (TransactionResult, error) {
+	tx, ok := n.mempool.Get(ID)
+	var bl *block.Block
+	if !ok {
+		var err error
+		tx, bl, err = n.bc.FindTransactionBlock(ID)
+		if err != nil {
+			return TransactionResult{}, err
+		}
+	}
+
+	result := TransactionResult{ID: hex.EncodeToString(tx.ID), Inputs: []InputResult{}, Outputs: []OutputResult{}}
+	if bl != nil {
+		bestHeight, err := n.bc.GetBestHeight()
+		if err != nil {
+			return TransactionResult{}, err
+		}
+
+		result.BlockHash = hex.EncodeToString(bl.Hash)
+		result.Confirmations = bestHeight - bl.Height + 1
+	}
+
+	for _, in := range tx.Vin {
+		result.Inputs = append(result.Inputs, InputResult{hex.EncodeToString(in.Txid), in.Vout})
+	}
+
+	for _, out := range tx.Vout {
+		output := OutputResult{Value: out.Value}
+		if out.IsData() {
+			output.Data = hex.EncodeToString(out.Data)
+		} else {
+			output.Address = transaction.PubKeyHashToAddress(out.PublicKeyHash, n.network)
+		}
+		result.Outputs = append(result.Outputs, output)
+	}
+
+	return result, nil
+}
+
+// serveAddress returns the unspent outputs at /address/{addr}/utxos or the balance at
+// /address/{addr}/balance
+func (n *Node) serveAddress(r *http.Request) (interface{}, error) {
+	address, resource, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/address/"), "/")
+	if !ok || (resource != "utxos" && resource != "balance") {
+		return nil, errors.ErrUnknownRoute
+	}
+
+	if !transaction.ValidateAddress(address, n.network) {
+		return nil, errors.ErrInvalidAddress
+	}
+
+	pubKeyHash, err := n.addressPubKeyHash(address)
+	if err != nil {
+		return nil, err
+	}
+
+	UTXOSet := blockchain.UTXOSet{Blockchain: n.bc}
+	if resource == "balance" {
+		balance, err := UTXOSet.GetBalance(pubKeyHash)
+		if err != nil {
+			return nil, err
+		}
+
+		return BalanceResult{address, balance}, nil
+	}
+
+	outPoints, err := UTXOSet.FindOutPoints(pubKeyHash)
+	if err != nil {
+		return nil, err
+	}
+
+	utxos := []UTXOResult{}
+	for _, op := range outPoints {
+		utxos = append(utxos, UTXOResult{hex.EncodeToString(op.Txid), op.Vout, op.Value})
+	}
+
+	return utxos, nil
+}
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/yanglinshu/glock/internal/blockchain"
+)
+
+// explorer serves the block explorer of a node over HTTP until the test ends
+func explorer(t *testing.T, n *Node) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	n.registerExplorer(mux)
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// getJSON fetches a path of the explorer, checks the status of the response and decodes its body
+// into v
+func getJSON(t *testing.T, server *httptest.Server, path string, status int, v interface{}) {
+	t.Helper()
+
+	resp, err := http.Get(server.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != status {
+		t.Fatalf("GET %s = %s, want %d", path, resp.Status, status)
+	}
+
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("GET %s has content type %q", path, ct)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(v)
+	if err != nil {
+		t.Fatalf("decoding GET %s: %v", path, err)
+	}
+}
+
+func TestExplorerPaginatesBlocks(t *testing.T) {
+	tn := newTestNetwork(t, 12)
+	a := tn.addNode(Config{})
+	server := explorer(t, a)
+
+	// Pages of five blocks from the tip down to the genesis block
+	var blocks []BlockResult
+	path := "/blocks?limit=5"
+	for pages := 1; ; pages++ {
+		var page BlocksPage
+		getJSON(t, server, path, http.StatusOK, &page)
+		blocks = append(blocks, page.Blocks...)
+
+		if page.Next == "" {
+			if pages != 3 {
+				t.Fatalf("13 blocks took %d pages of 5", pages)
+			}
+			break
+		}
+		path = "/blocks?limit=5&from=" + page.Next
+	}
+
+	if len(blocks) != 13 || blocks[0].Hash != hex.EncodeToString(a.bc.Tip()) {
+		t.Fatalf("listed %d blocks from %s, want 13 from the tip", len(blocks), blocks[0].Hash)
+	}
+
+	for i, bl := range blocks {
+		if bl.Height != 12-i || bl.Confirmations != i+1 {
+			t.Fatalf("block %d listed at height %d with %d confirmations", i, bl.Height, bl.Confirmations)
+		}
+
+		if i > 0 && blocks[i-1].PrevBlockHash != bl.Hash {
+			t.Fatalf("block %d is not the parent of the block before it", i)
+		}
+	}
+
+	// Ten blocks by default
+	var page BlocksPage
+	getJSON(t, server, "/blocks", http.StatusOK, &page)
+	if len(page.Blocks) != defaultBlocksPerPage || page.Next != blocks[defaultBlocksPerPage].Hash {
+		t.Fatalf("the default page holds %d blocks, next %s", len(page.Blocks), page.Next)
+	}
+
+	var failure struct {
+		Error string `json:"error"`
+	}
+	for path, status := range map[string]int{
+		"/blocks?limit=0":                          http.StatusBadRequest,
+		"/blocks?limit=101":                        http.StatusBadRequest,
+		"/blocks?limit=x":                          http.StatusBadRequest,
+		"/blocks?from=zz":                          http.StatusBadRequest,
+		"/blocks?from=" + strings.Repeat("00", 32): http.StatusNotFound,
+		"/block/" + strings.Repeat("00", 32):       http.StatusNotFound,
+		"/block/":                                  http.StatusBadRequest,
+	} {
+		getJSON(t, server, path, status, &failure)
+		if failure.Error == "" {
+			t.Fatalf("GET %s failed without a reason", path)
+		}
+	}
+}
+
+func TestExplorerBlockAndTransaction(t *testing.T) {
+	tn := newTestNetwork(t, 3)
+	a := tn.addNode(Config{})
+	server := explorer(t, a)
+
+	bl, err := a.bc.GetBlockByHeight(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result BlockResult
+	getJSON(t, server, "/block/"+hex.EncodeToString(bl.Hash), http.StatusOK, &result)
+	if result.Height != 1 || result.Confirmations != 3 || result.Transactions[0] != hex.EncodeToString(bl.Transactions[0].ID) {
+		t.Fatalf("GET /block of block 1 = %+v", result)
+	}
+
+	// A mined coinbase and a payment waiting in the mempool
+	var coinbase TransactionResult
+	getJSON(t, server, "/tx/"+result.Transactions[0], http.StatusOK, &coinbase)
+	if coinbase.BlockHash != result.Hash || coinbase.Confirmations != 3 || coinbase.Outputs[0].Address != tn.address.String() {
+		t.Fatalf("GET /tx of the coinbase of block 1 = %+v", coinbase)
+	}
+
+	tx := tn.payment(a, 5, 1)
+	err = a.mempool.Add(*tx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pending TransactionResult
+	getJSON(t, server, "/tx/"+hex.EncodeToString(tx.ID), http.StatusOK, &pending)
+	if pending.BlockHash != "" || pending.Confirmations != 0 || len(pending.Inputs) != len(tx.Vin) || pending.Outputs[0].Value != 5 {
+		t.Fatalf("GET /tx of a mempool transaction = %+v", pending)
+	}
+
+	var failure struct {
+		Error string `json:"error"`
+	}
+	getJSON(t, server, "/tx/"+strings.Repeat("00", 32), http.StatusNotFound, &failure)
+	getJSON(t, server, "/tx/zz", http.StatusBadRequest, &failure)
+
+	// The explorer is read-only
+	resp, err := http.Post(server.URL+"/blocks", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("POST /blocks = %s, want %d", resp.Status, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestExplorerAddress(t *testing.T) {
+	tn := newTestNetwork(t, 2)
+	a := tn.addNode(Config{})
+	server := explorer(t, a)
+
+	utxoSet := blockchain.UTXOSet{Blockchain: a.bc}
+	outPoints, err := utxoSet.FindOutPoints(tn.address.PubKeyHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var utxos []UTXOResult
+	getJSON(t, server, "/address/"+tn.address.String()+"/utxos", http.StatusOK, &utxos)
+	if len(utxos) != len(outPoints) || len(utxos) != 3 {
+		t.Fatalf("GET /utxos listed %d outputs, want the 3 coinbases", len(utxos))
+	}
+
+	total := 0
+	for i, utxo := range utxos {
+		if utxo.TxID != hex.EncodeToString(outPoints[i].Txid) || utxo.Vout != outPoints[i].Vout || utxo.Value != outPoints[i].Value {
+			t.Fatalf("GET /utxos listed %+v, want %+v", utxo, outPoints[i])
+		}
+		total += utxo.Value
+	}
+
+	var balance BalanceResult
+	getJSON(t, server, "/address/"+tn.address.String()+"/balance", http.StatusOK, &balance)
+	if balance.Address != tn.address.String() || balance.Balance != total {
+		t.Fatalf("GET /balance = %+v, want %d", balance, total)
+	}
+
+	// An address never paid has an empty list, not null
+	var empty []UTXOResult
+	getJSON(t, server, "/address/"+newAddress(t).String()+"/utxos", http.StatusOK, &empty)
+	if empty == nil || len(empty) != 0 {
+		t.Fatalf("GET /utxos of an address never paid = %v, want an empty list", empty)
+	}
+
+	var failure struct {
+		Error string `json:"error"`
+	}
+	getJSON(t, server, "/address/nope/balance", http.StatusBadRequest, &failure)
+	getJSON(t, server, "/address/"+tn.address.String()+"/history", http.StatusNotFound, &failure)
+	getJSON(t, server, "/address/"+tn.address.String(), http.StatusNotFound, &failure)
+}
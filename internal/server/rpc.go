@@ -0,0 +1,1159 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/yanglinshu/glock/internal/block"
+	"github.com/yanglinshu/glock/internal/blockchain"
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/events"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// The error codes of the JSON-RPC responses, the negative ones from -32700 to -32600 are defined
+// by the JSON-RPC 2.0 specification
+const (
+	RPCParseError     = -32700 // the request is not valid JSON
+	RPCInvalidRequest = -32600 // the request is not a valid JSON-RPC request
+	RPCMethodNotFound = -32601 // the method does not exist
+	RPCInvalidParams  = -32602 // the parameters of the method are invalid
+	RPCInternalError  = -32603 // the node failed to handle the request
+	RPCNotFound       = -5     // the requested block or transaction does not exist
+	RPCWalletError    = -4     // the wallet of the node cannot make the payment
+	RPCRejected       = -26    // the transaction or block is invalid or conflicts with the mempool
+	RPCStaleWork      = -28    // the block was mined from a template the tip has moved past
+	RPCTokenRequired  = -32000 // the method is only served by a node with a token configured
+)
+
+// maxRPCRequestSize is the largest JSON-RPC request body accepted
+const maxRPCRequestSize = 1 << 20
+
+// RPCRequest is a JSON-RPC request
+type RPCRequest struct {
+	JSONRPC string          `json:"jsonrpc"` // the protocol version, "2.0"
+	ID      json.RawMessage `json:"id"`      // the ID echoed in the response
+	Method  string          `json:"method"`  // the name of the method
+	Params  json.RawMessage `json:"params"`  // the parameters of the method, an object
+}
+
+// RPCResponse is a JSON-RPC response, carrying either a result or an error
+type RPCResponse struct {
+	JSONRPC string          `json:"jsonrpc"`          // the protocol version, "2.0"
+	ID      json.RawMessage `json:"id"`               // the ID of the request
+	Result  interface{}     `json:"result,omitempty"` // the result of the method
+	Error   *RPCError       `json:"error,omitempty"`  // the reason the method failed
+}
+
+// RPCError describes why a JSON-RPC request failed
+type RPCError struct {
+	Code    int    `json:"code"`    // one of the RPC error codes
+	Message string `json:"message"` // a description of the error
+}
+
+// Error returns the message of the error.
+func (e *RPCError) Error() string {
+	return e.Message
+}
+
+// GetBlockParams are the parameters of getblock, which looks a block up by hash or by height
+type GetBlockParams struct {
+	Hash   string `json:"hash"`   // the hash of the block in hex, if not looked up by height
+	Height *int   `json:"height"` // the height of the block on the main chain
+}
+
+// BlockResult is the result of getblock
+type BlockResult struct {
+	Hash          string   `json:"hash"`          // the hash of the block in hex
+	PrevBlockHash string   `json:"prevblockhash"` // the hash of the parent in hex
+	Height        int      `json:"height"`        // the height of the block
+	Timestamp     int64    `json:"timestamp"`     // the time the block was created
+	Bits          int      `json:"bits"`          // the difficulty of the block
+	Nonce         int      `json:"nonce"`         // the nonce of the proof-of-work
+	MerkleRoot    string   `json:"merkleroot"`    // the Merkle root of the transactions in hex
+	Transactions  []string `json:"transactions"`  // the IDs of the transactions in hex
+	Confirmations int      `json:"confirmations"` // the number of main chain blocks from it to the tip, 0 if stale
+}
+
+// GetBalanceParams are the parameters of getbalance
+type GetBalanceParams struct {
+	Address string `json:"address"` // the address to get the balance of
+}
+
+// ListUnspentParams are the parameters of listunspent
+type ListUnspentParams struct {
+	Address  string `json:"address"`  // the address to list the unspent outputs of
+	MinValue int    `json:"minvalue"` // the smallest value of the outputs listed
+}
+
+// UnspentResult is an entry of the result of listunspent
+type UnspentResult struct {
+	TxID          string `json:"txid"`          // the ID of the transaction holding the output in hex
+	Vout          int    `json:"vout"`          // the index of the output in the transaction
+	Value         int    `json:"value"`         // the value of the output
+	Confirmations int    `json:"confirmations"` // the number of blocks from the one holding it to the tip
+}
+
+// WalletBalanceParams are the optional parameters of getwalletbalance
+type WalletBalanceParams struct {
+	MinConf *int `json:"minconf"` // the confirmations an output needs to count as confirmed, 1 if absent
+}
+
+// AddressBalanceResult is the balance of an address in the result of getwalletbalance
+type AddressBalanceResult struct {
+	Address   string `json:"address"`   // the address
+	Confirmed int    `json:"confirmed"` // the value of the outputs with enough confirmations
+	Pending   int    `json:"pending"`   // the value of the younger outputs
+}
+
+// WalletBalanceResult is the result of getwalletbalance
+type WalletBalanceResult struct {
+	Addresses []AddressBalanceResult `json:"addresses"` // the balance of every address, sorted by address
+	Confirmed int                    `json:"confirmed"` // the total confirmed balance
+	Pending   int                    `json:"pending"`   // the total pending balance
+}
+
+// BlockTemplateParams are the optional parameters of getblocktemplate
+type BlockTemplateParams struct {
+	Address string `json:"address"` // the address paid by the coinbase, the mining address of the node if empty
+}
+
+// BlockTemplateResult is the result of getblocktemplate, an unmined block for an external miner
+type BlockTemplateResult struct {
+	TemplateID    string `json:"templateid"`    // the ID of the template, to echo in submitblock
+	Hex           string `json:"hex"`           // the serialized block in hex, to be mined and passed to submitblock
+	PrevBlockHash string `json:"prevblockhash"` // the hash of the tip the block builds on in hex
+	Height        int    `json:"height"`        // the height of the block
+	Timestamp     int64  `json:"timestamp"`     // the time of the block
+	Bits          int    `json:"bits"`          // the target of the block in compact form
+	Target        string `json:"target"`        // the upper bound of the hash of the block in hex
+	MerkleRoot    string `json:"merkleroot"`    // the Merkle root of the transactions in hex
+	Version       int    `json:"version"`       // the version of the block
+	Transactions  int    `json:"transactions"`  // the number of transactions, the coinbase included
+}
+
+// SubmitBlockParams are the parameters of submitblock
+type SubmitBlockParams struct {
+	TemplateID string `json:"templateid"` // the ID of the template the block was mined from
+	Hex        string `json:"hex"`        // the serialized block in hex, mined from the template
+}
+
+// RescanParams are the optional parameters of rescanblockchain
+type RescanParams struct {
+	StartHeight *int `json:"start_height"` // the height to rescan from, resuming the last rescan if absent
+}
+
+// RescanResult is the result of rescanblockchain
+type RescanResult struct {
+	Scanned int                 `json:"scanned"` // the number of blocks scanned
+	Balance WalletBalanceResult `json:"balance"` // the balances of the wallet after the rescan
+}
+
+// HistoryResult is an entry of the result of gethistory, which takes GetBalanceParams
+type HistoryResult struct {
+	TxID           string   `json:"txid"`           // the ID of the transaction in hex
+	Kind           string   `json:"kind"`           // "received", "sent" or "mined"
+	Amount         int      `json:"amount"`         // the value received, or spent net of the change
+	Counterparties []string `json:"counterparties"` // the addresses paid if sent, paying if received
+	Height         int      `json:"height"`         // the height of the block holding the transaction
+	Timestamp      int64    `json:"timestamp"`      // the time that block was created
+}
+
+// SendToAddressParams are the parameters of sendtoaddress, which pays from a wallet of the node
+type SendToAddressParams struct {
+	From   string `json:"from"`   // the address of the wallet paying
+	To     string `json:"to"`     // the address paid
+	Amount int    `json:"amount"` // the amount paid
+	Fee    int    `json:"fee"`    // the fee paid to the miner on top of the amount
+}
+
+// CreateRawTransactionParams are the parameters of createrawtransaction, which builds an unsigned
+// payment. The public key of the payer is taken from the wallets of the node if PubKey is empty, or
+// else from a transaction of the chain spending coins of the payer.
+type CreateRawTransactionParams struct {
+	From   string `json:"from"`   // the address paying
+	To     string `json:"to"`     // the address paid
+	Amount int    `json:"amount"` // the amount paid
+	Fee    int    `json:"fee"`    // the fee paid to the miner on top of the amount
+	PubKey string `json:"pubkey"` // the public key of the payer in hex, optional
+}
+
+// RawTransactionParams are the parameters of signrawtransaction and sendrawtransaction
+type RawTransactionParams struct {
+	Hex string `json:"hex"` // the raw transaction
+}
+
+// GetRawTransactionParams are the parameters of getrawtransaction and gettransaction
+type GetRawTransactionParams struct {
+	TxID string `json:"txid"` // the ID of the transaction in hex
+}
+
+// GetMerkleProofParams are the parameters of getmerkleproof
+type GetMerkleProofParams struct {
+	TxID string `json:"txid"` // the ID of the transaction in hex
+}
+
+// MerkleProofResult is the result of getmerkleproof
+type MerkleProofResult struct {
+	BlockHash  string   `json:"blockhash"`  // the block holding the transaction in hex
+	Height     int      `json:"height"`     // the height of that block
+	MerkleRoot string   `json:"merkleroot"` // the Merkle root of that block in hex
+	Index      int      `json:"index"`      // the position of the transaction in the block
+	Proof      []string `json:"proof"`      // the sibling hashes in hex, from the leaf up
+}
+
+// GetMempoolParams are the optional parameters of getmempool, which returns the IDs of the
+// transactions of the mempool without them
+type GetMempoolParams struct {
+	Verbose bool   `json:"verbose"` // whether to describe every transaction instead of listing their IDs
+	TxID    string `json:"txid"`    // the ID in hex of the transaction to return, with its raw encoding
+}
+
+// MempoolEntryResult describes a transaction of the mempool in the result of getmempool
+type MempoolEntryResult struct {
+	TxID string `json:"txid"`          // the ID of the transaction in hex
+	Size int    `json:"size"`          // the size of the serialized transaction in bytes
+	Fee  int    `json:"fee"`           // the fee paid by the transaction
+	Time int64  `json:"time"`          // the time the transaction entered the mempool
+	Hex  string `json:"hex,omitempty"` // the raw transaction, if asked for by ID
+}
+
+// PeerResult is an entry of the result of getpeers
+type PeerResult struct {
+	Address  string `json:"address"`  // the address of the peer
+	LastSeen int64  `json:"lastseen"` // the time a message of the peer was last received, 0 if never
+	RTT      int64  `json:"rtt"`      // the round-trip time of the last ping in microseconds, 0 if none
+}
+
+// UTXOStatsResult is the result of gettxoutsetinfo
+type UTXOStatsResult struct {
+	BestBlock      string `json:"bestblock"`      // the last block applied to the UTXO set in hex
+	Transactions   int    `json:"transactions"`   // the number of transactions with unspent outputs
+	Outputs        int    `json:"outputs"`        // the number of unspent outputs
+	TotalValue     int    `json:"totalvalue"`     // the total value of the unspent outputs
+	SerializedSize int    `json:"serializedsize"` // the size of the UTXO set in the database in bytes
+	Hash           string `json:"hash"`           // the digest of the unspent outputs in hex
+}
+
+// rpcMethod handles the parameters of a JSON-RPC method and returns its result
+type rpcMethod func(n *Node, params json.RawMessage) (interface{}, error)
+
+// rpcMethods are the methods of the JSON-RPC server by name
+var rpcMethods = map[string]rpcMethod{
+	"getbestheight":        rpcGetBestHeight,
+	"getblock":             rpcGetBlock,
+	"getbalance":           rpcGetBalance,
+	"gethistory":           rpcGetHistory,
+	"listunspent":          rpcListUnspent,
+	"getwalletbalance":     rpcGetWalletBalance,
+	"sendtoaddress":        rpcSendToAddress,
+	"getrawtransaction":    rpcGetRawTransaction,
+	"gettransaction":       rpcGetTransaction,
+	"createrawtransaction": rpcCreateRawTransaction,
+	"signrawtransaction":   rpcSignRawTransaction,
+	"sendrawtransaction":   rpcSendRawTransaction,
+	"getmempool":           rpcGetMempool,
+	"getpeers":             rpcGetPeers,
+	"getmerkleproof":       rpcGetMerkleProof,
+	"gettxoutsetinfo":      rpcGetTxOutSetInfo,
+	"rescanblockchain":     rpcRescanBlockchain,
+	"getblocktemplate":     rpcGetBlockTemplate,
+	"submitblock":          rpcSubmitBlock,
+	"generate":             rpcGenerate,
+}
+
+// rpcTokenMethods are the methods mining blocks or spending the coins of the wallet of the node.
+// Any local process can reach the RPC server, so they are refused unless requests must carry a
+// token.
+var rpcTokenMethods = map[string]bool{
+	"sendtoaddress":      true,
+	"signrawtransaction": true,
+	"generate":           true,
+}
+
+// startRPCServer serves the JSON-RPC methods, the database backups and the read-only block explorer
+// on the configured address until the context is canceled. If a token is configured, JSON-RPC and
+// backup requests must carry it as a bearer token, and without one the methods mining or spending
+// are refused. The returned listener stops the server once closed.
+func (n *Node) startRPCServer(ctx context.Context) (net.Listener, error) {
+	ln, err := net.Listen("tcp", localAddress(n.config.RPCAddr))
+	if err != nil {
+		return nil, err
+	}
+	n.logger.Info("RPC server listening", "addr", ln.Addr())
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", n.serveRPC)
+	mux.HandleFunc("/backup", n.serveBackup)
+	n.registerExplorer(mux)
+
+	server := &http.Server{Handler: mux, ReadTimeout: n.config.ReadTimeout}
+	go func() {
+		err := server.Serve(ln)
+		if err != nil && ctx.Err() == nil {
+			n.logger.Error("RPC server stopped", "err", err)
+		}
+	}()
+
+	return ln, nil
+}
+
+// serveRPC handles a JSON-RPC request over HTTP
+func (n *Node) serveRPC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !n.authorized(r) {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	var request RPCRequest
+	response := RPCResponse{JSONRPC: "2.0"}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRPCRequestSize))
+	err := dec.Decode(&request)
+	if err != nil {
+		response.Error = &RPCError{RPCParseError, err.Error()}
+		n.writeRPCResponse(w, response)
+		return
+	}
+	response.ID = request.ID
+
+	method, ok := rpcMethods[request.Method]
+	if request.JSONRPC != "2.0" || request.Method == "" {
+		response.Error = &RPCError{RPCInvalidRequest, "invalid JSON-RPC request"}
+	} else if !ok {
+		response.Error = &RPCError{RPCMethodNotFound, "unknown method " + request.Method}
+	} else if rpcTokenMethods[request.Method] && n.config.RPCToken == "" {
+		response.Error = &RPCError{RPCTokenRequired, request.Method + " is only served by a node started with an RPC token"}
+	} else {
+		result, err := method(n, request.Params)
+		if rpcErr, ok := err.(*RPCError); ok {
+			response.Error = rpcErr
+		} else if err != nil {
+			response.Error = &RPCError{RPCInternalError, err.Error()}
+		} else {
+			response.Result = result
+		}
+	}
+
+	n.writeRPCResponse(w, response)
+}
+
+// authorized checks that a request carries the configured token as a bearer token, if any
+func (n *Node) authorized(r *http.Request) bool {
+	if n.config.RPCToken == "" {
+		return true
+	}
+
+	expected := []byte("Bearer " + n.config.RPCToken)
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) == 1
+}
+
+// writeRPCResponse writes a JSON-RPC response
+func (n *Node) writeRPCResponse(w http.ResponseWriter, response RPCResponse) {
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		n.logger.Warn("Failed to write RPC response", "err", err)
+	}
+}
+
+// decodeParams decodes the parameters of a method, which are required
+func decodeParams(params json.RawMessage, v interface{}) error {
+	if len(params) == 0 {
+		return &RPCError{RPCInvalidParams, "missing parameters"}
+	}
+
+	err := json.Unmarshal(params, v)
+	if err != nil {
+		return &RPCError{RPCInvalidParams, err.Error()}
+	}
+
+	return nil
+}
+
+// callRPC calls a JSON-RPC method of the node serving RPC on the local port and decodes its result
+// into result. token is the bearer token of the server, if any. It returns ErrNodeNotRunning if the
+// server is not reachable, and the *RPCError of a method that failed.
+func callRPC(port int, token, method string, params, result interface{}) error {
+	encodedParams, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(RPCRequest{JSONRPC: "2.0", ID: json.RawMessage("1"), Method: method, Params: encodedParams})
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, "http://"+localAddress(strconv.Itoa(port))+"/", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return errors.ErrNodeNotRunning
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return errors.NewError(fmt.Sprintf("%s failed: %s", method, response.Status))
+	}
+
+	var reply struct {
+		Result json.RawMessage `json:"result"` // the result of the method
+		Error  *RPCError       `json:"error"`  // the reason the method failed
+	}
+	err = json.NewDecoder(response.Body).Decode(&reply)
+	if err != nil {
+		return err
+	}
+
+	if reply.Error != nil {
+		return reply.Error
+	}
+
+	return json.Unmarshal(reply.Result, result)
+}
+
+// parseAddress parses an address of the network of the node given as a parameter
+func (n *Node) parseAddress(address string) (transaction.Address, error) {
+	parsed, err := transaction.ParseAddress(address, n.network)
+	if err != nil {
+		return transaction.Address{}, &RPCError{RPCInvalidParams, err.Error()}
+	}
+
+	return parsed, nil
+}
+
+// addressPubKeyHash returns the public key hash of an address given as a parameter
+func (n *Node) addressPubKeyHash(address string) ([]byte, error) {
+	parsed, err := n.parseAddress(address)
+	if err != nil {
+		return nil, err
+	}
+
+	return parsed.PubKeyHash(), nil
+}
+
+// rpcGetBestHeight returns the height of the tip
+func rpcGetBestHeight(n *Node, params json.RawMessage) (interface{}, error) {
+	return n.bc.GetBestHeight()
+}
+
+// rpcGetBlock returns a block by hash or by height
+func rpcGetBlock(n *Node, params json.RawMessage) (interface{}, error) {
+	var p GetBlockParams
+	err := decodeParams(params, &p)
+	if err != nil {
+		return nil, err
+	}
+
+	var bl *block.Block
+	if p.Height != nil {
+		bl, err = n.bc.GetBlockByHeight(*p.Height)
+		if errors.Is(err, errors.ErrBlockNotFound) {
+			return nil, &RPCError{RPCNotFound, err.Error()}
+		}
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		bl, err = n.getBlockByHexHash(p.Hash)
+		if errors.Is(err, errors.ErrInvalidHash) {
+			return nil, &RPCError{RPCInvalidParams, err.Error()}
+		}
+		if errors.Is(err, errors.ErrBlockNotFound) {
+			return nil, &RPCError{RPCNotFound, err.Error()}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	bestHeight, err := n.bc.GetBestHeight()
+	if err != nil {
+		return nil, err
+	}
+
+	return n.blockResult(bl, bestHeight)
+}
+
+// rpcGetBalance returns the balance of an address
+func rpcGetBalance(n *Node, params json.RawMessage) (interface{}, error) {
+	var p GetBalanceParams
+	err := decodeParams(params, &p)
+	if err != nil {
+		return nil, err
+	}
+
+	pubKeyHash, err := n.addressPubKeyHash(p.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	UTXOSet := blockchain.UTXOSet{Blockchain: n.bc}
+	return UTXOSet.GetBalance(pubKeyHash)
+}
+
+// rpcGetHistory returns the transactions of the main chain paying or spending coins of an address,
+// the latest first
+func rpcGetHistory(n *Node, params json.RawMessage) (interface{}, error) {
+	var p GetBalanceParams
+	err := decodeParams(params, &p)
+	if err != nil {
+		return nil, err
+	}
+
+	pubKeyHash, err := n.addressPubKeyHash(p.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := n.bc.FindTransactionsForAddress(pubKeyHash)
+	if err != nil {
+		return nil, err
+	}
+
+	history := []HistoryResult{}
+	for _, r := range records {
+		counterparties := r.Counterparties
+		if counterparties == nil {
+			counterparties = []string{}
+		}
+
+		history = append(history, HistoryResult{
+			TxID:           hex.EncodeToString(r.TxID),
+			Kind:           r.Kind,
+			Amount:         r.Amount,
+			Counterparties: counterparties,
+			Height:         r.Height,
+			Timestamp:      r.Timestamp,
+		})
+	}
+
+	return history, nil
+}
+
+// rpcListUnspent returns the unspent outputs of an address worth at least the minimum value
+func rpcListUnspent(n *Node, params json.RawMessage) (interface{}, error) {
+	var p ListUnspentParams
+	err := decodeParams(params, &p)
+	if err != nil {
+		return nil, err
+	}
+
+	pubKeyHash, err := n.addressPubKeyHash(p.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	UTXOSet := blockchain.UTXOSet{Blockchain: n.bc}
+	unspent, err := UTXOSet.FindUTXOWithOutpoints(pubKeyHash)
+	if err != nil {
+		return nil, err
+	}
+
+	return UnspentResults(unspent, p.MinValue), nil
+}
+
+// UnspentResults converts the unspent outputs worth at least minValue to entries of the result of
+// listunspent.
+func UnspentResults(unspent []blockchain.UnspentOutput, minValue int) []UnspentResult {
+	results := []UnspentResult{}
+	for _, utxo := range unspent {
+		if utxo.Value < minValue {
+			continue
+		}
+
+		results = append(results, UnspentResult{
+			TxID:          hex.EncodeToString(utxo.Txid),
+			Vout:          utxo.Vout,
+			Value:         utxo.Value,
+			Confirmations: utxo.Confirmations,
+		})
+	}
+
+	return results
+}
+
+// rpcGetWalletBalance returns the balance of every address of the wallets of the node and their
+// total
+func rpcGetWalletBalance(n *Node, params json.RawMessage) (interface{}, error) {
+	var p WalletBalanceParams
+	if len(params) > 0 {
+		err := decodeParams(params, &p)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	minConf := 1
+	if p.MinConf != nil {
+		minConf = *p.MinConf
+	}
+	if minConf < 0 {
+		return nil, &RPCError{RPCInvalidParams, "minconf must not be negative"}
+	}
+
+	wallets, err := transaction.NewWallets(n.config.NodeID, n.network)
+	if err != nil {
+		return nil, err
+	}
+
+	UTXOSet := blockchain.UTXOSet{Blockchain: n.bc}
+	balances, err := UTXOSet.GetWalletBalances(wallets, minConf)
+	if err != nil {
+		return nil, err
+	}
+
+	return WalletBalance(balances), nil
+}
+
+// WalletBalance converts the balances of the addresses of a wallet to the result of
+// getwalletbalance, adding up their total.
+func WalletBalance(balances []blockchain.AddressBalance) WalletBalanceResult {
+	result := WalletBalanceResult{Addresses: []AddressBalanceResult{}}
+	for _, b := range balances {
+		result.Addresses = append(result.Addresses, AddressBalanceResult{b.Address, b.Confirmed, b.Pending})
+		result.Confirmed += b.Confirmed
+		result.Pending += b.Pending
+	}
+
+	return result
+}
+
+// rpcSendToAddress pays an address from a wallet of the node, putting the transaction in the
+// mempool and announcing it to the peers. It returns the ID of the transaction.
+func rpcSendToAddress(n *Node, params json.RawMessage) (interface{}, error) {
+	var p SendToAddressParams
+	err := decodeParams(params, &p)
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := transaction.ParseAddress(p.To, n.network)
+	if !transaction.ValidateAddress(p.From, n.network) || err != nil {
+		return nil, &RPCError{RPCInvalidParams, errors.ErrInvalidAddress.Error()}
+	}
+
+	if p.Amount <= 0 || p.Fee < 0 {
+		return nil, &RPCError{RPCInvalidParams, errors.ErrInvalidAmount.Error()}
+	}
+
+	wallets, err := transaction.NewWallets(n.config.NodeID, n.network)
+	if err != nil {
+		return nil, &RPCError{RPCWalletError, err.Error()}
+	}
+
+	wallet, err := wallets.GetWallet(p.From)
+	if err != nil {
+		return nil, &RPCError{RPCWalletError, err.Error()}
+	}
+
+	UTXOSet := blockchain.UTXOSet{Blockchain: n.bc}
+	tx, err := blockchain.NewUTXOTransaction(wallet, to, p.Amount, p.Fee, nil, nil, &UTXOSet)
+	if errors.Is(err, errors.ErrNotEnoughFunds) {
+		return nil, &RPCError{RPCWalletError, err.Error()}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = n.submitTransaction(tx, p.Fee)
+	if err != nil {
+		return nil, &RPCError{RPCWalletError, err.Error()}
+	}
+
+	return hex.EncodeToString(tx.ID), nil
+}
+
+// submitTransaction puts a transaction created on this node in the mempool and announces it to the
+// peers, which fetch it from the mempool. It is recorded as unconfirmed, so it is announced again
+// until it is mined.
+func (n *Node) submitTransaction(tx *transaction.Transaction, fee int) error {
+	err := n.mempool.Add(*tx, fee)
+	if err != nil {
+		return err
+	}
+
+	err = n.bc.AddUnconfirmed(tx)
+	if err != nil {
+		return err
+	}
+
+	n.eventBus.Publish(events.Event{Kind: events.TxAccepted, ID: tx.ID})
+	n.broadcastInv("tx", tx.ID, "")
+
+	return nil
+}
+
+// rpcCreateRawTransaction returns an unsigned payment as a raw transaction
+func rpcCreateRawTransaction(n *Node, params json.RawMessage) (interface{}, error) {
+	var p CreateRawTransactionParams
+	err := decodeParams(params, &p)
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := transaction.ParseAddress(p.To, n.network)
+	if !transaction.ValidateAddress(p.From, n.network) || err != nil {
+		return nil, &RPCError{RPCInvalidParams, errors.ErrInvalidAddress.Error()}
+	}
+
+	if p.Amount <= 0 || p.Fee < 0 {
+		return nil, &RPCError{RPCInvalidParams, errors.ErrInvalidAmount.Error()}
+	}
+
+	pubKey, err := n.payerPublicKey(p.From, p.PubKey)
+	if err != nil {
+		return nil, err
+	}
+
+	UTXOSet := blockchain.UTXOSet{Blockchain: n.bc}
+	recipients := []blockchain.Recipient{{Address: to, Amount: p.Amount}}
+	tx, err := blockchain.NewUnsignedTransaction(pubKey, recipients, p.Fee, nil, nil, &UTXOSet)
+	if errors.Is(err, errors.ErrNotEnoughFunds) || errors.Is(err, errors.ErrDuplicateRecipient) {
+		return nil, &RPCError{RPCWalletError, err.Error()}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return tx.EncodeRaw()
+}
+
+// payerPublicKey returns the public key of the address paying a raw transaction: pubKeyHex if
+// given, else the key of a wallet of the node, else the key revealed by a transaction of the chain.
+// A multisig address is paid from with its script.
+func (n *Node) payerPublicKey(from, pubKeyHex string) ([]byte, error) {
+	pubKeyHash, err := n.addressPubKeyHash(from)
+	if err != nil {
+		return nil, err
+	}
+
+	if transaction.IsMultisig(pubKeyHash) {
+		return pubKeyHash, nil
+	}
+
+	var pubKey []byte
+	if pubKeyHex != "" {
+		pubKey, err = hex.DecodeString(pubKeyHex)
+		if err != nil {
+			return nil, &RPCError{RPCInvalidParams, errors.ErrInvalidPublicKey.Error()}
+		}
+	} else if wallets, err := transaction.NewWallets(n.config.NodeID, n.network); err == nil && wallets.Wallets[from] != nil {
+		pubKey = wallets.Wallets[from].PublicKey
+	} else {
+		pubKey, err = n.bc.FindPublicKey(pubKeyHash)
+		if err != nil {
+			return nil, &RPCError{RPCWalletError, "unknown public key for address " + from}
+		}
+	}
+
+	keyHash, err := transaction.HashPubKey(pubKey)
+	if err != nil || !bytes.Equal(keyHash, pubKeyHash) {
+		return nil, &RPCError{RPCInvalidParams, errors.ErrInvalidPublicKey.Error()}
+	}
+
+	return pubKey, nil
+}
+
+// rpcSignRawTransaction signs a raw transaction with the wallets of the node and returns it
+func rpcSignRawTransaction(n *Node, params json.RawMessage) (interface{}, error) {
+	var p RawTransactionParams
+	err := decodeParams(params, &p)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := transaction.DecodeRaw(p.Hex)
+	if err != nil {
+		return nil, &RPCError{RPCInvalidParams, "invalid raw transaction"}
+	}
+
+	wallets, err := transaction.NewWallets(n.config.NodeID, n.network)
+	if err != nil {
+		return nil, &RPCError{RPCWalletError, err.Error()}
+	}
+
+	chainID, err := n.bc.ChainID()
+	if err != nil {
+		return nil, err
+	}
+
+	err = wallets.SignRaw(&tx, chainID)
+	if errors.Is(err, errors.ErrMissingKey) {
+		return nil, &RPCError{RPCWalletError, err.Error()}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return tx.EncodeRaw()
+}
+
+// rpcSendRawTransaction puts a signed raw transaction in the mempool and announces it to the peers.
+// It returns the ID of the transaction.
+func rpcSendRawTransaction(n *Node, params json.RawMessage) (interface{}, error) {
+	var p RawTransactionParams
+	err := decodeParams(params, &p)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := transaction.DecodeRaw(p.Hex)
+	if err != nil {
+		return nil, &RPCError{RPCInvalidParams, "invalid raw transaction"}
+	}
+
+	ok, err := n.bc.VerifyTransaction(&tx)
+	if errors.Is(err, errors.ErrTransactionNotFound) {
+		return nil, &RPCError{RPCRejected, "transaction spends unknown outputs"}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !ok || tx.IsCoinbase() {
+		return nil, &RPCError{RPCRejected, "invalid transaction signature"}
+	}
+
+	fee, err := n.bc.TransactionFee(&tx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = n.submitTransaction(&tx, fee)
+	if err != nil {
+		return nil, &RPCError{RPCRejected, err.Error()}
+	}
+
+	return hex.EncodeToString(tx.ID), nil
+}
+
+// rpcGetRawTransaction returns the serialized transaction in hex, from the mempool or the chain
+func rpcGetRawTransaction(n *Node, params json.RawMessage) (interface{}, error) {
+	var p GetRawTransactionParams
+	err := decodeParams(params, &p)
+	if err != nil {
+		return nil, err
+	}
+
+	ID, err := hex.DecodeString(p.TxID)
+	if err != nil || len(ID) == 0 {
+		return nil, &RPCError{RPCInvalidParams, "invalid transaction ID"}
+	}
+
+	tx, ok := n.mempool.Get(ID)
+	if !ok {
+		tx, err = n.bc.FindTransaction(ID)
+		if errors.Is(err, errors.ErrTransactionNotFound) {
+			return nil, &RPCError{RPCNotFound, err.Error()}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sl, err := tx.Serialize()
+	if err != nil {
+		return nil, err
+	}
+
+	return hex.EncodeToString(sl), nil
+}
+
+// rpcGetTransaction describes a transaction of the mempool or the main chain, with the payload of
+// its data output
+func rpcGetTransaction(n *Node, params json.RawMessage) (interface{}, error) {
+	var p GetRawTransactionParams
+	err := decodeParams(params, &p)
+	if err != nil {
+		return nil, err
+	}
+
+	ID, err := hex.DecodeString(p.TxID)
+	if err != nil || len(ID) == 0 {
+		return nil, &RPCError{RPCInvalidParams, "invalid transaction ID"}
+	}
+
+	result, err := n.transactionResult(ID)
+	if errors.Is(err, errors.ErrTransactionNotFound) {
+		return nil, &RPCError{RPCNotFound, err.Error()}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// rpcGetMempool returns the IDs of the transactions in the mempool, their description if verbose,
+// or a single transaction
+func rpcGetMempool(n *Node, params json.RawMessage) (interface{}, error) {
+	var p GetMempoolParams
+	if len(params) > 0 {
+		err := decodeParams(params, &p)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if p.TxID != "" {
+		txID, err := hex.DecodeString(p.TxID)
+		if err != nil {
+			return nil, &RPCError{RPCInvalidParams, errors.ErrInvalidHash.Error()}
+		}
+
+		reply, err := n.mempoolReply(txID)
+		if err != nil {
+			return nil, err
+		}
+
+		entry := MempoolEntries(reply.Entries)[0]
+		entry.Hex = hex.EncodeToString(reply.Tx)
+		return entry, nil
+	}
+
+	if p.Verbose {
+		return MempoolEntries(n.mempool.Info()), nil
+	}
+
+	IDs := []string{}
+	for _, tx := range n.mempool.Transactions() {
+		IDs = append(IDs, hex.EncodeToString(tx.ID))
+	}
+
+	return IDs, nil
+}
+
+// MempoolEntries converts the descriptions of transactions of the mempool to entries of the result
+// of getmempool.
+func MempoolEntries(infos []MempoolInfo) []MempoolEntryResult {
+	entries := []MempoolEntryResult{}
+	for _, info := range infos {
+		entries = append(entries, MempoolEntryResult{
+			TxID: hex.EncodeToString(info.ID),
+			Size: info.Size,
+			Fee:  info.Fee,
+			Time: info.Added.Unix(),
+		})
+	}
+
+	return entries
+}
+
+// rpcGetPeers returns the known nodes with their last-seen time and round-trip time
+func rpcGetPeers(n *Node, params json.RawMessage) (interface{}, error) {
+	peers := []PeerResult{}
+	for _, info := range n.knownNodes.Info() {
+		peer := PeerResult{Address: info.Address, RTT: info.RTT.Microseconds()}
+		if !info.LastSeen.IsZero() {
+			peer.LastSeen = info.LastSeen.Unix()
+		}
+		peers = append(peers, peer)
+	}
+
+	return peers, nil
+}
+
+// rpcGetMerkleProof returns the proof that a transaction is included in the main chain
+func rpcGetMerkleProof(n *Node, params json.RawMessage) (interface{}, error) {
+	var p GetMerkleProofParams
+	err := decodeParams(params, &p)
+	if err != nil {
+		return nil, err
+	}
+
+	ID, err := hex.DecodeString(p.TxID)
+	if err != nil || len(ID) == 0 {
+		return nil, &RPCError{RPCInvalidParams, "invalid transaction ID"}
+	}
+
+	proof, err := n.merkleProof(ID)
+	if errors.Is(err, errors.ErrTransactionNotFound) {
+		return nil, &RPCError{RPCNotFound, err.Error()}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := MerkleProofResult{
+		BlockHash:  hex.EncodeToString(proof.Header.Hash),
+		Height:     proof.Header.Height,
+		MerkleRoot: hex.EncodeToString(proof.Header.MerkleRoot),
+		Index:      proof.Index,
+		Proof:      []string{},
+	}
+	for _, sibling := range proof.Proof {
+		result.Proof = append(result.Proof, hex.EncodeToString(sibling))
+	}
+
+	return result, nil
+}
+
+// rpcGetTxOutSetInfo returns the statistics and the hash of the UTXO set
+func rpcGetTxOutSetInfo(n *Node, params json.RawMessage) (interface{}, error) {
+	UTXOSet := blockchain.UTXOSet{Blockchain: n.bc}
+	stats, err := UTXOSet.Stats()
+	if err != nil {
+		return nil, err
+	}
+
+	return UTXOStatsEntry(stats), nil
+}
+
+// rpcGetBlockTemplate returns an unmined block on top of the tip holding the valid transactions of
+// the mempool, for an external miner to find its proof-of-work, along with the ID submitblock takes
+func rpcGetBlockTemplate(n *Node, params json.RawMessage) (interface{}, error) {
+	var p BlockTemplateParams
+	if len(params) > 0 {
+		err := decodeParams(params, &p)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	address := n.miningAddress
+	if p.Address != "" {
+		var err error
+		address, err = n.parseAddress(p.Address)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if address.IsZero() {
+		return nil, &RPCError{RPCInvalidParams, "no address to pay the coinbase to"}
+	}
+
+	work, err := n.NewWork(address)
+	if err != nil {
+		return nil, err
+	}
+	template := work.Block
+
+	encoded, err := template.Serialize()
+	if err != nil {
+		return nil, err
+	}
+
+	return BlockTemplateResult{
+		TemplateID:    work.TemplateID,
+		Hex:           hex.EncodeToString(encoded),
+		PrevBlockHash: hex.EncodeToString(template.PrevBlockHash),
+		Height:        template.Height,
+		Timestamp:     template.Timestamp,
+		Bits:          template.Bits,
+		Target:        template.Target().Text(16),
+		MerkleRoot:    hex.EncodeToString(template.MerkleRoot),
+		Version:       template.Version,
+		Transactions:  len(template.Transactions),
+	}, nil
+}
+
+// rpcSubmitBlock connects a block mined from a template of getblocktemplate and announces it to the
+// known nodes, returning its hash. A block of a template the tip has moved past is refused with
+// RPCStaleWork.
+func rpcSubmitBlock(n *Node, params json.RawMessage) (interface{}, error) {
+	var p SubmitBlockParams
+	err := decodeParams(params, &p)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded, err := hex.DecodeString(p.Hex)
+	if err != nil {
+		return nil, &RPCError{RPCInvalidParams, "invalid block"}
+	}
+
+	bl, err := block.DeserializeBlock(encoded)
+	if err != nil {
+		return nil, &RPCError{RPCInvalidParams, "invalid block"}
+	}
+
+	if p.TemplateID == "" {
+		return nil, &RPCError{RPCInvalidParams, "missing template ID"}
+	}
+
+	err = n.SubmitWork(p.TemplateID, bl)
+	if errors.Is(err, errors.ErrStaleBlock) {
+		return nil, &RPCError{RPCStaleWork, err.Error()}
+	}
+	if err != nil {
+		return nil, &RPCError{RPCRejected, err.Error()}
+	}
+
+	n.logger.Info("Added submitted block", "block", bl.Hash, "height", bl.Height)
+
+	return hex.EncodeToString(bl.Hash), nil
+}
+
+// rpcRescanBlockchain records the transactions of the wallets of the node found in the chain from
+// the start height, or from where the last rescan stopped, and returns the balances of the wallets
+func rpcRescanBlockchain(n *Node, params json.RawMessage) (interface{}, error) {
+	var p RescanParams
+	if len(params) > 0 {
+		err := decodeParams(params, &p)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	from := -1
+	if p.StartHeight != nil {
+		if *p.StartHeight < 0 {
+			return nil, &RPCError{RPCInvalidParams, "start_height must not be negative"}
+		}
+		from = *p.StartHeight
+	}
+
+	wallets, err := transaction.NewWallets(n.config.NodeID, n.network)
+	if err != nil {
+		return nil, err
+	}
+
+	scanned, err := n.bc.RescanWallets(wallets, from, func(height, bestHeight int) {
+		n.logger.Info("Rescanning the chain", "height", height, "best", bestHeight)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	UTXOSet := blockchain.UTXOSet{Blockchain: n.bc}
+	balances, err := UTXOSet.GetWalletBalances(wallets, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	return RescanResult{scanned, WalletBalance(balances)}, nil
+}
+
+// UTXOStatsEntry converts the statistics of a UTXO set to the result of gettxoutsetinfo.
+func UTXOStatsEntry(stats blockchain.UTXOStats) UTXOStatsResult {
+	return UTXOStatsResult{
+		BestBlock:      hex.EncodeToString(stats.BestBlock),
+		Transactions:   stats.Transactions,
+		Outputs:        stats.Outputs,
+		TotalValue:     stats.TotalValue,
+		SerializedSize: stats.SerializedSize,
+		Hash:           hex.EncodeToString(stats.Hash),
+	}
+}
@@ -0,0 +1,432 @@
+package server
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/yanglinshu/glock/internal/blockchain"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// rpcReply is a JSON-RPC response with its result left encoded
+type rpcReply struct {
+	ID     json.RawMessage `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *RPCError       `json:"error"`
+}
+
+// postRPC posts a raw JSON-RPC request body to the handler of a node with the given token, and
+// returns the HTTP response
+func postRPC(t *testing.T, n *Node, token, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	recorder := httptest.NewRecorder()
+	n.serveRPC(recorder, request)
+
+	return recorder
+}
+
+// rpcCall calls a method of a node through its HTTP handler, decoding the result into result
+// unless the method fails, in which case the error is returned
+func rpcCall(t *testing.T, n *Node, method string, params, result interface{}) *RPCError {
+	t.Helper()
+
+	encodedParams, err := json.Marshal(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := json.Marshal(RPCRequest{JSONRPC: "2.0", ID: json.RawMessage("7"), Method: method, Params: encodedParams})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reply := decodeReply(t, postRPC(t, n, n.config.RPCToken, string(body)))
+	if string(reply.ID) != "7" {
+		t.Fatalf("%s replied with ID %s, want 7", method, reply.ID)
+	}
+
+	if reply.Error != nil {
+		return reply.Error
+	}
+
+	err = json.Unmarshal(reply.Result, result)
+	if err != nil {
+		t.Fatalf("decoding the result of %s: %v", method, err)
+	}
+
+	return nil
+}
+
+// decodeReply decodes a successful HTTP response carrying a JSON-RPC response
+func decodeReply(t *testing.T, recorder *httptest.ResponseRecorder) rpcReply {
+	t.Helper()
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", recorder.Code, recorder.Body)
+	}
+
+	var reply rpcReply
+	err := json.NewDecoder(recorder.Body).Decode(&reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return reply
+}
+
+// fundedWallet creates a wallet file for a node holding one wallet, paid by a block the node mines,
+// and returns the address of the wallet
+func fundedWallet(t *testing.T, n *Node) string {
+	t.Helper()
+
+	wallets := transaction.Wallets{Wallets: make(map[string]*transaction.Wallet), Network: transaction.Mainnet}
+	address, err := wallets.CreateWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = wallets.SaveToFile(n.config.NodeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payee, err := transaction.ParseAddress(address, transaction.Mainnet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = n.generate(1, payee)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return address
+}
+
+func TestRPCChainMethods(t *testing.T) {
+	tn := newTestNetwork(t, 3)
+	b := tn.addNode(Config{})
+	a := tn.addNode(Config{}, b)
+	tn.waitFor("a to know b", func() bool { return a.knownNodes.IsKnown(b.Address()) })
+
+	var height int
+	if err := rpcCall(t, a, "getbestheight", nil, &height); err != nil || height != 3 {
+		t.Fatalf("getbestheight = %d, %v, want 3", height, err)
+	}
+
+	// A block looked up by height and by hash
+	two := 2
+	var byHeight, byHash BlockResult
+	if err := rpcCall(t, a, "getblock", GetBlockParams{Height: &two}, &byHeight); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rpcCall(t, a, "getblock", GetBlockParams{Hash: byHeight.Hash}, &byHash); err != nil {
+		t.Fatal(err)
+	}
+
+	if byHeight.Height != 2 || byHash.Hash != byHeight.Hash || byHash.Confirmations != 2 || len(byHash.Transactions) != 1 {
+		t.Fatalf("getblock by height = %+v, by hash = %+v", byHeight, byHash)
+	}
+
+	for params, want := range map[string]int{
+		`{"hash":"` + strings.Repeat("00", 32) + `"}`: RPCNotFound,
+		`{"height":9}`:     RPCNotFound,
+		`{"hash":"xyz"}`:   RPCInvalidParams,
+		`{"height":"two"}`: RPCInvalidParams,
+	} {
+		err := rpcCall(t, a, "getblock", json.RawMessage(params), &byHash)
+		if err == nil || err.Code != want {
+			t.Fatalf("getblock with %s = %v, want code %d", params, err, want)
+		}
+	}
+
+	// The wallet of the network holds the coinbases of the genesis block and the prefix
+	var balance int
+	utxoSet := blockchain.UTXOSet{Blockchain: a.bc}
+	want, err := utxoSet.GetBalance(tn.address.PubKeyHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rpcCall(t, a, "getbalance", GetBalanceParams{Address: tn.address.String()}, &balance); err != nil || balance != want || want == 0 {
+		t.Fatalf("getbalance = %d, %v, want %d", balance, err, want)
+	}
+
+	if err := rpcCall(t, a, "getbalance", GetBalanceParams{Address: "nope"}, &balance); err == nil || err.Code != RPCInvalidParams {
+		t.Fatalf("getbalance of an invalid address = %v, want invalid parameters", err)
+	}
+
+	var peers []PeerResult
+	if err := rpcCall(t, a, "getpeers", nil, &peers); err != nil || len(peers) != 1 || peers[0].Address != b.Address() {
+		t.Fatalf("getpeers = %+v, %v, want b", peers, err)
+	}
+}
+
+func TestRPCSendToAddress(t *testing.T) {
+	tn := newTestNetwork(t, 0)
+	a := tn.addNode(Config{RPCToken: "secret"})
+	from := fundedWallet(t, a)
+
+	to := newAddress(t)
+	var txID string
+	if err := rpcCall(t, a, "sendtoaddress", SendToAddressParams{From: from, To: to.String(), Amount: 5, Fee: 1}, &txID); err != nil {
+		t.Fatal(err)
+	}
+
+	var mempool []string
+	if err := rpcCall(t, a, "getmempool", nil, &mempool); err != nil || len(mempool) != 1 || mempool[0] != txID {
+		t.Fatalf("getmempool = %v, %v, want [%s]", mempool, err, txID)
+	}
+
+	var entries []MempoolEntryResult
+	if err := rpcCall(t, a, "getmempool", GetMempoolParams{Verbose: true}, &entries); err != nil || len(entries) != 1 || entries[0].Fee != 1 {
+		t.Fatalf("verbose getmempool = %+v, %v, want the payment with a fee of 1", entries, err)
+	}
+
+	// The raw transaction pays the address
+	var raw string
+	if err := rpcCall(t, a, "getrawtransaction", GetRawTransactionParams{TxID: txID}, &raw); err != nil {
+		t.Fatal(err)
+	}
+
+	encoded, err := hex.DecodeString(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := transaction.DeserializeTransaction(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hex.EncodeToString(tx.ID) != txID || tx.Vout[0].Value != 5 || !tx.Vout[0].IsLockedWithKey(to.PubKeyHash()) {
+		t.Fatalf("getrawtransaction returned %x paying %d, want %s paying 5 to %s", tx.ID, tx.Vout[0].Value, txID, to)
+	}
+
+	for name, p := range map[string]SendToAddressParams{
+		"no amount":        {From: from, To: to.String()},
+		"negative fee":     {From: from, To: to.String(), Amount: 1, Fee: -1},
+		"invalid receiver": {From: from, To: "nope", Amount: 1},
+	} {
+		err := rpcCall(t, a, "sendtoaddress", p, &txID)
+		if err == nil || err.Code != RPCInvalidParams {
+			t.Fatalf("sendtoaddress with %s = %v, want invalid parameters", name, err)
+		}
+	}
+
+	for name, p := range map[string]SendToAddressParams{
+		"a wallet the node lacks": {From: tn.address.String(), To: to.String(), Amount: 1},
+		"too large an amount":     {From: from, To: to.String(), Amount: 1 << 40},
+	} {
+		err := rpcCall(t, a, "sendtoaddress", p, &txID)
+		if err == nil || err.Code != RPCWalletError {
+			t.Fatalf("sendtoaddress from %s = %v, want a wallet error", name, err)
+		}
+	}
+
+	if err := rpcCall(t, a, "getrawtransaction", GetRawTransactionParams{TxID: strings.Repeat("00", 32)}, &raw); err == nil || err.Code != RPCNotFound {
+		t.Fatalf("getrawtransaction of an unknown transaction = %v, want not found", err)
+	}
+}
+
+func TestRPCRescanBlockchain(t *testing.T) {
+	tn := newTestNetwork(t, 2)
+	a := tn.addNode(Config{})
+
+	// The key is paid in the middle of the chain, then imported into the wallet of the node
+	wallets := transaction.Wallets{Wallets: make(map[string]*transaction.Wallet), Network: transaction.Mainnet}
+	address, err := wallets.CreateWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payee, err := transaction.ParseAddress(address, transaction.Mainnet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = a.generate(1, payee)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = a.generate(2, tn.address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = wallets.SaveToFile(a.config.NodeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	utxoSet := blockchain.UTXOSet{Blockchain: a.bc}
+	paid, err := utxoSet.GetBalance(payee.PubKeyHash())
+	if err != nil || paid == 0 {
+		t.Fatalf("balance of the imported key = %d, %v, want the reward of block 3", paid, err)
+	}
+
+	var result RescanResult
+	if err := rpcCall(t, a, "rescanblockchain", nil, &result); err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Scanned != 6 || result.Balance.Confirmed != paid || len(result.Balance.Addresses) != 1 || result.Balance.Addresses[0].Address != address {
+		t.Fatalf("rescanblockchain = %+v, want 6 blocks scanned and %d confirmed for %s", result, paid, address)
+	}
+
+	var history []HistoryResult
+	if err := rpcCall(t, a, "gethistory", GetBalanceParams{Address: address}, &history); err != nil || len(history) != 1 || history[0].Height != 3 {
+		t.Fatalf("gethistory of the imported key = %+v, %v, want the coinbase of block 3", history, err)
+	}
+
+	// The next rescan resumes where the last one stopped, unless told where to start
+	if err := rpcCall(t, a, "rescanblockchain", nil, &result); err != nil || result.Scanned != 0 {
+		t.Fatalf("resumed rescanblockchain = %+v, %v, want no block scanned", result, err)
+	}
+
+	three := 3
+	if err := rpcCall(t, a, "rescanblockchain", RescanParams{StartHeight: &three}, &result); err != nil || result.Scanned != 3 || result.Balance.Confirmed != paid {
+		t.Fatalf("rescanblockchain from height 3 = %+v, %v, want 3 blocks scanned", result, err)
+	}
+
+	negative := -1
+	if err := rpcCall(t, a, "rescanblockchain", RescanParams{StartHeight: &negative}, &result); err == nil || err.Code != RPCInvalidParams {
+		t.Fatalf("rescanblockchain from a negative height = %v, want invalid parameters", err)
+	}
+}
+
+func TestRPCRawTransactionWorkflow(t *testing.T) {
+	tn := newTestNetwork(t, 0)
+	a := tn.addNode(Config{RPCToken: "secret"})
+	from := fundedWallet(t, a)
+	to := newAddress(t)
+
+	var unsigned, signed, txID string
+	if err := rpcCall(t, a, "createrawtransaction", CreateRawTransactionParams{From: from, To: to.String(), Amount: 4, Fee: 1}, &unsigned); err != nil {
+		t.Fatal(err)
+	}
+
+	// An unsigned transaction is not relayed
+	if err := rpcCall(t, a, "sendrawtransaction", RawTransactionParams{Hex: unsigned}, &txID); err == nil || err.Code != RPCRejected {
+		t.Fatalf("sendrawtransaction of an unsigned transaction = %v, want rejected", err)
+	}
+
+	if err := rpcCall(t, a, "signrawtransaction", RawTransactionParams{Hex: unsigned}, &signed); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rpcCall(t, a, "sendrawtransaction", RawTransactionParams{Hex: signed}, &txID); err != nil {
+		t.Fatal(err)
+	}
+
+	// The transaction in the mempool is the one signed, byte for byte
+	var raw string
+	if err := rpcCall(t, a, "getrawtransaction", GetRawTransactionParams{TxID: txID}, &raw); err != nil || raw != signed {
+		t.Fatalf("getrawtransaction = %s, %v, want the signed transaction", raw, err)
+	}
+
+	tx, err := transaction.DecodeRaw(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hex.EncodeToString(tx.ID) != txID || tx.Vout[0].Value != 4 || !tx.Vout[0].IsLockedWithKey(to.PubKeyHash()) {
+		t.Fatalf("sendrawtransaction sent %x paying %d, want %s paying 4 to %s", tx.ID, tx.Vout[0].Value, txID, to)
+	}
+
+	for method, raw := range map[string]string{"signrawtransaction": "zz", "sendrawtransaction": "0102"} {
+		if err := rpcCall(t, a, method, RawTransactionParams{Hex: raw}, &signed); err == nil || err.Code != RPCInvalidParams {
+			t.Fatalf("%s of an invalid raw transaction = %v, want invalid parameters", method, err)
+		}
+	}
+}
+
+func TestRPCRejectsInvalidRequests(t *testing.T) {
+	tn := newTestNetwork(t, 0)
+	a := tn.addNode(Config{RPCToken: "secret"})
+
+	// Only POST requests carrying the token are handled
+	recorder := httptest.NewRecorder()
+	a.serveRPC(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("GET = %d, want %d", recorder.Code, http.StatusMethodNotAllowed)
+	}
+
+	body := `{"jsonrpc":"2.0","id":1,"method":"getbestheight"}`
+	for _, token := range []string{"", "wrong"} {
+		if recorder := postRPC(t, a, token, body); recorder.Code != http.StatusUnauthorized {
+			t.Fatalf("request with token %q = %d, want %d", token, recorder.Code, http.StatusUnauthorized)
+		}
+	}
+
+	for body, want := range map[string]int{
+		`{"jsonrpc":`: RPCParseError,
+		`{"jsonrpc":"1.0","id":1,"method":"getbestheight"}`:                            RPCInvalidRequest,
+		`{"jsonrpc":"2.0","id":1}`:                                                     RPCInvalidRequest,
+		`{"jsonrpc":"2.0","id":1,"method":"stop"}`:                                     RPCMethodNotFound,
+		`{"jsonrpc":"2.0","id":1,"method":"getblock"}`:                                 RPCInvalidParams,
+		`{"jsonrpc":"2.0","id":1,"method":"getbalance"}`:                               RPCInvalidParams,
+		`{"jsonrpc":"2.0","id":1,"method":"getrawtransaction","params":{"txid":"zz"}}`: RPCInvalidParams,
+	} {
+		reply := decodeReply(t, postRPC(t, a, "secret", body))
+		if reply.Error == nil || reply.Error.Code != want || reply.Result != nil {
+			t.Fatalf("request %s = %+v, want code %d", body, reply, want)
+		}
+	}
+
+	reply := decodeReply(t, postRPC(t, a, "secret", body))
+	if reply.Error != nil || !bytes.Equal(reply.Result, []byte("0")) {
+		t.Fatalf("getbestheight with the token = %s, %v", reply.Result, reply.Error)
+	}
+}
+
+func TestRPCRefusesMiningAndSpendingWithoutToken(t *testing.T) {
+	tn := newTestNetwork(t, 0)
+	a := tn.addNode(Config{})
+	from := fundedWallet(t, a)
+	to := newAddress(t)
+
+	var unsigned string
+	if err := rpcCall(t, a, "createrawtransaction", CreateRawTransactionParams{From: from, To: to.String(), Amount: 4, Fee: 1}, &unsigned); err != nil {
+		t.Fatal(err)
+	}
+
+	// Any caller reaches a node without a token, so it neither mines nor spends for them
+	var result json.RawMessage
+	for method, params := range map[string]interface{}{
+		"generate":           GenerateParams{Blocks: 1, Address: to.String()},
+		"sendtoaddress":      SendToAddressParams{From: from, To: to.String(), Amount: 5, Fee: 1},
+		"signrawtransaction": RawTransactionParams{Hex: unsigned},
+	} {
+		if err := rpcCall(t, a, method, params, &result); err == nil || err.Code != RPCTokenRequired {
+			t.Fatalf("%s without a token = %v, want RPCTokenRequired", method, err)
+		}
+	}
+
+	if height, err := a.bc.GetBestHeight(); err != nil || height != 1 {
+		t.Fatalf("height after refused requests = %d, %v, want 1", height, err)
+	}
+
+	if a.mempool.Len() != 0 {
+		t.Fatalf("%d transactions in the mempool after refused requests, want none", a.mempool.Len())
+	}
+
+	// The methods reading the chain are still served
+	var height int
+	if err := rpcCall(t, a, "getbestheight", nil, &height); err != nil || height != 1 {
+		t.Fatalf("getbestheight without a token = %d, %v, want 1", height, err)
+	}
+}
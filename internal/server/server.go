@@ -1,154 +1,786 @@
-package server
-
-import (
-	"bytes"
-	"fmt"
-	"io"
-	"io/ioutil"
-	"log"
-	"net"
-
-	"github.com/yanglinshu/glock/internal/blockchain"
-	"github.com/yanglinshu/glock/internal/errors"
-	"github.com/yanglinshu/glock/internal/transaction"
-)
-
-// protocol is the protocol used to communicate with other nodes
-const protocol = "tcp"
-
-// nodeAddress is the address of the current node
-var nodeAddress string
-
-// miningAddress is the address of the miner
-var miningAddress string
-
-// knownNodes is the list of known nodes
-var knownNodes = []string{"localhost:5000"}
-
-// blocksInTransit is the list of blocks that are being downloaded
-var blocksInTransit = [][]byte{}
-
-// mempool is the list of transactions that are waiting to be mined
-var mempool = make(map[string]transaction.Transaction)
-
-func StartServer(nodeID, minerAddress string) error {
-	nodeAddress = fmt.Sprintf("localhost:%s", nodeID)
-	miningAddress = minerAddress
-	ln, err := net.Listen(protocol, nodeAddress)
-	if err != nil {
-		return err
-	}
-	defer ln.Close()
-
-	bc, err := blockchain.NewBlockchain(nodeID)
-	if err != nil {
-		return err
-	}
-
-	// send version to known nodes to get the latest blockchain
-	if nodeAddress != knownNodes[0] {
-		sendVersion(knownNodes[0], bc)
-	}
-
-	for {
-		conn, err := ln.Accept()
-		if err != nil {
-			return err
-		}
-		go handleConnection(conn, bc)
-	}
-}
-
-// handleConnection handles the connection
-func handleConnection(conn net.Conn, bc *blockchain.Blockchain) {
-	request, err := ioutil.ReadAll(conn)
-	if err != nil {
-		log.Panic(err)
-	}
-
-	command := bytesToCommand(request[:commandLength])
-	log.Printf("Received %s command\n", command)
-
-	switch command {
-	case "addr":
-		err := handleAddr(request)
-		if err != nil {
-			log.Println(err)
-		}
-	case "block":
-		err := handleBlock(request, bc)
-		if err != nil {
-			log.Println(err)
-		}
-	case "inv":
-		err := handleInv(request, bc)
-		if err != nil {
-			log.Println(err)
-		}
-	case "getblocks":
-		err := handleGetBlocks(request, bc)
-		if err != nil {
-			log.Println(err)
-		}
-	case "getdata":
-		err := handleGetData(request, bc)
-		if err != nil {
-			log.Println(err)
-		}
-	case "tx":
-		err := handleTx(request, bc)
-		if err != nil {
-			log.Println(err)
-		}
-	case "version":
-		err := handleVersion(request, bc)
-		if err != nil {
-			log.Println(err)
-		}
-	default:
-		log.Println(errors.ErrUnknownCommand)
-	}
-
-	conn.Close()
-}
-
-// nodeIsKnown checks if the node is known
-func nodeIsKnown(addr string) bool {
-	for _, node := range knownNodes {
-		if node == addr {
-			return true
-		}
-	}
-	return false
-}
-
-// sendData sends data to a node
-func sendData(addr string, data []byte) error {
-	conn, err := net.Dial(protocol, addr)
-	if err != nil {
-		log.Printf("%s is not available\n", addr)
-		var updatedNodes []string
-
-		for _, node := range knownNodes {
-			if node != addr {
-				updatedNodes = append(updatedNodes, node)
-			}
-		}
-
-		knownNodes = updatedNodes
-		return err
-	}
-	defer conn.Close()
-
-	_, err = io.Copy(conn, bytes.NewReader(data))
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// sendTransaction sends a transaction to the network
-func SendTransaction(tnx *transaction.Transaction) {
-	sendTx(knownNodes[0], tnx)
-}
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/yanglinshu/glock/internal/blockchain"
+	"github.com/yanglinshu/glock/internal/config"
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/events"
+	"github.com/yanglinshu/glock/internal/logger"
+	"github.com/yanglinshu/glock/internal/metrics"
+	"github.com/yanglinshu/glock/internal/transaction"
+	"github.com/yanglinshu/glock/internal/util"
+)
+
+// protocol is the protocol used to communicate with other nodes
+const protocol = "tcp"
+
+// DefaultTimeout is how long reading or writing a message may take unless configured otherwise
+const DefaultTimeout = 5 * time.Second
+
+// DefaultSeeds are the nodes known at startup unless configured otherwise
+var DefaultSeeds = []string{config.DefaultSeed}
+
+// Config holds the settings of a node
+type Config struct {
+	NodeID              string        // the ID of the node, which names its files
+	ListenAddr          string        // the address the node listens on, localhost:NodeID if empty
+	MinerAddress        string        // the address receiving mining rewards, mining is off if empty
+	Allowed             []string      // the identities allowed to talk to the node, every peer if nil
+	DebugAddr           string        // the address serving profiles and metrics, disabled if empty
+	MempoolSize         int           // the maximum number of transactions in the mempool, unbounded if 0
+	Seeds               []string      // the nodes known at startup, DefaultSeeds if nil
+	Network             string        // the network to join, DefaultNetwork if empty
+	ReadTimeout         time.Duration // how long a peer may take to send a message, DefaultTimeout if 0
+	WriteTimeout        time.Duration // how long sending a message to a peer may take, DefaultTimeout if 0
+	PingInterval        time.Duration // how often the peers are pinged, DefaultPingInterval if 0
+	RPCAddr             string        // the address serving the JSON-RPC methods, disabled if empty
+	RPCToken            string        // the bearer token JSON-RPC requests must carry, none if empty
+	MaxClockSkew        time.Duration // how far ahead of the local clock a block may be timestamped, blockchain.DefaultMaxClockSkew if 0
+	MempoolTTL          time.Duration // how long a transaction may wait in the mempool, DefaultMempoolTTL if 0
+	RebroadcastInterval time.Duration // how often unconfirmed transactions of the wallet are announced again, DefaultRebroadcastInterval if 0
+	MiningIdleInterval  time.Duration // how often an empty block is mined when no transaction arrives, never if 0
+	MaxInbound          int           // the most inbound connections open at once, DefaultMaxInbound if 0
+	MaxMessageRate      int           // the most messages a peer may send per minute before it is throttled, DefaultMaxMessageRate if 0
+	MaxInvItems         int           // the most items of an inv message handled, the rest being dropped, DefaultMaxInvItems if 0
+	WorkFeeDelta        int           // the fees the mempool must gain for fresh work to be pushed to the miners, DefaultWorkFeeDelta if 0
+	Logger              logger.Logger // where the node logs, info and above to the standard error if nil
+}
+
+// Node is a node of the network. It owns the blockchain database and all the state shared by the
+// connection handlers.
+type Node struct {
+	config        Config                 // the settings of the node
+	address       string                 // the address the node listens on
+	miningAddress transaction.Address    // the address of the miner, zero if the node does not mine
+	bc            *blockchain.Blockchain // the blockchain of the node
+	logger        logger.Logger          // the logger of the node
+
+	knownNodes      *PeerManager // the known nodes, starting with the seeds
+	blocksInTransit *BlockQueue  // the blocks that are being downloaded
+	orphans         *OrphanPool  // the blocks received before their parent
+	mempool         *Mempool     // the transactions that are waiting to be mined
+	reorgBase       []byte       // the tip before the blocks being downloaded arrived
+	lock            sync.Mutex   // guards address, reorgBase and the listeners and cancel of Start
+	eventBus        *events.Bus  // notifications about transactions leaving the main chain
+	mining          miningState  // the block being mined
+	work            workState    // the templates handed out to external miners
+	batch           syncBatch    // the batch of blocks being downloaded
+
+	identity           *ecdsa.PrivateKey    // the key the node signs its handshakes with
+	allowlist          map[string]bool      // the identities allowed to connect, nil if all are
+	peerIdentities     map[string]string    // the identity of every authenticated peer by address
+	receivedNonces     map[string]time.Time // when the signed version messages received expire, by identity and nonce
+	peerIdentitiesLock sync.Mutex           // guards peerIdentities and receivedNonces
+
+	magic          uint32               // the magic number of the network of the node
+	network        transaction.Network  // the network of the addresses the node accepts and shows
+	genesis        []byte               // the hash of the genesis block of the node
+	sentNonces     map[uint64]time.Time // the nonces of the recent version messages of the node
+	handshakes     map[string]bool      // the peers the handshake completed with, by address
+	peerServices   map[string]Services  // the services advertised by the peers in their handshake, by address
+	handshakesLock sync.Mutex           // guards sentNonces, handshakes and peerServices
+
+	pool      *ConnPool             // the outbound connections to the peers
+	conns     map[net.Conn]struct{} // the inbound connections open
+	connsLock sync.Mutex            // guards conns
+	limiter   *RateLimiter          // the message rate of the peers
+
+	ctx           context.Context // the context the node runs in, canceled when it stops
+	listener      net.Listener    // the listener accepting peers, once started
+	debugListener net.Listener    // the listener of the debug server, if any
+	rpcListener   net.Listener    // the listener of the JSON-RPC server, if any
+	handlers      sync.WaitGroup  // the connection handlers running
+	loops         sync.WaitGroup  // the background loops using the blockchain, such as the miner
+	cancel        func()          // cancels the context the node was started with
+	quit          chan struct{}   // closed when the node stops
+	stopOnce      sync.Once       // makes Stop idempotent
+}
+
+// NewNode creates a node with the given settings and opens its blockchain.
+func NewNode(cfg Config) (*Node, error) {
+	seeds := cfg.Seeds
+	if seeds == nil {
+		seeds = DefaultSeeds
+	}
+
+	if cfg.Network == "" {
+		cfg.Network = DefaultNetwork
+	}
+
+	magic, err := NetworkMagic(cfg.Network)
+	if err != nil {
+		return nil, err
+	}
+
+	network, err := transaction.NetworkByName(cfg.Network)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.ReadTimeout == 0 {
+		cfg.ReadTimeout = DefaultTimeout
+	}
+
+	if cfg.WriteTimeout == 0 {
+		cfg.WriteTimeout = DefaultTimeout
+	}
+
+	if cfg.PingInterval == 0 {
+		cfg.PingInterval = DefaultPingInterval
+	}
+
+	if cfg.MempoolTTL == 0 {
+		cfg.MempoolTTL = DefaultMempoolTTL
+	}
+
+	if cfg.RebroadcastInterval == 0 {
+		cfg.RebroadcastInterval = DefaultRebroadcastInterval
+	}
+
+	if cfg.MaxInbound == 0 {
+		cfg.MaxInbound = DefaultMaxInbound
+	}
+
+	if cfg.MaxMessageRate == 0 {
+		cfg.MaxMessageRate = DefaultMaxMessageRate
+	}
+
+	if cfg.MaxInvItems < maxInvBlocks {
+		cfg.MaxInvItems = DefaultMaxInvItems
+	}
+
+	if cfg.WorkFeeDelta == 0 {
+		cfg.WorkFeeDelta = DefaultWorkFeeDelta
+	}
+
+	if cfg.Logger == nil {
+		cfg.Logger = logger.New(os.Stderr, logger.LevelInfo)
+	}
+
+	if cfg.ListenAddr == "" {
+		cfg.ListenAddr = fmt.Sprintf("localhost:%s", cfg.NodeID)
+	}
+
+	n := &Node{
+		config:          cfg,
+		address:         cfg.ListenAddr,
+		logger:          cfg.Logger,
+		knownNodes:      NewPeerManager(seeds...),
+		blocksInTransit: NewBlockQueue(),
+		orphans:         NewOrphanPool(),
+		mempool:         NewMempool(cfg.MempoolSize, cfg.Logger),
+		eventBus:        events.NewBus(),
+		peerIdentities:  make(map[string]string),
+		receivedNonces:  make(map[string]time.Time),
+		magic:           magic,
+		network:         network,
+		sentNonces:      make(map[uint64]time.Time),
+		handshakes:      make(map[string]bool),
+		peerServices:    make(map[string]Services),
+		conns:           make(map[net.Conn]struct{}),
+		limiter:         NewRateLimiter(cfg.MaxMessageRate),
+		quit:            make(chan struct{}),
+		ctx:             context.Background(),
+	}
+	n.pool = NewConnPool(cfg.WriteTimeout, n.versionRequest)
+
+	if cfg.MinerAddress != "" {
+		n.miningAddress, err = transaction.ParseAddress(cfg.MinerAddress, network)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	identity, err := LoadIdentity(cfg.NodeID)
+	if err != nil {
+		return nil, err
+	}
+	n.identity = identity
+
+	if cfg.Allowed != nil {
+		n.allowlist = make(map[string]bool)
+		for _, id := range cfg.Allowed {
+			n.allowlist[id] = true
+		}
+	}
+
+	bc, err := blockchain.NewBlockchain(cfg.NodeID)
+	if err != nil {
+		return nil, err
+	}
+	n.bc = bc
+	bc.SetLogger(cfg.Logger)
+	bc.SetMiningProgress(n.reportHashRate)
+	bc.SetMaxClockSkew(cfg.MaxClockSkew)
+
+	// Chains created before their network was recorded may join any network
+	if network := bc.Params().Network; network != "" && network != cfg.Network {
+		bc.CloseDB()
+		return nil, errors.Wrapf(errors.ErrChainNetwork, "blockchain of %s, node on %s", network, cfg.Network)
+	}
+
+	n.genesis, err = bc.ChainID()
+	if err != nil {
+		bc.CloseDB()
+		return nil, err
+	}
+
+	err = n.restoreMempool()
+	if err != nil {
+		bc.CloseDB()
+		return nil, err
+	}
+
+	return n, nil
+}
+
+// restoreMempool puts the transactions saved when the node last stopped back into the mempool,
+// dropping the ones that are no longer valid
+func (n *Node) restoreMempool() error {
+	txs, added, err := loadMempoolFile(n.config.NodeID)
+	if err != nil {
+		return err
+	}
+
+	for i := range txs {
+		tx := &txs[i]
+		if ok, err := n.bc.VerifyTransaction(tx); err != nil || !ok {
+			n.logger.Info("Dropped transaction, it is no longer valid", "tx", tx.ID)
+			continue
+		}
+
+		fee, err := n.bc.TransactionFee(tx)
+		if err != nil {
+			n.logger.Info("Dropped transaction, it is no longer valid", "tx", tx.ID)
+			continue
+		}
+
+		err = n.mempool.addAt(*tx, fee, added[i])
+		if err != nil {
+			n.logger.Info("Dropped transaction", "tx", tx.ID, "err", err)
+		}
+	}
+
+	if n.mempool.Len() > 0 {
+		n.logger.Info("Restored the mempool", "transactions", n.mempool.Len())
+	}
+
+	return nil
+}
+
+// Address returns the address the node listens on and advertises to its peers. Once the node has
+// started, it holds the port given if port 0 was configured.
+func (n *Node) Address() string {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	return n.address
+}
+
+// Subscribe returns a channel receiving the events of the node, see events.Bus.Subscribe
+func (n *Node) Subscribe(buffer int) chan events.Event {
+	return n.eventBus.Subscribe(buffer)
+}
+
+// Start listens on the port given by the ID of the node and handles peers until the context is
+// canceled or Stop is called. A node listening on port 0 gets a free port, which it advertises to
+// its peers. If a debug address is configured, profiles and metrics are served over HTTP on it, and
+// if an RPC address is, the JSON-RPC methods.
+func (n *Node) Start(ctx context.Context) error {
+	address := n.Address()
+	ln, err := net.Listen(protocol, address)
+	if err != nil {
+		return err
+	}
+
+	// The peers are told the port given for port 0, which is the one they can reach. It is resolved
+	// before any goroutine of the node starts.
+	if host, port, err := net.SplitHostPort(address); err == nil && port == "0" {
+		_, port, _ = net.SplitHostPort(ln.Addr().String())
+		address = net.JoinHostPort(host, port)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	n.lock.Lock()
+	n.ctx = ctx
+	n.cancel = cancel
+	n.listener = ln
+	n.address = address
+	n.lock.Unlock()
+
+	n.logger.Info("Starting node", "address", address, "identity", Identity(n.identity))
+
+	if n.config.DebugAddr != "" {
+		debugListener, err := startDebugServer(ctx, n.config.DebugAddr, n.bc, n.logger)
+		if err != nil {
+			cancel()
+			ln.Close()
+			return err
+		}
+
+		n.lock.Lock()
+		n.debugListener = debugListener
+		n.lock.Unlock()
+	}
+
+	if n.config.RPCAddr != "" {
+		rpcListener, err := n.startRPCServer(ctx)
+		if err != nil {
+			cancel()
+			ln.Close()
+
+			n.lock.Lock()
+			if n.debugListener != nil {
+				n.debugListener.Close()
+			}
+			n.lock.Unlock()
+
+			return err
+		}
+
+		n.lock.Lock()
+		n.rpcListener = rpcListener
+		n.lock.Unlock()
+	}
+
+	go func() {
+		<-ctx.Done()
+		n.Stop()
+	}()
+
+	go n.keepAlive(ctx)
+	n.loops.Add(1)
+	go func() {
+		defer n.loops.Done()
+		n.maintainMempool(ctx)
+	}()
+
+	n.loops.Add(1)
+	go func() {
+		defer n.loops.Done()
+		n.notifyWork(ctx)
+	}()
+
+	if !n.miningAddress.IsZero() {
+		n.loops.Add(1)
+		go func() {
+			defer n.loops.Done()
+			n.mineLoop(ctx)
+		}()
+	}
+
+	// send version to known nodes to get the latest blockchain
+	for _, node := range n.knownNodes.Peers() {
+		if node != n.address {
+			n.sendVersion(node)
+		}
+	}
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			select {
+			case <-n.quit:
+				return nil
+			default:
+				return err
+			}
+		}
+
+		n.handlers.Add(1)
+		go func() {
+			defer n.handlers.Done()
+			n.handleConnection(conn)
+		}()
+	}
+}
+
+// Stop stops accepting peers, closes the connections, aborts mining and waits for the connection
+// handlers and the background loops to return. It then saves the mempool and closes the blockchain
+// database.
+func (n *Node) Stop() {
+	n.stopOnce.Do(func() {
+		close(n.quit)
+
+		n.lock.Lock()
+		if n.cancel != nil {
+			n.cancel()
+		}
+
+		if n.listener != nil {
+			n.listener.Close()
+		}
+
+		if n.debugListener != nil {
+			n.debugListener.Close()
+		}
+
+		if n.rpcListener != nil {
+			n.rpcListener.Close()
+		}
+		n.lock.Unlock()
+
+		n.connsLock.Lock()
+		for conn := range n.conns {
+			conn.Close()
+		}
+		n.connsLock.Unlock()
+
+		n.pool.Close()
+
+		n.handlers.Wait()
+		n.loops.Wait()
+
+		err := n.mempool.SaveToFile(n.config.NodeID)
+		if err != nil {
+			n.logger.Error("Failed to save the mempool", "err", err)
+		}
+
+		n.bc.CloseDB()
+	})
+}
+
+// handleConnection handles the messages of a connection, in order, until the peer closes it. The
+// connection is closed at once if the node has too many open, and once its peer is throttled.
+func (n *Node) handleConnection(conn net.Conn) {
+	if !n.trackInbound(conn) {
+		n.logger.Debug("Refused connection, too many open", "remote", conn.RemoteAddr(), "max", n.config.MaxInbound)
+		conn.Close()
+		return
+	}
+
+	defer func() {
+		n.untrackInbound(conn)
+		conn.Close()
+	}()
+
+	host := remoteHost(conn)
+	var s session
+
+	// Stop may have closed the open connections before this one was recorded
+	select {
+	case <-n.quit:
+		return
+	default:
+	}
+
+	for {
+		err := conn.SetReadDeadline(time.Now().Add(n.config.ReadTimeout))
+		if err != nil {
+			n.logger.Warn("Failed to set the read deadline", "err", err)
+			return
+		}
+
+		request, err := readMessage(conn)
+		if err == io.EOF {
+			return
+		}
+		// An idle peer is dropped quietly, it connects again when it has something to send
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			return
+		}
+		if err != nil {
+			select {
+			case <-n.quit:
+			default:
+				n.logger.Warn("Failed to read message", "remote", conn.RemoteAddr(), "err", err)
+			}
+			return
+		}
+
+		if len(request) < commandLength {
+			n.logger.Warn("Received a truncated message", "remote", conn.RemoteAddr(), "err", errors.ErrUnknownCommand)
+			return
+		}
+
+		if !n.limiter.Allow(host, time.Now()) {
+			metrics.Add("messages_throttled", 1)
+			n.logger.Warn("Throttled peer, too many messages", "remote", conn.RemoteAddr(), "max", n.config.MaxMessageRate)
+			return
+		}
+
+		n.handleMessage(request, conn, &s)
+	}
+}
+
+// session is the state of an inbound connection. The peer is bound to the connection once its
+// version message is verified, so the address a message claims to come from is not trusted.
+type session struct {
+	verified bool   // whether a version message was verified on the connection
+	addr     string // the address of the peer, empty for a client that does not listen
+}
+
+// bind records that the version message of the peer at addr was verified on the connection
+func (s *session) bind(addr string) {
+	s.verified = true
+	s.addr = addr
+}
+
+// handleMessage handles a message received on a connection
+func (n *Node) handleMessage(request []byte, conn net.Conn, s *session) {
+	command := bytesToCommand(request[:commandLength])
+	sender := s.addr
+	n.logger.Debug("Received command", "command", command, "peer", sender, "remote", conn.RemoteAddr())
+
+	// Only the handshake is accepted over a connection the peer was not verified on, and the
+	// read-only requests of the local clients, which are answered over the connection itself
+	switch command {
+	case "version", "getpeers", "getmerkleproof", "getmempool":
+	default:
+		if !s.verified {
+			n.logger.Warn("Dropped command", "command", command, "remote", conn.RemoteAddr(), "err", errors.ErrHandshakeIncomplete)
+			return
+		}
+
+		if !n.isAuthenticated(s.addr) {
+			n.logger.Warn("Dropped command", "command", command, "peer", sender, "err", errors.ErrPeerNotAllowed)
+			return
+		}
+	}
+
+	// A verified peer cannot speak for another address
+	if claimed := senderOf(request); s.verified && claimed != "" && claimed != s.addr {
+		n.logger.Warn("Dropped command", "command", command, "peer", sender, "claimed", claimed, "err", errors.ErrPeerNotAllowed)
+		return
+	}
+	n.knownNodes.Seen(sender)
+
+	// Blocks are only exchanged with peers on the same chain
+	switch command {
+	case "inv", "getblocks", "getheaders", "headers", "getdata", "block":
+		if !n.hasHandshake(sender) {
+			n.logger.Warn("Dropped command", "command", command, "peer", sender, "err", errors.ErrHandshakeIncomplete)
+			return
+		}
+	}
+
+	var err error
+	switch command {
+	case "addr":
+		err = n.handleAddr(request)
+	case "block":
+		err = n.handleBlock(request)
+	case "inv":
+		err = n.handleInv(request)
+	case "getblocks":
+		err = n.handleGetBlocks(request)
+	case "getheaders":
+		err = n.handleGetHeaders(request)
+	case "headers":
+		err = n.handleHeaders(request)
+	case "getdata":
+		err = n.handleGetData(request)
+	case "tx":
+		err = n.handleTx(request, conn)
+	case "version":
+		err = n.handleVersion(request, s)
+	case "verack":
+		err = n.handleVerack(request)
+	case "reject":
+		err = n.handleReject(request)
+	case "ping":
+		err = n.handlePing(request)
+	case "pong":
+		err = n.handlePong(request)
+	case "getpeers":
+		err = n.handleGetPeers(conn)
+	case "getmerkleproof":
+		err = n.handleGetMerkleProof(request, conn)
+	case "getmempool":
+		err = n.handleGetMempool(request, conn)
+	default:
+		err = errors.ErrUnknownCommand
+	}
+	if err != nil {
+		n.logger.Warn("Failed to handle command", "command", command, "peer", sender, "err", err)
+	}
+}
+
+// senderOf returns the address a message claims to come from
+func senderOf(request []byte) string {
+	var payload struct {
+		AddrFrom string
+	}
+
+	dec := gob.NewDecoder(bytes.NewReader(request[commandLength:]))
+	err := dec.Decode(&payload)
+	if err != nil {
+		return ""
+	}
+
+	return payload.AddrFrom
+}
+
+// sendData sends data to a node over the connection pool, forgetting the node if it cannot be
+// reached
+func (n *Node) sendData(addr string, data []byte) error {
+	err := n.pool.Send(addr, data)
+	if _, ok := err.(*net.OpError); ok || errors.Is(err, errors.ErrPeerBackoff) {
+		n.logger.Info("Peer is not available, forgetting it", "peer", addr)
+		n.knownNodes.RemovePeer(addr)
+	}
+
+	return errors.Wrapf(err, "peer %s", addr)
+}
+
+// writeData sends data to a node over a connection of its own
+func writeData(addr string, data []byte) error {
+	conn, err := net.DialTimeout(protocol, addr, DefaultTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	err = conn.SetWriteDeadline(time.Now().Add(DefaultTimeout))
+	if err != nil {
+		return err
+	}
+
+	return writeMessage(conn, data)
+}
+
+// requestData sends data to a node over a connection of its own and waits for its reply, which
+// may take as long as the node needs
+func requestData(addr string, data []byte) ([]byte, error) {
+	conn, err := net.DialTimeout(protocol, addr, DefaultTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	err = conn.SetWriteDeadline(time.Now().Add(DefaultTimeout))
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeMessage(conn, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return readMessage(conn)
+}
+
+// SendTransaction puts a transaction in the mempool and announces it to every known peer, which
+// fetch it with getdata.
+func (n *Node) SendTransaction(tnx *transaction.Transaction) error {
+	fee, err := n.bc.TransactionFee(tnx)
+	if err != nil {
+		return err
+	}
+
+	return n.submitTransaction(tnx, fee)
+}
+
+// Client talks to the network without running a node, on behalf of the wallet of a node
+type Client struct {
+	nodeAddress string   // the address of the local node, which mines on demand
+	seeds       []string // the nodes transactions are sent to
+	network     string   // the network of the seeds
+}
+
+// NewClient creates a client for the local node at nodeAddress, sending transactions to the seeds
+// of the network.
+func NewClient(nodeAddress string, seeds []string, network string) *Client {
+	return &Client{
+		nodeAddress: nodeAddress,
+		seeds:       seeds,
+		network:     network,
+	}
+}
+
+// SendTransaction sends a transaction to every seed of the chain with the given genesis block. A
+// client cannot answer getdata, so the transaction itself is sent rather than announced, after a
+// version message the seed verifies the connection with. Every seed is given rejectWait to reject
+// the transaction, and the first reject is returned as an ErrRejected error. Otherwise it succeeds
+// if at least one seed received it, and the error of the last one is returned if none did.
+func (c *Client) SendTransaction(tnx *transaction.Transaction, genesis []byte) error {
+	version, err := c.versionRequest(genesis)
+	if err != nil {
+		return err
+	}
+
+	request, err := txRequest("", tnx)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	sent := false
+	for _, seed := range c.seeds {
+		reject, err := sendAwaitingReject(seed, version, request)
+		if err != nil {
+			lastErr = errors.Wrapf(err, "peer %s", seed)
+			continue
+		}
+
+		if reject != nil {
+			return errors.Wrapf(reject.Err(), "peer %s", seed)
+		}
+
+		sent = true
+	}
+
+	if !sent {
+		return lastErr
+	}
+
+	return nil
+}
+
+// versionRequest returns the version message of the client, which has no address nor identity
+func (c *Client) versionRequest(genesis []byte) ([]byte, error) {
+	magic, err := NetworkMagic(c.network)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := randomNonce()
+	if err != nil {
+		return nil, err
+	}
+
+	version := Version{nodeVersion, 0, "", nonce, time.Now().Unix(), nil, nil, magic, genesis, 0, minPeerVersion}
+	payload, err := util.GobEncode(version)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(commandToBytes("version"), payload...), nil
+}
+
+// sendAwaitingReject sends a version message then data to a node over a connection of its own, and
+// returns the reject the node replied with, if any
+func sendAwaitingReject(addr string, version, data []byte) (*Reject, error) {
+	conn, err := net.DialTimeout(protocol, addr, DefaultTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	err = conn.SetWriteDeadline(time.Now().Add(DefaultTimeout))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, message := range [][]byte{version, data} {
+		err = writeMessage(conn, message)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return awaitReject(conn), nil
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/yanglinshu/glock/internal/util"
+)
+
+// exchange sends messages to a node over a connection of its own, then waits for the reply to a
+// getpeers request, which the node answers once it handled the messages before it
+func exchange(t *testing.T, n *Node, messages ...[]byte) {
+	t.Helper()
+
+	conn, err := net.DialTimeout(protocol, n.Address(), DefaultTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	payload, err := util.GobEncode(GetPeers{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages = append(messages, append(commandToBytes("getpeers"), payload...))
+
+	for _, message := range messages {
+		err = writeMessage(conn, message)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = conn.SetReadDeadline(time.Now().Add(DefaultTimeout))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = readMessage(conn)
+	if err != nil {
+		t.Fatalf("reading the getpeers reply: %v", err)
+	}
+}
+
+func TestCommandsBeforeVersionDropped(t *testing.T) {
+	tn := newTestNetwork(t, 1)
+	a := tn.addNode(Config{})
+
+	tx := tn.payment(a, 5, 1)
+	request, err := txRequest("", tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exchange(t, a, request)
+	if _, ok := a.mempool.Get(tx.ID); ok {
+		t.Fatal("a transaction sent before the handshake reached the mempool")
+	}
+
+	// The same transaction is accepted once the connection is verified
+	version, err := NewClient("", nil, DefaultNetwork).versionRequest(a.genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exchange(t, a, version, request)
+	if _, ok := a.mempool.Get(tx.ID); !ok {
+		t.Fatal("a transaction sent after the handshake did not reach the mempool")
+	}
+}
+
+func TestVerifiedConnectionCannotSpeakForAnotherPeer(t *testing.T) {
+	tn := newTestNetwork(t, 1)
+	a := tn.addNode(Config{})
+	b := tn.addNode(Config{})
+
+	version, err := NewClient("", nil, DefaultNetwork).versionRequest(a.genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The connection was verified for a client, not for b
+	tx := tn.payment(a, 5, 1)
+	request, err := txRequest(b.Address(), tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exchange(t, a, version, request)
+	if _, ok := a.mempool.Get(tx.ID); ok {
+		t.Fatal("a transaction claiming to come from another peer reached the mempool")
+	}
+}
+
+func TestVersionOfAnotherChainRejected(t *testing.T) {
+	tn := newTestNetwork(t, 1)
+	a := tn.addNode(Config{})
+
+	version, err := NewClient("", nil, DefaultNetwork).versionRequest([]byte("another genesis"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := tn.payment(a, 5, 1)
+	request, err := txRequest("", tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exchange(t, a, version, request)
+	if _, ok := a.mempool.Get(tx.ID); ok {
+		t.Fatal("a transaction sent after a version of another chain reached the mempool")
+	}
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"bytes"
+	"sync"
+	"time"
+)
+
+// syncBatch tracks the batch of blocks being downloaded after a headers or an inv command
+type syncBatch struct {
+	peer      string     // the peer to ask for the next batch once the blocks arrived, empty if none
+	last      []byte     // the hash of the last block of the batch
+	getBlocks bool       // whether the next batch is asked for with getblocks rather than getheaders
+	started   time.Time  // when the blocks of the batch were asked for
+	lock      sync.Mutex // guards the sync state
+}
+
+// downloadBatch downloads the blocks of a batch the node is missing, in chain order. If the batch
+// is full, the peer is asked for the next one once the blocks arrived, with getblocks or
+// getheaders.
+func (n *Node) downloadBatch(addr string, hashes [][]byte, full, getBlocks bool) error {
+	var missing [][]byte
+	for _, hash := range hashes {
+		ok, err := n.bc.HasBlock(hash)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			missing = append(missing, hash)
+		}
+	}
+
+	if len(missing) == 0 {
+		if full {
+			return n.requestBatch(addr, getBlocks)
+		}
+		return nil
+	}
+
+	n.batch.lock.Lock()
+	// The same batch may be announced by an inv and a headers command at once, as after a version
+	// message opening a connection, and is only downloaded once unless it stalled
+	if bytes.Equal(n.batch.last, hashes[len(hashes)-1]) && time.Since(n.batch.started) < n.config.ReadTimeout {
+		n.batch.lock.Unlock()
+		return nil
+	}
+	n.batch.started = time.Now()
+	n.batch.peer = ""
+	if full {
+		n.batch.peer = addr
+	}
+	n.batch.last = hashes[len(hashes)-1]
+	n.batch.getBlocks = getBlocks
+	n.batch.lock.Unlock()
+
+	n.blocksInTransit.Reset(missing, missing[0])
+	return n.sendGetData(addr, "block", missing[0])
+}
+
+// continueSync asks for the next batch once the blocks of a full batch arrived
+func (n *Node) continueSync() error {
+	n.batch.lock.Lock()
+	peer, last, getBlocks := n.batch.peer, n.batch.last, n.batch.getBlocks
+	n.batch.peer = ""
+	n.batch.lock.Unlock()
+
+	if peer == "" {
+		return nil
+	}
+
+	// Asking again for a batch whose blocks were rejected would loop forever
+	ok, err := n.bc.HasBlock(last)
+	if err != nil || !ok {
+		return err
+	}
+
+	return n.requestBatch(peer, getBlocks)
+}
+
+// requestBatch asks a peer for the batch following the tip of the node
+func (n *Node) requestBatch(addr string, getBlocks bool) error {
+	if getBlocks {
+		return n.sendGetBlocks(addr)
+	}
+
+	return n.sendGetHeaders(addr)
+}
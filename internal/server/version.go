@@ -1,110 +1,340 @@
-package server
-
-import (
-	"bytes"
-	"encoding/gob"
-	"log"
-
-	"github.com/yanglinshu/glock/internal/blockchain"
-	"github.com/yanglinshu/glock/internal/util"
-)
-
-// nodeVersion is the current version of the node
-const nodeVersion = 1
-
-// Version is the version of the node
-type Version struct {
-	Version    int    // version of the node
-	BestHeight int    // the best height of the blockchain
-	AddrFrom   string // the address of the node
-}
-
-// handleVersion handles the version command
-func handleVersion(request []byte, bc *blockchain.Blockchain) error {
-	var buff bytes.Buffer
-	var payload Version
-
-	buff.Write(request[commandLength:])
-	dec := gob.NewDecoder(&buff)
-	err := dec.Decode(&payload)
-	if err != nil {
-		return err
-	}
-
-	myBestHeight, err := bc.GetBestHeight()
-	if err != nil {
-		return err
-	}
-
-	foreignerBestHeight := payload.BestHeight
-
-	if myBestHeight < foreignerBestHeight {
-		sendGetBlocks(payload.AddrFrom)
-	} else if myBestHeight > foreignerBestHeight {
-		sendVersion(payload.AddrFrom, bc)
-	}
-
-	if !nodeIsKnown(payload.AddrFrom) {
-		knownNodes = append(knownNodes, payload.AddrFrom)
-	}
-
-	return nil
-}
-
-// handleConnection handles the connection
-func sendVersion(addr string, bc *blockchain.Blockchain) error {
-	bestHeight, err := bc.GetBestHeight()
-	if err != nil {
-		return err
-	}
-
-	payload, err := util.GobEncode(Version{nodeVersion, bestHeight, nodeAddress})
-	if err != nil {
-		return err
-	}
-
-	request := append(commandToBytes("version"), payload...)
-
-	sendData(addr, request)
-	return nil
-}
-
-type Addr struct {
-	AddrList []string
-}
-
-// sendAddr sends the address
-func sendAddr(addr string) error {
-	nodes := Addr{knownNodes}
-	nodes.AddrList = append(nodes.AddrList, nodeAddress)
-	payload, err := util.GobEncode(nodes)
-	if err != nil {
-		return err
-	}
-
-	request := append(commandToBytes("addr"), payload...)
-
-	err = sendData(addr, request)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// handleAddr handles the address
-func handleAddr(request []byte) error {
-	var buff bytes.Buffer
-	var payload Addr
-
-	buff.Write(request[commandLength:])
-	dec := gob.NewDecoder(&buff)
-	err := dec.Decode(&payload)
-	if err != nil {
-		return err
-	}
-
-	knownNodes = append(knownNodes, payload.AddrList...)
-	log.Printf("There are %d known nodes now", len(knownNodes))
-	return nil
-}
+package server
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"time"
+
+	"github.com/yanglinshu/glock/internal/config"
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/util"
+)
+
+// nodeVersion is the current version of the node
+const nodeVersion = 2
+
+// minPeerVersion is the lowest version of the peers the node talks to
+const minPeerVersion = 1
+
+// capabilitiesVersion is the first version whose version message carries the services of the node
+// and the lowest version of the peers it talks to
+const capabilitiesVersion = 2
+
+// Services is a bitfield of the capabilities of a node, advertised in its version message
+type Services uint64
+
+// The services a node may offer
+const (
+	ServiceBlocks  Services = 1 << iota // serves blocks with getblocks and getdata
+	ServiceHeaders                      // serves headers with getheaders, for headers-first sync
+)
+
+// localServices are the services offered by the node
+const localServices = ServiceBlocks | ServiceHeaders
+
+// Has checks whether the bitfield holds every given service.
+func (s Services) Has(service Services) bool {
+	return s&service == service
+}
+
+// The magic numbers of the networks, which keep nodes of different networks apart
+const (
+	MagicMainnet uint32 = 0x676c6f6b
+	MagicTestnet uint32 = 0x746c6f6b
+	MagicDev     uint32 = 0x646c6f6b
+)
+
+// DefaultNetwork is the network a node joins unless configured otherwise
+const DefaultNetwork = config.DefaultNetwork
+
+// NetworkMagic returns the magic number of the network with the given name.
+func NetworkMagic(network string) (uint32, error) {
+	switch network {
+	case "mainnet":
+		return MagicMainnet, nil
+	case "testnet":
+		return MagicTestnet, nil
+	case "dev":
+		return MagicDev, nil
+	default:
+		return 0, errors.ErrUnknownNetwork
+	}
+}
+
+// Version is the version of the node
+type Version struct {
+	Version    int      // version of the node
+	BestHeight int      // the best height of the blockchain
+	AddrFrom   string   // the address of the node
+	Nonce      uint64   // random value identifying the handshake, also telling a node its own handshakes
+	Timestamp  int64    // time the message was created
+	PublicKey  []byte   // identity of the node
+	Signature  []byte   // signature of the handshake by the identity of the node
+	Magic      uint32   // the magic number of the network of the node
+	Genesis    []byte   // the hash of the genesis block of the node
+	Services   Services // the services offered by the node, from capabilitiesVersion on
+	MinVersion int      // the lowest version of the peers the node talks to, from capabilitiesVersion on
+}
+
+// services returns the services offered by the node sending a version message. Nodes older than
+// capabilitiesVersion do not advertise them and only serve blocks.
+func (v Version) services() Services {
+	if v.Version < capabilitiesVersion {
+		return ServiceBlocks
+	}
+
+	return v.Services
+}
+
+// Verack acknowledges a valid version message, completing the handshake
+type Verack struct {
+	AddrFrom string // the address of the node
+}
+
+// handleVersion handles the version command, binding the peer to the session of the connection it
+// came over once verified
+func (n *Node) handleVersion(request []byte, s *session) error {
+	var buff bytes.Buffer
+	var payload Version
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		return err
+	}
+
+	if n.isOwnNonce(payload.Nonce) || payload.AddrFrom == n.address {
+		return errors.ErrSelfConnection
+	}
+
+	if payload.Magic != n.magic || !bytes.Equal(payload.Genesis, n.genesis) {
+		n.knownNodes.RemovePeer(payload.AddrFrom)
+		return errors.ErrWrongNetwork
+	}
+
+	err = n.authenticateVersion(payload)
+	if err != nil {
+		return err
+	}
+
+	err = n.checkPeerVersion(payload)
+	if err != nil {
+		return err
+	}
+
+	s.bind(payload.AddrFrom)
+
+	// A client does not listen, it only talks over the connection it opened
+	if payload.AddrFrom == "" {
+		return nil
+	}
+
+	n.completeHandshake(payload.AddrFrom)
+	n.recordServices(payload.AddrFrom, payload.services())
+	err = n.sendVerack(payload.AddrFrom)
+	if err != nil {
+		return err
+	}
+
+	myBestHeight, err := n.bc.GetBestHeight()
+	if err != nil {
+		return err
+	}
+
+	foreignerBestHeight := payload.BestHeight
+
+	if myBestHeight < foreignerBestHeight {
+		n.requestBatch(payload.AddrFrom, !n.peerHas(payload.AddrFrom, ServiceHeaders))
+	} else if myBestHeight > foreignerBestHeight {
+		n.sendVersion(payload.AddrFrom)
+	}
+
+	n.knownNodes.AddPeer(payload.AddrFrom)
+
+	return nil
+}
+
+// sendVersion sends the version of the node to the given address
+func (n *Node) sendVersion(addr string) error {
+	request, err := n.versionRequest()
+	if err != nil {
+		return err
+	}
+
+	n.sendData(addr, request)
+	return nil
+}
+
+// versionRequest returns a version message of the node, signed by its identity
+func (n *Node) versionRequest() ([]byte, error) {
+	bestHeight, err := n.bc.GetBestHeight()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := randomNonce()
+	if err != nil {
+		return nil, err
+	}
+
+	version := Version{nodeVersion, bestHeight, n.address, nonce, time.Now().Unix(), nil, nil, n.magic, n.genesis, localServices, minPeerVersion}
+	n.recordNonce(version.Nonce)
+
+	err = n.signVersion(&version)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := util.GobEncode(version)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(commandToBytes("version"), payload...), nil
+}
+
+// checkPeerVersion drops a peer whose version is below minPeerVersion, telling it why with a reject
+// message, and a peer that requires a newer version than the node runs.
+func (n *Node) checkPeerVersion(v Version) error {
+	if v.Version >= minPeerVersion && v.MinVersion <= nodeVersion {
+		return nil
+	}
+
+	n.knownNodes.RemovePeer(v.AddrFrom)
+	n.pool.Remove(v.AddrFrom)
+
+	if v.MinVersion > nodeVersion {
+		return errors.Wrapf(errors.ErrObsoletePeer, "peer requires version %d, the node runs %d", v.MinVersion, nodeVersion)
+	}
+
+	reason := fmt.Sprintf("protocol version %d is below the minimum %d", v.Version, minPeerVersion)
+	n.sendReject(v.AddrFrom, Reject{Command: "version", Code: RejectObsolete, Reason: reason})
+	return errors.Wrapf(errors.ErrObsoletePeer, "%s", reason)
+}
+
+// sendVerack acknowledges the version message of the given address
+func (n *Node) sendVerack(addr string) error {
+	payload, err := util.GobEncode(Verack{n.address})
+	if err != nil {
+		return err
+	}
+
+	request := append(commandToBytes("verack"), payload...)
+
+	return n.sendData(addr, request)
+}
+
+// handleVerack handles the verack command
+func (n *Node) handleVerack(request []byte) error {
+	var buff bytes.Buffer
+	var payload Verack
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		return err
+	}
+
+	n.completeHandshake(payload.AddrFrom)
+	return nil
+}
+
+// recordNonce remembers the nonce of a version message sent by the node, forgetting the nonces too
+// old to be accepted anyway
+func (n *Node) recordNonce(nonce uint64) {
+	n.handshakesLock.Lock()
+	defer n.handshakesLock.Unlock()
+
+	for sent, at := range n.sentNonces {
+		if time.Since(at) > handshakeMaxAge {
+			delete(n.sentNonces, sent)
+		}
+	}
+	n.sentNonces[nonce] = time.Now()
+}
+
+// isOwnNonce checks whether a version message was sent by the node itself
+func (n *Node) isOwnNonce(nonce uint64) bool {
+	n.handshakesLock.Lock()
+	defer n.handshakesLock.Unlock()
+
+	_, ok := n.sentNonces[nonce]
+	return ok
+}
+
+// completeHandshake records that the handshake with a peer completed
+func (n *Node) completeHandshake(addr string) {
+	n.handshakesLock.Lock()
+	defer n.handshakesLock.Unlock()
+
+	n.handshakes[addr] = true
+}
+
+// recordServices records the services a peer advertised in its handshake
+func (n *Node) recordServices(addr string, services Services) {
+	n.handshakesLock.Lock()
+	defer n.handshakesLock.Unlock()
+
+	n.peerServices[addr] = services
+}
+
+// peerHas checks whether a peer advertised every given service in its handshake
+func (n *Node) peerHas(addr string, service Services) bool {
+	n.handshakesLock.Lock()
+	defer n.handshakesLock.Unlock()
+
+	return n.peerServices[addr].Has(service)
+}
+
+// hasHandshake checks whether the handshake with a peer completed
+func (n *Node) hasHandshake(addr string) bool {
+	n.handshakesLock.Lock()
+	defer n.handshakesLock.Unlock()
+
+	return n.handshakes[addr]
+}
+
+type Addr struct {
+	AddrList []string
+}
+
+// sendAddr sends the address
+func (n *Node) sendAddr(addr string) error {
+	nodes := Addr{n.knownNodes.Peers()}
+	nodes.AddrList = append(nodes.AddrList, n.address)
+	payload, err := util.GobEncode(nodes)
+	if err != nil {
+		return err
+	}
+
+	request := append(commandToBytes("addr"), payload...)
+
+	err = n.sendData(addr, request)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// handleAddr handles the address
+func (n *Node) handleAddr(request []byte) error {
+	var buff bytes.Buffer
+	var payload Addr
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		return err
+	}
+
+	for _, addr := range payload.AddrList {
+		n.knownNodes.AddPeer(addr)
+	}
+	n.logger.Debug("Received addresses", "addresses", len(payload.AddrList), "known", len(n.knownNodes.Peers()))
+	return nil
+}
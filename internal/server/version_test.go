@@ -0,0 +1,293 @@
+package server
+
+import (
+	"bytes"
+	"encoding/gob"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yanglinshu/glock/internal/blockchain"
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/logger"
+	"github.com/yanglinshu/glock/internal/transaction"
+	"github.com/yanglinshu/glock/internal/util"
+)
+
+func TestVersionFromSelfIgnored(t *testing.T) {
+	tn := newTestNetwork(t, 0)
+	a := tn.addNode(Config{})
+	b := tn.addNode(Config{})
+
+	// The handshake of the node itself, and one carrying its nonce from another address as when
+	// it dials itself through a forwarded port
+	own := signedVersion(t, a)
+	forwarded := own
+	forwarded.AddrFrom = b.Address()
+	resign(t, &forwarded, a.identity)
+
+	for name, v := range map[string]Version{"own": own, "forwarded": forwarded} {
+		err := a.handleVersion(versionMessage(t, v), &session{})
+		if !errors.Is(err, errors.ErrSelfConnection) {
+			t.Fatalf("handling its %s handshake = %v, want ErrSelfConnection", name, err)
+		}
+	}
+
+	if a.hasHandshake(b.Address()) || a.knownNodes.IsKnown(b.Address()) {
+		t.Fatal("a self-connection was taken for a peer")
+	}
+}
+
+func TestVersionFromOtherNetworkDropped(t *testing.T) {
+	tn := newTestNetwork(t, 0)
+	a := tn.addNode(Config{})
+	b := tn.addNode(Config{})
+
+	forgeries := map[string]func(v *Version){
+		"another magic":   func(v *Version) { v.Magic = MagicTestnet },
+		"another genesis": func(v *Version) { v.Genesis = make([]byte, len(v.Genesis)) },
+		"no genesis":      func(v *Version) { v.Genesis = nil },
+	}
+
+	for name, forge := range forgeries {
+		a.knownNodes.AddPeer(b.Address())
+
+		v := signedVersion(t, b)
+		forge(&v)
+		resign(t, &v, b.identity)
+
+		s := &session{}
+		err := a.handleVersion(versionMessage(t, v), s)
+		if !errors.Is(err, errors.ErrWrongNetwork) {
+			t.Fatalf("handling a handshake with %s = %v, want ErrWrongNetwork", name, err)
+		}
+
+		if s.verified || a.hasHandshake(b.Address()) || a.knownNodes.IsKnown(b.Address()) {
+			t.Fatalf("a peer with %s was kept", name)
+		}
+	}
+}
+
+func TestHandshakeCompletesWithVerack(t *testing.T) {
+	tn := newTestNetwork(t, 0)
+	a := tn.addNode(Config{})
+	b := tn.addNode(Config{}, a)
+
+	// a completes the handshake on the version of b, b on the verack of a
+	tn.waitFor("the handshake to complete", func() bool {
+		return a.hasHandshake(b.Address()) && b.hasHandshake(a.Address())
+	})
+
+	_, err := a.generate(2, tn.address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tn.waitHeight(2, a, b)
+}
+
+func TestNetworkMagic(t *testing.T) {
+	magics := make(map[uint32]bool)
+	for _, network := range []string{"mainnet", "testnet", "dev"} {
+		magic, err := NetworkMagic(network)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if magics[magic] {
+			t.Fatalf("network %s shares its magic %x", network, magic)
+		}
+		magics[magic] = true
+	}
+
+	_, err := NetworkMagic("regtest2")
+	if !errors.Is(err, errors.ErrUnknownNetwork) {
+		t.Fatalf("NetworkMagic of an unknown network = %v, want ErrUnknownNetwork", err)
+	}
+}
+
+func TestNodesOfTwoNetworksInOneProcess(t *testing.T) {
+	tn := newTestNetwork(t, 0)
+	mainnet := tn.addNode(Config{})
+
+	// A testnet node beside it, on a chain of its own paying the same key
+	testnetAddress := transaction.NewAddress(tn.address.PubKeyHash(), transaction.Testnet)
+	params := blockchain.GenesisConfig{Network: "testnet", TargetBits: testTargetBits, Timestamp: testGenesisTime}
+	bc, err := blockchain.CreateBlockchain(testnetAddress, "testnet", params, blockchain.Config{RetargetInterval: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc.CloseDB()
+
+	cfg := Config{NodeID: "testnet", Network: "testnet", ListenAddr: "127.0.0.1:0", Seeds: []string{}, Logger: logger.Nop()}
+
+	cfg.MinerAddress = tn.address.String()
+	_, err = NewNode(cfg)
+	if !errors.Is(err, errors.ErrInvalidAddress) {
+		t.Fatalf("testnet node mining to a mainnet address = %v, want ErrInvalidAddress", err)
+	}
+
+	cfg.MinerAddress = testnetAddress.String()
+	testnet, err := NewNode(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(testnet.Stop)
+
+	// Starting the testnet node leaves the addresses accepted by the mainnet one as they were
+	for _, tt := range []struct {
+		n          *Node
+		own, other transaction.Address
+	}{
+		{mainnet, tn.address, testnetAddress},
+		{testnet, testnetAddress, tn.address},
+	} {
+		if _, err := tt.n.parseAddress(tt.own.String()); err != nil {
+			t.Fatalf("node %s rejects its own address %s: %v", tt.n.config.NodeID, tt.own, err)
+		}
+
+		if _, err := tt.n.parseAddress(tt.other.String()); err == nil {
+			t.Fatalf("node %s accepts %s of another network", tt.n.config.NodeID, tt.other)
+		}
+	}
+}
+
+// legacyVersion is the version message of the nodes before capabilitiesVersion, which carries
+// neither their services nor the lowest version of the peers they talk to
+type legacyVersion struct {
+	Version    int
+	BestHeight int
+	AddrFrom   string
+	Nonce      uint64
+	Timestamp  int64
+	Magic      uint32
+	Genesis    []byte
+}
+
+// legacyVersionMessage encodes the version message of an old peer listening on addr, of the network
+// of the node and ahead of it
+func legacyVersionMessage(t *testing.T, n *Node, version int, addr string) []byte {
+	t.Helper()
+
+	v := legacyVersion{version, 5, addr, 42, time.Now().Unix(), n.magic, n.genesis}
+	payload, err := util.GobEncode(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return append(commandToBytes("version"), payload...)
+}
+
+// receiveCommand waits for the listener to read a message with the given command, skipping the
+// others, and returns its payload
+func (l *countingListener) receiveCommand(t *testing.T, command string) []byte {
+	t.Helper()
+
+	for {
+		message := l.receive(t)
+		if bytesToCommand(message[:commandLength]) == command {
+			return message[commandLength:]
+		}
+	}
+}
+
+func TestOldPeerSyncedWithGetBlocks(t *testing.T) {
+	tn := newTestNetwork(t, 0)
+	a := tn.addNode(Config{})
+	old := listen(t)
+	addr := old.Addr().String()
+
+	err := a.handleVersion(legacyVersionMessage(t, a, capabilitiesVersion-1, addr), &session{})
+	if err != nil {
+		t.Fatalf("handling the handshake of a version %d peer: %v", capabilitiesVersion-1, err)
+	}
+
+	// The old peer only serves blocks, so it is asked for blocks rather than headers
+	if !a.peerHas(addr, ServiceBlocks) || a.peerHas(addr, ServiceHeaders) {
+		t.Fatal("the old peer was taken to serve headers")
+	}
+
+	old.receiveCommand(t, "verack")
+	if command := bytesToCommand(old.receive(t)[:commandLength]); command != "getblocks" {
+		t.Fatalf("the old peer was sent %s, want getblocks", command)
+	}
+
+	if !a.hasHandshake(addr) || !a.knownNodes.IsKnown(addr) {
+		t.Fatal("the old peer was not kept")
+	}
+}
+
+func TestNewPeerSyncedWithGetHeaders(t *testing.T) {
+	tn := newTestNetwork(t, 0)
+	a := tn.addNode(Config{})
+	b := tn.addNode(Config{})
+	peer := listen(t)
+	addr := peer.Addr().String()
+
+	v := signedVersion(t, b)
+	v.AddrFrom = addr
+	v.BestHeight = 5
+	resign(t, &v, b.identity)
+
+	err := a.handleVersion(versionMessage(t, v), &session{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !a.peerHas(addr, localServices) {
+		t.Fatal("the services of the peer were not recorded")
+	}
+
+	peer.receiveCommand(t, "verack")
+	if command := bytesToCommand(peer.receive(t)[:commandLength]); command != "getheaders" {
+		t.Fatalf("a peer serving headers was sent %s, want getheaders", command)
+	}
+}
+
+func TestObsoletePeerRejected(t *testing.T) {
+	tn := newTestNetwork(t, 0)
+	a := tn.addNode(Config{})
+	old := listen(t)
+	addr := old.Addr().String()
+
+	a.knownNodes.AddPeer(addr)
+	err := a.handleVersion(legacyVersionMessage(t, a, minPeerVersion-1, addr), &session{})
+	if !errors.Is(err, errors.ErrObsoletePeer) {
+		t.Fatalf("handling the handshake of a version %d peer = %v, want ErrObsoletePeer", minPeerVersion-1, err)
+	}
+
+	// The peer is told why before it is dropped
+	var reject Reject
+	err = gob.NewDecoder(bytes.NewReader(old.receiveCommand(t, "reject"))).Decode(&reject)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reject.Command != "version" || reject.Code != RejectObsolete || !strings.Contains(reject.Reason, "below the minimum") {
+		t.Fatalf("reject = %+v, want the version refused as obsolete", reject)
+	}
+
+	if a.hasHandshake(addr) || a.knownNodes.IsKnown(addr) {
+		t.Fatal("an obsolete peer was kept")
+	}
+}
+
+func TestPeerRequiringNewerVersionDropped(t *testing.T) {
+	tn := newTestNetwork(t, 0)
+	a := tn.addNode(Config{})
+	b := tn.addNode(Config{})
+
+	v := signedVersion(t, b)
+	v.Version = nodeVersion + 1
+	v.MinVersion = nodeVersion + 1
+	resign(t, &v, b.identity)
+
+	a.knownNodes.AddPeer(b.Address())
+	err := a.handleVersion(versionMessage(t, v), &session{})
+	if !errors.Is(err, errors.ErrObsoletePeer) {
+		t.Fatalf("handling the handshake of a peer requiring version %d = %v, want ErrObsoletePeer", v.MinVersion, err)
+	}
+
+	if a.hasHandshake(b.Address()) || a.knownNodes.IsKnown(b.Address()) {
+		t.Fatal("a peer requiring a newer version was kept")
+	}
+}
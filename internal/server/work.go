@@ -0,0 +1,231 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/yanglinshu/glock/internal/block"
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/events"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// DefaultWorkFeeDelta is the fees the mempool must gain since the last work pushed to the miners
+// for fresh work to be pushed without a new tip
+const DefaultWorkFeeDelta = 10
+
+// maxWorkTemplates is the number of templates on the current tip remembered for submission, the
+// oldest being forgotten first
+const maxWorkTemplates = 1024
+
+// workEventBuffer is the number of events the work notifier may lag behind
+const workEventBuffer = 64
+
+// Work is a block template handed to an external miner, as getblocktemplate does. Once the block is
+// mined, it goes back to the node with SubmitWork along with its template ID.
+type Work struct {
+	TemplateID string       // the ID of the template, to echo in SubmitWork
+	Block      *block.Block // the unmined block
+	Clean      bool         // whether the tip moved, making the work handed out before stale
+}
+
+// workState tracks the templates handed out to external miners and the subscribers pushed fresh work
+type workState struct {
+	templates   map[string][]byte                 // the tip every remembered template builds on, by ID
+	order       []string                          // the IDs of the remembered templates, the oldest first
+	next        uint64                            // the number of the next template
+	subscribers map[chan Work]transaction.Address // the address the coinbase of every subscriber pays
+	lastTip     []byte                            // the tip of the work last pushed
+	lastFees    int                               // the fees of the mempool when work was last pushed
+	lock        sync.Mutex                        // guards the work state
+}
+
+// NewWork builds a template on top of the tip holding the valid transactions of the mempool, with
+// a coinbase paying address, and remembers its ID for SubmitWork.
+func (n *Node) NewWork(address transaction.Address) (Work, error) {
+	txs, err := n.transactionsToMine()
+	if err != nil {
+		return Work{}, err
+	}
+
+	template, err := n.bc.BuildBlockTemplate(txs, address)
+	if err != nil {
+		return Work{}, err
+	}
+
+	return Work{TemplateID: n.rememberTemplate(template), Block: template}, nil
+}
+
+// rememberTemplate returns the ID of a new template. The templates of former tips are forgotten, as
+// blocks mined from them can no longer extend the tip.
+func (n *Node) rememberTemplate(template *block.Block) string {
+	n.work.lock.Lock()
+	defer n.work.lock.Unlock()
+
+	if n.work.templates == nil {
+		n.work.templates = make(map[string][]byte)
+	}
+
+	var kept []string
+	for _, id := range n.work.order {
+		if bytes.Equal(n.work.templates[id], template.PrevBlockHash) {
+			kept = append(kept, id)
+		} else {
+			delete(n.work.templates, id)
+		}
+	}
+
+	if len(kept) >= maxWorkTemplates {
+		delete(n.work.templates, kept[0])
+		kept = kept[1:]
+	}
+
+	id := fmt.Sprintf("%d-%d", template.Height, n.work.next)
+	n.work.next++
+	n.work.templates[id] = template.PrevBlockHash
+	n.work.order = append(kept, id)
+
+	return id
+}
+
+// SubmitWork connects a block mined from the template with the given ID and announces it to the
+// known nodes. It returns ErrStaleBlock if the template is unknown or the tip has moved since it was
+// built, and the error of blockchain.SubmitBlock if the block is invalid.
+func (n *Node) SubmitWork(templateID string, bl *block.Block) error {
+	n.work.lock.Lock()
+	tip, ok := n.work.templates[templateID]
+	n.work.lock.Unlock()
+
+	if !ok || !bytes.Equal(tip, bl.PrevBlockHash) {
+		return errors.Wrapf(errors.ErrStaleBlock, "template %s", templateID)
+	}
+
+	err := n.submitBlock(bl)
+	if err != nil {
+		return errors.Wrapf(err, "template %s", templateID)
+	}
+
+	return nil
+}
+
+// SubscribeWork returns a channel receiving work paying address: a template right away, then a
+// fresh one whenever the tip moves or the mempool gains WorkFeeDelta in fees. A subscriber lagging
+// more than buffer templates behind misses the oldest ones, the last one pushed always being kept.
+func (n *Node) SubscribeWork(address transaction.Address, buffer int) (chan Work, error) {
+	work, err := n.NewWork(address)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan Work, buffer+1)
+	ch <- work
+
+	n.work.lock.Lock()
+	if n.work.subscribers == nil {
+		n.work.subscribers = make(map[chan Work]transaction.Address)
+	}
+	n.work.subscribers[ch] = address
+	n.work.lock.Unlock()
+
+	return ch, nil
+}
+
+// UnsubscribeWork stops pushing work to a channel returned by SubscribeWork and closes it
+func (n *Node) UnsubscribeWork(ch chan Work) {
+	n.work.lock.Lock()
+	defer n.work.lock.Unlock()
+
+	if _, ok := n.work.subscribers[ch]; ok {
+		delete(n.work.subscribers, ch)
+		close(ch)
+	}
+}
+
+// notifyWork pushes fresh work to the subscribers of SubscribeWork until the context is canceled:
+// clean work when the tip moves, and updated work when the mempool gained enough fees since the
+// work last pushed.
+func (n *Node) notifyWork(ctx context.Context) {
+	chainEvents := n.eventBus.Subscribe(workEventBuffer)
+	defer n.eventBus.Unsubscribe(chainEvents)
+
+	n.work.lock.Lock()
+	n.work.lastTip = n.bc.Tip()
+	n.work.lastFees = n.mempool.Fees()
+	n.work.lock.Unlock()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-chainEvents:
+		}
+
+		tip := n.bc.Tip()
+		fees := n.mempool.Fees()
+
+		n.work.lock.Lock()
+		if fees < n.work.lastFees {
+			n.work.lastFees = fees
+		}
+
+		clean := !bytes.Equal(tip, n.work.lastTip)
+		due := clean || fees-n.work.lastFees >= n.config.WorkFeeDelta
+		if due {
+			n.work.lastTip = tip
+			n.work.lastFees = fees
+		}
+		n.work.lock.Unlock()
+
+		if due {
+			n.pushWork(clean)
+		}
+	}
+}
+
+// pushWork builds a template for every address the subscribers mine to and pushes it to them. The
+// oldest work waiting for a subscriber lagging behind makes room for it, rather than blocking.
+func (n *Node) pushWork(clean bool) {
+	n.work.lock.Lock()
+	subscribers := make(map[chan Work]transaction.Address, len(n.work.subscribers))
+	for ch, address := range n.work.subscribers {
+		subscribers[ch] = address
+	}
+	n.work.lock.Unlock()
+
+	built := make(map[string]Work)
+	for ch, address := range subscribers {
+		work, ok := built[address.String()]
+		if !ok {
+			var err error
+			work, err = n.NewWork(address)
+			if err != nil {
+				n.logger.Error("Failed to build work for the miners", "err", err)
+				return
+			}
+			work.Clean = clean
+			built[address.String()] = work
+		}
+
+		n.work.lock.Lock()
+		if _, ok := n.work.subscribers[ch]; ok {
+			select {
+			case ch <- work:
+			default:
+				// The subscriber may take the oldest work meanwhile, either way there is room after
+				select {
+				case <-ch:
+				default:
+				}
+				ch <- work
+			}
+		}
+		n.work.lock.Unlock()
+	}
+}
+
+// publishTip tells the subscribers of the event bus that the tip moved to the block
+func (n *Node) publishTip(bl *block.Block) {
+	n.eventBus.Publish(events.Event{Kind: events.TipChanged, ID: bl.Hash})
+}
@@ -0,0 +1,219 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/yanglinshu/glock/internal/block"
+	"github.com/yanglinshu/glock/internal/blockchain"
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/transaction"
+)
+
+// nextWork waits for the next work pushed to a subscriber
+func nextWork(t *testing.T, ch chan Work) Work {
+	t.Helper()
+
+	select {
+	case work := <-ch:
+		return work
+	case <-time.After(waitTimeout):
+		t.Fatal("timed out waiting for work")
+		return Work{}
+	}
+}
+
+// wantNoWork checks that no work is pushed to a subscriber for a while
+func wantNoWork(t *testing.T, ch chan Work) {
+	t.Helper()
+
+	select {
+	case work := <-ch:
+		t.Fatalf("work %s was pushed, want none", work.TemplateID)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+// mineWork finds the proof-of-work of a copy of the block of the work, as an external miner does
+func mineWork(t *testing.T, work Work) *block.Block {
+	t.Helper()
+
+	bl := *work.Block
+	err := bl.Mine(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &bl
+}
+
+func TestStaleWorkRefused(t *testing.T) {
+	tn := newTestNetwork(t, 1)
+	a := tn.addNode(Config{})
+	miner := newAddress(t)
+
+	ch, err := a.SubscribeWork(miner, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.UnsubscribeWork(ch)
+
+	stale := nextWork(t, ch)
+	if stale.Clean || stale.Block.Height != 2 || !bytes.Equal(stale.Block.PrevBlockHash, a.bc.Tip()) {
+		t.Fatalf("first work at height %d, clean %t, want work on the tip at height 2", stale.Block.Height, stale.Clean)
+	}
+
+	// The tip moves while the miner works on the template, so clean work on the new tip is pushed
+	_, err = a.generate(1, tn.address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fresh := nextWork(t, ch)
+	if !fresh.Clean || fresh.Block.Height != 3 || !bytes.Equal(fresh.Block.PrevBlockHash, a.bc.Tip()) {
+		t.Fatalf("work after the tip moved at height %d, clean %t, want clean work on the tip at height 3", fresh.Block.Height, fresh.Clean)
+	}
+
+	// The block mined from the former template is refused, whichever template ID comes with it
+	tip := a.bc.Tip()
+	mined := mineWork(t, stale)
+	for _, id := range []string{stale.TemplateID, fresh.TemplateID, "unknown"} {
+		err = a.SubmitWork(id, mined)
+		if !errors.Is(err, errors.ErrStaleBlock) {
+			t.Fatalf("SubmitWork of a stale block with template %s = %v, want ErrStaleBlock", id, err)
+		}
+	}
+
+	if !bytes.Equal(a.bc.Tip(), tip) {
+		t.Fatal("a stale submission moved the tip")
+	}
+
+	// The block mined from the fresh template extends the chain, and the next work builds on it
+	mined = mineWork(t, fresh)
+	err = a.SubmitWork(fresh.TemplateID, mined)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(a.bc.Tip(), mined.Hash) {
+		t.Fatal("the submitted block is not the tip")
+	}
+
+	next := nextWork(t, ch)
+	if !next.Clean || next.Block.Height != 4 || !bytes.Equal(next.Block.PrevBlockHash, mined.Hash) {
+		t.Fatalf("work after the submitted block at height %d, clean %t, want clean work at height 4", next.Block.Height, next.Clean)
+	}
+
+	// A template is used once, its block becoming stale as soon as it is the tip
+	err = a.SubmitWork(fresh.TemplateID, mined)
+	if !errors.Is(err, errors.ErrStaleBlock) {
+		t.Fatalf("SubmitWork of the block already connected = %v, want ErrStaleBlock", err)
+	}
+}
+
+func TestWorkPushedOnMempoolFees(t *testing.T) {
+	tn := newTestNetwork(t, 1)
+	a := tn.addNode(Config{WorkFeeDelta: 3})
+
+	ch, err := a.SubscribeWork(newAddress(t), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.UnsubscribeWork(ch)
+	nextWork(t, ch)
+
+	from := fundedWallet(t, a)
+	if work := nextWork(t, ch); !work.Clean {
+		t.Fatal("the block funding the wallet did not push clean work")
+	}
+
+	// A payment whose fee is below the delta does not make fresh work worth pushing
+	err = a.submitTransaction(tn.payment(a, 1, 2), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantNoWork(t, ch)
+
+	// Together with another, the fees gained reach it
+	wallets, err := transaction.NewWallets(a.config.NodeID, a.network)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wallet, err := wallets.GetWallet(from)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	utxoSet := &blockchain.UTXOSet{Blockchain: a.bc}
+	tx, err := blockchain.NewUTXOTransaction(wallet, newAddress(t), 1, 1, nil, nil, utxoSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = a.submitTransaction(tx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	work := nextWork(t, ch)
+	if work.Clean || len(work.Block.Transactions) != 3 {
+		t.Fatalf("work after the fees grew holds %d transactions, clean %t, want the coinbase and both payments on the same tip", len(work.Block.Transactions), work.Clean)
+	}
+
+	// Work handed out before is still valid on the same tip
+	err = a.SubmitWork(work.TemplateID, mineWork(t, work))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.mempool.Len() != 0 {
+		t.Fatalf("the mempool holds %d transactions after the work was mined, want 0", a.mempool.Len())
+	}
+}
+
+func TestRPCSubmitBlockStaleWork(t *testing.T) {
+	tn := newTestNetwork(t, 1)
+	a := tn.addNode(Config{})
+
+	var template BlockTemplateResult
+	if err := rpcCall(t, a, "getblocktemplate", BlockTemplateParams{Address: tn.address.String()}, &template); err != nil {
+		t.Fatal(err)
+	}
+
+	encoded, err := hex.DecodeString(template.Hex)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bl, err := block.DeserializeTemplate(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mined := mineWork(t, Work{TemplateID: template.TemplateID, Block: bl})
+	encoded, err = mined.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another block takes the tip while the template is being mined
+	_, err = a.generate(1, tn.address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var hash string
+	rpcErr := rpcCall(t, a, "submitblock", SubmitBlockParams{TemplateID: template.TemplateID, Hex: hex.EncodeToString(encoded)}, &hash)
+	if rpcErr == nil || rpcErr.Code != RPCStaleWork {
+		t.Fatalf("submitblock of a stale block = %v, want code %d", rpcErr, RPCStaleWork)
+	}
+
+	var height int
+	if err := rpcCall(t, a, "getbestheight", nil, &height); err != nil || height != 2 {
+		t.Fatalf("getbestheight after the stale submission = %d, %v, want 2", height, err)
+	}
+}
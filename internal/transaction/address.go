@@ -0,0 +1,109 @@
+package transaction
+
+import (
+	"bytes"
+
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/util"
+)
+
+// addressChecksumLen is the length of the checksum in the address
+const addressChecksumLen = 4
+
+// Address is an address of a network: its version byte and what it locks outputs to, a public key
+// hash or the multisig script of a multisig address. Addresses are only made by
+// ParseAddress, which checks them, or from a hash with NewAddress, so an invalid address never
+// reaches the outputs of a transaction.
+type Address struct {
+	version byte   // version is the version byte of the address
+	hash    []byte // hash is the public key hash, or the multisig script
+}
+
+// ParseAddress parses an address of the network. An address that is not Base58 returns
+// ErrInvalidBase58, and one without the length, version or checksum of an address of the network
+// ErrInvalidAddress.
+func ParseAddress(address string, network Network) (Address, error) {
+	decoded, err := util.Base58Decode([]byte(address))
+	if err != nil {
+		return Address{}, err
+	}
+
+	if len(decoded) < 1+pubKeyHashSize+addressChecksumLen {
+		return Address{}, errors.ErrInvalidAddress
+	}
+
+	addressVersion := decoded[0]
+	if addressVersion != network.Version && addressVersion != network.MultisigVersion {
+		return Address{}, errors.ErrInvalidAddress
+	}
+
+	payload := decoded[:len(decoded)-addressChecksumLen]
+	if !bytes.Equal(decoded[len(payload):], checksum(payload)) {
+		return Address{}, errors.ErrInvalidAddress
+	}
+
+	hash := payload[1:]
+	if addressVersion == network.MultisigVersion && !IsMultisig(hash) {
+		return Address{}, errors.ErrInvalidAddress
+	}
+
+	if addressVersion == network.Version && len(hash) != pubKeyHashSize {
+		return Address{}, errors.ErrInvalidAddress
+	}
+
+	return Address{addressVersion, hash}, nil
+}
+
+// NewAddress returns the address on the network locking outputs to the given public key hash, or
+// the multisig address of a multisig script.
+func NewAddress(pubKeyHash []byte, network Network) Address {
+	if IsMultisig(pubKeyHash) {
+		return Address{network.MultisigVersion, pubKeyHash}
+	}
+
+	return Address{network.Version, pubKeyHash}
+}
+
+// PubKeyHash returns the public key hash the address locks outputs to, or the multisig script of a
+// multisig address.
+func (a Address) PubKeyHash() []byte {
+	return a.hash
+}
+
+// Version returns the version byte of the address.
+func (a Address) Version() byte {
+	return a.version
+}
+
+// IsMultisig checks whether the address locks outputs to several keys.
+func (a Address) IsMultisig() bool {
+	return IsMultisig(a.hash)
+}
+
+// IsZero checks whether the address is the zero value, which locks outputs to nothing.
+func (a Address) IsZero() bool {
+	return len(a.hash) == 0
+}
+
+// Equal checks whether two addresses lock outputs the same way.
+func (a Address) Equal(other Address) bool {
+	return a.version == other.version && bytes.Equal(a.hash, other.hash)
+}
+
+// String returns the address in Base58: the version byte, the hash and a checksum.
+func (a Address) String() string {
+	payload := append([]byte{a.version}, a.hash...)
+	return string(util.Base58Encode(append(payload, checksum(payload)...)))
+}
+
+// ValidateAddress checks whether the address is valid on the network, see ParseAddress.
+func ValidateAddress(address string, network Network) bool {
+	_, err := ParseAddress(address, network)
+	return err == nil
+}
+
+// PubKeyHashToAddress returns the address on the network locking outputs to the given public key
+// hash, or the multisig address of a multisig script.
+func PubKeyHashToAddress(pubKeyHash []byte, network Network) string {
+	return NewAddress(pubKeyHash, network).String()
+}
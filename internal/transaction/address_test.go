@@ -0,0 +1,114 @@
+package transaction
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/yanglinshu/glock/internal/errors"
+)
+
+// networkNamed returns the network with the given name
+func networkNamed(t *testing.T, name string) Network {
+	t.Helper()
+
+	network, err := NetworkByName(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return network
+}
+
+func TestAddressesTiedToNetwork(t *testing.T) {
+	w := newWallets(t, 3)
+
+	var hashes [][]byte
+	for _, wallet := range w {
+		pubKeyHash, err := HashPubKey(wallet.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, pubKeyHash)
+	}
+
+	script, err := NewMultisigScript(2, hashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addresses := make(map[string][2]string)
+	for name, prefixes := range map[string]string{"mainnet": "1", "testnet": "mn"} {
+		network := networkNamed(t, name)
+
+		address := NewAddress(hashes[0], network).String()
+		if !strings.ContainsRune(prefixes, rune(address[0])) {
+			t.Fatalf("%s address %s does not start with one of %q", name, address, prefixes)
+		}
+
+		addresses[name] = [2]string{address, NewAddress(script, network).String()}
+	}
+
+	// A mainnet node rejects testnet addresses, and the other way round, both networks being used
+	// side by side
+	for name, other := range map[string]string{"mainnet": "testnet", "testnet": "mainnet"} {
+		network := networkNamed(t, name)
+
+		for _, address := range addresses[name] {
+			parsed, err := ParseAddress(address, network)
+			if err != nil {
+				t.Fatalf("ParseAddress of %s address %s on %s: %v", name, address, name, err)
+			}
+
+			if parsed.String() != address {
+				t.Fatalf("ParseAddress(%s) on %s prints as %s", address, name, parsed)
+			}
+		}
+
+		if !NewAddress(script, network).IsMultisig() || NewAddress(hashes[0], network).IsMultisig() {
+			t.Fatalf("multisig addresses on %s are not told from the others", name)
+		}
+
+		for _, address := range addresses[other] {
+			_, err := ParseAddress(address, network)
+			if !errors.Is(err, errors.ErrInvalidAddress) {
+				t.Fatalf("ParseAddress of %s address %s on %s = %v, want ErrInvalidAddress", other, address, name, err)
+			}
+
+			if ValidateAddress(address, network) {
+				t.Fatalf("%s address %s is valid on %s", other, address, name)
+			}
+		}
+	}
+
+	_, err = NetworkByName("regtest")
+	if !errors.Is(err, errors.ErrUnknownNetwork) {
+		t.Fatalf("NetworkByName of an unknown network = %v, want ErrUnknownNetwork", err)
+	}
+}
+
+func TestParseAddressRejectsInvalidBase58(t *testing.T) {
+	w := newWallets(t, 1)[0]
+
+	pubKeyHash, err := HashPubKey(w.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := NewAddress(pubKeyHash, Mainnet).String()
+
+	// A character outside the alphabet in place of the last one
+	invalid := address[:len(address)-1] + "0"
+
+	_, err = ParseAddress(invalid, Mainnet)
+	if !errors.Is(err, errors.ErrInvalidBase58) {
+		t.Fatalf("ParseAddress(%q) = %v, want ErrInvalidBase58", invalid, err)
+	}
+
+	if ValidateAddress(invalid, Mainnet) {
+		t.Fatalf("address %q with a character outside the alphabet is valid", invalid)
+	}
+
+	var out TXOutput
+	if err := out.Lock(Address{}); !errors.Is(err, errors.ErrInvalidAddress) {
+		t.Fatalf("locking an output to the zero address = %v, want ErrInvalidAddress", err)
+	}
+}
@@ -0,0 +1,127 @@
+package transaction
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/binary"
+	"math/big"
+
+	"github.com/yanglinshu/glock/internal/errors"
+)
+
+// seedSize is the size in bytes of a generated master seed
+const seedSize = 32
+
+// masterKeySalt is the HMAC key deriving the master key and chain code from a seed
+var masterKeySalt = []byte("glock seed")
+
+// NewSeed generates a random master seed.
+func NewSeed() ([]byte, error) {
+	seed := make([]byte, seedSize)
+
+	_, err := rand.Read(seed)
+	if err != nil {
+		return nil, err
+	}
+
+	return seed, nil
+}
+
+// DeriveWallet derives the wallet with the given index from a master seed. The master key and chain
+// code are the halves of HMAC-SHA512 of the seed, and every child key adds the left half of
+// HMAC-SHA512(chain code, 0x00 || master key || index) to the master key, modulo the curve order.
+func DeriveWallet(seed []byte, index int) (*Wallet, error) {
+	if len(seed) == 0 || index < 0 {
+		return nil, errors.ErrInvalidSeed
+	}
+
+	mac := hmac.New(sha512.New, masterKeySalt)
+	mac.Write(seed)
+	master := mac.Sum(nil)
+	masterKey, chainCode := master[:32], master[32:]
+
+	var indexBytes [4]byte
+	binary.BigEndian.PutUint32(indexBytes[:], uint32(index))
+
+	var data []byte
+	data = append(data, 0x00)
+	data = append(data, masterKey...)
+	data = append(data, indexBytes[:]...)
+
+	mac = hmac.New(sha512.New, chainCode)
+	mac.Write(data)
+	child := mac.Sum(nil)
+
+	curve := elliptic.P256()
+	d := new(big.Int).SetBytes(child[:32])
+	d.Add(d, new(big.Int).SetBytes(masterKey))
+	d.Mod(d, curve.Params().N)
+	if d.Sign() == 0 {
+		return nil, errors.ErrInvalidSeed
+	}
+
+	private := ecdsa.PrivateKey{PublicKey: ecdsa.PublicKey{Curve: curve}, D: d}
+	private.PublicKey.X, private.PublicKey.Y = curve.ScalarBaseMult(d.FillBytes(make([]byte, coordinateSize)))
+
+	pubKey := joinHalves(private.PublicKey.X, private.PublicKey.Y)
+
+	return &Wallet{private, pubKey}, nil
+}
+
+// NewWalletsFromSeed returns a collection holding the first count wallets derived from seed,
+// addressed on the network.
+func NewWalletsFromSeed(seed []byte, count int, network Network) (*Wallets, error) {
+	wallets := Wallets{Wallets: make(map[string]*Wallet), Seed: seed, Network: network}
+
+	for wallets.Index < count {
+		_, err := wallets.deriveNext()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &wallets, nil
+}
+
+// deriveNext derives the next wallet from the seed, adds it to the collection and returns its
+// address.
+func (ws *Wallets) deriveNext() (string, error) {
+	wallet, err := DeriveWallet(ws.Seed, ws.Index)
+	if err != nil {
+		return "", err
+	}
+
+	address, err := wallet.GetAddress(ws.Network)
+	if err != nil {
+		return "", err
+	}
+
+	ws.Wallets[string(address)] = wallet
+	ws.Index++
+
+	return string(address), nil
+}
+
+// derivedAddresses returns the addresses of the wallets derived from the seed.
+func (ws Wallets) derivedAddresses() (map[string]bool, error) {
+	addresses := make(map[string]bool)
+
+	for i := 0; i < ws.Index; i++ {
+		wallet, err := DeriveWallet(ws.Seed, i)
+		if err != nil {
+			return nil, err
+		}
+
+		address, err := wallet.GetAddress(ws.Network)
+		if err != nil {
+			return nil, err
+		}
+
+		addresses[string(address)] = true
+	}
+
+	return addresses, nil
+}
@@ -0,0 +1,140 @@
+package transaction
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"math/big"
+
+	"github.com/yanglinshu/glock/internal/errors"
+)
+
+// memoMarker is the first byte of a data output holding an encrypted memo
+const memoMarker = byte(0x6d)
+
+// maxMemoSize is the maximum length of a memo in bytes before encryption
+const maxMemoSize = 80
+
+// ephemeralKeyLen is the length of an uncompressed P-256 public key
+const ephemeralKeyLen = 65
+
+// NewMemoTXOutput encrypts a memo so that only the owner of pubKey can read it, and returns a data
+// output holding it. The key is derived via ECDH between a fresh ephemeral key and pubKey; the
+// ephemeral public key is stored next to the ciphertext so the recipient can derive it again.
+func NewMemoTXOutput(memo string, pubKey []byte) (*TXOutput, error) {
+	if len(memo) > maxMemoSize {
+		return nil, errors.ErrMemoTooLarge
+	}
+
+	recipient, err := parsePublicKey(pubKey)
+	if err != nil {
+		return nil, err
+	}
+
+	curve := elliptic.P256()
+	ephemeral, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := memoCipher(recipient, ephemeral.D)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	// Layout: marker | ephemeral public key | nonce | ciphertext
+	data := []byte{memoMarker}
+	data = append(data, elliptic.Marshal(curve, ephemeral.X, ephemeral.Y)...)
+	data = append(data, nonce...)
+	data = aead.Seal(data, nonce, []byte(memo), nil)
+
+	return &TXOutput{0, nil, data}, nil
+}
+
+// IsMemo checks whether the output carries an encrypted memo.
+func (out *TXOutput) IsMemo() bool {
+	return out.IsData() && out.Data[0] == memoMarker
+}
+
+// DecryptMemo decrypts a memo output with the private key of the wallet. It returns
+// ErrInvalidMemo if the memo was not encrypted to this wallet.
+func (w Wallet) DecryptMemo(out *TXOutput) (string, error) {
+	if !out.IsMemo() {
+		return "", errors.ErrInvalidMemo
+	}
+
+	curve := elliptic.P256()
+	data := out.Data[1:]
+	if len(data) < ephemeralKeyLen {
+		return "", errors.ErrInvalidMemo
+	}
+
+	x, y := elliptic.Unmarshal(curve, data[:ephemeralKeyLen])
+	if x == nil {
+		return "", errors.ErrInvalidMemo
+	}
+	data = data[ephemeralKeyLen:]
+
+	aead, err := memoCipher(&ecdsa.PublicKey{Curve: curve, X: x, Y: y}, w.PrivateKey.D)
+	if err != nil {
+		return "", err
+	}
+
+	if len(data) < aead.NonceSize() {
+		return "", errors.ErrInvalidMemo
+	}
+
+	memo, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return "", errors.ErrInvalidMemo
+	}
+
+	return string(memo), nil
+}
+
+// DecryptMemo tries every wallet in the collection on a memo output and returns the address of
+// the wallet that could read it along with the memo.
+func (ws Wallets) DecryptMemo(out *TXOutput) (string, string, error) {
+	for address, wallet := range ws.Wallets {
+		memo, err := wallet.DecryptMemo(out)
+		if err == nil {
+			return address, memo, nil
+		}
+	}
+
+	return "", "", errors.ErrInvalidMemo
+}
+
+// memoCipher derives the AES-GCM cipher shared between the holders of pub and priv.
+func memoCipher(pub *ecdsa.PublicKey, priv *big.Int) (cipher.AEAD, error) {
+	sx, _ := pub.Curve.ScalarMult(pub.X, pub.Y, priv.Bytes())
+	key := sha256.Sum256(sx.FillBytes(make([]byte, 32)))
+
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// parsePublicKey converts a wallet public key, the concatenation of X and Y, to a curve point.
+func parsePublicKey(pubKey []byte) (*ecdsa.PublicKey, error) {
+	curve := elliptic.P256()
+
+	x, y, ok := splitHalves(pubKey)
+	if !ok || !curve.IsOnCurve(x, y) {
+		return nil, errors.ErrInvalidPublicKey
+	}
+
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
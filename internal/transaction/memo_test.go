@@ -0,0 +1,131 @@
+package transaction
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/yanglinshu/glock/internal/errors"
+)
+
+// newWallets returns n new wallets
+func newWallets(t *testing.T, n int) []*Wallet {
+	t.Helper()
+
+	wallets := make([]*Wallet, n)
+	for i := range wallets {
+		w, err := NewWallet()
+		if err != nil {
+			t.Fatal(err)
+		}
+		wallets[i] = w
+	}
+
+	return wallets
+}
+
+func TestMemoOnlyReadableByRecipient(t *testing.T) {
+	w := newWallets(t, 3)
+	recipient, other := w[1], w[2]
+
+	out, err := NewMemoTXOutput("invoice #42", recipient.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !out.IsMemo() || out.Value != 0 || out.PublicKeyHash != nil {
+		t.Fatalf("memo output = %+v, want a data output", out)
+	}
+
+	memo, err := recipient.DecryptMemo(out)
+	if err != nil {
+		t.Fatalf("DecryptMemo by the recipient: %v", err)
+	}
+
+	if memo != "invoice #42" {
+		t.Fatalf("memo = %q, want %q", memo, "invoice #42")
+	}
+
+	// Neither a third wallet nor the sender, who only kept the ephemeral key, can read it
+	for _, wallet := range []*Wallet{other, w[0]} {
+		_, err = wallet.DecryptMemo(out)
+		if !errors.Is(err, errors.ErrInvalidMemo) {
+			t.Fatalf("DecryptMemo by another wallet = %v, want ErrInvalidMemo", err)
+		}
+	}
+}
+
+func TestWalletsDecryptMemo(t *testing.T) {
+	w := newWallets(t, 3)
+	ws := Wallets{Wallets: map[string]*Wallet{"first": w[0], "second": w[1]}}
+
+	out, err := NewMemoTXOutput("rent", w[1].PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	address, memo, err := ws.DecryptMemo(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if address != "second" || memo != "rent" {
+		t.Fatalf("DecryptMemo = %q, %q, want the memo for the second wallet", address, memo)
+	}
+
+	out, err = NewMemoTXOutput("rent", w[2].PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = ws.DecryptMemo(out)
+	if !errors.Is(err, errors.ErrInvalidMemo) {
+		t.Fatalf("DecryptMemo of a memo for a wallet outside the collection = %v, want ErrInvalidMemo", err)
+	}
+}
+
+func TestMemoSizeCap(t *testing.T) {
+	w := newWallets(t, 1)[0]
+
+	// The largest memo still fits in a data output of the default size
+	out, err := NewMemoTXOutput(strings.Repeat("x", maxMemoSize), w.PublicKey)
+	if err != nil {
+		t.Fatalf("NewMemoTXOutput of %d bytes: %v", maxMemoSize, err)
+	}
+
+	if len(out.Data) > DefaultMaxDataSize {
+		t.Fatalf("memo output holds %d bytes, more than the %d of a standard data output", len(out.Data), DefaultMaxDataSize)
+	}
+
+	_, err = NewMemoTXOutput(strings.Repeat("x", maxMemoSize+1), w.PublicKey)
+	if !errors.Is(err, errors.ErrMemoTooLarge) {
+		t.Fatalf("NewMemoTXOutput of %d bytes = %v, want ErrMemoTooLarge", maxMemoSize+1, err)
+	}
+}
+
+func TestMemoRejectsTamperingAndBadKeys(t *testing.T) {
+	w := newWallets(t, 1)[0]
+
+	_, err := NewMemoTXOutput("hello", []byte("not a key"))
+	if !errors.Is(err, errors.ErrInvalidPublicKey) {
+		t.Fatalf("NewMemoTXOutput to an invalid key = %v, want ErrInvalidPublicKey", err)
+	}
+
+	out, err := NewMemoTXOutput("hello", w.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out.Data[len(out.Data)-1] ^= 0xff
+	_, err = w.DecryptMemo(out)
+	if !errors.Is(err, errors.ErrInvalidMemo) {
+		t.Fatalf("DecryptMemo of a tampered memo = %v, want ErrInvalidMemo", err)
+	}
+
+	// Outputs cut short or without the marker are not memos
+	for _, data := range [][]byte{{memoMarker}, {memoMarker, 0x04, 0x01}, []byte("plain data")} {
+		_, err = w.DecryptMemo(&TXOutput{Data: data})
+		if !errors.Is(err, errors.ErrInvalidMemo) {
+			t.Fatalf("DecryptMemo of %x = %v, want ErrInvalidMemo", data, err)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package transaction
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	_ "embed"
+	"math/big"
+	"strings"
+
+	"github.com/yanglinshu/glock/internal/errors"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// englishWords is the BIP39 English word list, one word per line
+//
+//go:embed english.txt
+var englishWords string
+
+// wordList holds the words of the dictionary in order
+var wordList = strings.Fields(englishWords)
+
+// wordIndex maps every word of the dictionary to its index
+var wordIndex = func() map[string]int {
+	index := make(map[string]int, len(wordList))
+	for i, word := range wordList {
+		index[word] = i
+	}
+
+	return index
+}()
+
+// mnemonicIterations is the number of PBKDF2 rounds stretching a mnemonic into a seed
+const mnemonicIterations = 2048
+
+// mnemonicSeedSize is the size in bytes of a seed derived from a mnemonic
+const mnemonicSeedSize = 64
+
+// NewMnemonic generates a mnemonic phrase encoding bits of random entropy. bits must be a multiple
+// of 32 between 128 and 256, which gives 12 to 24 words.
+func NewMnemonic(bits int) (string, error) {
+	if bits < 128 || bits > 256 || bits%32 != 0 {
+		return "", errors.ErrInvalidMnemonic
+	}
+
+	entropy := make([]byte, bits/8)
+	_, err := rand.Read(entropy)
+	if err != nil {
+		return "", err
+	}
+
+	return mnemonicFromEntropy(entropy), nil
+}
+
+// mnemonicFromEntropy encodes entropy followed by the first len(entropy)/4 bits of its SHA-256 hash
+// in groups of 11 bits, one word per group.
+func mnemonicFromEntropy(entropy []byte) string {
+	checksumBits := len(entropy) * 8 / 32
+	hash := sha256.Sum256(entropy)
+
+	data := new(big.Int).SetBytes(entropy)
+	data.Lsh(data, uint(checksumBits))
+	data.Or(data, big.NewInt(int64(hash[0]>>(8-checksumBits))))
+
+	count := (len(entropy)*8 + checksumBits) / 11
+	words := make([]string, count)
+	mask := big.NewInt(2047)
+	for i := count - 1; i >= 0; i-- {
+		words[i] = wordList[new(big.Int).And(data, mask).Int64()]
+		data.Rsh(data, 11)
+	}
+
+	return strings.Join(words, " ")
+}
+
+// ValidateMnemonic checks the words of a mnemonic phrase and its checksum.
+func ValidateMnemonic(mnemonic string) error {
+	words := strings.Fields(mnemonic)
+	if len(words) < 12 || len(words) > 24 || len(words)%3 != 0 {
+		return errors.ErrInvalidMnemonic
+	}
+
+	data := new(big.Int)
+	for _, word := range words {
+		index, ok := wordIndex[word]
+		if !ok {
+			return errors.ErrInvalidMnemonic
+		}
+
+		data.Lsh(data, 11)
+		data.Or(data, big.NewInt(int64(index)))
+	}
+
+	checksumBits := len(words) * 11 / 33
+	checksum := new(big.Int).And(data, big.NewInt(int64(1<<checksumBits-1)))
+	entropy := data.Rsh(data, uint(checksumBits)).FillBytes(make([]byte, checksumBits*4))
+
+	hash := sha256.Sum256(entropy)
+	if checksum.Int64() != int64(hash[0]>>(8-checksumBits)) {
+		return errors.ErrInvalidMnemonic
+	}
+
+	return nil
+}
+
+// SeedFromMnemonic validates a mnemonic phrase and stretches it with the passphrase into a master
+// seed, as in BIP39. The words are ASCII, so they need no further normalization.
+func SeedFromMnemonic(mnemonic, passphrase string) ([]byte, error) {
+	err := ValidateMnemonic(mnemonic)
+	if err != nil {
+		return nil, err
+	}
+
+	normalized := strings.Join(strings.Fields(mnemonic), " ")
+	seed := pbkdf2.Key([]byte(normalized), []byte("mnemonic"+passphrase), mnemonicIterations, mnemonicSeedSize, sha512.New)
+
+	return seed, nil
+}
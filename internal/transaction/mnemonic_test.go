@@ -0,0 +1,125 @@
+package transaction
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/yanglinshu/glock/internal/errors"
+)
+
+// mnemonicVectors are test vectors of BIP39, with the passphrase "TREZOR"
+var mnemonicVectors = []struct {
+	entropy  string
+	mnemonic string
+	seed     string
+}{
+	{
+		"00000000000000000000000000000000",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+		"c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04",
+	},
+	{
+		"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f",
+		"legal winner thank year wave sausage worth useful legal winner thank yellow",
+		"2e8905819b8723fe2c1d161860e5ee1830318dbf49a83bd451cfb8440c28bd6fa457fe1296106559a3c80937a1c1069be3a3a5bd381ee6260e8d9739fce1f607",
+	},
+	{
+		"80808080808080808080808080808080",
+		"letter advice cage absurd amount doctor acoustic avoid letter advice cage above",
+		"d71de856f81a8acc65e6fc851a38d4d7ec216fd0796d0a6827a3ad6ed5511a30fa280f12eb2e47ed2ac03b5c462a0358d18d69fe4f985ec81778c1b370b652a8",
+	},
+	{
+		"ffffffffffffffffffffffffffffffff",
+		"zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo wrong",
+		"ac27495480225222079d7be181583751e86f571027b0497b5b5d11218e0a8a13332572917f0f8e5a589620c6f15b11c61dee327651a14c34e18231052e48c069",
+	},
+	{
+		"0000000000000000000000000000000000000000000000000000000000000000",
+		strings.Repeat("abandon ", 23) + "art",
+		"bda85446c68413707090a52022edd26a1c9462295029f2e60cd7c4f2bbd3097170af7a4d73245cafa9c3cca8d561a7c3de6f5d4a10be8ed2a5e608d68f92fcc8",
+	},
+}
+
+func TestMnemonicVectors(t *testing.T) {
+	for _, v := range mnemonicVectors {
+		entropy, err := hex.DecodeString(v.entropy)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := mnemonicFromEntropy(entropy); got != v.mnemonic {
+			t.Fatalf("mnemonic of %s = %q, want %q", v.entropy, got, v.mnemonic)
+		}
+
+		seed, err := SeedFromMnemonic(v.mnemonic, "TREZOR")
+		if err != nil {
+			t.Fatalf("SeedFromMnemonic(%q): %v", v.mnemonic, err)
+		}
+
+		if got := hex.EncodeToString(seed); got != v.seed {
+			t.Fatalf("seed of %q = %s, want %s", v.mnemonic, got, v.seed)
+		}
+	}
+}
+
+func TestNewMnemonic(t *testing.T) {
+	for bits := 128; bits <= 256; bits += 32 {
+		mnemonic, err := NewMnemonic(bits)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if words := len(strings.Fields(mnemonic)); words != bits*33/32/11 {
+			t.Fatalf("a mnemonic of %d bits has %d words, want %d", bits, words, bits*33/32/11)
+		}
+
+		err = ValidateMnemonic(mnemonic)
+		if err != nil {
+			t.Fatalf("ValidateMnemonic(%q): %v", mnemonic, err)
+		}
+	}
+
+	for _, bits := range []int{0, 96, 152, 288} {
+		_, err := NewMnemonic(bits)
+		if !errors.Is(err, errors.ErrInvalidMnemonic) {
+			t.Fatalf("NewMnemonic(%d) = %v, want ErrInvalidMnemonic", bits, err)
+		}
+	}
+}
+
+func TestValidateMnemonicRejectsInvalid(t *testing.T) {
+	valid := mnemonicVectors[0].mnemonic
+
+	for name, mnemonic := range map[string]string{
+		// The last word carries the checksum
+		"bad checksum":     strings.Repeat("abandon ", 11) + "abandon",
+		"swapped words":    "legal winner thank year wave sausage worth useful legal winner yellow thank",
+		"too few words":    strings.Repeat("abandon ", 8) + "about",
+		"too many words":   strings.Repeat("abandon ", 26) + "about",
+		"not a multiple":   valid + " abandon",
+		"unknown word":     strings.Replace(valid, "about", "aboot", 1),
+		"empty":            "",
+		"capitalized word": strings.Replace(valid, "about", "About", 1),
+	} {
+		err := ValidateMnemonic(mnemonic)
+		if !errors.Is(err, errors.ErrInvalidMnemonic) {
+			t.Fatalf("ValidateMnemonic with %s = %v, want ErrInvalidMnemonic", name, err)
+		}
+
+		_, err = SeedFromMnemonic(mnemonic, "")
+		if !errors.Is(err, errors.ErrInvalidMnemonic) {
+			t.Fatalf("SeedFromMnemonic with %s = %v, want ErrInvalidMnemonic", name, err)
+		}
+	}
+
+	// Extra whitespace does not change the seed
+	seed, err := SeedFromMnemonic("  "+strings.ReplaceAll(valid, " ", "\t ")+"\n", "TREZOR")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := hex.EncodeToString(seed); got != mnemonicVectors[0].seed {
+		t.Fatalf("seed of a mnemonic with extra whitespace = %s, want %s", got, mnemonicVectors[0].seed)
+	}
+}
@@ -0,0 +1,307 @@
+package transaction
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+
+	"github.com/yanglinshu/glock/internal/errors"
+)
+
+// A multisig output locks coins to N public key hashes, M of whose keys must sign to spend them. Its
+// PublicKeyHash holds the multisig script instead of a single hash:
+//
+//	multisigMarker | M (byte) | N (byte) | N public key hashes
+//
+// An input spending it carries the script followed by the public keys of the signers, in the order
+// of their hashes in the script, and their signatures in the same order. Until M keys have signed,
+// the input is partially signed and co-signers add their signatures with Wallets.SignRaw. Neither
+// encoding of a transaction changes, so the IDs of existing transactions stay the same.
+
+// multisigMarker starts every multisig script. A public key hash is never as long as a script, and a
+// public key never has the length of a script followed by keys, which tells them apart.
+const multisigMarker = byte(0xae)
+
+// pubKeyHashSize is the size of a public key hash
+const pubKeyHashSize = 20
+
+// maxMultisigKeys is the largest number of keys a multisig output may be locked to
+const maxMultisigKeys = 16
+
+// publicKeySize is the size of a public key, and of a signature, as encoded by joinHalves
+const publicKeySize = 2 * coordinateSize
+
+// NewMultisigScript returns the script locking coins to the given public key hashes, required of
+// whose keys must sign to spend them. It returns ErrInvalidMultisig unless 1 <= required <= N <=
+// maxMultisigKeys and the hashes are distinct.
+func NewMultisigScript(required int, pubKeyHashes [][]byte) ([]byte, error) {
+	if required < 1 || required > len(pubKeyHashes) || len(pubKeyHashes) > maxMultisigKeys {
+		return nil, errors.ErrInvalidMultisig
+	}
+
+	script := []byte{multisigMarker, byte(required), byte(len(pubKeyHashes))}
+	for i, pubKeyHash := range pubKeyHashes {
+		if len(pubKeyHash) != pubKeyHashSize {
+			return nil, errors.ErrInvalidMultisig
+		}
+
+		for _, other := range pubKeyHashes[:i] {
+			if bytes.Equal(pubKeyHash, other) {
+				return nil, errors.ErrInvalidMultisig
+			}
+		}
+
+		script = append(script, pubKeyHash...)
+	}
+
+	return script, nil
+}
+
+// parseMultisig returns the number of signatures required by a multisig script and the public key
+// hashes it locks to, and false if the data does not start with a script.
+func parseMultisig(data []byte) (int, [][]byte, bool) {
+	if len(data) < 3 || data[0] != multisigMarker {
+		return 0, nil, false
+	}
+
+	required, count := int(data[1]), int(data[2])
+	if required < 1 || required > count || count > maxMultisigKeys || len(data) < 3+count*pubKeyHashSize {
+		return 0, nil, false
+	}
+
+	var pubKeyHashes [][]byte
+	for i := 0; i < count; i++ {
+		start := 3 + i*pubKeyHashSize
+		pubKeyHashes = append(pubKeyHashes, data[start:start+pubKeyHashSize])
+	}
+
+	return required, pubKeyHashes, true
+}
+
+// multisigScriptSize returns the size of the multisig script starting the data.
+func multisigScriptSize(data []byte) int {
+	return 3 + int(data[2])*pubKeyHashSize
+}
+
+// IsMultisig checks whether the locking data, the PublicKeyHash of an output, is a multisig script.
+func IsMultisig(lock []byte) bool {
+	_, _, ok := parseMultisig(lock)
+	return ok && len(lock) == multisigScriptSize(lock)
+}
+
+// NewMultisigTXOutput creates and returns a TXOutput locked to the given public key hashes, required
+// of whose keys must sign to spend it. The value must be positive.
+func NewMultisigTXOutput(value, required int, pubKeyHashes [][]byte) (*TXOutput, error) {
+	if value <= 0 {
+		return nil, errors.ErrInvalidAmount
+	}
+
+	script, err := NewMultisigScript(required, pubKeyHashes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TXOutput{value, script, nil}, nil
+}
+
+// IsMultisig checks whether the output is locked to several keys.
+func (out *TXOutput) IsMultisig() bool {
+	return IsMultisig(out.PublicKeyHash)
+}
+
+// multisigInput is an input spending a multisig output, split into its parts
+type multisigInput struct {
+	Script     []byte   // Script is the multisig script of the output spent
+	Required   int      // Required is the number of signatures needed
+	Hashes     [][]byte // Hashes are the public key hashes of the script
+	PublicKeys [][]byte // PublicKeys are the keys of the signers, in the order of their hashes
+	Signatures [][]byte // Signatures are the signatures of the signers, in the same order
+}
+
+// splitMultisigInput splits an input spending a multisig output, and returns false if it does not
+// carry a script followed by as many keys as signatures.
+func splitMultisigInput(in TXInput) (multisigInput, bool) {
+	required, hashes, ok := parseMultisig(in.PublicKey)
+	if !ok {
+		return multisigInput{}, false
+	}
+
+	size := multisigScriptSize(in.PublicKey)
+	keys := in.PublicKey[size:]
+	if len(keys)%publicKeySize != 0 || len(in.Signature) != len(keys) {
+		return multisigInput{}, false
+	}
+
+	m := multisigInput{Script: in.PublicKey[:size], Required: required, Hashes: hashes}
+	for i := 0; i < len(keys); i += publicKeySize {
+		m.PublicKeys = append(m.PublicKeys, keys[i:i+publicKeySize])
+		m.Signatures = append(m.Signatures, in.Signature[i:i+publicKeySize])
+	}
+
+	return m, true
+}
+
+// IsMultisig checks whether the input spends a multisig output.
+func (in *TXInput) IsMultisig() bool {
+	_, ok := splitMultisigInput(*in)
+	return ok
+}
+
+// join writes the parts of the multisig input back into the input.
+func (m multisigInput) join(in *TXInput) {
+	in.PublicKey = append([]byte{}, m.Script...)
+	in.Signature = nil
+	for i := range m.PublicKeys {
+		in.PublicKey = append(in.PublicKey, m.PublicKeys[i]...)
+		in.Signature = append(in.Signature, m.Signatures[i]...)
+	}
+}
+
+// hashIndex returns the index in the script of the hash of a public key, or -1 if the script does
+// not hold it.
+func (m multisigInput) hashIndex(pubKey []byte) (int, error) {
+	pubKeyHash, err := HashPubKey(pubKey)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, hash := range m.Hashes {
+		if bytes.Equal(hash, pubKeyHash) {
+			return i, nil
+		}
+	}
+
+	return -1, nil
+}
+
+// missing returns the number of signatures the input still needs.
+func (m multisigInput) missing() int {
+	if len(m.Signatures) >= m.Required {
+		return 0
+	}
+
+	return m.Required - len(m.Signatures)
+}
+
+// signMultisigInput adds the signature of the wallet to an input spending a multisig output, given
+// the trimmed copy of the transaction. It returns false if the script does not hold the key of the
+// wallet or the wallet has already signed.
+func (tx *Transaction) signMultisigInput(w Wallet, txCopy *Transaction, inID int, chainID []byte) (bool, error) {
+	m, ok := splitMultisigInput(tx.Vin[inID])
+	if !ok {
+		return false, nil
+	}
+
+	index, err := m.hashIndex(w.PublicKey)
+	if err != nil || index < 0 {
+		return false, err
+	}
+
+	// The keys are kept in the order of their hashes, so the signature goes before the first
+	// signer further in the script
+	at := len(m.PublicKeys)
+	for i, key := range m.PublicKeys {
+		other, err := m.hashIndex(key)
+		if err != nil {
+			return false, err
+		}
+
+		if other == index {
+			return false, nil
+		}
+
+		if other > index && at == len(m.PublicKeys) {
+			at = i
+		}
+	}
+
+	signature, err := tx.signDigest(w.PrivateKey, txCopy, inID, m.Script, chainID)
+	if err != nil {
+		return false, err
+	}
+
+	m.PublicKeys = append(m.PublicKeys[:at], append([][]byte{w.PublicKey}, m.PublicKeys[at:]...)...)
+	m.Signatures = append(m.Signatures[:at], append([][]byte{signature}, m.Signatures[at:]...)...)
+	m.join(&tx.Vin[inID])
+
+	return true, nil
+}
+
+// verifyMultisigInput verifies an input spending an output locked to the multisig script, given the
+// trimmed copy of the transaction. The input must carry the script, and signatures of at least the
+// required number of distinct keys of the script, in the order of their hashes.
+func (tx *Transaction) verifyMultisigInput(txCopy *Transaction, inID int, script, chainID []byte) error {
+	vin := tx.Vin[inID]
+
+	m, ok := splitMultisigInput(vin)
+	if !ok || !bytes.Equal(m.Script, script) {
+		return errors.Wrapf(errors.ErrInvalidPublicKey, "input %d (%x:%d) does not carry the multisig script it spends", inID, vin.Txid, vin.Vout)
+	}
+
+	if m.missing() > 0 {
+		return errors.Wrapf(errors.ErrInvalidSignature, "input %d (%x:%d) has %d of %d signatures", inID, vin.Txid, vin.Vout, len(m.Signatures), m.Required)
+	}
+
+	txCopy.Vin[inID].PublicKey = script
+	dataToVerify, err := tx.signatureDigest(*txCopy, chainID)
+	txCopy.Vin[inID].PublicKey = nil
+	if err != nil {
+		return errors.Wrapf(err, "input %d (%x:%d)", inID, vin.Txid, vin.Vout)
+	}
+
+	last := -1
+	for i, key := range m.PublicKeys {
+		index, err := m.hashIndex(key)
+		if err != nil {
+			return err
+		}
+
+		// Increasing indices keep a key from signing twice
+		if index <= last {
+			return errors.Wrapf(errors.ErrInvalidPublicKey, "input %d (%x:%d) key %d", inID, vin.Txid, vin.Vout, i)
+		}
+		last = index
+
+		pubKey, err := parsePublicKey(key)
+		if err != nil {
+			return errors.Wrapf(err, "input %d (%x:%d) key %d", inID, vin.Txid, vin.Vout, i)
+		}
+
+		r, s, _ := splitHalves(m.Signatures[i])
+		if !ecdsa.Verify(pubKey, dataToVerify, r, s) {
+			return errors.Wrapf(errors.ErrInvalidSignature, "input %d (%x:%d) signature %d", inID, vin.Txid, vin.Vout, i)
+		}
+	}
+
+	return nil
+}
+
+// MissingSignatures returns the number of signatures the transaction still needs: one for every
+// unsigned input, and the rest of the required signatures for every partially signed multisig
+// input.
+func (tx *Transaction) MissingSignatures() int {
+	if tx.IsCoinbase() {
+		return 0
+	}
+
+	missing := 0
+	for _, vin := range tx.Vin {
+		if m, ok := splitMultisigInput(vin); ok {
+			missing += m.missing()
+		} else if len(vin.Signature) == 0 {
+			missing++
+		}
+	}
+
+	return missing
+}
+
+// MultisigAddress returns the address of the multisig script locking coins to the given public key
+// hashes on the network, required of whose keys must sign to spend them.
+func MultisigAddress(required int, pubKeyHashes [][]byte, network Network) (string, error) {
+	script, err := NewMultisigScript(required, pubKeyHashes)
+	if err != nil {
+		return "", err
+	}
+
+	return PubKeyHashToAddress(script, network), nil
+}
@@ -0,0 +1,262 @@
+package transaction
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/yanglinshu/glock/internal/errors"
+)
+
+// newMultisigSpend returns a transaction spending the only output of a transaction locked to the
+// keys of the wallets, required of which must sign, along with the spent transactions by ID
+func newMultisigSpend(t *testing.T, w []*Wallet, required int) (*Transaction, map[string]Transaction) {
+	t.Helper()
+
+	var hashes [][]byte
+	for _, wallet := range w {
+		pubKeyHash, err := HashPubKey(wallet.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, pubKeyHash)
+	}
+
+	out, err := NewMultisigTXOutput(10, required, hashes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prev := Transaction{ID: []byte{0x01, 0x02}, Vout: []TXOutput{*out}}
+	tx := &Transaction{
+		ID:      []byte{0x03, 0x04},
+		Vin:     []TXInput{{Txid: prev.ID, Vout: 0, PublicKey: out.PublicKeyHash}},
+		Vout:    []TXOutput{{Value: 9, PublicKeyHash: hashes[0]}},
+		Version: ChainIDVersion,
+	}
+
+	return tx, map[string]Transaction{hex.EncodeToString(prev.ID): prev}
+}
+
+func TestMultisigTwoOfThree(t *testing.T) {
+	w := newWallets(t, 3)
+	chainID := []byte("regtest genesis")
+
+	// Any two of the three keys sign, in either order
+	for _, signers := range [][]int{{0, 1}, {1, 0}, {0, 2}, {2, 1}} {
+		tx, prevTXs := newMultisigSpend(t, w, 2)
+		unsigned, err := tx.UnsignedHash()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i, signer := range signers {
+			signed, err := tx.SignInputs(*w[signer], chainID)
+			if err != nil || signed != 1 {
+				t.Fatalf("SignInputs of key %d = %d, %v, want the multisig input signed", signer, signed, err)
+			}
+
+			if missing := tx.MissingSignatures(); missing != 1-i {
+				t.Fatalf("MissingSignatures after %d signatures = %d, want %d", i+1, missing, 1-i)
+			}
+		}
+
+		ok, err := tx.Verify(prevTXs, chainID)
+		if !ok {
+			t.Fatalf("Verify of a multisig input signed by keys %v: %v", signers, err)
+		}
+
+		// The keys of the signers come with their signatures, so the ID set before signing holds
+		if hash, err := tx.UnsignedHash(); err != nil || !bytes.Equal(hash, unsigned) {
+			t.Fatalf("UnsignedHash once signed = %x, %v, want %x", hash, err, unsigned)
+		}
+
+		// Signing it again leaves it as it is
+		before := append([]byte{}, tx.Vin[0].Signature...)
+		signed, err := tx.SignInputs(*w[signers[0]], chainID)
+		if err != nil || signed != 0 || !bytes.Equal(tx.Vin[0].Signature, before) {
+			t.Fatalf("SignInputs by a key that already signed = %d, %v, want the input left as it is", signed, err)
+		}
+	}
+
+	// Co-signers holding the keys in one wallet file sign it at once
+	tx, prevTXs := newMultisigSpend(t, w, 2)
+	ws := Wallets{Wallets: map[string]*Wallet{"a": w[0], "c": w[2]}}
+
+	err := ws.SignRaw(tx, chainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err := tx.Verify(prevTXs, chainID)
+	if !ok {
+		t.Fatalf("Verify of a multisig input signed with SignRaw: %v", err)
+	}
+}
+
+func TestMultisigInsufficientSignatures(t *testing.T) {
+	w := newWallets(t, 4)
+	chainID := []byte("regtest genesis")
+	cosigners, outsider := w[:3], w[3]
+
+	tx, prevTXs := newMultisigSpend(t, cosigners, 2)
+
+	// A key outside the script cannot sign
+	signed, err := tx.SignInputs(*outsider, chainID)
+	if err != nil || signed != 0 {
+		t.Fatalf("SignInputs of a key outside the script = %d, %v, want 0", signed, err)
+	}
+
+	ok, err := tx.Verify(prevTXs, chainID)
+	if ok || !errors.Is(err, errors.ErrInvalidSignature) {
+		t.Fatalf("Verify of an unsigned multisig input = %t, %v, want ErrInvalidSignature", ok, err)
+	}
+
+	err = Wallets{Wallets: map[string]*Wallet{"d": outsider}}.SignRaw(tx, chainID)
+	if !errors.Is(err, errors.ErrMissingKey) {
+		t.Fatalf("SignRaw without a key of the script = %v, want ErrMissingKey", err)
+	}
+
+	// A wallet file holding a single key leaves it partially signed, one signature short
+	ws := Wallets{Wallets: map[string]*Wallet{"a": cosigners[0], "d": outsider}}
+	err = ws.SignRaw(tx, chainID)
+	if err != nil {
+		t.Fatalf("SignRaw with a single key of the script: %v", err)
+	}
+
+	if missing := tx.MissingSignatures(); missing != 1 {
+		t.Fatalf("MissingSignatures of a partially signed input = %d, want 1", missing)
+	}
+
+	ok, err = tx.Verify(prevTXs, chainID)
+	if ok || !errors.Is(err, errors.ErrInvalidSignature) {
+		t.Fatalf("Verify of a multisig input signed by 1 of 2 keys = %t, %v, want ErrInvalidSignature", ok, err)
+	}
+
+	// Nor does the same key signing twice count for two
+	m, _ := splitMultisigInput(tx.Vin[0])
+	m.PublicKeys = append(m.PublicKeys, m.PublicKeys[0])
+	m.Signatures = append(m.Signatures, m.Signatures[0])
+	m.join(&tx.Vin[0])
+
+	ok, err = tx.Verify(prevTXs, chainID)
+	if ok || !errors.Is(err, errors.ErrInvalidPublicKey) {
+		t.Fatalf("Verify of a multisig input signed twice by a key = %t, %v, want ErrInvalidPublicKey", ok, err)
+	}
+
+	// Two signatures fail if one of them is tampered with
+	tx, prevTXs = newMultisigSpend(t, cosigners, 2)
+	for _, signer := range cosigners[:2] {
+		_, err := tx.SignInputs(*signer, chainID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	tx.Vin[0].Signature[len(tx.Vin[0].Signature)-1] ^= 0xff
+
+	ok, err = tx.Verify(prevTXs, chainID)
+	if ok || !errors.Is(err, errors.ErrInvalidSignature) {
+		t.Fatalf("Verify of a multisig input with a tampered signature = %t, %v, want ErrInvalidSignature", ok, err)
+	}
+}
+
+func TestMultisigSignaturesCoverOutputs(t *testing.T) {
+	w := newWallets(t, 4)
+	chainID := []byte("regtest genesis")
+	cosigners, thief := w[:3], w[3]
+
+	thiefHash, err := HashPubKey(thief.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// signed returns a spend of the multisig output signed by the first two co-signers
+	signed := func() (*Transaction, map[string]Transaction) {
+		tx, prevTXs := newMultisigSpend(t, cosigners, 2)
+		for _, signer := range cosigners[:2] {
+			_, err := tx.SignInputs(*signer, chainID)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		return tx, prevTXs
+	}
+
+	for name, tamper := range map[string]func(tx *Transaction){
+		"value":     func(tx *Transaction) { tx.Vout[0].Value = 10 },
+		"recipient": func(tx *Transaction) { tx.Vout[0].PublicKeyHash = thiefHash },
+		"output":    func(tx *Transaction) { tx.Vout = append(tx.Vout, TXOutput{Value: 1, PublicKeyHash: thiefHash}) },
+	} {
+		tx, prevTXs := signed()
+		tamper(tx)
+
+		ok, err := tx.Verify(prevTXs, chainID)
+		if ok || !errors.Is(err, errors.ErrInvalidSignature) {
+			t.Fatalf("Verify of a multisig spend whose %s changed after signing = %t, %v, want ErrInvalidSignature", name, ok, err)
+		}
+	}
+
+	// Signatures collected for one spend do not authorize another paying elsewhere
+	tx, _ := signed()
+	other, prevTXs := newMultisigSpend(t, cosigners, 2)
+	other.Vout[0].PublicKeyHash = thiefHash
+	other.Vin[0] = tx.Vin[0]
+
+	ok, err := other.Verify(prevTXs, chainID)
+	if ok || !errors.Is(err, errors.ErrInvalidSignature) {
+		t.Fatalf("Verify of a multisig spend carrying the signatures of another = %t, %v, want ErrInvalidSignature", ok, err)
+	}
+}
+
+func TestNewMultisigScriptRejectsInvalid(t *testing.T) {
+	var hashes [][]byte
+	for _, wallet := range newWallets(t, maxMultisigKeys+1) {
+		pubKeyHash, err := HashPubKey(wallet.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, pubKeyHash)
+	}
+
+	for name, tt := range map[string]struct {
+		required int
+		hashes   [][]byte
+	}{
+		"no signature required":   {0, hashes[:3]},
+		"more required than keys": {4, hashes[:3]},
+		"too many keys":           {2, hashes},
+		"duplicate key":           {2, [][]byte{hashes[0], hashes[1], hashes[0]}},
+		"short hash":              {2, [][]byte{hashes[0], hashes[1][1:]}},
+	} {
+		_, err := NewMultisigScript(tt.required, tt.hashes)
+		if !errors.Is(err, errors.ErrInvalidMultisig) {
+			t.Fatalf("NewMultisigScript with %s = %v, want ErrInvalidMultisig", name, err)
+		}
+	}
+
+	_, err := NewMultisigTXOutput(0, 2, hashes[:3])
+	if !errors.Is(err, errors.ErrInvalidAmount) {
+		t.Fatalf("NewMultisigTXOutput of 0 = %v, want ErrInvalidAmount", err)
+	}
+
+	// The multisig address of a script parses back to the script
+	address, err := MultisigAddress(2, hashes[:3], Mainnet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	script, err := NewMultisigScript(2, hashes[:3])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := ParseAddress(address, Mainnet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !parsed.IsMultisig() || !bytes.Equal(parsed.PubKeyHash(), script) {
+		t.Fatalf("ParseAddress(%s) = %x, want the multisig script %x", address, parsed.PubKeyHash(), script)
+	}
+}
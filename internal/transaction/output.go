@@ -1,66 +1,155 @@
-package transaction
-
-import (
-	"bytes"
-	"encoding/gob"
-
-	"github.com/yanglinshu/glock/internal/util"
-)
-
-// TXOutput represents a transaction output. It contains the value of the output and the public key
-// of the recipient. In glock, the public key will be a simple string, rather than a smart contract.
-// Note that the value of the output cannot be used partially. If the value is greater than the amount
-// needed, the remaining value will be returned to the sender as a new output.
-type TXOutput struct {
-	Value         int    // Value is the amount of coins in the output
-	PublicKeyHash []byte // PublicKeyHash is the hash of the public key of the recipient
-}
-
-// NewTXOutput creates and returns a TXOutput.
-func NewTXOutput(value int, address string) *TXOutput {
-	txo := &TXOutput{value, nil}
-	txo.Lock([]byte(address))
-
-	return txo
-}
-
-// Lock signs the output.
-func (out *TXOutput) Lock(address []byte) {
-	pubKeyHash := util.Base58Decode(address)
-
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-4]
-	out.PublicKeyHash = pubKeyHash
-}
-
-// IsLockedWithKey checks whether the address is the owner of the output.
-func (out *TXOutput) IsLockedWithKey(pubKeyHash []byte) bool {
-	return bytes.Equal(out.PublicKeyHash, pubKeyHash)
-}
-
-// TXOutputs represents a list of transaction outputs.
-type TXOutputs struct {
-	Outputs []TXOutput
-}
-
-// Serialize serializes the transaction outputs.
-func (outs TXOutputs) Serialize() ([]byte, error) {
-	buff, err := util.GobEncode(outs)
-	if err != nil {
-		return nil, err
-	}
-
-	return buff, nil
-}
-
-// DeserializeOutputs deserializes the transaction outputs.
-func DeserializeOutputs(data []byte) (TXOutputs, error) {
-	var outputs TXOutputs
-
-	dec := gob.NewDecoder(bytes.NewReader(data))
-	err := dec.Decode(&outputs)
-	if err != nil {
-		return TXOutputs{}, err
-	}
-
-	return outputs, nil
-}
+package transaction
+
+import (
+	"bytes"
+	"encoding/gob"
+	"math"
+
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/util"
+)
+
+// TXOutput represents a transaction output. It contains the value of the output and the public key
+// of the recipient. In glock, the public key will be a simple string, rather than a smart contract.
+// Note that the value of the output cannot be used partially. If the value is greater than the amount
+// needed, the remaining value will be returned to the sender as a new output.
+// An output holding Data instead of a public key hash carries a payload and can never be spent.
+type TXOutput struct {
+	Value         int    // Value is the amount of coins in the output
+	PublicKeyHash []byte // PublicKeyHash is the hash of the public key of the recipient, or a multisig script
+	Data          []byte // Data is the payload of a data-carrying output
+}
+
+// DefaultMaxDataSize is the maximum number of bytes a data-carrying output may hold on chains that do
+// not set their own limit
+const DefaultMaxDataSize = 256
+
+// maxDataOutputs is the maximum number of data-carrying outputs of a transaction
+const maxDataOutputs = 1
+
+// DefaultDustThreshold is the smallest value of an output locking coins on chains that do not set
+// their own threshold
+const DefaultDustThreshold = 1
+
+// AddValues returns the sum of two values of coins, or ErrValueOverflow if it does not fit in an
+// int. Every total of values taken from transactions goes through it, so crafted values cannot wrap
+// around.
+func AddValues(a, b int) (int, error) {
+	if (b > 0 && a > math.MaxInt-b) || (b < 0 && a < math.MinInt-b) {
+		return 0, errors.ErrValueOverflow
+	}
+
+	return a + b, nil
+}
+
+// NewTXOutput creates and returns a TXOutput locked to an address. The value must be positive.
+func NewTXOutput(value int, to Address) (*TXOutput, error) {
+	if value <= 0 {
+		return nil, errors.ErrInvalidAmount
+	}
+
+	txo := &TXOutput{value, nil, nil}
+	err := txo.Lock(to)
+	if err != nil {
+		return nil, err
+	}
+
+	return txo, nil
+}
+
+// Lock signs the output. The zero address returns ErrInvalidAddress, so coins are never locked to
+// nothing.
+func (out *TXOutput) Lock(to Address) error {
+	if to.IsZero() {
+		return errors.ErrInvalidAddress
+	}
+
+	out.PublicKeyHash = to.PubKeyHash()
+	return nil
+}
+
+// IsLockedWithKey checks whether the address is the owner of the output.
+func (out *TXOutput) IsLockedWithKey(pubKeyHash []byte) bool {
+	return bytes.Equal(out.PublicKeyHash, pubKeyHash)
+}
+
+// NewDataTXOutput creates and returns an unspendable output anchoring data on the chain. The size
+// of the data is checked against the limit of the chain when the transaction is.
+func NewDataTXOutput(data []byte) (*TXOutput, error) {
+	if len(data) == 0 {
+		return nil, errors.ErrInvalidDataOutput
+	}
+
+	return &TXOutput{0, nil, data}, nil
+}
+
+// IsData checks whether the output carries data instead of locking coins.
+func (out *TXOutput) IsData() bool {
+	return len(out.Data) > 0
+}
+
+// IsDust checks whether the output locks coins worth less than the dust threshold, so little that
+// spending it would not be worth the space it takes in the UTXO set.
+func (out *TXOutput) IsDust(threshold int) bool {
+	return !out.IsData() && out.Value < threshold
+}
+
+// IsSpent checks whether the output is the empty placeholder the UTXO set keeps in place of a spent
+// output, so that the other outputs of the transaction stay at their original indices.
+func (out *TXOutput) IsSpent() bool {
+	return out.Value == 0 && len(out.PublicKeyHash) == 0 && len(out.Data) == 0
+}
+
+// TXOutputs represents a list of transaction outputs.
+type TXOutputs struct {
+	Outputs []TXOutput
+}
+
+// UnspentOutputs returns the outputs of a new transaction as the UTXO set keeps them. Data outputs
+// can never be spent, so they are replaced by the placeholder of a spent output, which keeps the
+// other outputs at their indices.
+func UnspentOutputs(vout []TXOutput) TXOutputs {
+	var outs TXOutputs
+	for _, out := range vout {
+		if out.IsData() {
+			out = TXOutput{}
+		}
+		outs.Outputs = append(outs.Outputs, out)
+	}
+
+	return outs
+}
+
+// AllSpent checks whether every output in the list has been spent.
+func (outs TXOutputs) AllSpent() bool {
+	for _, out := range outs.Outputs {
+		if !out.IsSpent() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Serialize serializes the transaction outputs.
+func (outs TXOutputs) Serialize() ([]byte, error) {
+	buff, err := util.GobEncode(outs)
+	if err != nil {
+		return nil, err
+	}
+
+	return buff, nil
+}
+
+// DeserializeOutputs deserializes the transaction outputs.
+func DeserializeOutputs(data []byte) (TXOutputs, error) {
+	var outputs TXOutputs
+
+	dec := gob.NewDecoder(bytes.NewReader(data))
+	err := dec.Decode(&outputs)
+	if err != nil {
+		return TXOutputs{}, err
+	}
+
+	return outputs, nil
+}
@@ -0,0 +1,119 @@
+package transaction
+
+import (
+	"bytes"
+	"encoding/hex"
+
+	"github.com/yanglinshu/glock/internal/errors"
+)
+
+// A raw transaction is the binary encoding of a transaction in hex, as passed between
+// createrawtransaction, signrawtransaction and sendrawtransaction. An unsigned raw transaction
+// already carries the public key of the wallet in its inputs, so it can be signed on a machine
+// holding the wallet file but not the chain.
+
+// EncodeRaw returns the transaction as a raw transaction.
+func (tx *Transaction) EncodeRaw() (string, error) {
+	sl, err := tx.Serialize()
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(sl), nil
+}
+
+// DecodeRaw decodes a raw transaction.
+func DecodeRaw(raw string) (Transaction, error) {
+	data, err := hex.DecodeString(raw)
+	if err != nil || len(data) == 0 {
+		return Transaction{}, errors.ErrInvalidEncoding
+	}
+
+	return DeserializeTransaction(data)
+}
+
+// SignInputs signs the inputs of the transaction carrying the public key of the wallet for the chain
+// identified by chainID, and adds the signature of the wallet to the multisig inputs whose script
+// holds its key. It returns how many inputs were signed. The outputs they spend are taken to be
+// locked to the wallet, or to the script they carry, which verification checks against the chain, so
+// the transactions holding them are not needed.
+func (tx *Transaction) SignInputs(w Wallet, chainID []byte) (int, error) {
+	signed, err := tx.signInputs(w, chainID)
+	return len(signed), err
+}
+
+// signInputs signs the inputs of the transaction as SignInputs does, and returns their indices.
+func (tx *Transaction) signInputs(w Wallet, chainID []byte) ([]int, error) {
+	if tx.IsCoinbase() {
+		return nil, nil
+	}
+
+	pubKeyHash, err := HashPubKey(w.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var signed []int
+	txCopy := tx.TrimmedCopy()
+	for inID, vin := range tx.Vin {
+		if vin.IsMultisig() {
+			ok, err := tx.signMultisigInput(w, &txCopy, inID, chainID)
+			if err != nil {
+				return signed, err
+			}
+
+			if ok {
+				signed = append(signed, inID)
+			}
+			continue
+		}
+
+		if !bytes.Equal(vin.PublicKey, w.PublicKey) {
+			continue
+		}
+
+		err := tx.signInput(w.PrivateKey, &txCopy, inID, pubKeyHash, chainID)
+		if err != nil {
+			return signed, err
+		}
+
+		signed = append(signed, inID)
+	}
+
+	return signed, nil
+}
+
+// SignRaw signs every input of the transaction with the wallet holding its key, for the chain
+// identified by chainID. A multisig input is signed by every wallet whose key its script holds, and
+// may be left partially signed for other wallets to co-sign, see Transaction.MissingSignatures. It
+// returns ErrMissingKey if an input still needs a signature no wallet could add.
+func (ws Wallets) SignRaw(tx *Transaction, chainID []byte) error {
+	signed := make(map[int]bool)
+	for _, w := range ws.Wallets {
+		inputs, err := tx.signInputs(*w, chainID)
+		if err != nil {
+			return err
+		}
+
+		for _, inID := range inputs {
+			signed[inID] = true
+		}
+	}
+
+	if tx.IsCoinbase() {
+		return nil
+	}
+
+	for inID, vin := range tx.Vin {
+		if signed[inID] {
+			continue
+		}
+
+		m, ok := splitMultisigInput(vin)
+		if !ok || m.missing() > 0 {
+			return errors.ErrMissingKey
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package transaction
+
+import (
+	"testing"
+
+	"github.com/yanglinshu/glock/internal/errors"
+)
+
+func TestRawTransactionRoundTrip(t *testing.T) {
+	w := newWallets(t, 1)[0]
+	chainID := []byte("regtest genesis")
+
+	// An unsigned transaction, as createrawtransaction returns it
+	tx, prevTXs := newSpend(t, w, ChainIDVersion)
+	raw, err := tx.EncodeRaw()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := DecodeRaw(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := decoded.EncodeRaw()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if again != raw {
+		t.Fatalf("raw transaction %s encodes again as %s", raw, again)
+	}
+
+	// Signed without the spent transactions, then verified against them
+	signed, err := decoded.SignInputs(*w, chainID)
+	if err != nil || signed != 1 {
+		t.Fatalf("SignInputs = %d, %v, want 1 input signed", signed, err)
+	}
+
+	raw, err = decoded.EncodeRaw()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	final, err := DecodeRaw(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = final.VerifyInputs(prevTXs, chainID)
+	if err != nil {
+		t.Fatalf("a raw transaction signed offline does not verify: %v", err)
+	}
+
+	for _, raw := range []string{"", "zz", "00", "0102"} {
+		_, err := DecodeRaw(raw)
+		if err == nil {
+			t.Fatalf("DecodeRaw(%q) succeeded", raw)
+		}
+	}
+}
+
+func TestSignRawNeedsEveryKey(t *testing.T) {
+	ws := newWallets(t, 2)
+	owner, stranger := ws[0], ws[1]
+
+	tx, prevTXs := newSpend(t, owner, ChainIDVersion)
+
+	// Wallets lacking the key of an input leave the transaction unsigned
+	err := Wallets{Wallets: map[string]*Wallet{"stranger": stranger}}.SignRaw(tx, nil)
+	if !errors.Is(err, errors.ErrMissingKey) {
+		t.Fatalf("SignRaw without the key = %v, want ErrMissingKey", err)
+	}
+
+	err = Wallets{Wallets: map[string]*Wallet{"stranger": stranger, "owner": owner}}.SignRaw(tx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = tx.VerifyInputs(prevTXs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
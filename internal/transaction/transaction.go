@@ -1,225 +1,456 @@
-package transaction
-
-import (
-	"bytes"
-	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
-	"crypto/sha256"
-	"encoding/gob"
-	"encoding/hex"
-	"fmt"
-	"math/big"
-	"strings"
-
-	"github.com/yanglinshu/glock/internal/util"
-)
-
-// subsidy is the amount of coins given to the miner as a reward for mining a block.
-const subsidy = 10
-
-// Transaction is a struct that contains the ID, inputs and outputs of a transaction. The Id is a
-// unique identifier for the transaction. The inputs must be the outputs of previous transactions.
-// The outputs will be the new outputs of the transaction.
-// When a miner creates a new block, it will include a coinbase transaction. This transaction will
-// have no inputs, and will have an output that will be given to the miner. The value of the output
-// will be the reward for mining the block.
-type Transaction struct {
-	ID   []byte     // ID is the hash of the transaction
-	Vin  []TXInput  // Vin is the inputs of the transaction
-	Vout []TXOutput // Vout is the outputs of the transaction
-}
-
-// Sign signs each input of the transaction.
-func (tx *Transaction) Sign(privKey ecdsa.PrivateKey, prevTXs map[string]Transaction) error {
-	if tx.IsCoinbase() {
-		return nil
-	}
-
-	// Sign the inputs, one at a time
-	txCopy := tx.TrimmedCopy()
-	for inID, vin := range txCopy.Vin {
-		prevTx := prevTXs[hex.EncodeToString(vin.Txid)]
-		txCopy.Vin[inID].Signature = nil
-		txCopy.Vin[inID].PublicKey = prevTx.Vout[vin.Vout].PublicKeyHash
-
-		dataToSign := fmt.Sprintf("%x\n", txCopy)
-
-		// Sign the transaction with the private key
-		r, s, err := ecdsa.Sign(rand.Reader, &privKey, []byte(dataToSign))
-		if err != nil {
-			return err
-		}
-
-		// Combine the r and s into a single signature
-		signature := append(r.Bytes(), s.Bytes()...)
-		tx.Vin[inID].Signature = signature
-		txCopy.Vin[inID].PublicKey = nil
-	}
-
-	return nil
-}
-
-// TrimmedCopy creates a trimmed copy of the transaction. The copy will have no signature, and the
-// public key of the inputs will be replaced by the hash of the public key.
-func (tx *Transaction) TrimmedCopy() Transaction {
-	var inputs []TXInput
-	var outputs []TXOutput
-
-	for _, vin := range tx.Vin {
-		inputs = append(inputs, TXInput{vin.Txid, vin.Vout, nil, nil})
-	}
-
-	for _, vout := range tx.Vout {
-		outputs = append(outputs, TXOutput{vout.Value, vout.PublicKeyHash})
-	}
-
-	txCopy := Transaction{tx.ID, inputs, outputs}
-
-	return txCopy
-}
-
-// Serialize serializes the transaction using the gob package.
-func (tx *Transaction) Serialize() ([]byte, error) {
-	encoded, err := util.GobEncode(tx)
-	if err != nil {
-		return nil, err
-	}
-
-	return encoded, nil
-}
-
-// Hash returns the hash of the transaction.
-func (tx *Transaction) Hash() ([]byte, error) {
-	var hash [32]byte
-
-	txCopy := *tx
-	txCopy.ID = []byte{}
-
-	sl, err := txCopy.Serialize()
-	if err != nil {
-		return nil, err
-	}
-
-	hash = sha256.Sum256(sl)
-
-	return hash[:], nil
-}
-
-// String returns a human-readable representation of the transaction.
-func (tx *Transaction) String() string {
-	var lines []string
-
-	lines = append(lines, fmt.Sprintf("--- Transaction %x:", tx.ID))
-
-	for i, input := range tx.Vin {
-		lines = append(lines, fmt.Sprintf("     Input %d:", i))
-		lines = append(lines, fmt.Sprintf("       TXID:      %x", input.Txid))
-		lines = append(lines, fmt.Sprintf("       Out:       %d", input.Vout))
-		lines = append(lines, fmt.Sprintf("       Signature: %x", input.Signature))
-		lines = append(lines, fmt.Sprintf("       PubKey:    %x", input.PublicKey))
-	}
-
-	for i, output := range tx.Vout {
-		lines = append(lines, fmt.Sprintf("     Output %d:", i))
-		lines = append(lines, fmt.Sprintf("       Value:  %d", output.Value))
-		lines = append(lines, fmt.Sprintf("       Script: %x", output.PublicKeyHash))
-	}
-
-	return strings.Join(lines, "\n")
-}
-
-// Verify verifies the signatures of the transaction.
-func (tx *Transaction) Verify(prevTXs map[string]Transaction) bool {
-	txCopy := tx.TrimmedCopy()
-	curve := elliptic.P256()
-
-	for inID, vin := range tx.Vin {
-		// Get the public key from the previous transaction
-		prevTx := prevTXs[hex.EncodeToString(vin.Txid)]
-		txCopy.Vin[inID].Signature = nil
-		txCopy.Vin[inID].PublicKey = prevTx.Vout[vin.Vout].PublicKeyHash
-
-		// Extract the real signature and the real public key from the transaction
-		r := big.Int{}
-		s := big.Int{}
-		sigLen := len(vin.Signature)
-		r.SetBytes(vin.Signature[:(sigLen / 2)])
-		s.SetBytes(vin.Signature[(sigLen / 2):])
-
-		x := big.Int{}
-		y := big.Int{}
-		keyLen := len(vin.PublicKey)
-		x.SetBytes(vin.PublicKey[:(keyLen / 2)])
-		y.SetBytes(vin.PublicKey[(keyLen / 2):])
-
-		dataToVerify := fmt.Sprintf("%x\n", txCopy)
-
-		// Verify the signature
-		rawPubKey := ecdsa.PublicKey{Curve: curve, X: &x, Y: &y}
-		if !ecdsa.Verify(&rawPubKey, []byte(dataToVerify), &r, &s) {
-			return false
-		}
-		txCopy.Vin[inID].PublicKey = nil
-	}
-
-	return true
-}
-
-// NewCoinbaseTX creates a new coinbase transaction. The transaction will have no inputs, and will
-// have an output that will be given to the miner. The value of the output will be the reward for
-// mining the block.
-func NewCoinbaseTX(to, data string) (*Transaction, error) {
-	if data == "" {
-		randData := make([]byte, 20)
-		_, err := rand.Read(randData)
-		if err != nil {
-			return nil, err
-		}
-
-		data = fmt.Sprintf("%x", randData)
-	}
-
-	txin := TXInput{[]byte{}, -1, nil, []byte(data)}
-	txout := NewTXOutput(subsidy, to)
-
-	tx := Transaction{nil, []TXInput{txin}, []TXOutput{*txout}}
-
-	var err error = nil
-	tx.ID, err = tx.Hash()
-	if err != nil {
-		return nil, err
-	}
-
-	return &tx, nil
-}
-
-// IsCoinbase checks whether the transaction is a coinbase transaction.
-func (tx *Transaction) IsCoinbase() bool {
-	return len(tx.Vin) == 1 && len(tx.Vin[0].Txid) == 0 && tx.Vin[0].Vout == -1
-}
-
-// SetID sets the ID of the transaction to the hash of the transaction.
-func (tx *Transaction) SetID() error {
-	encoded, err := util.GobEncode(tx)
-	if err != nil {
-		return err
-	}
-
-	hash := sha256.Sum256(encoded)
-	tx.ID = hash[:]
-	return nil
-}
-
-// DeserializeTransaction deserializes a transaction.
-func DeserializeTransaction(data []byte) (Transaction, error) {
-	var transaction Transaction
-
-	decoder := gob.NewDecoder(bytes.NewReader(data))
-	err := decoder.Decode(&transaction)
-	if err != nil {
-		return Transaction{}, err
-	}
-
-	return transaction, nil
-}
+package transaction
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/yanglinshu/glock/internal/errors"
+)
+
+// DefaultSubsidy is the amount of coins given to the miner as a reward for mining a block, unless
+// the genesis parameters of the chain set another.
+const DefaultSubsidy = 10
+
+// DefaultHalvingInterval is the number of blocks between halvings of the subsidy of new chains
+const DefaultHalvingInterval = 210000
+
+// ChainParams are the parameters of a chain setting the reward for mining a block
+type ChainParams struct {
+	InitialSubsidy  int // Reward for mining the genesis block
+	HalvingInterval int // Number of blocks between halvings of the subsidy, never halved if 0
+}
+
+// BlockSubsidy returns the reward for mining the block at the given height. The subsidy halves
+// every HalvingInterval blocks until it reaches 0, after which miners are only paid the fees.
+func BlockSubsidy(height int, params ChainParams) int {
+	if params.HalvingInterval <= 0 || height < 0 {
+		return params.InitialSubsidy
+	}
+
+	halvings := height / params.HalvingInterval
+	if halvings >= strconv.IntSize-1 {
+		return 0
+	}
+
+	return params.InitialSubsidy >> halvings
+}
+
+// ChainIDVersion is the first transaction version whose signatures commit to the identifier of the
+// chain, so they cannot be replayed on another network.
+const ChainIDVersion = 1
+
+// Transaction is a struct that contains the ID, inputs and outputs of a transaction. The Id is a
+// unique identifier for the transaction. The inputs must be the outputs of previous transactions.
+// The outputs will be the new outputs of the transaction.
+// When a miner creates a new block, it will include a coinbase transaction. This transaction will
+// have no inputs, and will have an output that will be given to the miner. The value of the output
+// will be the reward for mining the block.
+type Transaction struct {
+	ID      []byte     // ID is the hash of the transaction
+	Vin     []TXInput  // Vin is the inputs of the transaction
+	Vout    []TXOutput // Vout is the outputs of the transaction
+	Version int        // Version selects the signature rules of the transaction
+}
+
+// legacyTransaction is the shape of the transactions signed before ChainIDVersion, without a
+// version, whose outputs are formatted in the shape they were signed in.
+type legacyTransaction struct {
+	ID   []byte
+	Vin  []TXInput
+	Vout []interface{}
+}
+
+// legacyOutput is the shape of the outputs signed before data outputs existed
+type legacyOutput struct {
+	Value         int
+	PublicKeyHash []byte
+}
+
+// signatureDigest returns the hash signed for an input, given the trimmed copy prepared for it.
+// From ChainIDVersion on, it hashes the chain identifier followed by the binary encoding of the
+// copy. Older signatures cover the transaction in the text shape it was signed in, so the digest
+// stays the same as the fields of the transactions grow. ECDSA only reads as many bytes of what it
+// signs as the curve order holds, so the data is hashed for the signature to cover all of it.
+func (tx *Transaction) signatureDigest(txCopy Transaction, chainID []byte) ([]byte, error) {
+	if tx.Version >= ChainIDVersion {
+		encoded, err := txCopy.Serialize()
+		if err != nil {
+			return nil, err
+		}
+
+		hash := sha256.Sum256(append(append([]byte{}, chainID...), encoded...))
+		return hash[:], nil
+	}
+
+	legacy := legacyTransaction{ID: txCopy.ID, Vin: txCopy.Vin}
+	for _, out := range txCopy.Vout {
+		if len(out.Data) == 0 {
+			legacy.Vout = append(legacy.Vout, legacyOutput{out.Value, out.PublicKeyHash})
+		} else {
+			legacy.Vout = append(legacy.Vout, out)
+		}
+	}
+
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%x\n", legacy)))
+	return hash[:], nil
+}
+
+// Sign signs each input of the transaction for the chain identified by chainID.
+func (tx *Transaction) Sign(privKey ecdsa.PrivateKey, prevTXs map[string]Transaction, chainID []byte) error {
+	if tx.IsCoinbase() {
+		return nil
+	}
+
+	// Sign the inputs, one at a time
+	txCopy := tx.TrimmedCopy()
+	for inID, vin := range txCopy.Vin {
+		prevTx := prevTXs[hex.EncodeToString(vin.Txid)]
+
+		err := tx.signInput(privKey, &txCopy, inID, prevTx.Vout[vin.Vout].PublicKeyHash, chainID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// signInput signs an input spending an output locked to pubKeyHash, given the trimmed copy of the
+// transaction.
+func (tx *Transaction) signInput(privKey ecdsa.PrivateKey, txCopy *Transaction, inID int, pubKeyHash, chainID []byte) error {
+	signature, err := tx.signDigest(privKey, txCopy, inID, pubKeyHash, chainID)
+	if err != nil {
+		return err
+	}
+
+	tx.Vin[inID].Signature = signature
+	return nil
+}
+
+// signDigest returns the signature of an input spending an output locked to lock, given the trimmed
+// copy of the transaction.
+func (tx *Transaction) signDigest(privKey ecdsa.PrivateKey, txCopy *Transaction, inID int, lock, chainID []byte) ([]byte, error) {
+	txCopy.Vin[inID].Signature = nil
+	txCopy.Vin[inID].PublicKey = lock
+
+	dataToSign, err := tx.signatureDigest(*txCopy, chainID)
+	txCopy.Vin[inID].PublicKey = nil
+	if err != nil {
+		return nil, err
+	}
+
+	// Sign the transaction with the private key
+	r, s, err := ecdsa.Sign(rand.Reader, &privKey, dataToSign)
+	if err != nil {
+		return nil, err
+	}
+
+	// Combine the r and s into a single signature of fixed width
+	return joinHalves(r, s), nil
+}
+
+// TrimmedCopy creates a trimmed copy of the transaction. The copy will have no signature, and the
+// public key of the inputs will be replaced by the hash of the public key.
+func (tx *Transaction) TrimmedCopy() Transaction {
+	var inputs []TXInput
+	var outputs []TXOutput
+
+	for _, vin := range tx.Vin {
+		inputs = append(inputs, TXInput{vin.Txid, vin.Vout, nil, nil})
+	}
+
+	for _, vout := range tx.Vout {
+		outputs = append(outputs, TXOutput{vout.Value, vout.PublicKeyHash, vout.Data})
+	}
+
+	txCopy := Transaction{tx.ID, inputs, outputs, tx.Version}
+
+	return txCopy
+}
+
+// Serialize serializes the transaction with the deterministic binary encoding. It returns
+// ErrUnencodable if a field is beyond the bounds of the encoding.
+func (tx *Transaction) Serialize() ([]byte, error) {
+	return tx.encodeWire()
+}
+
+// Hash returns the hash of the binary encoding of the transaction without its ID. Transactions
+// created before the binary encoding keep the IDs they were given from their gob encoding.
+func (tx *Transaction) Hash() ([]byte, error) {
+	var hash [32]byte
+
+	txCopy := *tx
+	txCopy.ID = []byte{}
+
+	sl, err := txCopy.Serialize()
+	if err != nil {
+		return nil, err
+	}
+
+	hash = sha256.Sum256(sl)
+
+	return hash[:], nil
+}
+
+// String returns a human-readable representation of the transaction.
+func (tx *Transaction) String() string {
+	var lines []string
+
+	lines = append(lines, fmt.Sprintf("--- Transaction %x:", tx.ID))
+
+	for i, input := range tx.Vin {
+		lines = append(lines, fmt.Sprintf("     Input %d:", i))
+		lines = append(lines, fmt.Sprintf("       TXID:      %x", input.Txid))
+		lines = append(lines, fmt.Sprintf("       Out:       %d", input.Vout))
+		lines = append(lines, fmt.Sprintf("       Signature: %x", input.Signature))
+		lines = append(lines, fmt.Sprintf("       PubKey:    %x", input.PublicKey))
+	}
+
+	for i, output := range tx.Vout {
+		lines = append(lines, fmt.Sprintf("     Output %d:", i))
+		lines = append(lines, fmt.Sprintf("       Value:  %d", output.Value))
+		lines = append(lines, fmt.Sprintf("       Script: %x", output.PublicKeyHash))
+		if output.IsData() {
+			lines = append(lines, fmt.Sprintf("       Data:   %x", output.Data))
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Verify verifies the signatures of the transaction on the chain identified by chainID. It returns
+// false with the reason, as VerifyInputs does, if an input is invalid.
+func (tx *Transaction) Verify(prevTXs map[string]Transaction, chainID []byte) (bool, error) {
+	err := tx.VerifyInputs(prevTXs, chainID)
+	return err == nil, err
+}
+
+// VerifyInputs verifies the signatures of the transaction on the chain identified by chainID, as
+// Verify does. An input spending a multisig output must carry the signatures of enough of its
+// keys. It returns ErrInvalidSignature or ErrInvalidPublicKey naming the first input that fails,
+// or ErrInvalidTransaction if an input spends an output missing from prevTXs.
+func (tx *Transaction) VerifyInputs(prevTXs map[string]Transaction, chainID []byte) error {
+	txCopy := tx.TrimmedCopy()
+
+	for inID, vin := range tx.Vin {
+		// Get the public key from the previous transaction
+		prevTx, ok := prevTXs[hex.EncodeToString(vin.Txid)]
+		if !ok || vin.Vout < 0 || vin.Vout >= len(prevTx.Vout) {
+			return errors.Wrapf(errors.ErrInvalidTransaction, "input %d spends unknown output %x:%d", inID, vin.Txid, vin.Vout)
+		}
+
+		if prevTx.Vout[vin.Vout].IsMultisig() {
+			err := tx.verifyMultisigInput(&txCopy, inID, prevTx.Vout[vin.Vout].PublicKeyHash, chainID)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		txCopy.Vin[inID].Signature = nil
+		txCopy.Vin[inID].PublicKey = prevTx.Vout[vin.Vout].PublicKeyHash
+
+		// Extract the real signature and the real public key from the transaction
+		r, s, ok := splitHalves(vin.Signature)
+		if !ok {
+			return errors.Wrapf(errors.ErrInvalidSignature, "input %d (%x:%d) has a malformed signature", inID, vin.Txid, vin.Vout)
+		}
+
+		pubKey, err := parsePublicKey(vin.PublicKey)
+		if err != nil {
+			return errors.Wrapf(err, "input %d (%x:%d)", inID, vin.Txid, vin.Vout)
+		}
+
+		dataToVerify, err := tx.signatureDigest(txCopy, chainID)
+		if err != nil {
+			return errors.Wrapf(err, "input %d (%x:%d)", inID, vin.Txid, vin.Vout)
+		}
+
+		// Verify the signature
+		if !ecdsa.Verify(pubKey, dataToVerify, r, s) {
+			return errors.Wrapf(errors.ErrInvalidSignature, "input %d (%x:%d)", inID, vin.Txid, vin.Vout)
+		}
+		txCopy.Vin[inID].PublicKey = nil
+	}
+
+	return nil
+}
+
+// CheckDataOutputs checks that the transaction carries at most one data output, and that such an
+// output holds no coins and at most maxSize bytes.
+func (tx *Transaction) CheckDataOutputs(maxSize int) error {
+	dataOutputs := 0
+
+	for _, out := range tx.Vout {
+		if !out.IsData() {
+			continue
+		}
+
+		dataOutputs++
+		if dataOutputs > maxDataOutputs || out.Value != 0 || len(out.PublicKeyHash) != 0 || len(out.Data) > maxSize {
+			return errors.ErrInvalidDataOutput
+		}
+	}
+
+	return nil
+}
+
+// CheckOutputValues checks that every output locking coins is worth a positive amount of at least
+// the dust threshold. It returns ErrInvalidAmount or ErrDustOutput otherwise.
+func (tx *Transaction) CheckOutputValues(dustThreshold int) error {
+	for _, out := range tx.Vout {
+		if out.IsData() {
+			continue
+		}
+
+		// The subsidy halves below any threshold, down to 0 when a block pays no fees
+		if tx.IsCoinbase() {
+			if out.Value < 0 {
+				return errors.ErrInvalidAmount
+			}
+			continue
+		}
+
+		if out.Value <= 0 {
+			return errors.ErrInvalidAmount
+		}
+
+		if out.IsDust(dustThreshold) {
+			return errors.ErrDustOutput
+		}
+	}
+
+	return nil
+}
+
+// coinbaseHeightSize is the size of the height of the block at the start of the data of a coinbase
+const coinbaseHeightSize = 8
+
+// NewCoinbaseTX creates a new coinbase transaction. The transaction will have no inputs, and will
+// have an output that will be given to the miner. The value of the output will be the reward for
+// mining the block at the given height, which starts the data of the input so coinbases of
+// different blocks never share an ID.
+func NewCoinbaseTX(to Address, data string, height int, params ChainParams) (*Transaction, error) {
+	if data == "" {
+		randData := make([]byte, 20)
+		_, err := rand.Read(randData)
+		if err != nil {
+			return nil, err
+		}
+
+		data = fmt.Sprintf("%x", randData)
+	}
+
+	coinbaseData := make([]byte, coinbaseHeightSize, coinbaseHeightSize+len(data))
+	binary.BigEndian.PutUint64(coinbaseData, uint64(height))
+	coinbaseData = append(coinbaseData, data...)
+
+	txin := TXInput{[]byte{}, -1, nil, coinbaseData}
+
+	// The output is kept once the subsidy is 0, so the miner can be paid the fees of the block
+	txout := &TXOutput{BlockSubsidy(height, params), nil, nil}
+	err := txout.Lock(to)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := Transaction{nil, []TXInput{txin}, []TXOutput{*txout}, 0}
+
+	tx.ID, err = tx.Hash()
+	if err != nil {
+		return nil, err
+	}
+
+	return &tx, nil
+}
+
+// CoinbaseHeight returns the height of the block a coinbase commits to, and false if its data is
+// too short to hold one.
+func (tx *Transaction) CoinbaseHeight() (int, bool) {
+	if !tx.IsCoinbase() || len(tx.Vin[0].PublicKey) < coinbaseHeightSize {
+		return 0, false
+	}
+
+	return int(binary.BigEndian.Uint64(tx.Vin[0].PublicKey[:coinbaseHeightSize])), true
+}
+
+// CoinbaseData returns the data of a coinbase after the height of the block.
+func (tx *Transaction) CoinbaseData() []byte {
+	if len(tx.Vin[0].PublicKey) < coinbaseHeightSize {
+		return nil
+	}
+
+	return tx.Vin[0].PublicKey[coinbaseHeightSize:]
+}
+
+// IsCoinbase checks whether the transaction is a coinbase transaction.
+func (tx *Transaction) IsCoinbase() bool {
+	return len(tx.Vin) == 1 && len(tx.Vin[0].Txid) == 0 && tx.Vin[0].Vout == -1
+}
+
+// UnsignedHash returns the hash of the transaction without the signatures of its inputs, nor the
+// keys of the co-signers of its multisig inputs, which come with their signatures. The ID of a
+// transaction is set before its inputs are signed, so it is this hash rather than Hash.
+func (tx *Transaction) UnsignedHash() ([]byte, error) {
+	txCopy := *tx
+	txCopy.Vin = make([]TXInput, len(tx.Vin))
+	for i, vin := range tx.Vin {
+		if m, ok := splitMultisigInput(vin); ok {
+			vin.PublicKey = m.Script
+		}
+		vin.Signature = nil
+		txCopy.Vin[i] = vin
+	}
+
+	return txCopy.Hash()
+}
+
+// SetID sets the ID of the transaction to the hash of the transaction.
+func (tx *Transaction) SetID() error {
+	hash, err := tx.Hash()
+	if err != nil {
+		return err
+	}
+
+	tx.ID = hash
+	return nil
+}
+
+// MaxSerializedSize is the largest encoded transaction decoded. Larger payloads are rejected
+// before any decoding.
+const MaxSerializedSize = 8 << 20
+
+// DeserializeTransaction deserializes a transaction from its binary encoding. Transactions
+// serialized with gob by older releases are still read.
+func DeserializeTransaction(data []byte) (Transaction, error) {
+	var transaction Transaction
+	var err error
+
+	if len(data) > MaxSerializedSize {
+		return Transaction{}, errors.ErrPayloadTooLarge
+	}
+
+	if len(data) > 0 && data[0] == wireMarker {
+		transaction, err = decodeWire(data)
+	} else {
+		err = gob.NewDecoder(bytes.NewReader(data)).Decode(&transaction)
+	}
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	// Every transaction has an ID and spends at least one input, the coinbase its empty one
+	if len(transaction.ID) == 0 || len(transaction.Vin) == 0 {
+		return Transaction{}, errors.ErrMalformedTransaction
+	}
+
+	return transaction, nil
+}
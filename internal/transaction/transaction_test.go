@@ -0,0 +1,717 @@
+package transaction
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/util"
+)
+
+// newSpend returns a transaction of the given version spending the only output of a coinbase paying
+// the wallet, along with the spent transactions by ID
+func newSpend(t testing.TB, w *Wallet, version int) (*Transaction, map[string]Transaction) {
+	t.Helper()
+
+	pubKeyHash, err := HashPubKey(w.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prev := Transaction{ID: []byte{0x01, 0x02}, Vout: []TXOutput{{Value: 10, PublicKeyHash: pubKeyHash}}}
+	tx := &Transaction{
+		ID:      []byte{0x03, 0x04},
+		Vin:     []TXInput{{Txid: prev.ID, Vout: 0, PublicKey: w.PublicKey}},
+		Vout:    []TXOutput{{Value: 7, PublicKeyHash: pubKeyHash}, {Value: 3, PublicKeyHash: pubKeyHash}},
+		Version: version,
+	}
+
+	return tx, map[string]Transaction{hex.EncodeToString(prev.ID): prev}
+}
+
+func TestSignatureCommitsToChain(t *testing.T) {
+	w, err := NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	regtest := []byte("regtest genesis")
+	mainnet := []byte("mainnet genesis")
+
+	tx, prevTXs := newSpend(t, w, ChainIDVersion)
+	err = tx.Sign(w.PrivateKey, prevTXs, regtest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = tx.VerifyInputs(prevTXs, regtest)
+	if err != nil {
+		t.Fatalf("VerifyInputs on the signing chain: %v", err)
+	}
+
+	err = tx.VerifyInputs(prevTXs, mainnet)
+	if !errors.Is(err, errors.ErrInvalidSignature) {
+		t.Fatalf("VerifyInputs on another chain = %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestLegacySignatureIgnoresChain(t *testing.T) {
+	w, err := NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, prevTXs := newSpend(t, w, 0)
+	err = tx.Sign(w.PrivateKey, prevTXs, []byte("regtest genesis"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = tx.VerifyInputs(prevTXs, []byte("mainnet genesis"))
+	if err != nil {
+		t.Fatalf("VerifyInputs of a legacy signature: %v", err)
+	}
+}
+
+// TestLegacySignatureDigest checks that transactions signed before ChainIDVersion verify against the
+// hash of the original shape of transactions, which had no version nor data outputs
+func TestLegacySignatureDigest(t *testing.T) {
+	type originalOutput struct {
+		Value         int
+		PublicKeyHash []byte
+	}
+	type originalTransaction struct {
+		ID   []byte
+		Vin  []TXInput
+		Vout []originalOutput
+	}
+
+	w, err := NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, prevTXs := newSpend(t, w, 0)
+	txCopy := tx.TrimmedCopy()
+	txCopy.Vin[0].PublicKey = prevTXs[hex.EncodeToString(tx.Vin[0].Txid)].Vout[0].PublicKeyHash
+
+	original := originalTransaction{ID: txCopy.ID, Vin: txCopy.Vin}
+	for _, out := range txCopy.Vout {
+		original.Vout = append(original.Vout, originalOutput{out.Value, out.PublicKeyHash})
+	}
+	text := fmt.Sprintf("%x\n", original)
+	want := sha256.Sum256([]byte(text))
+
+	got, err := tx.signatureDigest(txCopy, []byte("any chain"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, want[:]) {
+		t.Fatalf("legacy digest = %x, want the hash %x of %q", got, want, text)
+	}
+
+	// A signature over the hash of the original shape verifies
+	r, s, err := ecdsa.Sign(rand.Reader, &w.PrivateKey, want[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Vin[0].Signature = joinHalves(r, s)
+
+	err = tx.VerifyInputs(prevTXs, nil)
+	if err != nil {
+		t.Fatalf("VerifyInputs of a signature over the original shape: %v", err)
+	}
+
+	// One over the text itself only covered its first bytes, the ID of the transaction, and is refused
+	r, s, err = ecdsa.Sign(rand.Reader, &w.PrivateKey, []byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Vin[0].Signature = joinHalves(r, s)
+
+	err = tx.VerifyInputs(prevTXs, nil)
+	if !errors.Is(err, errors.ErrInvalidSignature) {
+		t.Fatalf("VerifyInputs of a signature over the unhashed text = %v, want ErrInvalidSignature", err)
+	}
+}
+
+// TestSignatureCoversTransaction checks that a signature no longer verifies once the outputs of the
+// transaction, or the chain it was signed for, change
+func TestSignatureCoversTransaction(t *testing.T) {
+	w, err := NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	thief := newWallets(t, 1)[0]
+	thiefHash, err := HashPubKey(thief.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chainID := []byte("regtest genesis")
+	for _, version := range []int{0, ChainIDVersion} {
+		for name, tamper := range map[string]func(tx *Transaction) []byte{
+			"value":     func(tx *Transaction) []byte { tx.Vout[0].Value = 9; return chainID },
+			"recipient": func(tx *Transaction) []byte { tx.Vout[0].PublicKeyHash = thiefHash; return chainID },
+			"output":    func(tx *Transaction) []byte { tx.Vout = tx.Vout[:1]; return chainID },
+			"data":      func(tx *Transaction) []byte { tx.Vout[1] = TXOutput{Data: []byte("note")}; return chainID },
+			"chain ID":  func(tx *Transaction) []byte { return []byte("regtest genesiS") },
+		} {
+			if version < ChainIDVersion && name == "chain ID" {
+				continue
+			}
+
+			tx, prevTXs := newSpend(t, w, version)
+			err := tx.Sign(w.PrivateKey, prevTXs, chainID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = tx.VerifyInputs(prevTXs, tamper(tx))
+			if !errors.Is(err, errors.ErrInvalidSignature) {
+				t.Fatalf("VerifyInputs of a version %d transaction whose %s changed after signing = %v, want ErrInvalidSignature", version, name, err)
+			}
+		}
+	}
+}
+
+func TestUnsignedHashIgnoresSignatures(t *testing.T) {
+	w, err := NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, prevTXs := newSpend(t, w, ChainIDVersion)
+	err = tx.SetID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := tx.ID
+
+	err = tx.Sign(w.PrivateKey, prevTXs, []byte("genesis"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := tx.UnsignedHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(hash, id) {
+		t.Fatalf("UnsignedHash of the signed transaction = %x, want its ID %x", hash, id)
+	}
+
+	if tx.Vin[0].Signature == nil {
+		t.Fatal("UnsignedHash removed the signature of the transaction")
+	}
+
+	// Anything else the ID commits to changes the hash
+	tx.Vout[0].Value++
+	hash, err = tx.UnsignedHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Equal(hash, id) {
+		t.Fatal("UnsignedHash ignores the outputs")
+	}
+}
+
+func TestSerializeRejectsUnencodableFields(t *testing.T) {
+	tooLong := make([]byte, maxWireLength+1)
+
+	tests := []struct {
+		name   string
+		tamper func(tx *Transaction)
+	}{
+		{"negative version", func(tx *Transaction) { tx.Version = -1 }},
+		{"long public key", func(tx *Transaction) { tx.Vin[0].PublicKey = tooLong }},
+		{"long signature", func(tx *Transaction) { tx.Vin[0].Signature = tooLong }},
+		{"long data", func(tx *Transaction) { tx.Vout[1].Data = tooLong }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := NewWallet()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tx, _ := newSpend(t, w, ChainIDVersion)
+			tt.tamper(tx)
+
+			_, err = tx.Serialize()
+			if !errors.Is(err, errors.ErrUnencodable) {
+				t.Fatalf("Serialize = %v, want ErrUnencodable", err)
+			}
+
+			_, err = tx.Hash()
+			if !errors.Is(err, errors.ErrUnencodable) {
+				t.Fatalf("Hash = %v, want ErrUnencodable", err)
+			}
+
+			err = tx.SetID()
+			if !errors.Is(err, errors.ErrUnencodable) {
+				t.Fatalf("SetID = %v, want ErrUnencodable", err)
+			}
+		})
+	}
+}
+
+func TestNewCoinbaseTXUnencodableData(t *testing.T) {
+	w, err := NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pubKeyHash, err := HashPubKey(w.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The height the data follows takes the coinbase data beyond the bounds of the encoding
+	data := string(make([]byte, maxWireLength))
+	_, err = NewCoinbaseTX(NewAddress(pubKeyHash, Mainnet), data, 1, ChainParams{})
+	if !errors.Is(err, errors.ErrUnencodable) {
+		t.Fatalf("NewCoinbaseTX = %v, want ErrUnencodable", err)
+	}
+}
+
+func TestSerializeRoundTrip(t *testing.T) {
+	w, err := NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, prevTXs := newSpend(t, w, ChainIDVersion)
+	tx.Vout[1].Data = []byte("memo")
+	err = tx.Sign(w.PrivateKey, prevTXs, []byte("genesis"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := tx.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := DeserializeTransaction(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := decoded.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(data, again) {
+		t.Fatal("a decoded transaction encodes to other bytes")
+	}
+}
+
+// goldenTransaction is a transaction whose fields are all fixed, so its encoding and hashes are
+// too
+func goldenTransaction() *Transaction {
+	return &Transaction{
+		ID: bytes.Repeat([]byte{0x11}, 32),
+		Vin: []TXInput{
+			{Txid: bytes.Repeat([]byte{0x22}, 32), Vout: 1, Signature: bytes.Repeat([]byte{0x33}, 64), PublicKey: bytes.Repeat([]byte{0x44}, 64)},
+		},
+		Vout: []TXOutput{
+			{Value: 7, PublicKeyHash: bytes.Repeat([]byte{0x55}, 20)},
+			{Value: 0, Data: []byte("golden")},
+		},
+		Version: ChainIDVersion,
+	}
+}
+
+func TestTransactionGoldenID(t *testing.T) {
+	tx := goldenTransaction()
+
+	// These values must never change: they are the IDs under which released nodes store and
+	// relay this transaction
+	const wantID = "19ecd27a725e79dc8a10b96f12e213357464b76a2f247793a8c05fd7f862ae1b"
+	const wantHash = "b9b99e4035d9f61216bd724815ac57f4bf48d50f69d67af3fa5ee53224784f2b"
+
+	id, err := tx.UnsignedHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := hex.EncodeToString(id); got != wantID {
+		t.Fatalf("ID = %s, want %s", got, wantID)
+	}
+
+	hash, err := tx.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := hex.EncodeToString(hash); got != wantHash {
+		t.Fatalf("hash = %s, want %s", got, wantHash)
+	}
+}
+
+func TestDeserializeGobTransaction(t *testing.T) {
+	tx := goldenTransaction()
+
+	// Databases written before the binary encoding hold transactions as gob
+	var buff bytes.Buffer
+	err := gob.NewEncoder(&buff).Encode(tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := DeserializeTransaction(buff.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := tx.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := decoded.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Fatal("a transaction decoded from gob differs from the original")
+	}
+}
+
+func TestSignaturesVerifyWithLeadingZeros(t *testing.T) {
+	// About one signature in 128 has a half with a leading zero byte, which an unpadded encoding
+	// splits in the wrong place
+	shortHalves := 0
+	for i := 0; i < 1000; i++ {
+		w, err := NewWallet()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(w.PublicKey) != 2*coordinateSize {
+			t.Fatalf("public key is %d bytes, want %d", len(w.PublicKey), 2*coordinateSize)
+		}
+
+		tx, prevTXs := newSpend(t, w, ChainIDVersion)
+		err = tx.Sign(w.PrivateKey, prevTXs, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		signature := tx.Vin[0].Signature
+		if len(signature) != 2*coordinateSize {
+			t.Fatalf("signature is %d bytes, want %d", len(signature), 2*coordinateSize)
+		}
+
+		if signature[0] == 0 || signature[coordinateSize] == 0 {
+			shortHalves++
+		}
+
+		err = tx.VerifyInputs(prevTXs, nil)
+		if err != nil {
+			t.Fatalf("signature %d (%x) does not verify: %v", i, signature, err)
+		}
+	}
+
+	t.Logf("%d signatures had a half with a leading zero byte", shortHalves)
+}
+
+func TestJoinHalvesPadsShortIntegers(t *testing.T) {
+	a := new(big.Int).SetBytes([]byte{0x01, 0x02})
+	b := new(big.Int).SetBytes(bytes.Repeat([]byte{0xff}, coordinateSize))
+
+	encoded := joinHalves(a, b)
+	if len(encoded) != 2*coordinateSize {
+		t.Fatalf("encoding is %d bytes, want %d", len(encoded), 2*coordinateSize)
+	}
+
+	gotA, gotB, ok := splitHalves(encoded)
+	if !ok || gotA.Cmp(a) != 0 || gotB.Cmp(b) != 0 {
+		t.Fatalf("splitHalves(%x) = %x, %x, want %x, %x", encoded, gotA, gotB, a, b)
+	}
+
+	// Encodings written before the halves were padded are split in the middle
+	gotA, gotB, ok = splitHalves([]byte{0x01, 0x02, 0x03, 0x04})
+	if !ok || gotA.Int64() != 0x0102 || gotB.Int64() != 0x0304 {
+		t.Fatalf("splitHalves of a legacy encoding = %x, %x", gotA, gotB)
+	}
+
+	for _, encoded := range [][]byte{nil, make([]byte, 2*coordinateSize+1)} {
+		if _, _, ok := splitHalves(encoded); ok {
+			t.Fatalf("splitHalves accepted %d bytes", len(encoded))
+		}
+	}
+}
+
+func TestCheckOutputValuesBoundaries(t *testing.T) {
+	const threshold = 10
+	locked := []byte("01234567890123456789")
+
+	for value, want := range map[int]error{
+		-1:            errors.ErrInvalidAmount,
+		0:             errors.ErrInvalidAmount,
+		1:             errors.ErrDustOutput,
+		threshold - 1: errors.ErrDustOutput,
+		threshold:     nil,
+		threshold + 1: nil,
+	} {
+		tx := &Transaction{
+			Vin:  []TXInput{{Txid: []byte("prev"), Vout: 0}},
+			Vout: []TXOutput{{Value: threshold, PublicKeyHash: locked}, {Value: value, PublicKeyHash: locked}},
+		}
+
+		err := tx.CheckOutputValues(threshold)
+		if !errors.Is(err, want) {
+			t.Fatalf("CheckOutputValues of an output worth %d = %v, want %v", value, err, want)
+		}
+	}
+
+	// Data outputs carry no value, and coinbases may pay less than the threshold but not less than 0
+	data := &Transaction{
+		Vin:  []TXInput{{Txid: []byte("prev"), Vout: 0}},
+		Vout: []TXOutput{{Value: threshold, PublicKeyHash: locked}, {Data: []byte("anchor")}},
+	}
+	if err := data.CheckOutputValues(threshold); err != nil {
+		t.Fatalf("CheckOutputValues of a data output: %v", err)
+	}
+
+	for value, want := range map[int]error{-1: errors.ErrInvalidAmount, 0: nil, threshold - 1: nil} {
+		coinbase := &Transaction{
+			Vin:  []TXInput{{Txid: []byte{}, Vout: -1}},
+			Vout: []TXOutput{{Value: value, PublicKeyHash: locked}},
+		}
+
+		err := coinbase.CheckOutputValues(threshold)
+		if !errors.Is(err, want) {
+			t.Fatalf("CheckOutputValues of a coinbase worth %d = %v, want %v", value, err, want)
+		}
+	}
+
+	// An output locking coins is never made worth nothing
+	for _, value := range []int{-1, 0} {
+		_, err := NewTXOutput(value, NewAddress(locked, Mainnet))
+		if !errors.Is(err, errors.ErrInvalidAmount) {
+			t.Fatalf("NewTXOutput of %d = %v, want ErrInvalidAmount", value, err)
+		}
+	}
+}
+
+func TestAddValuesOverflow(t *testing.T) {
+	for _, tt := range []struct {
+		a, b int
+		want int
+		err  error
+	}{
+		{math.MaxInt, 0, math.MaxInt, nil},
+		{math.MaxInt - 1, 1, math.MaxInt, nil},
+		{math.MaxInt, 1, 0, errors.ErrValueOverflow},
+		{math.MaxInt / 2, math.MaxInt/2 + 2, 0, errors.ErrValueOverflow},
+		{math.MaxInt, math.MaxInt, 0, errors.ErrValueOverflow},
+		{math.MinInt, 0, math.MinInt, nil},
+		{math.MinInt + 1, -1, math.MinInt, nil},
+		{math.MinInt, -1, 0, errors.ErrValueOverflow},
+		{math.MaxInt, math.MinInt, -1, nil},
+	} {
+		got, err := AddValues(tt.a, tt.b)
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Fatalf("AddValues(%d, %d) = %d, %v, want %d, %v", tt.a, tt.b, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestBlockSubsidy(t *testing.T) {
+	halving := ChainParams{InitialSubsidy: 50, HalvingInterval: 210000}
+
+	for _, tt := range []struct {
+		height int
+		params ChainParams
+		want   int
+	}{
+		{0, halving, 50},
+		{209999, halving, 50},
+		{210000, halving, 25},
+		{419999, halving, 25},
+		{420000, halving, 12},
+		{5 * 210000, halving, 1},
+		{6*210000 - 1, halving, 1},
+		{6 * 210000, halving, 0},
+		{64 * 210000, halving, 0},
+		{math.MaxInt, halving, 0},
+		{-1, halving, 50},
+		{math.MaxInt, ChainParams{InitialSubsidy: 50}, 50},
+		{math.MaxInt, ChainParams{InitialSubsidy: math.MaxInt, HalvingInterval: 1}, 0},
+	} {
+		if got := BlockSubsidy(tt.height, tt.params); got != tt.want {
+			t.Fatalf("BlockSubsidy(%d, %+v) = %d, want %d", tt.height, tt.params, got, tt.want)
+		}
+	}
+}
+
+func TestVerifyRejectsMalformedInputs(t *testing.T) {
+	w := newWallets(t, 1)[0]
+	chainID := []byte("regtest genesis")
+
+	for name, tt := range map[string]struct {
+		malform func(tx *Transaction, prevTXs map[string]Transaction)
+		want    error
+	}{
+		"nil signature":        {func(tx *Transaction, _ map[string]Transaction) { tx.Vin[0].Signature = nil }, errors.ErrInvalidSignature},
+		"odd signature":        {func(tx *Transaction, _ map[string]Transaction) { tx.Vin[0].Signature = tx.Vin[0].Signature[1:] }, errors.ErrInvalidSignature},
+		"oversized signature":  {func(tx *Transaction, _ map[string]Transaction) { tx.Vin[0].Signature = append(tx.Vin[0].Signature, 0) }, errors.ErrInvalidSignature},
+		"nil public key":       {func(tx *Transaction, _ map[string]Transaction) { tx.Vin[0].PublicKey = nil }, errors.ErrInvalidPublicKey},
+		"truncated public key": {func(tx *Transaction, _ map[string]Transaction) { tx.Vin[0].PublicKey = tx.Vin[0].PublicKey[:33] }, errors.ErrInvalidPublicKey},
+		"vout out of range":    {func(tx *Transaction, _ map[string]Transaction) { tx.Vin[0].Vout = 1 }, errors.ErrInvalidTransaction},
+		"negative vout":        {func(tx *Transaction, _ map[string]Transaction) { tx.Vin[0].Vout = -1 }, errors.ErrInvalidTransaction},
+		"unknown previous transaction": {func(tx *Transaction, prevTXs map[string]Transaction) {
+			for id := range prevTXs {
+				delete(prevTXs, id)
+			}
+		}, errors.ErrInvalidTransaction},
+	} {
+		tx, prevTXs := newSpend(t, w, ChainIDVersion)
+		err := tx.Sign(w.PrivateKey, prevTXs, chainID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tt.malform(tx, prevTXs)
+
+		ok, err := tx.Verify(prevTXs, chainID)
+		if ok || !errors.Is(err, tt.want) {
+			t.Fatalf("Verify of a transaction with a %s = %t, %v, want false, %v", name, ok, err, tt.want)
+		}
+	}
+}
+
+func FuzzVerify(f *testing.F) {
+	w, err := NewWallet()
+	if err != nil {
+		f.Fatal(err)
+	}
+	chainID := []byte("regtest genesis")
+
+	tx, prevTXs := newSpend(f, w, ChainIDVersion)
+	err = tx.Sign(w.PrivateKey, prevTXs, chainID)
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	encoded, err := tx.Serialize()
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	gobEncoded, err := util.GobEncode(tx)
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	f.Add(encoded)
+	f.Add(gobEncoded)
+	f.Add(encoded[:len(encoded)/2])
+	f.Add([]byte{})
+	for _, i := range []int{1, len(encoded) / 3, len(encoded) - 1} {
+		corrupt := append([]byte{}, encoded...)
+		corrupt[i] ^= 0xff
+		f.Add(corrupt)
+	}
+
+	// Whatever a peer sends, decoding and verifying it fails cleanly instead of panicking
+	f.Fuzz(func(t *testing.T, data []byte) {
+		tx, err := DeserializeTransaction(data)
+		if err != nil {
+			return
+		}
+
+		ok, err := tx.Verify(prevTXs, chainID)
+		if ok != (err == nil) {
+			t.Fatalf("Verify = %t, %v", ok, err)
+		}
+	})
+}
+
+func TestDeserializeTransactionRejectsMalformed(t *testing.T) {
+	w := newWallets(t, 1)[0]
+
+	for name, malform := range map[string]func(tx *Transaction){
+		"no ID":    func(tx *Transaction) { tx.ID = nil },
+		"no input": func(tx *Transaction) { tx.Vin = nil },
+	} {
+		tx, _ := newSpend(t, w, ChainIDVersion)
+		malform(tx)
+
+		for encoding, encode := range map[string]func() ([]byte, error){
+			"wire": tx.Serialize,
+			"gob":  func() ([]byte, error) { return util.GobEncode(tx) },
+		} {
+			data, err := encode()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = DeserializeTransaction(data)
+			if !errors.Is(err, errors.ErrMalformedTransaction) {
+				t.Fatalf("DeserializeTransaction of a %s transaction with %s = %v, want ErrMalformedTransaction", encoding, name, err)
+			}
+		}
+	}
+
+	_, err := DeserializeTransaction(bytes.Repeat([]byte{0}, MaxSerializedSize+1))
+	if !errors.Is(err, errors.ErrPayloadTooLarge) {
+		t.Fatalf("DeserializeTransaction of %d bytes = %v, want ErrPayloadTooLarge", MaxSerializedSize+1, err)
+	}
+}
+
+func FuzzDeserializeTransaction(f *testing.F) {
+	w, err := NewWallet()
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	tx, _ := newSpend(f, w, ChainIDVersion)
+	encoded, err := tx.Serialize()
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	gobEncoded, err := util.GobEncode(tx)
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	f.Add(encoded)
+	f.Add(gobEncoded)
+	f.Add(encoded[:len(encoded)/2])
+	f.Add([]byte{wireMarker})
+
+	// A decoded transaction has an ID and inputs, and encodes again, whatever a peer sends
+	f.Fuzz(func(t *testing.T, data []byte) {
+		tx, err := DeserializeTransaction(data)
+		if err != nil {
+			return
+		}
+
+		if len(tx.ID) == 0 || len(tx.Vin) == 0 {
+			t.Fatalf("DeserializeTransaction returned a malformed transaction %+v", tx)
+		}
+
+		tx.Hash()
+		tx.IsCoinbase()
+	})
+}
@@ -0,0 +1,59 @@
+package transaction
+
+import (
+	"net/url"
+	"strconv"
+
+	"github.com/yanglinshu/glock/internal/errors"
+)
+
+// uriScheme is the scheme of payment request URIs
+const uriScheme = "glock"
+
+// PaymentRequest is a request for a payment, shared as a glock: URI such as
+// glock:ADDRESS?amount=5&label=invoice.
+type PaymentRequest struct {
+	Address Address // Address is the address to pay to
+	Amount  int     // Amount is the requested amount, 0 if left to the payer
+	Label   string  // Label is a description of the payment
+}
+
+// String encodes the payment request as a URI.
+func (r PaymentRequest) String() string {
+	query := url.Values{}
+	if r.Amount > 0 {
+		query.Set("amount", strconv.Itoa(r.Amount))
+	}
+	if r.Label != "" {
+		query.Set("label", r.Label)
+	}
+
+	u := url.URL{Scheme: uriScheme, Opaque: r.Address.String(), RawQuery: query.Encode()}
+
+	return u.String()
+}
+
+// ParsePaymentURI decodes a glock: URI into a payment request, validating the address on the
+// network.
+func ParsePaymentURI(uri string, network Network) (*PaymentRequest, error) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != uriScheme {
+		return nil, errors.ErrInvalidURI
+	}
+
+	address, err := ParseAddress(u.Opaque, network)
+	if err != nil {
+		return nil, errors.ErrInvalidAddress
+	}
+
+	request := PaymentRequest{Address: address, Label: u.Query().Get("label")}
+
+	if amount := u.Query().Get("amount"); amount != "" {
+		request.Amount, err = strconv.Atoi(amount)
+		if err != nil || request.Amount <= 0 {
+			return nil, errors.ErrInvalidURI
+		}
+	}
+
+	return &request, nil
+}
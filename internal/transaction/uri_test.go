@@ -0,0 +1,55 @@
+package transaction
+
+import (
+	"testing"
+
+	"github.com/yanglinshu/glock/internal/errors"
+)
+
+func TestPaymentURIRoundTrip(t *testing.T) {
+	w := newWallets(t, 1)[0]
+
+	pubKeyHash, err := HashPubKey(w.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := NewAddress(pubKeyHash, Mainnet)
+
+	for _, request := range []PaymentRequest{
+		{Address: address},
+		{Address: address, Amount: 5},
+		{Address: address, Amount: 5, Label: "invoice #42 & more"},
+	} {
+		parsed, err := ParsePaymentURI(request.String(), Mainnet)
+		if err != nil {
+			t.Fatalf("ParsePaymentURI(%q): %v", request.String(), err)
+		}
+
+		if parsed.Address.String() != address.String() || parsed.Amount != request.Amount || parsed.Label != request.Label {
+			t.Fatalf("ParsePaymentURI(%q) = %+v, want %+v", request.String(), parsed, request)
+		}
+	}
+}
+
+func TestParsePaymentURIRejectsInvalid(t *testing.T) {
+	w := newWallets(t, 1)[0]
+
+	pubKeyHash, err := HashPubKey(w.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := NewAddress(pubKeyHash, Mainnet).String()
+
+	for uri, want := range map[string]error{
+		"bitcoin:" + address:             errors.ErrInvalidURI,
+		address:                          errors.ErrInvalidURI,
+		"glock:" + address + "?amount=0": errors.ErrInvalidURI,
+		"glock:" + address + "?amount=x": errors.ErrInvalidURI,
+		"glock:notanaddress":             errors.ErrInvalidAddress,
+	} {
+		_, err := ParsePaymentURI(uri, Mainnet)
+		if !errors.Is(err, want) {
+			t.Fatalf("ParsePaymentURI(%q) = %v, want %v", uri, err, want)
+		}
+	}
+}
@@ -1,208 +1,296 @@
-package transaction
-
-import (
-	"bytes"
-	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
-	"crypto/sha256"
-	"encoding/gob"
-	"fmt"
-	"os"
-
-	"github.com/yanglinshu/glock/internal/util"
-	"golang.org/x/crypto/ripemd160"
-)
-
-// version is the current version of the wallet
-const version = byte(0x00)
-
-// walletFileFormat is the format of the wallet file
-const walletFileFormat = "wallet_%s.dat"
-
-// addressChecksumLen is the length of the checksum in the address
-const addressChecksumLen = 4
-
-// Wallet stores a private and public key
-type Wallet struct {
-	PrivateKey ecdsa.PrivateKey // Private key
-	PublicKey  []byte           // Public key
-}
-
-// NewWallet creates and returns a Wallet
-func NewWallet() (*Wallet, error) {
-	private, public, err := newKeyPair()
-	if err != nil {
-		return nil, err
-	}
-
-	wallet := Wallet{private, public}
-
-	return &wallet, nil
-}
-
-// newKeyPair generates a private and public key
-func newKeyPair() (ecdsa.PrivateKey, []byte, error) {
-	curve := elliptic.P256()
-	private, err := ecdsa.GenerateKey(curve, rand.Reader)
-	if err != nil {
-		return ecdsa.PrivateKey{}, nil, err
-	}
-
-	pubKey := append(private.PublicKey.X.Bytes(), private.PublicKey.Y.Bytes()...)
-
-	return *private, pubKey, nil
-}
-
-// ValidateAddress check if address if valid
-func ValidateAddress(address string) bool {
-	pubKeyHash := util.Base58Decode([]byte(address))
-
-	if len(pubKeyHash)-addressChecksumLen < 0 {
-		return false
-	}
-
-	actualChecksum := pubKeyHash[len(pubKeyHash)-addressChecksumLen:]
-	version := pubKeyHash[0]
-
-	if len(pubKeyHash)-addressChecksumLen < 1 {
-		return false
-	}
-
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-addressChecksumLen]
-	targetChecksum := checksum(append([]byte{version}, pubKeyHash...))
-
-	return bytes.Equal(actualChecksum, targetChecksum)
-}
-
-// GetAddress returns wallet address: a hash of the public key. Address contains the version, the
-// public key hash, and a checksum.
-func (w Wallet) GetAddress() ([]byte, error) {
-	pubKeyHash, err := HashPubKey(w.PublicKey)
-	if err != nil {
-		return nil, err
-	}
-
-	versionedHash := append([]byte{version}, pubKeyHash...)
-	checksum := checksum(versionedHash)
-
-	fullHash := append(versionedHash, checksum...)
-	addr := util.Base58Encode(fullHash)
-
-	return addr, nil
-}
-
-// HashPubKey hashes public key
-func HashPubKey(pubKey []byte) ([]byte, error) {
-	publicSHA256 := sha256.Sum256(pubKey)
-
-	RIPEMD160Hasher := ripemd160.New()
-	_, err := RIPEMD160Hasher.Write(publicSHA256[:])
-	if err != nil {
-		return nil, err
-	}
-
-	publicRIPEMD160 := RIPEMD160Hasher.Sum(nil)
-
-	return publicRIPEMD160, nil
-}
-
-// checksum returns a checksum for a public key hash
-func checksum(payload []byte) []byte {
-	firstSHA := sha256.Sum256(payload)
-	secondSHA := sha256.Sum256(firstSHA[:])
-
-	return secondSHA[:addressChecksumLen]
-}
-
-// Wallets stores a collection of wallets.
-type Wallets struct {
-	Wallets map[string]*Wallet // Wallets
-}
-
-// NewWallets creates a new wallet
-func NewWallets(nodeID string) (*Wallets, error) {
-	wallets := Wallets{}
-	wallets.Wallets = make(map[string]*Wallet)
-
-	err := wallets.LoadFromFile(nodeID)
-
-	return &wallets, err
-}
-
-// CreateWallet creates a new wallet
-func (ws *Wallets) CreateWallet() (string, error) {
-	wallet, err := NewWallet()
-	if err != nil {
-		return "", err
-	}
-
-	address, err := wallet.GetAddress()
-	if err != nil {
-		return "", err
-	}
-
-	ws.Wallets[string(address)] = wallet
-
-	return string(address), nil
-}
-
-// GetAddresses returns all addresses from the collection of wallets
-func (ws Wallets) GetAddresses() []string {
-	var addresses []string
-	for address := range ws.Wallets {
-		addresses = append(addresses, address)
-	}
-
-	return addresses
-}
-
-// GetWallet returns a wallet by its address
-func (ws Wallets) GetWallet(address string) Wallet {
-	return *ws.Wallets[address]
-}
-
-// LoadFromFile loads wallets from file
-func (ws *Wallets) LoadFromFile(nodeID string) error {
-	walletFile := fmt.Sprintf(walletFileFormat, nodeID)
-	if _, err := os.Stat(walletFile); os.IsNotExist(err) {
-		return err
-	}
-
-	fileContent, err := os.ReadFile(walletFile)
-	if err != nil {
-		return err
-	}
-
-	var wallets Wallets
-	gob.Register(elliptic.P256())
-	decoder := gob.NewDecoder(bytes.NewReader(fileContent))
-	err = decoder.Decode(&wallets)
-	if err != nil {
-		return err
-	}
-
-	ws.Wallets = wallets.Wallets
-
-	return nil
-}
-
-// SaveToFile saves wallets to file
-func (ws Wallets) SaveToFile(nodeID string) error {
-	var content bytes.Buffer
-
-	gob.Register(elliptic.P256())
-	encoder := gob.NewEncoder(&content)
-	err := encoder.Encode(ws)
-	if err != nil {
-		return err
-	}
-
-	walletFile := fmt.Sprintf(walletFileFormat, nodeID)
-	err = os.WriteFile(walletFile, content.Bytes(), 0644)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
+package transaction
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/gob"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/yanglinshu/glock/internal/config"
+	"github.com/yanglinshu/glock/internal/errors"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// The version bytes of the addresses of each network, so an address of one network is rejected by
+// the nodes of the others
+const (
+	VersionMainnet = byte(0x00)
+	VersionTestnet = byte(0x6f)
+	VersionDev     = byte(0x58)
+)
+
+// The version bytes of the multisig addresses of each network, which hold a multisig script instead
+// of a public key hash
+const (
+	MultisigVersionMainnet = byte(0x05)
+	MultisigVersionTestnet = byte(0xc4)
+	MultisigVersionDev     = byte(0x5c)
+)
+
+// Network holds the version bytes of the addresses of a network. Addresses are created and
+// accepted for the network given, so nodes of several networks may run in one process.
+type Network struct {
+	Version         byte // the version byte of the addresses
+	MultisigVersion byte // the version byte of the multisig addresses
+}
+
+// The networks whose addresses are known
+var (
+	Mainnet = Network{VersionMainnet, MultisigVersionMainnet}
+	Testnet = Network{VersionTestnet, MultisigVersionTestnet}
+	Dev     = Network{VersionDev, MultisigVersionDev}
+)
+
+// NetworkByName returns the network with the given name, or ErrUnknownNetwork.
+func NetworkByName(name string) (Network, error) {
+	switch name {
+	case "mainnet":
+		return Mainnet, nil
+	case "testnet":
+		return Testnet, nil
+	case "dev":
+		return Dev, nil
+	default:
+		return Network{}, errors.ErrUnknownNetwork
+	}
+}
+
+// walletFileFormat is the format of the wallet file
+const walletFileFormat = "wallet_%s.dat"
+
+// coordinateSize is the size in bytes of each half of a public key or a signature
+const coordinateSize = 32
+
+// Wallet stores a private and public key
+type Wallet struct {
+	PrivateKey ecdsa.PrivateKey // Private key
+	PublicKey  []byte           // Public key
+}
+
+// NewWallet creates and returns a Wallet
+func NewWallet() (*Wallet, error) {
+	private, public, err := newKeyPair()
+	if err != nil {
+		return nil, err
+	}
+
+	wallet := Wallet{private, public}
+
+	return &wallet, nil
+}
+
+// newKeyPair generates a private and public key
+func newKeyPair() (ecdsa.PrivateKey, []byte, error) {
+	curve := elliptic.P256()
+	private, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		return ecdsa.PrivateKey{}, nil, err
+	}
+
+	pubKey := joinHalves(private.PublicKey.X, private.PublicKey.Y)
+
+	return *private, pubKey, nil
+}
+
+// joinHalves encodes a pair of integers, the coordinates of a public key or the r and s of a
+// signature, as two big-endian halves of coordinateSize bytes each.
+func joinHalves(a, b *big.Int) []byte {
+	encoded := make([]byte, 2*coordinateSize)
+	a.FillBytes(encoded[:coordinateSize])
+	b.FillBytes(encoded[coordinateSize:])
+
+	return encoded
+}
+
+// splitHalves decodes a pair of integers encoded by joinHalves. Shorter encodings, written before
+// the halves were padded, are split in the middle as they were when they were accepted.
+func splitHalves(encoded []byte) (*big.Int, *big.Int, bool) {
+	if len(encoded) == 0 || len(encoded) > 2*coordinateSize {
+		return nil, nil, false
+	}
+
+	half := len(encoded) / 2
+	a := new(big.Int).SetBytes(encoded[:half])
+	b := new(big.Int).SetBytes(encoded[half:])
+
+	return a, b, true
+}
+
+// GetAddress returns wallet address: a hash of the public key. Address contains the version of the
+// network, the public key hash, and a checksum.
+func (w Wallet) GetAddress(network Network) ([]byte, error) {
+	pubKeyHash, err := HashPubKey(w.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(PubKeyHashToAddress(pubKeyHash, network)), nil
+}
+
+// HashPubKey hashes public key
+func HashPubKey(pubKey []byte) ([]byte, error) {
+	publicSHA256 := sha256.Sum256(pubKey)
+
+	RIPEMD160Hasher := ripemd160.New()
+	_, err := RIPEMD160Hasher.Write(publicSHA256[:])
+	if err != nil {
+		return nil, err
+	}
+
+	publicRIPEMD160 := RIPEMD160Hasher.Sum(nil)
+
+	return publicRIPEMD160, nil
+}
+
+// checksum returns a checksum for a public key hash
+func checksum(payload []byte) []byte {
+	firstSHA := sha256.Sum256(payload)
+	secondSHA := sha256.Sum256(firstSHA[:])
+
+	return secondSHA[:addressChecksumLen]
+}
+
+// Wallets stores a collection of wallets. Wallets derived from the seed are not written to the
+// wallet file, they are derived again when it is loaded.
+type Wallets struct {
+	Wallets map[string]*Wallet // Wallets
+	Seed    []byte             // Master seed of the derived wallets
+	Index   int                // Number of wallets derived from the seed
+	Network Network            // Network of the addresses of the wallets
+}
+
+// storedWallets is the content of a wallet file
+type storedWallets struct {
+	Wallets map[string]*Wallet // Wallets not derived from the seed
+	Seed    []byte             // Master seed of the derived wallets
+	Index   int                // Number of wallets derived from the seed
+}
+
+// NewWallets loads the wallets of a node, addressed on the network. It returns
+// ErrWalletFileNotFound if the node has no wallet file and ErrWalletFileCorrupt if the file cannot
+// be decoded.
+func NewWallets(nodeID string, network Network) (*Wallets, error) {
+	wallets := Wallets{Network: network}
+	wallets.Wallets = make(map[string]*Wallet)
+
+	err := wallets.LoadFromFile(nodeID)
+
+	return &wallets, err
+}
+
+// CreateWallet derives the next wallet from the seed, generating the seed on first use
+func (ws *Wallets) CreateWallet() (string, error) {
+	if len(ws.Seed) == 0 {
+		seed, err := NewSeed()
+		if err != nil {
+			return "", err
+		}
+
+		ws.Seed = seed
+		ws.Index = 0
+	}
+
+	return ws.deriveNext()
+}
+
+// WalletFileExists checks whether the node has a wallet file
+func WalletFileExists(nodeID string) bool {
+	walletFile := config.Path(fmt.Sprintf(walletFileFormat, nodeID))
+	_, err := os.Stat(walletFile)
+
+	return err == nil
+}
+
+// GetAddresses returns all addresses from the collection of wallets
+func (ws Wallets) GetAddresses() []string {
+	var addresses []string
+	for address := range ws.Wallets {
+		addresses = append(addresses, address)
+	}
+
+	return addresses
+}
+
+// GetWallet returns a wallet by its address, or ErrWalletNotFound if the address is not in the
+// collection.
+func (ws Wallets) GetWallet(address string) (*Wallet, error) {
+	wallet, ok := ws.Wallets[address]
+	if !ok {
+		return nil, errors.Wrapf(errors.ErrWalletNotFound, "address %s", address)
+	}
+
+	return wallet, nil
+}
+
+// LoadFromFile loads wallets from file. A missing file returns ErrWalletFileNotFound, which callers
+// may treat as an empty wallet, while a file that cannot be decoded returns ErrWalletFileCorrupt and
+// must not be overwritten.
+func (ws *Wallets) LoadFromFile(nodeID string) error {
+	walletFile := config.Path(fmt.Sprintf(walletFileFormat, nodeID))
+	fileContent, err := os.ReadFile(walletFile)
+	if os.IsNotExist(err) {
+		return errors.ErrWalletFileNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	var content storedWallets
+	gob.Register(elliptic.P256())
+	decoder := gob.NewDecoder(bytes.NewReader(fileContent))
+	err = decoder.Decode(&content)
+	if err != nil {
+		return errors.ErrWalletFileCorrupt
+	}
+
+	derived, err := NewWalletsFromSeed(content.Seed, content.Index, ws.Network)
+	if err != nil {
+		return errors.ErrWalletFileCorrupt
+	}
+
+	for address, wallet := range content.Wallets {
+		derived.Wallets[address] = wallet
+	}
+
+	*ws = *derived
+
+	return nil
+}
+
+// SaveToFile saves wallets to file. The file is written next to the wallet file then renamed over
+// it, so an interrupted write never leaves a truncated wallet file.
+func (ws Wallets) SaveToFile(nodeID string) error {
+	var content bytes.Buffer
+
+	derived, err := ws.derivedAddresses()
+	if err != nil {
+		return err
+	}
+
+	file := storedWallets{Wallets: make(map[string]*Wallet), Seed: ws.Seed, Index: ws.Index}
+	for address, wallet := range ws.Wallets {
+		if !derived[address] {
+			file.Wallets[address] = wallet
+		}
+	}
+
+	gob.Register(elliptic.P256())
+	encoder := gob.NewEncoder(&content)
+	err = encoder.Encode(file)
+	if err != nil {
+		return err
+	}
+
+	walletFile := config.Path(fmt.Sprintf(walletFileFormat, nodeID))
+	err = os.WriteFile(walletFile+".tmp", content.Bytes(), 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(walletFile+".tmp", walletFile)
+}
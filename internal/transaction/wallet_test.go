@@ -0,0 +1,106 @@
+package transaction
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/yanglinshu/glock/internal/config"
+	"github.com/yanglinshu/glock/internal/errors"
+)
+
+// newWalletFile saves a wallet file holding n derived wallets in a temporary data directory and
+// returns its path
+func newWalletFile(t *testing.T, nodeID string, n int) string {
+	t.Helper()
+
+	err := config.SetDataDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ws := &Wallets{Wallets: make(map[string]*Wallet), Network: Mainnet}
+	for i := 0; i < n; i++ {
+		_, err = ws.CreateWallet()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = ws.SaveToFile(nodeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return config.Path(fmt.Sprintf(walletFileFormat, nodeID))
+}
+
+func TestWalletFileRoundTrip(t *testing.T) {
+	newWalletFile(t, "3000", 3)
+
+	ws, err := NewWallets("3000", Mainnet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ws.Wallets) != 3 || ws.Index != 3 {
+		t.Fatalf("loaded %d wallets at index %d, want 3", len(ws.Wallets), ws.Index)
+	}
+
+	_, err = NewWallets("3001", Mainnet)
+	if !errors.Is(err, errors.ErrWalletFileNotFound) {
+		t.Fatalf("NewWallets of a node without a wallet file = %v, want ErrWalletFileNotFound", err)
+	}
+}
+
+func TestCorruptWalletFileRejected(t *testing.T) {
+	walletFile := newWalletFile(t, "3000", 2)
+
+	content, err := os.ReadFile(walletFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, corrupt := range map[string][]byte{
+		"empty":     {},
+		"truncated": content[:len(content)/2],
+		"last byte": content[:len(content)-1],
+		"garbage":   bytes.Repeat([]byte{0xde, 0xad, 0xbe, 0xef}, 64),
+		"text":      []byte("not a wallet file\n"),
+	} {
+		err = os.WriteFile(walletFile, corrupt, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = NewWallets("3000", Mainnet)
+		if !errors.Is(err, errors.ErrWalletFileCorrupt) {
+			t.Fatalf("NewWallets of a %s wallet file = %v, want ErrWalletFileCorrupt", name, err)
+		}
+	}
+}
+
+func TestGetWalletUnknownAddress(t *testing.T) {
+	ws := &Wallets{Wallets: make(map[string]*Wallet), Network: Mainnet}
+	address, err := ws.CreateWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := ws.GetWallet(address)
+	if err != nil || w == nil {
+		t.Fatalf("GetWallet(%s) = %v, %v, want the wallet", address, w, err)
+	}
+
+	other := &Wallets{Wallets: make(map[string]*Wallet), Network: Mainnet}
+	missing, err := other.CreateWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err = ws.GetWallet(missing)
+	if !errors.Is(err, errors.ErrWalletNotFound) || w != nil {
+		t.Fatalf("GetWallet of an address missing from the wallet = %v, %v, want ErrWalletNotFound", w, err)
+	}
+}
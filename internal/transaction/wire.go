@@ -0,0 +1,177 @@
+package transaction
+
+import (
+	"bytes"
+	"io"
+	"math"
+
+	"github.com/yanglinshu/glock/internal/errors"
+	"github.com/yanglinshu/glock/internal/util"
+)
+
+// wireMarker starts every transaction in the binary encoding. A gob stream never starts with a zero
+// byte, which tells the two encodings apart.
+const wireMarker = byte(0x00)
+
+// wireVersion is the version of the binary encoding
+const wireVersion = byte(0x01)
+
+// maxWireLength bounds the length of any variable-length field or list in the binary encoding
+const maxWireLength = 1 << 20
+
+// The binary encoding of a transaction lays its fields out in a fixed order, integers in big endian
+// and byte strings prefixed with their 32-bit length:
+//
+//	marker | version byte | Version (uint32) | ID
+//	input count (uint32)  | per input:  Txid | Vout (int64) | Signature | PublicKey
+//	output count (uint32) | per output: Value (int64) | PublicKeyHash | Data
+
+// encodeWire returns the binary encoding of the transaction. A field the encoding cannot represent,
+// or that decodeWire would refuse, returns ErrUnencodable rather than encoding a transaction no
+// node can read back.
+func (tx *Transaction) encodeWire() ([]byte, error) {
+	err := tx.checkEncodable()
+	if err != nil {
+		return nil, err
+	}
+
+	var buff bytes.Buffer
+
+	buff.WriteByte(wireMarker)
+	buff.WriteByte(wireVersion)
+	util.WriteUint32(&buff, uint32(tx.Version))
+	util.WriteBytes(&buff, tx.ID)
+
+	util.WriteUint32(&buff, uint32(len(tx.Vin)))
+	for _, in := range tx.Vin {
+		util.WriteBytes(&buff, in.Txid)
+		util.WriteInt64(&buff, int64(in.Vout))
+		util.WriteBytes(&buff, in.Signature)
+		util.WriteBytes(&buff, in.PublicKey)
+	}
+
+	util.WriteUint32(&buff, uint32(len(tx.Vout)))
+	for _, out := range tx.Vout {
+		util.WriteInt64(&buff, int64(out.Value))
+		util.WriteBytes(&buff, out.PublicKeyHash)
+		util.WriteBytes(&buff, out.Data)
+	}
+
+	return buff.Bytes(), nil
+}
+
+// checkEncodable returns ErrUnencodable naming the first field of the transaction beyond the
+// bounds of the binary encoding.
+func (tx *Transaction) checkEncodable() error {
+	if tx.Version < 0 || int64(tx.Version) > math.MaxUint32 {
+		return errors.Wrapf(errors.ErrUnencodable, "version %d", tx.Version)
+	}
+
+	if len(tx.ID) > maxWireLength {
+		return errors.Wrapf(errors.ErrUnencodable, "ID of %d bytes", len(tx.ID))
+	}
+
+	if len(tx.Vin) > maxWireLength || len(tx.Vout) > maxWireLength {
+		return errors.Wrapf(errors.ErrUnencodable, "%d inputs and %d outputs", len(tx.Vin), len(tx.Vout))
+	}
+
+	for i, in := range tx.Vin {
+		for _, field := range [][]byte{in.Txid, in.Signature, in.PublicKey} {
+			if len(field) > maxWireLength {
+				return errors.Wrapf(errors.ErrUnencodable, "input %d holds a field of %d bytes", i, len(field))
+			}
+		}
+	}
+
+	for i, out := range tx.Vout {
+		for _, field := range [][]byte{out.PublicKeyHash, out.Data} {
+			if len(field) > maxWireLength {
+				return errors.Wrapf(errors.ErrUnencodable, "output %d holds a field of %d bytes", i, len(field))
+			}
+		}
+	}
+
+	return nil
+}
+
+// decodeWire decodes a transaction from its binary encoding.
+func decodeWire(data []byte) (Transaction, error) {
+	var tx Transaction
+	r := bytes.NewReader(data)
+
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil || header[0] != wireMarker || header[1] != wireVersion {
+		return Transaction{}, errors.ErrInvalidEncoding
+	}
+
+	version, err := util.ReadUint32(r)
+	if err != nil {
+		return Transaction{}, err
+	}
+	tx.Version = int(version)
+
+	tx.ID, err = util.ReadBytes(r, maxWireLength)
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	inputs, err := util.ReadLength(r, maxWireLength)
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	for i := 0; i < inputs; i++ {
+		var in TXInput
+
+		if in.Txid, err = util.ReadBytes(r, maxWireLength); err != nil {
+			return Transaction{}, err
+		}
+
+		vout, err := util.ReadInt64(r)
+		if err != nil {
+			return Transaction{}, err
+		}
+		in.Vout = int(vout)
+
+		if in.Signature, err = util.ReadBytes(r, maxWireLength); err != nil {
+			return Transaction{}, err
+		}
+
+		if in.PublicKey, err = util.ReadBytes(r, maxWireLength); err != nil {
+			return Transaction{}, err
+		}
+
+		tx.Vin = append(tx.Vin, in)
+	}
+
+	outputs, err := util.ReadLength(r, maxWireLength)
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	for i := 0; i < outputs; i++ {
+		var out TXOutput
+
+		value, err := util.ReadInt64(r)
+		if err != nil {
+			return Transaction{}, err
+		}
+		out.Value = int(value)
+
+		if out.PublicKeyHash, err = util.ReadBytes(r, maxWireLength); err != nil {
+			return Transaction{}, err
+		}
+
+		if out.Data, err = util.ReadBytes(r, maxWireLength); err != nil {
+			return Transaction{}, err
+		}
+
+		tx.Vout = append(tx.Vout, out)
+	}
+
+	if r.Len() != 0 {
+		return Transaction{}, errors.ErrInvalidEncoding
+	}
+
+	return tx, nil
+}
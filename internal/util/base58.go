@@ -1,61 +1,68 @@
-// https://github.com/Jeiwan/blockchain_go/blob/f35aa3c3cacd9be7b2a6f31d0f550bcaf31c6e53/base58.go
-
-package util
-
-import (
-	"bytes"
-	"math/big"
-)
-
-var b58Alphabet = []byte("123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz")
-
-// Base58Encode encodes a byte array to Base58
-func Base58Encode(input []byte) []byte {
-	var result []byte
-
-	x := big.NewInt(0).SetBytes(input)
-
-	base := big.NewInt(int64(len(b58Alphabet)))
-	zero := big.NewInt(0)
-	mod := &big.Int{}
-
-	for x.Cmp(zero) != 0 {
-		x.DivMod(x, base, mod)
-		result = append(result, b58Alphabet[mod.Int64()])
-	}
-
-	ReverseBytes(result)
-	for b := range input {
-		if b == 0x00 {
-			result = append([]byte{b58Alphabet[0]}, result...)
-		} else {
-			break
-		}
-	}
-
-	return result
-}
-
-// Base58Decode decodes Base58-encoded data
-func Base58Decode(input []byte) []byte {
-	result := big.NewInt(0)
-	zeroBytes := 0
-
-	for b := range input {
-		if b == 0x00 {
-			zeroBytes++
-		}
-	}
-
-	payload := input[zeroBytes:]
-	for _, b := range payload {
-		charIndex := bytes.IndexByte(b58Alphabet, b)
-		result.Mul(result, big.NewInt(58))
-		result.Add(result, big.NewInt(int64(charIndex)))
-	}
-
-	decoded := result.Bytes()
-	decoded = append(bytes.Repeat([]byte{byte(0x00)}, zeroBytes), decoded...)
-
-	return decoded
-}
+// https://github.com/Jeiwan/blockchain_go/blob/f35aa3c3cacd9be7b2a6f31d0f550bcaf31c6e53/base58.go
+
+package util
+
+import (
+	"bytes"
+	"math/big"
+
+	"github.com/yanglinshu/glock/internal/errors"
+)
+
+var b58Alphabet = []byte("123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz")
+
+// Base58Encode encodes a byte array to Base58, each leading zero byte giving a '1'
+func Base58Encode(input []byte) []byte {
+	var result []byte
+
+	x := big.NewInt(0).SetBytes(input)
+
+	base := big.NewInt(int64(len(b58Alphabet)))
+	zero := big.NewInt(0)
+	mod := &big.Int{}
+
+	for x.Cmp(zero) != 0 {
+		x.DivMod(x, base, mod)
+		result = append(result, b58Alphabet[mod.Int64()])
+	}
+
+	ReverseBytes(result)
+	for _, b := range input {
+		if b == 0x00 {
+			result = append([]byte{b58Alphabet[0]}, result...)
+		} else {
+			break
+		}
+	}
+
+	return result
+}
+
+// Base58Decode decodes Base58-encoded data, each leading '1' giving a zero byte. Input with a
+// character outside the alphabet returns ErrInvalidBase58.
+func Base58Decode(input []byte) ([]byte, error) {
+	result := big.NewInt(0)
+	zeroBytes := 0
+
+	for _, b := range input {
+		if b != b58Alphabet[0] {
+			break
+		}
+		zeroBytes++
+	}
+
+	payload := input[zeroBytes:]
+	for _, b := range payload {
+		charIndex := bytes.IndexByte(b58Alphabet, b)
+		if charIndex < 0 {
+			return nil, errors.ErrInvalidBase58
+		}
+		result.Mul(result, big.NewInt(58))
+		result.Add(result, big.NewInt(int64(charIndex)))
+	}
+
+	decoded := result.Bytes()
+	decoded = append(bytes.Repeat([]byte{byte(0x00)}, zeroBytes), decoded...)
+
+	return decoded, nil
+}
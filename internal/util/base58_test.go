@@ -0,0 +1,84 @@
+package util
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/yanglinshu/glock/internal/errors"
+)
+
+// base58Vectors are the encodings of the Bitcoin Core test vectors, with the address of the genesis
+// block of Bitcoin
+var base58Vectors = []struct {
+	hex     string
+	encoded string
+}{
+	{"", ""},
+	{"61", "2g"},
+	{"626262", "a3gV"},
+	{"636363", "aPEr"},
+	{"73696d706c792061206c6f6e6720737472696e67", "2cFupjhnEsSn59qHXstmK2ffpLv2"},
+	{"00eb15231dfceb60925886b67d065299925915aeb172c06647", "1NS17iag9jJgTHD1VXjvLCEnZuQ3rJDE9L"},
+	{"516b6fcd0f", "ABnLTmg"},
+	{"bf4f89001e670274dd", "3SEo3LWLoPntC"},
+	{"572e4794", "3EFU7m"},
+	{"ecac89cad93923c02321", "EJDM8drfXA6uyA"},
+	{"10c8511e", "Rt5zm"},
+	{"00000000000000000000", "1111111111"},
+	{"0062e907b15cbf27d5425399ebf6f0fb50ebb88f18c29b7d93", "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"},
+}
+
+func TestBase58Vectors(t *testing.T) {
+	for _, v := range base58Vectors {
+		data, err := hex.DecodeString(v.hex)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if encoded := Base58Encode(data); string(encoded) != v.encoded {
+			t.Fatalf("Base58Encode(%s) = %q, want %q", v.hex, encoded, v.encoded)
+		}
+
+		decoded, err := Base58Decode([]byte(v.encoded))
+		if err != nil {
+			t.Fatalf("Base58Decode(%q): %v", v.encoded, err)
+		}
+
+		if !bytes.Equal(decoded, data) {
+			t.Fatalf("Base58Decode(%q) = %x, want %s", v.encoded, decoded, v.hex)
+		}
+	}
+}
+
+func TestBase58RoundTripKeepsLeadingZeros(t *testing.T) {
+	for zeros := 0; zeros <= 4; zeros++ {
+		for _, tail := range [][]byte{nil, {0x01}, {0xff, 0x00}, bytes.Repeat([]byte{0xab}, 25)} {
+			data := append(make([]byte, zeros), tail...)
+
+			encoded := Base58Encode(data)
+			if !bytes.HasPrefix(encoded, bytes.Repeat([]byte{'1'}, zeros)) {
+				t.Fatalf("Base58Encode(%x) = %q, want %d leading '1'", data, encoded, zeros)
+			}
+
+			decoded, err := Base58Decode(encoded)
+			if err != nil {
+				t.Fatalf("Base58Decode(%q): %v", encoded, err)
+			}
+
+			if !bytes.Equal(decoded, data) {
+				t.Fatalf("Base58Decode(Base58Encode(%x)) = %x", data, decoded)
+			}
+		}
+	}
+}
+
+func TestBase58DecodeRejectsInvalidCharacters(t *testing.T) {
+	// 0, O, I and l are left out of the alphabet
+	for _, input := range []string{"0", "O", "I", "l", "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfN0", "2g ", "a3g+V", "é"} {
+		decoded, err := Base58Decode([]byte(input))
+		if !errors.Is(err, errors.ErrInvalidBase58) {
+			t.Fatalf("Base58Decode(%q) = %x, %v, want ErrInvalidBase58", input, decoded, err)
+		}
+	}
+}
@@ -1,32 +1,42 @@
-package util
-
-import (
-	"bytes"
-	"encoding/gob"
-	"fmt"
-)
-
-// IntToHex converts an integer to a hexadecimal byte array.
-func IntToHex(n int64) []byte {
-	return []byte(fmt.Sprintf("%x", n))
-}
-
-// ReverseBytes reverses a byte array
-func ReverseBytes(data []byte) {
-	for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
-		data[i], data[j] = data[j], data[i]
-	}
-}
-
-// gobEncode encodes a data structure into a byte array.
-func GobEncode(data any) ([]byte, error) {
-	var buff bytes.Buffer
-
-	enc := gob.NewEncoder(&buff)
-	err := enc.Encode(data)
-	if err != nil {
-		return nil, err
-	}
-
-	return buff.Bytes(), nil
-}
+package util
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+)
+
+// IntToHex converts an integer to a hexadecimal byte array. Its length depends on the magnitude of
+// the integer, so it is only kept for the proof-of-work of legacy blocks.
+func IntToHex(n int64) []byte {
+	return []byte(fmt.Sprintf("%x", n))
+}
+
+// Int64ToBytes converts an integer to its fixed-width, 8-byte big-endian encoding.
+func Int64ToBytes(n int64) []byte {
+	var buff [8]byte
+	binary.BigEndian.PutUint64(buff[:], uint64(n))
+
+	return buff[:]
+}
+
+// ReverseBytes reverses a byte array
+func ReverseBytes(data []byte) {
+	for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
+		data[i], data[j] = data[j], data[i]
+	}
+}
+
+// gobEncode encodes a data structure into a byte array.
+func GobEncode(data any) ([]byte, error) {
+	var buff bytes.Buffer
+
+	enc := gob.NewEncoder(&buff)
+	err := enc.Encode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return buff.Bytes(), nil
+}
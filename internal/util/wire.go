@@ -0,0 +1,86 @@
+package util
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/yanglinshu/glock/internal/errors"
+)
+
+// The binary encodings of blocks and transactions lay integers out in big endian and prefix byte
+// strings and lists with their 32-bit length. Truncated or oversized data decodes to
+// ErrInvalidEncoding.
+
+// WriteUint32 appends a 32-bit unsigned integer.
+func WriteUint32(buff *bytes.Buffer, v uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	buff.Write(b[:])
+}
+
+// WriteInt64 appends a 64-bit signed integer.
+func WriteInt64(buff *bytes.Buffer, v int64) {
+	buff.Write(Int64ToBytes(v))
+}
+
+// WriteBytes appends a byte string prefixed with its length.
+func WriteBytes(buff *bytes.Buffer, data []byte) {
+	WriteUint32(buff, uint32(len(data)))
+	buff.Write(data)
+}
+
+// ReadUint32 reads a 32-bit unsigned integer.
+func ReadUint32(r *bytes.Reader) (uint32, error) {
+	var b [4]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return 0, errors.ErrInvalidEncoding
+	}
+
+	return binary.BigEndian.Uint32(b[:]), nil
+}
+
+// ReadInt64 reads a 64-bit signed integer.
+func ReadInt64(r *bytes.Reader) (int64, error) {
+	var b [8]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return 0, errors.ErrInvalidEncoding
+	}
+
+	return int64(binary.BigEndian.Uint64(b[:])), nil
+}
+
+// ReadLength reads the length of a field or list, rejecting lengths beyond max or beyond the
+// remaining data.
+func ReadLength(r *bytes.Reader, max int) (int, error) {
+	n, err := ReadUint32(r)
+	if err != nil {
+		return 0, err
+	}
+
+	if int64(n) > int64(max) || int(n) > r.Len() {
+		return 0, errors.ErrInvalidEncoding
+	}
+
+	return int(n), nil
+}
+
+// ReadBytes reads a byte string prefixed with its length, at most max bytes long. Empty strings are
+// read as nil.
+func ReadBytes(r *bytes.Reader, max int) ([]byte, error) {
+	n, err := ReadLength(r, max)
+	if err != nil {
+		return nil, err
+	}
+
+	if n == 0 {
+		return nil, nil
+	}
+
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, errors.ErrInvalidEncoding
+	}
+
+	return data, nil
+}
@@ -0,0 +1,92 @@
+package util
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/yanglinshu/glock/internal/errors"
+)
+
+func TestWireRoundTrip(t *testing.T) {
+	var buff bytes.Buffer
+	WriteUint32(&buff, 0xdeadbeef)
+	WriteInt64(&buff, -42)
+	WriteBytes(&buff, []byte("glock"))
+	WriteBytes(&buff, nil)
+
+	want := []byte{
+		0xde, 0xad, 0xbe, 0xef,
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xd6,
+		0x00, 0x00, 0x00, 0x05, 'g', 'l', 'o', 'c', 'k',
+		0x00, 0x00, 0x00, 0x00,
+	}
+	if !bytes.Equal(buff.Bytes(), want) {
+		t.Fatalf("encoding = %x, want %x", buff.Bytes(), want)
+	}
+
+	r := bytes.NewReader(buff.Bytes())
+
+	u, err := ReadUint32(r)
+	if err != nil || u != 0xdeadbeef {
+		t.Fatalf("ReadUint32 = %#x, %v", u, err)
+	}
+
+	i, err := ReadInt64(r)
+	if err != nil || i != -42 {
+		t.Fatalf("ReadInt64 = %d, %v", i, err)
+	}
+
+	data, err := ReadBytes(r, 16)
+	if err != nil || string(data) != "glock" {
+		t.Fatalf("ReadBytes = %q, %v", data, err)
+	}
+
+	data, err = ReadBytes(r, 16)
+	if err != nil || data != nil {
+		t.Fatalf("ReadBytes of an empty string = %v, %v, want nil", data, err)
+	}
+
+	if r.Len() != 0 {
+		t.Fatalf("%d bytes left after decoding", r.Len())
+	}
+}
+
+func TestWireRejectsBadLengths(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		max  int
+	}{
+		{"truncated length", []byte{0x00, 0x00}, 16},
+		{"length beyond the data", []byte{0x00, 0x00, 0x00, 0x04, 'a', 'b'}, 16},
+		{"length beyond the limit", []byte{0x00, 0x00, 0x00, 0x02, 'a', 'b'}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadBytes(bytes.NewReader(tt.data), tt.max)
+			if !errors.Is(err, errors.ErrInvalidEncoding) {
+				t.Fatalf("ReadBytes = %v, want ErrInvalidEncoding", err)
+			}
+		})
+	}
+
+	_, err := ReadInt64(bytes.NewReader([]byte{0x01, 0x02, 0x03}))
+	if !errors.Is(err, errors.ErrInvalidEncoding) {
+		t.Fatalf("ReadInt64 of truncated data = %v, want ErrInvalidEncoding", err)
+	}
+}
+
+func TestInt64ToBytesFixedWidth(t *testing.T) {
+	for n, want := range map[int64][]byte{
+		0:          {0, 0, 0, 0, 0, 0, 0, 0},
+		1:          {0, 0, 0, 0, 0, 0, 0, 1},
+		-1:         {0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		1700000000: {0, 0, 0, 0, 0x65, 0x53, 0xf1, 0x00},
+		1 << 62:    {0x40, 0, 0, 0, 0, 0, 0, 0},
+	} {
+		if got := Int64ToBytes(n); !bytes.Equal(got, want) {
+			t.Fatalf("Int64ToBytes(%d) = %x, want %x", n, got, want)
+		}
+	}
+}